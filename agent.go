@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// agentMain is the entry point of the 'agent' command.
+func agentMain(args []string) {
+	// Parse the command line:
+	var options dummy.AgentOptions
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	address := flags.String("listen", dummy.DefaultAgentAddress, "Address where the agent listens for workloads.")
+	flags.StringVar(&options.Name, "name", "", "Name of the agent in the results. Default is the pod or host name.")
+	flags.StringVar(&options.Token, "token", os.Getenv(dummy.AgentTokenEnv), fmt.Sprintf(
+		"Secret that the orchestrator has to present. Default is the value of the '%s' environment variable.",
+		dummy.AgentTokenEnv,
+	))
+	crtFile := flags.String("tls-cert", "", "File containing the TLS certificate. Default is the built-in one.")
+	keyFile := flags.String("tls-key", "", "File containing the TLS key. Default is the built-in one.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s agent [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Waits for workloads sent by the 'orchestrate' command, runs them against the "+
+			"target and returns the results. The control channel uses TLS and a shared token.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// Prepare the logger:
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	// Run the agent till it receives a termination signal:
+	agent, err := dummy.NewAgent(logger, options)
+	if err != nil {
+		logger.Error(
+			"Failed to create agent",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = agent.ListenAndServe(ctx, *address, *crtFile, *keyFile)
+	if err != nil {
+		logger.Error(
+			"Failed to run agent",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// benchMain is the entry point of the 'bench' command.
+func benchMain(args []string) {
+	// Parse the command line:
+	var options dummy.BenchOptions
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	flags.IntVar(&options.Connections, "connections", dummy.DefaultBenchConnections, "Number of concurrent connections.")
+	flags.DurationVar(&options.Duration, "duration", dummy.DefaultBenchDuration, "Duration of the run.")
+	flags.IntVar(&options.Size, "size", 0,
+		"Size of the data requested in each request. Zero means the server default.")
+	flags.IntVar(&options.Buffer, "buffer", dummy.DefaultBufferSize, "Size of the buffer used to read the data.")
+	addTransportFlags(flags, &options.Transport, dummy.BenchProtocolHTTP1)
+	flags.DurationVar(&options.Warmup, "warmup", 0,
+		"Duration of the initial phase whose requests are excluded from the results. Default is no warm up.")
+	flags.Float64Var(&options.SteadyState, "steady-state", 0, "Maximum coefficient of variation of the throughput "+
+		"of the last five seconds for the load to be considered steady. The warm up is extended till then, at most "+
+		"for the duration of the run. Zero means no detection.")
+	compare := flags.Bool("compare", false, "Run the same workload against two URLs, one after the other, and "+
+		"report the differences of the metrics and whether they are statistically significant.")
+	reuse := flags.Bool("reuse", false, "Instead of a load test, measure the cost of opening connections: send "+
+		"small requests over a reused connection, over new connections with TLS session resumption, and over new "+
+		"connections with full handshakes. The default size is 1 KiB. Note that sessions aren't resumed if the "+
+		"certificate of the server has expired.")
+	requests := flags.Int("requests", dummy.DefaultBenchReuseRequests,
+		"Number of requests of each phase of the '--reuse' mode.")
+	fleetTargets := flags.String("targets", "", "Set to 'all' to discover the servers of the fleet of the URL and "+
+		"distribute the connections across them, reporting the results of each server.")
+	discovery := flags.String("discovery", dummy.FleetDiscoveryAPI, fmt.Sprintf(
+		"How to discover the servers when '--targets' is 'all': '%s' asks the fleet endpoint of the server, and "+
+			"'%s' uses the addresses of the host name of the URL, usually a headless service.",
+		dummy.FleetDiscoveryAPI, dummy.FleetDiscoveryDNS,
+	))
+	output := flags.String("output", outputJSON, fmt.Sprintf(
+		"Format of the result, '%s', '%s' with a row per connection, or per phase in the '--reuse' mode, or '%s' "+
+			"for humans.",
+		outputJSON, outputCSV, outputTable,
+	))
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s bench [flags] URL\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s bench --compare [flags] URL_A URL_B\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s bench --reuse [flags] URL\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s bench --targets=all [flags] URL\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Sends requests to the server from several concurrent connections and writes the "+
+			"aggregated and per connection measurements as a JSON document, or in the format selected with the "+
+			"'--output' flag.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	targets := 1
+	if *compare {
+		targets = 2
+	}
+	if flags.NArg() != targets {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	// Prepare the logger. Note that the log goes to the standard error, as the standard output is for the results.
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	err := checkOutputFormat(*output)
+	if err != nil {
+		logger.Error(
+			"Invalid output format",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+
+	// Running against all the servers of the fleet is also a different kind of benchmark:
+	switch *fleetTargets {
+	case "":
+	case "all":
+		if *compare || *reuse {
+			logger.Error("The '--targets' flag can't be used with the '--compare' or '--reuse' flags")
+			os.Exit(1)
+		}
+		runFleetBench(logger, options, flags.Arg(0), *discovery, *output)
+		return
+	default:
+		logger.Error(
+			"Invalid targets, the only supported value is 'all'",
+			slog.String("targets", *fleetTargets),
+		)
+		os.Exit(1)
+	}
+
+	// The connection reuse mode is a different kind of benchmark:
+	if *reuse {
+		if options.Size == 0 {
+			options.Size = dummy.DefaultBenchReuseSize
+		}
+		runReuse(logger, options, flags.Arg(0), *requests, *output)
+		return
+	}
+
+	// Run the benchmarks, one after the other so that they don't compete for the resources of the machine:
+	results := make([]*dummy.BenchResult, targets)
+	for i := range results {
+		results[i] = runBench(logger, options, flags.Arg(i))
+	}
+
+	// Write the result:
+	if *compare {
+		err = writeBenchComparison(os.Stdout, *output, dummy.CompareBench(results[0], results[1]))
+	} else {
+		err = writeBenchResult(os.Stdout, *output, results[0])
+	}
+	if err != nil {
+		logger.Error(
+			"Failed to write result",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	for _, result := range results {
+		if result.Errors > 0 {
+			os.Exit(1)
+		}
+	}
+}
+
+// runBench runs the benchmark against the given target, and exits if that fails.
+func runBench(logger *slog.Logger, options dummy.BenchOptions, target string) *dummy.BenchResult {
+	options.Target = target
+	bench, err := dummy.NewBench(logger, options)
+	if err != nil {
+		logger.Error(
+			"Failed to create benchmark",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	result, err := bench.Run(context.Background())
+	if err != nil {
+		logger.Error(
+			"Failed to run benchmark",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	return result
+}
+
+// runReuse runs the benchmark in connection reuse mode against the given target and writes the result.
+func runReuse(logger *slog.Logger, options dummy.BenchOptions, target string, requests int, output string) {
+	options.Target = target
+	bench, err := dummy.NewBench(logger, options)
+	if err != nil {
+		logger.Error(
+			"Failed to create benchmark",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	result, err := bench.RunReuse(context.Background(), requests)
+	if err != nil {
+		logger.Error(
+			"Failed to run benchmark",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	err = writeReuseResult(os.Stdout, output, result)
+	if err != nil {
+		logger.Error(
+			"Failed to write result",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	for _, phase := range result.Phases {
+		if phase.Errors > 0 {
+			os.Exit(1)
+		}
+	}
+}
+
+// runFleetBench discovers the servers of the fleet of the given target, runs the benchmark against all of them and
+// writes the result.
+func runFleetBench(logger *slog.Logger, options dummy.BenchOptions, target, discovery, output string) {
+	ctx := context.Background()
+	targets, err := dummy.DiscoverFleet(ctx, target, discovery, options.Transport)
+	if err != nil {
+		logger.Error(
+			"Failed to discover fleet",
+			slog.String("target", target),
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	for _, fleetTarget := range targets {
+		logger.Info(
+			"Discovered fleet target",
+			slog.String("id", fleetTarget.ID),
+			slog.String("target", fleetTarget.Target),
+		)
+	}
+	bench, err := dummy.NewFleetBench(logger, options, targets)
+	if err != nil {
+		logger.Error(
+			"Failed to create benchmark",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	result, err := bench.Run(ctx)
+	if err != nil {
+		logger.Error(
+			"Failed to run benchmark",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	err = writeFleetBenchResult(os.Stdout, output, result)
+	if err != nil {
+		logger.Error(
+			"Failed to write result",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	if result.Errors > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// clientMain is the entry point of the 'client' command.
+func clientMain(args []string) {
+	// Parse the command line:
+	flags := flag.NewFlagSet("client", flag.ExitOnError)
+	size := flags.Int("size", 0, "Size of the data requested from the server. Zero means the server default.")
+	buffer := flags.Int("buffer", dummy.DefaultBufferSize, "Size of the buffer used to read the data.")
+	pattern := flags.String("pattern", "", "Data pattern requested from the server.")
+	count := flags.Int("count", 1, "Number of downloads.")
+	upload := flags.Bool("upload", false, "Upload pseudo random data instead of downloading. The size is mandatory.")
+	digest := flags.String("digest", "", "Digest algorithm used to verify uploads, 'sha256', 'crc32' or 'xxh3'. "+
+		"The default is to not verify.")
+	streams := flags.Int("streams", 1, "Number of parallel range requests, each in its own connection, used for "+
+		"each download. Note that ranges require deterministic data, so a random seed is added to the URL if it "+
+		"doesn't select a seed or a pattern.")
+	clock := flags.Int("clock", 0, "Number of exchanges with the server used to estimate the offset between the "+
+		"clocks of the client and the server. Zero means no estimation.")
+	ping := flags.Int("ping", 0, "Number of pings sent to the server before the downloads. They are ICMP echo "+
+		"requests if the process has permission to send them, otherwise the time to establish TCP connections is "+
+		"measured. Zero means no pings. Use '--count=0' to only check the reachability.")
+	traceroute := flags.Bool("traceroute", false, "Find the hops of the path to the server, and their latency, "+
+		"before the downloads. Needs permission to open raw ICMP sockets.")
+	maxHops := flags.Int("max-hops", dummy.DefaultMaxHops, "Maximum number of hops explored by '--traceroute'.")
+	mtu := flags.Bool("mtu", false, "Discover the path MTU to the server, sending ICMP echo requests of different "+
+		"sizes that can't be fragmented, and detect blackholes that drop large packets without telling the sender. "+
+		"Needs permission to open raw ICMP sockets, and is only supported in Linux.")
+	mtuMax := flags.Int("mtu-max", dummy.DefaultMTUMax, "Largest packet size tried by '--mtu'.")
+	progress := flags.Duration("progress", 0, "Interval between the progress messages written to the log during "+
+		"each transfer. The records are also added to the results. Zero means no progress messages.")
+	output := flags.String("output", outputJSON, fmt.Sprintf(
+		"Format of the results, '%s' with a document per line, '%s' with a row per download, or per progress "+
+			"interval if '--progress' is used, or '%s' for humans.",
+		outputJSON, outputCSV, outputTable,
+	))
+	var transport dummy.TransportOptions
+	addTransportFlags(flags, &transport, "")
+	asJob := flags.Bool("as-k8s-job", false, "Print a Kubernetes job that runs the client inside the cluster.")
+	jobName := flags.String("job-name", "dummy-client", "Name of the Kubernetes job.")
+	jobNamespace := flags.String("job-namespace", "", "Namespace of the Kubernetes job.")
+	jobImage := flags.String("job-image", dummy.DefaultImage, "Image used by the Kubernetes job.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s client [flags] URL\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Downloads data from the server and writes the measurements as JSON documents, "+
+			"one per line, or in the format selected with the '--output' flag.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	target := flags.Arg(0)
+
+	// Prepare the logger. Note that the log goes to the standard error, as the standard output is for the results.
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	// If requested generate the Kubernetes job and stop there. The job runs this same command, with the same flags,
+	// except the ones that control the job itself.
+	if *asJob {
+		jobArgs := []string{"client"}
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "as-k8s-job", "job-name", "job-namespace", "job-image":
+			default:
+				jobArgs = append(jobArgs, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+			}
+		})
+		jobArgs = append(jobArgs, target)
+		err := dummy.WriteClientJob(os.Stdout, *jobName, *jobNamespace, *jobImage, jobArgs)
+		if err != nil {
+			logger.Error(
+				"Failed to write job",
+				slog.String("error", err.Error()),
+			)
+			os.Exit(1)
+		}
+		return
+	}
+
+	err := checkOutputFormat(*output)
+	if err != nil {
+		logger.Error(
+			"Invalid output format",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	if *upload && *size == 0 {
+		logger.Error("Size is mandatory for uploads")
+		os.Exit(1)
+	}
+
+	// Add the query parameters to the target address:
+	address, err := dummy.ClientAddress(target, *size, *pattern)
+	if err != nil {
+		logger.Error(
+			"Failed to parse target URL",
+			slog.String("url", target),
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+
+	// Create the client:
+	client, err := dummy.NewClientWithTransport(transport, *buffer)
+	if err != nil {
+		logger.Error(
+			"Failed to create client",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	client.SetProgress(*progress, func(record *dummy.ProgressRecord) {
+		logger.Info(
+			"Transfer progress",
+			slog.Int64("bytes", record.Bytes),
+			slog.Int64("total", record.Total),
+			slog.Float64("rate", record.Rate),
+			slog.String("elapsed", time.Duration(record.Elapsed).String()),
+		)
+	})
+
+	// Estimate the clock offset if requested:
+	var estimate *dummy.ClockEstimate
+	if *clock > 0 {
+		estimate, err = client.EstimateClock(context.Background(), target, *clock)
+		if err != nil {
+			logger.Error(
+				"Failed to estimate clock offset",
+				slog.String("error", err.Error()),
+			)
+			os.Exit(1)
+		}
+		logger.Info(
+			"Estimated clock offset",
+			slog.String("offset", time.Duration(estimate.Offset).String()),
+			slog.String("delay", time.Duration(estimate.Delay).String()),
+		)
+	}
+
+	// Check the reachability if requested:
+	var reach *dummy.ReachReport
+	if *ping > 0 || *traceroute || *mtu {
+		reach, err = checkReach(logger, target, *ping, *traceroute, *maxHops, *mtu, *mtuMax)
+		if err != nil {
+			logger.Error(
+				"Failed to check reachability",
+				slog.String("error", err.Error()),
+			)
+			os.Exit(1)
+		}
+	}
+
+	// Run the downloads and write the results:
+	writer := newClientWriter(os.Stdout, *output, *progress > 0)
+	failed := false
+	for i := 0; i < *count; i++ {
+		var result *dummy.ClientResult
+		switch {
+		case *upload:
+			result = client.Upload(context.Background(), target, int64(*size), *digest)
+		case *streams > 1:
+			result = client.DownloadParallel(context.Background(), address, *streams)
+		default:
+			result = client.Download(context.Background(), address)
+		}
+		result.Clock = estimate
+		result.Reach = reach
+		if result.Error != "" || (result.Status != http.StatusOK && result.Status != http.StatusPartialContent) {
+			failed = true
+		}
+		err = writer.Write(result)
+		if err != nil {
+			logger.Error(
+				"Failed to write result",
+				slog.String("error", err.Error()),
+			)
+			os.Exit(1)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		logger.Error(
+			"Failed to write results",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checkReach pings the server, finds the hops of the path to it and discovers the path MTU, writing the results to the
+// log.
+func checkReach(logger *slog.Logger, target string, ping int, traceroute bool, maxHops int, mtu bool,
+	mtuMax int) (result *dummy.ReachReport, err error) {
+	ctx := context.Background()
+	options := dummy.ReachOptions{
+		MaxHops: maxHops,
+	}
+	result = &dummy.ReachReport{}
+	if ping > 0 {
+		result.Ping, err = dummy.ReachPing(ctx, target, ping, options)
+		if err != nil {
+			return
+		}
+		logger.Info(
+			"Pinged server",
+			slog.String("method", result.Ping.Method),
+			slog.String("address", result.Ping.Address),
+			slog.Int("sent", result.Ping.Sent),
+			slog.Int("received", result.Ping.Received),
+			slog.String("min", time.Duration(result.Ping.Min).String()),
+			slog.String("avg", time.Duration(result.Ping.Avg).String()),
+			slog.String("max", time.Duration(result.Ping.Max).String()),
+		)
+	}
+	if traceroute {
+		result.Traceroute, err = dummy.Traceroute(ctx, target, options)
+		if err != nil {
+			return
+		}
+		for _, hop := range result.Traceroute {
+			logger.Info(
+				"Found hop",
+				slog.Int("ttl", hop.TTL),
+				slog.String("address", hop.Address),
+				slog.String("rtt", time.Duration(hop.RTT).String()),
+			)
+		}
+	}
+	if mtu {
+		result.MTU, err = dummy.DiscoverMTU(ctx, target, mtuMax, options)
+		if err != nil {
+			return
+		}
+		logger.Info(
+			"Discovered path MTU",
+			slog.String("address", result.MTU.Address),
+			slog.Int("mtu", result.MTU.MTU),
+			slog.String("reporter", result.MTU.Reporter),
+			slog.Bool("blackhole", result.MTU.Blackhole),
+		)
+		if result.MTU.Blackhole {
+			logger.Warn(
+				"Larger packets are dropped without telling the sender, this usually breaks the path MTU "+
+					"discovery of TCP",
+				slog.Int("mtu", result.MTU.MTU),
+			)
+		}
+	}
+	return
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// conformanceMain is the entry point of the 'conformance' command.
+func conformanceMain(args []string) {
+	// Parse the command line:
+	flags := flag.NewFlagSet("conformance", flag.ExitOnError)
+	target := flags.String("target", "", "URL of the server to check.")
+	insecure := flags.Bool("insecure", false, "Don't verify the TLS certificate of the server.")
+	timeout := flags.Duration("timeout", dummy.DefaultConformanceTimeout, "Time limit for each check.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s conformance --target URL [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Checks that the server, and the proxies in front of it, behave as specified, and "+
+			"writes the results as JSON documents, one per line.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *target == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	// Prepare the logger. Note that the log goes to the standard error, as the standard output is for the results.
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	// Create the suite:
+	suite, err := dummy.NewConformanceSuite(logger, *target, *insecure, *timeout)
+	if err != nil {
+		logger.Error(
+			"Failed to create conformance suite",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+
+	// Run the checks and write the results, one JSON document per line:
+	encoder := json.NewEncoder(os.Stdout)
+	var passed, failed, skipped int
+	suite.Run(context.Background(), func(result *dummy.ConformanceResult) {
+		switch {
+		case result.Skipped:
+			skipped++
+		case result.Passed:
+			passed++
+		default:
+			failed++
+		}
+		err := encoder.Encode(result)
+		if err != nil {
+			logger.Error(
+				"Failed to write result",
+				slog.String("error", err.Error()),
+			)
+			os.Exit(1)
+		}
+	})
+	logger.Info(
+		"Conformance checks finished",
+		slog.Int("passed", passed),
+		slog.Int("failed", failed),
+		slog.Int("skipped", skipped),
+	)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
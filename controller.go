@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// controllerMain is the entry point of the 'controller' command.
+func controllerMain(args []string) {
+	// Parse the command line:
+	flags := flag.NewFlagSet("controller", flag.ExitOnError)
+	server := flags.String("api-server", "", "Address of the Kubernetes API server. The default is the in cluster one.")
+	insecure := flags.Bool("api-insecure", false, "Don't verify the TLS certificate of the Kubernetes API server.")
+	namespace := flags.String("namespace", "", "Namespace to watch. The default is the namespace of the pod.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s controller [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Watches DummyTest resources and runs the tests that they describe.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// Prepare the logger:
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	// Create the Kubernetes client:
+	kube, err := dummy.NewInClusterKubeClient(*server, *insecure)
+	if err != nil {
+		logger.Error(
+			"Failed to create Kubernetes client",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	if *namespace == "" {
+		*namespace = kube.Namespace()
+	}
+	if *namespace == "" {
+		logger.Error("Namespace is mandatory when not running inside a pod")
+		os.Exit(1)
+	}
+
+	// Run the controller:
+	controller := dummy.NewController(logger, kube, *namespace)
+	logger.Info(
+		"Watching tests",
+		slog.String("namespace", *namespace),
+	)
+	controller.Run(context.Background())
+}
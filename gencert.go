@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// Default validity of the certificates generated by the 'gencert' command.
+const defaultCertValidity = 365 * 24 * time.Hour
+
+// gencertMain is the entry point of the 'gencert' command.
+func gencertMain(args []string) {
+	// Parse the command line:
+	flags := flag.NewFlagSet("gencert", flag.ExitOnError)
+	hosts := flags.String("hosts", "localhost,127.0.0.1,::1",
+		"Comma separated list of host names and IP addresses that the certificate is valid for.")
+	validity := flags.Duration("validity", defaultCertValidity, "Time that the certificate is valid for.")
+	certFile := flags.String("cert", "tls.crt", "File where the certificate will be written.")
+	keyFile := flags.String("key", "tls.key", "File where the private key will be written.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s gencert [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Generates a self signed TLS certificate and key, for use in the 'tls' section of "+
+			"the configuration file.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// Prepare the logger:
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	// Generate the certificate and write the files. Note that the key is readable only by the owner.
+	certPEM, keyPEM, err := dummy.GenerateCertificate(strings.Split(*hosts, ","), *validity)
+	if err != nil {
+		logger.Error(
+			"Failed to generate certificate",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	err = os.WriteFile(*certFile, certPEM, 0o644)
+	if err == nil {
+		err = os.WriteFile(*keyFile, keyPEM, 0o600)
+	}
+	if err != nil {
+		logger.Error(
+			"Failed to write certificate",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	logger.Info(
+		"Generated certificate",
+		slog.String("cert", *certFile),
+		slog.String("key", *keyFile),
+		slog.String("hosts", *hosts),
+		slog.String("validity", validity.String()),
+	)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// orchestrateMain is the entry point of the 'orchestrate' command.
+func orchestrateMain(args []string) {
+	// Parse the command line:
+	var options dummy.OrchestrateOptions
+	var transport dummy.TransportOptions
+	flags := flag.NewFlagSet("orchestrate", flag.ExitOnError)
+	agents := flags.String("agents", "", "Comma separated list of base URLs of the agents, for example "+
+		"'https://10.0.0.1:8553,https://10.0.0.2:8553'.")
+	flags.StringVar(&options.Token, "token", os.Getenv(dummy.AgentTokenEnv), fmt.Sprintf(
+		"Secret shared with the agents. Default is the value of the '%s' environment variable.",
+		dummy.AgentTokenEnv,
+	))
+	flags.BoolVar(&options.Control.Insecure, "agent-insecure", false,
+		"Don't verify the TLS certificates of the agents.")
+	flags.StringVar(&options.Control.CAFile, "agent-cacert", "",
+		"File containing the CA certificates used to verify the agents. Default is the system trust store.")
+	flags.DurationVar(&options.StartDelay, "start-delay", dummy.DefaultOrchestrateStartDelay,
+		"Time between sending the workload and the start of the load, so that all the agents start at the same time.")
+	flags.IntVar(&options.Workload.Connections, "connections", dummy.DefaultBenchConnections,
+		"Number of concurrent connections of each agent.")
+	duration := flags.Duration("duration", dummy.DefaultBenchDuration, "Duration of the run.")
+	warmup := flags.Duration("warmup", 0,
+		"Duration of the initial phase whose requests are excluded from the results. Default is no warm up.")
+	flags.IntVar(&options.Workload.Size, "size", 0,
+		"Size of the data requested in each request. Zero means the server default.")
+	flags.IntVar(&options.Workload.Buffer, "buffer", dummy.DefaultBufferSize,
+		"Size of the buffer used by the agents to read the data.")
+	flags.BoolVar(&transport.Insecure, "insecure", false, "Don't verify the TLS certificate of the target.")
+	flags.Var((*resolveFlag)(&transport.Resolve), "resolve", "Use a fixed address for a host and port of the "+
+		"target, in the 'host:port:address' format. Can be repeated, or contain multiple values separated by commas.")
+	flags.StringVar(&transport.Protocol, "protocol", dummy.BenchProtocolHTTP1, fmt.Sprintf(
+		"HTTP version, '%s' or '%s'.",
+		dummy.ProtocolHTTP1, dummy.ProtocolHTTP2,
+	))
+	flags.BoolVar(&transport.DisableReuse, "no-reuse", false, "Open a new connection for each request.")
+	output := flags.String("output", outputJSON, fmt.Sprintf(
+		"Format of the result, '%s', '%s' with a row per agent, or '%s' for humans.",
+		outputJSON, outputCSV, outputTable,
+	))
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s orchestrate --agents=URL,... [flags] URL\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Sends the same workload to several agents started with the 'agent' command, "+
+			"so that they load the target simultaneously, and writes their aggregated results. This measures "+
+			"bandwidths that a single client can't saturate, like the one of the ingress of a cluster.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || *agents == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+	options.Agents = strings.Split(*agents, ",")
+	options.Workload.Target = flags.Arg(0)
+	options.Workload.Duration = dummy.Duration(*duration)
+	options.Workload.Warmup = dummy.Duration(*warmup)
+	options.Workload.Insecure = transport.Insecure
+	options.Workload.Resolve = transport.Resolve
+	options.Workload.Protocol = transport.Protocol
+	options.Workload.DisableReuse = transport.DisableReuse
+
+	// Prepare the logger. Note that the log goes to the standard error, as the standard output is for the results.
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	err := checkOutputFormat(*output)
+	if err != nil {
+		logger.Error(
+			"Invalid output format",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+
+	// Run the workload in all the agents:
+	orchestrator, err := dummy.NewOrchestrator(logger, options)
+	if err != nil {
+		logger.Error(
+			"Failed to create orchestrator",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	result, err := orchestrator.Run(context.Background())
+	if err != nil {
+		logger.Error(
+			"Failed to run workload",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	err = writeOrchestrateResult(os.Stdout, *output, result)
+	if err != nil {
+		logger.Error(
+			"Failed to write result",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	if result.Failed > 0 || result.Errors > 0 {
+		os.Exit(1)
+	}
+}
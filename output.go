@@ -0,0 +1,674 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// Output formats of the results of the client and bench commands:
+const (
+	outputJSON  = "json"
+	outputCSV   = "csv"
+	outputTable = "table"
+)
+
+// outputFormats are the names of the supported output formats.
+var outputFormats = []string{
+	outputJSON,
+	outputCSV,
+	outputTable,
+}
+
+// checkOutputFormat checks that the given output format is supported.
+func checkOutputFormat(format string) error {
+	if !slices.Contains(outputFormats, format) {
+		return fmt.Errorf(
+			"output format should be one of '%s', but it is '%s'",
+			strings.Join(outputFormats, "', '"), format,
+		)
+	}
+	return nil
+}
+
+// clientWriter writes the results of the client, one after another, in one of the output formats.
+type clientWriter interface {
+	// Write writes one result.
+	Write(result *dummy.ClientResult) error
+
+	// Close writes whatever is pending. For tables that is all the rows, as the widths of the columns are only known
+	// when all the results are available.
+	Close() error
+}
+
+// newClientWriter creates a writer for the results of the client. When intervals is true the CSV format writes a row
+// for each of the progress records instead of one for each result.
+func newClientWriter(out io.Writer, format string, intervals bool) clientWriter {
+	switch format {
+	case outputCSV:
+		return &clientCSVWriter{
+			writer:    csv.NewWriter(out),
+			intervals: intervals,
+		}
+	case outputTable:
+		return &clientTableWriter{
+			writer: tabwriter.NewWriter(out, 0, 0, 2, ' ', 0),
+		}
+	default:
+		return &clientJSONWriter{
+			encoder: json.NewEncoder(out),
+		}
+	}
+}
+
+// clientJSONWriter writes the results of the client as JSON documents, one per line.
+type clientJSONWriter struct {
+	encoder *json.Encoder
+}
+
+// Write is the implementation of the clientWriter interface.
+func (w *clientJSONWriter) Write(result *dummy.ClientResult) error {
+	return w.encoder.Encode(result)
+}
+
+// Close is the implementation of the clientWriter interface.
+func (w *clientJSONWriter) Close() error {
+	return nil
+}
+
+// clientCSVWriter writes the results of the client as CSV rows, with the durations in seconds and the rates in bytes
+// per second, so that they can be loaded directly by analysis tools.
+type clientCSVWriter struct {
+	writer    *csv.Writer
+	intervals bool
+	count     int
+}
+
+// Write is the implementation of the clientWriter interface.
+func (w *clientCSVWriter) Write(result *dummy.ClientResult) error {
+	// Write the header before the first row:
+	if w.count == 0 {
+		header := []string{
+			"download", "url", "status", "instance", "start", "elapsed", "bytes", "throughput",
+			"dns", "connect", "tls", "ttfb", "transfer", "error",
+		}
+		if w.intervals {
+			header = []string{"download", "time", "elapsed", "bytes", "total", "rate"}
+		}
+		err := w.writer.Write(header)
+		if err != nil {
+			return err
+		}
+	}
+	w.count++
+
+	// Write the rows:
+	download := strconv.Itoa(w.count)
+	if w.intervals {
+		for _, record := range result.Progress {
+			err := w.writer.Write([]string{
+				download,
+				record.Time.Format(time.RFC3339Nano),
+				formatSeconds(record.Elapsed),
+				strconv.FormatInt(record.Bytes, 10),
+				strconv.FormatInt(record.Total, 10),
+				formatFloat(record.Rate),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		row := []string{
+			download,
+			result.URL,
+			strconv.Itoa(result.Status),
+			result.Instance,
+			result.Start.Format(time.RFC3339Nano),
+			formatSeconds(result.Elapsed),
+			strconv.FormatInt(result.Bytes, 10),
+			formatFloat(result.Throughput),
+		}
+		timing := result.Timing
+		if timing == nil {
+			timing = &dummy.ClientTiming{}
+		}
+		row = append(
+			row,
+			formatSeconds(timing.DNS),
+			formatSeconds(timing.Connect),
+			formatSeconds(timing.TLS),
+			formatSeconds(timing.TTFB),
+			formatSeconds(timing.Transfer),
+			result.Error,
+		)
+		err := w.writer.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Flush after each result, so that the rows can be processed while the client is still running:
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// Close is the implementation of the clientWriter interface.
+func (w *clientCSVWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// clientTableWriter writes the results of the client as a table for humans.
+type clientTableWriter struct {
+	writer *tabwriter.Writer
+	count  int
+}
+
+// Write is the implementation of the clientWriter interface.
+func (w *clientTableWriter) Write(result *dummy.ClientResult) error {
+	if w.count == 0 {
+		_, err := fmt.Fprintln(
+			w.writer,
+			"DOWNLOAD\tSTATUS\tBYTES\tELAPSED\tTHROUGHPUT\tDNS\tCONNECT\tTLS\tTTFB\tINSTANCE\tERROR",
+		)
+		if err != nil {
+			return err
+		}
+	}
+	w.count++
+	timing := result.Timing
+	if timing == nil {
+		timing = &dummy.ClientTiming{}
+	}
+	_, err := fmt.Fprintf(
+		w.writer,
+		"%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		w.count,
+		result.Status,
+		formatBytes(float64(result.Bytes)),
+		time.Duration(result.Elapsed).Round(time.Millisecond),
+		formatRate(result.Throughput),
+		time.Duration(timing.DNS).Round(time.Microsecond),
+		time.Duration(timing.Connect).Round(time.Microsecond),
+		time.Duration(timing.TLS).Round(time.Microsecond),
+		time.Duration(timing.TTFB).Round(time.Microsecond),
+		result.Instance,
+		result.Error,
+	)
+	return err
+}
+
+// Close is the implementation of the clientWriter interface.
+func (w *clientTableWriter) Close() error {
+	return w.writer.Flush()
+}
+
+// writeBenchResult writes the result of the bench command in the given output format. The CSV format has a row for
+// each connection and a last row with the totals.
+func writeBenchResult(out io.Writer, format string, result *dummy.BenchResult) error {
+	switch format {
+	case outputCSV:
+		return writeBenchCSV(out, result)
+	case outputTable:
+		return writeBenchTable(out, result)
+	default:
+		return json.NewEncoder(out).Encode(result)
+	}
+}
+
+// writeBenchCSV writes the result of the bench command in CSV format.
+func writeBenchCSV(out io.Writer, result *dummy.BenchResult) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"connection", "requests", "errors", "bytes", "throughput"})
+	for _, connection := range result.PerConnection {
+		writer.Write([]string{
+			strconv.Itoa(connection.Index),
+			strconv.Itoa(connection.Requests),
+			strconv.Itoa(connection.Errors),
+			strconv.FormatInt(connection.Bytes, 10),
+			formatFloat(connection.Throughput),
+		})
+	}
+	writer.Write([]string{
+		"total",
+		strconv.Itoa(result.Requests),
+		strconv.Itoa(result.Errors),
+		strconv.FormatInt(result.Bytes, 10),
+		formatFloat(result.Throughput),
+	})
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeBenchTable writes the result of the bench command as tables for humans.
+func writeBenchTable(out io.Writer, result *dummy.BenchResult) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	// Write the summary:
+	fmt.Fprintf(writer, "Target:\t%s\n", result.Target)
+	fmt.Fprintf(writer, "Protocol:\t%s\n", result.Protocol)
+	fmt.Fprintf(writer, "Connections:\t%d\n", result.Connections)
+	if result.Warmup > 0 {
+		fmt.Fprintf(writer, "Warm up:\t%s\n", time.Duration(result.Warmup).Round(time.Millisecond))
+	}
+	if result.SteadyState != nil {
+		fmt.Fprintf(writer, "Steady state:\t%t, cv %.3f\n", result.SteadyState.Reached, result.SteadyState.CV)
+	}
+	fmt.Fprintf(writer, "Elapsed:\t%s\n", time.Duration(result.Elapsed).Round(time.Millisecond))
+	fmt.Fprintf(writer, "Requests:\t%d\n", result.Requests)
+	fmt.Fprintf(writer, "Errors:\t%d\n", result.Errors)
+	fmt.Fprintf(writer, "Bytes:\t%s\n", formatBytes(float64(result.Bytes)))
+	fmt.Fprintf(writer, "Throughput:\t%s\n", formatRate(result.Throughput))
+	if result.Latency != nil {
+		fmt.Fprintf(
+			writer,
+			"Latency:\tp50 %s, p90 %s, p99 %s, max %s\n",
+			time.Duration(result.Latency.P50).Round(time.Microsecond),
+			time.Duration(result.Latency.P90).Round(time.Microsecond),
+			time.Duration(result.Latency.P99).Round(time.Microsecond),
+			time.Duration(result.Latency.Max).Round(time.Microsecond),
+		)
+	}
+	messages := make([]string, 0, len(result.ErrorCounts))
+	for message := range result.ErrorCounts {
+		messages = append(messages, message)
+	}
+	slices.Sort(messages)
+	for _, message := range messages {
+		fmt.Fprintf(writer, "Error:\t%d x %s\n", result.ErrorCounts[message], message)
+	}
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	// Write the connections, in a separate table because the columns are different:
+	fmt.Fprintln(out)
+	fmt.Fprintln(writer, "CONNECTION\tREQUESTS\tERRORS\tBYTES\tTHROUGHPUT")
+	for _, connection := range result.PerConnection {
+		fmt.Fprintf(
+			writer,
+			"%d\t%d\t%d\t%s\t%s\n",
+			connection.Index,
+			connection.Requests,
+			connection.Errors,
+			formatBytes(float64(connection.Bytes)),
+			formatRate(connection.Throughput),
+		)
+	}
+	return writer.Flush()
+}
+
+// writeBenchComparison writes the comparison of two results of the bench command in the given output format. The CSV
+// format has a row for each metric.
+func writeBenchComparison(out io.Writer, format string, comparison *dummy.BenchComparison) error {
+	switch format {
+	case outputCSV:
+		return writeComparisonCSV(out, comparison)
+	case outputTable:
+		return writeComparisonTable(out, comparison)
+	default:
+		return json.NewEncoder(out).Encode(comparison)
+	}
+}
+
+// writeComparisonCSV writes the comparison of two results of the bench command in CSV format.
+func writeComparisonCSV(out io.Writer, comparison *dummy.BenchComparison) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"metric", "a", "b", "delta", "relative", "p_value", "significant"})
+	for _, delta := range comparison.Deltas {
+		var pValue string
+		if delta.PValue != nil {
+			pValue = strconv.FormatFloat(*delta.PValue, 'g', -1, 64)
+		}
+		writer.Write([]string{
+			delta.Metric,
+			formatFloat(delta.A),
+			formatFloat(delta.B),
+			formatFloat(delta.Delta),
+			formatFloat(delta.Relative),
+			pValue,
+			strconv.FormatBool(delta.Significant),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeComparisonTable writes the comparison of two results of the bench command as a table for humans.
+func writeComparisonTable(out io.Writer, comparison *dummy.BenchComparison) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "A:\t%s\n", comparison.A.Target)
+	fmt.Fprintf(writer, "B:\t%s\n", comparison.B.Target)
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(writer, "METRIC\tA\tB\tDELTA\tP-VALUE\tSIGNIFICANT")
+	for _, delta := range comparison.Deltas {
+		format := func(value float64) string {
+			return strconv.FormatFloat(value, 'f', 0, 64)
+		}
+		switch {
+		case delta.Metric == "throughput":
+			format = formatRate
+		case strings.HasPrefix(delta.Metric, "latency_"):
+			format = func(value float64) string {
+				return time.Duration(value * float64(time.Second)).Round(time.Microsecond).String()
+			}
+		}
+		pValue := "-"
+		significant := "-"
+		if delta.PValue != nil {
+			pValue = fmt.Sprintf("%.4f", *delta.PValue)
+			significant = "no"
+			if delta.Significant {
+				significant = "yes"
+			}
+		}
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%+.1f%%\t%s\t%s\n",
+			delta.Metric,
+			format(delta.A),
+			format(delta.B),
+			delta.Relative*100,
+			pValue,
+			significant,
+		)
+	}
+	return writer.Flush()
+}
+
+// writeReuseResult writes the result of the connection reuse mode of the bench command in the given output format.
+// The CSV format has a row for each phase.
+func writeReuseResult(out io.Writer, format string, result *dummy.BenchReuseResult) error {
+	switch format {
+	case outputCSV:
+		return writeReuseCSV(out, result)
+	case outputTable:
+		return writeReuseTable(out, result)
+	default:
+		return json.NewEncoder(out).Encode(result)
+	}
+}
+
+// writeReuseCSV writes the result of the connection reuse mode in CSV format.
+func writeReuseCSV(out io.Writer, result *dummy.BenchReuseResult) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{
+		"phase", "requests", "errors", "new_connections", "latency", "p50", "p99", "connect", "tls", "resumed",
+		"resumption_rate",
+	})
+	for _, phase := range result.Phases {
+		writer.Write([]string{
+			phase.Name,
+			strconv.Itoa(phase.Requests),
+			strconv.Itoa(phase.Errors),
+			strconv.Itoa(phase.NewConnections),
+			formatSeconds(phase.Latency),
+			formatSeconds(phase.P50),
+			formatSeconds(phase.P99),
+			formatSeconds(phase.Connect),
+			formatSeconds(phase.TLS),
+			strconv.Itoa(phase.Resumed),
+			formatFloat(phase.ResumptionRate),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeReuseTable writes the result of the connection reuse mode as a table for humans.
+func writeReuseTable(out io.Writer, result *dummy.BenchReuseResult) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "Target:\t%s\n", result.Target)
+	fmt.Fprintf(writer, "Protocol:\t%s\n", result.Protocol)
+	fmt.Fprintf(writer, "Requests:\t%d per phase\n", result.Requests)
+	fmt.Fprintf(writer, "Overhead:\t%s per new connection\n", time.Duration(result.Overhead).Round(time.Microsecond))
+
+	// The savings are only meaningful if at least one TLS session was resumed:
+	resumed := 0
+	for _, phase := range result.Phases {
+		resumed += phase.Resumed
+	}
+	if resumed > 0 {
+		fmt.Fprintf(
+			writer,
+			"Resumption savings:\t%s per new connection\n",
+			time.Duration(result.ResumptionSavings).Round(time.Microsecond),
+		)
+	}
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(writer, "PHASE\tREQUESTS\tERRORS\tCONNECTIONS\tLATENCY\tP50\tP99\tCONNECT\tTLS\tRESUMED")
+	for _, phase := range result.Phases {
+		fmt.Fprintf(
+			writer,
+			"%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%.0f%%\n",
+			phase.Name,
+			phase.Requests,
+			phase.Errors,
+			phase.NewConnections,
+			time.Duration(phase.Latency).Round(time.Microsecond),
+			time.Duration(phase.P50).Round(time.Microsecond),
+			time.Duration(phase.P99).Round(time.Microsecond),
+			time.Duration(phase.Connect).Round(time.Microsecond),
+			time.Duration(phase.TLS).Round(time.Microsecond),
+			phase.ResumptionRate*100,
+		)
+	}
+	return writer.Flush()
+}
+
+// writeFleetBenchResult writes the result of the bench command against a fleet in the given output format. The CSV
+// format has a row for each target.
+func writeFleetBenchResult(out io.Writer, format string, result *dummy.FleetBenchResult) error {
+	switch format {
+	case outputCSV:
+		return writeFleetBenchCSV(out, result)
+	case outputTable:
+		return writeFleetBenchTable(out, result)
+	default:
+		return json.NewEncoder(out).Encode(result)
+	}
+}
+
+// writeFleetBenchCSV writes the result of the bench command against a fleet in CSV format.
+func writeFleetBenchCSV(out io.Writer, result *dummy.FleetBenchResult) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"target", "connections", "requests", "errors", "bytes", "throughput", "p50", "p99"})
+	for _, target := range result.Targets {
+		var p50, p99 string
+		if target.Latency != nil {
+			p50 = formatSeconds(target.Latency.P50)
+			p99 = formatSeconds(target.Latency.P99)
+		}
+		writer.Write([]string{
+			target.ID,
+			strconv.Itoa(target.Connections),
+			strconv.Itoa(target.Requests),
+			strconv.Itoa(target.Errors),
+			strconv.FormatInt(target.Bytes, 10),
+			formatFloat(target.Throughput),
+			p50,
+			p99,
+		})
+	}
+	writer.Write([]string{
+		"total",
+		strconv.Itoa(result.Connections),
+		strconv.Itoa(result.Requests),
+		strconv.Itoa(result.Errors),
+		strconv.FormatInt(result.Bytes, 10),
+		formatFloat(result.Throughput),
+		"",
+		"",
+	})
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeFleetBenchTable writes the result of the bench command against a fleet as tables for humans.
+func writeFleetBenchTable(out io.Writer, result *dummy.FleetBenchResult) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "Targets:\t%d\n", len(result.Targets))
+	fmt.Fprintf(writer, "Connections:\t%d\n", result.Connections)
+	fmt.Fprintf(writer, "Elapsed:\t%s\n", time.Duration(result.Elapsed).Round(time.Millisecond))
+	fmt.Fprintf(writer, "Requests:\t%d\n", result.Requests)
+	fmt.Fprintf(writer, "Errors:\t%d\n", result.Errors)
+	fmt.Fprintf(writer, "Bytes:\t%s\n", formatBytes(float64(result.Bytes)))
+	fmt.Fprintf(writer, "Throughput:\t%s\n", formatRate(result.Throughput))
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(writer, "TARGET\tCONNECTIONS\tREQUESTS\tERRORS\tBYTES\tTHROUGHPUT\tP50\tP99")
+	for _, target := range result.Targets {
+		p50, p99 := "-", "-"
+		if target.Latency != nil {
+			p50 = time.Duration(target.Latency.P50).Round(time.Microsecond).String()
+			p99 = time.Duration(target.Latency.P99).Round(time.Microsecond).String()
+		}
+		fmt.Fprintf(
+			writer,
+			"%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			target.ID,
+			target.Connections,
+			target.Requests,
+			target.Errors,
+			formatBytes(float64(target.Bytes)),
+			formatRate(target.Throughput),
+			p50,
+			p99,
+		)
+	}
+	return writer.Flush()
+}
+
+// writeOrchestrateResult writes the result of the orchestrate command in the given output format. The CSV format has
+// a row for each agent.
+func writeOrchestrateResult(out io.Writer, format string, result *dummy.OrchestrateResult) error {
+	switch format {
+	case outputCSV:
+		return writeOrchestrateCSV(out, result)
+	case outputTable:
+		return writeOrchestrateTable(out, result)
+	default:
+		return json.NewEncoder(out).Encode(result)
+	}
+}
+
+// writeOrchestrateCSV writes the result of the orchestrate command in CSV format.
+func writeOrchestrateCSV(out io.Writer, result *dummy.OrchestrateResult) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"agent", "url", "connections", "requests", "errors", "bytes", "throughput", "error"})
+	for _, agent := range result.Agents {
+		if agent.AgentRunResult == nil || agent.BenchResult == nil {
+			writer.Write([]string{"", agent.URL, "", "", "", "", "", agent.Error})
+			continue
+		}
+		writer.Write([]string{
+			agent.Agent,
+			agent.URL,
+			strconv.Itoa(agent.Connections),
+			strconv.Itoa(agent.Requests),
+			strconv.Itoa(agent.Errors),
+			strconv.FormatInt(agent.Bytes, 10),
+			formatFloat(agent.Throughput),
+			"",
+		})
+	}
+	writer.Write([]string{
+		"total",
+		"",
+		strconv.Itoa(result.Connections),
+		strconv.Itoa(result.Requests),
+		strconv.Itoa(result.Errors),
+		strconv.FormatInt(result.Bytes, 10),
+		formatFloat(result.Throughput),
+		"",
+	})
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeOrchestrateTable writes the result of the orchestrate command as tables for humans.
+func writeOrchestrateTable(out io.Writer, result *dummy.OrchestrateResult) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "Target:\t%s\n", result.Target)
+	fmt.Fprintf(writer, "Agents:\t%d, %d failed\n", len(result.Agents), result.Failed)
+	fmt.Fprintf(writer, "Start spread:\t%s\n", time.Duration(result.StartSpread).Round(time.Microsecond))
+	fmt.Fprintf(writer, "Connections:\t%d\n", result.Connections)
+	fmt.Fprintf(writer, "Requests:\t%d\n", result.Requests)
+	fmt.Fprintf(writer, "Errors:\t%d\n", result.Errors)
+	fmt.Fprintf(writer, "Bytes:\t%s\n", formatBytes(float64(result.Bytes)))
+	fmt.Fprintf(writer, "Throughput:\t%s\n", formatRate(result.Throughput))
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(writer, "AGENT\tURL\tCONNECTIONS\tREQUESTS\tERRORS\tBYTES\tTHROUGHPUT")
+	for _, agent := range result.Agents {
+		if agent.AgentRunResult == nil || agent.BenchResult == nil {
+			fmt.Fprintf(writer, "-\t%s\tfailed: %s\n", agent.URL, agent.Error)
+			continue
+		}
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			agent.Agent,
+			agent.URL,
+			agent.Connections,
+			agent.Requests,
+			agent.Errors,
+			formatBytes(float64(agent.Bytes)),
+			formatRate(agent.Throughput),
+		)
+	}
+	return writer.Flush()
+}
+
+// formatSeconds formats a duration as a number of seconds.
+func formatSeconds(duration dummy.Duration) string {
+	return formatFloat(time.Duration(duration).Seconds())
+}
+
+// formatFloat formats a number with the minimum number of digits needed to represent it exactly.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// formatBytes formats a number of bytes using decimal units, for example '1.5 MB'.
+func formatBytes(value float64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", value, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// formatRate formats a number of bytes per second using decimal units, for example '1.5 MB/s'.
+func formatRate(value float64) string {
+	return formatBytes(value) + "/s"
+}
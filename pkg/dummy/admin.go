@@ -0,0 +1,43 @@
+package dummy
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// AdminTokenEnv is the environment variable that contains the default token of the administration endpoints.
+const AdminTokenEnv = "DUMMY_ADMIN_TOKEN"
+
+// AdminHandler is an HTTP handler that passes requests to the wrapped handler only if they contain the admin token in
+// the 'Authorization' header, as a bearer token. It protects the endpoints that change the behavior of the server for
+// all the clients, as they are served in the same listeners than the data. When the token is empty those endpoints
+// are disabled, and all the requests are rejected.
+type AdminHandler struct {
+	logger  *slog.Logger
+	handler http.Handler
+	token   string
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token == "" {
+		http.Error(w, "administration endpoints are disabled because there is no admin token", http.StatusForbidden)
+		return
+	}
+
+	// Check the token. Note that the comparison takes constant time so that it doesn't reveal the token.
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		h.logger.Warn(
+			"Rejected unauthenticated administration request",
+			slog.String("remote", r.RemoteAddr),
+			slog.String("path", r.URL.Path),
+		)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "valid bearer token is required", http.StatusUnauthorized)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
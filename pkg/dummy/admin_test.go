@@ -0,0 +1,85 @@
+package dummy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAdminEndpoints(t *testing.T) {
+	enabled := startTestServer(t, Options{AdminToken: "secret"})
+	disabled := startTestServer(t, Options{})
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{
+			name:   "Scenario trigger",
+			method: http.MethodPost,
+			path:   "/scenario/trigger",
+			body:   `{}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Chaos",
+			method: http.MethodPut,
+			path:   "/admin/chaos",
+			body:   `{"error_rate": 0}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "Chaos reset",
+			method: http.MethodDelete,
+			path:   "/admin/chaos",
+			status: http.StatusOK,
+		},
+		{
+			name:   "Kill transfer",
+			method: http.MethodDelete,
+			path:   "/admin/transfers/12345",
+			status: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			send := func(address, token string) int {
+				request, err := http.NewRequest(test.method, address+test.path, strings.NewReader(test.body))
+				if err != nil {
+					t.Fatalf("failed to create request: %v", err)
+				}
+				if token != "" {
+					request.Header.Set("Authorization", "Bearer "+token)
+				}
+				response, err := http.DefaultClient.Do(request)
+				if err != nil {
+					t.Fatalf("failed to send request: %v", err)
+				}
+				response.Body.Close()
+				return response.StatusCode
+			}
+			if status := send(disabled.URL, "secret"); status != http.StatusForbidden {
+				t.Errorf("expected status %d without admin token, but got %d", http.StatusForbidden, status)
+			}
+			if status := send(enabled.URL, ""); status != http.StatusUnauthorized {
+				t.Errorf("expected status %d without bearer token, but got %d", http.StatusUnauthorized, status)
+			}
+			if status := send(enabled.URL, "wrong"); status != http.StatusUnauthorized {
+				t.Errorf("expected status %d with wrong token, but got %d", http.StatusUnauthorized, status)
+			}
+			if status := send(enabled.URL, "secret"); status != test.status {
+				t.Errorf("expected status %d with the right token, but got %d", test.status, status)
+			}
+		})
+	}
+}
+
+func TestConnectionsReportIsPublic(t *testing.T) {
+	server := startTestServer(t, Options{AdminToken: "secret"})
+	response, _ := getBody(t, server.URL+"/debug/connections", nil)
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, response.StatusCode)
+	}
+}
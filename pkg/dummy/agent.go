@@ -0,0 +1,216 @@
+package dummy
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the agents that run workloads for the orchestrator:
+const (
+	DefaultAgentAddress = ":8553"
+	AgentTokenEnv       = "DUMMY_AGENT_TOKEN"
+
+	// agentRunPath is the path of the endpoint of the agents that runs a workload.
+	agentRunPath = "/run"
+
+	// agentMaxBody is the maximum size of the documents exchanged by the orchestrator and the agents. The results
+	// contain the measurements of each connection, so it needs to be large.
+	agentMaxBody = 64 << 20
+)
+
+// AgentRunRequest is the workload that the orchestrator sends to the agents. The fields have the same meaning than the
+// options of the load generator. Delay is the time that the agent waits before starting, calculated by the
+// orchestrator so that all the agents start at the same time without depending on their clocks.
+type AgentRunRequest struct {
+	Target       string   `json:"target"`
+	Connections  int      `json:"connections,omitempty"`
+	Duration     Duration `json:"duration,omitempty"`
+	Warmup       Duration `json:"warmup,omitempty"`
+	Size         int      `json:"size,omitempty"`
+	Buffer       int      `json:"buffer,omitempty"`
+	Protocol     string   `json:"protocol,omitempty"`
+	Insecure     bool     `json:"insecure,omitempty"`
+	Resolve      []string `json:"resolve,omitempty"`
+	DisableReuse bool     `json:"disable_reuse,omitempty"`
+	Delay        Duration `json:"delay,omitempty"`
+}
+
+// benchOptions converts the workload into the options of the load generator.
+func (r *AgentRunRequest) benchOptions() BenchOptions {
+	return BenchOptions{
+		Target:      r.Target,
+		Connections: r.Connections,
+		Duration:    time.Duration(r.Duration),
+		Warmup:      time.Duration(r.Warmup),
+		Size:        r.Size,
+		Buffer:      r.Buffer,
+		Transport: TransportOptions{
+			Insecure:     r.Insecure,
+			Protocol:     r.Protocol,
+			Resolve:      r.Resolve,
+			DisableReuse: r.DisableReuse,
+		},
+	}
+}
+
+// AgentRunResult is the result of a workload run by an agent. Agent is the name of the agent, and Start is the time,
+// according to the clock of the agent, when the load started.
+type AgentRunResult struct {
+	Agent string    `json:"agent"`
+	Start time.Time `json:"start"`
+	*BenchResult
+}
+
+// AgentOptions contains the settings of an agent.
+type AgentOptions struct {
+	// Name identifies the agent in the results. The default is the instance name of the identity.
+	Name string
+
+	// Token is the secret that the orchestrator has to send in the 'Authorization' header, as a bearer token. It is
+	// mandatory.
+	Token string
+}
+
+// Agent runs the workloads requested by an orchestrator, one at a time, and returns the results. The requests are
+// authenticated with a shared token.
+type Agent struct {
+	logger  *slog.Logger
+	name    string
+	token   string
+	running atomic.Bool
+}
+
+// NewAgent creates an agent with the given options.
+func NewAgent(logger *slog.Logger, options AgentOptions) (result *Agent, err error) {
+	if options.Token == "" {
+		err = errors.New("token is mandatory")
+		return
+	}
+	name := options.Name
+	if name == "" {
+		name = LoadIdentity().Instance
+	}
+	result = &Agent{
+		logger: logger,
+		name:   name,
+		token:  options.Token,
+	}
+	return
+}
+
+// ListenAndServe serves the control requests in the given address till the context is cancelled. The certificate and
+// key files are optional, and when they aren't given the built-in ones are used.
+func (a *Agent) ListenAndServe(ctx context.Context, address, crtFile, keyFile string) error {
+	var certificate tls.Certificate
+	var err error
+	if crtFile != "" || keyFile != "" {
+		certificate, err = tls.LoadX509KeyPair(crtFile, keyFile)
+	} else {
+		certificate, err = tls.X509KeyPair([]byte(tlsCrt), []byte(tlsKey))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST "+agentRunPath, a)
+	server := &http.Server{
+		Addr:    address,
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+		},
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	a.logger.Info(
+		"Agent ready",
+		slog.String("name", a.name),
+		slog.String("address", address),
+	)
+	err = server.ListenAndServeTLS("", "")
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Check the token. Note that the comparison takes constant time so that it doesn't reveal the token.
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		a.logger.Warn(
+			"Rejected unauthenticated request",
+			slog.String("remote", r.RemoteAddr),
+		)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "valid bearer token is required", http.StatusUnauthorized)
+		return
+	}
+
+	// Run only one workload at a time, otherwise the results would interfere:
+	if !a.running.CompareAndSwap(false, true) {
+		http.Error(w, "agent is already running a workload", http.StatusConflict)
+		return
+	}
+	defer a.running.Store(false)
+
+	// Parse the workload:
+	request := &AgentRunRequest{}
+	err := json.NewDecoder(io.LimitReader(r.Body, agentMaxBody)).Decode(request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode workload: %v", err), http.StatusBadRequest)
+		return
+	}
+	bench, err := NewBench(a.logger, request.benchOptions())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("workload isn't valid: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Wait till the start time and then run the workload:
+	a.logger.Info(
+		"Received workload",
+		slog.String("target", request.Target),
+		slog.Int("connections", request.Connections),
+		slog.String("delay", time.Duration(request.Delay).String()),
+	)
+	timer := time.NewTimer(time.Duration(request.Delay))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+		return
+	}
+	start := time.Now().UTC()
+	benchResult, err := bench.Run(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to run workload: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&AgentRunResult{
+		Agent:       a.name,
+		Start:       start,
+		BenchResult: benchResult,
+	})
+	if err != nil {
+		a.logger.Error(
+			"Failed to send result",
+			slog.String("error", err.Error()),
+		)
+	}
+}
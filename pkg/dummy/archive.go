@@ -0,0 +1,236 @@
+package dummy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Names of the archive formats:
+const (
+	archiveFormatTar = "tar"
+	archiveFormatZip = "zip"
+)
+
+// Defaults and limits of the archive endpoint:
+const (
+	defaultArchiveFiles          = 10
+	defaultArchiveFileSize       = 1 << 20 // 1 MiB
+	maxArchiveFiles              = 1000000
+	maxArchiveFileSize     int64 = 1 << 40 // 1 TiB
+)
+
+// tarBlockSize is the size of the blocks of the tar format, and tarMaxUSTARSize is the maximum size of a file that
+// doesn't need extended headers.
+const (
+	tarBlockSize    = 512
+	tarMaxUSTARSize = 1<<33 - 1
+)
+
+// ArchiveHandler is an HTTP handler that streams an archive of synthetic files, so that clients that extract archives
+// on the fly and proxies that inspect them can be tested with archives of any size. The archive is generated while it
+// is sent, so it doesn't need memory or storage. It is controlled with these query parameters:
+//
+//   - 'format' is 'tar' or 'zip'. The default is 'tar'.
+//   - 'files' is the number of files. The default is ten.
+//   - 'filesize' is the size of each file, in bytes. The default is one mebibyte.
+//   - 'source' is the name of the data source that generates the content of the files, like 'lorem' for files that
+//     can be compressed. The default is 'random'. The settings of configurable sources aren't used.
+//
+// The content of each file depends only on the source, the size and the position in the archive. Files in zip
+// archives are stored without compression, and each file is generated twice, once to calculate the checksum and once
+// to send it, so that the sizes and checksums are in the local headers and the archive can be extracted as a stream.
+// The size of tar archives is sent in the 'Content-Length' header, zip archives use chunked transfer encoding.
+type ArchiveHandler struct {
+	logger   *slog.Logger
+	identity Identity
+	buffers  *BufferPool
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *ArchiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+
+	// Get the parameters:
+	query := r.URL.Query()
+	format := query.Get("format")
+	switch format {
+	case "":
+		format = archiveFormatTar
+	case archiveFormatTar, archiveFormatZip:
+	default:
+		http.Error(
+			w,
+			fmt.Sprintf(
+				"format should be '%s' or '%s', but it is '%s'",
+				archiveFormatTar, archiveFormatZip, format,
+			),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	files, err := parseIntParam(query.Get("files"), defaultArchiveFiles)
+	if err != nil || files > maxArchiveFiles {
+		http.Error(w, fmt.Sprintf("files '%s' should be a number between 0 and %d", query.Get("files"),
+			maxArchiveFiles), http.StatusBadRequest)
+		return
+	}
+	fileSize := int64(defaultArchiveFileSize)
+	text := query.Get("filesize")
+	if text != "" {
+		fileSize, err = strconv.ParseInt(text, 10, 64)
+		if err != nil || fileSize < 0 || fileSize > maxArchiveFileSize {
+			http.Error(w, fmt.Sprintf("filesize '%s' should be a number of bytes between 0 and %d", text,
+				maxArchiveFileSize), http.StatusBadRequest)
+			return
+		}
+	}
+	sourceName := query.Get("source")
+	if sourceName == "" {
+		sourceName = sourceRandom
+	}
+	source := lookupDataSource(sourceName)
+	if source == nil {
+		http.Error(w, unknownSourceError(sourceName).Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Send the archive:
+	archive := &syntheticArchive{
+		source:     source,
+		sourceName: sourceName,
+		files:      files,
+		fileSize:   fileSize,
+	}
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf(`attachment; filename="dummy-%d.%s"`, files, format),
+	)
+	buffer := h.buffers.Get(DefaultBufferSize)
+	defer h.buffers.Put(buffer)
+	startTime := time.Now()
+	if format == archiveFormatTar {
+		w.Header().Set("Content-Type", "application/x-tar")
+		if fileSize <= tarMaxUSTARSize {
+			w.Header().Set("Content-Length", strconv.FormatInt(archive.tarSize(), 10))
+		}
+		err = archive.writeTar(w, *buffer)
+	} else {
+		w.Header().Set("Content-Type", "application/zip")
+		err = archive.writeZip(w, *buffer)
+	}
+	elapsed := time.Since(startTime)
+	if err != nil {
+		h.logger.Info(
+			"Failed to send archive",
+			slog.String("format", format),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	h.logger.Info(
+		"Archive sent",
+		slog.String("format", format),
+		slog.Int("files", files),
+		slog.Int64("file_size", fileSize),
+		slog.String("source", sourceName),
+		slog.String("elapsed", elapsed.String()),
+		h.identity.LogAttr(),
+	)
+}
+
+// syntheticArchive generates the files of an archive.
+type syntheticArchive struct {
+	source     DataSource
+	sourceName string
+	files      int
+	fileSize   int64
+}
+
+// name returns the name of the file with the given index.
+func (a *syntheticArchive) name(index int) string {
+	return fmt.Sprintf("dummy/file-%06d.bin", index)
+}
+
+// reader returns a reader for the content of the file with the given index.
+func (a *syntheticArchive) reader(index int) io.Reader {
+	seed := sha256.Sum256([]byte(fmt.Sprintf("archive/%s/%d/%d", a.sourceName, a.fileSize, index)))
+	return newDataSourceReader(a.source, seed, a.fileSize)
+}
+
+// tarSize calculates the size of the tar archive, assuming that the files don't need extended headers.
+func (a *syntheticArchive) tarSize() int64 {
+	padded := (a.fileSize + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+	return int64(a.files)*(tarBlockSize+padded) + 2*tarBlockSize
+}
+
+// writeTar writes the archive in the tar format.
+func (a *syntheticArchive) writeTar(w io.Writer, buffer []byte) error {
+	writer := tar.NewWriter(w)
+	for i := 0; i < a.files; i++ {
+		err := writer.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     a.name(i),
+			Size:     a.fileSize,
+			Mode:     0644,
+			ModTime:  syntheticModTime,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyBuffer(writer, a.reader(i), buffer)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeZip writes the archive in the zip format.
+func (a *syntheticArchive) writeZip(w io.Writer, buffer []byte) error {
+	writer := zip.NewWriter(w)
+	for i := 0; i < a.files; i++ {
+		checksum := crc32.NewIEEE()
+		_, err := io.CopyBuffer(checksum, a.reader(i), buffer)
+		if err != nil {
+			return err
+		}
+
+		// Raw headers are written as they are, so the legacy modification time needs to be set explicitly:
+		date, clock := msDosTime(syntheticModTime)
+		header := &zip.FileHeader{
+			Name:               a.name(i),
+			Method:             zip.Store,
+			Modified:           syntheticModTime,
+			ModifiedDate:       date,
+			ModifiedTime:       clock,
+			CRC32:              checksum.Sum32(),
+			CompressedSize64:   uint64(a.fileSize),
+			UncompressedSize64: uint64(a.fileSize),
+		}
+		header.SetMode(0644)
+		file, err := writer.CreateRaw(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyBuffer(file, a.reader(i), buffer)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// msDosTime converts a time to the date and time fields of the MS-DOS format, used by the headers of the zip format.
+func msDosTime(t time.Time) (date, clock uint16) {
+	date = uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	clock = uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	return
+}
@@ -0,0 +1,201 @@
+package dummy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Behavior describes the simulated conditions that the server applies to the requests that it receives. Fields with
+// zero values mean that the corresponding condition isn't simulated.
+type Behavior struct {
+	// ErrorRate is the probability, from zero to one, that a request will fail.
+	ErrorRate float64
+
+	// ErrorStatus is the HTTP status code that will be returned for failed requests. When it is zero requests will fail
+	// with status 500.
+	ErrorStatus int
+
+	// Latency is the delay added before starting to send the response.
+	Latency time.Duration
+
+	// Rate is the maximum number of bytes per second that will be sent. When it is zero there is no limit.
+	Rate int64
+
+	// SlowRate is the probability, from zero to one, that SlowLatency will be added to the latency of a request.
+	SlowRate float64
+
+	// SlowLatency is the additional latency of slow requests.
+	SlowLatency time.Duration
+
+	// TruncateRate is the probability, from zero to one, that the body of the response will be truncated at a random
+	// point, closing the connection or the stream abruptly.
+	TruncateRate float64
+
+	// ResetRate is the probability, from zero to one, that the connection will be reset before sending the
+	// response.
+	ResetRate float64
+}
+
+// behaviorJSON is the representation of the behavior used in JSON documents, where durations are strings like '10s'.
+type behaviorJSON struct {
+	ErrorRate    float64  `json:"error_rate,omitempty"`
+	ErrorStatus  int      `json:"error_status,omitempty"`
+	Latency      Duration `json:"latency,omitempty"`
+	Rate         int64    `json:"rate,omitempty"`
+	SlowRate     float64  `json:"slow_rate,omitempty"`
+	SlowLatency  Duration `json:"slow_latency,omitempty"`
+	TruncateRate float64  `json:"truncate_rate,omitempty"`
+	ResetRate    float64  `json:"reset_rate,omitempty"`
+}
+
+// MarshalJSON is the implementation of the json.Marshaler interface.
+func (b Behavior) MarshalJSON() ([]byte, error) {
+	return json.Marshal(behaviorJSON{
+		ErrorRate:    b.ErrorRate,
+		ErrorStatus:  b.ErrorStatus,
+		Latency:      Duration(b.Latency),
+		Rate:         b.Rate,
+		SlowRate:     b.SlowRate,
+		SlowLatency:  Duration(b.SlowLatency),
+		TruncateRate: b.TruncateRate,
+		ResetRate:    b.ResetRate,
+	})
+}
+
+// UnmarshalJSON is the implementation of the json.Unmarshaler interface.
+func (b *Behavior) UnmarshalJSON(data []byte) error {
+	var tmp behaviorJSON
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	*b = Behavior{
+		ErrorRate:    tmp.ErrorRate,
+		ErrorStatus:  tmp.ErrorStatus,
+		Latency:      time.Duration(tmp.Latency),
+		Rate:         tmp.Rate,
+		SlowRate:     tmp.SlowRate,
+		SlowLatency:  time.Duration(tmp.SlowLatency),
+		TruncateRate: tmp.TruncateRate,
+		ResetRate:    tmp.ResetRate,
+	}
+	return nil
+}
+
+// Merge returns a new behavior that contains the values of this one replaced by the non zero values of the given one.
+func (b Behavior) Merge(other Behavior) Behavior {
+	if other.ErrorRate != 0 {
+		b.ErrorRate = other.ErrorRate
+	}
+	if other.ErrorStatus != 0 {
+		b.ErrorStatus = other.ErrorStatus
+	}
+	if other.Latency != 0 {
+		b.Latency = other.Latency
+	}
+	if other.Rate != 0 {
+		b.Rate = other.Rate
+	}
+	if other.SlowRate != 0 {
+		b.SlowRate = other.SlowRate
+	}
+	if other.SlowLatency != 0 {
+		b.SlowLatency = other.SlowLatency
+	}
+	if other.TruncateRate != 0 {
+		b.TruncateRate = other.TruncateRate
+	}
+	if other.ResetRate != 0 {
+		b.ResetRate = other.ResetRate
+	}
+	return b
+}
+
+// Validate checks that the probabilities are between zero and one, and that the rest of the values aren't negative.
+func (b Behavior) Validate() error {
+	rates := map[string]float64{
+		"error_rate":    b.ErrorRate,
+		"slow_rate":     b.SlowRate,
+		"truncate_rate": b.TruncateRate,
+		"reset_rate":    b.ResetRate,
+	}
+	for name, rate := range rates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s should be between zero and one, but it is %g", name, rate)
+		}
+	}
+	if b.ErrorStatus != 0 && (b.ErrorStatus < 100 || b.ErrorStatus > 999) {
+		return fmt.Errorf("error_status %d isn't a valid HTTP status code", b.ErrorStatus)
+	}
+	if b.Latency < 0 || b.SlowLatency < 0 || b.Rate < 0 {
+		return fmt.Errorf("latency, slow_latency and rate can't be negative")
+	}
+	return nil
+}
+
+// BehaviorSet contains the behaviors that are active at a given moment, each of them identified by the name of the
+// thing that activated it, for example a scenario. When several behaviors are active they are merged in the order
+// they were activated, so the most recent ones take precedence.
+type BehaviorSet struct {
+	lock   sync.Mutex
+	layers []behaviorLayer
+}
+
+type behaviorLayer struct {
+	name     string
+	behavior Behavior
+}
+
+// Set activates the given behavior, replacing any previous behavior with the same name.
+func (s *BehaviorSet) Set(name string, behavior Behavior) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remove(name)
+	s.layers = append(s.layers, behaviorLayer{
+		name:     name,
+		behavior: behavior,
+	})
+}
+
+// Get returns the behavior with the given name, and a flag indicating if it is active.
+func (s *BehaviorSet) Get(name string) (result Behavior, ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, layer := range s.layers {
+		if layer.name == name {
+			result = layer.behavior
+			ok = true
+			return
+		}
+	}
+	return
+}
+
+// Clear deactivates the behavior with the given name. It does nothing if there is no such behavior.
+func (s *BehaviorSet) Clear(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remove(name)
+}
+
+// Current returns the result of merging all the active behaviors.
+func (s *BehaviorSet) Current() Behavior {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var result Behavior
+	for _, layer := range s.layers {
+		result = result.Merge(layer.behavior)
+	}
+	return result
+}
+
+func (s *BehaviorSet) remove(name string) {
+	for i, layer := range s.layers {
+		if layer.name == name {
+			s.layers = append(s.layers[:i], s.layers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package dummy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Protocols supported by the load generator:
+const (
+	BenchProtocolHTTP1 = ProtocolHTTP1
+	BenchProtocolHTTP2 = ProtocolHTTP2
+)
+
+// Defaults of the load generator:
+const (
+	DefaultBenchConnections = 4
+	DefaultBenchDuration    = 10 * time.Second
+)
+
+// Settings of the detection of the steady state. The throughput is sampled every second, and the steady state is
+// reached when the coefficient of variation of the last samples is below the threshold.
+const (
+	steadyStateInterval = time.Second
+	steadyStateSamples  = 5
+)
+
+// BenchOptions contains the settings of the load generator.
+type BenchOptions struct {
+	// Target is the URL of the data endpoint of the server, optionally with query parameters.
+	Target string
+
+	// Connections is the number of concurrent connections, each one sending one request after another. The default
+	// is four.
+	Connections int
+
+	// Duration is the duration of the run. The default is ten seconds.
+	Duration time.Duration
+
+	// Size is the size of the data requested in each request. Zero means the server default.
+	Size int
+
+	// Transport contains the settings of the HTTP transport. The protocol is 'http1' by default, instead of
+	// negotiated, and with plain text URLs HTTP/2 uses prior knowledge.
+	Transport TransportOptions
+
+	// Buffer is the size of the buffer used to read the data. The default is 32 KiB.
+	Buffer int
+
+	// Warmup is the duration of the initial phase whose requests are excluded from the results, so that effects like
+	// the TCP slow start don't pollute them. The default is no warm up.
+	Warmup time.Duration
+
+	// SteadyState is the maximum coefficient of variation of the throughput of the last five seconds for the load to
+	// be considered steady. When it is set the warm up is extended till the steady state is reached, or till the
+	// configured duration has passed. Zero, the default, disables the detection.
+	SteadyState float64
+}
+
+// BenchResult is the report of a run of the load generator.
+type BenchResult struct {
+	Target        string                   `json:"target"`
+	Protocol      string                   `json:"protocol"`
+	Connections   int                      `json:"connections"`
+	Elapsed       Duration                 `json:"elapsed"`
+	Requests      int                      `json:"requests"`
+	Errors        int                      `json:"errors"`
+	Bytes         int64                    `json:"bytes"`
+	Throughput    float64                  `json:"throughput"`
+	Latency       *BenchLatency            `json:"latency,omitempty"`
+	ErrorCounts   map[string]int           `json:"error_counts,omitempty"`
+	PerConnection []*BenchConnectionResult `json:"per_connection"`
+
+	// Warmup is the actual duration of the warm up, including the time needed to reach the steady state.
+	Warmup Duration `json:"warmup,omitempty"`
+
+	// SteadyState is the result of the detection of the steady state, if enabled.
+	SteadyState *BenchSteadyState `json:"steady_state,omitempty"`
+
+	latencies []float64
+}
+
+// BenchSteadyState is the result of the detection of the steady state. CV is the last coefficient of variation
+// calculated, and Reached is false if it was still above the threshold when the maximum warm up expired.
+type BenchSteadyState struct {
+	Reached bool    `json:"reached"`
+	CV      float64 `json:"cv"`
+}
+
+// BenchLatency contains the percentiles of the time to the first byte of the responses.
+type BenchLatency struct {
+	P50 Duration `json:"p50"`
+	P90 Duration `json:"p90"`
+	P99 Duration `json:"p99"`
+	Max Duration `json:"max"`
+}
+
+// BenchConnectionResult contains the measurements of one of the connections of the load generator.
+type BenchConnectionResult struct {
+	Index      int     `json:"index"`
+	Requests   int     `json:"requests"`
+	Errors     int     `json:"errors"`
+	Bytes      int64   `json:"bytes"`
+	Throughput float64 `json:"throughput"`
+
+	latencies []float64
+	errors    map[string]int
+}
+
+// Bench is a load generator that sends requests to the data endpoint of a server from several concurrent
+// connections, and reports the aggregated and per connection measurements.
+type Bench struct {
+	logger  *slog.Logger
+	options BenchOptions
+	address string
+}
+
+// NewBench creates a load generator with the given options.
+func NewBench(logger *slog.Logger, options BenchOptions) (result *Bench, err error) {
+	if options.Connections == 0 {
+		options.Connections = DefaultBenchConnections
+	}
+	if options.Connections < 0 {
+		err = fmt.Errorf("number of connections %d is negative", options.Connections)
+		return
+	}
+	if options.Duration == 0 {
+		options.Duration = DefaultBenchDuration
+	}
+	if options.Duration < 0 {
+		err = fmt.Errorf("duration %s is negative", options.Duration)
+		return
+	}
+	if options.Warmup < 0 {
+		err = fmt.Errorf("warm up %s is negative", options.Warmup)
+		return
+	}
+	if options.SteadyState < 0 {
+		err = fmt.Errorf("steady state threshold %g is negative", options.SteadyState)
+		return
+	}
+	if options.Transport.Protocol == "" {
+		options.Transport.Protocol = BenchProtocolHTTP1
+	}
+	_, err = NewTransport(options.Transport)
+	if err != nil {
+		return
+	}
+	if options.Buffer == 0 {
+		options.Buffer = DefaultBufferSize
+	}
+	address, err := ClientAddress(options.Target, options.Size, "")
+	if err != nil {
+		return
+	}
+	result = &Bench{
+		logger:  logger,
+		options: options,
+		address: address,
+	}
+	return
+}
+
+// Run runs the load generator till the configured warm up and duration expire or the context is cancelled.
+func (b *Bench) Run(ctx context.Context) (result *BenchResult, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Create the clients before starting, so that all connections start at the same time:
+	clients := make([]*http.Client, b.options.Connections)
+	for i := range clients {
+		clients[i], err = b.newClient()
+		if err != nil {
+			return
+		}
+	}
+
+	// The throughput is sampled only when the steady state needs to be detected:
+	var detector *steadyStateDetector
+	var progress *progressMeter
+	if b.options.SteadyState > 0 {
+		detector = newSteadyStateDetector(b.options.SteadyState)
+		progress = startProgress(steadyStateInterval, detector.add)
+	}
+
+	// Run the connections in parallel. The requests are counted only if they start after the beginning of the
+	// measurement, which is set now if there is no warm up.
+	var measureStart atomic.Int64
+	start := time.Now()
+	if b.options.Warmup == 0 && detector == nil {
+		measureStart.Store(start.UnixNano())
+	}
+	connections := make([]*BenchConnectionResult, len(clients))
+	var wait sync.WaitGroup
+	for i, client := range clients {
+		connections[i] = &BenchConnectionResult{
+			Index:  i,
+			errors: map[string]int{},
+		}
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			defer client.CloseIdleConnections()
+			b.runConnection(ctx, client, connections[i], &measureStart, progress)
+		}()
+	}
+
+	// Wait for the warm up, and then for the steady state, if requested:
+	var steadyState *BenchSteadyState
+	if b.options.Warmup > 0 {
+		b.sleep(ctx, b.options.Warmup)
+	}
+	if detector != nil {
+		steadyState = b.waitSteadyState(ctx, detector)
+	}
+	warmup := time.Since(start)
+	if measureStart.Load() == 0 {
+		b.logger.Info(
+			"Warm up finished",
+			slog.String("elapsed", warmup.String()),
+		)
+		measureStart.Store(time.Now().UnixNano())
+	} else {
+		warmup = 0
+	}
+
+	// Wait for the measurement and then stop the connections:
+	b.sleep(ctx, b.options.Duration-time.Since(time.Unix(0, measureStart.Load())))
+	cancel()
+	wait.Wait()
+	progress.Stop()
+	elapsed := time.Since(time.Unix(0, measureStart.Load()))
+
+	// Aggregate the results:
+	result = &BenchResult{
+		Target:        b.address,
+		Protocol:      b.options.Transport.Protocol,
+		Connections:   b.options.Connections,
+		Elapsed:       Duration(elapsed),
+		PerConnection: connections,
+		Warmup:        Duration(warmup),
+		SteadyState:   steadyState,
+	}
+	var latencies []float64
+	for _, connection := range connections {
+		connection.Throughput = float64(connection.Bytes) / elapsed.Seconds()
+		result.Requests += connection.Requests
+		result.Errors += connection.Errors
+		result.Bytes += connection.Bytes
+		latencies = append(latencies, connection.latencies...)
+		for message, count := range connection.errors {
+			if result.ErrorCounts == nil {
+				result.ErrorCounts = map[string]int{}
+			}
+			result.ErrorCounts[message] += count
+		}
+	}
+	result.Throughput = float64(result.Bytes) / elapsed.Seconds()
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		result.latencies = latencies
+		result.Latency = &BenchLatency{
+			P50: benchSeconds(percentile(latencies, 0.50)),
+			P90: benchSeconds(percentile(latencies, 0.90)),
+			P99: benchSeconds(percentile(latencies, 0.99)),
+			Max: benchSeconds(latencies[len(latencies)-1]),
+		}
+	}
+	b.logger.Info(
+		"Benchmark finished",
+		slog.Int("requests", result.Requests),
+		slog.Int("errors", result.Errors),
+		slog.Int64("bytes", result.Bytes),
+		slog.Float64("throughput", result.Throughput),
+	)
+	return
+}
+
+// sleep waits till the given duration passes or the context is cancelled.
+func (b *Bench) sleep(ctx context.Context, duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// waitSteadyState waits till the detector signals that the steady state has been reached, or till the configured
+// duration passes.
+func (b *Bench) waitSteadyState(ctx context.Context, detector *steadyStateDetector) *BenchSteadyState {
+	timer := time.NewTimer(b.options.Duration)
+	defer timer.Stop()
+	select {
+	case <-detector.reached:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	result := detector.result()
+	if !result.Reached {
+		b.logger.Warn(
+			"Steady state not reached",
+			slog.Float64("cv", result.CV),
+			slog.Float64("threshold", b.options.SteadyState),
+		)
+	}
+	return result
+}
+
+// runConnection sends requests one after another using the given client, which has a single connection, till the
+// context is cancelled. The requests that start before the measurement start, or that are interrupted because the
+// run finished, aren't counted, but the bytes that the interrupted ones transferred are. The bytes read are also
+// added to the progress meter, if any, which is used to detect the steady state.
+func (b *Bench) runConnection(ctx context.Context, client *http.Client, result *BenchConnectionResult,
+	measureStart *atomic.Int64, progress *progressMeter) {
+	buffer := make([]byte, b.options.Buffer)
+	for ctx.Err() == nil {
+		start := time.Now()
+		latency, bytes, err := b.send(ctx, client, buffer, start, progress)
+		if measureStart.Load() == 0 || start.UnixNano() < measureStart.Load() {
+			continue
+		}
+		result.Bytes += bytes
+		if ctx.Err() != nil {
+			return
+		}
+		result.Requests++
+		if err != nil {
+			result.Errors++
+			result.errors[err.Error()]++
+			continue
+		}
+		result.latencies = append(result.latencies, latency.Seconds())
+	}
+}
+
+// send sends one request and reads the response. It returns the time to the first byte and the number of bytes read.
+func (b *Bench) send(ctx context.Context, client *http.Client, buffer []byte, start time.Time,
+	progress *progressMeter) (latency time.Duration, bytes int64, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, b.address, nil)
+	if err != nil {
+		return
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		// Remove the method and URL from the message, as they are the same for all requests:
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return
+	}
+	defer response.Body.Close()
+	latency = time.Since(start)
+	var body io.Reader = response.Body
+	if progress != nil {
+		body = &progressReader{
+			reader: body,
+			meter:  progress,
+		}
+	}
+	bytes, err = io.CopyBuffer(io.Discard, body, buffer)
+	if err != nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	return
+}
+
+// newClient creates an HTTP client that uses a single connection with the configured protocol, unless reuse of
+// connections is disabled.
+func (b *Bench) newClient() (result *http.Client, err error) {
+	address, err := url.Parse(b.address)
+	if err != nil {
+		return
+	}
+	transport, err := NewTransport(b.options.Transport)
+	if err != nil {
+		return
+	}
+	transport.MaxConnsPerHost = 1
+	result = &http.Client{
+		Transport: transport,
+		Timeout:   b.options.Transport.Timeout,
+	}
+
+	// For plain text HTTP/2 replace the transport with one that uses prior knowledge, but still dials with the
+	// configured one, so that the address overrides and timeouts are honored:
+	if b.options.Transport.Protocol == BenchProtocolHTTP2 && address.Scheme == "http" {
+		result.Transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return transport.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	return
+}
+
+// steadyStateDetector receives throughput samples and signals when the coefficient of variation of the last ones
+// is below the threshold.
+type steadyStateDetector struct {
+	threshold float64
+	lock      sync.Mutex
+	samples   []float64
+	cv        float64
+	reached   chan struct{}
+	closed    bool
+}
+
+func newSteadyStateDetector(threshold float64) *steadyStateDetector {
+	return &steadyStateDetector{
+		threshold: threshold,
+		cv:        math.Inf(1),
+		reached:   make(chan struct{}),
+	}
+}
+
+// add adds the throughput of a progress record to the samples.
+func (d *steadyStateDetector) add(record *ProgressRecord) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.samples = append(d.samples, record.Rate)
+	if len(d.samples) > steadyStateSamples {
+		d.samples = d.samples[1:]
+	}
+	if len(d.samples) < steadyStateSamples {
+		return
+	}
+	m := mean(d.samples)
+	if m == 0 {
+		return
+	}
+	d.cv = math.Sqrt(variance(d.samples)) / m
+	if d.cv <= d.threshold && !d.closed {
+		close(d.reached)
+		d.closed = true
+	}
+}
+
+// result returns the current state of the detection.
+func (d *steadyStateDetector) result() *BenchSteadyState {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	result := &BenchSteadyState{
+		Reached: d.closed,
+	}
+	if !math.IsInf(d.cv, 1) {
+		result.CV = d.cv
+	}
+	return result
+}
+
+// benchSeconds converts a number of seconds to a duration.
+func benchSeconds(seconds float64) Duration {
+	return Duration(time.Duration(seconds * float64(time.Second)))
+}
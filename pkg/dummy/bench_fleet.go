@@ -0,0 +1,258 @@
+package dummy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ways to discover the servers of a fleet:
+const (
+	FleetDiscoveryAPI = "api"
+	FleetDiscoveryDNS = "dns"
+)
+
+// FleetTarget is one of the servers of a fleet that the load generator sends requests to. Target is the URL of the
+// data endpoint of the server, and Resolve contains the address overrides needed to reach it, in the format of the
+// transport options.
+type FleetTarget struct {
+	ID      string
+	Target  string
+	Resolve []string
+}
+
+// DiscoverFleet finds the servers of the fleet of the given target URL. With the 'api' discovery they are the members
+// returned by the fleet endpoint of the target server, and with the 'dns' discovery they are the addresses of the host
+// name of the target URL, which is usually the one of a headless service. In both cases the path and query of the
+// target URL are kept.
+func DiscoverFleet(ctx context.Context, target, discovery string,
+	transport TransportOptions) (result []FleetTarget, err error) {
+	address, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	switch discovery {
+	case "", FleetDiscoveryAPI:
+		result, err = discoverFleetAPI(ctx, address, transport)
+	case FleetDiscoveryDNS:
+		result, err = discoverFleetDNS(ctx, address, transport)
+	default:
+		err = fmt.Errorf(
+			"discovery should be '%s' or '%s', but it is '%s'",
+			FleetDiscoveryAPI, FleetDiscoveryDNS, discovery,
+		)
+		return
+	}
+	if err == nil && len(result) == 0 {
+		err = fmt.Errorf("no servers found for '%s'", target)
+	}
+	return
+}
+
+// discoverFleetAPI gets the members of the fleet from the fleet endpoint of the target server.
+func discoverFleetAPI(ctx context.Context, address *url.URL, options TransportOptions) (result []FleetTarget,
+	err error) {
+	transport, err := NewTransport(options)
+	if err != nil {
+		return
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   options.Timeout,
+	}
+	endpoint := &url.URL{
+		Scheme: address.Scheme,
+		Host:   address.Host,
+		Path:   FleetPath,
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %d from '%s'", response.StatusCode, endpoint)
+		return
+	}
+	report := &FleetReport{}
+	err = json.NewDecoder(io.LimitReader(response.Body, fleetMaxBody)).Decode(report)
+	if err != nil {
+		err = fmt.Errorf("failed to decode fleet from '%s': %w", endpoint, err)
+		return
+	}
+	for _, member := range report.Members {
+		var base *url.URL
+		base, err = url.Parse(member.URL)
+		if err != nil {
+			err = fmt.Errorf("URL of fleet member '%s' isn't valid: %w", member.ID, err)
+			return
+		}
+		base.Path = strings.TrimRight(base.Path, "/") + address.Path
+		base.RawQuery = address.RawQuery
+		result = append(result, FleetTarget{
+			ID:      member.ID,
+			Target:  base.String(),
+			Resolve: options.Resolve,
+		})
+	}
+	return
+}
+
+// discoverFleetDNS resolves the host name of the target URL, and returns a target for each address. The URL of the
+// targets is the same, so that the TLS server name doesn't change, and the address is selected with an override.
+func discoverFleetDNS(ctx context.Context, address *url.URL, options TransportOptions) (result []FleetTarget,
+	err error) {
+	host := address.Hostname()
+	port := address.Port()
+	if port == "" {
+		port = "80"
+		if address.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return
+	}
+	slices.Sort(addresses)
+	for _, ip := range addresses {
+		override := fmt.Sprintf("%s:%s:%s", host, port, ip)
+		if strings.Contains(ip, ":") {
+			override = fmt.Sprintf("%s:%s:[%s]", host, port, ip)
+		}
+		result = append(result, FleetTarget{
+			ID:      ip,
+			Target:  address.String(),
+			Resolve: append(slices.Clone(options.Resolve), override),
+		})
+	}
+	return
+}
+
+// FleetBenchResult is the report of a run of the load generator against all the servers of a fleet. The totals are
+// the sums of the results of the targets, which run in parallel.
+type FleetBenchResult struct {
+	Connections int                 `json:"connections"`
+	Elapsed     Duration            `json:"elapsed"`
+	Requests    int                 `json:"requests"`
+	Errors      int                 `json:"errors"`
+	Bytes       int64               `json:"bytes"`
+	Throughput  float64             `json:"throughput"`
+	Targets     []*FleetBenchTarget `json:"targets"`
+}
+
+// FleetBenchTarget is the result of the load generator for one of the servers of a fleet.
+type FleetBenchTarget struct {
+	ID string `json:"id"`
+	*BenchResult
+}
+
+// FleetBench is a load generator that distributes the connections across the servers of a fleet, and reports the
+// results of each server and the totals.
+type FleetBench struct {
+	logger  *slog.Logger
+	targets []FleetTarget
+	benches []*Bench
+}
+
+// NewFleetBench creates a load generator for the given servers. The connections are distributed across them in round
+// robin, with at least one connection for each server.
+func NewFleetBench(logger *slog.Logger, options BenchOptions, targets []FleetTarget) (result *FleetBench,
+	err error) {
+	if len(targets) == 0 {
+		err = fmt.Errorf("there are no targets")
+		return
+	}
+	connections := options.Connections
+	if connections == 0 {
+		connections = DefaultBenchConnections
+	}
+	if connections < len(targets) {
+		logger.Warn(
+			"Fewer connections than targets, using one connection per target",
+			slog.Int("connections", connections),
+			slog.Int("targets", len(targets)),
+		)
+		connections = len(targets)
+	}
+	benches := make([]*Bench, len(targets))
+	for i, target := range targets {
+		targetOptions := options
+		targetOptions.Target = target.Target
+		targetOptions.Transport.Resolve = target.Resolve
+		targetOptions.Connections = connections / len(targets)
+		if i < connections%len(targets) {
+			targetOptions.Connections++
+		}
+		benches[i], err = NewBench(logger.With(slog.String("target", target.ID)), targetOptions)
+		if err != nil {
+			err = fmt.Errorf("failed to create benchmark for target '%s': %w", target.ID, err)
+			return
+		}
+	}
+	result = &FleetBench{
+		logger:  logger,
+		targets: targets,
+		benches: benches,
+	}
+	return
+}
+
+// Run runs the load generator against all the servers in parallel, till the configured warm up and duration expire
+// or the context is cancelled.
+func (b *FleetBench) Run(ctx context.Context) (result *FleetBenchResult, err error) {
+	results := make([]*BenchResult, len(b.benches))
+	errs := make([]error, len(b.benches))
+	var wait sync.WaitGroup
+	for i, bench := range b.benches {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			results[i], errs[i] = bench.Run(ctx)
+		}()
+	}
+	wait.Wait()
+	result = &FleetBenchResult{}
+	for i, target := range b.targets {
+		if errs[i] != nil {
+			err = fmt.Errorf("failed to run benchmark for target '%s': %w", target.ID, errs[i])
+			result = nil
+			return
+		}
+		targetResult := results[i]
+		result.Targets = append(result.Targets, &FleetBenchTarget{
+			ID:          target.ID,
+			BenchResult: targetResult,
+		})
+		result.Connections += targetResult.Connections
+		result.Requests += targetResult.Requests
+		result.Errors += targetResult.Errors
+		result.Bytes += targetResult.Bytes
+		result.Throughput += targetResult.Throughput
+		result.Elapsed = max(result.Elapsed, targetResult.Elapsed)
+	}
+	b.logger.Info(
+		"Fleet benchmark finished",
+		slog.Int("targets", len(result.Targets)),
+		slog.Int("requests", result.Requests),
+		slog.Int("errors", result.Errors),
+		slog.Int64("bytes", result.Bytes),
+		slog.Float64("throughput", result.Throughput),
+		slog.String("elapsed", time.Duration(result.Elapsed).String()),
+	)
+	return
+}
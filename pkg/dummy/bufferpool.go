@@ -0,0 +1,123 @@
+package dummy
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Sizes of the smallest and largest buffer tiers. Tiers are the powers of two between these two values.
+const (
+	minBufferTier = 4 * (1 << 10) // 4 KiB
+	maxBufferTier = 4 * (1 << 20) // 4 MiB
+)
+
+// BufferPool is a set of pools of data buffers, one for each size tier. Requests for buffers are served from the
+// smallest tier that is large enough, so that buffers can be reused by requests with similar buffer sizes. Buffers
+// larger than the largest tier aren't pooled.
+type BufferPool struct {
+	tiers         []*bufferTier
+	getCount      *prometheus.CounterVec
+	allocCount    *prometheus.CounterVec
+	allocBytes    *prometheus.CounterVec
+	unpooledCount prometheus.Counter
+	unpooledBytes prometheus.Counter
+}
+
+type bufferTier struct {
+	size  int
+	label string
+	pool  sync.Pool
+}
+
+// NewBufferPool creates a new buffer pool and registers its allocation metrics with the given registerer.
+func NewBufferPool(registerer prometheus.Registerer) (result *BufferPool, err error) {
+	getCount := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_buffer_pool_gets_total",
+			Help: "Number of buffers requested from the pool.",
+		},
+		[]string{"tier"},
+	)
+	allocCount := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_buffer_pool_allocations_total",
+			Help: "Number of buffers allocated because there was no buffer available in the pool.",
+		},
+		[]string{"tier"},
+	)
+	allocBytes := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_buffer_pool_allocated_bytes_total",
+			Help: "Number of bytes allocated for buffers.",
+		},
+		[]string{"tier"},
+	)
+	for _, collector := range []prometheus.Collector{getCount, allocCount, allocBytes} {
+		err = registerer.Register(collector)
+		if err != nil {
+			return
+		}
+	}
+	pool := &BufferPool{
+		getCount:   getCount,
+		allocCount: allocCount,
+		allocBytes: allocBytes,
+	}
+	for size := minBufferTier; size <= maxBufferTier; size *= 2 {
+		tier := &bufferTier{
+			size:  size,
+			label: strconv.Itoa(size),
+		}
+		tier.pool.New = func() any {
+			pool.allocCount.WithLabelValues(tier.label).Inc()
+			pool.allocBytes.WithLabelValues(tier.label).Add(float64(tier.size))
+			buffer := make([]byte, tier.size)
+			return &buffer
+		}
+		pool.tiers = append(pool.tiers, tier)
+	}
+	pool.unpooledCount = allocCount.WithLabelValues("unpooled")
+	pool.unpooledBytes = allocBytes.WithLabelValues("unpooled")
+	result = pool
+	return
+}
+
+// Get returns a buffer with the given size. The buffer should be returned to the pool with the Put method when it
+// is no longer needed.
+func (p *BufferPool) Get(size int) *[]byte {
+	tier := p.tier(size)
+	if tier == nil {
+		p.getCount.WithLabelValues("unpooled").Inc()
+		p.unpooledCount.Inc()
+		p.unpooledBytes.Add(float64(size))
+		buffer := make([]byte, size)
+		return &buffer
+	}
+	p.getCount.WithLabelValues(tier.label).Inc()
+	buffer := tier.pool.Get().(*[]byte)
+	*buffer = (*buffer)[0:size]
+	return buffer
+}
+
+// Put returns to the pool a buffer that was obtained with the Get method.
+func (p *BufferPool) Put(buffer *[]byte) {
+	tier := p.tier(cap(*buffer))
+	if tier == nil || tier.size != cap(*buffer) {
+		return
+	}
+	*buffer = (*buffer)[0:tier.size]
+	tier.pool.Put(buffer)
+}
+
+// tier returns the smallest tier that can hold buffers of the given size, or nil if the size is larger than the
+// largest tier.
+func (p *BufferPool) tier(size int) *bufferTier {
+	for _, tier := range p.tiers {
+		if tier.size >= size {
+			return tier
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package dummy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Capabilities describes what this build and instance of the server supports, so that orchestration tools can adapt
+// to fleets running different builds or configurations.
+type Capabilities struct {
+	Version      string            `json:"version"`
+	Revision     string            `json:"revision,omitempty"`
+	GoVersion    string            `json:"go_version"`
+	Instance     string            `json:"instance,omitempty"`
+	Endpoints    []string          `json:"endpoints"`
+	Protocols    []string          `json:"protocols"`
+	Patterns     []string          `json:"patterns"`
+	Sources      []string          `json:"sources"`
+	RandomSource string            `json:"random_source"`
+	Encodings    []string          `json:"encodings"`
+	CachePresets []string          `json:"cache_presets"`
+	Deprecated   map[string]string `json:"deprecated_parameters"`
+	Limits       CapabilityLimits  `json:"limits"`
+}
+
+// CapabilityLimits contains the limits and defaults of the server.
+type CapabilityLimits struct {
+	DefaultSize   int      `json:"default_size"`
+	DefaultBuffer int      `json:"default_buffer"`
+	MaxSize       int      `json:"max_size,omitempty"`
+	MaxBuffer     int      `json:"max_buffer,omitempty"`
+	MaxBytes      int64    `json:"max_bytes_per_request,omitempty"`
+	MaxDuration   Duration `json:"max_duration,omitempty"`
+	MaxPooled     int      `json:"max_pooled_buffer"`
+	PatternBlob   int      `json:"pattern_blob"`
+}
+
+// BuildVersion returns the version of the main module and the revision of the source code, as recorded by the Go
+// tool chain in the binary.
+func BuildVersion() (version, revision string) {
+	version = "unknown"
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if info.Main.Version != "" {
+		version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			revision = setting.Value
+		}
+	}
+	return
+}
+
+// CapabilitiesHandler is an HTTP handler that returns the capabilities of the server as a JSON document.
+type CapabilitiesHandler struct {
+	logger       *slog.Logger
+	capabilities *Capabilities
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *CapabilitiesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(h.capabilities)
+	if err != nil {
+		h.logger.Error(
+			"Failed to send capabilities",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// Router is a wrapper for the HTTP request multiplexer that remembers the patterns that have been registered, so that
+// they can be reported as capabilities.
+type Router struct {
+	*http.ServeMux
+	patterns []string
+}
+
+// NewRouter creates a new empty router.
+func NewRouter() *Router {
+	return &Router{
+		ServeMux: http.NewServeMux(),
+	}
+}
+
+// Handle registers the handler for the given pattern.
+func (r *Router) Handle(pattern string, handler http.Handler) {
+	r.ServeMux.Handle(pattern, handler)
+	r.patterns = append(r.patterns, pattern)
+}
+
+// Patterns returns the registered patterns, sorted by path.
+func (r *Router) Patterns() []string {
+	result := slices.Clone(r.patterns)
+	slices.SortFunc(result, func(a, b string) int {
+		return strings.Compare(routePath(a), routePath(b))
+	})
+	return result
+}
+
+// routePath returns the path part of a pattern, without the method.
+func routePath(pattern string) string {
+	_, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		return pattern
+	}
+	return path
+}
+
+// newCapabilities returns the capabilities that don't depend on the configuration of the server, the rest are filled
+// by the caller.
+func newCapabilities() *Capabilities {
+	version, revision := BuildVersion()
+	patterns := []string{patternRandom}
+	for name := range patternFills {
+		patterns = append(patterns, name)
+	}
+	slices.Sort(patterns[1:])
+	return &Capabilities{
+		Version:      version,
+		Revision:     revision,
+		GoVersion:    runtime.Version(),
+		Patterns:     patterns,
+		Sources:      DataSourceNames(),
+		Encodings:    slices.Clone(supportedEncodings),
+		CachePresets: cachePresetNames(),
+		Deprecated:   maps.Clone(paramAliases),
+		Limits: CapabilityLimits{
+			DefaultSize:   DefaultDataSize,
+			DefaultBuffer: DefaultBufferSize,
+			MaxPooled:     maxBufferTier,
+			PatternBlob:   defaultPatternSize,
+		},
+	}
+}
@@ -0,0 +1,89 @@
+package dummy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// Name of the behavior layer used by the chaos mode.
+const chaosLayer = "chaos"
+
+// ChaosStatus is the document used by the chaos admin endpoint.
+type ChaosStatus struct {
+	Enabled  bool     `json:"enabled"`
+	Behavior Behavior `json:"behavior"`
+}
+
+// ChaosHandler is an HTTP handler that manages the chaos mode, a behavior that is applied to all the requests till
+// it is disabled. The GET method returns the current chaos behavior, the PUT method replaces it with the behavior in
+// the request body, and the DELETE method disables it.
+type ChaosHandler struct {
+	logger    *slog.Logger
+	behaviors *BehaviorSet
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *ChaosHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var behavior Behavior
+		err = json.Unmarshal(data, &behavior)
+		if err == nil {
+			err = behavior.Validate()
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("chaos behavior isn't valid: %v", err), http.StatusBadRequest)
+			return
+		}
+		h.behaviors.Set(chaosLayer, behavior)
+		h.logger.Info(
+			"Enabled chaos mode",
+			slog.Any("behavior", behavior),
+		)
+	case http.MethodDelete:
+		h.behaviors.Clear(chaosLayer)
+		h.logger.Info("Disabled chaos mode")
+	}
+
+	// Send the current status:
+	var status ChaosStatus
+	status.Behavior, status.Enabled = h.behaviors.Get(chaosLayer)
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(&status)
+	if err != nil {
+		h.logger.Error(
+			"Failed to send chaos status",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// resetConnection closes the connection of the request abruptly. For HTTP/1 the connection is hijacked and closed
+// with a zero linger time, so that the client receives a TCP reset. For HTTP/2 only the stream is reset, because the
+// connection is shared with other requests.
+func resetConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		netConn, ok := conn.(interface{ NetConn() net.Conn })
+		if ok {
+			tcpConn, _ = netConn.NetConn().(*net.TCPConn)
+		}
+	}
+	if tcpConn != nil {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
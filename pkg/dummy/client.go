@@ -0,0 +1,288 @@
+package dummy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ClientResult contains the measurements of one download performed by the client.
+type ClientResult struct {
+	URL        string    `json:"url"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Start      time.Time `json:"start"`
+	Elapsed    Duration  `json:"elapsed"`
+	Throughput float64   `json:"throughput"`
+	Instance   string    `json:"instance,omitempty"`
+	Error      string    `json:"error,omitempty"`
+
+	// ServerElapsed and ServerThroughput are the measurements made by the server, taken from the response
+	// trailers. They are empty if the server or a proxy in the path doesn't send trailers.
+	ServerElapsed    string  `json:"server_elapsed,omitempty"`
+	ServerThroughput float64 `json:"server_throughput,omitempty"`
+
+	// Clock is the estimation of the offset between the clocks of the client and the server, if requested with the
+	// '--clock' flag.
+	Clock *ClockEstimate `json:"clock,omitempty"`
+
+	// Reach contains the results of the reachability checks, if requested with the '--ping', '--traceroute' or
+	// '--mtu' flags.
+	Reach *ReachReport `json:"reach,omitempty"`
+
+	// Digest and ServerDigest are the digests of the uploaded data calculated by the client and by the server, if
+	// requested with the '--digest' flag. When they are different the error contains a corruption message.
+	Digest       string `json:"digest,omitempty"`
+	ServerDigest string `json:"server_digest,omitempty"`
+
+	// Streams are the measurements of each of the range requests of a parallel download, requested with the
+	// '--streams' flag.
+	Streams []*StreamResult `json:"streams,omitempty"`
+
+	// Timing contains the durations of the phases of the request. For uploads the time to the first byte includes
+	// sending the body. For parallel downloads it is in each of the streams instead.
+	Timing *ClientTiming `json:"timing,omitempty"`
+
+	// Progress contains the bytes transferred in each interval, if progress reporting was enabled with the
+	// SetProgress method.
+	Progress []*ProgressRecord `json:"progress,omitempty"`
+}
+
+// Client downloads data from a dummy server and measures the throughput.
+type Client struct {
+	httpClient       *http.Client
+	buffer           int
+	progressInterval time.Duration
+	progressReport   func(*ProgressRecord)
+}
+
+// NewClient creates a client that uses the given buffer size to read the data.
+func NewClient(insecure bool, buffer int) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: insecure,
+				},
+				ForceAttemptHTTP2: true,
+			},
+		},
+		buffer: buffer,
+	}
+}
+
+// NewClientWithTransport creates a client that uses a transport with the given options and the given buffer size to
+// read the data.
+func NewClientWithTransport(options TransportOptions, buffer int) (result *Client, err error) {
+	transport, err := NewTransport(options)
+	if err != nil {
+		return
+	}
+	result = &Client{
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   options.Timeout,
+		},
+		buffer: buffer,
+	}
+	return
+}
+
+// SetProgress enables progress reporting: during each transfer the given function is called every interval with the
+// bytes transferred and the rate, and the records are also added to the result. A zero interval disables it.
+func (c *Client) SetProgress(interval time.Duration, report func(*ProgressRecord)) {
+	c.progressInterval = interval
+	c.progressReport = report
+}
+
+// startProgress starts the progress meter of a transfer, or returns nil if progress reporting is disabled.
+func (c *Client) startProgress() *progressMeter {
+	return startProgress(c.progressInterval, c.progressReport)
+}
+
+// ClientAddress adds to the given target address the query parameters that request the given size and pattern. Zero
+// or empty values aren't added, so that the server uses its defaults.
+func ClientAddress(target string, size int, pattern string) (result string, err error) {
+	address, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	query := address.Query()
+	if size > 0 {
+		query.Set("size", strconv.Itoa(size))
+	}
+	if pattern != "" {
+		query.Set("pattern", pattern)
+	}
+	address.RawQuery = query.Encode()
+	result = address.String()
+	return
+}
+
+// Download downloads the data from the given address, discarding it, and returns the measurements.
+func (c *Client) Download(ctx context.Context, address string) *ClientResult {
+	result := &ClientResult{
+		URL:   address,
+		Start: time.Now(),
+	}
+	tracer, ctx := newTimingTracer(ctx)
+	defer func() {
+		result.Timing = tracer.finish()
+		elapsed := time.Since(result.Start)
+		result.Elapsed = Duration(elapsed)
+		if elapsed > 0 {
+			result.Throughput = float64(result.Bytes) / elapsed.Seconds()
+		}
+	}()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer response.Body.Close()
+	result.Status = response.StatusCode
+	result.Instance = response.Header.Get(instanceHeader)
+	progress := c.startProgress()
+	var body io.Reader = response.Body
+	if progress != nil {
+		body = &progressReader{
+			reader: body,
+			meter:  progress,
+		}
+	}
+	result.Bytes, err = io.CopyBuffer(io.Discard, body, make([]byte, c.buffer))
+	result.Progress = progress.Stop()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.ServerElapsed = response.Trailer.Get(elapsedTrailer)
+	result.ServerThroughput, _ = strconv.ParseFloat(response.Trailer.Get(throughputTrailer), 64)
+	return result
+}
+
+// Upload sends the given number of bytes of pseudo random data to the upload endpoint, and returns the measurements.
+// If the address doesn't have a path the '/upload' path is used. If a digest algorithm is given the client calculates
+// the digest of the data that it sends, and compares it with the one calculated by the server to detect corruption.
+func (c *Client) Upload(ctx context.Context, address string, size int64, digestName string) *ClientResult {
+	result := &ClientResult{
+		Start: time.Now(),
+	}
+	tracer, ctx := newTimingTracer(ctx)
+	defer func() {
+		result.Timing = tracer.finish()
+		elapsed := time.Since(result.Start)
+		result.Elapsed = Duration(elapsed)
+		if elapsed > 0 {
+			result.Throughput = float64(result.Bytes) / elapsed.Seconds()
+		}
+	}()
+	address, err := uploadAddress(address, digestName)
+	result.URL = address
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Prepare the data, calculating the digest while it is sent:
+	var seed [32]byte
+	_, err = rand.Read(seed[:])
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	var body io.Reader = newSyntheticData(seed, size)
+	var digest hash.Hash
+	if digestName != "" {
+		digest, err = NewDigest(digestName)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		body = io.TeeReader(body, digest)
+	}
+	progress := c.startProgress()
+	if progress != nil {
+		body = &progressReader{
+			reader: body,
+			meter:  progress,
+		}
+	}
+
+	// Send the data:
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, address, body)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	request.ContentLength = size
+	request.Header.Set("Content-Type", "application/octet-stream")
+	response, err := c.httpClient.Do(request)
+	result.Progress = progress.Stop()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer response.Body.Close()
+	result.Status = response.StatusCode
+	result.Instance = response.Header.Get(instanceHeader)
+	if response.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, response.Body)
+		return result
+	}
+	var upload UploadResult
+	err = json.NewDecoder(response.Body).Decode(&upload)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Bytes = upload.Bytes
+	result.ServerElapsed = time.Duration(upload.Elapsed).String()
+	result.ServerThroughput = upload.Throughput
+
+	// Compare the digests:
+	if digest != nil {
+		result.Digest = hex.EncodeToString(digest.Sum(nil))
+		result.ServerDigest = upload.Digest
+		if result.Digest != result.ServerDigest {
+			result.Error = fmt.Sprintf(
+				"data is corrupted, %s digest sent is '%s' but server received '%s'",
+				digestName, result.Digest, result.ServerDigest,
+			)
+		}
+	}
+	return result
+}
+
+// uploadAddress returns the address of the upload endpoint, adding the digest query parameter.
+func uploadAddress(address string, digestName string) (result string, err error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/upload"
+	}
+	if digestName != "" {
+		query := parsed.Query()
+		query.Set("digest", digestName)
+		parsed.RawQuery = query.Encode()
+	}
+	result = parsed.String()
+	return
+}
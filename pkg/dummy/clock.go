@@ -0,0 +1,137 @@
+package dummy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ClockResult is the response of the clock endpoint. It contains the four timestamps of an NTP style exchange: T1 is
+// the time when the client sent the request, as given by the client in the 't1' query parameter, T2 is the time when
+// the server received it, and T3 is the time when the server sent the response. The client adds T4, the time when
+// it received the response, and uses the four to estimate the offset of its clock and the network delay.
+type ClockResult struct {
+	T1 time.Time `json:"t1"`
+	T2 time.Time `json:"t2"`
+	T3 time.Time `json:"t3"`
+	T4 time.Time `json:"-"`
+}
+
+// Offset returns the estimated offset of the clock of the server relative to the clock of the client. A positive
+// value means that the clock of the server is ahead.
+func (r *ClockResult) Offset() time.Duration {
+	return (r.T2.Sub(r.T1) + r.T3.Sub(r.T4)) / 2
+}
+
+// Delay returns the round trip network delay, excluding the time spent by the server processing the request.
+func (r *ClockResult) Delay() time.Duration {
+	return r.T4.Sub(r.T1) - r.T3.Sub(r.T2)
+}
+
+// ClockHandler is an HTTP handler that implements an NTP style exchange of timestamps, so that clients can estimate the
+// offset between their clock and the clock of the server, and then the one way delays of other requests.
+type ClockHandler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *ClockHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Take the receive time before doing anything else:
+	result := &ClockResult{
+		T2: time.Now().UTC(),
+	}
+	h.identity.SetHeaders(w.Header())
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Get the parameters:
+	text := r.URL.Query().Get("t1")
+	if text != "" {
+		var err error
+		result.T1, err = time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("t1 '%s' should be an RFC 3339 timestamp", text), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Send the result, taking the send time as late as possible:
+	w.Header().Set("Content-Type", "application/json")
+	result.T3 = time.Now().UTC()
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		h.logger.Error(
+			"Failed to send clock result",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// ClockEstimate is the estimation of the clock offset made by the client.
+type ClockEstimate struct {
+	Offset  Duration `json:"offset"`
+	Delay   Duration `json:"delay"`
+	Samples int      `json:"samples"`
+}
+
+// EstimateClock performs the given number of exchanges with the clock endpoint of the server and returns the offset
+// estimated by the exchange with the smallest delay, as that is the one less affected by queueing in the network.
+func (c *Client) EstimateClock(ctx context.Context, target string, samples int) (result *ClockEstimate, err error) {
+	address, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	address.Path = "/clock"
+	var best *ClockResult
+	for i := 0; i < samples; i++ {
+		var sample *ClockResult
+		sample, err = c.exchangeClock(ctx, address)
+		if err != nil {
+			return
+		}
+		if best == nil || sample.Delay() < best.Delay() {
+			best = sample
+		}
+	}
+	if best == nil {
+		err = fmt.Errorf("at least one clock sample is needed")
+		return
+	}
+	result = &ClockEstimate{
+		Offset:  Duration(best.Offset()),
+		Delay:   Duration(best.Delay()),
+		Samples: samples,
+	}
+	return
+}
+
+// exchangeClock performs one exchange with the clock endpoint of the server.
+func (c *Client) exchangeClock(ctx context.Context, address *url.URL) (result *ClockResult, err error) {
+	t1 := time.Now()
+	address.RawQuery = url.Values{"t1": {t1.UTC().Format(time.RFC3339Nano)}}.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address.String(), nil)
+	if err != nil {
+		return
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("clock request failed with status %d", response.StatusCode)
+		return
+	}
+	result = &ClockResult{}
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return
+	}
+	result.T1 = t1
+	result.T4 = time.Now()
+	return
+}
@@ -0,0 +1,190 @@
+package dummy
+
+import (
+	"math"
+	"time"
+)
+
+// significanceLevel is the maximum p-value for a difference to be considered significant.
+const significanceLevel = 0.05
+
+// BenchComparison is the report of the comparison of two runs of the load generator with the same workload against
+// two different targets, for example the same server behind two different proxies.
+type BenchComparison struct {
+	A      *BenchResult  `json:"a"`
+	B      *BenchResult  `json:"b"`
+	Deltas []*BenchDelta `json:"deltas"`
+}
+
+// BenchDelta is the difference of one metric between the two runs of a comparison. Delta is the value of B minus the
+// value of A, and Relative is that delta divided by the value of A. For the metrics calculated from samples, the
+// throughput of the connections and the latency of the requests, PValue is the result of the Welch's t-test, and
+// Significant is true when it is below 0.05.
+type BenchDelta struct {
+	Metric      string   `json:"metric"`
+	A           float64  `json:"a"`
+	B           float64  `json:"b"`
+	Delta       float64  `json:"delta"`
+	Relative    float64  `json:"relative"`
+	PValue      *float64 `json:"p_value,omitempty"`
+	Significant bool     `json:"significant"`
+}
+
+// CompareBench calculates the differences of the metrics of two runs of the load generator.
+func CompareBench(a, b *BenchResult) *BenchComparison {
+	result := &BenchComparison{
+		A: a,
+		B: b,
+	}
+	add := func(metric string, valueA, valueB float64, samplesA, samplesB []float64) {
+		delta := &BenchDelta{
+			Metric: metric,
+			A:      valueA,
+			B:      valueB,
+			Delta:  valueB - valueA,
+		}
+		if valueA != 0 {
+			delta.Relative = delta.Delta / valueA
+		}
+		if samplesA != nil && samplesB != nil {
+			p, ok := welchTest(samplesA, samplesB)
+			if ok {
+				delta.PValue = &p
+				delta.Significant = p < significanceLevel
+			}
+		}
+		result.Deltas = append(result.Deltas, delta)
+	}
+
+	// Throughput, using the connections as samples:
+	add("throughput", a.Throughput, b.Throughput, connectionThroughputs(a), connectionThroughputs(b))
+	add("requests", float64(a.Requests), float64(b.Requests), nil, nil)
+	add("errors", float64(a.Errors), float64(b.Errors), nil, nil)
+
+	// Latency, using the requests as samples:
+	if len(a.latencies) > 0 && len(b.latencies) > 0 {
+		add("latency_mean", mean(a.latencies), mean(b.latencies), a.latencies, b.latencies)
+		add("latency_p50", time.Duration(a.Latency.P50).Seconds(), time.Duration(b.Latency.P50).Seconds(), nil, nil)
+		add("latency_p90", time.Duration(a.Latency.P90).Seconds(), time.Duration(b.Latency.P90).Seconds(), nil, nil)
+		add("latency_p99", time.Duration(a.Latency.P99).Seconds(), time.Duration(b.Latency.P99).Seconds(), nil, nil)
+		add("latency_max", time.Duration(a.Latency.Max).Seconds(), time.Duration(b.Latency.Max).Seconds(), nil, nil)
+	}
+	return result
+}
+
+// connectionThroughputs returns the throughput of each of the connections of a run.
+func connectionThroughputs(result *BenchResult) []float64 {
+	samples := make([]float64, len(result.PerConnection))
+	for i, connection := range result.PerConnection {
+		samples[i] = connection.Throughput
+	}
+	return samples
+}
+
+// welchTest calculates the two sided p-value of the Welch's t-test for the null hypothesis that the two sets of
+// samples have the same mean. It returns false if there aren't enough samples or they have no variance.
+func welchTest(a, b []float64) (p float64, ok bool) {
+	if len(a) < 2 || len(b) < 2 {
+		return
+	}
+	na := float64(len(a))
+	nb := float64(len(b))
+	va := variance(a) / na
+	vb := variance(b) / nb
+	if va+vb == 0 {
+		return
+	}
+	t := (mean(a) - mean(b)) / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/(na-1) + vb*vb/(nb-1))
+	p = incompleteBeta(df/2, 0.5, df/(df+t*t))
+	ok = true
+	return
+}
+
+// mean calculates the arithmetic mean of the given samples.
+func mean(samples []float64) float64 {
+	var sum float64
+	for _, sample := range samples {
+		sum += sample
+	}
+	return sum / float64(len(samples))
+}
+
+// variance calculates the unbiased variance of the given samples.
+func variance(samples []float64) float64 {
+	m := mean(samples)
+	var sum float64
+	for _, sample := range samples {
+		sum += (sample - m) * (sample - m)
+	}
+	return sum / float64(len(samples)-1)
+}
+
+// incompleteBeta calculates the regularized incomplete beta function, using the continued fraction described in
+// 'Numerical Recipes'. With a = df/2, b = 1/2 and x = df/(df+t²) it is the two sided p-value of the t distribution.
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(a, b, x) / a
+	}
+	return 1 - front*betaFraction(b, a, 1-x)/b
+}
+
+// betaFraction evaluates the continued fraction of the incomplete beta function with the modified Lentz's method.
+func betaFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-12
+		tiny          = 1e-300
+	)
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	result := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+
+		// Even step:
+		numerator := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		result *= d * c
+
+		// Odd step:
+		numerator = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		step := d * c
+		result *= step
+		if math.Abs(step-1) < epsilon {
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,122 @@
+package dummy
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Names of the supported content encodings, in order of preference:
+const (
+	encodingZstd    = "zstd"
+	encodingBrotli  = "br"
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+var supportedEncodings = []string{
+	encodingZstd,
+	encodingBrotli,
+	encodingGzip,
+	encodingDeflate,
+}
+
+// negotiateEncoding selects the content encoding from the value of the 'Accept-Encoding' header. It returns the
+// supported encoding with the highest quality value, using the server preference to break ties, or an empty string
+// if none of the supported encodings is acceptable.
+func negotiateEncoding(accept string) string {
+	qualities := map[string]float64{}
+	for _, item := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.TrimSpace(key) == "q" {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err == nil {
+					quality = parsed
+				}
+			}
+		}
+		qualities[name] = quality
+	}
+	result := ""
+	best := 0.0
+	for _, encoding := range supportedEncodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > best {
+			result = encoding
+			best = quality
+		}
+	}
+	return result
+}
+
+// newEncoder creates a writer that compresses the data with the given encoding and writes the result to the given
+// writer. The caller must close the encoder to flush the compressed data.
+func newEncoder(encoding string, writer io.Writer) (result io.WriteCloser, err error) {
+	switch encoding {
+	case encodingZstd:
+		result, err = zstd.NewWriter(writer)
+	case encodingBrotli:
+		result = brotli.NewWriter(writer)
+	case encodingGzip:
+		result = gzip.NewWriter(writer)
+	case encodingDeflate:
+		result, err = flate.NewWriter(writer, flate.DefaultCompression)
+	default:
+		err = fmt.Errorf("encoding '%s' isn't supported", encoding)
+	}
+	return
+}
+
+// newDecoder creates a reader that decompresses the data read from the given reader with the given encoding. It is the
+// counterpart of newEncoder, used by the commands that check the responses of the server.
+func newDecoder(encoding string, reader io.Reader) (result io.ReadCloser, err error) {
+	switch encoding {
+	case encodingZstd:
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(reader)
+		if err != nil {
+			return
+		}
+		result = decoder.IOReadCloser()
+	case encodingBrotli:
+		result = io.NopCloser(brotli.NewReader(reader))
+	case encodingGzip:
+		result, err = gzip.NewReader(reader)
+	case encodingDeflate:
+		result = flate.NewReader(reader)
+	default:
+		err = fmt.Errorf("encoding '%s' isn't supported", encoding)
+	}
+	return
+}
+
+// countingWriter is a writer that counts the bytes written to the underlying writer, and the number of writes.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+	writes int64
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.writer.Write(p)
+	w.count += int64(n)
+	w.writes++
+	return
+}
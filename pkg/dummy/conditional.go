@@ -0,0 +1,46 @@
+package dummy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Modification time reported for all the synthetic data. It is fixed so that all the instances of the server agree,
+// and so that caches in front of them can use it to validate their copies.
+var syntheticModTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// contentETag calculates the entity tag of the data generated with the given pattern, seed and size, and compressed
+// with the given encoding, if any. It is stable across requests and instances of the server, because the data is also
+// the same.
+func contentETag(pattern, seed string, size int, encoding string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%s", pattern, seed, size, encoding)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// notModified checks the 'If-None-Match' and 'If-Modified-Since' headers of the request, and returns true if the
+// client already has the current version of the data, so that a 304 response can be sent instead of the data. As
+// required by RFC 9110 the 'If-Modified-Since' header is ignored when the 'If-None-Match' header is present.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	match := r.Header.Get("If-None-Match")
+	if match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,307 @@
+package dummy
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the configuration of the server, loaded from the file given with the '--config' command line flag. The
+// file can be YAML or JSON.
+type Config struct {
+	// Listeners are the addresses where the server listens. When empty there is one listener in the default port,
+	// configured with the command line flags.
+	Listeners []ListenerConfig `json:"listeners,omitempty"`
+
+	// TLS contains the certificate and key used by the listeners that don't specify their own. When empty the
+	// built-in ones are used.
+	TLS *ListenerTLSConfig `json:"tls,omitempty"`
+
+	// Limits contains the default sizes and the maximum sizes that clients can request.
+	Limits *LimitsConfig `json:"limits,omitempty"`
+
+	// Logging contains the level and format of the log.
+	Logging *LoggingConfig `json:"logging,omitempty"`
+
+	// Strict enables the rejection of requests to the data endpoint that contain unknown query parameters or
+	// invalid combinations.
+	Strict bool `json:"strict,omitempty"`
+
+	// Templates enables the 'template' data source, which renders the body from the template sent in the query. It
+	// is disabled by default because then any client could send templates that take a long time to render, so it
+	// should only be enabled when the clients are trusted.
+	Templates bool `json:"templates,omitempty"`
+
+	// CORS is the cross origin resource sharing policy. When empty CORS is disabled.
+	CORS *CORSConfig `json:"cors,omitempty"`
+
+	// Sessions contains the settings of the session simulation.
+	Sessions *SessionsConfig `json:"sessions,omitempty"`
+
+	// Chaos is the behavior applied to all requests when the server starts. It can be changed later with the
+	// '/admin/chaos' endpoint, which requires the admin token.
+	Chaos *Behavior `json:"chaos,omitempty"`
+
+	// Scenarios are fault injection profiles that can be started and stopped using only their names.
+	Scenarios []Scenario `json:"scenarios,omitempty"`
+
+	// Schedules are the behaviors that are activated periodically.
+	Schedules []Schedule `json:"schedules,omitempty"`
+
+	// Overrides are the behaviors that are applied only to some clients.
+	Overrides []Override `json:"overrides,omitempty"`
+
+	// Quotas contains the number of bytes that each client can download.
+	Quotas *QuotasConfig `json:"quotas,omitempty"`
+
+	// Zones describes the latency added to requests from clients in other zones.
+	Zones *ZoneConfig `json:"zones,omitempty"`
+
+	// Fleet contains the settings of the coordination with other servers. When empty the server doesn't announce
+	// itself, but other servers can still announce themselves to it.
+	Fleet *FleetConfig `json:"fleet,omitempty"`
+
+	// Probes are the targets that the server downloads from periodically, acting as a client.
+	Probes []ProbeConfig `json:"probes,omitempty"`
+
+	// Webhooks are the URLs that receive the alerts of the probes.
+	Webhooks []WebhookConfig `json:"webhooks,omitempty"`
+
+	// History contains the settings of the recording of results in a database. When empty results aren't recorded.
+	History *HistoryConfig `json:"history,omitempty"`
+
+	// Exporters are the external databases where the results are pushed.
+	Exporters []ExporterConfig `json:"exporters,omitempty"`
+
+	// Mocks are routes that return canned responses. They take precedence over the built-in endpoints.
+	Mocks []MockConfig `json:"mocks,omitempty"`
+
+	// Proxy contains the settings of the proxy that records the exchanges with a real server and replays them. When
+	// empty there is no proxy.
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+}
+
+// LimitsConfig contains the default sizes used when clients don't request a size, and the maximum sizes that they can
+// request. Zero means the built-in default, or no limit, except for the maximum buffer size, which is 64 MiB by default.
+// The maximum bytes per request and the maximum duration apply to the responses of all the endpoints, which are
+// truncated when they exceed them.
+type LimitsConfig struct {
+	DefaultSize        int      `json:"default_size,omitempty"`
+	DefaultBufferSize  int      `json:"default_buffer_size,omitempty"`
+	MaxSize            int      `json:"max_size,omitempty"`
+	MaxBufferSize      int      `json:"max_buffer_size,omitempty"`
+	MaxBytesPerRequest int64    `json:"max_bytes_per_request,omitempty"`
+	MaxDuration        Duration `json:"max_duration,omitempty"`
+}
+
+// withDefaults returns a copy of the limits where the default sizes and the maximum buffer size that aren't set have
+// the built-in values. The receiver can be nil.
+func (c *LimitsConfig) withDefaults() LimitsConfig {
+	var result LimitsConfig
+	if c != nil {
+		result = *c
+	}
+	if result.DefaultSize == 0 {
+		result.DefaultSize = DefaultDataSize
+	}
+	if result.DefaultBufferSize == 0 {
+		result.DefaultBufferSize = DefaultBufferSize
+	}
+	if result.MaxBufferSize == 0 {
+		result.MaxBufferSize = DefaultMaxBufferSize
+	}
+	return result
+}
+
+// validate checks that the limits aren't negative, and that the defaults are within the limits.
+func (c *LimitsConfig) validate() error {
+	if c.DefaultBufferSize < 0 {
+		return fmt.Errorf("default buffer size %d should be positive", c.DefaultBufferSize)
+	}
+	if c.DefaultSize < 0 || c.MaxSize < 0 || c.MaxBufferSize < 0 || c.MaxBytesPerRequest < 0 || c.MaxDuration < 0 {
+		return fmt.Errorf("limits can't be negative")
+	}
+	resolved := c.withDefaults()
+	if c.MaxSize > 0 && resolved.DefaultSize > c.MaxSize {
+		return fmt.Errorf("default size %d exceeds the maximum size %d", resolved.DefaultSize, c.MaxSize)
+	}
+	if resolved.DefaultBufferSize > resolved.MaxBufferSize {
+		return fmt.Errorf(
+			"default buffer size %d exceeds the maximum buffer size %d",
+			resolved.DefaultBufferSize, resolved.MaxBufferSize,
+		)
+	}
+	return nil
+}
+
+// LoadConfig loads the configuration from the given file, and checks that it is valid.
+func LoadConfig(file string) (result *Config, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	config := &Config{}
+	err = yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		err = fmt.Errorf("failed to parse configuration file '%s': %w", file, err)
+		return
+	}
+	err = config.Validate()
+	if err != nil {
+		err = fmt.Errorf("configuration file '%s' isn't valid: %w", file, err)
+		return
+	}
+	result = config
+	return
+}
+
+// Validate checks that the configuration is valid. It returns the first problem found.
+func (c *Config) Validate() error {
+	names := map[string]bool{}
+	for i := range c.Listeners {
+		listener := &c.Listeners[i]
+		if listener.Name == "" {
+			listener.Name = fmt.Sprintf("listener-%d", i)
+		}
+		if names[listener.Name] {
+			return fmt.Errorf("listener name '%s' is duplicated", listener.Name)
+		}
+		names[listener.Name] = true
+		err := listener.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if c.TLS != nil && (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("TLS certificate and key files should be used together")
+	}
+	if c.Limits != nil {
+		err := c.Limits.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if c.Logging != nil {
+		err := c.Logging.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if c.CORS != nil {
+		err := c.CORS.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if c.Sessions != nil {
+		err := c.Sessions.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if c.Quotas != nil {
+		err := c.Quotas.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if c.Fleet != nil {
+		err := c.Fleet.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if c.History != nil {
+		err := c.History.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if c.Proxy != nil {
+		err := c.Proxy.validate()
+		if err != nil {
+			return err
+		}
+	}
+	names = map[string]bool{}
+	for i := range c.Probes {
+		probe := &c.Probes[i]
+		err := probe.validate()
+		if err != nil {
+			return err
+		}
+		if names[probe.Name] {
+			return fmt.Errorf("probe name '%s' is duplicated", probe.Name)
+		}
+		names[probe.Name] = true
+	}
+	names = map[string]bool{}
+	for i := range c.Webhooks {
+		webhook := &c.Webhooks[i]
+		err := webhook.validate()
+		if err != nil {
+			return err
+		}
+		if names[webhook.Name] {
+			return fmt.Errorf("webhook name '%s' is duplicated", webhook.Name)
+		}
+		names[webhook.Name] = true
+	}
+	names = map[string]bool{}
+	for i := range c.Exporters {
+		exporter := &c.Exporters[i]
+		err := exporter.validate()
+		if err != nil {
+			return err
+		}
+		if names[exporter.Name] {
+			return fmt.Errorf("exporter name '%s' is duplicated", exporter.Name)
+		}
+		names[exporter.Name] = true
+	}
+	names = map[string]bool{}
+	for i := range c.Mocks {
+		mock := &c.Mocks[i]
+		err := mock.validate()
+		if err != nil {
+			return err
+		}
+		if names[mock.Name] {
+			return fmt.Errorf("mock route name '%s' is duplicated", mock.Name)
+		}
+		names[mock.Name] = true
+	}
+	if c.Chaos != nil {
+		err := c.Chaos.Validate()
+		if err != nil {
+			return fmt.Errorf("chaos behavior isn't valid: %w", err)
+		}
+	}
+	names = map[string]bool{}
+	for i, scenario := range c.Scenarios {
+		if scenario.Name == "" {
+			return fmt.Errorf("name of scenario %d is mandatory", i)
+		}
+		if names[scenario.Name] {
+			return fmt.Errorf("scenario name '%s' is duplicated", scenario.Name)
+		}
+		names[scenario.Name] = true
+		err := scenario.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	// The rest of the sections are checked creating the objects that use them, which don't have side effects:
+	_, err := NewScheduler(nil, &BehaviorSet{}, c.Schedules)
+	if err != nil {
+		return err
+	}
+	_, err = NewOverrideSet(c.Overrides)
+	if err != nil {
+		return err
+	}
+	_, err = NewZoneEmulator("", c.Zones)
+	return err
+}
@@ -0,0 +1,153 @@
+package dummy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		check func(t *testing.T, config *Config)
+		fail  string
+	}{
+		{
+			name: "Empty",
+			text: "",
+			check: func(t *testing.T, config *Config) {
+				if len(config.Listeners) != 0 {
+					t.Errorf("expected no listeners, but got %d", len(config.Listeners))
+				}
+			},
+		},
+		{
+			name: "YAML",
+			text: "listeners:\n- address: ':8080'\n- name: plain\n  address: ':8081'\nlimits:\n  max_size: 2000000000\n",
+			check: func(t *testing.T, config *Config) {
+				if len(config.Listeners) != 2 {
+					t.Fatalf("expected two listeners, but got %d", len(config.Listeners))
+				}
+				if config.Listeners[0].Name != "listener-0" {
+					t.Errorf("expected default name 'listener-0', but got '%s'", config.Listeners[0].Name)
+				}
+				if config.Listeners[1].Name != "plain" {
+					t.Errorf("expected name 'plain', but got '%s'", config.Listeners[1].Name)
+				}
+				if config.Limits == nil || config.Limits.MaxSize != 2000000000 {
+					t.Errorf("expected maximum size 2000000000, but got %+v", config.Limits)
+				}
+			},
+		},
+		{
+			name: "JSON",
+			text: `{"strict": true, "limits": {"max_duration": "1m"}}`,
+			check: func(t *testing.T, config *Config) {
+				if !config.Strict {
+					t.Errorf("expected strict mode")
+				}
+				if config.Limits == nil || time.Duration(config.Limits.MaxDuration) != time.Minute {
+					t.Errorf("expected maximum duration of one minute, but got %+v", config.Limits)
+				}
+			},
+		},
+		{
+			name: "Unknown top level field",
+			text: "listeners: []\nlistenres: []\n",
+			fail: "listenres",
+		},
+		{
+			name: "Unknown nested field",
+			text: "limits:\n  max_sise: 10\n",
+			fail: "max_sise",
+		},
+		{
+			name: "Wrong type",
+			text: "limits:\n  max_size: big\n",
+			fail: "failed to parse",
+		},
+		{
+			name: "Duplicated listener name",
+			text: "listeners:\n- name: a\n  address: ':8080'\n- name: a\n  address: ':8081'\n",
+			fail: "listener name 'a' is duplicated",
+		},
+		{
+			name: "Listener without address",
+			text: "listeners:\n- name: a\n",
+			fail: "address of listener 'a' is mandatory",
+		},
+		{
+			name: "Raw without multiplexing",
+			text: "listeners:\n- name: a\n  address: ':8080'\n  raw: send\n",
+			fail: "can't accept raw TCP connections",
+		},
+		{
+			name: "Unknown raw mode",
+			text: "listeners:\n- name: a\n  address: ':8080'\n  tls: {}\n  multiplex: true\n  raw: echo\n",
+			fail: "raw mode of listener 'a'",
+		},
+		{
+			name: "Trusted CIDRs without PROXY protocol",
+			text: "listeners:\n- name: a\n  address: ':8080'\n  proxy_trusted: ['10.0.0.0/8']\n",
+			fail: "the protocol is off",
+		},
+		{
+			name: "Invalid trusted CIDR",
+			text: "listeners:\n- name: a\n  address: ':8080'\n  proxy_protocol: required\n  proxy_trusted: ['bad']\n",
+			fail: "trusted PROXY protocol CIDR 'bad' isn't valid",
+		},
+		{
+			name: "Negative limit",
+			text: "limits:\n  max_size: -1\n",
+			fail: "can't be negative",
+		},
+		{
+			name: "Negative default buffer size",
+			text: "limits:\n  default_buffer_size: -1\n",
+			fail: "default buffer size -1 should be positive",
+		},
+		{
+			name: "Default size above maximum",
+			text: "limits:\n  default_size: 2000\n  max_size: 1000\n",
+			fail: "exceeds the maximum size",
+		},
+		{
+			name: "TLS certificate without key",
+			text: "tls:\n  cert_file: tls.crt\n",
+			fail: "should be used together",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.yaml")
+			err := os.WriteFile(file, []byte(test.text), 0600)
+			if err != nil {
+				t.Fatalf("failed to write configuration: %v", err)
+			}
+			config, err := LoadConfig(file)
+			if test.fail != "" {
+				if err == nil {
+					t.Fatalf("expected an error containing '%s', but succeeded", test.fail)
+				}
+				if !strings.Contains(err.Error(), test.fail) {
+					t.Fatalf("expected an error containing '%s', but got: %v", test.fail, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			test.check(t, config)
+		})
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	if !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, but got: %v", err)
+	}
+}
@@ -0,0 +1,1583 @@
+package dummy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Default time limit for each conformance check.
+const DefaultConformanceTimeout = 30 * time.Second
+
+// ConformanceResult is the result of one of the checks of the conformance suite.
+type ConformanceResult struct {
+	Feature string   `json:"feature"`
+	Passed  bool     `json:"passed"`
+	Skipped bool     `json:"skipped,omitempty"`
+	Elapsed Duration `json:"elapsed"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// conformanceCheck is one of the checks of the conformance suite. The endpoint is the pattern that the server needs to
+// report in its capabilities for the check to run. If it is empty the check always runs.
+type conformanceCheck struct {
+	feature  string
+	endpoint string
+	run      func(ctx context.Context, s *ConformanceSuite) error
+}
+
+// ConformanceSuite checks that a running instance of the server, and the proxies and load balancers in front of it,
+// behave as specified.
+type ConformanceSuite struct {
+	logger       *slog.Logger
+	target       *url.URL
+	timeout      time.Duration
+	httpClient   *http.Client
+	grpcClient   *http.Client
+	wsDialer     *websocket.Dialer
+	capabilities *Capabilities
+}
+
+// NewConformanceSuite creates a suite that runs the checks against the given target URL.
+func NewConformanceSuite(logger *slog.Logger, target string, insecure bool,
+	timeout time.Duration) (result *ConformanceSuite, err error) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
+		err = fmt.Errorf("scheme of target '%s' should be 'http' or 'https'", target)
+		return
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+
+	// Compression is disabled in the transport because the checks send the 'Accept-Encoding' header explicitly
+	// and want to see the raw response.
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			Proxy:              http.ProxyFromEnvironment,
+			TLSClientConfig:    tlsConfig,
+			ForceAttemptHTTP2:  true,
+			DisableCompression: true,
+		},
+	}
+
+	// gRPC needs HTTP/2 also when TLS isn't used, and in that case the server only supports it with prior
+	// knowledge:
+	grpcClient := httpClient
+	if targetURL.Scheme == "http" {
+		grpcClient = &http.Client{
+			Transport: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn,
+					error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, network, addr)
+				},
+			},
+		}
+	}
+
+	// Note that the WebSocket dialer gets a copy of the TLS configuration because the HTTP transport adds the 'h2'
+	// protocol to it, and that breaks the WebSocket handshake.
+	result = &ConformanceSuite{
+		logger:     logger,
+		target:     targetURL,
+		timeout:    timeout,
+		httpClient: httpClient,
+		grpcClient: grpcClient,
+		wsDialer: &websocket.Dialer{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig.Clone(),
+		},
+	}
+	return
+}
+
+// Run runs all the checks and calls the given function with the result of each of them.
+func (s *ConformanceSuite) Run(ctx context.Context, report func(*ConformanceResult)) {
+	for _, check := range conformanceChecks {
+		result := &ConformanceResult{
+			Feature: check.feature,
+		}
+		if s.capabilities != nil && check.endpoint != "" &&
+			!slices.Contains(s.capabilities.Endpoints, check.endpoint) {
+			result.Skipped = true
+			result.Passed = true
+			report(result)
+			continue
+		}
+		start := time.Now()
+		checkCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		err := check.run(checkCtx, s)
+		cancel()
+		result.Elapsed = Duration(time.Since(start))
+		result.Passed = err == nil
+		if err != nil {
+			result.Error = err.Error()
+		}
+		report(result)
+	}
+}
+
+// url returns the URL for the given path and query parameters, relative to the target.
+func (s *ConformanceSuite) url(path string, query url.Values) *url.URL {
+	result := *s.target
+	result.Path = strings.TrimSuffix(result.Path, "/") + path
+	result.RawQuery = query.Encode()
+	return &result
+}
+
+// get sends a GET request and returns the response with the complete body.
+func (s *ConformanceSuite) get(ctx context.Context, path string, query url.Values,
+	header http.Header) (response *http.Response, body []byte, err error) {
+	response, body, err = s.send(ctx, http.MethodGet, path, query, header, nil)
+	return
+}
+
+// send sends a request with the given method and body, and returns the response with the complete body.
+func (s *ConformanceSuite) send(ctx context.Context, method, path string, query url.Values, header http.Header,
+	content []byte) (response *http.Response, body []byte, err error) {
+	var reader io.Reader
+	if content != nil {
+		reader = bytes.NewReader(content)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, s.url(path, query).String(), reader)
+	if err != nil {
+		return
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	response, err = s.httpClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	body, err = io.ReadAll(response.Body)
+	return
+}
+
+// download requests data from the root endpoint and checks that the response is successful and has the expected size.
+func (s *ConformanceSuite) download(ctx context.Context, query url.Values, size int) (response *http.Response,
+	body []byte, err error) {
+	response, body, err = s.get(ctx, "/", query, nil)
+	if err != nil {
+		return
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return
+	}
+	if len(body) != size {
+		err = fmt.Errorf("expected %d bytes, but received %d", size, len(body))
+	}
+	return
+}
+
+// expectStatus returns an error if the status code of the response isn't the expected one.
+func expectStatus(response *http.Response, expected int) error {
+	if response.StatusCode != expected {
+		return fmt.Errorf("expected status %d, but received %d", expected, response.StatusCode)
+	}
+	return nil
+}
+
+// expectHeader returns an error if the value of the header isn't the expected one.
+func expectHeader(header http.Header, name, expected string) error {
+	actual := header.Get(name)
+	if actual != expected {
+		return fmt.Errorf("expected header '%s' to be '%s', but it is '%s'", name, expected, actual)
+	}
+	return nil
+}
+
+// sequenceData returns the expected content of the 'sequence' pattern.
+func sequenceData(size int) []byte {
+	result := make([]byte, size)
+	patternFills[patternSequence](result)
+	return result
+}
+
+// conformanceChecks is the list of checks, in the order they run. The capabilities check needs to be first because it
+// loads the capabilities used to skip the checks of the endpoints that the server doesn't support.
+var conformanceChecks = []conformanceCheck{
+	{
+		feature:  "capabilities",
+		endpoint: "GET /capabilities",
+		run:      checkCapabilities,
+	},
+	{
+		feature: "identity",
+		run:     checkIdentity,
+	},
+	{
+		feature: "size",
+		run:     checkSize,
+	},
+	{
+		feature: "size/invalid",
+		run:     checkInvalidSize,
+	},
+	{
+		feature: "buffer_size",
+		run:     checkBufferSize,
+	},
+	{
+		feature: "flush",
+		run:     checkFlush,
+	},
+	{
+		feature: "timeline",
+		run:     checkTimeline,
+	},
+	{
+		feature: "deprecated_parameters",
+		run:     checkDeprecatedParameters,
+	},
+	{
+		feature: "pattern/random",
+		run:     checkRandomPattern,
+	},
+	{
+		feature: "pattern/zero",
+		run:     checkZeroPattern,
+	},
+	{
+		feature: "pattern/sequence",
+		run:     checkSequencePattern,
+	},
+	{
+		feature: "pattern/invalid",
+		run:     checkInvalidPattern,
+	},
+	{
+		feature: "source/json",
+		run:     checkJSONSource,
+	},
+	{
+		feature: "source/json/records",
+		run:     checkJSONRecords,
+	},
+	{
+		feature: "source/csv",
+		run:     checkCSVSource,
+	},
+	{
+		feature: "source/invalid",
+		run:     checkInvalidSource,
+	},
+	{
+		feature: "headers",
+		run:     checkHeaders,
+	},
+	{
+		feature: "compression",
+		run:     checkCompression,
+	},
+	{
+		feature:  "events",
+		endpoint: "GET /events",
+		run:      checkEvents,
+	},
+	{
+		feature: "strict",
+		run:     checkStrict,
+	},
+	{
+		feature:  "ping",
+		endpoint: "GET /ping",
+		run:      checkPing,
+	},
+	{
+		feature:  "clock",
+		endpoint: "GET /clock",
+		run:      checkClock,
+	},
+	{
+		feature:  "websocket/echo",
+		endpoint: "GET /ws/echo",
+		run:      checkWebSocketEcho,
+	},
+	{
+		feature:  "websocket/data",
+		endpoint: "GET /ws/data",
+		run:      checkWebSocketData,
+	},
+	{
+		feature:  "grpc/download",
+		endpoint: "POST " + grpcServicePath,
+		run:      checkGRPCDownload,
+	},
+	{
+		feature:  "metrics",
+		endpoint: "GET /metrics",
+		run:      checkMetrics,
+	},
+	{
+		feature:  "stats",
+		endpoint: "GET /stats",
+		run:      checkStats,
+	},
+	{
+		feature:  "debug/connections",
+		endpoint: "GET /debug/connections",
+		run:      checkConnections,
+	},
+	{
+		feature:  "delay",
+		endpoint: "GET /delay/{duration}",
+		run:      checkDelay,
+	},
+	{
+		feature: "ranges",
+		run:     checkRanges,
+	},
+	{
+		feature: "conditional",
+		run:     checkConditional,
+	},
+	{
+		feature: "throttle",
+		run:     checkThrottle,
+	},
+	{
+		feature:  "redirect",
+		endpoint: "GET /redirect/{n}",
+		run:      checkRedirect,
+	},
+	{
+		feature:  "objects",
+		endpoint: "GET /objects/{name}",
+		run:      checkObjects,
+	},
+	{
+		feature:  "s3",
+		endpoint: s3Prefix,
+		run:      checkS3,
+	},
+	{
+		feature:  "archive/tar",
+		endpoint: "GET /archive",
+		run:      checkTarArchive,
+	},
+	{
+		feature:  "archive/zip",
+		endpoint: "GET /archive",
+		run:      checkZipArchive,
+	},
+	{
+		feature:  "resume",
+		endpoint: "GET /resume/{token}",
+		run:      checkResume,
+	},
+	{
+		feature:  "registry",
+		endpoint: registryPrefix,
+		run:      checkRegistry,
+	},
+	{
+		feature:  "registry/upload",
+		endpoint: registryPrefix,
+		run:      checkRegistryUpload,
+	},
+	{
+		feature:  "media/hls",
+		endpoint: "GET /media/{protocol}/{rendition}/{file}",
+		run:      checkHLS,
+	},
+	{
+		feature:  "media/dash",
+		endpoint: "GET /media/{protocol}/{rendition}/{file}",
+		run:      checkDASH,
+	},
+}
+
+func checkCapabilities(ctx context.Context, s *ConformanceSuite) error {
+	response, body, err := s.get(ctx, "/capabilities", nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	capabilities := &Capabilities{}
+	err = json.Unmarshal(body, capabilities)
+	if err != nil {
+		return err
+	}
+	if capabilities.Version == "" || len(capabilities.Endpoints) == 0 {
+		return fmt.Errorf("capabilities don't contain the version or the endpoints")
+	}
+	s.capabilities = capabilities
+	s.logger.Info(
+		"Loaded capabilities",
+		slog.String("version", capabilities.Version),
+		slog.Any("endpoints", capabilities.Endpoints),
+	)
+	return nil
+}
+
+func checkIdentity(ctx context.Context, s *ConformanceSuite) error {
+	response, _, err := s.download(ctx, url.Values{"size": {"0"}}, 0)
+	if err != nil {
+		return err
+	}
+	if response.Header.Get(instanceHeader) == "" {
+		return fmt.Errorf("header '%s' is missing", instanceHeader)
+	}
+	return nil
+}
+
+func checkSize(ctx context.Context, s *ConformanceSuite) error {
+	for _, size := range []int{0, 1, 1000, 1 << 20} {
+		query := url.Values{
+			"size": {fmt.Sprint(size)},
+		}
+		response, _, err := s.download(ctx, query, size)
+		if err != nil {
+			return fmt.Errorf("size %d: %w", size, err)
+		}
+		if response.ContentLength != -1 && response.ContentLength != int64(size) {
+			return fmt.Errorf("size %d: content length is %d", size, response.ContentLength)
+		}
+	}
+	return nil
+}
+
+func checkInvalidSize(ctx context.Context, s *ConformanceSuite) error {
+	response, _, err := s.get(ctx, "/", url.Values{"size": {"junk"}}, nil)
+	if err != nil {
+		return err
+	}
+	return expectStatus(response, http.StatusBadRequest)
+}
+
+func checkBufferSize(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"size":        {"100000"},
+		"buffer_size": {"1000"},
+	}
+	response, _, err := s.download(ctx, query, 100000)
+	if err != nil {
+		return err
+	}
+	if response.Header.Get("Warning") != "" {
+		return fmt.Errorf("unexpected warning '%s'", response.Header.Get("Warning"))
+	}
+	return nil
+}
+
+func checkFlush(ctx context.Context, s *ConformanceSuite) error {
+	for _, flush := range []string{flushEvery, "3", flushEnd} {
+		query := url.Values{
+			"size":        {"100000"},
+			"buffer_size": {"1000"},
+			"batch":       {"4"},
+			"flush":       {flush},
+		}
+		_, _, err := s.download(ctx, query, 100000)
+		if err != nil {
+			return fmt.Errorf("flush '%s': %w", flush, err)
+		}
+	}
+	return nil
+}
+
+func checkTimeline(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"size":        {"100000"},
+		"buffer_size": {"1000"},
+		"timeline":    {"true"},
+	}
+	response, _, err := s.download(ctx, query, 100000)
+	if err != nil {
+		return err
+	}
+	timeline := response.Trailer.Get(timelineTrailer)
+	for _, name := range []string{timelineHeaders, timelineFirstByte, "progress_50", timelineCompleted} {
+		if !strings.Contains(timeline, name+"=") {
+			return fmt.Errorf("timeline '%s' doesn't contain event '%s'", timeline, name)
+		}
+	}
+	return nil
+}
+
+func checkDeprecatedParameters(ctx context.Context, s *ConformanceSuite) error {
+	aliases := paramAliases
+	if s.capabilities != nil {
+		aliases = s.capabilities.Deprecated
+	}
+	for oldName := range aliases {
+		query := url.Values{
+			"size":  {"0"},
+			oldName: {"1000"},
+		}
+		response, _, err := s.download(ctx, query, 0)
+		if err != nil {
+			return fmt.Errorf("parameter '%s': %w", oldName, err)
+		}
+		if !strings.Contains(response.Header.Get("Warning"), oldName) {
+			return fmt.Errorf("parameter '%s': warning is missing", oldName)
+		}
+	}
+	return nil
+}
+
+func checkRandomPattern(ctx context.Context, s *ConformanceSuite) error {
+	_, body, err := s.download(ctx, url.Values{"size": {"4096"}}, 4096)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(body, make([]byte, len(body))) {
+		return fmt.Errorf("random data contains only zeros")
+	}
+	return nil
+}
+
+func checkZeroPattern(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"size":    {"100000"},
+		"pattern": {patternZero},
+	}
+	_, body, err := s.download(ctx, query, 100000)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(body, make([]byte, len(body))) {
+		return fmt.Errorf("data contains bytes that aren't zero")
+	}
+	return nil
+}
+
+func checkSequencePattern(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"size":    {"100000"},
+		"pattern": {patternSequence},
+	}
+	_, body, err := s.download(ctx, query, 100000)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(body, sequenceData(len(body))) {
+		return fmt.Errorf("data doesn't match the sequence")
+	}
+	return nil
+}
+
+func checkInvalidPattern(ctx context.Context, s *ConformanceSuite) error {
+	response, _, err := s.get(ctx, "/", url.Values{"pattern": {"junk"}}, nil)
+	if err != nil {
+		return err
+	}
+	return expectStatus(response, http.StatusBadRequest)
+}
+
+func checkJSONSource(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"size":   {"100000"},
+		"source": {sourceJSON},
+	}
+	response, body, err := s.download(ctx, query, 100000)
+	if err != nil {
+		return err
+	}
+	err = expectHeader(response.Header, "Content-Type", "application/x-ndjson")
+	if err != nil {
+		return err
+	}
+
+	// All the lines should be valid JSON, except the last one, that may be truncated:
+	lines := bytes.Split(body, []byte("\n"))
+	for i, line := range lines[:len(lines)-1] {
+		if !json.Valid(line) {
+			return fmt.Errorf("line %d isn't valid JSON", i+1)
+		}
+	}
+	return nil
+}
+
+func checkJSONRecords(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"source":      {sourceJSON},
+		"format":      {recordsFormatJSON},
+		"schema":      {"id:uuid,name:word,score:int"},
+		"records":     {"10"},
+		"record_size": {"100"},
+	}
+	_, body, err := s.download(ctx, query, 1004)
+	if err != nil {
+		return err
+	}
+	var records []map[string]any
+	err = json.Unmarshal(body, &records)
+	if err != nil {
+		return fmt.Errorf("data isn't a valid JSON array: %w", err)
+	}
+	if len(records) != 10 {
+		return fmt.Errorf("expected 10 records, but received %d", len(records))
+	}
+	return nil
+}
+
+func checkCSVSource(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"source":      {sourceCSV},
+		"schema":      {"id:int,name:text"},
+		"records":     {"5"},
+		"record_size": {"60"},
+	}
+	response, body, err := s.download(ctx, query, 320)
+	if err != nil {
+		return err
+	}
+	err = expectHeader(response.Header, "Content-Type", "text/csv; charset=utf-8")
+	if err != nil {
+		return err
+	}
+	rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("data isn't valid CSV: %w", err)
+	}
+	if len(rows) != 6 {
+		return fmt.Errorf("expected a header and 5 rows, but received %d rows", len(rows))
+	}
+	if !slices.Equal(rows[0], []string{"id", "name", recordsPaddingName}) {
+		return fmt.Errorf("header %v isn't the expected one", rows[0])
+	}
+	return nil
+}
+
+func checkInvalidSource(ctx context.Context, s *ConformanceSuite) error {
+	response, _, err := s.get(ctx, "/", url.Values{"source": {"junk"}}, nil)
+	if err != nil {
+		return err
+	}
+	return expectStatus(response, http.StatusBadRequest)
+}
+
+func checkHeaders(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"size":                 {"10"},
+		"pattern":              {patternZero},
+		"content_type":         {"text/plain"},
+		"cache_control":        {"no-store"},
+		"disposition":          {"attachment"},
+		"header_X-Conformance": {"yes"},
+	}
+	response, _, err := s.download(ctx, query, 10)
+	if err != nil {
+		return err
+	}
+	expected := map[string]string{
+		"Content-Type":        "text/plain",
+		"Cache-Control":       "no-store",
+		"Content-Disposition": `attachment; filename="dummy-zero-10.bin"`,
+		"X-Conformance":       "yes",
+	}
+	for name, value := range expected {
+		err = expectHeader(response.Header, name, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkCompression(ctx context.Context, s *ConformanceSuite) error {
+	encodings := supportedEncodings
+	if s.capabilities != nil {
+		encodings = s.capabilities.Encodings
+	}
+	expected := sequenceData(100000)
+	query := url.Values{
+		"size":     {"100000"},
+		"pattern":  {patternSequence},
+		"compress": {"true"},
+	}
+	for _, encoding := range encodings {
+		header := http.Header{
+			"Accept-Encoding": {encoding},
+		}
+		response, body, err := s.get(ctx, "/", query, header)
+		if err != nil {
+			return fmt.Errorf("encoding '%s': %w", encoding, err)
+		}
+		err = expectStatus(response, http.StatusOK)
+		if err == nil {
+			err = expectHeader(response.Header, "Content-Encoding", encoding)
+		}
+		if err != nil {
+			return fmt.Errorf("encoding '%s': %w", encoding, err)
+		}
+		decoder, err := newDecoder(encoding, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("encoding '%s': %w", encoding, err)
+		}
+		data, err := io.ReadAll(decoder)
+		decoder.Close()
+		if err != nil {
+			return fmt.Errorf("encoding '%s': %w", encoding, err)
+		}
+		if !bytes.Equal(data, expected) {
+			return fmt.Errorf("encoding '%s': decompressed data doesn't match", encoding)
+		}
+	}
+	return nil
+}
+
+func checkEvents(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"count": {"3"},
+		"rate":  {"50"},
+		"size":  {"4"},
+	}
+	response, body, err := s.get(ctx, "/events", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	err = expectHeader(response.Header, "Content-Type", "text/event-stream")
+	if err != nil {
+		return err
+	}
+	count := bytes.Count(body, []byte("event: data\n"))
+	if count != 3 {
+		return fmt.Errorf("expected 3 events, but received %d", count)
+	}
+	return nil
+}
+
+func checkStrict(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"strict": {"true"},
+		"size":   {"0"},
+		"bufer":  {"1000"},
+	}
+	response, body, err := s.get(ctx, "/", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusBadRequest)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(body, []byte("buffer_size")) {
+		return fmt.Errorf("expected the error to suggest 'buffer_size', but it is '%s'", bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+func checkPing(ctx context.Context, s *ConformanceSuite) error {
+	response, body, err := s.get(ctx, "/ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	var result PingResult
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return fmt.Errorf("failed to parse ping result: %w", err)
+	}
+	if result.Time.IsZero() {
+		return fmt.Errorf("ping result doesn't contain the server time")
+	}
+	query := url.Values{
+		"count":    {"3"},
+		"interval": {"10ms"},
+	}
+	response, body, err = s.get(ctx, "/ping", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	count := bytes.Count(body, []byte("event: ping\n"))
+	if count != 3 {
+		return fmt.Errorf("expected 3 ping events, but received %d", count)
+	}
+	return nil
+}
+
+func checkClock(ctx context.Context, s *ConformanceSuite) error {
+	t1 := time.Now().UTC().Truncate(time.Millisecond)
+	query := url.Values{
+		"t1": {t1.Format(time.RFC3339Nano)},
+	}
+	response, body, err := s.get(ctx, "/clock", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	var result ClockResult
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return fmt.Errorf("failed to parse clock result: %w", err)
+	}
+	if !result.T1.Equal(t1) {
+		return fmt.Errorf("expected t1 '%s', but received '%s'", t1, result.T1)
+	}
+	if result.T2.IsZero() || result.T3.Before(result.T2) {
+		return fmt.Errorf("expected t3 '%s' to be after t2 '%s'", result.T3, result.T2)
+	}
+	return nil
+}
+
+// dialWebSocket opens a WebSocket connection to the given path of the target.
+func (s *ConformanceSuite) dialWebSocket(ctx context.Context, path string,
+	query url.Values) (conn *websocket.Conn, err error) {
+	address := s.url(path, query)
+	address.Scheme = strings.Replace(address.Scheme, "http", "ws", 1)
+	conn, _, err = s.wsDialer.DialContext(ctx, address.String(), nil)
+	if err != nil {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if ok {
+		conn.SetReadDeadline(deadline)
+		conn.SetWriteDeadline(deadline)
+	}
+	return
+}
+
+func checkWebSocketEcho(ctx context.Context, s *ConformanceSuite) error {
+	conn, err := s.dialWebSocket(ctx, "/ws/echo", nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	message := []byte("conformance")
+	err = conn.WriteMessage(websocket.TextMessage, message)
+	if err != nil {
+		return err
+	}
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if messageType != websocket.TextMessage || !bytes.Equal(data, message) {
+		return fmt.Errorf("echo doesn't match the message sent")
+	}
+	return conn.WriteMessage(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+	)
+}
+
+func checkWebSocketData(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"count": {"3"},
+		"size":  {"100"},
+	}
+	conn, err := s.dialWebSocket(ctx, "/ws/data", query)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	frames := 0
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if messageType != websocket.BinaryMessage || len(data) != 100 {
+			return fmt.Errorf("frame %d has type %d and size %d", frames, messageType, len(data))
+		}
+		frames++
+	}
+	if frames != 3 {
+		return fmt.Errorf("expected 3 frames, but received %d", frames)
+	}
+	return nil
+}
+
+func checkGRPCDownload(ctx context.Context, s *ConformanceSuite) error {
+	// Prepare the request:
+	var message []byte
+	message = protowire.AppendTag(message, 1, protowire.VarintType)
+	message = protowire.AppendVarint(message, 100000)
+	message = protowire.AppendTag(message, 2, protowire.VarintType)
+	message = protowire.AppendVarint(message, 1000)
+	message = protowire.AppendTag(message, 3, protowire.BytesType)
+	message = protowire.AppendString(message, patternSequence)
+	body := &bytes.Buffer{}
+	err := writeGRPCMessage(body, message)
+	if err != nil {
+		return err
+	}
+	address := s.url(grpcServicePath+"Download", nil)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, address.String(), body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/grpc")
+	request.Header.Set("Te", "trailers")
+
+	// Send the request and read the chunks:
+	response, err := s.grpcClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	data := &bytes.Buffer{}
+	for {
+		message, err = readGRPCMessage(response.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		chunk, err := parseChunk(message)
+		if err != nil {
+			return err
+		}
+		data.Write(chunk)
+	}
+	status := response.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = response.Header.Get("Grpc-Status")
+	}
+	if status != "0" {
+		return fmt.Errorf("gRPC status is '%s'", status)
+	}
+	if !bytes.Equal(data.Bytes(), sequenceData(100000)) {
+		return fmt.Errorf("received %d bytes that don't match the sequence", data.Len())
+	}
+	return nil
+}
+
+func checkMetrics(ctx context.Context, s *ConformanceSuite) error {
+	response, body, err := s.get(ctx, "/metrics", nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(body, []byte("dummy_buffer_pool_gets_total")) {
+		return fmt.Errorf("buffer pool metrics are missing")
+	}
+	return nil
+}
+
+func checkStats(ctx context.Context, s *ConformanceSuite) error {
+	response, body, err := s.get(ctx, "/stats", nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	report := &StatsReport{}
+	err = json.Unmarshal(body, report)
+	if err != nil {
+		return err
+	}
+	if report.TotalConnections == 0 || len(report.Endpoints) == 0 {
+		return fmt.Errorf("statistics don't contain connections or endpoints")
+	}
+	return nil
+}
+
+func checkConnections(ctx context.Context, s *ConformanceSuite) error {
+	// The request for the table should be one of the transfers in progress:
+	response, body, err := s.get(ctx, "/debug/connections", nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	report := &ConnectionsReport{}
+	err = json.Unmarshal(body, report)
+	if err != nil {
+		return err
+	}
+	if len(report.Connections) == 0 {
+		return fmt.Errorf("table doesn't contain any connection")
+	}
+	found := slices.ContainsFunc(report.Transfers, func(transfer TransferInfo) bool {
+		return transfer.Path == "/debug/connections"
+	})
+	if !found {
+		return fmt.Errorf("table doesn't contain the request for the table")
+	}
+	return nil
+}
+
+func checkDelay(ctx context.Context, s *ConformanceSuite) error {
+	start := time.Now()
+	response, body, err := s.get(ctx, "/delay/100ms", url.Values{"profile": {delayProfileConstant}}, nil)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	result := &DelayResult{}
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return err
+	}
+	if time.Duration(result.Delay) != 100*time.Millisecond || elapsed < 100*time.Millisecond {
+		return fmt.Errorf("delay is %s and response took %s, but both should be 100ms", time.Duration(result.Delay),
+			elapsed)
+	}
+	return nil
+}
+
+func checkObjects(ctx context.Context, s *ConformanceSuite) error {
+	// The complete object should be the same than the one generated locally:
+	object := newSyntheticObject("conformance")
+	expected, err := io.ReadAll(object)
+	if err != nil {
+		return err
+	}
+	response, body, err := s.get(ctx, "/objects/conformance", nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(body, expected) {
+		return fmt.Errorf("object has %d bytes, but it doesn't match the expected %d bytes", len(body), len(expected))
+	}
+	err = expectHeader(response.Header, "ETag", object.ETag())
+	if err != nil {
+		return err
+	}
+
+	// A range should return the same bytes:
+	response, body, err = s.get(ctx, "/objects/conformance", nil, http.Header{"Range": {"bytes=100-199"}})
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusPartialContent)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(body, expected[100:200]) {
+		return fmt.Errorf("range of object doesn't match the expected data")
+	}
+	return nil
+}
+
+func checkS3(ctx context.Context, s *ConformanceSuite) error {
+	// List the first object of the bucket:
+	query := url.Values{"list-type": {"2"}, "max-keys": {"1"}}
+	response, body, err := s.get(ctx, s3Prefix+"conformance", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	result := &S3ListBucketResult{}
+	err = xml.Unmarshal(body, result)
+	if err != nil {
+		return err
+	}
+	if len(result.Contents) != 1 || !result.IsTruncated || result.NextContinuationToken == "" {
+		return fmt.Errorf("listing should contain one object and be truncated")
+	}
+	listed := result.Contents[0]
+
+	// Get the object and check that it matches the listing:
+	response, body, err = s.get(ctx, s3Prefix+"conformance/"+listed.Key, nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	err = expectHeader(response.Header, "ETag", listed.ETag)
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) != listed.Size {
+		return fmt.Errorf("object has %d bytes, but the listing says %d", len(body), listed.Size)
+	}
+	return nil
+}
+
+func checkRanges(ctx context.Context, s *ConformanceSuite) error {
+	// Request two ranges of the sequence pattern, which should be returned as a multipart body:
+	query := url.Values{"size": {"1000"}, "pattern": {patternSequence}}
+	header := http.Header{"Range": {"bytes=0-9,500-509"}}
+	response, body, err := s.get(ctx, "/", query, header)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusPartialContent)
+	if err != nil {
+		return err
+	}
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	if mediaType != "multipart/byteranges" {
+		return fmt.Errorf("expected content type 'multipart/byteranges', but received '%s'", mediaType)
+	}
+	expected := sequenceData(1000)
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for _, start := range []int{0, 500} {
+		part, err := reader.NextPart()
+		if err != nil {
+			return err
+		}
+		err = expectHeader(http.Header(part.Header), "Content-Range", fmt.Sprintf("bytes %d-%d/1000", start,
+			start+9))
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, expected[start:start+10]) {
+			return fmt.Errorf("part starting at %d doesn't match the expected data", start)
+		}
+	}
+	return nil
+}
+
+func checkConditional(ctx context.Context, s *ConformanceSuite) error {
+	// Data generated with a seed should have an entity tag:
+	query := url.Values{"size": {"1000"}, "seed": {"conformance"}}
+	response, _, err := s.get(ctx, "/", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	etag := response.Header.Get("ETag")
+	if etag == "" {
+		return fmt.Errorf("header 'ETag' is missing")
+	}
+
+	// Requesting it again with the entity tag should return a not modified response:
+	response, _, err = s.get(ctx, "/", query, http.Header{"If-None-Match": {etag}})
+	if err != nil {
+		return err
+	}
+	return expectStatus(response, http.StatusNotModified)
+}
+
+func checkThrottle(ctx context.Context, s *ConformanceSuite) error {
+	// The client is unique for each run, so that the counters of previous runs don't interfere:
+	query := url.Values{
+		"size":           {"10"},
+		"throttle_after": {"2"},
+		"client":         {fmt.Sprintf("conformance-%d", time.Now().UnixNano())},
+	}
+	for _, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		response, _, err := s.get(ctx, "/", query, nil)
+		if err != nil {
+			return err
+		}
+		err = expectStatus(response, expected)
+		if err != nil {
+			return err
+		}
+		if expected == http.StatusTooManyRequests {
+			seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+			if err != nil || seconds <= 0 {
+				return fmt.Errorf("header 'Retry-After' should be a positive number of seconds")
+			}
+		}
+	}
+	return nil
+}
+
+func checkRedirect(ctx context.Context, s *ConformanceSuite) error {
+	response, body, err := s.get(ctx, "/redirect/3", url.Values{"code": {"301,307"}, "size": {"10"}}, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if response.Request.URL.Path != "/" || len(body) != 10 {
+		return fmt.Errorf("redirects should end in '/' with 10 bytes, but ended in '%s' with %d bytes",
+			response.Request.URL.Path, len(body))
+	}
+	return nil
+}
+
+func checkTarArchive(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"format":   {archiveFormatTar},
+		"files":    {"3"},
+		"filesize": {"1000"},
+	}
+	response, body, err := s.get(ctx, "/archive", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	reader := tar.NewReader(bytes.NewReader(body))
+	count := 0
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("archive isn't a valid tar archive: %w", err)
+		}
+		if header.Size != 1000 {
+			return fmt.Errorf("file '%s' has %d bytes, but it should have 1000", header.Name, header.Size)
+		}
+		count++
+	}
+	if count != 3 {
+		return fmt.Errorf("expected 3 files in the archive, but there are %d", count)
+	}
+	return nil
+}
+
+func checkZipArchive(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"format":   {archiveFormatZip},
+		"files":    {"3"},
+		"filesize": {"1000"},
+	}
+	response, body, err := s.get(ctx, "/archive", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return fmt.Errorf("archive isn't a valid zip archive: %w", err)
+	}
+	if len(reader.File) != 3 {
+		return fmt.Errorf("expected 3 files in the archive, but there are %d", len(reader.File))
+	}
+
+	// Reading the files verifies the checksums:
+	for _, file := range reader.File {
+		content, err := file.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(io.Discard, content)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("file '%s' can't be read: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+func checkResume(ctx context.Context, s *ConformanceSuite) error {
+	// Each attempt is interrupted after 1000 bytes, so the download needs three attempts:
+	query := url.Values{
+		"size":      {"2500"},
+		"interrupt": {"1000"},
+	}
+	response, data, err := s.get(ctx, "/resume", query, nil)
+	if response == nil {
+		return err
+	}
+	token := response.Header.Get(resumeTokenHeader)
+	if token == "" {
+		return fmt.Errorf("response doesn't have the '%s' header", resumeTokenHeader)
+	}
+	for len(data) < 2500 {
+		var body []byte
+		response, body, err = s.get(ctx, "/resume/"+token, nil, nil)
+		if response == nil {
+			return err
+		}
+		err = expectStatus(response, http.StatusPartialContent)
+		if err != nil {
+			return err
+		}
+		err = expectHeader(response.Header, "Content-Range", fmt.Sprintf("bytes %d-2499/2500", len(data)))
+		if err != nil {
+			return err
+		}
+		if len(body) == 0 {
+			return fmt.Errorf("attempt to resume from byte %d returned no data", len(data))
+		}
+		data = append(data, body...)
+	}
+
+	// The content should be the same when the client asks to start again:
+	query = url.Values{
+		"offset": {"0"},
+	}
+	_, body, _ := s.get(ctx, "/resume/"+token, query, nil)
+	if len(body) != 1000 || !bytes.Equal(body, data[:1000]) {
+		return fmt.Errorf("content changed when the download was restarted")
+	}
+
+	// The statistics should report that the download has been completed:
+	_, body, err = s.get(ctx, "/stats", nil, nil)
+	if err != nil {
+		return err
+	}
+	var report StatsReport
+	err = json.Unmarshal(body, &report)
+	if err != nil {
+		return fmt.Errorf("statistics aren't valid JSON: %w", err)
+	}
+	for _, session := range report.ResumeSessions {
+		if session.Token == token {
+			if !session.Completed || session.Delivered != 2500 {
+				return fmt.Errorf("download has delivered %d bytes but it should be complete", session.Delivered)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("statistics don't contain download '%s'", token)
+}
+
+func checkRegistry(ctx context.Context, s *ConformanceSuite) error {
+	response, body, err := s.get(ctx, "/v2/conformance/2x1k/manifests/latest", nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	err = expectHeader(response.Header, "Docker-Content-Digest", ociDigest(body))
+	if err != nil {
+		return err
+	}
+	var manifest OCIManifest
+	err = json.Unmarshal(body, &manifest)
+	if err != nil {
+		return fmt.Errorf("manifest isn't valid JSON: %w", err)
+	}
+	if len(manifest.Layers) != 2 {
+		return fmt.Errorf("expected 2 layers in the manifest, but there are %d", len(manifest.Layers))
+	}
+
+	// The blobs should have the size and the digest of the descriptors:
+	for _, descriptor := range append([]OCIDescriptor{manifest.Config}, manifest.Layers...) {
+		response, body, err = s.get(ctx, "/v2/conformance/2x1k/blobs/"+descriptor.Digest, nil, nil)
+		if err != nil {
+			return err
+		}
+		err = expectStatus(response, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		if int64(len(body)) != descriptor.Size || ociDigest(body) != descriptor.Digest {
+			return fmt.Errorf("blob '%s' doesn't match its descriptor", descriptor.Digest)
+		}
+	}
+	return nil
+}
+
+func checkRegistryUpload(ctx context.Context, s *ConformanceSuite) error {
+	response, _, err := s.send(ctx, http.MethodPost, "/v2/conformance/push/blobs/uploads/", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	location := response.Header.Get("Location")
+	if location == "" {
+		return fmt.Errorf("response to the start of the upload doesn't have a location")
+	}
+
+	// Send two chunks, the second one with a range that doesn't match, which should be rejected:
+	chunk := []byte(patternSequence)
+	header := http.Header{
+		"Content-Range": {fmt.Sprintf("0-%d", len(chunk)-1)},
+	}
+	for _, expected := range []int{http.StatusAccepted, http.StatusRequestedRangeNotSatisfiable} {
+		response, _, err = s.send(ctx, http.MethodPatch, location, nil, header, chunk)
+		if err != nil {
+			return err
+		}
+		err = expectStatus(response, expected)
+		if err != nil {
+			return err
+		}
+		err = expectHeader(response.Header, "Range", fmt.Sprintf("0-%d", len(chunk)-1))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Finish the upload with the last chunk and a wrong digest, which should be rejected without discarding the
+	// upload, and then try again with the right one:
+	blob := append(chunk, chunk...)
+	query := url.Values{
+		"digest": {ociDigest(chunk)},
+	}
+	response, _, err = s.send(ctx, http.MethodPut, location, query, nil, chunk)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusBadRequest)
+	if err != nil {
+		return err
+	}
+	query.Set("digest", ociDigest(blob))
+	response, _, err = s.send(ctx, http.MethodPut, location, query, nil, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	return expectHeader(response.Header, "Docker-Content-Digest", ociDigest(blob))
+}
+
+func checkHLS(ctx context.Context, s *ConformanceSuite) error {
+	// The playlist should contain the four segments of the presentation:
+	query := url.Values{
+		"bitrates": {"100000"},
+		"segment":  {"1s"},
+		"duration": {"3500ms"},
+	}
+	response, body, err := s.get(ctx, "/media/hls/100000/playlist.m3u8", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	count := bytes.Count(body, []byte("#EXTINF:"))
+	if count != 4 {
+		return fmt.Errorf("expected 4 segments in the playlist, but there are %d", count)
+	}
+	if !bytes.Contains(body, []byte("#EXT-X-ENDLIST")) {
+		return fmt.Errorf("playlist doesn't contain the end marker")
+	}
+
+	// The segments should be made of transport stream packets:
+	response, body, err = s.get(ctx, "/media/hls/100000/3.ts", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 || len(body)%tsPacketSize != 0 {
+		return fmt.Errorf("segment size %d isn't a multiple of the packet size", len(body))
+	}
+	for i := 0; i < len(body); i += tsPacketSize {
+		if body[i] != 0x47 {
+			return fmt.Errorf("packet at offset %d doesn't start with the sync byte", i)
+		}
+	}
+	return nil
+}
+
+func checkDASH(ctx context.Context, s *ConformanceSuite) error {
+	query := url.Values{
+		"bitrates": {"100000,200000"},
+		"segment":  {"2s"},
+	}
+	response, body, err := s.get(ctx, "/media/dash/manifest.mpd", query, nil)
+	if err != nil {
+		return err
+	}
+	err = expectStatus(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	var manifest DASHManifest
+	err = xml.Unmarshal(body, &manifest)
+	if err != nil {
+		return fmt.Errorf("manifest isn't valid XML: %w", err)
+	}
+	count := len(manifest.Period.AdaptationSet.Representations)
+	if count != 2 {
+		return fmt.Errorf("expected 2 representations in the manifest, but there are %d", count)
+	}
+
+	// The initialization and media segments should start with the expected boxes:
+	expected := map[string]string{
+		"/media/dash/200000/init.mp4": "ftyp",
+		"/media/dash/200000/1.m4s":    "styp",
+	}
+	for path, kind := range expected {
+		response, body, err = s.get(ctx, path, query, nil)
+		if err != nil {
+			return err
+		}
+		err = expectStatus(response, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		if len(body) < 8 || string(body[4:8]) != kind {
+			return fmt.Errorf("file '%s' doesn't start with a '%s' box", path, kind)
+		}
+	}
+	return nil
+}
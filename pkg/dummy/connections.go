@@ -0,0 +1,281 @@
+package dummy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errTransferKilled is returned by the writes of transfers that have been killed with the admin API.
+var errTransferKilled = errors.New("transfer killed by the administrator")
+
+// ConnectionsReport is the document returned by the connections endpoint.
+type ConnectionsReport struct {
+	Connections []ConnectionInfo `json:"connections"`
+	Transfers   []TransferInfo   `json:"transfers"`
+}
+
+// ConnectionInfo describes an open connection.
+type ConnectionInfo struct {
+	Remote    string    `json:"remote"`
+	Local     string    `json:"local"`
+	State     string    `json:"state"`
+	Start     time.Time `json:"start"`
+	Duration  Duration  `json:"duration"`
+	Transfers int       `json:"transfers"`
+}
+
+// TransferInfo describes a request that is being served. The rate is the average since the start of the request, in
+// bytes per second.
+type TransferInfo struct {
+	ID       int64     `json:"id"`
+	Remote   string    `json:"remote"`
+	Protocol string    `json:"protocol"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Start    time.Time `json:"start"`
+	Duration Duration  `json:"duration"`
+	Bytes    int64     `json:"bytes"`
+	Rate     float64   `json:"rate"`
+}
+
+// connectionEntry is the state of an open connection.
+type connectionEntry struct {
+	start time.Time
+	state http.ConnState
+}
+
+// transferEntry is the state of a request that is being served.
+type transferEntry struct {
+	info   TransferInfo
+	bytes  atomic.Int64
+	killed atomic.Bool
+	cancel context.CancelFunc
+}
+
+// ConnectionTable tracks the open connections and the requests that are being served, so that they can be inspected,
+// and so that transfers can be killed.
+type ConnectionTable struct {
+	lock        sync.Mutex
+	connections map[net.Conn]*connectionEntry
+	transfers   map[int64]*transferEntry
+	next        int64
+}
+
+// NewConnectionTable creates an empty connection table.
+func NewConnectionTable() *ConnectionTable {
+	return &ConnectionTable{
+		connections: map[net.Conn]*connectionEntry{},
+		transfers:   map[int64]*transferEntry{},
+	}
+}
+
+// ConnState updates the table of connections. It should be used as the ConnState hook of the HTTP servers.
+func (t *ConnectionTable) ConnState(conn net.Conn, state http.ConnState) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(t.connections, conn)
+	default:
+		entry := t.connections[conn]
+		if entry == nil {
+			entry = &connectionEntry{
+				start: time.Now(),
+			}
+			t.connections[conn] = entry
+		}
+		entry.state = state
+	}
+}
+
+// Serve serves the request with the given handler, adding it to the table of transfers while it runs.
+func (t *ConnectionTable) Serve(handler http.Handler, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	entry := &transferEntry{
+		info: TransferInfo{
+			Remote:   r.RemoteAddr,
+			Protocol: r.Proto,
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Start:    time.Now(),
+		},
+		cancel: cancel,
+	}
+	t.lock.Lock()
+	t.next++
+	entry.info.ID = t.next
+	t.transfers[entry.info.ID] = entry
+	t.lock.Unlock()
+	defer func() {
+		t.lock.Lock()
+		delete(t.transfers, entry.info.ID)
+		t.lock.Unlock()
+	}()
+	handler.ServeHTTP(&transferWriter{
+		ResponseWriter: w,
+		entry:          entry,
+	}, r.WithContext(ctx))
+
+	// Reset the stream of killed transfers, so that the client doesn't take the partial body for the complete one:
+	if entry.killed.Load() {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Kill stops the transfer with the given identifier. It returns false if there is no such transfer.
+func (t *ConnectionTable) Kill(id int64) bool {
+	t.lock.Lock()
+	entry := t.transfers[id]
+	t.lock.Unlock()
+	if entry == nil {
+		return false
+	}
+	entry.killed.Store(true)
+	entry.cancel()
+	return true
+}
+
+// Report returns the open connections and the transfers in progress, sorted by start time.
+func (t *ConnectionTable) Report() *ConnectionsReport {
+	now := time.Now()
+	report := &ConnectionsReport{
+		Connections: []ConnectionInfo{},
+		Transfers:   []TransferInfo{},
+	}
+	t.lock.Lock()
+	counts := map[string]int{}
+	for _, entry := range t.transfers {
+		info := entry.info
+		info.Duration = Duration(now.Sub(info.Start))
+		info.Bytes = entry.bytes.Load()
+		seconds := now.Sub(info.Start).Seconds()
+		if seconds > 0 {
+			info.Rate = float64(info.Bytes) / seconds
+		}
+		report.Transfers = append(report.Transfers, info)
+		counts[info.Remote]++
+	}
+	for conn, entry := range t.connections {
+		remote := conn.RemoteAddr().String()
+		report.Connections = append(report.Connections, ConnectionInfo{
+			Remote:    remote,
+			Local:     conn.LocalAddr().String(),
+			State:     entry.state.String(),
+			Start:     entry.start,
+			Duration:  Duration(now.Sub(entry.start)),
+			Transfers: counts[remote],
+		})
+	}
+	t.lock.Unlock()
+	slices.SortFunc(report.Connections, func(a, b ConnectionInfo) int {
+		return a.Start.Compare(b.Start)
+	})
+	slices.SortFunc(report.Transfers, func(a, b TransferInfo) int {
+		return a.Start.Compare(b.Start)
+	})
+	return report
+}
+
+// transferWriter is a response writer that counts the bytes of the body of a transfer, and that fails when the
+// transfer has been killed.
+type transferWriter struct {
+	http.ResponseWriter
+	entry *transferEntry
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *transferWriter) Write(p []byte) (n int, err error) {
+	if w.entry.killed.Load() {
+		err = errTransferKilled
+		return
+	}
+	n, err = w.ResponseWriter.Write(p)
+	w.entry.bytes.Add(int64(n))
+	return
+}
+
+// ReadFrom is the implementation of the io.ReaderFrom interface. It is needed so that the runtime can still use
+// sendfile to copy the blobs of the patterns.
+func (w *transferWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	if w.entry.killed.Load() {
+		err = errTransferKilled
+		return
+	}
+	readerFrom, ok := w.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		n, err = io.Copy(struct{ io.Writer }{w}, r)
+		return
+	}
+	n, err = readerFrom.ReadFrom(r)
+	w.entry.bytes.Add(n)
+	return
+}
+
+// Flush is the implementation of the http.Flusher interface.
+func (w *transferWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack is the implementation of the http.Hijacker interface, needed by the WebSocket library. Note that the bytes
+// sent through hijacked connections aren't counted.
+func (w *transferWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped response writer, so that http.ResponseController can use it.
+func (w *transferWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ConnectionsHandler is an HTTP handler that returns the open connections and the transfers in progress as a JSON
+// document, and that kills transfers when it receives a DELETE request with the identifier of the transfer. The
+// server only sends it the DELETE requests that contain the admin token.
+type ConnectionsHandler struct {
+	logger *slog.Logger
+	stats  *Stats
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *ConnectionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		text := r.PathValue("id")
+		id, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("transfer identifier '%s' should be a number", text), http.StatusBadRequest)
+			return
+		}
+		if !h.stats.connections.Kill(id) {
+			http.Error(w, fmt.Sprintf("transfer %d doesn't exist", id), http.StatusNotFound)
+			return
+		}
+		h.logger.Info(
+			"Killed transfer",
+			slog.Int64("id", id),
+		)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(h.stats.connections.Report())
+	if err != nil {
+		h.logger.Error(
+			"Failed to send connections",
+			slog.String("error", err.Error()),
+		)
+	}
+}
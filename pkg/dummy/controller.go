@@ -0,0 +1,283 @@
+package dummy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Path of the DummyTest custom resources, relative to the namespace.
+const dummyTestsPath = "/apis/dummy.jhernand.github.com/v1alpha1/namespaces/%s/dummytests"
+
+// Phases of a DummyTest:
+const (
+	dummyTestRunning   = "Running"
+	dummyTestSucceeded = "Succeeded"
+	dummyTestFailed    = "Failed"
+)
+
+// DummyTest is a custom resource that describes a network test that the controller runs using the client.
+type DummyTest struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec   DummyTestSpec    `json:"spec"`
+	Status *DummyTestStatus `json:"status,omitempty"`
+}
+
+// DummyTestSpec describes what the test should do.
+type DummyTestSpec struct {
+	// Targets are the addresses of the servers.
+	Targets []string `json:"targets"`
+
+	// Sizes are the sizes of the data requested to each target. When empty the server default is used.
+	Sizes []int `json:"sizes,omitempty"`
+
+	// Duration is the time that the test runs. All the combinations of targets and sizes are repeated till this time
+	// has passed, and they are always executed at least once.
+	Duration Duration `json:"duration,omitempty"`
+
+	// Insecure disables verification of the TLS certificates of the targets.
+	Insecure bool `json:"insecure,omitempty"`
+
+	// Assertions are the conditions that the results need to satisfy for the test to succeed.
+	Assertions DummyTestAssertions `json:"assertions,omitempty"`
+}
+
+// DummyTestAssertions are the conditions that the results of a test need to satisfy.
+type DummyTestAssertions struct {
+	// MinThroughput is the minimum average throughput, in bytes per second, of each combination of target and
+	// size.
+	MinThroughput float64 `json:"minThroughput,omitempty"`
+
+	// MaxErrors is the maximum number of failed downloads. When not set no limit is checked.
+	MaxErrors *int `json:"maxErrors,omitempty"`
+}
+
+// DummyTestStatus contains the results of the test, written by the controller.
+type DummyTestStatus struct {
+	Phase          string            `json:"phase,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	StartTime      *time.Time        `json:"startTime,omitempty"`
+	CompletionTime *time.Time        `json:"completionTime,omitempty"`
+	Results        []DummyTestResult `json:"results,omitempty"`
+}
+
+// DummyTestResult contains the aggregated measurements for a combination of target and size.
+type DummyTestResult struct {
+	Target     string  `json:"target"`
+	Size       int     `json:"size,omitempty"`
+	Downloads  int     `json:"downloads"`
+	Errors     int     `json:"errors"`
+	Bytes      int64   `json:"bytes"`
+	Throughput float64 `json:"throughput"`
+}
+
+// Controller watches DummyTest resources and runs the tests that haven't been run yet.
+type Controller struct {
+	logger    *slog.Logger
+	kube      *KubeClient
+	namespace string
+	lock      sync.Mutex
+	running   map[string]bool
+}
+
+// NewController creates a controller that watches the tests of the given namespace using the given Kubernetes client.
+func NewController(logger *slog.Logger, kube *KubeClient, namespace string) *Controller {
+	return &Controller{
+		logger:    logger,
+		kube:      kube,
+		namespace: namespace,
+		running:   map[string]bool{},
+	}
+}
+
+// Run lists and watches the DummyTest resources till the context is cancelled. When the watch is closed by the
+// server, or fails, the resources are listed again and a new watch is started.
+func (c *Controller) Run(ctx context.Context) {
+	path := fmt.Sprintf(dummyTestsPath, c.namespace)
+	for ctx.Err() == nil {
+		err := c.listAndWatch(ctx, path)
+		if err != nil {
+			c.logger.Error(
+				"Failed to watch tests",
+				slog.String("error", err.Error()),
+			)
+			sleepUntil(ctx, time.Now().Add(5*time.Second))
+		}
+	}
+}
+
+func (c *Controller) listAndWatch(ctx context.Context, path string) error {
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []json.RawMessage `json:"items"`
+	}
+	err := c.kube.Get(ctx, path, &list)
+	if err != nil {
+		return err
+	}
+	for _, item := range list.Items {
+		c.process(ctx, item)
+	}
+	return c.kube.Watch(ctx, path, list.Metadata.ResourceVersion, func(event *KubeEvent) {
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			c.process(ctx, event.Object)
+		case "ERROR":
+			c.logger.Info(
+				"Received watch error",
+				slog.String("object", string(event.Object)),
+			)
+		}
+	})
+}
+
+// process starts the test if it hasn't been started yet.
+func (c *Controller) process(ctx context.Context, data json.RawMessage) {
+	test := &DummyTest{}
+	err := json.Unmarshal(data, test)
+	if err != nil {
+		c.logger.Error(
+			"Failed to parse test",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if test.Status != nil && test.Status.Phase != "" {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.running[test.Metadata.Name] {
+		return
+	}
+	c.running[test.Metadata.Name] = true
+	go func() {
+		c.run(ctx, test)
+		c.lock.Lock()
+		delete(c.running, test.Metadata.Name)
+		c.lock.Unlock()
+	}()
+}
+
+// run runs the test and updates the status with the results.
+func (c *Controller) run(ctx context.Context, test *DummyTest) {
+	name := test.Metadata.Name
+	logger := c.logger.With(slog.String("test", name))
+	startTime := time.Now().UTC()
+	status := &DummyTestStatus{
+		Phase:     dummyTestRunning,
+		StartTime: &startTime,
+	}
+	err := c.updateStatus(ctx, name, status)
+	if err != nil {
+		logger.Error(
+			"Failed to update status",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	logger.Info(
+		"Started test",
+		slog.Any("spec", test.Spec),
+	)
+
+	// Run the downloads:
+	sizes := test.Spec.Sizes
+	if len(sizes) == 0 {
+		sizes = []int{0}
+	}
+	client := NewClient(test.Spec.Insecure, DefaultBufferSize)
+	results := map[string]*DummyTestResult{}
+	elapsed := map[string]time.Duration{}
+	var order []string
+	deadline := startTime.Add(time.Duration(test.Spec.Duration))
+	for first := true; first || time.Now().Before(deadline); first = false {
+		for _, target := range test.Spec.Targets {
+			for _, size := range sizes {
+				key := fmt.Sprintf("%s/%d", target, size)
+				result, ok := results[key]
+				if !ok {
+					result = &DummyTestResult{
+						Target: target,
+						Size:   size,
+					}
+					results[key] = result
+					order = append(order, key)
+				}
+				address, err := ClientAddress(target, size, "")
+				if err != nil {
+					result.Downloads++
+					result.Errors++
+					continue
+				}
+				download := client.Download(ctx, address)
+				result.Downloads++
+				result.Bytes += download.Bytes
+				elapsed[key] += time.Duration(download.Elapsed)
+				if download.Error != "" || download.Status != http.StatusOK {
+					result.Errors++
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	// Check the assertions:
+	status.Phase = dummyTestSucceeded
+	totalErrors := 0
+	for _, key := range order {
+		result := results[key]
+		if elapsed[key] > 0 {
+			result.Throughput = float64(result.Bytes) / elapsed[key].Seconds()
+		}
+		status.Results = append(status.Results, *result)
+		totalErrors += result.Errors
+		minThroughput := test.Spec.Assertions.MinThroughput
+		if minThroughput > 0 && result.Throughput < minThroughput && status.Phase == dummyTestSucceeded {
+			status.Phase = dummyTestFailed
+			status.Message = fmt.Sprintf(
+				"throughput of '%s' with size %d is %.0f, less than the minimum %.0f",
+				result.Target, result.Size, result.Throughput, minThroughput,
+			)
+		}
+	}
+	maxErrors := test.Spec.Assertions.MaxErrors
+	if maxErrors != nil && totalErrors > *maxErrors && status.Phase == dummyTestSucceeded {
+		status.Phase = dummyTestFailed
+		status.Message = fmt.Sprintf("there were %d errors, more than the maximum %d", totalErrors, *maxErrors)
+	}
+	completionTime := time.Now().UTC()
+	status.CompletionTime = &completionTime
+	err = c.updateStatus(ctx, name, status)
+	if err != nil {
+		logger.Error(
+			"Failed to update status",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	logger.Info(
+		"Finished test",
+		slog.String("phase", status.Phase),
+		slog.String("message", status.Message),
+	)
+}
+
+func (c *Controller) updateStatus(ctx context.Context, name string, status *DummyTestStatus) error {
+	path := fmt.Sprintf(dummyTestsPath+"/%s/status", c.namespace, name)
+	return c.kube.MergePatch(ctx, path, map[string]any{
+		"status": status,
+	})
+}
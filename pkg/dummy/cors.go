@@ -0,0 +1,165 @@
+package dummy
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default CORS policy values, used when the configuration doesn't specify them:
+var (
+	defaultCORSMethods = []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodDelete,
+	}
+	defaultCORSExposedHeaders = []string{
+		instanceHeader,
+		nodeHeader,
+		zoneHeader,
+		scenarioStepHeader,
+		sessionHeader,
+		quotaRemainingHeader,
+		elapsedTrailer,
+		throughputTrailer,
+		chunksTrailer,
+		"Content-Length",
+		"Content-Range",
+		"ETag",
+	}
+)
+
+// Default time that browsers can cache the result of a preflight request.
+const defaultCORSMaxAge = 10 * time.Minute
+
+// CORSConfig is the cross origin resource sharing policy, which allows browser based clients loaded from other
+// origins to send requests to the server.
+type CORSConfig struct {
+	// AllowedOrigins are the origins that can send requests. The '*' value allows any origin. When empty CORS is
+	// disabled.
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+
+	// AllowedMethods are the methods that can be used. The default is 'GET', 'HEAD', 'POST', 'PUT' and 'DELETE'.
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
+
+	// AllowedHeaders are the request headers that can be used. The default is to allow the headers that the
+	// browser asks for in the preflight request.
+	AllowedHeaders []string `json:"allowed_headers,omitempty"`
+
+	// ExposedHeaders are the response headers that scripts can read, in addition to the basic ones. The default is
+	// the headers and trailers that contain the identity of the instance and the measurements of the server.
+	ExposedHeaders []string `json:"exposed_headers,omitempty"`
+
+	// AllowCredentials allows requests with cookies. Note that it requires explicit origins, not '*'.
+	AllowCredentials bool `json:"allow_credentials,omitempty"`
+
+	// MaxAge is the time that browsers can cache the result of a preflight request. The default is 10 minutes.
+	MaxAge Duration `json:"max_age,omitempty"`
+}
+
+// validate checks that the CORS policy is valid.
+func (c *CORSConfig) validate() error {
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return errors.New("CORS credentials can't be allowed for any origin, the allowed origins must be explicit")
+	}
+	if c.MaxAge < 0 {
+		return errors.New("CORS maximum age can't be negative")
+	}
+	return nil
+}
+
+// CORSHandler is an HTTP handler that adds the CORS headers to the responses of the wrapped handler, and answers the
+// preflight requests, so that browser based clients can talk directly to the server.
+type CORSHandler struct {
+	handler        http.Handler
+	origins        []string
+	anyOrigin      bool
+	methods        string
+	headers        string
+	exposedHeaders string
+	credentials    bool
+	maxAge         string
+}
+
+// NewCORSHandler wraps the given handler so that it applies the given CORS policy. If the policy doesn't allow any
+// origin it returns the given handler unchanged.
+func NewCORSHandler(handler http.Handler, config CORSConfig) (result http.Handler, err error) {
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	if len(config.AllowedOrigins) == 0 {
+		result = handler
+		return
+	}
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	exposedHeaders := config.ExposedHeaders
+	if len(exposedHeaders) == 0 {
+		exposedHeaders = defaultCORSExposedHeaders
+	}
+	maxAge := time.Duration(config.MaxAge)
+	if maxAge == 0 {
+		maxAge = defaultCORSMaxAge
+	}
+	result = &CORSHandler{
+		handler:        handler,
+		origins:        config.AllowedOrigins,
+		anyOrigin:      slices.Contains(config.AllowedOrigins, "*"),
+		methods:        strings.Join(methods, ", "),
+		headers:        strings.Join(config.AllowedHeaders, ", "),
+		exposedHeaders: strings.Join(exposedHeaders, ", "),
+		credentials:    config.AllowCredentials,
+		maxAge:         strconv.Itoa(int(maxAge.Seconds())),
+	}
+	return
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *CORSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Requests without origin, or from origins that aren't allowed, are passed without CORS headers, so the browser
+	// will block the responses:
+	origin := r.Header.Get("Origin")
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	if origin == "" || (!h.anyOrigin && !slices.Contains(h.origins, origin)) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	if h.anyOrigin && !h.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if h.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	// Answer the preflight requests directly. If the allowed headers aren't configured explicitly the ones
+	// requested by the browser are allowed.
+	requestedMethod := r.Header.Get("Access-Control-Request-Method")
+	if r.Method == http.MethodOptions && requestedMethod != "" {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", h.methods)
+		allowedHeaders := h.headers
+		if allowedHeaders == "" {
+			allowedHeaders = r.Header.Get("Access-Control-Request-Headers")
+		}
+		if allowedHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowedHeaders)
+		}
+		header.Set("Access-Control-Max-Age", h.maxAge)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	header.Set("Access-Control-Expose-Headers", h.exposedHeaders)
+	h.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,75 @@
+package dummy
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Limits of the simulated per request cost:
+const (
+	maxCPUCost   = time.Minute
+	maxAllocCost = 1 << 30 // 1 GiB
+)
+
+// RequestCost is the CPU time and memory that a request consumes, so that the server can emulate compute bound
+// backends.
+type RequestCost struct {
+	CPU   time.Duration
+	Alloc int
+}
+
+// parseRequestCost gets the cost from the 'cpu' query parameter, which is the number of milliseconds of CPU time, and
+// the 'alloc' query parameter, which is the number of bytes of memory.
+func parseRequestCost(query url.Values) (result RequestCost, err error) {
+	cpu, err := parseIntParam(query.Get("cpu"), 0)
+	if err != nil {
+		err = fmt.Errorf("cpu '%s' should be a non negative number of milliseconds", query.Get("cpu"))
+		return
+	}
+	result.CPU = time.Duration(cpu) * time.Millisecond
+	if result.CPU > maxCPUCost {
+		err = fmt.Errorf("cpu %s exceeds the maximum %s", result.CPU, maxCPUCost)
+		return
+	}
+	result.Alloc, err = parseIntParam(query.Get("alloc"), 0)
+	if err != nil {
+		err = fmt.Errorf("alloc '%s' should be a non negative number of bytes", query.Get("alloc"))
+		return
+	}
+	if result.Alloc > maxAllocCost {
+		err = fmt.Errorf("alloc %d exceeds the maximum %d", result.Alloc, maxAllocCost)
+	}
+	return
+}
+
+// Apply allocates the memory and then keeps one CPU busy during the configured time, or till the context is
+// cancelled. The returned memory should be kept alive by the caller till the end of the request, so that it
+// contributes to the memory usage of the process while the response is streamed.
+func (c RequestCost) Apply(ctx context.Context) []byte {
+	// Allocate the memory and write to every page, otherwise the operating system wouldn't really allocate it:
+	var memory []byte
+	if c.Alloc > 0 {
+		memory = make([]byte, c.Alloc)
+		page := os.Getpagesize()
+		for i := 0; i < len(memory); i += page {
+			memory[i] = 1
+		}
+	}
+
+	// Burn the CPU calculating hashes, checking the time and the context from time to time:
+	if c.CPU > 0 {
+		deadline := time.Now().Add(c.CPU)
+		var block [1024]byte
+		for time.Now().Before(deadline) && ctx.Err() == nil {
+			for i := 0; i < 100; i++ {
+				sum := sha256.Sum256(block[:])
+				copy(block[:], sum[:])
+			}
+		}
+	}
+	return memory
+}
@@ -0,0 +1,167 @@
+package dummy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Names of the delay profiles:
+const (
+	delayProfileConstant = "constant"
+	delayProfileUniform  = "uniform"
+	delayProfilePareto   = "pareto"
+	delayProfileSpike    = "spike"
+)
+
+// Defaults for the delay endpoint:
+const (
+	defaultParetoAlpha = 2.0
+	defaultSpikeRate   = 0.01
+	defaultSpikeFactor = 10.0
+	maxDelay           = 5 * time.Minute
+)
+
+// DelayResult is the response of the delay endpoint.
+type DelayResult struct {
+	Profile   string   `json:"profile"`
+	Requested Duration `json:"requested"`
+	Delay     Duration `json:"delay"`
+}
+
+// DelayHandler is an HTTP handler that waits before responding, so that client timeouts and hedging strategies can be
+// tested. The duration in the path is used according to the profile selected with the 'profile' query parameter:
+//
+//   - constant: the delay is always the duration. This is the default.
+//   - uniform: the delay is uniformly distributed between zero and twice the duration.
+//   - pareto: the delay follows a Pareto distribution where the duration is the minimum, and the 'alpha' query
+//     parameter is the shape. The default shape is 2, so the mean is twice the duration, with a long tail.
+//   - spike: the delay is the duration, but with the probability given by the 'spike_rate' query parameter it is
+//     multiplied by the 'spike_factor' query parameter. The defaults are 0.01 and 10.
+//
+// The 'max' query parameter limits the delay, which is also limited to five minutes.
+type DelayHandler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *DelayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+
+	// Get the parameters:
+	text := r.PathValue("duration")
+	requested, err := time.ParseDuration(text)
+	if err != nil || requested < 0 {
+		http.Error(w, fmt.Sprintf("duration '%s' should be a non negative duration", text), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	profile := query.Get("profile")
+	if profile == "" {
+		profile = delayProfileConstant
+	}
+	limit := maxDelay
+	text = query.Get("max")
+	if text != "" {
+		value, err := time.ParseDuration(text)
+		if err != nil || value < 0 {
+			http.Error(w, fmt.Sprintf("max '%s' should be a non negative duration", text), http.StatusBadRequest)
+			return
+		}
+		limit = min(value, limit)
+	}
+
+	// Calculate the delay:
+	var delay time.Duration
+	switch profile {
+	case delayProfileConstant:
+		delay = requested
+	case delayProfileUniform:
+		delay = time.Duration(rand.Float64() * 2 * float64(requested))
+	case delayProfilePareto:
+		alpha, err := parseFloatParam(query.Get("alpha"), defaultParetoAlpha)
+		if err != nil || alpha <= 0 {
+			http.Error(w, "alpha should be a positive number", http.StatusBadRequest)
+			return
+		}
+		delay = time.Duration(float64(requested) / math.Pow(1-rand.Float64(), 1/alpha))
+	case delayProfileSpike:
+		rate, err := parseFloatParam(query.Get("spike_rate"), defaultSpikeRate)
+		if err != nil || rate < 0 || rate > 1 {
+			http.Error(w, "spike_rate should be a number between zero and one", http.StatusBadRequest)
+			return
+		}
+		factor, err := parseFloatParam(query.Get("spike_factor"), defaultSpikeFactor)
+		if err != nil || factor < 0 {
+			http.Error(w, "spike_factor should be a non negative number", http.StatusBadRequest)
+			return
+		}
+		delay = requested
+		if rand.Float64() < rate {
+			delay = time.Duration(factor * float64(requested))
+		}
+	default:
+		http.Error(
+			w,
+			fmt.Sprintf(
+				"profile should be '%s', '%s', '%s' or '%s', but it is '%s'",
+				delayProfileConstant, delayProfileUniform, delayProfilePareto, delayProfileSpike, profile,
+			),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if delay < 0 || delay > limit {
+		delay = limit
+	}
+
+	// Wait, unless the client gives up before:
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		h.logger.Info(
+			"Client cancelled delay",
+			slog.String("profile", profile),
+			slog.String("delay", delay.String()),
+		)
+		return
+	}
+
+	// Send the result:
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&DelayResult{
+		Profile:   profile,
+		Requested: Duration(requested),
+		Delay:     Duration(delay),
+	})
+	if err != nil {
+		h.logger.Error(
+			"Failed to send delay result",
+			slog.String("error", err.Error()),
+		)
+	}
+	h.logger.Info(
+		"Delay finished",
+		slog.String("profile", profile),
+		slog.String("requested", requested.String()),
+		slog.String("delay", delay.String()),
+		h.identity.LogAttr(),
+	)
+}
+
+// parseFloatParam parses the value of a floating point query parameter. If the text is empty it returns the default
+// value.
+func parseFloatParam(text string, defaultValue float64) (result float64, err error) {
+	if text == "" {
+		result = defaultValue
+		return
+	}
+	result, err = strconv.ParseFloat(text, 64)
+	return
+}
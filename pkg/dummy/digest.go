@@ -0,0 +1,44 @@
+package dummy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"github.com/zeebo/xxh3"
+)
+
+// Digest algorithms supported for uploads:
+const (
+	DigestSHA256 = "sha256"
+	DigestCRC32  = "crc32"
+	DigestXXH3   = "xxh3"
+)
+
+// digestNames are the names of the supported digest algorithms, in the order used in help text and error messages.
+var digestNames = []string{
+	DigestSHA256,
+	DigestCRC32,
+	DigestXXH3,
+}
+
+// NewDigest creates the hash for the given digest algorithm, 'sha256', 'crc32' or 'xxh3'. The 'sha256' algorithm
+// detects any corruption, the other two are much faster and enough to detect accidental corruption.
+func NewDigest(name string) (result hash.Hash, err error) {
+	switch name {
+	case DigestSHA256:
+		result = sha256.New()
+	case DigestCRC32:
+		result = crc32.NewIEEE()
+	case DigestXXH3:
+		result = xxh3.New()
+	default:
+		err = fmt.Errorf(
+			"digest should be one of %s, but it is '%s'",
+			strings.Join(digestNames, ", "), name,
+		)
+	}
+	return
+}
@@ -0,0 +1,115 @@
+// Package dummytest contains helpers to run the dummy server in process in the tests of other projects. It is kept
+// apart from the dummy package so that programs that embed the server don't link the testing package.
+package dummytest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// Option changes the options used to create a test server.
+type Option func(*dummy.Options)
+
+// WithConfig sets the configuration of the test server.
+func WithConfig(config *dummy.Config) Option {
+	return func(options *dummy.Options) {
+		options.Config = config
+	}
+}
+
+// WithLogger sets the logger of the test server. The default is to discard the log.
+func WithLogger(logger *slog.Logger) Option {
+	return func(options *dummy.Options) {
+		options.Logger = logger
+	}
+}
+
+// WithIdentity sets the identity of the test server. The default is the identity loaded from the environment.
+func WithIdentity(identity dummy.Identity) Option {
+	return func(options *dummy.Options) {
+		options.Identity = &identity
+	}
+}
+
+// WithHeaders sets the extra headers added by the test server to the responses of the data endpoint.
+func WithHeaders(headers http.Header) Option {
+	return func(options *dummy.Options) {
+		options.Headers = headers
+	}
+}
+
+// Server is an in process dummy server for the tests of other projects. It uses TLS with a certificate generated for
+// each server, and supports HTTP/2.
+type Server struct {
+	server *dummy.Server
+	test   *httptest.Server
+}
+
+// NewServer starts a test server with the given options. The server is stopped automatically when the test finishes.
+// Any failure to create it fails the test.
+func NewServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	var options dummy.Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	server, err := dummy.NewServer(options)
+	if err != nil {
+		t.Fatalf("failed to create dummy server: %v", err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+	})
+	certPEM, keyPEM, err := dummy.GenerateCertificate([]string{"localhost", "127.0.0.1", "::1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate dummy server certificate: %v", err)
+	}
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to load dummy server certificate: %v", err)
+	}
+	test := httptest.NewUnstartedServer(server.Handler())
+	test.EnableHTTP2 = true
+	test.TLS = &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+	}
+	test.Config.ConnState = server.Stats().ConnState
+	test.StartTLS()
+	t.Cleanup(test.Close)
+	return &Server{
+		server: server,
+		test:   test,
+	}
+}
+
+// URL returns the base URL of the server, for example 'https://127.0.0.1:12345'.
+func (s *Server) URL() string {
+	return s.test.URL
+}
+
+// Client returns an HTTP client that trusts the certificate of the server.
+func (s *Server) Client() *http.Client {
+	return s.test.Client()
+}
+
+// Certificate returns the certificate of the server.
+func (s *Server) Certificate() *x509.Certificate {
+	return s.test.Certificate()
+}
+
+// Stats returns the statistics of the requests and connections served.
+func (s *Server) Stats() *dummy.Stats {
+	return s.server.Stats()
+}
+
+// Report returns the statistics report for the given window, the same that is returned by the '/stats' endpoint.
+func (s *Server) Report(window time.Duration) *dummy.StatsReport {
+	return s.server.Stats().Report(window)
+}
@@ -0,0 +1,50 @@
+package dummytest
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServerServesData(t *testing.T) {
+	server := NewServer(t, WithHeaders(http.Header{
+		"X-Test": {"yes"},
+	}))
+	response, err := server.Client().Get(server.URL() + "/?size=1000")
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, response.StatusCode)
+	}
+	if response.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, but got %s", response.Proto)
+	}
+	if len(body) != 1000 {
+		t.Errorf("expected 1000 bytes, but got %d", len(body))
+	}
+	if value := response.Header.Get("X-Test"); value != "yes" {
+		t.Errorf("expected extra header with value 'yes', but got '%s'", value)
+	}
+	if response.TLS == nil || !response.TLS.PeerCertificates[0].Equal(server.Certificate()) {
+		t.Errorf("expected the certificate of the server")
+	}
+	report := server.Report(time.Minute)
+	if report.BytesServed < 1000 {
+		t.Errorf("expected at least 1000 bytes served, but got %d", report.BytesServed)
+	}
+}
+
+func TestServersHaveDifferentCertificates(t *testing.T) {
+	first := NewServer(t)
+	second := NewServer(t)
+	if first.Certificate().Equal(second.Certificate()) {
+		t.Errorf("expected different certificates")
+	}
+}
@@ -0,0 +1,24 @@
+package dummy
+
+import (
+	"time"
+)
+
+// Duration is a time duration that is represented in text documents, like JSON, using the format supported by the
+// time.ParseDuration function, for example '1m30s'.
+type Duration time.Duration
+
+// MarshalText is the implementation of the encoding.TextMarshaler interface.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText is the implementation of the encoding.TextUnmarshaler interface.
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
@@ -0,0 +1,123 @@
+package dummy
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults for the events endpoint:
+const (
+	defaultEventRate = 1.0
+	defaultEventSize = 16
+)
+
+// EventsHandler is an HTTP handler that sends server sent events. The 'rate' query parameter is the number of
+// events per second, the 'size' query parameter is the size of the payload of each event, and the 'count' query
+// parameter is the number of events to send. When the count is zero, the default, events are sent till the client
+// disconnects. Each event is flushed as soon as it is written, so that it can be used to check that the proxies and
+// load balancers in the path don't buffer streaming responses.
+type EventsHandler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get the parameters:
+	query, deprecated := resolveParamAliases(r.URL.Query())
+	setDeprecationWarnings(w.Header(), deprecated)
+	rate := defaultEventRate
+	text := query.Get("rate")
+	if text != "" {
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || value <= 0 {
+			http.Error(w, fmt.Sprintf("rate '%s' should be a positive number", text), http.StatusBadRequest)
+			return
+		}
+		rate = value
+	}
+	size, err := parseIntParam(query.Get("size"), defaultEventSize)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("size isn't valid: %v", err), http.StatusBadRequest)
+		return
+	}
+	count, err := parseIntParam(query.Get("count"), 0)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("count isn't valid: %v", err), http.StatusBadRequest)
+		return
+	}
+	h.logger.Info(
+		"Sending events",
+		slog.Float64("rate", rate),
+		slog.Int("size", size),
+		slog.Int("count", count),
+	)
+
+	// Send the headers:
+	h.identity.SetHeaders(w.Header())
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	err = controller.Flush()
+	if err != nil {
+		h.logger.Error(
+			"Failed to flush headers",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	// Send the events:
+	startTime := time.Now()
+	payload := bytes.Repeat([]byte("x"), size)
+	interval := time.Duration(float64(time.Second) / rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	sent := 0
+	for count == 0 || sent < count {
+		_, err = fmt.Fprintf(
+			w,
+			"id: %d\nevent: data\ndata: {\"seq\":%d,\"time\":\"%s\",\"payload\":\"%s\"}\n\n",
+			sent, sent, time.Now().UTC().Format(time.RFC3339Nano), payload,
+		)
+		if err == nil {
+			err = controller.Flush()
+		}
+		if err != nil {
+			h.logger.Info(
+				"Stopped sending events",
+				slog.Int("sent", sent),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		sent++
+		if count != 0 && sent == count {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			h.logger.Info(
+				"Client disconnected",
+				slog.Int("sent", sent),
+			)
+			return
+		}
+	}
+
+	// Write a summary to the log:
+	h.logger.Info(
+		"Events sent",
+		slog.Int("count", sent),
+		slog.Int("size", size),
+		slog.String("elapsed", time.Since(startTime).String()),
+		h.identity.LogAttr(),
+	)
+}
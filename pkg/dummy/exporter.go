@@ -0,0 +1,247 @@
+package dummy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// Types of exporters:
+const (
+	ExporterTypeInfluxDB = "influxdb"
+	ExporterTypePostgres = "postgres"
+)
+
+// Defaults of the exporters:
+const (
+	DefaultExporterInterval = 10 * time.Second
+
+	// exporterBatch is the maximum number of results sent in one write.
+	exporterBatch = 1000
+)
+
+// ResultRecorder receives the results of the transfers completed by the server and of the background probes, for
+// example to store them.
+type ResultRecorder interface {
+	RecordTransfer(endpoint string, bytes int64, elapsed time.Duration)
+	RecordProbe(name string, result *ClientResult)
+}
+
+// ExporterConfig describes a destination where the results of the transfers and of the probes are pushed
+// periodically, so that they can be graphed centrally. For example:
+//
+//	{
+//	  "type": "influxdb",
+//	  "url": "http://influxdb:8086/api/v2/write?org=perf&bucket=dummy",
+//	  "token": "..."
+//	}
+type ExporterConfig struct {
+	// Name identifies the exporter in the log. The default is the type.
+	Name string `json:"name,omitempty"`
+
+	// Type is 'influxdb', for the line protocol of InfluxDB, or 'postgres', for a PostgreSQL or TimescaleDB table.
+	Type string `json:"type"`
+
+	// URL is the address of the destination. For InfluxDB it is the URL of the write endpoint, including the query
+	// parameters that select the database or the bucket. For PostgreSQL it is the connection string.
+	URL string `json:"url"`
+
+	// Token is the authentication token of InfluxDB. It is ignored for PostgreSQL, where the credentials are part of
+	// the connection string.
+	Token string `json:"token,omitempty"`
+
+	// Interval is the time between pushes. The default is ten seconds.
+	Interval Duration `json:"interval,omitempty"`
+
+	// Insecure disables the verification of the TLS certificate of InfluxDB.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// validate checks that the exporter is valid, and sets the default name.
+func (c *ExporterConfig) validate() error {
+	if c.Name == "" {
+		c.Name = c.Type
+	}
+	switch c.Type {
+	case ExporterTypeInfluxDB:
+		address, err := url.Parse(c.URL)
+		if err != nil {
+			return fmt.Errorf("URL of exporter '%s' isn't valid: %w", c.Name, err)
+		}
+		if address.Scheme != "http" && address.Scheme != "https" {
+			return fmt.Errorf("scheme of the URL of exporter '%s' should be 'http' or 'https'", c.Name)
+		}
+	case ExporterTypePostgres:
+		if c.URL == "" {
+			return fmt.Errorf("URL of exporter '%s' is mandatory", c.Name)
+		}
+	default:
+		return fmt.Errorf(
+			"type of exporter '%s' should be '%s' or '%s', but it is '%s'",
+			c.Name, ExporterTypeInfluxDB, ExporterTypePostgres, c.Type,
+		)
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("interval of exporter '%s' is negative", c.Name)
+	}
+	return nil
+}
+
+// exportWriter is implemented by the destinations of the exporters. The results are HistoryTransfer and HistoryProbe
+// values.
+type exportWriter interface {
+	write(ctx context.Context, batch []any) error
+	close() error
+}
+
+// Exporter collects the results of the transfers and of the probes, and pushes them periodically to a destination.
+// When the destination isn't available the results are discarded, so that memory doesn't grow without limit.
+type Exporter struct {
+	logger   *slog.Logger
+	name     string
+	interval time.Duration
+	writer   exportWriter
+	queue    chan any
+	done     chan struct{}
+}
+
+// NewExporter creates the exporter described by the given configuration, and starts pushing results till the context
+// is cancelled. The identity is added to the results, so that the ones of different servers can be distinguished.
+func NewExporter(ctx context.Context, logger *slog.Logger, identity Identity,
+	config ExporterConfig) (result *Exporter, err error) {
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	interval := time.Duration(config.Interval)
+	if interval == 0 {
+		interval = DefaultExporterInterval
+	}
+	var writer exportWriter
+	switch config.Type {
+	case ExporterTypeInfluxDB:
+		writer = newInfluxWriter(identity, config)
+	case ExporterTypePostgres:
+		writer, err = newPostgresWriter(ctx, identity, config)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to create exporter '%s': %w", config.Name, err)
+		return
+	}
+	exporter := &Exporter{
+		logger:   logger.With(slog.String("exporter", config.Name)),
+		name:     config.Name,
+		interval: interval,
+		writer:   writer,
+		queue:    make(chan any, historyQueue),
+		done:     make(chan struct{}),
+	}
+	go exporter.run(ctx)
+	logger.Info(
+		"Exporting results",
+		slog.String("name", config.Name),
+		slog.String("type", config.Type),
+		slog.String("interval", interval.String()),
+	)
+	result = exporter
+	return
+}
+
+// RecordTransfer queues a completed transfer for pushing.
+func (e *Exporter) RecordTransfer(endpoint string, bytes int64, elapsed time.Duration) {
+	throughput := 0.0
+	if elapsed > 0 {
+		throughput = float64(bytes) / elapsed.Seconds()
+	}
+	e.enqueue(HistoryTransfer{
+		Time:       time.Now().UTC(),
+		Endpoint:   endpoint,
+		Bytes:      bytes,
+		Elapsed:    Duration(elapsed),
+		Throughput: throughput,
+	})
+}
+
+// RecordProbe queues the result of a probe for pushing.
+func (e *Exporter) RecordProbe(name string, result *ClientResult) {
+	e.enqueue(HistoryProbe{
+		Time:       result.Start,
+		Probe:      name,
+		URL:        result.URL,
+		Status:     result.Status,
+		Bytes:      result.Bytes,
+		Elapsed:    result.Elapsed,
+		Throughput: result.Throughput,
+		Error:      result.Error,
+	})
+}
+
+// enqueue adds the result to the queue, or discards it if the queue is full.
+func (e *Exporter) enqueue(record any) {
+	select {
+	case e.queue <- record:
+	default:
+	}
+}
+
+// run pushes the queued results periodically. Before stopping it pushes the results that are still queued.
+func (e *Exporter) run(ctx context.Context) {
+	defer close(e.done)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.flush(ctx)
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), e.interval)
+			e.flush(flushCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+// flush pushes the queued results, in batches.
+func (e *Exporter) flush(ctx context.Context) {
+	for {
+		batch := make([]any, 0, exporterBatch)
+	loop:
+		for len(batch) < exporterBatch {
+			select {
+			case record := <-e.queue:
+				batch = append(batch, record)
+			default:
+				break loop
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		err := e.writer.write(ctx, batch)
+		if err != nil {
+			e.logger.Error(
+				"Failed to export results",
+				slog.Int("records", len(batch)),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		e.logger.Debug(
+			"Exported results",
+			slog.Int("records", len(batch)),
+		)
+		if len(batch) < exporterBatch {
+			return
+		}
+	}
+}
+
+// Close waits till the pending results are pushed, which happens when the context is cancelled, and releases the
+// resources of the destination.
+func (e *Exporter) Close() error {
+	<-e.done
+	return e.writer.close()
+}
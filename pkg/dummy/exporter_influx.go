@@ -0,0 +1,139 @@
+package dummy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the InfluxDB measurements:
+const (
+	influxTransferMeasurement = "dummy_transfer"
+	influxProbeMeasurement    = "dummy_probe"
+)
+
+// influxWriter writes results to InfluxDB using the line protocol. It works with the write endpoints of versions 1 and
+// 2, as the database or bucket is selected with the query parameters of the URL.
+type influxWriter struct {
+	address   string
+	token     string
+	instance  string
+	namespace string
+	client    *http.Client
+}
+
+// newInfluxWriter creates the writer. The precision of the timestamps is always nanoseconds.
+func newInfluxWriter(identity Identity, config ExporterConfig) *influxWriter {
+	address, _ := url.Parse(config.URL)
+	query := address.Query()
+	query.Set("precision", "ns")
+	address.RawQuery = query.Encode()
+	return &influxWriter{
+		address:   address.String(),
+		token:     config.Token,
+		instance:  identity.Instance,
+		namespace: identity.Namespace,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: config.Insecure,
+				},
+			},
+			Timeout: webhookTimeout,
+		},
+	}
+}
+
+func (w *influxWriter) write(ctx context.Context, batch []any) error {
+	buffer := &bytes.Buffer{}
+	for _, record := range batch {
+		switch record := record.(type) {
+		case HistoryTransfer:
+			w.writeTags(buffer, influxTransferMeasurement, "endpoint", record.Endpoint)
+			fmt.Fprintf(
+				buffer, " bytes=%di,elapsed=%s,throughput=%s %d\n",
+				record.Bytes,
+				influxFloat(time.Duration(record.Elapsed).Seconds()),
+				influxFloat(record.Throughput),
+				record.Time.UnixNano(),
+			)
+		case HistoryProbe:
+			w.writeTags(buffer, influxProbeMeasurement, "probe", record.Probe)
+			fmt.Fprintf(
+				buffer, " url=%s,status=%di,bytes=%di,elapsed=%s,throughput=%s,success=%t",
+				influxString(record.URL),
+				record.Status,
+				record.Bytes,
+				influxFloat(time.Duration(record.Elapsed).Seconds()),
+				influxFloat(record.Throughput),
+				record.Error == "",
+			)
+			if record.Error != "" {
+				fmt.Fprintf(buffer, ",error=%s", influxString(record.Error))
+			}
+			fmt.Fprintf(buffer, " %d\n", record.Time.UnixNano())
+		}
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.address, buffer)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		request.Header.Set("Authorization", "Token "+w.token)
+	}
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("unexpected status %d: %s", response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// writeTags writes the measurement and the tags of a line. The instance and namespace tags are only added when they
+// aren't empty, as InfluxDB rejects empty tag values.
+func (w *influxWriter) writeTags(buffer *bytes.Buffer, measurement, key, value string) {
+	buffer.WriteString(measurement)
+	for _, tag := range [][2]string{{"instance", w.instance}, {"namespace", w.namespace}, {key, value}} {
+		if tag[1] == "" {
+			continue
+		}
+		buffer.WriteString(",")
+		buffer.WriteString(tag[0])
+		buffer.WriteString("=")
+		buffer.WriteString(influxTagReplacer.Replace(tag[1]))
+	}
+}
+
+func (w *influxWriter) close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// influxTagReplacer escapes the characters that have a special meaning in tag values.
+var influxTagReplacer = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+// influxStringReplacer escapes the characters that have a special meaning in string field values.
+var influxStringReplacer = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`)
+
+// influxString formats a string field value.
+func influxString(value string) string {
+	return `"` + influxStringReplacer.Replace(value) + `"`
+}
+
+// influxFloat formats a float field value.
+func influxFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,121 @@
+package dummy
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	// PostgreSQL driver:
+	_ "github.com/lib/pq"
+)
+
+// postgresSchema creates the tables. When the TimescaleDB extension is available they are converted to hypertables.
+const postgresSchema = `
+create table if not exists dummy_transfers (
+	time timestamptz not null,
+	instance text not null,
+	namespace text not null,
+	endpoint text not null,
+	bytes bigint not null,
+	elapsed double precision not null,
+	throughput double precision not null
+);
+create table if not exists dummy_probes (
+	time timestamptz not null,
+	instance text not null,
+	namespace text not null,
+	probe text not null,
+	url text not null,
+	status integer not null,
+	bytes bigint not null,
+	elapsed double precision not null,
+	throughput double precision not null,
+	error text not null
+);
+`
+
+// postgresHypertables converts the tables to TimescaleDB hypertables.
+const postgresHypertables = `
+select create_hypertable('dummy_transfers', 'time', if_not_exists => true);
+select create_hypertable('dummy_probes', 'time', if_not_exists => true);
+`
+
+// postgresWriter writes results to PostgreSQL or TimescaleDB tables.
+type postgresWriter struct {
+	instance  string
+	namespace string
+	db        *sql.DB
+}
+
+// newPostgresWriter connects to the database and creates the tables if they don't exist.
+func newPostgresWriter(ctx context.Context, identity Identity, config ExporterConfig) (result *postgresWriter,
+	err error) {
+	db, err := sql.Open("postgres", config.URL)
+	if err != nil {
+		return
+	}
+	_, err = db.ExecContext(ctx, postgresSchema)
+	if err != nil {
+		db.Close()
+		return
+	}
+	var timescale bool
+	err = db.QueryRowContext(
+		ctx,
+		`select exists (select 1 from pg_extension where extname = 'timescaledb')`,
+	).Scan(&timescale)
+	if err != nil {
+		db.Close()
+		return
+	}
+	if timescale {
+		_, err = db.ExecContext(ctx, postgresHypertables)
+		if err != nil {
+			db.Close()
+			return
+		}
+	}
+	result = &postgresWriter{
+		instance:  identity.Instance,
+		namespace: identity.Namespace,
+		db:        db,
+	}
+	return
+}
+
+func (w *postgresWriter) write(ctx context.Context, batch []any) error {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, record := range batch {
+		switch record := record.(type) {
+		case HistoryTransfer:
+			_, err = tx.ExecContext(
+				ctx,
+				`insert into dummy_transfers (time, instance, namespace, endpoint, bytes, elapsed, throughput) `+
+					`values ($1, $2, $3, $4, $5, $6, $7)`,
+				record.Time, w.instance, w.namespace, record.Endpoint, record.Bytes,
+				time.Duration(record.Elapsed).Seconds(), record.Throughput,
+			)
+		case HistoryProbe:
+			_, err = tx.ExecContext(
+				ctx,
+				`insert into dummy_probes `+
+					`(time, instance, namespace, probe, url, status, bytes, elapsed, throughput, error) `+
+					`values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+				record.Time, w.instance, w.namespace, record.Probe, record.URL, record.Status, record.Bytes,
+				time.Duration(record.Elapsed).Seconds(), record.Throughput, record.Error,
+			)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (w *postgresWriter) close() error {
+	return w.db.Close()
+}
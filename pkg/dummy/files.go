@@ -0,0 +1,63 @@
+package dummy
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Prefix of the paths served from the files directory.
+const FilesPrefix = "/files/"
+
+// FilesHandler is an HTTP handler that serves the real files of a directory, so that the throughput of disk backed
+// responses can be compared with the throughput of synthetic data through the same stack. Range requests and
+// conditional requests are supported, and the entity tag is calculated from the size and modification time of the
+// file.
+type FilesHandler struct {
+	logger   *slog.Logger
+	identity Identity
+	root     string
+	server   http.Handler
+}
+
+// NewFilesHandler creates a handler that serves the files of the given directory.
+func NewFilesHandler(logger *slog.Logger, identity Identity, root string) (result *FilesHandler, err error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return
+	}
+	if !info.IsDir() {
+		err = fmt.Errorf("'%s' isn't a directory", root)
+		return
+	}
+	result = &FilesHandler{
+		logger:   logger,
+		identity: identity,
+		root:     root,
+		server:   http.StripPrefix(strings.TrimSuffix(FilesPrefix, "/"), http.FileServer(http.Dir(root))),
+	}
+	return
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *FilesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+
+	// The file server doesn't generate entity tags, but it uses them for conditional and range requests if they are
+	// already in the response headers:
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, FilesPrefix))
+	info, err := os.Stat(filepath.Join(h.root, filepath.FromSlash(name)))
+	if err == nil && info.Mode().IsRegular() {
+		w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	}
+	h.logger.Debug(
+		"Serving file",
+		slog.String("name", name),
+		slog.String("range", r.Header.Get("Range")),
+	)
+	h.server.ServeHTTP(w, r)
+}
@@ -0,0 +1,512 @@
+package dummy
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Path of the endpoint where the servers of a fleet register, and where clients discover them.
+const FleetPath = "/fleet"
+
+// Defaults of the coordination of a fleet of servers:
+const (
+	DefaultFleetInterval = 10 * time.Second
+
+	// fleetExpiration is the number of announcement intervals after which a member that hasn't been refreshed is
+	// removed.
+	fleetExpiration = 3
+
+	// fleetMaxBody is the maximum size of the documents exchanged by the members of the fleet.
+	fleetMaxBody = 1 << 20
+
+	// maxFleetMembers is the maximum number of other members that a server remembers.
+	maxFleetMembers = 1000
+)
+
+// Name of the environment variable that contains the address of the pod, usually populated using the downward API.
+const podIPEnv = "POD_IP"
+
+// FleetTokenEnv is the environment variable that contains the default token of the fleet.
+const FleetTokenEnv = "DUMMY_FLEET_TOKEN"
+
+// FleetConfig contains the settings of the coordination of a fleet of servers. There is no leader: each server
+// periodically announces itself to the peers that it knows, and merges the members that they know in return, so
+// that all the members eventually know each other and clients can discover the complete fleet asking any of them.
+// For example:
+//
+//	{
+//	  "advertise": "https://10.0.0.1:8443",
+//	  "dns": "dummy.my-ns.svc.cluster.local",
+//	  "interval": "10s",
+//	  "insecure": true,
+//	  "token": "..."
+//	}
+type FleetConfig struct {
+	// Advertise is the base URL where the other members and the clients can reach this server. The default is
+	// built with the address from the 'POD_IP' environment variable, or the host name, and the port of the first
+	// TCP listener.
+	Advertise string `json:"advertise,omitempty"`
+
+	// Peers are the base URLs of other servers that this server announces itself to.
+	Peers []string `json:"peers,omitempty"`
+
+	// DNS is a host name, usually the one of a headless service, whose addresses are the ones of other servers.
+	// They are contacted with the scheme and port of the advertised URL.
+	DNS string `json:"dns,omitempty"`
+
+	// Interval is the time between announcements. Members that haven't been refreshed in three intervals are
+	// removed. The default is ten seconds.
+	Interval Duration `json:"interval,omitempty"`
+
+	// Insecure disables the verification of the TLS certificates of the peers.
+	Insecure bool `json:"insecure,omitempty"`
+
+	// Token is the secret shared by the members of the fleet. They send it as a bearer token when they announce
+	// themselves, and announcements without it are rejected. When it is empty the server doesn't accept
+	// announcements at all. It is mandatory when there are peers or a DNS name.
+	Token string `json:"token,omitempty"`
+
+	// Mesh contains the settings of the periodic measurements of the latency and throughput to the other members.
+	// When empty there are no measurements.
+	Mesh *MeshConfig `json:"mesh,omitempty"`
+}
+
+// validate checks that the fleet settings are valid.
+func (c *FleetConfig) validate() error {
+	if c.Advertise != "" {
+		err := checkFleetURL(c.Advertise)
+		if err != nil {
+			return fmt.Errorf("advertised URL isn't valid: %w", err)
+		}
+	}
+	for _, peer := range c.Peers {
+		err := checkFleetURL(peer)
+		if err != nil {
+			return fmt.Errorf("peer URL isn't valid: %w", err)
+		}
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("fleet interval %s is negative", time.Duration(c.Interval))
+	}
+	if c.enabled() && c.Token == "" {
+		return fmt.Errorf("fleet token is mandatory when there are peers or a DNS name")
+	}
+	if c.Mesh != nil {
+		err := c.Mesh.validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enabled checks if the server should announce itself to other servers.
+func (c *FleetConfig) enabled() bool {
+	return c != nil && (len(c.Peers) > 0 || c.DNS != "")
+}
+
+// accepting checks if the server accepts the announcements of other servers.
+func (c *FleetConfig) accepting() bool {
+	return c != nil && c.Token != ""
+}
+
+// checkFleetURL checks that the given text is the absolute HTTP or HTTPS URL of a server.
+func checkFleetURL(text string) error {
+	address, err := url.Parse(text)
+	if err != nil {
+		return err
+	}
+	if address.Scheme != "http" && address.Scheme != "https" {
+		return fmt.Errorf("scheme of URL '%s' should be 'http' or 'https'", text)
+	}
+	if address.Host == "" {
+		return fmt.Errorf("URL '%s' doesn't contain a host", text)
+	}
+	return nil
+}
+
+// FleetMember describes one of the servers of a fleet. LastSeen is the last time that the member announced itself,
+// either directly or through other members.
+type FleetMember struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Namespace string    `json:"namespace,omitempty"`
+	Node      string    `json:"node,omitempty"`
+	Zone      string    `json:"zone,omitempty"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// FleetReport is the document returned by the fleet endpoint, with the members sorted by identifier.
+type FleetReport struct {
+	Members []FleetMember `json:"members"`
+}
+
+// Fleet keeps the members of the fleet known by this server. It serves the fleet endpoint, where other servers
+// announce themselves with POST requests that contain the token of the fleet, and clients get the members with GET
+// requests. No more than one thousand other members are remembered, and those that haven't been refreshed recently are
+// removed when the members are read, even if this server doesn't announce itself.
+type Fleet struct {
+	logger   *slog.Logger
+	self     FleetMember
+	peers    []string
+	dns      string
+	interval time.Duration
+	insecure bool
+	token    string
+	client   *http.Client
+	lock     sync.Mutex
+	members  map[string]*FleetMember
+}
+
+// NewFleet creates the fleet of the server with the given identity and listeners. The configuration can be nil, and
+// then the server doesn't announce itself, and it doesn't accept the announcements of other servers. With only the
+// token other servers can still use it as a peer.
+func NewFleet(logger *slog.Logger, identity Identity, listeners []ListenerConfig,
+	config *FleetConfig) (result *Fleet, err error) {
+	if config == nil {
+		config = &FleetConfig{}
+	}
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	interval := time.Duration(config.Interval)
+	if interval == 0 {
+		interval = DefaultFleetInterval
+	}
+	advertise := config.Advertise
+	if advertise == "" && config.enabled() {
+		advertise, err = defaultFleetAdvertise(listeners)
+		if err != nil {
+			return
+		}
+	}
+	result = &Fleet{
+		logger: logger,
+		self: FleetMember{
+			ID:        identity.Instance,
+			URL:       strings.TrimRight(advertise, "/"),
+			Namespace: identity.Namespace,
+			Node:      identity.Node,
+			Zone:      identity.Zone,
+		},
+		peers:    config.Peers,
+		dns:      config.DNS,
+		interval: interval,
+		insecure: config.Insecure,
+		token:    config.Token,
+		client: &http.Client{
+			Timeout: interval,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: config.Insecure,
+				},
+			},
+		},
+		members: map[string]*FleetMember{},
+	}
+	if config.enabled() {
+		logger.Info(
+			"Joining fleet",
+			slog.String("id", result.self.ID),
+			slog.String("advertise", result.self.URL),
+			slog.Any("peers", result.peers),
+			slog.String("dns", result.dns),
+			slog.String("interval", interval.String()),
+		)
+	}
+	return
+}
+
+// defaultFleetAdvertise builds the advertised URL from the address of the pod, or the host name, and the port of the
+// first TCP listener.
+func defaultFleetAdvertise(listeners []ListenerConfig) (result string, err error) {
+	host := os.Getenv(podIPEnv)
+	if host == "" {
+		host, err = os.Hostname()
+		if err != nil {
+			return
+		}
+	}
+	for _, listener := range listeners {
+		if listener.Network != "" && listener.Network != "tcp" {
+			continue
+		}
+		var port string
+		_, port, err = net.SplitHostPort(listener.Address)
+		if err != nil {
+			return
+		}
+		scheme := "http"
+		if listener.TLS != nil {
+			scheme = "https"
+		}
+		result = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+		return
+	}
+	err = fmt.Errorf("there is no TCP listener to build the advertised URL, it needs to be configured explicitly")
+	return
+}
+
+// Start starts announcing this server to its peers periodically, till the context is cancelled. It does nothing if
+// there are no peers.
+func (f *Fleet) Start(ctx context.Context) {
+	if f.dns == "" && len(f.peers) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for {
+			f.announce(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// announce sends the description of this server to all the known peers, and merges the members that they return.
+func (f *Fleet) announce(ctx context.Context) {
+	self := f.self
+	self.LastSeen = time.Now().UTC()
+	body, err := json.Marshal(&self)
+	if err != nil {
+		return
+	}
+	var wait sync.WaitGroup
+	for _, peer := range f.targets(ctx) {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			report, err := f.send(ctx, peer, body)
+			if err != nil {
+				f.logger.Debug(
+					"Failed to announce to fleet peer",
+					slog.String("peer", peer),
+					slog.String("error", err.Error()),
+				)
+				return
+			}
+			for _, member := range report.Members {
+				f.merge(member)
+			}
+		}()
+	}
+	wait.Wait()
+	f.expire()
+}
+
+// targets returns the URLs of the peers that this server announces itself to: the configured ones, the ones
+// resolved from the DNS name, and the members already known.
+func (f *Fleet) targets(ctx context.Context) []string {
+	targets := slices.Clone(f.peers)
+	if f.dns != "" {
+		addresses, err := net.DefaultResolver.LookupHost(ctx, f.dns)
+		if err != nil {
+			f.logger.Debug(
+				"Failed to resolve fleet peers",
+				slog.String("dns", f.dns),
+				slog.String("error", err.Error()),
+			)
+		}
+		advertise, _ := url.Parse(f.self.URL)
+		for _, address := range addresses {
+			peer := *advertise
+			peer.Host = net.JoinHostPort(address, advertise.Port())
+			targets = append(targets, peer.String())
+		}
+	}
+	f.lock.Lock()
+	for _, member := range f.members {
+		targets = append(targets, member.URL)
+	}
+	f.lock.Unlock()
+	for i, target := range targets {
+		targets[i] = strings.TrimRight(target, "/")
+	}
+	slices.Sort(targets)
+	targets = slices.Compact(targets)
+	return slices.DeleteFunc(targets, func(target string) bool {
+		return target == f.self.URL
+	})
+}
+
+// send sends the description of this server to the given peer, and returns the members that it knows.
+func (f *Fleet) send(ctx context.Context, peer string, body []byte) (result *FleetReport, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+FleetPath, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+f.token)
+	response, err := f.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %d", response.StatusCode)
+		return
+	}
+	report := &FleetReport{}
+	err = json.NewDecoder(io.LimitReader(response.Body, fleetMaxBody)).Decode(report)
+	if err != nil {
+		return
+	}
+	result = report
+	return
+}
+
+// merge adds the given member to the fleet, or updates it if the given description is more recent than the known
+// one. New members are ignored when the maximum number of members is reached.
+func (f *Fleet) merge(member FleetMember) {
+	if member.ID == "" || member.ID == f.self.ID || member.URL == "" {
+		return
+	}
+	if time.Since(member.LastSeen) > fleetExpiration*f.interval {
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	known := f.members[member.ID]
+	if known != nil && !member.LastSeen.After(known.LastSeen) {
+		return
+	}
+	if known == nil && len(f.members) >= maxFleetMembers {
+		f.expireLocked()
+		if len(f.members) >= maxFleetMembers {
+			f.logger.Warn(
+				"Ignored fleet member because the fleet is full",
+				slog.String("id", member.ID),
+				slog.String("url", member.URL),
+				slog.Int("max", maxFleetMembers),
+			)
+			return
+		}
+	}
+	f.members[member.ID] = &member
+	if known == nil {
+		f.logger.Info(
+			"Added fleet member",
+			slog.String("id", member.ID),
+			slog.String("url", member.URL),
+		)
+	}
+}
+
+// expire removes the members that haven't been refreshed recently.
+func (f *Fleet) expire() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.expireLocked()
+}
+
+// expireLocked removes the members that haven't been refreshed recently. It must be called with the lock held.
+func (f *Fleet) expireLocked() {
+	for id, member := range f.members {
+		if time.Since(member.LastSeen) > fleetExpiration*f.interval {
+			delete(f.members, id)
+			f.logger.Info(
+				"Removed fleet member",
+				slog.String("id", member.ID),
+				slog.String("url", member.URL),
+			)
+		}
+	}
+}
+
+// others returns the other members of the fleet, sorted by identifier, after removing the ones that haven't been
+// refreshed recently.
+func (f *Fleet) others() []FleetMember {
+	f.lock.Lock()
+	f.expireLocked()
+	result := make([]FleetMember, 0, len(f.members))
+	for _, member := range f.members {
+		result = append(result, *member)
+	}
+	f.lock.Unlock()
+	slices.SortFunc(result, func(a, b FleetMember) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return result
+}
+
+// Report returns the members of the fleet, including this server. When the advertised URL isn't known the URL of this
+// server is the one used to send the given request.
+func (f *Fleet) Report(r *http.Request) *FleetReport {
+	self := f.self
+	self.LastSeen = time.Now().UTC()
+	if self.URL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		self.URL = fmt.Sprintf("%s://%s", scheme, r.Host)
+	}
+	report := &FleetReport{
+		Members: append(f.others(), self),
+	}
+	slices.SortFunc(report.Members, func(a, b FleetMember) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return report
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (f *Fleet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		// Check the token. Note that the comparison takes constant time so that it doesn't reveal the token.
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if f.token == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(f.token)) != 1 {
+			f.logger.Warn(
+				"Rejected unauthenticated fleet announcement",
+				slog.String("remote", r.RemoteAddr),
+			)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "valid bearer token is required", http.StatusUnauthorized)
+			return
+		}
+		var member FleetMember
+		err := json.NewDecoder(io.LimitReader(r.Body, fleetMaxBody)).Decode(&member)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to decode member: %v", err), http.StatusBadRequest)
+			return
+		}
+		if member.ID == "" || checkFleetURL(member.URL) != nil {
+			http.Error(w, "member should have an identifier and a valid URL", http.StatusBadRequest)
+			return
+		}
+
+		// The member is talking to us directly, so it is alive now, regardless of the clock of its host:
+		member.LastSeen = time.Now().UTC()
+		f.merge(member)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(f.Report(r))
+	if err != nil {
+		f.logger.Error(
+			"Failed to send fleet",
+			slog.String("error", err.Error()),
+		)
+	}
+}
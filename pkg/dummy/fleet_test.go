@@ -0,0 +1,172 @@
+package dummy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestFleet creates a fleet that accepts announcements with the given token.
+func newTestFleet(t *testing.T, token string) *Fleet {
+	t.Helper()
+	var config *FleetConfig
+	if token != "" {
+		config = &FleetConfig{
+			Token: token,
+		}
+	}
+	fleet, err := NewFleet(slog.New(slog.NewTextHandler(io.Discard, nil)), Identity{Instance: "self"}, nil, config)
+	if err != nil {
+		t.Fatalf("failed to create fleet: %v", err)
+	}
+	return fleet
+}
+
+// announceMember sends an announcement of a member with the given identifier to the fleet, and returns the status.
+func announceMember(t *testing.T, fleet *Fleet, id, token string) int {
+	t.Helper()
+	body, err := json.Marshal(&FleetMember{
+		ID:  id,
+		URL: "https://" + id + ".example.com",
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal member: %v", err)
+	}
+	request := httptest.NewRequest(http.MethodPost, FleetPath, bytes.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	fleet.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func TestFleetConfigValidate(t *testing.T) {
+	config := &FleetConfig{
+		Peers: []string{"https://peer.example.com"},
+	}
+	err := config.validate()
+	if err == nil {
+		t.Fatalf("expected an error for peers without token")
+	}
+	config.Token = "secret"
+	err = config.validate()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFleetAnnouncementRequiresToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted string
+		sent     string
+		status   int
+	}{
+		{
+			name:   "No fleet",
+			sent:   "secret",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:     "Missing token",
+			accepted: "secret",
+			status:   http.StatusUnauthorized,
+		},
+		{
+			name:     "Wrong token",
+			accepted: "secret",
+			sent:     "wrong",
+			status:   http.StatusUnauthorized,
+		},
+		{
+			name:     "Right token",
+			accepted: "secret",
+			sent:     "secret",
+			status:   http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fleet := newTestFleet(t, test.accepted)
+			status := announceMember(t, fleet, "member", test.sent)
+			if status != test.status {
+				t.Fatalf("expected status %d, but got %d", test.status, status)
+			}
+			members := len(fleet.others())
+			if test.status == http.StatusOK && members != 1 {
+				t.Errorf("expected one member, but got %d", members)
+			}
+			if test.status != http.StatusOK && members != 0 {
+				t.Errorf("expected no members, but got %d", members)
+			}
+		})
+	}
+}
+
+func TestFleetMembersAreBounded(t *testing.T) {
+	fleet := newTestFleet(t, "secret")
+	for i := 0; i < maxFleetMembers+10; i++ {
+		fleet.merge(FleetMember{
+			ID:       fmt.Sprintf("member-%d", i),
+			URL:      fmt.Sprintf("https://member-%d.example.com", i),
+			LastSeen: time.Now(),
+		})
+	}
+	members := len(fleet.others())
+	if members != maxFleetMembers {
+		t.Errorf("expected %d members, but got %d", maxFleetMembers, members)
+	}
+}
+
+func TestFleetMembersExpireWhenRead(t *testing.T) {
+	fleet := newTestFleet(t, "secret")
+	fleet.merge(FleetMember{
+		ID:       "member",
+		URL:      "https://member.example.com",
+		LastSeen: time.Now(),
+	})
+	fleet.lock.Lock()
+	fleet.members["member"].LastSeen = time.Now().Add(-fleetExpiration*fleet.interval - time.Second)
+	fleet.lock.Unlock()
+	members := len(fleet.others())
+	if members != 0 {
+		t.Errorf("expected the member to expire, but there are %d members", members)
+	}
+}
+
+func TestServerFleetAnnouncementsDisabled(t *testing.T) {
+	server := startTestServer(t, Options{})
+	body, err := json.Marshal(&FleetMember{
+		ID:  "member",
+		URL: "https://member.example.com",
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal member: %v", err)
+	}
+	response, err := http.Post(server.URL+FleetPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	response.Body.Close()
+
+	// The announcement shouldn't reach the fleet, so it should contain only the server itself:
+	response, data := getBody(t, server.URL+FleetPath, nil)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, response.StatusCode)
+	}
+	report := &FleetReport{}
+	err = json.Unmarshal(data, report)
+	if err != nil {
+		t.Fatalf("failed to parse fleet: %v", err)
+	}
+	if len(report.Members) != 1 {
+		t.Errorf("expected only the server itself, but got %d members", len(report.Members))
+	}
+}
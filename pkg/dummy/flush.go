@@ -0,0 +1,70 @@
+package dummy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Values of the 'flush' query parameter that aren't a number of writes:
+const (
+	flushEvery = "every"
+	flushEnd   = "end"
+)
+
+// parseFlushInterval gets the number of writes between flushes from the value of the 'flush' query parameter, which
+// can be 'every' to flush after each write, a number of writes, or 'end' to flush only when the response ends. The
+// result is zero in the last case, which is also the default.
+func parseFlushInterval(text string) (result int, err error) {
+	switch text {
+	case "", flushEnd:
+	case flushEvery:
+		result = 1
+	default:
+		result, err = strconv.Atoi(text)
+		if err != nil || result <= 0 {
+			err = fmt.Errorf(
+				"flush '%s' should be '%s', '%s' or a positive number of writes",
+				text, flushEvery, flushEnd,
+			)
+		}
+	}
+	return
+}
+
+// responseFlusher flushes the response every given number of writes, so that the effect of the flush granularity on
+// latency and throughput can be studied. When the data is compressed the encoder is flushed first, otherwise the
+// compressed data would stay in its buffers. A nil flusher, or one with a zero interval, never flushes, and then the
+// response is flushed when the buffers of the server are full and when it ends.
+type responseFlusher struct {
+	response http.ResponseWriter
+	encoder  io.Writer
+	interval int
+	writes   int
+	flushes  int64
+}
+
+// wrote records a write, and flushes the response if the interval has been reached.
+func (f *responseFlusher) wrote() error {
+	if f == nil || f.interval == 0 {
+		return nil
+	}
+	f.writes++
+	if f.writes%f.interval != 0 {
+		return nil
+	}
+	flusher, ok := f.encoder.(interface{ Flush() error })
+	if ok {
+		err := flusher.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	err := http.NewResponseController(f.response).Flush()
+	if err != nil {
+		return err
+	}
+	f.flushes++
+	return nil
+}
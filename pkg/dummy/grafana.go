@@ -0,0 +1,319 @@
+package dummy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Prefix of the endpoints that implement the API of the Grafana JSON data source plugin. The URL of the data source
+// in Grafana is the URL of the server followed by this prefix.
+const GrafanaPrefix = "/grafana/"
+
+// Defaults of the Grafana data source:
+const (
+	defaultGrafanaInterval = time.Minute
+	defaultGrafanaPoints   = 1000
+
+	// grafanaMaxBody is the maximum size of the requests sent by Grafana.
+	grafanaMaxBody = 1 << 20
+)
+
+// grafanaFields are the aggregated values of the history that can be used in queries, and their descriptions.
+var grafanaFields = [][2]string{
+	{"throughput", "average throughput"},
+	{"min_throughput", "minimum throughput"},
+	{"max_throughput", "maximum throughput"},
+	{"count", "count"},
+	{"failures", "failures"},
+	{"bytes", "bytes"},
+}
+
+// GrafanaMetric is an element of the list of metrics returned to Grafana.
+type GrafanaMetric struct {
+	Label    string                 `json:"label"`
+	Value    string                 `json:"value"`
+	Payloads []GrafanaMetricPayload `json:"payloads,omitempty"`
+}
+
+// GrafanaMetricPayload describes a parameter of a metric that the user can select in the query editor of Grafana.
+type GrafanaMetricPayload struct {
+	Label string `json:"label"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+}
+
+// GrafanaOption is an element of the list of values of a parameter of a metric.
+type GrafanaOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// GrafanaQueryRequest is the body of the query request sent by Grafana.
+type GrafanaQueryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	IntervalMs    int64                `json:"intervalMs"`
+	MaxDataPoints int                  `json:"maxDataPoints"`
+	Targets       []GrafanaQueryTarget `json:"targets"`
+}
+
+// GrafanaQueryTarget is one of the queries of a query request. The target is the name of the metric, and the payload
+// contains the selected 'probe' or 'endpoint'.
+type GrafanaQueryTarget struct {
+	Target  string            `json:"target"`
+	RefID   string            `json:"refId"`
+	Hide    bool              `json:"hide"`
+	Payload map[string]string `json:"payload"`
+}
+
+// GrafanaTimeSeries is one of the results of a query. Each data point is a value followed by the time in
+// milliseconds since the epoch.
+type GrafanaTimeSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// GrafanaHandler implements the API of the Grafana JSON data source plugin on top of the recorded history, so that
+// dashboards can graph the results without an external time series database. The metrics are named after the kind of
+// results and the aggregated value, for example 'probes.throughput', and they are aggregated in buckets of the
+// interval requested by Grafana.
+type GrafanaHandler struct {
+	logger  *slog.Logger
+	history *History
+}
+
+// NewGrafanaHandler creates the Grafana data source for the given history.
+func NewGrafanaHandler(logger *slog.Logger, history *History) *GrafanaHandler {
+	return &GrafanaHandler{
+		logger:  logger,
+		history: history,
+	}
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *GrafanaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, GrafanaPrefix)
+	switch {
+	case path == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		// This is the request that Grafana sends to test the connection.
+		w.WriteHeader(http.StatusOK)
+	case path == "metrics" && r.Method == http.MethodPost:
+		h.sendJSON(w, h.metrics())
+	case path == "metric-payload-options" && r.Method == http.MethodPost:
+		h.serveOptions(w, r)
+	case path == "query" && r.Method == http.MethodPost:
+		h.serveQuery(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// metrics returns the list of metrics. The metrics of the probes can be filtered by probe, and the metrics of the
+// transfers by endpoint.
+func (h *GrafanaHandler) metrics() []GrafanaMetric {
+	var result []GrafanaMetric
+	kinds := [][3]string{
+		{HistoryKindTransfers, "Transfer", "endpoint"},
+		{HistoryKindProbes, "Probe", "probe"},
+	}
+	for _, kind := range kinds {
+		for _, field := range grafanaFields {
+			result = append(result, GrafanaMetric{
+				Label: fmt.Sprintf("%s %s", kind[1], field[1]),
+				Value: kind[0] + "." + field[0],
+				Payloads: []GrafanaMetricPayload{{
+					Label: "Filter",
+					Name:  kind[2],
+					Type:  "select",
+				}},
+			})
+		}
+	}
+	return result
+}
+
+// serveOptions returns the values of the 'probe' or 'endpoint' parameter, which are the ones recorded in the history.
+func (h *GrafanaHandler) serveOptions(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Metric string `json:"metric"`
+		Name   string `json:"name"`
+	}
+	err := json.NewDecoder(io.LimitReader(r.Body, grafanaMaxBody)).Decode(&request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+	table, _, _ := strings.Cut(request.Metric, ".")
+	var column string
+	switch {
+	case table == HistoryKindTransfers && request.Name == "endpoint":
+		column = "endpoint"
+	case table == HistoryKindProbes && request.Name == "probe":
+		column = "probe"
+	default:
+		h.sendJSON(w, []GrafanaOption{})
+		return
+	}
+	values, err := h.distinct(r.Context(), table, column)
+	if err != nil {
+		h.logger.Error(
+			"Failed to query history",
+			slog.String("error", err.Error()),
+		)
+		http.Error(w, "failed to query history", http.StatusInternalServerError)
+		return
+	}
+	options := []GrafanaOption{{Label: "All", Value: ""}}
+	for _, value := range values {
+		options = append(options, GrafanaOption{Label: value, Value: value})
+	}
+	h.sendJSON(w, options)
+}
+
+// distinct returns the sorted distinct values of a column of the history.
+func (h *GrafanaHandler) distinct(ctx context.Context, table, column string) (result []string, err error) {
+	rows, err := h.history.db.QueryContext(ctx, "select distinct "+column+" from "+table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value string
+		err = rows.Scan(&value)
+		if err != nil {
+			return
+		}
+		result = append(result, value)
+	}
+	err = rows.Err()
+	slices.Sort(result)
+	return
+}
+
+// serveQuery runs the queries of the request and returns a time series for each of them.
+func (h *GrafanaHandler) serveQuery(w http.ResponseWriter, r *http.Request) {
+	request := &GrafanaQueryRequest{}
+	err := json.NewDecoder(io.LimitReader(r.Body, grafanaMaxBody)).Decode(request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode query: %v", err), http.StatusBadRequest)
+		return
+	}
+	from, to := request.Range.From, request.Range.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+
+	// Use the interval requested by Grafana, but make it larger if needed to not exceed the maximum number of
+	// points:
+	points := request.MaxDataPoints
+	if points <= 0 {
+		points = defaultGrafanaPoints
+	}
+	step := time.Duration(request.IntervalMs) * time.Millisecond
+	if step <= 0 {
+		step = defaultGrafanaInterval
+	}
+	step = max(step, to.Sub(from)/time.Duration(points))
+
+	result := []GrafanaTimeSeries{}
+	for _, target := range request.Targets {
+		if target.Hide || target.Target == "" {
+			continue
+		}
+		var series GrafanaTimeSeries
+		series, err = h.query(r.Context(), target, from, to, step, points)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result = append(result, series)
+	}
+	h.sendJSON(w, result)
+}
+
+// query runs one query.
+func (h *GrafanaHandler) query(ctx context.Context, target GrafanaQueryTarget, from, to time.Time, step time.Duration,
+	points int) (result GrafanaTimeSeries, err error) {
+	table, field, _ := strings.Cut(target.Target, ".")
+	var column string
+	switch table {
+	case HistoryKindTransfers:
+		column = "endpoint"
+	case HistoryKindProbes:
+		column = "probe"
+	default:
+		err = fmt.Errorf("metric '%s' doesn't exist", target.Target)
+		return
+	}
+	if !slices.ContainsFunc(grafanaFields, func(item [2]string) bool { return item[0] == field }) {
+		err = fmt.Errorf("metric '%s' doesn't exist", target.Target)
+		return
+	}
+	where := "time >= ? and time <= ?"
+	args := []any{from.UnixNano(), to.UnixNano()}
+	name := target.Target
+	filter := target.Payload[column]
+	if filter != "" {
+		where += " and " + column + " = ?"
+		args = append(args, filter)
+		name = fmt.Sprintf("%s %s", target.Target, filter)
+	}
+	buckets, err := h.history.queryBuckets(ctx, table, where, args, step, points)
+	if err != nil {
+		h.logger.Error(
+			"Failed to query history",
+			slog.String("error", err.Error()),
+		)
+		err = fmt.Errorf("failed to query history")
+		return
+	}
+	result = GrafanaTimeSeries{
+		Target:     name,
+		RefID:      target.RefID,
+		Datapoints: make([][2]float64, len(buckets)),
+	}
+	for i, bucket := range buckets {
+		var value float64
+		switch field {
+		case "throughput":
+			value = bucket.Throughput
+		case "min_throughput":
+			value = bucket.Min
+		case "max_throughput":
+			value = bucket.Max
+		case "count":
+			value = float64(bucket.Count)
+		case "failures":
+			value = float64(bucket.Failures)
+		case "bytes":
+			value = float64(bucket.Bytes)
+		}
+		result.Datapoints[i] = [2]float64{value, float64(bucket.Time.UnixMilli())}
+	}
+	return
+}
+
+// sendJSON writes the given value as the JSON body of the response.
+func (h *GrafanaHandler) sendJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		h.logger.Error(
+			"Failed to send response",
+			slog.String("error", err.Error()),
+		)
+	}
+}
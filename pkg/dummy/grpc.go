@@ -0,0 +1,344 @@
+package dummy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Prefix of the paths of the gRPC methods.
+const grpcServicePath = "/dummy.v1.Dummy/"
+
+// Maximum size of a gRPC message accepted by the server.
+const grpcMaxMessageSize = 16 * (1 << 20) // 16 MiB
+
+// gRPC status codes used by the server, from the 'google.golang.org/grpc/codes' package:
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+)
+
+// GRPCHandler implements the gRPC service described in the 'dummy.proto' file. It doesn't use the gRPC library,
+// instead it implements the gRPC wire protocol on top of the HTTP/2 support of the standard library. That way it can
+// be served in the same port than the rest of the endpoints, and doesn't need generated code.
+type GRPCHandler struct {
+	logger   *slog.Logger
+	identity Identity
+	random   RandomSource
+	patterns *PatternStore
+	stats    *Stats
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *GRPCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requires HTTP/2 and the 'application/grpc' content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.Header.Get("Grpc-Encoding") != "" && r.Header.Get("Grpc-Encoding") != "identity" {
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Header().Set("Grpc-Status", strconv.Itoa(grpcUnimplemented))
+		w.Header().Set("Grpc-Message", "compression isn't supported")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Send the headers. Note that the trailers are declared using the special prefix because some of them, like the
+	// message, are only known at the end.
+	h.identity.SetHeaders(w.Header())
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.WriteHeader(http.StatusOK)
+
+	// Call the method:
+	method := strings.TrimPrefix(r.URL.Path, grpcServicePath)
+	startTime := time.Now()
+	var err error
+	var bytes int64
+	code := grpcOK
+	switch method {
+	case "Download":
+		bytes, code, err = h.download(w, r)
+	case "Upload":
+		bytes, code, err = h.upload(w, r, startTime)
+	case "Echo":
+		bytes, code, err = h.echo(w, r)
+	default:
+		code = grpcUnimplemented
+		err = fmt.Errorf("method '%s' isn't implemented", method)
+	}
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	h.finish(w, code, message)
+	elapsed := time.Since(startTime)
+	h.stats.RecordTransfer(r.Context(), bytes, elapsed)
+
+	// Write a summary to the log:
+	h.logger.Info(
+		"gRPC call finished",
+		slog.String("method", method),
+		slog.Int("code", code),
+		slog.String("message", message),
+		slog.Int64("bytes", bytes),
+		slog.String("elapsed", elapsed.String()),
+		h.identity.LogAttr(),
+	)
+}
+
+func (h *GRPCHandler) finish(w http.ResponseWriter, code int, message string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", message)
+	}
+}
+
+func (h *GRPCHandler) download(w http.ResponseWriter, r *http.Request) (bytes int64, code int, err error) {
+	// Read the request:
+	data, err := readGRPCMessage(r.Body)
+	if err != nil {
+		code = grpcInvalidArgument
+		return
+	}
+	size := int64(DefaultDataSize)
+	chunkSize := DefaultBufferSize
+	pattern := patternRandom
+	err = consumeProtoFields(data, func(number protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case number == 1 && typ == protowire.VarintType:
+			size = int64(protoVarint(value))
+		case number == 2 && typ == protowire.VarintType:
+			chunkSize = int(int32(protoVarint(value)))
+		case number == 3 && typ == protowire.BytesType && len(value) > 0:
+			pattern = string(value)
+		}
+		return nil
+	})
+	if err == nil && (size < 0 || chunkSize <= 0 || chunkSize > grpcMaxMessageSize) {
+		err = fmt.Errorf("size %d or chunk size %d isn't valid", size, chunkSize)
+	}
+	if err != nil {
+		code = grpcInvalidArgument
+		return
+	}
+
+	// Open the data:
+	var reader io.Reader
+	if pattern == patternRandom {
+		var randomReader io.ReadCloser
+		randomReader, err = h.random.Open()
+		if err != nil {
+			code = grpcInternal
+			return
+		}
+		defer randomReader.Close()
+		reader = randomReader
+	} else {
+		if patternFills[pattern] == nil {
+			code = grpcInvalidArgument
+			err = fmt.Errorf("pattern '%s' isn't supported", pattern)
+			return
+		}
+		var patternFile *os.File
+		patternFile, err = h.patterns.Open(pattern)
+		if err != nil {
+			code = grpcInternal
+			return
+		}
+		defer patternFile.Close()
+		reader = &repeatReader{
+			file: patternFile,
+		}
+	}
+
+	// Send the chunks:
+	buffer := make([]byte, chunkSize)
+	var message []byte
+	controller := http.NewResponseController(w)
+	for bytes < size {
+		chunk := buffer[0:min(int64(chunkSize), size-bytes)]
+		_, err = reader.Read(chunk)
+		if err != nil {
+			code = grpcInternal
+			return
+		}
+		message = appendChunk(message[:0], chunk)
+		err = writeGRPCMessage(w, message)
+		if err != nil {
+			code = grpcInternal
+			return
+		}
+		bytes += int64(len(chunk))
+	}
+	err = controller.Flush()
+	if err != nil {
+		code = grpcInternal
+	}
+	return
+}
+
+func (h *GRPCHandler) upload(w http.ResponseWriter, r *http.Request, startTime time.Time) (bytes int64, code int,
+	err error) {
+	var chunks int64
+	for {
+		var data []byte
+		data, err = readGRPCMessage(r.Body)
+		if errors.Is(err, io.EOF) {
+			err = nil
+			break
+		}
+		if err != nil {
+			code = grpcInvalidArgument
+			return
+		}
+		var chunk []byte
+		chunk, err = parseChunk(data)
+		if err != nil {
+			code = grpcInvalidArgument
+			return
+		}
+		bytes += int64(len(chunk))
+		chunks++
+	}
+	var response []byte
+	response = protowire.AppendTag(response, 1, protowire.VarintType)
+	response = protowire.AppendVarint(response, uint64(bytes))
+	response = protowire.AppendTag(response, 2, protowire.VarintType)
+	response = protowire.AppendVarint(response, uint64(chunks))
+	response = protowire.AppendTag(response, 3, protowire.VarintType)
+	response = protowire.AppendVarint(response, uint64(time.Since(startTime)))
+	err = writeGRPCMessage(w, response)
+	if err != nil {
+		code = grpcInternal
+	}
+	return
+}
+
+func (h *GRPCHandler) echo(w http.ResponseWriter, r *http.Request) (bytes int64, code int, err error) {
+	// Enable full duplex, so that we can send responses while the client is still sending requests. This is the
+	// default for HTTP/2, but it doesn't hurt to be explicit.
+	controller := http.NewResponseController(w)
+	_ = controller.EnableFullDuplex()
+	for {
+		var data []byte
+		data, err = readGRPCMessage(r.Body)
+		if errors.Is(err, io.EOF) {
+			err = nil
+			return
+		}
+		if err != nil {
+			code = grpcInvalidArgument
+			return
+		}
+		err = writeGRPCMessage(w, data)
+		if err == nil {
+			err = controller.Flush()
+		}
+		if err != nil {
+			code = grpcInternal
+			return
+		}
+		bytes += int64(len(data))
+	}
+}
+
+// readGRPCMessage reads a length prefixed gRPC message. It returns io.EOF if the stream ended cleanly before the
+// message.
+func readGRPCMessage(reader io.Reader) (data []byte, err error) {
+	var prefix [5]byte
+	_, err = io.ReadFull(reader, prefix[:])
+	if err != nil {
+		return
+	}
+	if prefix[0] != 0 {
+		err = fmt.Errorf("compressed messages aren't supported")
+		return
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > grpcMaxMessageSize {
+		err = fmt.Errorf("message size %d exceeds the maximum %d", length, grpcMaxMessageSize)
+		return
+	}
+	data = make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// writeGRPCMessage writes a length prefixed gRPC message.
+func writeGRPCMessage(writer io.Writer, data []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(data)))
+	_, err := writer.Write(prefix[:])
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// consumeProtoFields calls the given function for each field of the given protocol buffers message. For varint
+// fields the value passed is the encoded varint, for length delimited fields it is the content.
+func consumeProtoFields(data []byte, handler func(protowire.Number, protowire.Type, []byte) error) error {
+	for len(data) > 0 {
+		number, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		if typ == protowire.BytesType {
+			value, n = protowire.ConsumeBytes(data)
+		} else {
+			n = protowire.ConsumeFieldValue(number, typ, data)
+			if n >= 0 {
+				value = data[:n]
+			}
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		err := handler(number, typ, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoVarint decodes a varint that has already been validated by consumeProtoFields.
+func protoVarint(value []byte) uint64 {
+	result, _ := protowire.ConsumeVarint(value)
+	return result
+}
+
+// appendChunk appends to the given buffer a 'Chunk' message containing the given data.
+func appendChunk(buffer, data []byte) []byte {
+	buffer = protowire.AppendTag(buffer, 1, protowire.BytesType)
+	return protowire.AppendBytes(buffer, data)
+}
+
+// parseChunk extracts the data from a 'Chunk' message.
+func parseChunk(message []byte) (result []byte, err error) {
+	err = consumeProtoFields(message, func(number protowire.Number, typ protowire.Type, value []byte) error {
+		if number == 1 && typ == protowire.BytesType {
+			result = value
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,845 @@
+package dummy
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Default data and buffer sizes. The maximum buffer size applies to the buffers requested by the clients, including
+// the batches of buffers, when the configuration doesn't set one, so that a client can't make the server allocate huge
+// buffers.
+const (
+	DefaultDataSize      = 1 * (1 << 30)  // 1 GiB
+	DefaultBufferSize    = 32 * (1 << 10) // 32 KiB
+	DefaultMaxBufferSize = 64 * (1 << 20) // 64 MiB
+)
+
+// Handler is an HTTP handler that sends random data. The 'size' query parameter determines the total amount of bytes to
+// send. The 'buffer_size' query parameter determines the size of the buffer used internally. The 'pattern' query
+// parameter selects the data sent: 'random' (the default), 'zero' or 'sequence'. The response headers can be changed
+// with the parameters described in the setResponseHeaders function. When the 'compress' query parameter is 'true' the
+// data is compressed with the best encoding accepted by the client. With the 'seed' query parameter the random pattern
+// generates the same data in all requests. The 'cpu' query parameter is a number of milliseconds of CPU time and the
+// 'alloc' query parameter is a number of bytes of memory that the request consumes before sending the data, the memory
+// is kept till the data has been sent. Deterministic data supports range requests, including multiple ranges, and
+// conditional requests. The 'scenario' query parameter selects a scenario sequence, advanced separately for each
+// client, identified by the 'client' query parameter or else by the remote address. When sessions are enabled the
+// identifier of the session is the default for the 'seed' and 'client' query parameters. In strict mode, enabled for
+// the server or with the 'strict' query parameter, requests with unknown parameters or invalid combinations are
+// rejected. The 'progress' query parameter is the interval between the progress messages written to the log during
+// the transfer, overriding the one configured for the server. The 'source' query parameter selects one of the
+// registered data sources, like 'lorem', 'json' or 'csv', instead of a pattern. The records of the 'json' and 'csv'
+// sources are configured with the 'format', 'schema', 'record_size' and 'records' query parameters, and the body of
+// the 'template' source, when enabled in the configuration, is rendered from the Go template in the 'template' query
+// parameter. The 'throttle_after' and 'throttle_after_bytes' query parameters are the number of requests and bytes that
+// a client can use in each window, ten seconds or the 'throttle_window' query parameter, at most one hour, after which
+// the requests are rejected with the 429 status code and the 'Retry-After' header till the window ends. The 'flush'
+// query parameter controls how often the response is flushed: 'every' write, every number of writes, or only at the
+// 'end', the default. The 'batch' query parameter is the number of buffers that are gathered and sent with a single
+// larger write. The response writer doesn't support vectored writes, so the buffers are gathered in one contiguous
+// buffer. When the 'chunk_latency' query parameter is 'true' the duration of each write is recorded, and the
+// percentiles are written to the log and to the Prometheus metrics. When the 'timeline' query parameter is 'true' the
+// notable events of the request, like the first byte and each 10% of the body, are recorded and sent in the
+// 'X-Dummy-Timeline' trailer, and they are also available in the statistics endpoint.
+type Handler struct {
+	logger     *slog.Logger
+	identity   Identity
+	headers    http.Header
+	behaviors  *BehaviorSet
+	scenarios  *ScenarioManager
+	sessions   *SessionManager
+	throttles  *ThrottleManager
+	overrides  *OverrideSet
+	zones      *ZoneEmulator
+	random     RandomSource
+	patterns   *PatternStore
+	buffers    *BufferPool
+	limits     LimitsConfig
+	logHeaders bool
+	progress   time.Duration
+	strict     bool
+	templates  bool
+	stats      *Stats
+	latencies  prometheus.Observer
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	// Get the current time so that we can later measure the elapsed time:
+	startTime := time.Now()
+
+	// Write to the log the details of the request. The headers are written only if enabled in the configuration
+	// or with the 'verbose' query parameter, and in that case the per request details that are usually debug
+	// messages are written with the info level.
+	verbose := r.URL.Query().Get("verbose") == "true"
+	detailLevel := slog.LevelDebug
+	if verbose {
+		detailLevel = slog.LevelInfo
+	}
+	requestAttrs := []any{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("remote", r.RemoteAddr),
+		slog.Any("query", r.URL.Query()),
+	}
+	if h.logHeaders || verbose {
+		requestAttrs = append(requestAttrs, slog.Any("headers", r.Header))
+	}
+	h.logger.Info("Received request", requestAttrs...)
+
+	// Add the identity of the instance to the response, including error responses:
+	h.identity.SetHeaders(w.Header())
+
+	// In strict mode reject the requests with unknown parameters or invalid combinations, so that typos don't
+	// silently fall back to the defaults:
+	if h.strict || r.URL.Query().Get("strict") == "true" {
+		err = checkStrictParams(r.URL.Query())
+		if err != nil {
+			h.logger.Info(
+				"Rejected invalid parameters",
+				slog.String("error", err.Error()),
+			)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Replace the deprecated parameters with the current ones, and warn the client:
+	query, deprecated := resolveParamAliases(r.URL.Query())
+	if len(deprecated) > 0 {
+		setDeprecationWarnings(w.Header(), deprecated)
+		h.logger.Warn(
+			"Deprecated query parameters",
+			slog.Any("names", deprecated),
+		)
+	}
+
+	// Get the response size:
+	dataSize := h.limits.DefaultSize
+	text := query.Get("size")
+	if text != "" {
+		value, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			h.logger.Error(
+				"Failed to parse response size query paramer",
+				slog.String("value", text),
+				slog.String("error", err.Error()),
+			)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if value < 0 {
+			http.Error(w, fmt.Sprintf("size %d should be zero or positive", value), http.StatusBadRequest)
+			return
+		}
+		dataSize = int(value)
+	}
+
+	// Get the data source, if requested. Sources that are configured with query parameters may also determine the
+	// size of the data:
+	sourceName := query.Get("source")
+	var source DataSource
+	var rendered bool
+	if sourceName != "" {
+		source = lookupDataSource(sourceName)
+		switch {
+		case source == nil:
+			err = unknownSourceError(sourceName)
+		case sourceName == sourceTemplate && !h.templates:
+			source = nil
+			err = errors.New("template source is disabled, it can be enabled in the configuration of the server")
+		}
+		configurable, ok := source.(ConfigurableDataSource)
+		if ok {
+			var sourceSize int64
+			source, sourceSize, err = configurable.Configure(query)
+			if sourceSize > 0 {
+				dataSize = int(sourceSize)
+			}
+		}
+		renderer, ok := source.(RequestDataSource)
+		if ok {
+			var sourceSize int64
+			source, sourceSize, err = renderer.Render(r)
+			dataSize = int(sourceSize)
+			rendered = true
+		}
+		if err != nil {
+			h.logger.Error(
+				"Invalid data source",
+				slog.String("source", sourceName),
+				slog.String("error", err.Error()),
+			)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if h.limits.MaxSize > 0 && dataSize > h.limits.MaxSize {
+		http.Error(
+			w,
+			fmt.Sprintf("size %d exceeds the maximum %d", dataSize, h.limits.MaxSize),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	h.logger.Log(
+		r.Context(),
+		detailLevel,
+		"Response size",
+		slog.Int("size", dataSize),
+	)
+
+	// Get the buffer size:
+	bufferSize := h.limits.DefaultBufferSize
+	text = query.Get("buffer_size")
+	if text != "" {
+		value, err := strconv.Atoi(text)
+		if err != nil {
+			h.logger.Error(
+				"Failed to parse buffer size query paramer",
+				slog.String("value", text),
+				slog.String("error", err.Error()),
+			)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if value <= 0 {
+			http.Error(w, fmt.Sprintf("buffer size %d should be positive", value), http.StatusBadRequest)
+			return
+		}
+		bufferSize = value
+	}
+	if bufferSize > h.limits.MaxBufferSize {
+		http.Error(
+			w,
+			fmt.Sprintf("buffer size %d exceeds the maximum %d", bufferSize, h.limits.MaxBufferSize),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	h.logger.Log(
+		r.Context(),
+		detailLevel,
+		"Buffer size",
+		slog.Int("size", bufferSize),
+	)
+
+	// Find the session of the client, if sessions are enabled, and check that it has enough quota. The reserved bytes
+	// are returned to the session if the request is rejected before the data is sent.
+	session, err := h.sessions.Resolve(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusMisdirectedRequest)
+		return
+	}
+	var sending bool
+	if session != nil {
+		err = h.sessions.Reserve(session, int64(dataSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		defer func() {
+			if !sending {
+				h.sessions.Release(session, int64(dataSize))
+			}
+		}()
+	}
+
+	// Identify the client for the scenario sequences and the throttling, with the 'client' query parameter, or else
+	// the session, or else the remote address:
+	client := query.Get("client")
+	if client == "" && session != nil {
+		client = session.ID
+	}
+	if client == "" {
+		client, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+
+	// Reject the request if the client has exceeded the throttling limit:
+	throttleLimit, err := parseThrottleLimit(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if throttleLimit != nil {
+		retryAfter, throttled := h.throttles.Check(client, *throttleLimit, int64(dataSize))
+		if throttled {
+			seconds := int64(math.Ceil(retryAfter.Seconds()))
+			h.logger.Info(
+				"Throttled request",
+				slog.String("client", client),
+				slog.Int64("retry_after", seconds),
+			)
+			w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+			http.Error(w, fmt.Sprintf("client '%s' is throttled", client), http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	// Get the simulated cost:
+	cost, err := parseRequestCost(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Apply the simulated latency and errors, including the overrides specific for this client:
+	behavior := h.behaviors.Current()
+	override, overrideNames := h.overrides.Match(r)
+	if len(overrideNames) > 0 {
+		behavior = behavior.Merge(override)
+		h.logger.Info(
+			"Applied overrides",
+			slog.Any("names", overrideNames),
+		)
+	}
+	scenarioName := query.Get("scenario")
+	if scenarioName != "" {
+		scenarioBehavior, scenarioIndex, err := h.scenarios.Next(scenarioName, client)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		behavior = behavior.Merge(scenarioBehavior)
+		w.Header().Set(scenarioStepHeader, strconv.Itoa(scenarioIndex))
+		h.logger.Info(
+			"Applied scenario sequence",
+			slog.String("name", scenarioName),
+			slog.String("client", client),
+			slog.Int("index", scenarioIndex),
+		)
+	}
+	zoneLatency, clientZone := h.zones.Latency(r)
+	if zoneLatency > 0 {
+		behavior.Latency += zoneLatency
+		h.logger.Info(
+			"Applied cross zone latency",
+			slog.String("client_zone", clientZone),
+			slog.String("latency", zoneLatency.String()),
+		)
+	}
+	if behavior.SlowRate > 0 && rand.Float64() < behavior.SlowRate {
+		behavior.Latency += behavior.SlowLatency
+		h.logger.Info(
+			"Simulated slow response",
+			slog.String("latency", behavior.SlowLatency.String()),
+		)
+	}
+	if behavior.Latency > 0 {
+		select {
+		case <-time.After(behavior.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if behavior.ResetRate > 0 && rand.Float64() < behavior.ResetRate {
+		h.logger.Info("Simulated connection reset")
+		resetConnection(w)
+		return
+	}
+	if behavior.ErrorRate > 0 && rand.Float64() < behavior.ErrorRate {
+		errorStatus := behavior.ErrorStatus
+		if errorStatus == 0 {
+			errorStatus = http.StatusInternalServerError
+		}
+		h.logger.Info(
+			"Simulated error",
+			slog.Int("status", errorStatus),
+		)
+		w.WriteHeader(errorStatus)
+		return
+	}
+
+	// Consume the CPU and memory. The memory is kept till the response has been sent.
+	if cost.CPU > 0 || cost.Alloc > 0 {
+		costStart := time.Now()
+		memory := cost.Apply(r.Context())
+		defer runtime.KeepAlive(memory)
+		h.logger.Log(
+			r.Context(),
+			detailLevel,
+			"Applied request cost",
+			slog.String("cpu", cost.CPU.String()),
+			slog.Int("alloc", cost.Alloc),
+			slog.String("elapsed", time.Since(costStart).String()),
+		)
+	}
+
+	// Get the data pattern:
+	pattern := query.Get("pattern")
+	if pattern == "" {
+		pattern = patternRandom
+	}
+	if pattern != patternRandom && patternFills[pattern] == nil {
+		h.logger.Error(
+			"Unsupported data pattern",
+			slog.String("pattern", pattern),
+		)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Sources replace the pattern, and the name of the data used for the entity tag and the file name is the name of
+	// the source:
+	dataName := pattern
+	if source != nil {
+		pattern = patternRandom
+		dataName = sourceName
+	}
+
+	// Open the data. For the random pattern this is a reader from the random source, unless the 'seed' parameter is
+	// given, and then it is generated from the seed so that it is the same in all requests. For the rest of the
+	// patterns it is the blob that contains the pattern. Data sources are deterministic only when there is a seed,
+	// otherwise a random one is used.
+	seed := query.Get("seed")
+	if seed == "" && session != nil {
+		seed = session.ID
+	}
+	if pattern != patternRandom {
+		seed = ""
+	}
+	var dataReader io.ReadCloser
+	var dataFile *os.File
+	var dataSeeker io.ReadSeeker
+	switch {
+	case source != nil:
+		var sourceSeed [32]byte
+		if seed != "" {
+			sourceSeed = sha256.Sum256([]byte(seed))
+		} else {
+			_, err = crand.Read(sourceSeed[:])
+		}
+		sourceReader := newDataSourceReader(source, sourceSeed, int64(dataSize))
+		dataReader = io.NopCloser(sourceReader)
+		if seed != "" && !rendered {
+			dataSeeker = sourceReader
+		}
+	case pattern != patternRandom:
+		dataFile, err = h.patterns.Open(pattern)
+		dataReader = dataFile
+		dataSeeker = &patternSection{
+			file: dataFile,
+			blob: int64(h.patterns.Size()),
+			size: int64(dataSize),
+		}
+	case seed != "":
+		seeded := newSyntheticData(sha256.Sum256([]byte(seed)), int64(dataSize))
+		dataReader = io.NopCloser(seeded)
+		dataSeeker = seeded
+	default:
+		dataReader, err = h.random.Open()
+	}
+	if err != nil {
+		h.logger.Error(
+			"Failed to open data",
+			slog.String("pattern", dataName),
+			slog.String("error", err.Error()),
+		)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		err := dataReader.Close()
+		if err != nil {
+			h.logger.Error(
+				"Failed to close data",
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+
+	// Send the data:
+	err = setResponseHeaders(w.Header(), h.headers, query, dataSize, dataName)
+	if err != nil {
+		h.logger.Error(
+			"Failed to set response headers",
+			slog.String("error", err.Error()),
+		)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if source != nil && query.Get("content_type") == "" {
+		w.Header().Set("Content-Type", source.ContentType())
+	}
+
+	// Deterministic data has an entity tag and a modification time, so that caches can validate their copies:
+	if dataSeeker != nil {
+		etag := w.Header().Get("ETag")
+		if etag == "" {
+			var encoding string
+			if query.Get("compress") == "true" {
+				encoding = negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			}
+			// The settings of sources are part of the query, so they are also part of the tag:
+			etagName := pattern
+			if source != nil {
+				etagName = "source/" + sourceName + "?" + query.Encode()
+			}
+			etag = contentETag(etagName, seed, dataSize, encoding)
+			w.Header().Set("ETag", etag)
+		}
+		w.Header().Set("Last-Modified", syntheticModTime.Format(http.TimeFormat))
+		if notModified(r, etag, syntheticModTime) {
+			h.logger.Info(
+				"Data not modified",
+				slog.String("etag", etag),
+			)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	// Range requests are supported only for deterministic data, and only without compression. The standard library
+	// takes care of single and multiple ranges, the latter sent as 'multipart/byteranges', and of the 'If-Range'
+	// header.
+	if dataSeeker != nil && query.Get("compress") != "true" {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if r.Header.Get("Range") != "" {
+			h.logger.Info(
+				"Sending ranges",
+				slog.String("range", r.Header.Get("Range")),
+				slog.Int("size", dataSize),
+				slog.String("pattern", dataName),
+			)
+			sending = true
+			http.ServeContent(w, r, "", syntheticModTime, dataSeeker)
+			return
+		}
+	}
+
+	// Get the interval of the progress messages:
+	progressInterval := h.progress
+	text = query.Get("progress")
+	if text != "" {
+		progressInterval, err = time.ParseDuration(text)
+		if err != nil || progressInterval < 0 {
+			http.Error(w, fmt.Sprintf("progress interval '%s' isn't valid", text), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Get the flush interval and the number of buffers gathered in each write:
+	flushInterval, err := parseFlushInterval(query.Get("flush"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	batch, err := parseIntParam(query.Get("batch"), 1)
+	if err != nil || batch == 0 {
+		http.Error(w, fmt.Sprintf("batch '%s' should be a positive number of buffers", query.Get("batch")),
+			http.StatusBadRequest)
+		return
+	}
+	// Note that the product of the buffer size and the batch isn't calculated before checking it, as it could
+	// overflow:
+	if batch > h.limits.MaxBufferSize/bufferSize {
+		http.Error(
+			w,
+			fmt.Sprintf(
+				"batch of %d buffers of %d bytes exceeds the maximum buffer size %d",
+				batch, bufferSize, h.limits.MaxBufferSize,
+			),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	sending = true
+
+	// Prepare the compression, if requested and accepted by the client. Note that the counter is placed between the
+	// encoder and the response, so that it counts the bytes actually sent.
+	encoding := "identity"
+	var wireWriter io.Writer = w
+	var latencies *LatencyHistogram
+	if query.Get("chunk_latency") == "true" {
+		latencies = NewLatencyHistogram()
+		wireWriter = &latencyWriter{
+			writer:    w,
+			histogram: latencies,
+			observer:  h.latencies,
+		}
+	}
+	wireCounter := &countingWriter{
+		writer: wireWriter,
+	}
+	var bodyWriter io.Writer = wireCounter
+	var encoder io.WriteCloser
+	if query.Get("compress") == "true" {
+		w.Header().Add("Vary", "Accept-Encoding")
+		negotiated := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if negotiated != "" {
+			encoder, err = newEncoder(negotiated, wireCounter)
+			if err != nil {
+				h.logger.Error(
+					"Failed to create encoder",
+					slog.String("encoding", negotiated),
+					slog.String("error", err.Error()),
+				)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			encoding = negotiated
+			bodyWriter = encoder
+			w.Header().Set("Content-Encoding", encoding)
+		}
+	}
+
+	// If the body will be truncated send only part of the data:
+	sendSize := dataSize
+	truncated := behavior.TruncateRate > 0 && dataSize > 0 && rand.Float64() < behavior.TruncateRate
+	if truncated {
+		sendSize = rand.IntN(dataSize)
+	}
+
+	// Start the timeline, if requested. Progress is measured before compression, so the first byte is the first byte
+	// of the body passed to the encoder.
+	var timeline *timelineRecorder
+	if query.Get("timeline") == "true" {
+		timeline = newTimelineRecorder(r, startTime, int64(sendSize))
+		bodyWriter = &timelineWriter{
+			writer:   bodyWriter,
+			recorder: timeline,
+		}
+	}
+
+	declareStatsTrailers(w.Header())
+	if timeline != nil {
+		w.Header().Add("Trailer", timelineTrailer)
+	}
+	w.WriteHeader(http.StatusOK)
+	timeline.record(timelineHeaders)
+
+	// Start reporting progress, if requested. Note that the blob can't be used in that case, because the bytes
+	// can't be counted while the runtime copies them with sendfile.
+	progress := startProgress(progressInterval, func(record *ProgressRecord) {
+		h.logger.Info(
+			"Transfer progress",
+			slog.Int64("bytes", record.Bytes),
+			slog.Int64("total", record.Total),
+			slog.Int("size", sendSize),
+			slog.Float64("rate", record.Rate),
+			slog.String("elapsed", time.Duration(record.Elapsed).String()),
+			h.identity.LogAttr(),
+		)
+	})
+	flusher := &responseFlusher{
+		response: w,
+		encoder:  encoder,
+		interval: flushInterval,
+	}
+	var sent bool
+	if dataFile != nil && behavior.Rate == 0 && encoder == nil && progress == nil && flushInterval == 0 && batch == 1 &&
+		latencies == nil && timeline == nil {
+		sent = h.sendBlob(w, dataFile, sendSize)
+		wireCounter.count = int64(sendSize)
+		wireCounter.writes = 1
+	} else {
+		var bufferedReader io.Reader = dataReader
+		if dataFile != nil {
+			bufferedReader = &repeatReader{
+				file: dataFile,
+			}
+		}
+		sent = h.sendBuffered(bodyWriter, r, bufferedReader, sendSize, bufferSize, batch, behavior, progress,
+			flusher)
+	}
+	progress.Stop()
+	if !sent {
+		timeline.finish(h.stats, timelineFailed)
+		return
+	}
+	if truncated {
+		timeline.finish(h.stats, timelineTruncated)
+		h.logger.Info(
+			"Simulated truncated body",
+			slog.Int("size", dataSize),
+			slog.Int("sent", sendSize),
+		)
+		http.NewResponseController(w).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	if encoder != nil {
+		err = encoder.Close()
+		if err != nil {
+			h.logger.Error(
+				"Failed to close encoder",
+				slog.String("encoding", encoding),
+				slog.String("error", err.Error()),
+			)
+			timeline.finish(h.stats, timelineFailed)
+			return
+		}
+	}
+
+	// Calculate the elapsedTime time, and send it to the client in the trailers:
+	elapsedTime := time.Since(startTime)
+	setStatsTrailers(w.Header(), elapsedTime, int64(dataSize), wireCounter.writes)
+	if timeline != nil {
+		timeline.finish(h.stats, timelineCompleted)
+		w.Header().Set(timelineTrailer, timeline.timeline.String())
+	}
+	h.stats.RecordTransfer(r.Context(), int64(dataSize), elapsedTime)
+
+	// Write a summary to the log:
+	summaryAttrs := []any{
+		slog.Int("size", dataSize),
+		slog.Int("buffer", bufferSize),
+		slog.String("pattern", dataName),
+		slog.String("encoding", encoding),
+		slog.Int64("wire", wireCounter.count),
+		slog.Int64("writes", wireCounter.writes),
+		slog.Int64("flushes", flusher.flushes),
+		slog.String("elapsed", elapsedTime.String()),
+		h.identity.LogAttr(),
+	}
+	if latencies != nil {
+		summaryAttrs = append(summaryAttrs, latencies.LogAttr("chunk_latency"))
+	}
+	h.logger.Info("Data sent", summaryAttrs...)
+}
+
+// sendBuffered sends the data reading it into a buffer and then writing it to the response, honoring the rate limit of
+// the behavior, adding the bytes written to the progress meter and flushing the response as requested. Each write
+// contains the given number of buffers. It returns false if sending failed.
+func (h *Handler) sendBuffered(w io.Writer, r *http.Request, dataReader io.Reader, dataSize, bufferSize, batch int,
+	behavior Behavior, progress *progressMeter, flusher *responseFlusher) bool {
+	writeSize := bufferSize * batch
+	if bufferSize <= 0 || writeSize <= 0 {
+		h.logger.Error(
+			"Invalid write size",
+			slog.Int("buffer", bufferSize),
+			slog.Int("batch", batch),
+		)
+		return false
+	}
+	writeSize = min(writeSize, max(dataSize, 1))
+	dataBuffer := h.buffers.Get(writeSize)
+	defer h.buffers.Put(dataBuffer)
+	pendingSize := dataSize
+	sendStart := time.Now()
+	for pendingSize > 0 {
+		// Stop if the client is gone, even if the writes don't fail, for example because they are buffered:
+		if r.Context().Err() != nil {
+			return false
+		}
+		writeBuffer := (*dataBuffer)[0:min(pendingSize, writeSize)]
+		for offset := 0; offset < len(writeBuffer); offset += bufferSize {
+			readBuffer := writeBuffer[offset:min(offset+bufferSize, len(writeBuffer))]
+			n, err := dataReader.Read(readBuffer)
+			if err != nil {
+				h.logger.Error(
+					"Failed to read data",
+					slog.Int("size", len(readBuffer)),
+					slog.String("error", err.Error()),
+				)
+				return false
+			}
+			if n != len(readBuffer) {
+				h.logger.Error(
+					"Unexpected read size",
+					slog.Int("expected", len(readBuffer)),
+					slog.Int("actual", n),
+				)
+				return false
+			}
+		}
+		n, err := w.Write(writeBuffer)
+		if err != nil {
+			h.logger.Error(
+				"Failed to write data",
+				slog.Int("size", len(writeBuffer)),
+				slog.String("error", err.Error()),
+			)
+			return false
+		}
+		if n != len(writeBuffer) {
+			h.logger.Error(
+				"Unexpected write size",
+				slog.Int("expected", len(writeBuffer)),
+				slog.Int("actual", n),
+			)
+			return false
+		}
+		pendingSize -= n
+		progress.Add(int64(n))
+		err = flusher.wrote()
+		if err != nil {
+			h.logger.Error(
+				"Failed to flush data",
+				slog.String("error", err.Error()),
+			)
+			return false
+		}
+
+		// If the rate is limited wait till the sent data is within the limit:
+		if behavior.Rate > 0 {
+			sentSize := dataSize - pendingSize
+			sentTime := time.Duration(float64(sentSize) / float64(behavior.Rate) * float64(time.Second))
+			delay := sentTime - time.Since(sendStart)
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// sendBlob sends the data copying it from the pattern blob, as many times as needed. The blob is wrapped with an
+// io.LimitedReader because that is what allows the runtime to use sendfile for plain text connections. It returns
+// false if sending failed.
+func (h *Handler) sendBlob(w http.ResponseWriter, dataFile *os.File, dataSize int) bool {
+	blobSize := int64(h.patterns.Size())
+	pendingSize := int64(dataSize)
+	for pendingSize > 0 {
+		_, err := dataFile.Seek(0, io.SeekStart)
+		if err != nil {
+			h.logger.Error(
+				"Failed to rewind data file",
+				slog.String("error", err.Error()),
+			)
+			return false
+		}
+		copySize := min(pendingSize, blobSize)
+		n, err := io.Copy(w, &io.LimitedReader{
+			R: dataFile,
+			N: copySize,
+		})
+		if err != nil {
+			h.logger.Error(
+				"Failed to copy data",
+				slog.Int64("size", copySize),
+				slog.String("error", err.Error()),
+			)
+			return false
+		}
+		if n != copySize {
+			h.logger.Error(
+				"Unexpected copy size",
+				slog.Int64("expected", copySize),
+				slog.Int64("actual", n),
+			)
+			return false
+		}
+		pendingSize -= copySize
+	}
+	return true
+}
@@ -0,0 +1,341 @@
+package dummy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// startTestServer creates a server with the given options and serves its handler with a plain text test server. Both
+// are closed when the test finishes.
+func startTestServer(t *testing.T, options Options) *httptest.Server {
+	t.Helper()
+	server, err := NewServer(options)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+	})
+	test := httptest.NewServer(server.Handler())
+	t.Cleanup(test.Close)
+	return test
+}
+
+// getBody sends a GET request with the given headers and returns the response and the body.
+func getBody(t *testing.T, address string, headers map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	return response, body
+}
+
+func TestHandlerRanges(t *testing.T) {
+	server := startTestServer(t, Options{})
+	address := server.URL + "/?size=1000&seed=test"
+	response, full := getBody(t, address, nil)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, response.StatusCode)
+	}
+	if len(full) != 1000 {
+		t.Fatalf("expected 1000 bytes, but got %d", len(full))
+	}
+	if response.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("expected 'Accept-Ranges: bytes', but got '%s'", response.Header.Get("Accept-Ranges"))
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		status int
+		start  int
+		end    int
+	}{
+		{
+			name:   "First bytes",
+			value:  "bytes=0-9",
+			status: http.StatusPartialContent,
+			start:  0,
+			end:    10,
+		},
+		{
+			name:   "Middle",
+			value:  "bytes=500-599",
+			status: http.StatusPartialContent,
+			start:  500,
+			end:    600,
+		},
+		{
+			name:   "Open end",
+			value:  "bytes=990-",
+			status: http.StatusPartialContent,
+			start:  990,
+			end:    1000,
+		},
+		{
+			name:   "Suffix",
+			value:  "bytes=-5",
+			status: http.StatusPartialContent,
+			start:  995,
+			end:    1000,
+		},
+		{
+			name:   "End past the size",
+			value:  "bytes=900-5000",
+			status: http.StatusPartialContent,
+			start:  900,
+			end:    1000,
+		},
+		{
+			name:   "Start past the size",
+			value:  "bytes=2000-3000",
+			status: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:   "Invalid unit",
+			value:  "lines=0-9",
+			status: http.StatusRequestedRangeNotSatisfiable,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, body := getBody(t, address, map[string]string{
+				"Range": test.value,
+			})
+			if response.StatusCode != test.status {
+				t.Fatalf("expected status %d, but got %d", test.status, response.StatusCode)
+			}
+			if test.status != http.StatusPartialContent {
+				return
+			}
+			if !bytes.Equal(body, full[test.start:test.end]) {
+				t.Errorf("body doesn't match bytes %d to %d of the full body", test.start, test.end)
+			}
+			expected := fmt.Sprintf("bytes %d-%d/1000", test.start, test.end-1)
+			if actual := response.Header.Get("Content-Range"); actual != expected {
+				t.Errorf("expected 'Content-Range: %s', but got '%s'", expected, actual)
+			}
+		})
+	}
+}
+
+func TestHandlerMultipleRanges(t *testing.T) {
+	server := startTestServer(t, Options{})
+	address := server.URL + "/?size=1000&seed=test"
+	_, full := getBody(t, address, nil)
+	response, body := getBody(t, address, map[string]string{
+		"Range": "bytes=0-9,100-109,-10",
+	})
+	if response.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected status %d, but got %d", http.StatusPartialContent, response.StatusCode)
+	}
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse content type: %v", err)
+	}
+	if mediaType != "multipart/byteranges" {
+		t.Fatalf("expected 'multipart/byteranges', but got '%s'", mediaType)
+	}
+	expected := []struct {
+		start int
+		end   int
+	}{
+		{start: 0, end: 10},
+		{start: 100, end: 110},
+		{start: 990, end: 1000},
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for i, part := range expected {
+		next, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("failed to read part %d: %v", i, err)
+		}
+		data, err := io.ReadAll(next)
+		if err != nil {
+			t.Fatalf("failed to read data of part %d: %v", i, err)
+		}
+		if !bytes.Equal(data, full[part.start:part.end]) {
+			t.Errorf("part %d doesn't match bytes %d to %d of the full body", i, part.start, part.end)
+		}
+		contentRange := fmt.Sprintf("bytes %d-%d/1000", part.start, part.end-1)
+		if actual := next.Header.Get("Content-Range"); actual != contentRange {
+			t.Errorf("expected range '%s' for part %d, but got '%s'", contentRange, i, actual)
+		}
+	}
+	_, err = reader.NextPart()
+	if err != io.EOF {
+		t.Errorf("expected exactly %d parts, but got more or an error: %v", len(expected), err)
+	}
+}
+
+func TestHandlerRangesIgnoredForRandomData(t *testing.T) {
+	server := startTestServer(t, Options{})
+	response, body := getBody(t, server.URL+"/?size=1000", map[string]string{
+		"Range": "bytes=0-9",
+	})
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, response.StatusCode)
+	}
+	if len(body) != 1000 {
+		t.Errorf("expected the full body of 1000 bytes, but got %d", len(body))
+	}
+	if response.Header.Get("Accept-Ranges") != "" {
+		t.Errorf("expected no 'Accept-Ranges' header, but got '%s'", response.Header.Get("Accept-Ranges"))
+	}
+}
+
+func TestHandlerBufferSize(t *testing.T) {
+	server := startTestServer(t, Options{})
+	tests := []struct {
+		value  string
+		status int
+	}{
+		{value: "1", status: http.StatusOK},
+		{value: "1000", status: http.StatusOK},
+		{value: "0", status: http.StatusBadRequest},
+		{value: "-1", status: http.StatusBadRequest},
+		{value: "big", status: http.StatusBadRequest},
+		{value: "4294967296", status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			response, body := getBody(t, server.URL+"/?size=100&buffer_size="+test.value, nil)
+			if response.StatusCode != test.status {
+				t.Fatalf("expected status %d, but got %d", test.status, response.StatusCode)
+			}
+			if test.status == http.StatusOK && len(body) != 100 {
+				t.Errorf("expected 100 bytes, but got %d", len(body))
+			}
+		})
+	}
+}
+
+func TestHandlerBatch(t *testing.T) {
+	server := startTestServer(t, Options{})
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{
+			name:   "Small batch",
+			query:  "buffer_size=10&batch=4",
+			status: http.StatusOK,
+		},
+		{
+			name:   "Batch at the maximum",
+			query:  "buffer_size=1024&batch=65536",
+			status: http.StatusOK,
+		},
+		{
+			name:   "Batch above the maximum",
+			query:  "buffer_size=1024&batch=65537",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Overflow",
+			query:  "buffer_size=4294967296&batch=4294967296",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Zero",
+			query:  "batch=0",
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, body := getBody(t, server.URL+"/?size=100&"+test.query, nil)
+			if response.StatusCode != test.status {
+				t.Fatalf("expected status %d, but got %d: %s", test.status, response.StatusCode, body)
+			}
+			if test.status == http.StatusOK && len(body) != 100 {
+				t.Errorf("expected 100 bytes, but got %d", len(body))
+			}
+		})
+	}
+}
+
+func TestHandlerTemplateSourceIsOptIn(t *testing.T) {
+	address := "/?source=template&template=" + url.QueryEscape(`{{.Query.Get "name"}}`) + "&name=joe"
+	disabled := startTestServer(t, Options{})
+	response, _ := getBody(t, disabled.URL+address, nil)
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d when disabled, but got %d", http.StatusBadRequest, response.StatusCode)
+	}
+	enabled := startTestServer(t, Options{
+		Config: &Config{
+			Templates: true,
+		},
+	})
+	response, body := getBody(t, enabled.URL+address, nil)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d when enabled, but got %d", http.StatusOK, response.StatusCode)
+	}
+	if string(body) != "joe" {
+		t.Errorf("expected body 'joe', but got %q", body)
+	}
+}
+
+func TestHandlerSessionQuota(t *testing.T) {
+	server := startTestServer(t, Options{
+		Config: &Config{
+			Sessions: &SessionsConfig{
+				Mode:  SessionModeSet,
+				Quota: 1000,
+			},
+		},
+	})
+
+	// Get a session:
+	response, _ := getBody(t, server.URL+"/?size=0", nil)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, response.StatusCode)
+	}
+	cookies := response.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie {
+		t.Fatalf("expected the session cookie, but got %v", cookies)
+	}
+	headers := map[string]string{
+		"Cookie": cookies[0].String(),
+	}
+
+	// Negative sizes are rejected, and requests rejected after the reservation don't use the quota:
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{query: "size=-1000000", status: http.StatusBadRequest},
+		{query: "size=600&throttle_window=junk&throttle_after=1", status: http.StatusBadRequest},
+		{query: "size=600&batch=0", status: http.StatusBadRequest},
+		{query: "size=600", status: http.StatusOK},
+		{query: "size=600", status: http.StatusTooManyRequests},
+		{query: "size=400", status: http.StatusOK},
+	}
+	for _, test := range tests {
+		response, _ := getBody(t, server.URL+"/?"+test.query, headers)
+		if response.StatusCode != test.status {
+			t.Fatalf("expected status %d for '%s', but got %d", test.status, test.query, response.StatusCode)
+		}
+	}
+}
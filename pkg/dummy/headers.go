@@ -0,0 +1,142 @@
+package dummy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Prefix of the query parameters that set arbitrary response headers, for example 'header_X-My-Header=my-value'.
+const headerParamPrefix = "header_"
+
+// Headers that can't be set with query parameters or flags, because they would break the framing of the response.
+var reservedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Range":     true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+}
+
+// cachePresets contains the groups of caching headers that can be selected with the 'cache' query parameter.
+var cachePresets = map[string]http.Header{
+	"no-store": {
+		"Cache-Control": {"no-store"},
+		"Pragma":        {"no-cache"},
+		"Expires":       {"0"},
+	},
+	"immutable": {
+		"Cache-Control": {"public, max-age=31536000, immutable"},
+	},
+	"short-ttl": {
+		"Cache-Control": {"public, max-age=60"},
+	},
+	"stale-while-revalidate": {
+		"Cache-Control": {"public, max-age=60, stale-while-revalidate=600, stale-if-error=86400"},
+	},
+}
+
+// cachePresetNames returns the sorted names of the cache presets.
+func cachePresetNames() []string {
+	var result []string
+	for name := range cachePresets {
+		result = append(result, name)
+	}
+	slices.Sort(result)
+	return result
+}
+
+// HeaderFlag is a command line flag that can be repeated to set extra response headers, in the 'Name: value' format.
+type HeaderFlag http.Header
+
+// String is the implementation of the flag.Value interface.
+func (f HeaderFlag) String() string {
+	var pairs []string
+	for name, values := range f {
+		for _, value := range values {
+			pairs = append(pairs, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// Set is the implementation of the flag.Value interface.
+func (f HeaderFlag) Set(text string) error {
+	name, value, ok := strings.Cut(text, ":")
+	if !ok {
+		return fmt.Errorf("header '%s' should be in the 'Name: value' format", text)
+	}
+	name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	if reservedHeaders[name] {
+		return fmt.Errorf("header '%s' can't be set", name)
+	}
+	http.Header(f).Add(name, strings.TrimSpace(value))
+	return nil
+}
+
+// setResponseHeaders sets the response headers that are configured with flags and with the query parameters of the
+// request:
+//
+//   - 'content_type' sets the 'Content-Type' header, the default is 'application/octet-stream'.
+//   - 'cache' selects a group of coherent caching headers: 'no-store', 'immutable', 'short-ttl' or
+//     'stale-while-revalidate'.
+//   - 'cache_control' sets the 'Cache-Control' header, replacing the one set by the 'cache' parameter.
+//   - 'disposition' is 'inline' or 'attachment', and sets the 'Content-Disposition' header with a file name
+//     generated from the size and pattern of the data.
+//   - 'header_Name=value' sets the 'Name' header to 'value'.
+//
+// It returns an error if any of the parameters isn't valid.
+func setResponseHeaders(header http.Header, defaults http.Header, query url.Values, dataSize int,
+	pattern string) error {
+	for name, values := range defaults {
+		header[name] = append([]string(nil), values...)
+	}
+	contentType := query.Get("content_type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	cache := query.Get("cache")
+	if cache != "" {
+		preset, ok := cachePresets[cache]
+		if !ok {
+			return fmt.Errorf("cache preset should be one of %s, but it is '%s'", strings.Join(cachePresetNames(), ", "),
+				cache)
+		}
+		for name, values := range preset {
+			header[name] = slices.Clone(values)
+		}
+	}
+	cacheControl := query.Get("cache_control")
+	if cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+	disposition := query.Get("disposition")
+	switch disposition {
+	case "":
+	case "inline", "attachment":
+		header.Set(
+			"Content-Disposition",
+			fmt.Sprintf("%s; filename=\"dummy-%s-%d.bin\"", disposition, pattern, dataSize),
+		)
+	default:
+		return fmt.Errorf("disposition should be 'inline' or 'attachment', but it is '%s'", disposition)
+	}
+	for param, values := range query {
+		name, ok := strings.CutPrefix(param, headerParamPrefix)
+		if !ok {
+			continue
+		}
+		name = http.CanonicalHeaderKey(name)
+		if name == "" || reservedHeaders[name] {
+			return fmt.Errorf("header '%s' can't be set", name)
+		}
+		header.Del(name)
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	return nil
+}
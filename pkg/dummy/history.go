@@ -0,0 +1,560 @@
+package dummy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	// Pure Go SQLite driver, so that the binary doesn't need cgo:
+	_ "modernc.org/sqlite"
+)
+
+// Path of the endpoint that returns the recorded results.
+const HistoryPath = "/history"
+
+// Defaults of the recording of results:
+const (
+	DefaultHistoryRetention = 7 * 24 * time.Hour
+	defaultHistoryLimit     = 1000
+	maxHistoryLimit         = 10 * defaultHistoryLimit
+
+	// historyQueue is the number of results that can be waiting to be written. When the queue is full new results
+	// are discarded, so that a slow disk never delays the requests.
+	historyQueue = 4096
+
+	// historyBatch is the maximum number of results written in one transaction.
+	historyBatch = 256
+)
+
+// Kinds of results recorded:
+const (
+	HistoryKindTransfers = "transfers"
+	HistoryKindProbes    = "probes"
+)
+
+// historySchema creates the tables. Times are stored as Unix nanoseconds, and durations as seconds.
+const historySchema = `
+create table if not exists transfers (
+	time integer not null,
+	endpoint text not null,
+	bytes integer not null,
+	elapsed real not null,
+	throughput real not null
+);
+create index if not exists transfers_time on transfers (time);
+create table if not exists probes (
+	time integer not null,
+	probe text not null,
+	url text not null,
+	status integer not null,
+	bytes integer not null,
+	elapsed real not null,
+	throughput real not null,
+	error text not null
+);
+create index if not exists probes_time on probes (time);
+`
+
+// HistoryConfig contains the settings of the recording of the results of the transfers and of the probes in an
+// embedded SQLite database, so that they survive restarts.
+type HistoryConfig struct {
+	// File is the path of the database file. It is created if it doesn't exist.
+	File string `json:"file"`
+
+	// Retention is the time that results are kept. The default is seven days.
+	Retention Duration `json:"retention,omitempty"`
+}
+
+// validate checks that the history settings are valid.
+func (c *HistoryConfig) validate() error {
+	if c.File == "" {
+		return fmt.Errorf("history file is mandatory")
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("history retention %s is negative", time.Duration(c.Retention))
+	}
+	return nil
+}
+
+// HistoryTransfer is a recorded transfer completed by the server.
+type HistoryTransfer struct {
+	Time       time.Time `json:"time"`
+	Endpoint   string    `json:"endpoint"`
+	Bytes      int64     `json:"bytes"`
+	Elapsed    Duration  `json:"elapsed"`
+	Throughput float64   `json:"throughput"`
+}
+
+// HistoryProbe is a recorded download of one of the background probes.
+type HistoryProbe struct {
+	Time       time.Time `json:"time"`
+	Probe      string    `json:"probe"`
+	URL        string    `json:"url"`
+	Status     int       `json:"status,omitempty"`
+	Bytes      int64     `json:"bytes"`
+	Elapsed    Duration  `json:"elapsed"`
+	Throughput float64   `json:"throughput"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// HistoryBucket contains the aggregated results of a period of time. The throughput is the average of the successful
+// results.
+type HistoryBucket struct {
+	Time       time.Time `json:"time"`
+	Count      int64     `json:"count"`
+	Failures   int64     `json:"failures"`
+	Bytes      int64     `json:"bytes"`
+	Throughput float64   `json:"throughput"`
+	Min        float64   `json:"min"`
+	Max        float64   `json:"max"`
+}
+
+// HistoryReport is the document returned by the history endpoint. Only one of the fields is set, depending on the
+// kind of results and on whether they are aggregated.
+type HistoryReport struct {
+	Transfers []HistoryTransfer `json:"transfers,omitempty"`
+	Probes    []HistoryProbe    `json:"probes,omitempty"`
+	Buckets   []HistoryBucket   `json:"buckets,omitempty"`
+}
+
+// History records results in a SQLite database, and serves the history endpoint that queries them. Results are
+// written in the background, in batches.
+type History struct {
+	logger    *slog.Logger
+	file      string
+	retention time.Duration
+	db        *sql.DB
+	queue     chan any
+	dropped   atomic.Int64
+	done      chan struct{}
+}
+
+// NewHistory opens, or creates, the database and starts the goroutine that writes the results and removes the ones
+// older than the retention, till the context is cancelled.
+func NewHistory(ctx context.Context, logger *slog.Logger, config *HistoryConfig) (result *History, err error) {
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	retention := time.Duration(config.Retention)
+	if retention == 0 {
+		retention = DefaultHistoryRetention
+	}
+	db, err := sql.Open("sqlite", "file:"+config.File+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		err = fmt.Errorf("failed to open history database '%s': %w", config.File, err)
+		return
+	}
+	_, err = db.ExecContext(ctx, historySchema)
+	if err != nil {
+		db.Close()
+		err = fmt.Errorf("failed to create history tables in '%s': %w", config.File, err)
+		return
+	}
+	history := &History{
+		logger:    logger,
+		file:      config.File,
+		retention: retention,
+		db:        db,
+		queue:     make(chan any, historyQueue),
+		done:      make(chan struct{}),
+	}
+	go history.run(ctx)
+	logger.Info(
+		"Recording history",
+		slog.String("file", config.File),
+		slog.String("retention", retention.String()),
+	)
+	result = history
+	return
+}
+
+// files returns the files of the database that exist, so that they can be given to the unprivileged user.
+func (h *History) files() (result []string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		_, err := os.Stat(h.file + suffix)
+		if err == nil {
+			result = append(result, h.file+suffix)
+		}
+	}
+	return
+}
+
+// RecordTransfer queues a completed transfer for writing.
+func (h *History) RecordTransfer(endpoint string, bytes int64, elapsed time.Duration) {
+	throughput := 0.0
+	if elapsed > 0 {
+		throughput = float64(bytes) / elapsed.Seconds()
+	}
+	h.enqueue(HistoryTransfer{
+		Time:       time.Now().UTC(),
+		Endpoint:   endpoint,
+		Bytes:      bytes,
+		Elapsed:    Duration(elapsed),
+		Throughput: throughput,
+	})
+}
+
+// RecordProbe queues the result of a probe for writing.
+func (h *History) RecordProbe(name string, result *ClientResult) {
+	h.enqueue(HistoryProbe{
+		Time:       result.Start,
+		Probe:      name,
+		URL:        result.URL,
+		Status:     result.Status,
+		Bytes:      result.Bytes,
+		Elapsed:    result.Elapsed,
+		Throughput: result.Throughput,
+		Error:      result.Error,
+	})
+}
+
+// enqueue adds the result to the queue, or discards it if the queue is full.
+func (h *History) enqueue(record any) {
+	select {
+	case h.queue <- record:
+	default:
+		h.dropped.Add(1)
+	}
+}
+
+// run writes the queued results in batches, and periodically removes the old ones.
+func (h *History) run(ctx context.Context) {
+	defer close(h.done)
+	cleanup := time.NewTicker(min(h.retention, time.Hour))
+	defer cleanup.Stop()
+	h.cleanup(ctx)
+	batch := make([]any, 0, historyBatch)
+	for {
+		select {
+		case record := <-h.queue:
+			batch = append(batch[:0], record)
+		loop:
+			for len(batch) < historyBatch {
+				select {
+				case record = <-h.queue:
+					batch = append(batch, record)
+				default:
+					break loop
+				}
+			}
+			err := h.write(ctx, batch)
+			if err != nil {
+				h.logger.Error(
+					"Failed to write history",
+					slog.Int("records", len(batch)),
+					slog.String("error", err.Error()),
+				)
+			}
+		case <-cleanup.C:
+			h.cleanup(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// write inserts the given results in one transaction.
+func (h *History) write(ctx context.Context, batch []any) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, record := range batch {
+		switch record := record.(type) {
+		case HistoryTransfer:
+			_, err = tx.ExecContext(
+				ctx,
+				`insert into transfers (time, endpoint, bytes, elapsed, throughput) values (?, ?, ?, ?, ?)`,
+				record.Time.UnixNano(), record.Endpoint, record.Bytes,
+				time.Duration(record.Elapsed).Seconds(), record.Throughput,
+			)
+		case HistoryProbe:
+			_, err = tx.ExecContext(
+				ctx,
+				`insert into probes (time, probe, url, status, bytes, elapsed, throughput, error) `+
+					`values (?, ?, ?, ?, ?, ?, ?, ?)`,
+				record.Time.UnixNano(), record.Probe, record.URL, record.Status, record.Bytes,
+				time.Duration(record.Elapsed).Seconds(), record.Throughput, record.Error,
+			)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// cleanup removes the results older than the retention, and reports the results discarded because the queue was full.
+func (h *History) cleanup(ctx context.Context) {
+	dropped := h.dropped.Swap(0)
+	if dropped > 0 {
+		h.logger.Warn(
+			"Discarded history because the queue was full",
+			slog.Int64("records", dropped),
+		)
+	}
+	limit := time.Now().Add(-h.retention).UnixNano()
+	for _, table := range []string{HistoryKindTransfers, HistoryKindProbes} {
+		result, err := h.db.ExecContext(ctx, "delete from "+table+" where time < ?", limit)
+		if err != nil {
+			h.logger.Error(
+				"Failed to remove old history",
+				slog.String("table", table),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		count, _ := result.RowsAffected()
+		if count > 0 {
+			h.logger.Info(
+				"Removed old history",
+				slog.String("table", table),
+				slog.Int64("rows", count),
+			)
+		}
+	}
+}
+
+// Close waits till the writer stops, which happens when the context is cancelled, and closes the database. The
+// receiver can be nil, and then it does nothing.
+func (h *History) Close() error {
+	if h == nil {
+		return nil
+	}
+	<-h.done
+	return h.db.Close()
+}
+
+// ServeHTTP is the implementation of the http.Handler interface. The 'kind' query parameter selects 'transfers', the
+// default, or 'probes'. The 'since' and 'until' parameters limit the time range, and they accept a time in RFC 3339
+// format or a duration relative to the current time, like '1h'. The 'probe' and 'endpoint' parameters select the
+// results of one probe or endpoint. The 'limit' parameter is the maximum number of results, the most recent ones, up to
+// ten thousand. With the 'step' parameter, a duration, the results are aggregated in buckets of that size.
+func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	now := time.Now()
+	since, err := parseHistoryTime(query.Get("since"), now, now.Add(-24*time.Hour))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("since isn't valid: %v", err), http.StatusBadRequest)
+		return
+	}
+	until, err := parseHistoryTime(query.Get("until"), now, now)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("until isn't valid: %v", err), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseIntParam(query.Get("limit"), defaultHistoryLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, fmt.Sprintf("limit '%s' should be a positive integer", query.Get("limit")),
+			http.StatusBadRequest)
+		return
+	}
+	if limit > maxHistoryLimit {
+		http.Error(w, fmt.Sprintf("limit %d exceeds the maximum %d", limit, maxHistoryLimit), http.StatusBadRequest)
+		return
+	}
+	var step time.Duration
+	text := query.Get("step")
+	if text != "" {
+		step, err = time.ParseDuration(text)
+		if err != nil || step <= 0 {
+			http.Error(w, fmt.Sprintf("step '%s' should be a positive duration", text), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Build the condition:
+	kind := query.Get("kind")
+	var table, column string
+	switch kind {
+	case "", HistoryKindTransfers:
+		table, column = HistoryKindTransfers, "endpoint"
+		text = query.Get("endpoint")
+	case HistoryKindProbes:
+		table, column = HistoryKindProbes, "probe"
+		text = query.Get("probe")
+	default:
+		http.Error(
+			w,
+			fmt.Sprintf(
+				"kind should be '%s' or '%s', but it is '%s'",
+				HistoryKindTransfers, HistoryKindProbes, kind,
+			),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	where := "time >= ? and time <= ?"
+	args := []any{since.UnixNano(), until.UnixNano()}
+	if text != "" {
+		where += " and " + column + " = ?"
+		args = append(args, text)
+	}
+
+	// Run the query:
+	report := &HistoryReport{}
+	if step > 0 {
+		report.Buckets, err = h.queryBuckets(r.Context(), table, where, args, step, limit)
+	} else if table == HistoryKindTransfers {
+		report.Transfers, err = h.queryTransfers(r.Context(), where, args, limit)
+	} else {
+		report.Probes, err = h.queryProbes(r.Context(), where, args, limit)
+	}
+	if err != nil {
+		h.logger.Error(
+			"Failed to query history",
+			slog.String("error", err.Error()),
+		)
+		http.Error(w, "failed to query history", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(report)
+	if err != nil {
+		h.logger.Error(
+			"Failed to send history",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// queryTransfers returns the most recent transfers that match the condition, sorted by time.
+func (h *History) queryTransfers(ctx context.Context, where string, args []any,
+	limit int) (result []HistoryTransfer, err error) {
+	rows, err := h.db.QueryContext(
+		ctx,
+		`select * from (`+
+			`select time, endpoint, bytes, elapsed, throughput from transfers where `+where+` `+
+			`order by time desc limit `+strconv.Itoa(limit)+
+			`) order by time`,
+		args...,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = []HistoryTransfer{}
+	for rows.Next() {
+		var record HistoryTransfer
+		var nanos int64
+		var elapsed float64
+		err = rows.Scan(&nanos, &record.Endpoint, &record.Bytes, &elapsed, &record.Throughput)
+		if err != nil {
+			return
+		}
+		record.Time = time.Unix(0, nanos).UTC()
+		record.Elapsed = Duration(elapsed * float64(time.Second))
+		result = append(result, record)
+	}
+	err = rows.Err()
+	return
+}
+
+// queryProbes returns the most recent probe results that match the condition, sorted by time.
+func (h *History) queryProbes(ctx context.Context, where string, args []any,
+	limit int) (result []HistoryProbe, err error) {
+	rows, err := h.db.QueryContext(
+		ctx,
+		`select * from (`+
+			`select time, probe, url, status, bytes, elapsed, throughput, error from probes where `+where+` `+
+			`order by time desc limit `+strconv.Itoa(limit)+
+			`) order by time`,
+		args...,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = []HistoryProbe{}
+	for rows.Next() {
+		var record HistoryProbe
+		var nanos int64
+		var elapsed float64
+		err = rows.Scan(
+			&nanos, &record.Probe, &record.URL, &record.Status, &record.Bytes, &elapsed, &record.Throughput,
+			&record.Error,
+		)
+		if err != nil {
+			return
+		}
+		record.Time = time.Unix(0, nanos).UTC()
+		record.Elapsed = Duration(elapsed * float64(time.Second))
+		result = append(result, record)
+	}
+	err = rows.Err()
+	return
+}
+
+// queryBuckets returns the results that match the condition aggregated in buckets of the given size, sorted by time.
+// Transfers never fail, so for them the number of failures is always zero.
+func (h *History) queryBuckets(ctx context.Context, table, where string, args []any, step time.Duration,
+	limit int) (result []HistoryBucket, err error) {
+	failed := "0"
+	success := "1"
+	if table == HistoryKindProbes {
+		failed = "error != ''"
+		success = "error = ''"
+	}
+	bucket := "(time / " + strconv.FormatInt(int64(step), 10) + ")"
+	rows, err := h.db.QueryContext(
+		ctx,
+		`select * from (`+
+			`select `+bucket+` as bucket, count(*), sum(`+failed+`), sum(bytes), `+
+			`coalesce(avg(case when `+success+` then throughput end), 0), `+
+			`coalesce(min(case when `+success+` then throughput end), 0), `+
+			`coalesce(max(case when `+success+` then throughput end), 0) `+
+			`from `+table+` where `+where+` `+
+			`group by bucket order by bucket desc limit `+strconv.Itoa(limit)+
+			`) order by bucket`,
+		args...,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = []HistoryBucket{}
+	for rows.Next() {
+		var record HistoryBucket
+		var index int64
+		err = rows.Scan(
+			&index, &record.Count, &record.Failures, &record.Bytes, &record.Throughput, &record.Min,
+			&record.Max,
+		)
+		if err != nil {
+			return
+		}
+		record.Time = time.Unix(0, index*int64(step)).UTC()
+		result = append(result, record)
+	}
+	err = rows.Err()
+	return
+}
+
+// parseHistoryTime parses a time in RFC 3339 format or a duration relative to the given current time.
+func parseHistoryTime(text string, now, defaultValue time.Time) (result time.Time, err error) {
+	if text == "" {
+		result = defaultValue
+		return
+	}
+	duration, err := time.ParseDuration(text)
+	if err == nil {
+		result = now.Add(-duration.Abs())
+		return
+	}
+	result, err = time.Parse(time.RFC3339, text)
+	if err != nil {
+		err = fmt.Errorf("'%s' should be a time in RFC 3339 format or a duration", text)
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package dummy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestHistoryLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	history, err := NewHistory(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), &HistoryConfig{
+		File: filepath.Join(t.TempDir(), "history.db"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		history.Close()
+	})
+	tests := []struct {
+		limit  string
+		status int
+	}{
+		{limit: "1", status: http.StatusOK},
+		{limit: strconv.Itoa(maxHistoryLimit), status: http.StatusOK},
+		{limit: strconv.Itoa(maxHistoryLimit + 1), status: http.StatusBadRequest},
+		{limit: "9223372036854775807", status: http.StatusBadRequest},
+		{limit: "0", status: http.StatusBadRequest},
+		{limit: "-1", status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.limit, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, HistoryPath+"?limit="+test.limit, nil)
+			recorder := httptest.NewRecorder()
+			history.ServeHTTP(recorder, request)
+			if recorder.Code != test.status {
+				t.Errorf("expected status %d, but got %d: %s", test.status, recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package dummy
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Names of the environment variables that contain the identity of the instance. In Kubernetes these are usually
+// populated using the downward API.
+const (
+	podNameEnv      = "POD_NAME"
+	podNamespaceEnv = "POD_NAMESPACE"
+	nodeNameEnv     = "NODE_NAME"
+	zoneEnv         = "ZONE"
+)
+
+// Names of the response headers that contain the identity of the instance:
+const (
+	instanceHeader  = "X-Dummy-Instance"
+	namespaceHeader = "X-Dummy-Namespace"
+	nodeHeader      = "X-Dummy-Node"
+	zoneHeader      = "X-Dummy-Zone"
+)
+
+// Identity identifies the instance of the server that processed a request, so that when requests are balanced across
+// multiple replicas measurements can be attributed to specific instances.
+type Identity struct {
+	Instance  string
+	Namespace string
+	Node      string
+	Zone      string
+}
+
+// LoadIdentity loads the identity from the environment. The instance name is the name of the pod, or the host name
+// if that isn't available. The namespace is the namespace of the pod, or the one of the service account mounted in
+// the pod if the downward API doesn't provide it.
+func LoadIdentity() Identity {
+	instance := os.Getenv(podNameEnv)
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	namespace := os.Getenv(podNamespaceEnv)
+	if namespace == "" {
+		data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err == nil {
+			namespace = strings.TrimSpace(string(data))
+		}
+	}
+	return Identity{
+		Instance:  instance,
+		Namespace: namespace,
+		Node:      os.Getenv(nodeNameEnv),
+		Zone:      os.Getenv(zoneEnv),
+	}
+}
+
+// InPod checks if the identity is the one of a Kubernetes pod, that is when the namespace is known.
+func (i Identity) InPod() bool {
+	return i.Namespace != ""
+}
+
+// Labels returns the metric labels that contain the identity of the pod, so that the metrics of the replicas can be
+// told apart even if they are collected without the Kubernetes service discovery. Labels whose values are unknown
+// aren't added.
+func (i Identity) Labels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	if i.Instance != "" {
+		labels["pod"] = i.Instance
+	}
+	if i.Namespace != "" {
+		labels["namespace"] = i.Namespace
+	}
+	if i.Node != "" {
+		labels["node"] = i.Node
+	}
+	return labels
+}
+
+// SetHeaders adds the identity headers to the given response headers. Headers whose values are unknown aren't added.
+func (i Identity) SetHeaders(header http.Header) {
+	if i.Instance != "" {
+		header.Set(instanceHeader, i.Instance)
+	}
+	if i.Namespace != "" {
+		header.Set(namespaceHeader, i.Namespace)
+	}
+	if i.Node != "" {
+		header.Set(nodeHeader, i.Node)
+	}
+	if i.Zone != "" {
+		header.Set(zoneHeader, i.Zone)
+	}
+}
+
+// LogAttr returns the log attribute that contains the identity.
+func (i Identity) LogAttr() slog.Attr {
+	return slog.Group(
+		"identity",
+		slog.String("instance", i.Instance),
+		slog.String("namespace", i.Namespace),
+		slog.String("node", i.Node),
+		slog.String("zone", i.Zone),
+	)
+}
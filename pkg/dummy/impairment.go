@@ -0,0 +1,224 @@
+package dummy
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultReorderDelay is the default time that reordered datagrams are held before they are sent.
+const DefaultReorderDelay = 5 * time.Millisecond
+
+// Directions and actions used in the labels of the impairment metrics:
+const (
+	impairmentInbound    = "inbound"
+	impairmentOutbound   = "outbound"
+	impairmentDropped    = "dropped"
+	impairmentReordered  = "reordered"
+	impairmentDuplicated = "duplicated"
+)
+
+// UDPImpairment describes the synthetic impairments that the UDP listeners apply to the datagrams that carry the data,
+// so that the behavior of a transport can be examined without tools like tc and netem. Fields with zero values mean
+// that the corresponding impairment isn't simulated.
+type UDPImpairment struct {
+	// LossRate is the probability, from zero to one, that a datagram will be dropped.
+	LossRate float64
+
+	// ReorderRate is the probability, from zero to one, that a datagram will be delivered after the datagrams that
+	// follow it.
+	ReorderRate float64
+
+	// ReorderDelay is the time that reordered datagrams sent by the listener are held. Received datagrams are instead
+	// held till the next one arrives. The default is five milliseconds.
+	ReorderDelay time.Duration
+
+	// DuplicateRate is the probability, from zero to one, that a datagram will be delivered twice.
+	DuplicateRate float64
+}
+
+// Validate checks that the impairment is valid.
+func (i UDPImpairment) Validate() error {
+	rates := map[string]float64{
+		"loss rate":      i.LossRate,
+		"reorder rate":   i.ReorderRate,
+		"duplicate rate": i.DuplicateRate,
+	}
+	for name, rate := range rates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s should be between zero and one, but it is %g", name, rate)
+		}
+	}
+	if i.ReorderDelay < 0 {
+		return fmt.Errorf("reorder delay can't be negative")
+	}
+	return nil
+}
+
+// Enabled returns true if at least one of the impairments is simulated.
+func (i UDPImpairment) Enabled() bool {
+	return i.LossRate > 0 || i.ReorderRate > 0 || i.DuplicateRate > 0
+}
+
+// impairedPacketConn is a packet connection that applies an impairment to the datagrams that it sends or to the ones
+// that it receives, depending on the direction. Only one direction is impaired because the other one carries the
+// requests and the reports of the raw UDP listeners, and losing them would make the clients wait forever instead of
+// measuring the effect of the impairment. For the same reason empty datagrams are never impaired.
+//
+// The ReadFrom method isn't safe for concurrent use, as it keeps the datagrams that have been held back, but the
+// WriteTo method is.
+type impairedPacketConn struct {
+	net.PacketConn
+	impairment UDPImpairment
+	direction  string
+	counter    *prometheus.CounterVec
+
+	// held is the received datagram that has been held back to reorder it, and pending are the datagrams that will
+	// be returned before reading more from the connection.
+	held    *impairedDatagram
+	pending []*impairedDatagram
+
+	// timers are the reordered datagrams that haven't been sent yet, so that closing the connection can stop them.
+	lock   sync.Mutex
+	timers map[*time.Timer]struct{}
+}
+
+type impairedDatagram struct {
+	data []byte
+	addr net.Addr
+}
+
+// newImpairedPacketConn wraps the given connection so that it applies the impairment to the datagrams of the given
+// direction, 'inbound' or 'outbound'. The counter receives the number of datagrams impaired, labeled by direction and
+// action.
+func newImpairedPacketConn(conn net.PacketConn, impairment UDPImpairment, direction string,
+	counter *prometheus.CounterVec) *impairedPacketConn {
+	if impairment.ReorderDelay == 0 {
+		impairment.ReorderDelay = DefaultReorderDelay
+	}
+	return &impairedPacketConn{
+		PacketConn: conn,
+		impairment: impairment,
+		direction:  direction,
+		counter:    counter,
+		timers:     map[*time.Timer]struct{}{},
+	}
+}
+
+// ReadFrom is the implementation of the net.PacketConn interface.
+func (c *impairedPacketConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	for {
+		if len(c.pending) > 0 {
+			datagram := c.pending[0]
+			c.pending = c.pending[1:]
+			n = copy(p, datagram.data)
+			addr = datagram.addr
+			return
+		}
+		n, addr, err = c.PacketConn.ReadFrom(p)
+		if err != nil || c.direction != impairmentInbound {
+			return
+		}
+
+		// Release the held datagram before empty ones, so that it is counted before the report is requested:
+		if n == 0 {
+			if c.held != nil {
+				c.pending = append(c.pending, c.held, &impairedDatagram{addr: addr})
+				c.held = nil
+				continue
+			}
+			return
+		}
+		if c.roll(c.impairment.LossRate, impairmentInbound, impairmentDropped) {
+			continue
+		}
+		if c.held == nil && c.roll(c.impairment.ReorderRate, impairmentInbound, impairmentReordered) {
+			c.held = &impairedDatagram{
+				data: append([]byte(nil), p[:n]...),
+				addr: addr,
+			}
+			continue
+		}
+		if c.roll(c.impairment.DuplicateRate, impairmentInbound, impairmentDuplicated) {
+			c.pending = append(c.pending, &impairedDatagram{
+				data: append([]byte(nil), p[:n]...),
+				addr: addr,
+			})
+		}
+		if c.held != nil {
+			c.pending = append(c.pending, c.held)
+			c.held = nil
+		}
+		return
+	}
+}
+
+// WriteTo is the implementation of the net.PacketConn interface. Dropped and reordered datagrams are reported as
+// sent, like the network would do.
+func (c *impairedPacketConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	if len(p) == 0 || c.direction != impairmentOutbound {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+	if c.roll(c.impairment.LossRate, impairmentOutbound, impairmentDropped) {
+		n = len(p)
+		return
+	}
+	copies := 1
+	if c.roll(c.impairment.DuplicateRate, impairmentOutbound, impairmentDuplicated) {
+		copies = 2
+	}
+	if c.roll(c.impairment.ReorderRate, impairmentOutbound, impairmentReordered) {
+		c.delay(append([]byte(nil), p...), addr, copies)
+		n = len(p)
+		return
+	}
+	for i := 0; i < copies; i++ {
+		n, err = c.PacketConn.WriteTo(p, addr)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// delay sends the given copies of a datagram after the reorder delay, so that the datagrams sent in the meantime
+// overtake it.
+func (c *impairedPacketConn) delay(data []byte, addr net.Addr, copies int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var timer *time.Timer
+	timer = time.AfterFunc(c.impairment.ReorderDelay, func() {
+		c.lock.Lock()
+		delete(c.timers, timer)
+		c.lock.Unlock()
+		for i := 0; i < copies; i++ {
+			c.PacketConn.WriteTo(data, addr)
+		}
+	})
+	c.timers[timer] = struct{}{}
+}
+
+// Close is the implementation of the net.PacketConn interface. It discards the reordered datagrams that haven't been
+// sent yet.
+func (c *impairedPacketConn) Close() error {
+	c.lock.Lock()
+	for timer := range c.timers {
+		timer.Stop()
+	}
+	c.timers = map[*time.Timer]struct{}{}
+	c.lock.Unlock()
+	return c.PacketConn.Close()
+}
+
+// roll returns true with the given probability, and in that case counts the impaired datagram.
+func (c *impairedPacketConn) roll(rate float64, direction, action string) bool {
+	if rate <= 0 || rand.Float64() >= rate {
+		return false
+	}
+	c.counter.WithLabelValues(direction, action).Inc()
+	return true
+}
@@ -0,0 +1,59 @@
+package dummy
+
+import (
+	"io"
+	"strconv"
+	"text/template"
+)
+
+// Default image used for the Kubernetes resources that run the dummy binary.
+const DefaultImage = "quay.io/jhernand/dummy:latest"
+
+// clientJobTemplate is the template used to generate the Kubernetes job that runs the client. The security context
+// is the same used in the deployment of the server.
+var clientJobTemplate = template.Must(template.New("job").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`apiVersion: batch/v1
+kind: Job
+metadata:
+{{- if .Namespace }}
+  namespace: {{ quote .Namespace }}
+{{- end }}
+  name: {{ quote .Name }}
+spec:
+  backoffLimit: 0
+  template:
+    metadata:
+      labels:
+        app: dummy-client
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: client
+        securityContext:
+          allowPrivilegeEscalation: false
+          runAsNonRoot: true
+          capabilities:
+            drop:
+            - ALL
+          seccompProfile:
+            type: RuntimeDefault
+        image: {{ quote .Image }}
+        imagePullPolicy: Always
+        command:
+        - /usr/local/bin/dummy
+{{- range .Args }}
+        - {{ quote . }}
+{{- end }}
+`))
+
+// WriteClientJob writes to the given writer the YAML manifest of a Kubernetes job that runs the dummy binary with
+// the given arguments. The result can be applied with a command like 'kubectl apply -f -'.
+func WriteClientJob(writer io.Writer, name, namespace, image string, args []string) error {
+	return clientJobTemplate.Execute(writer, map[string]any{
+		"Name":      name,
+		"Namespace": namespace,
+		"Image":     image,
+		"Args":      args,
+	})
+}
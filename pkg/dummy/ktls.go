@@ -0,0 +1,367 @@
+package dummy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Record types of the TLS protocol:
+const tlsRecordApplicationData = 23
+
+// errKernelWrite is returned when the TLS implementation tries to write to a connection that is already using kernel
+// TLS, for example to send an alert.
+var errKernelWrite = errors.New("connection is using kernel TLS")
+
+// listenTLS wraps the given listener so that it accepts TLS connections. When kernel is true the listener tries to
+// hand the encryption of the data sent by the server to the kernel after the handshake.
+func listenTLS(logger *slog.Logger, name string, listener net.Listener, config *tls.Config,
+	kernel bool) net.Listener {
+	if !kernel {
+		return tls.NewListener(listener, config)
+	}
+	return &ktlsListener{
+		Listener: listener,
+		logger:   logger,
+		name:     name,
+		config:   config,
+	}
+}
+
+// ktlsListener is a listener that accepts TLS connections that send data with kernel TLS. The handshake is still
+// performed by the TLS implementation of Go, and then the keys are passed to the kernel, so that the records are
+// encrypted in the kernel and sendfile can be used. This requires Linux, TLS 1.3 and an AES-GCM cipher suite. The
+// connections that can't use kernel TLS fall back to user space TLS. Only data sent by the server is handled by the
+// kernel, data received is still decrypted in user space.
+//
+// Note that the HTTP server doesn't recognize these connections as TLS connections, so they always use HTTP/1, and
+// the details of the TLS connection aren't available to the handlers.
+type ktlsListener struct {
+	net.Listener
+	logger   *slog.Logger
+	name     string
+	config   *tls.Config
+	active   sync.Once
+	fallback sync.Once
+}
+
+// Accept is the implementation of the net.Listener interface.
+func (l *ktlsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	// Each connection needs its own copy of the configuration in order to capture the traffic secrets. Note that
+	// copying the configuration also copies the current session ticket keys, so the rotation still works.
+	secrets := &ktlsSecrets{}
+	config := l.config.Clone()
+	config.NextProtos = []string{"http/1.1"}
+	config.KeyLogWriter = secrets
+	recorder := &ktlsRecorder{
+		Conn:      conn,
+		recording: true,
+	}
+	return &ktlsConn{
+		listener: l,
+		raw:      conn,
+		recorder: recorder,
+		secrets:  secrets,
+		conn:     tls.Server(recorder, config),
+	}, nil
+}
+
+// report writes to the log the result of trying to enable kernel TLS for a connection. The first success and the
+// first failure are written with the info and warning levels, and the rest with the debug level.
+func (l *ktlsListener) report(conn *ktlsConn, err error) {
+	if err != nil {
+		l.fallback.Do(func() {
+			l.logger.Warn(
+				"Failed to enable kernel TLS, using user space TLS",
+				slog.String("listener", l.name),
+				slog.String("error", err.Error()),
+			)
+		})
+		l.logger.Debug(
+			"Connection uses user space TLS",
+			slog.String("listener", l.name),
+			slog.String("remote", conn.raw.RemoteAddr().String()),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	l.active.Do(func() {
+		l.logger.Info(
+			"Kernel TLS is active",
+			slog.String("listener", l.name),
+		)
+	})
+	l.logger.Debug(
+		"Connection uses kernel TLS",
+		slog.String("listener", l.name),
+		slog.String("remote", conn.raw.RemoteAddr().String()),
+	)
+}
+
+// ktlsConn is a TLS connection that uses kernel TLS to send data when possible.
+type ktlsConn struct {
+	listener *ktlsListener
+	raw      net.Conn
+	recorder *ktlsRecorder
+	secrets  *ktlsSecrets
+	conn     *tls.Conn
+	once     sync.Once
+	err      error
+	kernel   atomic.Bool
+}
+
+// handshake performs the TLS handshake, the first time it is called, and then tries to enable kernel TLS.
+func (c *ktlsConn) handshake() error {
+	c.once.Do(func() {
+		c.err = c.conn.Handshake()
+		c.recorder.recording = false
+		if c.err != nil {
+			return
+		}
+		err := c.enable()
+		c.recorder.written = nil
+		c.listener.report(c, err)
+	})
+	return c.err
+}
+
+// enable passes the keys used to send data to the kernel.
+func (c *ktlsConn) enable() error {
+	state := c.conn.ConnectionState()
+	if state.Version != tls.VersionTLS13 {
+		return fmt.Errorf("TLS version %s isn't supported", tls.VersionName(state.Version))
+	}
+	if c.secrets.server == nil {
+		return errors.New("traffic secret isn't available")
+	}
+	key, iv, err := ktlsKeys(state.CipherSuite, c.secrets.server)
+	if err != nil {
+		return err
+	}
+
+	// The TLS implementation may have already sent some records with the application keys, for example the session
+	// tickets, so the kernel needs to start with the next sequence number:
+	seq, err := ktlsSequence(c.recorder.written, key, iv)
+	if err != nil {
+		return err
+	}
+	syscallConn, ok := c.raw.(syscall.Conn)
+	if !ok {
+		return errors.New("connection doesn't have a file descriptor")
+	}
+	rawConn, err := syscallConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	err = enableKTLS(rawConn, key, iv, seq)
+	if err != nil {
+		return err
+	}
+	c.recorder.kernel.Store(true)
+	c.kernel.Store(true)
+	return nil
+}
+
+// Read is the implementation of the io.Reader interface.
+func (c *ktlsConn) Read(p []byte) (int, error) {
+	err := c.handshake()
+	if err != nil {
+		return 0, err
+	}
+	return c.conn.Read(p)
+}
+
+// Write is the implementation of the io.Writer interface.
+func (c *ktlsConn) Write(p []byte) (int, error) {
+	err := c.handshake()
+	if err != nil {
+		return 0, err
+	}
+	if c.kernel.Load() {
+		return c.raw.Write(p)
+	}
+	return c.conn.Write(p)
+}
+
+// ReadFrom is the implementation of the io.ReaderFrom interface. When kernel TLS is active it is what allows the HTTP
+// server and the runtime to send files with sendfile.
+func (c *ktlsConn) ReadFrom(reader io.Reader) (int64, error) {
+	err := c.handshake()
+	if err != nil {
+		return 0, err
+	}
+	if c.kernel.Load() {
+		readerFrom, ok := c.raw.(io.ReaderFrom)
+		if ok {
+			return readerFrom.ReadFrom(reader)
+		}
+	}
+	return io.Copy(struct{ io.Writer }{c}, reader)
+}
+
+// Close is the implementation of the net.Conn interface. Note that when kernel TLS is active the close notify alert
+// isn't sent.
+func (c *ktlsConn) Close() error {
+	if c.kernel.Load() {
+		return c.raw.Close()
+	}
+	return c.conn.Close()
+}
+
+// LocalAddr is the implementation of the net.Conn interface.
+func (c *ktlsConn) LocalAddr() net.Addr {
+	return c.raw.LocalAddr()
+}
+
+// RemoteAddr is the implementation of the net.Conn interface.
+func (c *ktlsConn) RemoteAddr() net.Addr {
+	return c.raw.RemoteAddr()
+}
+
+// SetDeadline is the implementation of the net.Conn interface.
+func (c *ktlsConn) SetDeadline(t time.Time) error {
+	return c.raw.SetDeadline(t)
+}
+
+// SetReadDeadline is the implementation of the net.Conn interface.
+func (c *ktlsConn) SetReadDeadline(t time.Time) error {
+	return c.raw.SetReadDeadline(t)
+}
+
+// SetWriteDeadline is the implementation of the net.Conn interface.
+func (c *ktlsConn) SetWriteDeadline(t time.Time) error {
+	return c.raw.SetWriteDeadline(t)
+}
+
+// ktlsRecorder is the connection used by the TLS implementation. It keeps a copy of the records written during the
+// handshake, and rejects writes once the kernel is in charge of sending data.
+type ktlsRecorder struct {
+	net.Conn
+	recording bool
+	written   []byte
+	kernel    atomic.Bool
+}
+
+// Write is the implementation of the io.Writer interface.
+func (r *ktlsRecorder) Write(p []byte) (int, error) {
+	if r.kernel.Load() {
+		return 0, errKernelWrite
+	}
+	if r.recording {
+		r.written = append(r.written, p...)
+	}
+	return r.Conn.Write(p)
+}
+
+// ktlsSecrets is the key log writer that captures the secret used by the server to encrypt application data.
+type ktlsSecrets struct {
+	server []byte
+}
+
+// Write is the implementation of the io.Writer interface.
+func (s *ktlsSecrets) Write(p []byte) (int, error) {
+	fields := strings.Fields(string(p))
+	if len(fields) == 3 && fields[0] == "SERVER_TRAFFIC_SECRET_0" {
+		secret, err := hex.DecodeString(fields[2])
+		if err == nil {
+			s.server = secret
+		}
+	}
+	return len(p), nil
+}
+
+// ktlsKeys derives from the traffic secret the key and the initialization vector of a TLS 1.3 cipher suite, as
+// described in section 7.3 of RFC 8446.
+func ktlsKeys(suite uint16, secret []byte) (key, iv []byte, err error) {
+	var newHash func() hash.Hash
+	var keySize int
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256:
+		newHash = sha256.New
+		keySize = 16
+	case tls.TLS_AES_256_GCM_SHA384:
+		newHash = sha512.New384
+		keySize = 32
+	default:
+		err = fmt.Errorf("cipher suite %s isn't supported", tls.CipherSuiteName(suite))
+		return
+	}
+	key = expandLabel(newHash, secret, "key", keySize)
+	iv = expandLabel(newHash, secret, "iv", 12)
+	return
+}
+
+// expandLabel implements the HKDF-Expand-Label function of TLS 1.3, with an empty context.
+func expandLabel(newHash func() hash.Hash, secret []byte, label string, size int) []byte {
+	info := []byte{byte(size >> 8), byte(size), byte(len("tls13 ") + len(label))}
+	info = append(info, "tls13 "...)
+	info = append(info, label...)
+	info = append(info, 0)
+	var result, block []byte
+	for counter := byte(1); len(result) < size; counter++ {
+		mac := hmac.New(newHash, secret)
+		mac.Write(block)
+		mac.Write(info)
+		mac.Write([]byte{counter})
+		block = mac.Sum(nil)
+		result = append(result, block...)
+	}
+	return result[:size]
+}
+
+// ktlsSequence calculates the sequence number of the next record from the records written during the handshake. It
+// finds the first record that can be decrypted with the application keys, and counts it and the following ones.
+func ktlsSequence(records, key, iv []byte) (seq uint64, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return
+	}
+	found := false
+	for len(records) >= 5 {
+		size := 5 + int(binary.BigEndian.Uint16(records[3:5]))
+		if len(records) < size {
+			break
+		}
+		header := records[:5]
+		payload := records[5:size]
+		records = records[size:]
+		if header[0] != tlsRecordApplicationData {
+			continue
+		}
+		if !found {
+			// The nonce of the first record is the initialization vector itself:
+			_, openErr := aead.Open(nil, iv, payload, header)
+			if openErr != nil {
+				continue
+			}
+			found = true
+		}
+		seq++
+	}
+	return
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package dummy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants of the kernel TLS interface, from 'linux/tls.h':
+const (
+	ktlsTX              = 1
+	ktlsVersion13       = 0x0304
+	ktlsCipherAESGCM128 = 51
+	ktlsCipherAESGCM256 = 52
+)
+
+// enableKTLS enables kernel TLS for the data sent by the given connection, using the given key, initialization vector
+// and sequence number of the next record.
+func enableKTLS(conn syscall.RawConn, key, iv []byte, seq uint64) error {
+	var cipherType uint16
+	switch len(key) {
+	case 16:
+		cipherType = ktlsCipherAESGCM128
+	case 32:
+		cipherType = ktlsCipherAESGCM256
+	default:
+		return fmt.Errorf("key size %d isn't supported", len(key))
+	}
+
+	// This is the 'tls12_crypto_info_aes_gcm_*' structure. For TLS 1.3 the first four bytes of the initialization
+	// vector are the salt, and the rest are the initialization vector.
+	info := binary.NativeEndian.AppendUint16(nil, ktlsVersion13)
+	info = binary.NativeEndian.AppendUint16(info, cipherType)
+	info = append(info, iv[4:]...)
+	info = append(info, key...)
+	info = append(info, iv[:4]...)
+	info = binary.BigEndian.AppendUint64(info, seq)
+
+	var err error
+	controlErr := conn.Control(func(fd uintptr) {
+		err = unix.SetsockoptString(int(fd), unix.SOL_TCP, unix.TCP_ULP, "tls")
+		if err != nil {
+			err = fmt.Errorf("failed to enable TLS upper layer protocol: %w", err)
+			return
+		}
+		err = unix.SetsockoptString(int(fd), unix.SOL_TLS, ktlsTX, string(info))
+		if err != nil {
+			err = fmt.Errorf("failed to set TLS keys: %w", err)
+		}
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package dummy
+
+import (
+	"errors"
+	"syscall"
+)
+
+// enableKTLS enables kernel TLS for the data sent by the given connection. It is only supported in Linux.
+func enableKTLS(conn syscall.RawConn, key, iv []byte, seq uint64) error {
+	return errors.New("kernel TLS is only supported in Linux")
+}
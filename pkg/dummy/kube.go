@@ -0,0 +1,168 @@
+package dummy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory where Kubernetes mounts the service account credentials inside pods.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubeClient is a minimal client for the Kubernetes API, with just what is needed to watch custom resources and
+// update their status. It avoids the large dependencies of the official client.
+type KubeClient struct {
+	server     string
+	token      string
+	httpClient *http.Client
+}
+
+// KubeEvent is an event received from a Kubernetes watch.
+type KubeEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// NewInClusterKubeClient creates a client using the service account credentials mounted in the pod. The server can
+// be used to override the address of the API server, and then the token and CA files are optional.
+func NewInClusterKubeClient(server string, insecure bool) (result *KubeClient, err error) {
+	if server == "" {
+		host := os.Getenv("KUBERNETES_SERVICE_HOST")
+		port := os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			err = fmt.Errorf("not running inside a cluster and no API server address has been given")
+			return
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+	caData, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	switch {
+	case err == nil:
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(caData)
+	case os.IsNotExist(err):
+	default:
+		return
+	}
+	result = &KubeClient{
+		server: strings.TrimRight(server, "/"),
+		token:  strings.TrimSpace(string(token)),
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+	err = nil
+	return
+}
+
+// Namespace returns the namespace of the pod where the client is running, or an empty string if it isn't known.
+func (c *KubeClient) Namespace() string {
+	data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Get sends a GET request to the given path and parses the response into the given object.
+func (c *KubeClient) Get(ctx context.Context, path string, object any) error {
+	response, err := c.do(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return json.NewDecoder(response.Body).Decode(object)
+}
+
+// Watch starts a watch on the given path and calls the given function for each event received. It returns when the
+// server closes the watch, or when the context is cancelled.
+func (c *KubeClient) Watch(ctx context.Context, path string, resourceVersion string, handler func(*KubeEvent)) error {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	path = fmt.Sprintf("%s%swatch=true&resourceVersion=%s", path, separator, resourceVersion)
+	response, err := c.do(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var event KubeEvent
+		err = decoder.Decode(&event)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		handler(&event)
+	}
+}
+
+// MergePatch sends a JSON merge patch to the given path.
+func (c *KubeClient) MergePatch(ctx context.Context, path string, patch any) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	response, err := c.do(ctx, http.MethodPatch, path, "application/merge-patch+json", data)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func (c *KubeClient) do(ctx context.Context, method, path, contentType string, body []byte) (result *http.Response,
+	err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.server+path, reader)
+	if err != nil {
+		return
+	}
+	request.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		response.Body.Close()
+		err = fmt.Errorf(
+			"request '%s %s' failed with status %d: %s",
+			method, path, response.StatusCode, strings.TrimSpace(string(message)),
+		)
+		return
+	}
+	result = response
+	return
+}
@@ -0,0 +1,116 @@
+package dummy
+
+import (
+	"io"
+	"log/slog"
+	"math/bits"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Number of bits of the sub buckets of the latency histograms. Each power of two is divided in 64 sub buckets, so the
+// values are recorded with a precision better than 2%.
+const latencySubBits = 7
+
+// LatencyHistogram is a high dynamic range histogram of durations. The buckets are linear inside each power of two,
+// like in HdrHistogram, so the relative precision is the same for microseconds and for seconds, and the percentiles
+// show the intermittent stalls that averages hide.
+type LatencyHistogram struct {
+	counts []int64
+	total  int64
+	max    time.Duration
+}
+
+// NewLatencyHistogram creates an empty histogram.
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{
+		counts: make([]int64, latencyIndex(1<<63-1)+1),
+	}
+}
+
+// latencyIndex returns the index of the bucket that contains the given number of nanoseconds. Values smaller than the
+// number of sub buckets are exact, the rest are divided in half as many sub buckets per power of two.
+func latencyIndex(value int64) int {
+	if value < 1<<latencySubBits {
+		return int(value)
+	}
+	shift := bits.Len64(uint64(value)) - latencySubBits
+	half := 1 << (latencySubBits - 1)
+	return 1<<latencySubBits + (shift-1)*half + int(value>>shift) - half
+}
+
+// latencyValue returns the largest number of nanoseconds that is recorded in the bucket with the given index.
+func latencyValue(index int) int64 {
+	if index < 1<<latencySubBits {
+		return int64(index)
+	}
+	half := 1 << (latencySubBits - 1)
+	shift := (index-1<<latencySubBits)/half + 1
+	mantissa := int64((index-1<<latencySubBits)%half + half)
+	return (mantissa+1)<<shift - 1
+}
+
+// Record adds a duration to the histogram. Negative durations are recorded as zero.
+func (h *LatencyHistogram) Record(value time.Duration) {
+	value = max(value, 0)
+	h.counts[latencyIndex(int64(value))]++
+	h.total++
+	h.max = max(h.max, value)
+}
+
+// Count returns the number of durations recorded.
+func (h *LatencyHistogram) Count() int64 {
+	return h.total
+}
+
+// Max returns the largest duration recorded.
+func (h *LatencyHistogram) Max() time.Duration {
+	return h.max
+}
+
+// Percentile returns the given percentile, between zero and one, of the durations recorded. The result is the largest
+// value of the bucket that contains the percentile, but never more than the largest duration recorded.
+func (h *LatencyHistogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := max(int64(p*float64(h.total)+0.5), 1)
+	var seen int64
+	for index, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return min(time.Duration(latencyValue(index)), h.max)
+		}
+	}
+	return h.max
+}
+
+// LogAttr returns the attribute used to write the percentiles of the histogram to the log.
+func (h *LatencyHistogram) LogAttr(name string) slog.Attr {
+	return slog.Group(
+		name,
+		slog.Int64("count", h.total),
+		slog.String("p50", h.Percentile(0.50).String()),
+		slog.String("p99", h.Percentile(0.99).String()),
+		slog.String("p999", h.Percentile(0.999).String()),
+		slog.String("max", h.max.String()),
+	)
+}
+
+// latencyWriter is a writer that records the duration of each write in a histogram and in a Prometheus observer.
+type latencyWriter struct {
+	writer    io.Writer
+	histogram *LatencyHistogram
+	observer  prometheus.Observer
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *latencyWriter) Write(p []byte) (n int, err error) {
+	start := time.Now()
+	n, err = w.writer.Write(p)
+	elapsed := time.Since(start)
+	w.histogram.Record(elapsed)
+	w.observer.Observe(elapsed.Seconds())
+	return
+}
@@ -0,0 +1,330 @@
+package dummy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ListenerConfig is the configuration of one of the listeners of the server. All the listeners serve the same
+// handlers.
+type ListenerConfig struct {
+	// Name is used only in the log.
+	Name string `json:"name,omitempty"`
+
+	// Network is 'tcp' (the default), 'unix' or 'systemd' for a socket passed by systemd with socket activation.
+	Network string `json:"network,omitempty"`
+
+	// Address is the host and port for TCP listeners, the path of the socket for Unix listeners, or the name of the
+	// socket for systemd listeners, as set with the 'FileDescriptorName' option of the socket unit, or its index.
+	Address string `json:"address"`
+
+	// TLS enables TLS. When it is nil the listener accepts plain text HTTP/1 and HTTP/2 with prior knowledge.
+	TLS *ListenerTLSConfig `json:"tls,omitempty"`
+
+	// Multiplex enables plain text HTTP/1 and HTTP/2 in the same port than TLS. It requires TLS.
+	Multiplex bool `json:"multiplex,omitempty"`
+
+	// Raw is the mode of the raw TCP server, 'send' or 'sink', that receives the multiplexed connections that aren't
+	// TLS or HTTP, including those where the client doesn't send anything for two seconds. It requires multiplexing.
+	// Note that the data sent to the sink shouldn't start like a TLS handshake or an HTTP request. When empty those
+	// connections are closed.
+	Raw string `json:"raw,omitempty"`
+
+	// ProxyProtocol is the support for the PROXY protocol header, 'off' (the default), 'optional' or 'required'.
+	ProxyProtocol string `json:"proxy_protocol,omitempty"`
+
+	// ProxyTrusted are the CIDRs of the peers, usually the load balancers, whose PROXY protocol headers are honoured.
+	// Connections from other peers are treated as if they had no header. When empty the headers of all the peers are
+	// honoured.
+	ProxyTrusted []string `json:"proxy_trusted,omitempty"`
+
+	// TCP contains the settings of the TCP connections. It is ignored for Unix listeners.
+	TCP *TCPConfig `json:"tcp,omitempty"`
+
+	// ReusePort is the number of listening sockets opened with the SO_REUSEPORT option, so that connections are
+	// accepted in parallel. Zero or one mean a single socket without that option.
+	ReusePort int `json:"reuse_port,omitempty"`
+}
+
+// ListenerTLSConfig contains the TLS settings of a listener. When the files aren't given the built-in certificate and
+// key are used. Note that there is no setting for 0-RTT because the TLS implementation doesn't support it.
+type ListenerTLSConfig struct {
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+
+	// MinVersion and MaxVersion are the minimum and maximum TLS versions: '1.0', '1.1', '1.2' or '1.3'. The
+	// defaults are '1.2' and '1.3'.
+	MinVersion string `json:"min_version,omitempty"`
+	MaxVersion string `json:"max_version,omitempty"`
+
+	// CipherSuites are the names of the cipher suites enabled for TLS 1.2 and older, for example
+	// 'TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256'. The TLS 1.3 suites can't be configured. The default is a secure
+	// selection ordered by the hardware support.
+	CipherSuites []string `json:"cipher_suites,omitempty"`
+
+	// SessionTickets enables session resumption with tickets. The default is enabled.
+	SessionTickets *bool `json:"session_tickets,omitempty"`
+
+	// TicketRotation is the period after which a new session ticket key is generated. The two previous keys are
+	// still accepted. The default is the automatic rotation of the TLS implementation, daily with tickets valid for
+	// a week.
+	TicketRotation Duration `json:"ticket_rotation,omitempty"`
+
+	// KTLS enables kernel TLS for the data sent by the server, so that the records are encrypted by the kernel and
+	// files can be sent with sendfile. It requires Linux, TLS 1.3 and an AES-GCM cipher suite, and connections that
+	// don't meet these requirements use user space TLS. Connections are always HTTP/1, and the TLS details aren't
+	// available to the handlers.
+	KTLS bool `json:"ktls,omitempty"`
+}
+
+// ServerOptions contains the settings that are applied to all the HTTP servers.
+type ServerOptions struct {
+	// ConnState is called when connections change state.
+	ConnState func(net.Conn, http.ConnState)
+
+	// ReadHeaderTimeout is the time allowed to read the request headers. IdleTimeout is the time that an idle keep
+	// alive connection is kept open. WriteTimeout is the maximum duration of a response, including the body, so it
+	// limits the size of the data that can be downloaded. Zero means no limit.
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+	WriteTimeout      time.Duration
+}
+
+// newServer creates an HTTP server for the given handler with these options.
+func (o ServerOptions) newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ConnState:         o.ConnState,
+		ReadHeaderTimeout: o.ReadHeaderTimeout,
+		IdleTimeout:       o.IdleTimeout,
+		WriteTimeout:      o.WriteTimeout,
+	}
+}
+
+// validate checks that the configuration of the listener is valid.
+func (c *ListenerConfig) validate() error {
+	if c.Address == "" {
+		return fmt.Errorf("address of listener '%s' is mandatory", c.Name)
+	}
+	switch c.Network {
+	case "", "tcp", "tcp4", "tcp6", "unix", NetworkSystemd:
+	default:
+		return fmt.Errorf("network '%s' of listener '%s' isn't supported", c.Network, c.Name)
+	}
+	if c.Multiplex && c.TLS == nil {
+		return fmt.Errorf("listener '%s' can't be multiplexed because it doesn't use TLS", c.Name)
+	}
+	switch c.Raw {
+	case "":
+	case RawModeSend, RawModeSink:
+		if !c.Multiplex {
+			return fmt.Errorf("listener '%s' can't accept raw TCP connections because it isn't multiplexed", c.Name)
+		}
+	default:
+		return fmt.Errorf(
+			"raw mode of listener '%s' should be '%s' or '%s', but it is '%s'",
+			c.Name, RawModeSend, RawModeSink, c.Raw,
+		)
+	}
+	if c.TLS != nil {
+		err := c.TLS.validate()
+		if err != nil {
+			return fmt.Errorf("TLS settings of listener '%s' aren't valid: %w", c.Name, err)
+		}
+	}
+	switch c.ProxyProtocol {
+	case "", ProxyProtocolOff, ProxyProtocolOptional, ProxyProtocolRequired:
+	default:
+		return fmt.Errorf(
+			"PROXY protocol mode of listener '%s' should be '%s', '%s' or '%s', but it is '%s'",
+			c.Name, ProxyProtocolOff, ProxyProtocolOptional, ProxyProtocolRequired, c.ProxyProtocol,
+		)
+	}
+	if len(c.ProxyTrusted) > 0 {
+		if c.ProxyProtocol == "" || c.ProxyProtocol == ProxyProtocolOff {
+			return fmt.Errorf("listener '%s' has trusted PROXY protocol CIDRs, but the protocol is off", c.Name)
+		}
+		_, err := parseProxyTrusted(c.ProxyTrusted)
+		if err != nil {
+			return fmt.Errorf("PROXY protocol settings of listener '%s' aren't valid: %w", c.Name, err)
+		}
+	}
+	if c.ReusePort < 0 {
+		return fmt.Errorf("number of sockets %d of listener '%s' is negative", c.ReusePort, c.Name)
+	}
+	if c.ReusePort > 1 && c.Network == "unix" {
+		return fmt.Errorf("listener '%s' can't use SO_REUSEPORT because it is a Unix listener", c.Name)
+	}
+	if c.ReusePort > 1 && c.Network == NetworkSystemd {
+		return fmt.Errorf("listener '%s' can't use SO_REUSEPORT because it uses a socket passed by systemd", c.Name)
+	}
+	if c.TCP != nil {
+		err := c.TCP.validate()
+		if err != nil {
+			return fmt.Errorf("TCP settings of listener '%s' aren't valid: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// openListener creates the network listener described by the given configuration, including the TCP settings and the
+// processing of the PROXY protocol header if they are enabled.
+func openListener(logger *slog.Logger, config ListenerConfig) (result net.Listener, err error) {
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	network := config.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	// Sockets passed by systemd are already listening, so the options of the socket are those of the socket unit,
+	// and only the settings of the accepted connections are applied:
+	if network == NetworkSystemd {
+		result, err = openSystemdListener(config.Address)
+		if err != nil {
+			return
+		}
+		logger.Info(
+			"Using socket passed by systemd",
+			slog.String("name", config.Name),
+			slog.String("socket", config.Address),
+			slog.String("address", result.Addr().String()),
+		)
+		if config.TCP != nil {
+			result = &tcpListener{
+				Listener: result,
+				noDelay:  config.TCP.NoDelay == nil || *config.TCP.NoDelay,
+			}
+		}
+		if config.ProxyProtocol != "" && config.ProxyProtocol != ProxyProtocolOff {
+			result, err = NewProxyListener(result, config.ProxyProtocol, config.ProxyTrusted)
+		}
+		return
+	}
+
+	// Remove the Unix socket left by a previous run, but nothing else:
+	if network == "unix" {
+		var info fs.FileInfo
+		info, err = os.Lstat(config.Address)
+		if err == nil && info.Mode()&fs.ModeSocket != 0 {
+			err = os.Remove(config.Address)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+	}
+
+	listenConfig := &net.ListenConfig{}
+	if config.TCP != nil && network != "unix" {
+		listenConfig = config.TCP.listenConfig()
+	}
+
+	// When SO_REUSEPORT is enabled open the requested number of sockets. Note that all except the first use the
+	// address of the first, so that they use the same port even if the configuration asks for a random one.
+	count := max(config.ReusePort, 1)
+	if count > 1 {
+		withReusePort(listenConfig)
+	}
+	sockets := make([]net.Listener, count)
+	address := config.Address
+	for i := range sockets {
+		sockets[i], err = listenConfig.Listen(context.Background(), network, address)
+		if err != nil {
+			for _, socket := range sockets[:i] {
+				socket.Close()
+			}
+			return
+		}
+		address = sockets[0].Addr().String()
+	}
+	listener := sockets[0]
+	if count > 1 {
+		logger.Info(
+			"Opened sockets with SO_REUSEPORT",
+			slog.String("name", config.Name),
+			slog.String("address", address),
+			slog.Int("count", count),
+		)
+		listener = newMergedListener(sockets)
+	}
+	if config.TCP != nil && network != "unix" {
+		logTCPSettings(logger, config.Name, config.TCP, sockets[0].(*net.TCPListener))
+		listener = &tcpListener{
+			Listener: listener,
+			noDelay:  config.TCP.NoDelay == nil || *config.TCP.NoDelay,
+		}
+	}
+	if config.ProxyProtocol != "" && config.ProxyProtocol != ProxyProtocolOff {
+		listener, err = NewProxyListener(listener, config.ProxyProtocol, config.ProxyTrusted)
+		if err != nil {
+			return
+		}
+	}
+	result = listener
+	return
+}
+
+// newListenerTLSConfig creates the TLS configuration of the given listener, or nil if the listener doesn't use TLS.
+// The default certificate and key files are used when the configuration doesn't specify them.
+func newListenerTLSConfig(logger *slog.Logger, config ListenerConfig, tlsCrtFile,
+	tlsKeyFile string) (result *tls.Config, err error) {
+	if config.TLS == nil {
+		return
+	}
+	if config.TLS.CertFile != "" {
+		tlsCrtFile = config.TLS.CertFile
+	}
+	if config.TLS.KeyFile != "" {
+		tlsKeyFile = config.TLS.KeyFile
+	}
+	result, err = newTLSConfig(logger, config.Name, config.TLS, tlsCrtFile, tlsKeyFile)
+	return
+}
+
+// serveListener serves the handler with the connections accepted by the given listener, using the protocols enabled
+// in the configuration. The TLS configuration must be nil if the listener doesn't use TLS.
+func serveListener(logger *slog.Logger, config ListenerConfig, listener net.Listener, tlsConfig *tls.Config,
+	handler http.Handler, raw *rawListeners, options ServerOptions) error {
+	logger.Info(
+		"Ready to listen and serve",
+		slog.String("name", config.Name),
+		slog.String("address", listener.Addr().String()),
+		slog.Bool("tls", config.TLS != nil),
+		slog.Bool("multiplex", config.Multiplex),
+		slog.String("raw", config.Raw),
+		slog.String("proxy_protocol", config.ProxyProtocol),
+		slog.Any("proxy_trusted", config.ProxyTrusted),
+	)
+	// Note that the TLS listener is created explicitly, instead of using the ServeTLS method, because that method
+	// copies the configuration, and then the rotation of the session ticket keys would have no effect.
+	newTLSListener := func(listener net.Listener) net.Listener {
+		return listenTLS(logger, config.Name, listener, tlsConfig, config.TLS.KTLS)
+	}
+	switch {
+	case config.Multiplex:
+		var rawServer *RawTCPServer
+		if config.Raw != "" {
+			rawServer = raw.newTCPServer(config.Raw, RawBackendStandard)
+		}
+		return serveMultiplexed(logger, listener, newTLSListener, handler, rawServer, options)
+	case config.TLS != nil:
+		server := options.newServer(handler)
+		return server.Serve(newTLSListener(listener))
+	default:
+		server := options.newServer(h2c.NewHandler(handler, &http2.Server{}))
+		return server.Serve(listener)
+	}
+}
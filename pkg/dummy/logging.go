@@ -0,0 +1,128 @@
+package dummy
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Supported log formats:
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LoggingConfig contains the configuration of the log.
+type LoggingConfig struct {
+	// Level is the minimum level of the messages written to the log: 'debug', 'info' (the default), 'warn' or
+	// 'error'.
+	Level string `json:"level,omitempty"`
+
+	// Format is 'json' (the default) or 'text'.
+	Format string `json:"format,omitempty"`
+
+	// Output is 'stdout' (the default), 'stderr' or the name of a file. Files are opened in append mode.
+	Output string `json:"output,omitempty"`
+
+	// Headers enables writing the headers of each request to the log. It is disabled by default because it makes
+	// the log very large during load tests. It can also be enabled for a single request with the 'verbose' query
+	// parameter.
+	Headers bool `json:"headers,omitempty"`
+
+	// Progress is the interval between the progress messages written to the log during transfers of the data
+	// endpoint, so that long transfers can be charted live. Zero, the default, disables them. It can also be set for
+	// a single request with the 'progress' query parameter.
+	Progress Duration `json:"progress,omitempty"`
+
+	// Summary is where the summary records are written, one line of JSON per request with a stable schema, for
+	// ingestion by log pipelines: 'stdout', 'stderr' or the name of a file. Files are opened in append mode. Empty,
+	// the default, disables them. The records are written independently of the level and format of the log.
+	Summary string `json:"summary,omitempty"`
+}
+
+// validate checks that the level and the format are valid.
+func (c *LoggingConfig) validate() error {
+	var level slog.Level
+	if c.Level != "" {
+		err := level.UnmarshalText([]byte(c.Level))
+		if err != nil {
+			return fmt.Errorf("log level '%s' isn't valid: %w", c.Level, err)
+		}
+	}
+	switch c.Format {
+	case "", LogFormatJSON, LogFormatText:
+	default:
+		return fmt.Errorf(
+			"log format should be '%s' or '%s', but it is '%s'",
+			LogFormatJSON, LogFormatText, c.Format,
+		)
+	}
+	return nil
+}
+
+// Merge returns a copy of the configuration where the fields that are set in the given one replace the current ones.
+// This is used to give precedence to the command line flags over the configuration file. The receiver can be nil.
+func (c *LoggingConfig) Merge(other LoggingConfig) LoggingConfig {
+	var result LoggingConfig
+	if c != nil {
+		result = *c
+	}
+	if other.Level != "" {
+		result.Level = other.Level
+	}
+	if other.Format != "" {
+		result.Format = other.Format
+	}
+	if other.Output != "" {
+		result.Output = other.Output
+	}
+	if other.Headers {
+		result.Headers = true
+	}
+	if other.Progress != 0 {
+		result.Progress = other.Progress
+	}
+	if other.Summary != "" {
+		result.Summary = other.Summary
+	}
+	return result
+}
+
+// NewLogger creates a logger with the level, format and output of the given configuration.
+func NewLogger(config LoggingConfig) (result *slog.Logger, err error) {
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	var writer io.Writer
+	switch config.Output {
+	case "", "stdout":
+		writer = os.Stdout
+	case "stderr":
+		writer = os.Stderr
+	default:
+		writer, err = os.OpenFile(config.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return
+		}
+	}
+	options := &slog.HandlerOptions{}
+	if config.Level != "" {
+		var level slog.Level
+		err = level.UnmarshalText([]byte(config.Level))
+		if err != nil {
+			return
+		}
+		options.Level = level
+	}
+	var handler slog.Handler
+	switch config.Format {
+	case LogFormatText:
+		handler = slog.NewTextHandler(writer, options)
+	default:
+		handler = slog.NewJSONHandler(writer, options)
+	}
+	result = slog.New(handler)
+	return
+}
@@ -0,0 +1,563 @@
+package dummy
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the streaming protocols supported by the media endpoints:
+const (
+	mediaProtocolHLS  = "hls"
+	mediaProtocolDASH = "dash"
+)
+
+// Names of the containers of the HLS segments:
+const (
+	mediaContainerTS   = "ts"
+	mediaContainerFMP4 = "fmp4"
+)
+
+// Defaults and limits of the media endpoints:
+const (
+	defaultMediaSegment  = 6 * time.Second
+	defaultMediaDuration = 10 * time.Minute
+	defaultMediaWindow   = 6
+	minMediaSegment      = 100 * time.Millisecond
+	maxMediaSegment      = time.Minute
+	maxMediaDuration     = 24 * time.Hour
+	maxMediaWindow       = 1000
+	minMediaBitrate      = 10000
+	maxMediaBitrate      = 200000000
+	maxMediaRenditions   = 10
+)
+
+// defaultMediaBitrates are the bitrates of the renditions when the request doesn't specify them.
+var defaultMediaBitrates = []int64{800000, 2500000, 5000000}
+
+// DASHManifest is the XML document that describes a DASH presentation.
+type DASHManifest struct {
+	XMLName                   xml.Name   `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Profiles                  string     `xml:"profiles,attr"`
+	Type                      string     `xml:"type,attr"`
+	MinBufferTime             string     `xml:"minBufferTime,attr"`
+	MediaPresentationDuration string     `xml:"mediaPresentationDuration,attr,omitempty"`
+	AvailabilityStartTime     string     `xml:"availabilityStartTime,attr,omitempty"`
+	PublishTime               string     `xml:"publishTime,attr,omitempty"`
+	MinimumUpdatePeriod       string     `xml:"minimumUpdatePeriod,attr,omitempty"`
+	TimeShiftBufferDepth      string     `xml:"timeShiftBufferDepth,attr,omitempty"`
+	Period                    DASHPeriod `xml:"Period"`
+}
+
+// DASHPeriod is the only period of the DASH presentation.
+type DASHPeriod struct {
+	ID            string            `xml:"id,attr"`
+	Start         string            `xml:"start,attr"`
+	AdaptationSet DASHAdaptationSet `xml:"AdaptationSet"`
+}
+
+// DASHAdaptationSet contains the video renditions of the DASH presentation.
+type DASHAdaptationSet struct {
+	MimeType         string               `xml:"mimeType,attr"`
+	Codecs           string               `xml:"codecs,attr"`
+	SegmentAlignment bool                 `xml:"segmentAlignment,attr"`
+	StartWithSAP     int                  `xml:"startWithSAP,attr"`
+	SegmentTemplate  DASHSegmentTemplate  `xml:"SegmentTemplate"`
+	Representations  []DASHRepresentation `xml:"Representation"`
+}
+
+// DASHSegmentTemplate describes how to build the URLs of the segments of all the renditions.
+type DASHSegmentTemplate struct {
+	Timescale      int    `xml:"timescale,attr"`
+	Duration       int64  `xml:"duration,attr"`
+	StartNumber    int64  `xml:"startNumber,attr"`
+	Initialization string `xml:"initialization,attr"`
+	Media          string `xml:"media,attr"`
+}
+
+// DASHRepresentation is one of the video renditions of the DASH presentation.
+type DASHRepresentation struct {
+	ID        string `xml:"id,attr"`
+	Bandwidth int64  `xml:"bandwidth,attr"`
+	Width     int    `xml:"width,attr"`
+	Height    int    `xml:"height,attr"`
+	FrameRate int    `xml:"frameRate,attr"`
+}
+
+// MediaHandler is an HTTP handler that simulates video streaming with HLS and DASH, so that video CDNs and the
+// buffering of players can be tested without storing real media. The playlists and manifests describe a presentation
+// with one rendition for each bitrate, and the segments contain synthetic video with the size that corresponds to the
+// bitrate and the duration, in the MPEG transport stream or fragmented MP4 formats. The content of the segments has
+// the right framing but it can't be decoded. The paths are:
+//
+//   - /media/hls/master.m3u8 is the HLS multivariant playlist.
+//   - /media/hls/{bitrate}/playlist.m3u8 is the HLS media playlist of a rendition.
+//   - /media/dash/manifest.mpd is the DASH manifest.
+//   - /media/{protocol}/{bitrate}/init.mp4 is the initialization segment of the fragmented MP4 format.
+//   - /media/{protocol}/{bitrate}/{number}.ts or {number}.m4s is a segment.
+//
+// The presentation is controlled with these query parameters, which are also added to the URLs inside the playlists
+// and manifests, so that they apply to all the requests of the player:
+//
+//   - 'bitrates' is a comma separated list of the bitrates of the renditions, in bits per second. The default is
+//     800000, 2500000 and 5000000.
+//   - 'segment' is the duration of each segment. The default is six seconds.
+//   - 'duration' is the total duration of a presentation that isn't live. The default is ten minutes.
+//   - 'live' set to 'true' generates a live presentation, where a new segment is available each segment duration and
+//     the playlists contain only the most recent ones.
+//   - 'window' is the number of segments of a live presentation that are included in the playlists. The default is
+//     six.
+//   - 'container' is the format of the HLS segments, 'ts' or 'fmp4'. The default is 'ts'. DASH always uses 'fmp4'.
+//   - 'pace' is the speed of the transfer of the segments relative to their bitrate, for example 1 sends the segments
+//     in real time and 0.5 makes the player starve. The default is zero, which means to send as fast as possible.
+//
+// The content of the segments depends only on the bitrate, the number and the duration, so it is the same in every
+// instance of the server, and range and conditional requests are supported.
+type MediaHandler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// mediaSettings are the settings of a presentation, extracted from the query parameters. The durations are in units
+// of the media timescale.
+type mediaSettings struct {
+	bitrates  []int64
+	segment   int64
+	duration  int64
+	live      bool
+	window    int64
+	container string
+	pace      float64
+	query     string
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *MediaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+	protocol := r.PathValue("protocol")
+	rendition := r.PathValue("rendition")
+	file := r.PathValue("file")
+	if protocol != mediaProtocolHLS && protocol != mediaProtocolDASH {
+		http.NotFound(w, r)
+		return
+	}
+	settings, err := parseMediaSettings(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if protocol == mediaProtocolDASH {
+		settings.container = mediaContainerFMP4
+	}
+
+	// Playlists and manifests of the presentation:
+	if rendition == "" {
+		switch {
+		case protocol == mediaProtocolHLS && file == "master.m3u8":
+			h.sendHLSMaster(w, settings)
+		case protocol == mediaProtocolDASH && file == "manifest.mpd":
+			h.sendDASHManifest(w, settings)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	// Files of a rendition:
+	bitrate, err := strconv.ParseInt(rendition, 10, 64)
+	if err != nil || !slices.Contains(settings.bitrates, bitrate) {
+		http.NotFound(w, r)
+		return
+	}
+	if protocol == mediaProtocolHLS && file == "playlist.m3u8" {
+		h.sendHLSPlaylist(w, settings, bitrate)
+		return
+	}
+	if file == "init.mp4" && settings.container == mediaContainerFMP4 {
+		w.Header().Set("Content-Type", "video/mp4")
+		http.ServeContent(w, r, file, syntheticModTime, bytes.NewReader(newMP4Init()))
+		return
+	}
+	extension := ".m4s"
+	if settings.container == mediaContainerTS {
+		extension = ".ts"
+	}
+	text, ok := strings.CutSuffix(file, extension)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	number, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || !settings.available(number, time.Now()) {
+		http.NotFound(w, r)
+		return
+	}
+	h.sendSegment(w, r, settings, settings.segmentAt(bitrate, number))
+}
+
+// parseMediaSettings extracts the settings of the presentation from the query parameters.
+func parseMediaSettings(query url.Values) (result *mediaSettings, err error) {
+	result = &mediaSettings{
+		bitrates:  defaultMediaBitrates,
+		live:      query.Get("live") == "true",
+		container: mediaContainerTS,
+		query:     query.Encode(),
+	}
+	text := query.Get("bitrates")
+	if text != "" {
+		result.bitrates = nil
+		for _, item := range strings.Split(text, ",") {
+			bitrate, err := strconv.ParseInt(strings.TrimSpace(item), 10, 64)
+			if err != nil || bitrate < minMediaBitrate || bitrate > maxMediaBitrate {
+				return nil, fmt.Errorf("bitrate '%s' should be a number between %d and %d", item, minMediaBitrate,
+					maxMediaBitrate)
+			}
+			if !slices.Contains(result.bitrates, bitrate) {
+				result.bitrates = append(result.bitrates, bitrate)
+			}
+		}
+		if len(result.bitrates) > maxMediaRenditions {
+			return nil, fmt.Errorf("number of bitrates %d exceeds the maximum %d", len(result.bitrates),
+				maxMediaRenditions)
+		}
+		slices.Sort(result.bitrates)
+	}
+	segment, err := parseMediaDuration(query, "segment", defaultMediaSegment, minMediaSegment, maxMediaSegment)
+	if err != nil {
+		return
+	}
+	result.segment = mediaTicks(segment)
+	duration, err := parseMediaDuration(query, "duration", defaultMediaDuration, segment, maxMediaDuration)
+	if err != nil {
+		return
+	}
+	result.duration = mediaTicks(duration)
+	window, err := parseIntParam(query.Get("window"), defaultMediaWindow)
+	if err != nil || window < 1 || window > maxMediaWindow {
+		err = fmt.Errorf("window '%s' should be a number of segments between 1 and %d", query.Get("window"),
+			maxMediaWindow)
+		return
+	}
+	result.window = int64(window)
+	text = query.Get("container")
+	switch text {
+	case "":
+	case mediaContainerTS, mediaContainerFMP4:
+		result.container = text
+	default:
+		err = fmt.Errorf(
+			"container should be '%s' or '%s', but it is '%s'",
+			mediaContainerTS, mediaContainerFMP4, text,
+		)
+		return
+	}
+	result.pace, err = parseFloatParam(query.Get("pace"), 0)
+	if err != nil || result.pace < 0 || math.IsInf(result.pace, 0) {
+		err = fmt.Errorf("pace '%s' should be a non negative number", query.Get("pace"))
+		return
+	}
+	return
+}
+
+// parseMediaDuration parses a duration query parameter and checks that it is within the given limits.
+func parseMediaDuration(query url.Values, name string, defaultValue, minValue,
+	maxValue time.Duration) (result time.Duration, err error) {
+	text := query.Get(name)
+	if text == "" {
+		result = defaultValue
+		return
+	}
+	result, err = time.ParseDuration(text)
+	if err != nil || result < minValue || result > maxValue {
+		err = fmt.Errorf("%s '%s' should be a duration between %s and %s", name, text, minValue, maxValue)
+	}
+	return
+}
+
+// mediaTicks converts a duration to units of the media timescale, with millisecond precision.
+func mediaTicks(duration time.Duration) int64 {
+	return duration.Milliseconds() * mediaTimescale / 1000
+}
+
+// mediaSeconds converts a number of units of the media timescale to seconds.
+func mediaSeconds(ticks int64) float64 {
+	return float64(ticks) / mediaTimescale
+}
+
+// count returns the number of segments of a presentation that isn't live.
+func (s *mediaSettings) count() int64 {
+	return (s.duration + s.segment - 1) / s.segment
+}
+
+// latest returns the number of the most recent segment of a live presentation that is complete at the given time,
+// or -1 if there is none. Live presentations start at the same time than the modification time of the synthetic
+// data, so that all the instances of the server agree.
+func (s *mediaSettings) latest(now time.Time) int64 {
+	return mediaTicks(now.Sub(syntheticModTime))/s.segment - 1
+}
+
+// span returns the range of segments that the playlists include at the given time.
+func (s *mediaSettings) span(now time.Time) (first, last int64) {
+	if !s.live {
+		return 0, s.count() - 1
+	}
+	last = s.latest(now)
+	first = max(0, last-s.window+1)
+	return
+}
+
+// available checks if the segment with the given number exists at the given time. Live presentations keep all the
+// past segments, so that players can go back in time.
+func (s *mediaSettings) available(number int64, now time.Time) bool {
+	if number < 0 {
+		return false
+	}
+	if s.live {
+		return number <= s.latest(now)
+	}
+	return number < s.count()
+}
+
+// segmentAt returns the description of the segment with the given number. The last segment of a presentation that isn't
+// live may be shorter than the rest.
+func (s *mediaSettings) segmentAt(bitrate, number int64) mediaSegment {
+	result := mediaSegment{
+		number:   number,
+		start:    number * s.segment,
+		duration: s.segment,
+		bitrate:  bitrate,
+	}
+	if !s.live {
+		result.duration = min(result.duration, s.duration-result.start)
+	}
+	return result
+}
+
+// source returns the generator and the size of the given segment.
+func (s *mediaSettings) source(segment mediaSegment) (source DataSource, size int64) {
+	if s.container == mediaContainerTS {
+		nominal := segment
+		nominal.duration = s.segment
+		return newTSSegment(segment, nominal)
+	}
+	return newMP4Segment(segment)
+}
+
+// bandwidth returns the peak bandwidth of a rendition, including the overhead of the container.
+func (s *mediaSettings) bandwidth(bitrate int64) int64 {
+	_, size := s.source(mediaSegment{
+		duration: s.segment,
+		bitrate:  bitrate,
+	})
+	return int64(math.Ceil(float64(size*8) / mediaSeconds(s.segment)))
+}
+
+// uri adds the query parameters of the request to the given relative URI.
+func (s *mediaSettings) uri(path string) string {
+	if s.query == "" {
+		return path
+	}
+	return path + "?" + s.query
+}
+
+// sendHLSMaster sends the HLS multivariant playlist, with one variant for each bitrate.
+func (h *MediaHandler) sendHLSMaster(w http.ResponseWriter, settings *mediaSettings) {
+	var buffer strings.Builder
+	buffer.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&buffer, "#EXT-X-VERSION:%d\n", settings.hlsVersion())
+	buffer.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, bitrate := range settings.bitrates {
+		fmt.Fprintf(
+			&buffer,
+			"#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,CODECS=\"%s\",RESOLUTION=%dx%d,"+
+				"FRAME-RATE=%d.000\n",
+			settings.bandwidth(bitrate), bitrate, mediaCodecs, mediaWidth, mediaHeight, mediaFrameRate,
+		)
+		buffer.WriteString(settings.uri(fmt.Sprintf("%d/playlist.m3u8", bitrate)))
+		buffer.WriteString("\n")
+	}
+	h.sendManifest(w, "application/vnd.apple.mpegurl", settings, buffer.String())
+}
+
+// sendHLSPlaylist sends the HLS media playlist of the rendition with the given bitrate.
+func (h *MediaHandler) sendHLSPlaylist(w http.ResponseWriter, settings *mediaSettings, bitrate int64) {
+	first, last := settings.span(time.Now())
+	var buffer strings.Builder
+	buffer.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&buffer, "#EXT-X-VERSION:%d\n", settings.hlsVersion())
+	fmt.Fprintf(&buffer, "#EXT-X-TARGETDURATION:%d\n", int64(math.Ceil(mediaSeconds(settings.segment))))
+	fmt.Fprintf(&buffer, "#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	if !settings.live {
+		buffer.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	}
+	extension := "ts"
+	if settings.container == mediaContainerFMP4 {
+		extension = "m4s"
+		fmt.Fprintf(&buffer, "#EXT-X-MAP:URI=\"%s\"\n", settings.uri("init.mp4"))
+	}
+	for number := first; number <= last; number++ {
+		segment := settings.segmentAt(bitrate, number)
+		fmt.Fprintf(&buffer, "#EXTINF:%.3f,\n", mediaSeconds(segment.duration))
+		buffer.WriteString(settings.uri(fmt.Sprintf("%d.%s", number, extension)))
+		buffer.WriteString("\n")
+	}
+	if !settings.live {
+		buffer.WriteString("#EXT-X-ENDLIST\n")
+	}
+	h.sendManifest(w, "application/vnd.apple.mpegurl", settings, buffer.String())
+}
+
+// hlsVersion returns the version of the HLS protocol required by the playlists.
+func (s *mediaSettings) hlsVersion() int {
+	if s.container == mediaContainerFMP4 {
+		return 7
+	}
+	return 3
+}
+
+// sendDASHManifest sends the DASH manifest, with one representation for each bitrate.
+func (h *MediaHandler) sendDASHManifest(w http.ResponseWriter, settings *mediaSettings) {
+	manifest := &DASHManifest{
+		Profiles:      "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:          "static",
+		MinBufferTime: dashDuration(2 * settings.segment),
+		Period: DASHPeriod{
+			ID:    "0",
+			Start: dashDuration(0),
+			AdaptationSet: DASHAdaptationSet{
+				MimeType:         "video/mp4",
+				Codecs:           mediaCodecs,
+				SegmentAlignment: true,
+				StartWithSAP:     1,
+				SegmentTemplate: DASHSegmentTemplate{
+					Timescale:      mediaTimescale,
+					Duration:       settings.segment,
+					Initialization: settings.uri("$RepresentationID$/init.mp4"),
+					Media:          settings.uri("$RepresentationID$/$Number$.m4s"),
+				},
+			},
+		},
+	}
+	if settings.live {
+		manifest.Type = "dynamic"
+		manifest.AvailabilityStartTime = syntheticModTime.Format(time.RFC3339)
+		manifest.PublishTime = time.Now().UTC().Format(time.RFC3339)
+		manifest.MinimumUpdatePeriod = dashDuration(settings.segment)
+		manifest.TimeShiftBufferDepth = dashDuration(settings.window * settings.segment)
+	} else {
+		manifest.MediaPresentationDuration = dashDuration(settings.duration)
+	}
+	for _, bitrate := range settings.bitrates {
+		manifest.Period.AdaptationSet.Representations = append(
+			manifest.Period.AdaptationSet.Representations,
+			DASHRepresentation{
+				ID:        strconv.FormatInt(bitrate, 10),
+				Bandwidth: settings.bandwidth(bitrate),
+				Width:     mediaWidth,
+				Height:    mediaHeight,
+				FrameRate: mediaFrameRate,
+			},
+		)
+	}
+	data, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		h.logger.Error(
+			"Failed to encode DASH manifest",
+			slog.String("error", err.Error()),
+		)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.sendManifest(w, "application/dash+xml", settings, xml.Header+string(data)+"\n")
+}
+
+// dashDuration formats a number of units of the media timescale as an XML schema duration.
+func dashDuration(ticks int64) string {
+	return fmt.Sprintf("PT%.3fS", mediaSeconds(ticks))
+}
+
+// sendManifest sends a playlist or manifest. The ones of live presentations change with every segment, so they can't
+// be cached.
+func (h *MediaHandler) sendManifest(w http.ResponseWriter, contentType string, settings *mediaSettings, text string) {
+	w.Header().Set("Content-Type", contentType)
+	if settings.live {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	_, err := io.WriteString(w, text)
+	if err != nil {
+		h.logger.Error(
+			"Failed to send media manifest",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// sendSegment sends the content of a segment, paced if requested.
+func (h *MediaHandler) sendSegment(w http.ResponseWriter, r *http.Request, settings *mediaSettings,
+	segment mediaSegment) {
+	source, size := settings.source(segment)
+	seed := segment.seed(settings.container)
+	w.Header().Set("Content-Type", source.ContentType())
+	w.Header().Set("ETag", `"`+hex.EncodeToString(seed[:8])+`"`)
+	h.logger.Debug(
+		"Serving media segment",
+		slog.String("container", settings.container),
+		slog.Int64("bitrate", segment.bitrate),
+		slog.Int64("number", segment.number),
+		slog.Int64("size", size),
+		slog.String("range", r.Header.Get("Range")),
+	)
+	if settings.pace > 0 {
+		w = &pacedWriter{
+			ResponseWriter: w,
+			ctx:            r.Context(),
+			rate:           settings.pace * float64(segment.bitrate) / 8,
+			start:          time.Now(),
+		}
+	}
+	http.ServeContent(w, r, "", syntheticModTime, newDataSourceReader(source, seed, size))
+}
+
+// pacedWriter is a response writer that waits after each write till the data written is within the given rate, in
+// bytes per second.
+type pacedWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	rate    float64
+	start   time.Time
+	written int64
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *pacedWriter) Write(p []byte) (n int, err error) {
+	n, err = w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	if err != nil {
+		return
+	}
+	delay := time.Duration(float64(w.written)/w.rate*float64(time.Second)) - time.Since(w.start)
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-w.ctx.Done():
+			err = w.ctx.Err()
+		}
+	}
+	return
+}
+
+// Unwrap returns the original response writer, so that it can be flushed with a response controller.
+func (w *pacedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,404 @@
+package dummy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+)
+
+// Characteristics of the synthetic video. The timescale is the MPEG clock, so the same time stamps are used for the
+// transport stream and the fragmented MP4 segments.
+const (
+	mediaTimescale = 90000
+	mediaFrameRate = 30
+	mediaWidth     = 1280
+	mediaHeight    = 720
+	mediaCodecs    = "avc1.64001f"
+)
+
+// Details of the MPEG transport stream segments. The blocks contain a whole number of packets, so that packets can be
+// generated independently, and they are a bit smaller than the default block size.
+const (
+	tsPacketSize   = 188
+	tsPayloadSize  = tsPacketSize - 4
+	tsBlockPackets = sourceBlockSize / tsPacketSize
+	tsPMTPID       = 0x1000
+	tsVideoPID     = 0x100
+	tsStreamH264   = 0x1b
+)
+
+// mediaSPS and mediaPPS are the parameter sets of the synthetic video. They describe a 1280x720 H.264 stream with the
+// high profile, but the slices are random, so it can't be decoded.
+var (
+	mediaSPS = []byte{
+		0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03,
+		0x00, 0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60,
+	}
+	mediaPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+)
+
+// mediaSegment describes a segment of a rendition: the sequence number, the time where it starts and the duration,
+// both in units of the media timescale, and the bitrate of the rendition, in bits per second.
+type mediaSegment struct {
+	number   int64
+	start    int64
+	duration int64
+	bitrate  int64
+}
+
+// frames returns the number of video frames of the segment, at least one.
+func (s mediaSegment) frames() int64 {
+	return max(1, s.duration*mediaFrameRate/mediaTimescale)
+}
+
+// payloadSize returns the number of bytes of video that correspond to the duration and the bitrate of the segment.
+func (s mediaSegment) payloadSize() int64 {
+	return max(8*s.frames(), s.bitrate*s.duration/mediaTimescale/8)
+}
+
+// seed returns the seed of the content of the segment in the given container.
+func (s mediaSegment) seed(container string) [32]byte {
+	return sha256.Sum256([]byte(fmt.Sprintf(
+		"media/%s/%d/%d/%d/%d", container, s.bitrate, s.number, s.start, s.duration,
+	)))
+}
+
+// tsSegment generates a segment in the MPEG transport stream format. It starts with the program association and program
+// map tables, followed by the packets of the video elementary stream. Each frame starts in a new packet, with the
+// clock reference and the time stamps, and the first frame of the segment is a key frame preceded by the parameter
+// sets. The continuity counters continue those of the previous segments, assuming that they all have the nominal
+// duration.
+type tsSegment struct {
+	segment mediaSegment
+	packets int64
+	frames  int64
+	counter int64
+}
+
+// newTSSegment creates the generator for the given segment. The nominal segment is used to calculate the continuity
+// counters. It returns the data source and the size of the segment.
+func newTSSegment(segment, nominal mediaSegment) (source DataSource, size int64) {
+	s := &tsSegment{
+		segment: segment,
+		packets: tsVideoPackets(segment),
+		frames:  segment.frames(),
+		counter: segment.number * tsVideoPackets(nominal),
+	}
+	source = &blockSource{
+		contentType: "video/mp2t",
+		size:        tsBlockPackets * tsPacketSize,
+		fill:        s.fill,
+	}
+	size = (2 + s.packets) * tsPacketSize
+	return
+}
+
+// tsVideoPackets returns the number of packets of the video elementary stream of a segment.
+func tsVideoPackets(segment mediaSegment) int64 {
+	return max(segment.frames(), (segment.payloadSize()+tsPayloadSize-1)/tsPayloadSize)
+}
+
+// fill fills a block with packets. The payloads are random, without zeros, so that they don't contain accidental start
+// codes.
+func (s *tsSegment) fill(block []byte, random *rand.Rand, index int64) {
+	fillRandomBlock(block, random, index)
+	for i, value := range block {
+		if value == 0 {
+			block[i] = 0x80
+		}
+	}
+	for i := 0; i+tsPacketSize <= len(block); i += tsPacketSize {
+		s.packet(block[i:i+tsPacketSize], index*tsBlockPackets+int64(i/tsPacketSize))
+	}
+}
+
+// packet writes the headers of the packet with the given index.
+func (s *tsSegment) packet(packet []byte, index int64) {
+	switch index {
+	case 0:
+		s.table(packet, 0, []byte{
+			0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00,
+			0x00, 0x01, 0xe0 | tsPMTPID>>8, tsPMTPID & 0xff,
+		})
+		return
+	case 1:
+		s.table(packet, tsPMTPID, []byte{
+			0x02, 0xb0, 0x12, 0x00, 0x01, 0xc1, 0x00, 0x00,
+			0xe0 | tsVideoPID>>8, tsVideoPID & 0xff, 0xf0, 0x00,
+			tsStreamH264, 0xe0 | tsVideoPID>>8, tsVideoPID & 0xff, 0xf0, 0x00,
+		})
+		return
+	}
+
+	// Frames are spread evenly, and the packets that remain belong to the last one:
+	video := index - 2
+	perFrame := max(1, s.packets/s.frames)
+	frame := video / perFrame
+	counter := byte((s.counter + video) & 0x0f)
+	packet[0] = 0x47
+	packet[1] = tsVideoPID >> 8
+	packet[2] = tsVideoPID & 0xff
+	if video%perFrame != 0 || frame >= s.frames {
+		packet[3] = 0x10 | counter
+		return
+	}
+	packet[1] |= 0x40
+	packet[3] = 0x30 | counter
+
+	// The adaptation field contains the clock reference, and the random access indicator for the key frame:
+	stamp := uint64(s.segment.start + frame*mediaTimescale/mediaFrameRate)
+	packet[4] = 7
+	packet[5] = 0x10
+	if frame == 0 {
+		packet[5] |= 0x40
+	}
+	packet[6] = byte(stamp >> 25)
+	packet[7] = byte(stamp >> 17)
+	packet[8] = byte(stamp >> 9)
+	packet[9] = byte(stamp >> 1)
+	packet[10] = byte(stamp<<7) | 0x7e
+	packet[11] = 0
+
+	// The header of the elementary stream packet, with the presentation time stamp, followed by an access unit
+	// delimiter and the start of the slice:
+	header := []byte{
+		0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x80, 0x80, 0x05,
+		0x21 | byte(stamp>>29)&0x0e,
+		byte(stamp >> 22),
+		0x01 | byte(stamp>>14)&0xfe,
+		byte(stamp >> 7),
+		0x01 | byte(stamp<<1)&0xfe,
+		0x00, 0x00, 0x00, 0x01, 0x09, 0xf0,
+	}
+	if frame == 0 {
+		header = append(header, 0x00, 0x00, 0x00, 0x01)
+		header = append(header, mediaSPS...)
+		header = append(header, 0x00, 0x00, 0x00, 0x01)
+		header = append(header, mediaPPS...)
+		header = append(header, 0x00, 0x00, 0x00, 0x01, nalIDRSlice)
+	} else {
+		header = append(header, 0x00, 0x00, 0x00, 0x01, nalSlice)
+	}
+	copy(packet[12:], header)
+}
+
+// table writes a packet that contains the given program specific information section, followed by its checksum and
+// stuffing.
+func (s *tsSegment) table(packet []byte, pid int, section []byte) {
+	packet[0] = 0x47
+	packet[1] = 0x40 | byte(pid>>8)
+	packet[2] = byte(pid)
+	packet[3] = 0x10 | byte(s.segment.number&0x0f)
+	packet[4] = 0
+	n := 5 + copy(packet[5:], section)
+	binary.BigEndian.PutUint32(packet[n:], mpegCRC32(section))
+	for i := n + 4; i < len(packet); i++ {
+		packet[i] = 0xff
+	}
+}
+
+// mpegCRC32 calculates the checksum used by the sections of the MPEG transport stream.
+func mpegCRC32(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, value := range data {
+		crc ^= uint32(value) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// mp4Segment generates a media segment in the fragmented MP4 format, used by DASH and optionally by HLS. It contains
+// one fragment with all the frames of the segment, where each frame is a sample with a single network abstraction
+// layer unit. The first frame is a key frame.
+type mp4Segment struct {
+	header  []byte
+	first   int64
+	sample  int64
+	payload *blockSource
+}
+
+// newMP4Segment creates the generator for the given segment. It returns the data source and the size of the segment.
+func newMP4Segment(segment mediaSegment) (source DataSource, size int64) {
+	// All the samples have the same size, except the first that also takes the remainder:
+	frames := segment.frames()
+	payload := segment.payloadSize()
+	s := &mp4Segment{
+		sample: payload / frames,
+	}
+	s.first = payload - (frames-1)*s.sample
+	sizes := mp4U32(uint32(s.first))
+	for i := int64(1); i < frames; i++ {
+		sizes = append(sizes, mp4U32(uint32(s.sample))...)
+	}
+
+	// The offset of the data is relative to the beginning of the fragment, so it is calculated building the fragment
+	// twice:
+	fragment := func(offset uint32) []byte {
+		return mp4Box("moof",
+			mp4FullBox("mfhd", 0, 0, mp4U32(uint32(segment.number+1))),
+			mp4Box("traf",
+				mp4FullBox("tfhd", 0, 0x020028, mp4U32(1, mediaTimescale/mediaFrameRate, 0x01010000)),
+				mp4FullBox("tfdt", 1, 0, mp4U64(uint64(segment.start))),
+				mp4FullBox("trun", 0, 0x000205, mp4U32(uint32(frames), offset, 0x02000000), sizes),
+			),
+		)
+	}
+	moof := fragment(0)
+	moof = fragment(uint32(len(moof) + 8))
+	s.header = mp4Box("styp", []byte("msdh"), mp4U32(0), []byte("msdhmsix"))
+	s.header = append(s.header, moof...)
+	s.header = append(s.header, mp4U32(uint32(8+payload))...)
+	s.header = append(s.header, "mdat"...)
+	s.payload = &blockSource{
+		fill: s.fill,
+	}
+	source = s
+	size = int64(len(s.header)) + payload
+	return
+}
+
+// ContentType is the implementation of the DataSource interface.
+func (s *mp4Segment) ContentType() string {
+	return "video/iso.segment"
+}
+
+// ReadAt is the implementation of the DataSource interface.
+func (s *mp4Segment) ReadAt(seed [32]byte, p []byte, offset int64) {
+	if offset < int64(len(s.header)) {
+		n := copy(p, s.header[offset:])
+		p = p[n:]
+		offset += int64(n)
+	}
+	if len(p) > 0 {
+		s.payload.ReadAt(seed, p, offset-int64(len(s.header)))
+	}
+}
+
+// fill fills a block of the media data with random bytes, and then writes the length and the header of the units
+// that start inside the block.
+func (s *mp4Segment) fill(block []byte, random *rand.Rand, index int64) {
+	fillRandomBlock(block, random, index)
+	base := index * sourceBlockSize
+	end := base + int64(len(block))
+	// Start with the sample before the one that contains the beginning of the block, as its header may continue in
+	// this block:
+	sample := int64(0)
+	if base > s.first {
+		sample = (base - s.first) / s.sample
+	}
+	for {
+		start, size, kind := int64(0), s.first, byte(nalIDRSlice)
+		if sample > 0 {
+			start, size, kind = s.first+(sample-1)*s.sample, s.sample, nalSlice
+		}
+		if start >= end {
+			return
+		}
+		header := binary.BigEndian.AppendUint32(nil, uint32(size-4))
+		header = append(header, kind)
+		for i, value := range header {
+			position := start + int64(i) - base
+			if position >= 0 && position < int64(len(block)) {
+				block[position] = value
+			}
+		}
+		sample++
+	}
+}
+
+// newMP4Init returns the initialization segment of the fragmented MP4 format, which describes the single video track.
+func newMP4Init() []byte {
+	matrix := mp4U32(0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000)
+	avcC := []byte{1, mediaSPS[1], mediaSPS[2], mediaSPS[3], 0xff, 0xe1}
+	avcC = append(avcC, mp4U16(uint16(len(mediaSPS)))...)
+	avcC = append(avcC, mediaSPS...)
+	avcC = append(avcC, 1)
+	avcC = append(avcC, mp4U16(uint16(len(mediaPPS)))...)
+	avcC = append(avcC, mediaPPS...)
+	avc1 := mp4Box("avc1",
+		make([]byte, 6), mp4U16(1), make([]byte, 16),
+		mp4U16(mediaWidth, mediaHeight), mp4U32(0x00480000, 0x00480000, 0), mp4U16(1),
+		make([]byte, 32), mp4U16(0x0018, 0xffff),
+		mp4Box("avcC", avcC),
+	)
+	stbl := mp4Box("stbl",
+		mp4FullBox("stsd", 0, 0, mp4U32(1), avc1),
+		mp4FullBox("stts", 0, 0, mp4U32(0)),
+		mp4FullBox("stsc", 0, 0, mp4U32(0)),
+		mp4FullBox("stsz", 0, 0, mp4U32(0, 0)),
+		mp4FullBox("stco", 0, 0, mp4U32(0)),
+	)
+	minf := mp4Box("minf",
+		mp4FullBox("vmhd", 0, 1, make([]byte, 8)),
+		mp4Box("dinf", mp4FullBox("dref", 0, 0, mp4U32(1), mp4FullBox("url ", 0, 1))),
+		stbl,
+	)
+	mdia := mp4Box("mdia",
+		mp4FullBox("mdhd", 0, 0, mp4U32(0, 0, mediaTimescale, 0), mp4U16(0x55c4, 0)),
+		mp4FullBox("hdlr", 0, 0, mp4U32(0), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00")),
+		minf,
+	)
+	trak := mp4Box("trak",
+		mp4FullBox("tkhd", 0, 3, mp4U32(0, 0, 1, 0, 0, 0, 0), mp4U16(0, 0, 0, 0), matrix,
+			mp4U32(mediaWidth<<16, mediaHeight<<16)),
+		mdia,
+	)
+	moov := mp4Box("moov",
+		mp4FullBox("mvhd", 0, 0, mp4U32(0, 0, mediaTimescale, 0, 0x00010000), mp4U16(0x0100, 0), mp4U32(0, 0),
+			matrix, make([]byte, 24), mp4U32(2)),
+		trak,
+		mp4Box("mvex", mp4FullBox("trex", 0, 0, mp4U32(1, 1, 0, 0, 0))),
+	)
+	return append(mp4Box("ftyp", []byte("iso6"), mp4U32(0), []byte("iso6cmfcmp41")), moov...)
+}
+
+// mp4Box returns a box of the ISO base media file format with the given type and content.
+func mp4Box(kind string, content ...[]byte) []byte {
+	size := 8
+	for _, part := range content {
+		size += len(part)
+	}
+	box := make([]byte, 0, size)
+	box = binary.BigEndian.AppendUint32(box, uint32(size))
+	box = append(box, kind...)
+	for _, part := range content {
+		box = append(box, part...)
+	}
+	return box
+}
+
+// mp4FullBox returns a box that starts with the given version and flags.
+func mp4FullBox(kind string, version byte, flags uint32, content ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return mp4Box(kind, append([][]byte{header}, content...)...)
+}
+
+// mp4U16 returns the big endian encoding of the given values.
+func mp4U16(values ...uint16) []byte {
+	var result []byte
+	for _, value := range values {
+		result = binary.BigEndian.AppendUint16(result, value)
+	}
+	return result
+}
+
+// mp4U32 returns the big endian encoding of the given values.
+func mp4U32(values ...uint32) []byte {
+	var result []byte
+	for _, value := range values {
+		result = binary.BigEndian.AppendUint32(result, value)
+	}
+	return result
+}
+
+// mp4U64 returns the big endian encoding of the given value.
+func mp4U64(value uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, value)
+}
@@ -0,0 +1,400 @@
+package dummy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Path of the endpoint that returns the matrix of measurements between the members of the fleet.
+const MeshPath = "/mesh"
+
+// Defaults of the measurements between the members of the fleet:
+const (
+	DefaultMeshSize = 10 << 20
+
+	// meshPings is the number of pings sent to measure the latency. The result is the minimum, so that the first
+	// one, which includes the connection establishment, is discarded.
+	meshPings = 3
+
+	// meshMaxFetches is the maximum number of members whose measurements are fetched at the same time, and
+	// meshFetchTimeout is the time allowed to fetch the measurements of each member.
+	meshMaxFetches   = 8
+	meshFetchTimeout = 5 * time.Second
+)
+
+// MeshConfig contains the settings of the periodic measurements of the latency and throughput from each member of
+// the fleet to every other member.
+type MeshConfig struct {
+	// Interval is the time between rounds of measurements. Zero disables the measurements.
+	Interval Duration `json:"interval,omitempty"`
+
+	// Size is the number of bytes downloaded from each peer to measure the throughput. The default is 10 MiB.
+	Size int64 `json:"size,omitempty"`
+}
+
+// validate checks that the mesh settings are valid.
+func (c *MeshConfig) validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("mesh interval %s is negative", time.Duration(c.Interval))
+	}
+	if c.Size < 0 {
+		return fmt.Errorf("mesh size %d is negative", c.Size)
+	}
+	return nil
+}
+
+// MeshLink is the last measurement from one member of the fleet to another. The latency is the minimum round trip
+// time of a ping, and the throughput is in bytes per second. When the measurement failed the error is set.
+type MeshLink struct {
+	Source     string    `json:"source"`
+	Target     string    `json:"target"`
+	Time       time.Time `json:"time"`
+	Latency    Duration  `json:"latency,omitempty"`
+	Throughput float64   `json:"throughput,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// MeshReport is the document returned by the mesh endpoint. Members are the identifiers of the members, sorted, and
+// they are the rows, the sources, and the columns, the targets, of the latency matrix, in seconds, and of the
+// throughput matrix, in bytes per second. Cells without measurement are null.
+type MeshReport struct {
+	Members    []string     `json:"members"`
+	Latency    [][]*float64 `json:"latency"`
+	Throughput [][]*float64 `json:"throughput"`
+	Links      []MeshLink   `json:"links"`
+}
+
+// Mesh periodically measures the latency and the throughput from this server to the other members of the fleet. It
+// serves the mesh endpoint, which returns the complete matrix collecting the measurements of the other members.
+type Mesh struct {
+	logger     *slog.Logger
+	fleet      *Fleet
+	interval   time.Duration
+	size       int64
+	client     *http.Client
+	lock       sync.Mutex
+	links      map[string]MeshLink
+	latency    *prometheus.GaugeVec
+	throughput *prometheus.GaugeVec
+	failures   *prometheus.CounterVec
+}
+
+// NewMesh creates the measurements of the given fleet, and registers the metrics with the given registerer. The
+// configuration can be nil, and then there are no measurements, but the endpoint still returns the ones of the other
+// members.
+func NewMesh(logger *slog.Logger, fleet *Fleet, config *MeshConfig, registerer prometheus.Registerer) (result *Mesh,
+	err error) {
+	if config == nil {
+		config = &MeshConfig{}
+	}
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	size := config.Size
+	if size == 0 {
+		size = DefaultMeshSize
+	}
+	latency := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dummy_mesh_latency_seconds",
+			Help: "Minimum ping round trip time from this server, the source, to another member of the fleet.",
+		},
+		[]string{"source", "target"},
+	)
+	throughput := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dummy_mesh_throughput_bytes_per_second",
+			Help: "Throughput of a download from another member of the fleet to this server, the source.",
+		},
+		[]string{"source", "target"},
+	)
+	failures := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_mesh_failures_total",
+			Help: "Number of measurements from this server to another member of the fleet that failed.",
+		},
+		[]string{"source", "target"},
+	)
+	for _, collector := range []prometheus.Collector{latency, throughput, failures} {
+		err = registerer.Register(collector)
+		if err != nil {
+			return
+		}
+	}
+	result = &Mesh{
+		logger:   logger,
+		fleet:    fleet,
+		interval: time.Duration(config.Interval),
+		size:     size,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: fleet.insecure,
+				},
+				MaxConnsPerHost: 1,
+			},
+		},
+		links:      map[string]MeshLink{},
+		latency:    latency,
+		throughput: throughput,
+		failures:   failures,
+	}
+	return
+}
+
+// Start starts measuring periodically, till the context is cancelled. It does nothing if the measurements are
+// disabled.
+func (m *Mesh) Start(ctx context.Context) {
+	if m.interval == 0 {
+		return
+	}
+	m.logger.Info(
+		"Starting mesh measurements",
+		slog.String("interval", m.interval.String()),
+		slog.Int64("size", m.size),
+	)
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			m.measureAll(ctx)
+		}
+	}()
+}
+
+// measureAll measures the links to all the other members of the fleet, one after the other so that the downloads
+// don't compete for the bandwidth of this server, and discards the links to the members that have left.
+func (m *Mesh) measureAll(ctx context.Context) {
+	source := m.fleet.self.ID
+	peers := m.fleet.others()
+	current := map[string]bool{}
+	for _, peer := range peers {
+		if ctx.Err() != nil {
+			return
+		}
+		current[peer.ID] = true
+		link := m.measure(ctx, peer)
+		if link.Error != "" {
+			m.failures.WithLabelValues(source, peer.ID).Inc()
+			m.logger.Debug(
+				"Failed to measure mesh link",
+				slog.String("target", peer.ID),
+				slog.String("error", link.Error),
+			)
+		} else {
+			m.latency.WithLabelValues(source, peer.ID).Set(time.Duration(link.Latency).Seconds())
+			m.throughput.WithLabelValues(source, peer.ID).Set(link.Throughput)
+		}
+		m.lock.Lock()
+		m.links[peer.ID] = link
+		m.lock.Unlock()
+	}
+	m.lock.Lock()
+	for target := range m.links {
+		if !current[target] {
+			delete(m.links, target)
+			m.latency.DeleteLabelValues(source, target)
+			m.throughput.DeleteLabelValues(source, target)
+			m.failures.DeleteLabelValues(source, target)
+		}
+	}
+	m.lock.Unlock()
+}
+
+// measure measures the latency and the throughput to the given member of the fleet.
+func (m *Mesh) measure(ctx context.Context, peer FleetMember) (result MeshLink) {
+	result = MeshLink{
+		Source: m.fleet.self.ID,
+		Target: peer.ID,
+		Time:   time.Now().UTC(),
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+
+	// Measure the latency with pings, which reuse the same connection:
+	var latency time.Duration
+	for i := 0; i < meshPings; i++ {
+		start := time.Now()
+		_, _, err := m.get(ctx, peer.URL+"/ping")
+		if err != nil {
+			result.Error = err.Error()
+			return
+		}
+		elapsed := time.Since(start)
+		if i == 0 || elapsed < latency {
+			latency = elapsed
+		}
+	}
+	result.Latency = Duration(latency)
+
+	// Measure the throughput, excluding the time to the first byte:
+	bytes, elapsed, err := m.get(ctx, peer.URL+"/?size="+strconv.FormatInt(m.size, 10))
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	if elapsed > 0 {
+		result.Throughput = float64(bytes) / elapsed.Seconds()
+	}
+	return
+}
+
+// get sends a GET request to the given address and discards the body. It returns the number of bytes of the body and
+// the time it took to read it.
+func (m *Mesh) get(ctx context.Context, address string) (bytes int64, elapsed time.Duration, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return
+	}
+	response, err := m.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	start := time.Now()
+	bytes, err = io.Copy(io.Discard, response.Body)
+	elapsed = time.Since(start)
+	if err == nil && response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	return
+}
+
+// row returns the last measurements from this server to the other members, sorted by target.
+func (m *Mesh) row() []MeshLink {
+	m.lock.Lock()
+	result := make([]MeshLink, 0, len(m.links))
+	for _, link := range m.links {
+		result = append(result, link)
+	}
+	m.lock.Unlock()
+	slices.SortFunc(result, func(a, b MeshLink) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+	return result
+}
+
+// fetchRow gets the measurements of another member of the fleet.
+func (m *Mesh) fetchRow(ctx context.Context, peer FleetMember) (result []MeshLink, err error) {
+	ctx, cancel := context.WithTimeout(ctx, meshFetchTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, peer.URL+MeshPath+"?scope=local", nil)
+	if err != nil {
+		return
+	}
+	response, err := m.fleet.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %d", response.StatusCode)
+		return
+	}
+	report := &MeshReport{}
+	err = json.NewDecoder(io.LimitReader(response.Body, fleetMaxBody)).Decode(report)
+	if err != nil {
+		return
+	}
+	result = report.Links
+	return
+}
+
+// ServeHTTP is the implementation of the http.Handler interface. With the 'scope=local' query parameter it returns
+// only the measurements of this server, otherwise it collects the measurements of all the members. The measurements of
+// the other members are only collected when the fleet has a token, so that they can only have been added by servers
+// that know it, and no more than eight of them are contacted at the same time.
+func (m *Mesh) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	links := m.row()
+	if r.URL.Query().Get("scope") != "local" && m.fleet.token != "" {
+		peers := m.fleet.others()
+		rows := make([][]MeshLink, len(peers))
+		slots := make(chan struct{}, meshMaxFetches)
+		var wait sync.WaitGroup
+		for i, peer := range peers {
+			slots <- struct{}{}
+			wait.Add(1)
+			go func() {
+				defer func() {
+					<-slots
+					wait.Done()
+				}()
+				var err error
+				rows[i], err = m.fetchRow(r.Context(), peer)
+				if err != nil {
+					m.logger.Info(
+						"Failed to get mesh measurements",
+						slog.String("peer", peer.ID),
+						slog.String("error", err.Error()),
+					)
+				}
+			}()
+		}
+		wait.Wait()
+		for _, row := range rows {
+			links = append(links, row...)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(newMeshReport(links))
+	if err != nil {
+		m.logger.Error(
+			"Failed to send mesh",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// newMeshReport builds the matrices from the given links.
+func newMeshReport(links []MeshLink) *MeshReport {
+	report := &MeshReport{
+		Members: []string{},
+		Links:   links,
+	}
+	for _, link := range links {
+		report.Members = append(report.Members, link.Source, link.Target)
+	}
+	slices.Sort(report.Members)
+	report.Members = slices.Compact(report.Members)
+	index := map[string]int{}
+	for i, member := range report.Members {
+		index[member] = i
+	}
+	report.Latency = make([][]*float64, len(report.Members))
+	report.Throughput = make([][]*float64, len(report.Members))
+	for i := range report.Members {
+		report.Latency[i] = make([]*float64, len(report.Members))
+		report.Throughput[i] = make([]*float64, len(report.Members))
+	}
+	for _, link := range links {
+		if link.Error != "" {
+			continue
+		}
+		latency := time.Duration(link.Latency).Seconds()
+		throughput := link.Throughput
+		report.Latency[index[link.Source]][index[link.Target]] = &latency
+		report.Throughput[index[link.Source]][index[link.Target]] = &throughput
+	}
+	return report
+}
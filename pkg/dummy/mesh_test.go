@@ -0,0 +1,74 @@
+package dummy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMeshFanOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		expected int64
+	}{
+		{
+			name:     "Without token",
+			expected: 0,
+		},
+		{
+			name:     "With token",
+			token:    "secret",
+			expected: 20,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Start a peer that counts the requests and the maximum number of concurrent ones:
+			var requests, current, peak atomic.Int64
+			peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				active := current.Add(1)
+				defer current.Add(-1)
+				for {
+					previous := peak.Load()
+					if active <= previous || peak.CompareAndSwap(previous, active) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				w.Write([]byte(`{"links": []}`))
+			}))
+			defer peer.Close()
+
+			fleet := newTestFleet(t, test.token)
+			for i := 0; i < 20; i++ {
+				fleet.merge(FleetMember{
+					ID:       fmt.Sprintf("member-%d", i),
+					URL:      peer.URL,
+					LastSeen: time.Now(),
+				})
+			}
+			mesh, err := NewMesh(fleet.logger, fleet, nil, prometheus.NewRegistry())
+			if err != nil {
+				t.Fatalf("failed to create mesh: %v", err)
+			}
+			recorder := httptest.NewRecorder()
+			mesh.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, MeshPath, nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected status %d, but got %d", http.StatusOK, recorder.Code)
+			}
+			if requests.Load() != test.expected {
+				t.Errorf("expected %d requests to the peers, but got %d", test.expected, requests.Load())
+			}
+			if peak.Load() > meshMaxFetches {
+				t.Errorf("expected at most %d concurrent requests, but got %d", meshMaxFetches, peak.Load())
+			}
+		})
+	}
+}
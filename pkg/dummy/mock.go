@@ -0,0 +1,260 @@
+package dummy
+
+import (
+	crand "crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MockConfig describes a route that returns a canned response, so that the server can stand in for a backend during
+// integration tests. For example:
+//
+//	{
+//	  "method": "GET",
+//	  "path": "/api/users/{id}",
+//	  "headers": {"Content-Type": "application/json"},
+//	  "body": "{\"id\": {{json (.PathValue \"id\")}}}",
+//	  "template": true,
+//	  "delay": "50ms"
+//	}
+type MockConfig struct {
+	// Name identifies the route in the log and in the metrics. The default is the method followed by the path.
+	Name string `json:"name,omitempty"`
+
+	// Method is the HTTP method of the route. The default is to accept all the methods.
+	Method string `json:"method,omitempty"`
+
+	// Path is the path of the route, with the syntax of the patterns of the standard library, so it can contain
+	// wildcards like '{id}', and when it ends with a slash it matches all the paths that start with it.
+	Path string `json:"path"`
+
+	// Status is the status code of the response. The default is 200.
+	Status int `json:"status,omitempty"`
+
+	// Headers are the headers of the response.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Body is the body of the response. When the template flag is set it is a Go template rendered with the same
+	// variables than the template data source, plus the 'PathValue' method that returns the values of the
+	// wildcards of the path.
+	Body     string `json:"body,omitempty"`
+	Template bool   `json:"template,omitempty"`
+
+	// BodySize is the size of a random body sent instead of the body, so that the route can also be used to test
+	// throughput.
+	BodySize int64 `json:"body_size,omitempty"`
+
+	// Delay is the time waited before sending the response.
+	Delay Duration `json:"delay,omitempty"`
+}
+
+// validate checks that the mock route is valid, and sets the default name.
+func (c *MockConfig) validate() error {
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("path '%s' of mock route should start with a slash", c.Path)
+	}
+	if strings.ContainsAny(c.Method, " \t/") {
+		return fmt.Errorf("method '%s' of mock route '%s' isn't valid", c.Method, c.Path)
+	}
+	if c.Name == "" {
+		c.Name = c.pattern()
+	}
+	if c.Status != 0 && (c.Status < 100 || c.Status > 999) {
+		return fmt.Errorf("status %d of mock route '%s' isn't a valid HTTP status code", c.Status, c.Name)
+	}
+	if c.Body != "" && c.BodySize != 0 {
+		return fmt.Errorf("body and body size of mock route '%s' can't be used together", c.Name)
+	}
+	if c.BodySize < 0 || c.Delay < 0 {
+		return fmt.Errorf("body size and delay of mock route '%s' can't be negative", c.Name)
+	}
+	if c.Template {
+		_, err := parseTemplate(c.Body)
+		if err != nil {
+			return fmt.Errorf("failed to parse body of mock route '%s': %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// pattern returns the pattern of the route, in the syntax of the standard library.
+func (c *MockConfig) pattern() string {
+	if c.Method == "" {
+		return c.Path
+	}
+	return strings.ToUpper(c.Method) + " " + c.Path
+}
+
+// MockHandler serves the mock routes. It is placed in front of the rest of the endpoints, so the mock routes take
+// precedence over the built-in ones, and requests that don't match any route are passed to the next handler.
+type MockHandler struct {
+	logger   *slog.Logger
+	next     RouteHandler
+	mux      *http.ServeMux
+	patterns []string
+	requests *prometheus.CounterVec
+}
+
+// mockRoute is the handler of one mock route.
+type mockRoute struct {
+	handler  *MockHandler
+	config   MockConfig
+	template *template.Template
+	counter  atomic.Int64
+}
+
+// NewMockHandler creates the handler for the given mock routes, passing the rest of the requests to the next handler,
+// and registers the metrics with the given registerer.
+func NewMockHandler(logger *slog.Logger, mocks []MockConfig, next RouteHandler,
+	registerer prometheus.Registerer) (result *MockHandler, err error) {
+	requests := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_mock_requests_total",
+			Help: "Number of requests served by the mock routes.",
+		},
+		[]string{"mock"},
+	)
+	err = registerer.Register(requests)
+	if err != nil {
+		return
+	}
+	handler := &MockHandler{
+		logger:   logger,
+		next:     next,
+		mux:      http.NewServeMux(),
+		requests: requests,
+	}
+	for _, config := range mocks {
+		route := &mockRoute{
+			handler: handler,
+			config:  config,
+		}
+		if config.Template {
+			route.template, err = parseTemplate(config.Body)
+			if err != nil {
+				err = fmt.Errorf("failed to parse body of mock route '%s': %w", config.Name, err)
+				return
+			}
+		}
+		err = handler.register(config.pattern(), route)
+		if err != nil {
+			err = fmt.Errorf("path of mock route '%s' isn't valid: %w", config.Name, err)
+			return
+		}
+	}
+	result = handler
+	return
+}
+
+// register adds a route to the multiplexer, converting the panics caused by invalid or conflicting patterns into
+// errors.
+func (h *MockHandler) register(pattern string, route *mockRoute) (err error) {
+	defer func() {
+		fault := recover()
+		if fault != nil {
+			err = fmt.Errorf("%v", fault)
+		}
+	}()
+	h.mux.Handle(pattern, route)
+	h.patterns = append(h.patterns, pattern)
+	return
+}
+
+// Patterns returns the patterns of the mock routes.
+func (h *MockHandler) Patterns() []string {
+	return h.patterns
+}
+
+// Handler is the implementation of the RouteHandler interface.
+func (h *MockHandler) Handler(r *http.Request) (handler http.Handler, pattern string) {
+	handler, pattern = h.mux.Handler(r)
+	if pattern == "" {
+		handler, pattern = h.next.Handler(r)
+	}
+	return
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *MockHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, pattern := h.mux.Handler(r)
+	if pattern == "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (m *mockRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.requests.WithLabelValues(m.config.Name).Inc()
+	counter := m.counter.Add(1)
+
+	// Prepare the body before the delay, so that errors are reported without waiting:
+	var body []byte
+	var err error
+	switch {
+	case m.template != nil:
+		body, err = renderTemplate(m.template, newTemplateData(r, counter))
+		if err != nil {
+			m.handler.logger.Error(
+				"Failed to render mock body",
+				slog.String("mock", m.config.Name),
+				slog.String("error", err.Error()),
+			)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case m.config.BodySize == 0:
+		body = []byte(m.config.Body)
+	}
+	if m.config.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(m.config.Delay)):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	// Send the response:
+	for name, value := range m.config.Headers {
+		w.Header().Set(name, value)
+	}
+	status := m.config.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	size := int64(len(body))
+	if m.config.BodySize > 0 {
+		size = m.config.BodySize
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if m.config.BodySize > 0 {
+		var seed [32]byte
+		_, err = crand.Read(seed[:])
+		if err == nil {
+			_, err = io.Copy(w, newDataSourceReader(lookupDataSource(sourceRandom), seed, size))
+		}
+	} else {
+		_, err = w.Write(body)
+	}
+	if err != nil {
+		m.handler.logger.Debug(
+			"Failed to send mock body",
+			slog.String("mock", m.config.Name),
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,276 @@
+package dummy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Limits of the sizes tried by the discovery of the path MTU. The minimums are the ones that all the links have to
+// support, 68 bytes for IPv4 and 1280 for IPv6.
+const (
+	DefaultMTUMax = 9000
+	mtuMinIPv4    = 68
+	mtuMinIPv6    = 1280
+
+	// Sizes of the headers included in the size of the packets.
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	icmpHeaderSize = 8
+
+	// mtuAttempts is the number of probes of each size sent before concluding that it is dropped.
+	mtuAttempts = 2
+)
+
+// MTUResult is the result of the discovery of the path MTU. The MTU is the size of the largest IP packet, including
+// headers, that reached the server. When packets larger than that were dropped without an ICMP message telling the
+// sender to use smaller packets the blackhole flag is set, because that breaks the path MTU discovery of TCP and it
+// usually shows up as connections that hang when sending large amounts of data.
+type MTUResult struct {
+	Address   string     `json:"address"`
+	MTU       int        `json:"mtu"`
+	LocalMTU  int        `json:"local_mtu,omitempty"`
+	Blackhole bool       `json:"blackhole"`
+	Reporter  string     `json:"reporter,omitempty"`
+	Probes    []MTUProbe `json:"probes"`
+	Elapsed   Duration   `json:"elapsed"`
+}
+
+// MTUProbe is the result of one probe of the discovery of the path MTU. The result is 'ok' when the server answered,
+// 'too_big' when a router or the local stack reported that the packet was too big, and 'lost' when there was no
+// answer. When a router reported the MTU of the next hop it is in the hop MTU field.
+type MTUProbe struct {
+	Size   int    `json:"size"`
+	Result string `json:"result"`
+	HopMTU int    `json:"hop_mtu,omitempty"`
+	From   string `json:"from,omitempty"`
+}
+
+// Results of the MTU probes:
+const (
+	MTUProbeOK     = "ok"
+	MTUProbeTooBig = "too_big"
+	MTUProbeLost   = "lost"
+)
+
+// DiscoverMTU finds the path MTU to the host of the target URL, sending ICMP echo requests of different sizes with
+// the don't fragment flag set. It needs permission to open raw ICMP sockets, because the unprivileged ones don't
+// receive the messages that routers send when a packet is too big. The maximum is the largest size tried, zero means
+// 9000 bytes.
+func DiscoverMTU(ctx context.Context, target string, maximum int, options ReachOptions) (result *MTUResult,
+	err error) {
+	options = options.withDefaults()
+	ip, _, err := reachTarget(ctx, target)
+	if err != nil {
+		return
+	}
+	if maximum <= 0 {
+		maximum = DefaultMTUMax
+	}
+	v4 := ip.To4() != nil
+	network, listen, minimum, header := "ip4:icmp", "0.0.0.0", mtuMinIPv4, ipv4HeaderSize
+	if !v4 {
+		network, listen, minimum, header = "ip6:ipv6-icmp", "::", mtuMinIPv6, ipv6HeaderSize
+	}
+	config := &net.ListenConfig{
+		Control: func(network, address string, conn syscall.RawConn) error {
+			return setDontFragment(conn, v4)
+		},
+	}
+	packetConn, err := config.ListenPacket(ctx, network, listen)
+	if err != nil {
+		err = fmt.Errorf("MTU discovery needs permission to open raw ICMP sockets: %w", err)
+		return
+	}
+	conn := packetConn.(*net.IPConn)
+	defer conn.Close()
+	start := time.Now()
+	result = &MTUResult{
+		Address: ip.String(),
+	}
+
+	// Binary search of the largest size that gets an answer. The low end is always known to work, and the high end
+	// is the first size known to fail.
+	prober := &mtuProber{
+		conn:    conn,
+		ip:      ip,
+		v4:      v4,
+		id:      os.Getpid() & 0xffff,
+		header:  header,
+		timeout: options.Timeout,
+	}
+	var lost int
+	low, high := minimum, maximum+1
+	probe, err := prober.probe(ctx, low)
+	if err != nil {
+		result = nil
+		return
+	}
+	result.Probes = append(result.Probes, probe)
+	if probe.Result != MTUProbeOK {
+		result = nil
+		err = fmt.Errorf("server doesn't answer to ICMP echo requests of the minimum size, %d bytes", minimum)
+		return
+	}
+	for high-low > 1 {
+		size := (low + high) / 2
+		probe, err = prober.probe(ctx, size)
+		if err != nil {
+			result = nil
+			return
+		}
+		result.Probes = append(result.Probes, probe)
+		switch probe.Result {
+		case MTUProbeOK:
+			low = size
+		case MTUProbeTooBig:
+			high = size
+			if probe.From == "" {
+				result.LocalMTU = size - 1
+			} else {
+				result.Reporter = probe.From
+			}
+			if probe.HopMTU > low && probe.HopMTU < high {
+				// Sizes larger than the MTU reported by the router will also fail:
+				high = probe.HopMTU + 1
+			}
+		case MTUProbeLost:
+			high = size
+			lost++
+		}
+	}
+	result.MTU = low
+	result.Blackhole = lost > 0 && result.Reporter == ""
+	result.Elapsed = Duration(time.Since(start))
+	return
+}
+
+// mtuProber sends the probes of the discovery of the path MTU.
+type mtuProber struct {
+	conn    *net.IPConn
+	ip      net.IP
+	v4      bool
+	id      int
+	seq     int
+	header  int
+	timeout time.Duration
+}
+
+// probe sends echo requests of the given size, including the IP header, till one is answered or the attempts are
+// exhausted.
+func (p *mtuProber) probe(ctx context.Context, size int) (result MTUProbe, err error) {
+	result = MTUProbe{
+		Size:   size,
+		Result: MTUProbeLost,
+	}
+	for attempt := 0; attempt < mtuAttempts; attempt++ {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+		p.seq++
+		result, err = p.exchange(size, p.seq)
+		if err != nil || result.Result != MTUProbeLost {
+			return
+		}
+	}
+	return
+}
+
+// exchange sends one echo request of the given size and waits for the answer.
+func (p *mtuProber) exchange(size, seq int) (result MTUProbe, err error) {
+	result = MTUProbe{
+		Size:   size,
+		Result: MTUProbeLost,
+	}
+	var echoType icmp.Type = ipv4.ICMPTypeEcho
+	protocol := icmpProtocolIPv4
+	if !p.v4 {
+		echoType = ipv6.ICMPTypeEchoRequest
+		protocol = icmpProtocolIPv6
+	}
+	message := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{
+			ID:   p.id,
+			Seq:  seq,
+			Data: make([]byte, size-p.header-icmpHeaderSize),
+		},
+	}
+	data, err := message.Marshal(nil)
+	if err != nil {
+		return
+	}
+	start := time.Now()
+	_, err = p.conn.WriteTo(data, &net.IPAddr{IP: p.ip})
+	if errors.Is(err, syscall.EMSGSIZE) {
+		// The packet is larger than the MTU of the local interface, or of a route cached by the kernel.
+		err = nil
+		result.Result = MTUProbeTooBig
+		return
+	}
+	if err != nil {
+		return
+	}
+	err = p.conn.SetReadDeadline(start.Add(p.timeout))
+	if err != nil {
+		return
+	}
+	buffer := make([]byte, 65536)
+	for {
+		var n int
+		var from net.Addr
+		n, from, err = p.conn.ReadFrom(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = nil
+			}
+			return
+		}
+		var answer *icmp.Message
+		answer, err = icmp.ParseMessage(protocol, buffer[:n])
+		if err != nil {
+			err = nil
+			continue
+		}
+		switch body := answer.Body.(type) {
+		case *icmp.Echo:
+			if answer.Type != ipv4.ICMPTypeEchoReply && answer.Type != ipv6.ICMPTypeEchoReply {
+				continue
+			}
+			if body.ID != p.id || body.Seq != seq {
+				continue
+			}
+			result.Result = MTUProbeOK
+			return
+		case *icmp.DstUnreach:
+			// Code 4 is 'fragmentation needed', and the MTU of the next hop is in the last two bytes of the
+			// header of the message.
+			if answer.Code != 4 || n < icmpHeaderSize || !matchEcho(body.Data, true, p.id, seq) {
+				continue
+			}
+			result.Result = MTUProbeTooBig
+			result.HopMTU = int(binary.BigEndian.Uint16(buffer[6:8]))
+			result.From = from.String()
+			return
+		case *icmp.PacketTooBig:
+			if !matchEcho(body.Data, false, p.id, seq) {
+				continue
+			}
+			result.Result = MTUProbeTooBig
+			result.HopMTU = body.MTU
+			result.From = from.String()
+			return
+		}
+	}
+}
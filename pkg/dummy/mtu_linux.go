@@ -0,0 +1,26 @@
+//go:build linux
+
+package dummy
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDontFragment sets the don't fragment flag in the packets sent by the given socket. The 'probe' mode also makes
+// the kernel ignore the path MTU that it may have cached for the destination, so that the probes measure the path.
+func setDontFragment(conn syscall.RawConn, v4 bool) error {
+	var err error
+	controlErr := conn.Control(func(fd uintptr) {
+		if v4 {
+			err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_PROBE)
+		} else {
+			err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_PROBE)
+		}
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
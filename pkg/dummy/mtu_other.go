@@ -0,0 +1,13 @@
+//go:build !linux
+
+package dummy
+
+import (
+	"errors"
+	"syscall"
+)
+
+// setDontFragment sets the don't fragment flag in the packets sent by the given socket. It is only supported in Linux.
+func setDontFragment(conn syscall.RawConn, v4 bool) error {
+	return errors.New("MTU discovery is only supported in Linux")
+}
@@ -0,0 +1,265 @@
+package dummy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Default time that the multiplexer waits for the first bytes sent by the client. When it expires the connection is
+// dispatched to the default listener, so that protocols where the server speaks first are also supported.
+const defaultMultiplexerPeekTimeout = 2 * time.Second
+
+// Matcher is a function that peeks at the first bytes of a connection and decides if they correspond to a protocol.
+// Matchers must not consume the bytes, only peek at them.
+type Matcher func(reader *bufio.Reader) bool
+
+// Multiplexer accepts connections from a listener and dispatches them to one of several virtual listeners, according
+// to the protocol detected from the first bytes sent by the client. This allows serving different protocols, like TLS
+// and plain text HTTP, in the same port.
+type Multiplexer struct {
+	logger   *slog.Logger
+	listener net.Listener
+	timeout  time.Duration
+	routes   []*multiplexerRoute
+	fallback *multiplexerListener
+}
+
+type multiplexerRoute struct {
+	name     string
+	matcher  Matcher
+	listener *multiplexerListener
+}
+
+// NewMultiplexer creates a multiplexer that accepts connections from the given listener.
+func NewMultiplexer(logger *slog.Logger, listener net.Listener) *Multiplexer {
+	return &Multiplexer{
+		logger:   logger,
+		listener: listener,
+		timeout:  defaultMultiplexerPeekTimeout,
+	}
+}
+
+// Match returns a listener that receives the connections accepted by the given matcher. Matchers are tried in the
+// order they were added.
+func (m *Multiplexer) Match(name string, matcher Matcher) net.Listener {
+	listener := m.newListener()
+	m.routes = append(m.routes, &multiplexerRoute{
+		name:     name,
+		matcher:  matcher,
+		listener: listener,
+	})
+	return listener
+}
+
+// Default returns a listener that receives the connections that don't match any matcher, including those where the
+// client didn't send anything before the peek timeout. If there is no default listener those connections are closed.
+func (m *Multiplexer) Default() net.Listener {
+	if m.fallback == nil {
+		m.fallback = m.newListener()
+	}
+	return m.fallback
+}
+
+func (m *Multiplexer) newListener() *multiplexerListener {
+	return &multiplexerListener{
+		addr:    m.listener.Addr(),
+		conns:   make(chan net.Conn),
+		closing: make(chan struct{}),
+	}
+}
+
+// Serve accepts connections and dispatches them till the underlying listener is closed.
+func (m *Multiplexer) Serve() error {
+	defer func() {
+		for _, route := range m.routes {
+			route.listener.Close()
+		}
+		if m.fallback != nil {
+			m.fallback.Close()
+		}
+	}()
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go m.dispatch(conn)
+	}
+}
+
+func (m *Multiplexer) dispatch(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	err := conn.SetReadDeadline(time.Now().Add(m.timeout))
+	if err != nil {
+		m.logger.Error(
+			"Failed to set peek deadline",
+			slog.String("error", err.Error()),
+		)
+		conn.Close()
+		return
+	}
+	var target *multiplexerListener
+	protocol := "default"
+	_, err = reader.Peek(1)
+	switch {
+	case err == nil:
+		for _, route := range m.routes {
+			if route.matcher(reader) {
+				target = route.listener
+				protocol = route.name
+				break
+			}
+		}
+	case errors.Is(err, os.ErrDeadlineExceeded):
+	default:
+		conn.Close()
+		return
+	}
+	if target == nil {
+		target = m.fallback
+	}
+	if target == nil {
+		m.logger.Info(
+			"Closing connection with unknown protocol",
+			slog.String("remote", conn.RemoteAddr().String()),
+		)
+		conn.Close()
+		return
+	}
+	err = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+	m.logger.Debug(
+		"Dispatching connection",
+		slog.String("remote", conn.RemoteAddr().String()),
+		slog.String("protocol", protocol),
+	)
+	target.deliver(&peekedConn{
+		Conn:   conn,
+		reader: reader,
+	})
+}
+
+// multiplexerListener is a virtual listener that receives the connections dispatched by the multiplexer.
+type multiplexerListener struct {
+	addr      net.Addr
+	conns     chan net.Conn
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept is the implementation of the net.Listener interface.
+func (l *multiplexerListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closing:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close is the implementation of the net.Listener interface.
+func (l *multiplexerListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closing)
+	})
+	return nil
+}
+
+// Addr is the implementation of the net.Listener interface.
+func (l *multiplexerListener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *multiplexerListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closing:
+		conn.Close()
+	}
+}
+
+// peekedConn is a connection whose first bytes have been read into a buffer by the multiplexer. Reads are served
+// from that buffer first.
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read is the implementation of the io.Reader interface.
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// matchTLS matches connections that start with a TLS handshake record.
+func matchTLS(reader *bufio.Reader) bool {
+	data, err := reader.Peek(1)
+	return err == nil && data[0] == 0x16
+}
+
+// httpMethods are the prefixes used to detect HTTP connections. Note that 'PRI ' is the start of the HTTP/2
+// connection preface, so this also matches HTTP/2 with prior knowledge, which is what gRPC uses.
+var httpMethods = [][]byte{
+	[]byte("GET "),
+	[]byte("HEAD "),
+	[]byte("POST "),
+	[]byte("PUT "),
+	[]byte("DELETE "),
+	[]byte("PATCH "),
+	[]byte("OPTIONS "),
+	[]byte("CONNECT "),
+	[]byte("TRACE "),
+	[]byte("PRI "),
+}
+
+// matchHTTP matches plain text HTTP/1 and HTTP/2 connections.
+func matchHTTP(reader *bufio.Reader) bool {
+	for _, method := range httpMethods {
+		data, _ := reader.Peek(len(method))
+		if bytes.Equal(data, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveMultiplexed accepts connections from the given listener and serves the handler using TLS, plain text HTTP/1
+// and plain text HTTP/2 with prior knowledge, all in the same port. The rest of the connections are passed to the given
+// raw TCP server, or closed if it is nil.
+func serveMultiplexed(logger *slog.Logger, listener net.Listener, newTLSListener func(net.Listener) net.Listener,
+	handler http.Handler, rawServer *RawTCPServer, options ServerOptions) error {
+	multiplexer := NewMultiplexer(logger, listener)
+	tlsListener := multiplexer.Match("tls", matchTLS)
+	httpListener := multiplexer.Match("http", matchHTTP)
+	tlsServer := options.newServer(handler)
+	httpServer := options.newServer(h2c.NewHandler(handler, &http2.Server{}))
+	errs := make(chan error, 4)
+	if rawServer != nil {
+		rawListener := multiplexer.Default()
+		go func() {
+			errs <- rawServer.Serve(rawListener)
+		}()
+	}
+	go func() {
+		errs <- tlsServer.Serve(newTLSListener(tlsListener))
+	}()
+	go func() {
+		errs <- httpServer.Serve(httpListener)
+	}()
+	go func() {
+		errs <- multiplexer.Serve()
+	}()
+	return <-errs
+}
@@ -0,0 +1,224 @@
+package dummy
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMultiplexerMatchers(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		tls   bool
+		http  bool
+	}{
+		{
+			name:  "TLS client hello",
+			input: "\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03",
+			tls:   true,
+		},
+		{
+			name:  "HTTP/1 GET",
+			input: "GET / HTTP/1.1\r\n",
+			http:  true,
+		},
+		{
+			name:  "HTTP/1 OPTIONS",
+			input: "OPTIONS * HTTP/1.1\r\n",
+			http:  true,
+		},
+		{
+			name:  "HTTP/2 preface",
+			input: "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n",
+			http:  true,
+		},
+		{
+			name:  "Lowercase method",
+			input: "get / HTTP/1.1\r\n",
+		},
+		{
+			name:  "Method without space",
+			input: "GETX",
+		},
+		{
+			name:  "Short input",
+			input: "GE",
+		},
+		{
+			name:  "SSH banner",
+			input: "SSH-2.0-OpenSSH_9.6\r\n",
+		},
+		{
+			name:  "Binary",
+			input: "\x00\x01\x02\x03",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(test.input))
+			if actual := matchTLS(reader); actual != test.tls {
+				t.Errorf("expected TLS match %t, but got %t", test.tls, actual)
+			}
+			if actual := matchHTTP(reader); actual != test.http {
+				t.Errorf("expected HTTP match %t, but got %t", test.http, actual)
+			}
+
+			// Matchers must not consume the data:
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("failed to read data: %v", err)
+			}
+			if string(data) != test.input {
+				t.Errorf("expected data %q to be preserved, but got %q", test.input, data)
+			}
+		})
+	}
+}
+
+func TestMultiplexerDispatch(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	multiplexer := NewMultiplexer(slog.New(slog.NewTextHandler(io.Discard, nil)), listener)
+	multiplexer.timeout = 100 * time.Millisecond
+	listeners := map[string]net.Listener{
+		"tls":     multiplexer.Match("tls", matchTLS),
+		"http":    multiplexer.Match("http", matchHTTP),
+		"default": multiplexer.Default(),
+	}
+	go multiplexer.Serve()
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "TLS",
+			input:    "\x16\x03\x01",
+			expected: "tls",
+		},
+		{
+			name:     "HTTP",
+			input:    "GET / HTTP/1.1\r\n",
+			expected: "http",
+		},
+		{
+			name:     "Unknown protocol",
+			input:    "hello",
+			expected: "default",
+		},
+		{
+			name:     "Silent client",
+			expected: "default",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer client.Close()
+			if test.input != "" {
+				_, err = client.Write([]byte(test.input))
+				if err != nil {
+					t.Fatalf("failed to write: %v", err)
+				}
+			}
+			conn, err := listeners[test.expected].Accept()
+			if err != nil {
+				t.Fatalf("failed to accept: %v", err)
+			}
+			defer conn.Close()
+
+			// The bytes peeked by the multiplexer should still be readable:
+			if test.input != "" {
+				data := make([]byte, len(test.input))
+				_, err = io.ReadFull(conn, data)
+				if err != nil {
+					t.Fatalf("failed to read: %v", err)
+				}
+				if string(data) != test.input {
+					t.Errorf("expected data %q, but got %q", test.input, data)
+				}
+			}
+		})
+	}
+}
+
+func TestServeMultiplexedRaw(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	registry := prometheus.NewRegistry()
+	random, err := NewRandomSource(randomSourceChaCha8)
+	if err != nil {
+		t.Fatalf("failed to create random source: %v", err)
+	}
+	buffers, err := NewBufferPool(registry)
+	if err != nil {
+		t.Fatalf("failed to create buffer pool: %v", err)
+	}
+	raw, err := newRawListeners(logger, random, buffers, nil, 0, 0, 0, UDPImpairment{}, registry, nil)
+	if err != nil {
+		t.Fatalf("failed to create raw listeners: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("http"))
+	})
+	newTLSListener := func(listener net.Listener) net.Listener {
+		return listener
+	}
+	go serveMultiplexed(logger, listener, newTLSListener, handler, raw.newTCPServer(RawModeSend, RawBackendStandard),
+		ServerOptions{})
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	address := listener.Addr().String()
+
+	// HTTP requests should still go to the handler:
+	response, err := http.Get("http://" + address)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	if string(body) != "http" {
+		t.Errorf("expected body 'http', but got %q", body)
+	}
+
+	// Connections that aren't TLS or HTTP should receive random data from the raw server:
+	client, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer client.Close()
+	_, err = client.Write([]byte("hello"))
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data := make([]byte, 1<<20)
+	_, err = io.ReadFull(client, data)
+	if err != nil {
+		t.Fatalf("failed to read data from the raw server: %v", err)
+	}
+}
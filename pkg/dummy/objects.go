@@ -0,0 +1,130 @@
+package dummy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+)
+
+// Limits of the size of the synthetic objects:
+const (
+	objectMinSize = 1 << 10 // 1 KiB
+	objectMaxSize = 1 << 20 // 1 MiB
+)
+
+// Size of the blocks that the content of the synthetic objects is divided into. Each block is generated independently,
+// so that reading from the middle of an object doesn't require generating everything before it.
+const objectBlockSize = 64 * (1 << 10) // 64 KiB
+
+// ObjectsHandler is an HTTP handler that serves a virtual filesystem of synthetic objects. The size and the content of
+// each object are derived from its name with a hash, so the same name always returns the same data, in this or any
+// other instance of the server, and cache and CDN tests can request thousands of distinct objects without storage.
+// Range requests and conditional requests are supported.
+type ObjectsHandler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *ObjectsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+	name := r.PathValue("name")
+	object := newSyntheticObject(name)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", object.ETag())
+	h.logger.Debug(
+		"Serving object",
+		slog.String("name", name),
+		slog.Int64("size", object.size),
+		slog.String("range", r.Header.Get("Range")),
+	)
+	http.ServeContent(w, r, name, syntheticModTime, object)
+}
+
+// syntheticObject is a read only view of the content of a synthetic object.
+type syntheticObject struct {
+	seed   [32]byte
+	size   int64
+	offset int64
+	index  int64
+	block  []byte
+}
+
+// newSyntheticObject creates the synthetic object for the given name.
+func newSyntheticObject(name string) *syntheticObject {
+	seed := sha256.Sum256([]byte(name))
+	size := objectMinSize + int64(binary.LittleEndian.Uint64(seed[:])%(objectMaxSize-objectMinSize+1))
+	return newSyntheticData(seed, size)
+}
+
+// newSyntheticData creates a synthetic object with the given seed and size.
+func newSyntheticData(seed [32]byte, size int64) *syntheticObject {
+	return &syntheticObject{
+		seed:  seed,
+		size:  size,
+		index: -1,
+	}
+}
+
+// ETag returns the entity tag of the object, which is derived from the same hash than the content.
+func (o *syntheticObject) ETag() string {
+	return `"` + hex.EncodeToString(o.seed[:8]) + `"`
+}
+
+// Read is the implementation of the io.Reader interface.
+func (o *syntheticObject) Read(p []byte) (n int, err error) {
+	for n < len(p) && o.offset < o.size {
+		index := o.offset / objectBlockSize
+		if index != o.index {
+			o.generate(index)
+		}
+		count := copy(p[n:], o.block[o.offset%objectBlockSize:])
+		n += count
+		o.offset += int64(count)
+	}
+	if n == 0 && len(p) > 0 {
+		err = io.EOF
+	}
+	return
+}
+
+// Seek is the implementation of the io.Seeker interface.
+func (o *syntheticObject) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+// generate fills the buffer with the content of the given block, using a generator seeded with the hash of the name
+// and the index of the block. The last block may be shorter than the rest.
+func (o *syntheticObject) generate(index int64) {
+	var input [40]byte
+	copy(input[:], o.seed[:])
+	binary.LittleEndian.PutUint64(input[32:], uint64(index))
+	reader := &chaCha8Reader{
+		generator: rand.NewChaCha8(sha256.Sum256(input[:])),
+	}
+	size := min(objectBlockSize, o.size-index*objectBlockSize)
+	if o.block == nil {
+		o.block = make([]byte, objectBlockSize)
+	}
+	o.block = o.block[:size]
+	reader.Read(o.block)
+	o.index = index
+}
@@ -0,0 +1,216 @@
+package dummy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default time between the moment the orchestrator sends the workload and the moment the agents start it. It should
+// be larger than the time needed to reach all the agents.
+const DefaultOrchestrateStartDelay = 2 * time.Second
+
+// OrchestrateOptions contains the settings of the orchestrator.
+type OrchestrateOptions struct {
+	// Agents are the base URLs of the agents, for example 'https://10.0.0.1:8553'.
+	Agents []string
+
+	// Token is the secret shared with the agents.
+	Token string
+
+	// Control contains the settings of the HTTP transport used to talk to the agents. Only the TLS settings, the
+	// proxy and the address overrides are relevant.
+	Control TransportOptions
+
+	// Workload is the workload that each of the agents runs. The delay is calculated by the orchestrator.
+	Workload AgentRunRequest
+
+	// StartDelay is the time between sending the workload and the start of the load. The default is two seconds.
+	StartDelay time.Duration
+}
+
+// OrchestrateResult is the report of a workload run simultaneously by several agents. The totals are the sums of the
+// results of the agents that succeeded. StartSpread is the difference between the first and the last start times
+// reported by the agents, which is only meaningful if their clocks are synchronized.
+type OrchestrateResult struct {
+	Target      string                    `json:"target"`
+	Agents      []*OrchestrateAgentResult `json:"agents"`
+	Failed      int                       `json:"failed"`
+	Connections int                       `json:"connections"`
+	Requests    int                       `json:"requests"`
+	Errors      int                       `json:"errors"`
+	Bytes       int64                     `json:"bytes"`
+	Throughput  float64                   `json:"throughput"`
+	StartSpread Duration                  `json:"start_spread"`
+}
+
+// OrchestrateAgentResult is the result of one of the agents. When the agent failed the error is set and the rest of
+// the fields are empty.
+type OrchestrateAgentResult struct {
+	URL   string `json:"url"`
+	Error string `json:"error,omitempty"`
+	*AgentRunResult
+}
+
+// Orchestrator sends the same workload to several agents, so that they generate load simultaneously, and aggregates
+// their results. This is used to measure the aggregate bandwidth of things like the ingress of a cluster, which a
+// single client can't saturate.
+type Orchestrator struct {
+	logger  *slog.Logger
+	options OrchestrateOptions
+	client  *http.Client
+}
+
+// NewOrchestrator creates an orchestrator with the given options.
+func NewOrchestrator(logger *slog.Logger, options OrchestrateOptions) (result *Orchestrator, err error) {
+	if len(options.Agents) == 0 {
+		err = errors.New("at least one agent is required")
+		return
+	}
+	if options.Token == "" {
+		err = errors.New("token is mandatory")
+		return
+	}
+	if options.Workload.Target == "" {
+		err = errors.New("target is mandatory")
+		return
+	}
+	if options.StartDelay == 0 {
+		options.StartDelay = DefaultOrchestrateStartDelay
+	}
+	if options.StartDelay < 0 {
+		err = fmt.Errorf("start delay %s is negative", options.StartDelay)
+		return
+	}
+
+	// Check the workload locally, so that mistakes are reported before contacting the agents:
+	_, err = NewBench(logger, options.Workload.benchOptions())
+	if err != nil {
+		err = fmt.Errorf("workload isn't valid: %w", err)
+		return
+	}
+	transport, err := NewTransport(options.Control)
+	if err != nil {
+		return
+	}
+	result = &Orchestrator{
+		logger:  logger,
+		options: options,
+		client: &http.Client{
+			Transport: transport,
+		},
+	}
+	return
+}
+
+// Run sends the workload to all the agents, waits for their results and aggregates them.
+func (o *Orchestrator) Run(ctx context.Context) (result *OrchestrateResult, err error) {
+	start := time.Now().Add(o.options.StartDelay)
+	results := make([]*OrchestrateAgentResult, len(o.options.Agents))
+	var wait sync.WaitGroup
+	for i, agent := range o.options.Agents {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			results[i] = &OrchestrateAgentResult{
+				URL: agent,
+			}
+			runResult, err := o.send(ctx, agent, start)
+			if err != nil {
+				o.logger.Error(
+					"Agent failed",
+					slog.String("agent", agent),
+					slog.String("error", err.Error()),
+				)
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].AgentRunResult = runResult
+		}()
+	}
+	wait.Wait()
+
+	// Aggregate the results:
+	result = &OrchestrateResult{
+		Target: o.options.Workload.Target,
+		Agents: results,
+	}
+	var first, last time.Time
+	for _, agent := range results {
+		if agent.AgentRunResult == nil || agent.BenchResult == nil {
+			result.Failed++
+			continue
+		}
+		result.Connections += agent.Connections
+		result.Requests += agent.Requests
+		result.Errors += agent.Errors
+		result.Bytes += agent.Bytes
+		result.Throughput += agent.Throughput
+		if first.IsZero() || agent.Start.Before(first) {
+			first = agent.Start
+		}
+		if last.IsZero() || agent.Start.After(last) {
+			last = agent.Start
+		}
+	}
+	result.StartSpread = Duration(last.Sub(first))
+	o.logger.Info(
+		"Orchestrated workload finished",
+		slog.Int("agents", len(results)),
+		slog.Int("failed", result.Failed),
+		slog.Int("requests", result.Requests),
+		slog.Int("errors", result.Errors),
+		slog.Int64("bytes", result.Bytes),
+		slog.Float64("throughput", result.Throughput),
+		slog.String("start_spread", time.Duration(result.StartSpread).String()),
+	)
+	return
+}
+
+// send sends the workload to one agent and waits for the result. The delay is calculated just before sending, so
+// that all the agents start at the given time regardless of how long it took to contact the previous ones.
+func (o *Orchestrator) send(ctx context.Context, agent string, start time.Time) (result *AgentRunResult,
+	err error) {
+	workload := o.options.Workload
+	workload.Delay = Duration(max(time.Until(start), 0))
+	body, err := json.Marshal(&workload)
+	if err != nil {
+		return
+	}
+	address := strings.TrimRight(agent, "/") + agentRunPath
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, address, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+o.options.Token)
+	response, err := o.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, agentMaxBody))
+		err = fmt.Errorf(
+			"unexpected status %d: %s",
+			response.StatusCode, strings.TrimSpace(string(message)),
+		)
+		return
+	}
+	runResult := &AgentRunResult{}
+	err = json.NewDecoder(io.LimitReader(response.Body, agentMaxBody)).Decode(runResult)
+	if err != nil {
+		err = fmt.Errorf("failed to decode result: %w", err)
+		return
+	}
+	result = runResult
+	return
+}
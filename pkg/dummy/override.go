@@ -0,0 +1,105 @@
+package dummy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// Override is a behavior that is applied only to the requests that match a header value or that come from a network.
+// When both the header and the network are given the request has to match both. For example, to make all the
+// requests that contain the header 'X-Team: a' fail half of the time:
+//
+//	{
+//	  "name": "team-a",
+//	  "header": "X-Team",
+//	  "value": "a",
+//	  "behavior": {
+//	    "error_rate": 0.5
+//	  }
+//	}
+type Override struct {
+	Name     string   `json:"name"`
+	Header   string   `json:"header,omitempty"`
+	Value    string   `json:"value,omitempty"`
+	CIDR     string   `json:"cidr,omitempty"`
+	Behavior Behavior `json:"behavior"`
+}
+
+// OverrideSet selects the overrides that match requests.
+type OverrideSet struct {
+	rules []*overrideRule
+}
+
+type overrideRule struct {
+	override Override
+	header   string
+	prefix   netip.Prefix
+}
+
+// NewOverrideSet creates a set containing the given overrides. It returns an error if any of the overrides isn't
+// valid.
+func NewOverrideSet(overrides []Override) (result *OverrideSet, err error) {
+	var rules []*overrideRule
+	for i, override := range overrides {
+		if override.Name == "" {
+			err = fmt.Errorf("name of override %d is mandatory", i)
+			return
+		}
+		if override.Header == "" && override.CIDR == "" {
+			err = fmt.Errorf("override '%s' should have a header or a CIDR", override.Name)
+			return
+		}
+		rule := &overrideRule{
+			override: override,
+			header:   http.CanonicalHeaderKey(override.Header),
+		}
+		if override.CIDR != "" {
+			rule.prefix, err = netip.ParsePrefix(override.CIDR)
+			if err != nil {
+				err = fmt.Errorf("CIDR '%s' of override '%s' isn't valid: %w", override.CIDR, override.Name, err)
+				return
+			}
+		}
+		rules = append(rules, rule)
+	}
+	result = &OverrideSet{
+		rules: rules,
+	}
+	return
+}
+
+// Match returns the result of merging the behaviors of all the overrides that match the request, in the order they
+// were defined, and the names of those overrides.
+func (s *OverrideSet) Match(r *http.Request) (behavior Behavior, names []string) {
+	if len(s.rules) == 0 {
+		return
+	}
+	addr := clientAddr(r)
+	for _, rule := range s.rules {
+		if rule.header != "" && r.Header.Get(rule.header) != rule.override.Value {
+			continue
+		}
+		if rule.prefix.IsValid() && (!addr.IsValid() || !rule.prefix.Contains(addr)) {
+			continue
+		}
+		behavior = behavior.Merge(rule.override.Behavior)
+		names = append(names, rule.override.Name)
+	}
+	return
+}
+
+// clientAddr extracts the IP address of the client from the remote address of the request. It returns the zero
+// address if the remote address can't be parsed.
+func clientAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
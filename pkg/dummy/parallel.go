@@ -0,0 +1,187 @@
+package dummy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamResult contains the measurements of one of the range requests of a parallel download.
+type StreamResult struct {
+	Index      int           `json:"index"`
+	First      int64         `json:"first"`
+	Last       int64         `json:"last"`
+	Status     int           `json:"status"`
+	Bytes      int64         `json:"bytes"`
+	Elapsed    Duration      `json:"elapsed"`
+	Throughput float64       `json:"throughput"`
+	Timing     *ClientTiming `json:"timing,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// DownloadParallel downloads the data from the given address splitting it in the given number of range requests,
+// each one sent in its own connection, so that the gains of multiple connections over links with a high bandwidth
+// delay product can be evaluated. The server only supports ranges for deterministic data, so if the address doesn't
+// select a pattern or a seed a random seed is added.
+func (c *Client) DownloadParallel(ctx context.Context, address string, streams int) *ClientResult {
+	result := &ClientResult{
+		Start: time.Now(),
+	}
+	defer func() {
+		elapsed := time.Since(result.Start)
+		result.Elapsed = Duration(elapsed)
+		if elapsed > 0 {
+			result.Throughput = float64(result.Bytes) / elapsed.Seconds()
+		}
+	}()
+	address, err := deterministicAddress(address)
+	result.URL = address
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Find the total size with a request for the first byte:
+	size, instance, err := c.probeSize(ctx, address)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Instance = instance
+
+	// Send the range requests in parallel. Each one uses its own transport, so that they don't share a connection
+	// even if the protocol is HTTP/2.
+	chunk := (size + int64(streams) - 1) / int64(streams)
+	progress := c.startProgress()
+	var wait sync.WaitGroup
+	for i := 0; i < streams; i++ {
+		first := int64(i) * chunk
+		if first >= size {
+			break
+		}
+		stream := &StreamResult{
+			Index: i,
+			First: first,
+			Last:  min(size, first+chunk) - 1,
+		}
+		result.Streams = append(result.Streams, stream)
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			c.downloadRange(ctx, address, stream, progress)
+		}()
+	}
+	wait.Wait()
+	result.Progress = progress.Stop()
+
+	// Aggregate the results. The status is the one of the first stream that failed, or else the status of the
+	// partial responses.
+	result.Status = http.StatusPartialContent
+	for _, stream := range result.Streams {
+		result.Bytes += stream.Bytes
+		if result.Error == "" && (stream.Error != "" || stream.Status != http.StatusPartialContent) {
+			result.Status = stream.Status
+			result.Error = stream.Error
+		}
+	}
+	return result
+}
+
+// deterministicAddress adds a random seed to the given address, unless it already selects a seed or a pattern.
+func deterministicAddress(address string) (result string, err error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return
+	}
+	query := parsed.Query()
+	if query.Get("seed") == "" && query.Get("pattern") == "" {
+		var data [8]byte
+		_, err = rand.Read(data[:])
+		if err != nil {
+			return
+		}
+		query.Set("seed", hex.EncodeToString(data[:]))
+		parsed.RawQuery = query.Encode()
+	}
+	result = parsed.String()
+	return
+}
+
+// probeSize requests the first byte of the data, and returns the total size from the 'Content-Range' header, and
+// the identifier of the instance that answered.
+func (c *Client) probeSize(ctx context.Context, address string) (size int64, instance string, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return
+	}
+	request.Header.Set("Range", "bytes=0-0")
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode != http.StatusPartialContent {
+		err = fmt.Errorf("server doesn't support ranges, status of probe is %d", response.StatusCode)
+		return
+	}
+	instance = response.Header.Get(instanceHeader)
+	contentRange := response.Header.Get("Content-Range")
+	_, total, ok := strings.Cut(contentRange, "/")
+	if ok {
+		size, err = strconv.ParseInt(total, 10, 64)
+	}
+	if !ok || err != nil || size <= 0 {
+		err = fmt.Errorf("content range '%s' of probe isn't valid", contentRange)
+	}
+	return
+}
+
+// downloadRange downloads one range of the data, using its own connection, and adds the bytes read to the progress
+// meter shared by all the streams.
+func (c *Client) downloadRange(ctx context.Context, address string, stream *StreamResult, progress *progressMeter) {
+	start := time.Now()
+	tracer, ctx := newTimingTracer(ctx)
+	defer func() {
+		stream.Timing = tracer.finish()
+		elapsed := time.Since(start)
+		stream.Elapsed = Duration(elapsed)
+		if elapsed > 0 {
+			stream.Throughput = float64(stream.Bytes) / elapsed.Seconds()
+		}
+	}()
+	transport := c.httpClient.Transport.(*http.Transport).Clone()
+	defer transport.CloseIdleConnections()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		stream.Error = err.Error()
+		return
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", stream.First, stream.Last))
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		stream.Error = err.Error()
+		return
+	}
+	defer response.Body.Close()
+	stream.Status = response.StatusCode
+	var body io.Reader = response.Body
+	if progress != nil {
+		body = &progressReader{
+			reader: body,
+			meter:  progress,
+		}
+	}
+	stream.Bytes, err = io.CopyBuffer(io.Discard, body, make([]byte, c.buffer))
+	if err != nil {
+		stream.Error = err.Error()
+	}
+}
@@ -0,0 +1,208 @@
+package dummy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// dataParams are the names of the query parameters supported by the data endpoint, including the deprecated ones.
+// Parameters starting with 'header_' are also supported, they set response headers.
+var dataParams = []string{
+	"alloc",
+	"batch",
+	"buffer",
+	"buffer_size",
+	"cache",
+	"cache_control",
+	"chunk_latency",
+	"client",
+	"compress",
+	"content_type",
+	"cpu",
+	"disposition",
+	"flush",
+	"format",
+	"pattern",
+	"progress",
+	"record_size",
+	"records",
+	"scenario",
+	"schema",
+	"seed",
+	"size",
+	"source",
+	"strict",
+	"template",
+	"throttle_after",
+	"throttle_after_bytes",
+	"throttle_window",
+	"timeline",
+	"verbose",
+}
+
+// booleanParams are the names of the query parameters of the data endpoint that only accept 'true' or 'false'.
+var booleanParams = []string{
+	"chunk_latency",
+	"compress",
+	"strict",
+	"timeline",
+	"verbose",
+}
+
+// paramAliases maps the names of deprecated query parameters to the names that replace them. Requests that use the
+// old names keep working, but the response contains a warning and the use is written to the log, so that test scripts
+// can be updated before the old names are removed.
+var paramAliases = map[string]string{
+	"buffer": "buffer_size",
+}
+
+// resolveParamAliases returns a copy of the query parameters where the deprecated names have been replaced by the
+// current ones. If both the deprecated and the current name are used the current one wins. The second result contains
+// the deprecated names that were used.
+func resolveParamAliases(query url.Values) (result url.Values, deprecated []string) {
+	result = query
+	for oldName, newName := range paramAliases {
+		values, ok := query[oldName]
+		if !ok {
+			continue
+		}
+		if len(deprecated) == 0 {
+			result = url.Values{}
+			for name, values := range query {
+				result[name] = values
+			}
+		}
+		delete(result, oldName)
+		if _, ok := result[newName]; !ok {
+			result[newName] = values
+		}
+		deprecated = append(deprecated, oldName)
+	}
+	return
+}
+
+// setDeprecationWarnings adds to the response a 'Warning' header for each of the given deprecated parameters.
+func setDeprecationWarnings(header http.Header, deprecated []string) {
+	for _, name := range deprecated {
+		header.Add(
+			"Warning",
+			fmt.Sprintf(`299 - "Parameter '%s' is deprecated, use '%s' instead"`, name, paramAliases[name]),
+		)
+	}
+}
+
+// checkStrictParams checks that the query parameters of a request to the data endpoint are all known, and that they
+// don't contain invalid combinations that would otherwise be silently ignored, like a seed for a pattern that isn't
+// random. It returns an error that describes all the problems found, suggesting the right name for parameters that
+// look like typos.
+func checkStrictParams(query url.Values) error {
+	var errs []error
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if slices.Contains(dataParams, name) || strings.HasPrefix(name, headerParamPrefix) {
+			continue
+		}
+		suggestion := closestParam(name)
+		if suggestion != "" {
+			errs = append(errs, fmt.Errorf("unknown parameter '%s', did you mean '%s'?", name, suggestion))
+		} else {
+			errs = append(errs, fmt.Errorf("unknown parameter '%s'", name))
+		}
+	}
+	for _, name := range booleanParams {
+		value := query.Get(name)
+		if value != "" && value != "true" && value != "false" {
+			errs = append(errs, fmt.Errorf("parameter '%s' should be 'true' or 'false', but it is '%s'", name, value))
+		}
+	}
+	for oldName, newName := range paramAliases {
+		if query.Has(oldName) && query.Has(newName) {
+			errs = append(errs, fmt.Errorf("parameters '%s' and '%s' can't be used together", oldName, newName))
+		}
+	}
+	pattern := query.Get("pattern")
+	if query.Has("seed") && pattern != "" && pattern != patternRandom {
+		errs = append(errs, fmt.Errorf("parameter 'seed' can only be used with the '%s' pattern", patternRandom))
+	}
+	if query.Has("source") && query.Has("pattern") {
+		errs = append(errs, errors.New("parameters 'source' and 'pattern' can't be used together"))
+	}
+	for _, name := range []string{"format", "records", "record_size", "schema", "template"} {
+		if query.Has(name) && !query.Has("source") {
+			errs = append(errs, fmt.Errorf("parameter '%s' can only be used with 'source'", name))
+		}
+	}
+	throttled := query.Has("throttle_after") || query.Has("throttle_after_bytes")
+	if query.Has("client") && !query.Has("scenario") && !throttled {
+		errs = append(errs, errors.New("parameter 'client' can only be used with 'scenario' or 'throttle_after'"))
+	}
+	if query.Has("throttle_window") && !throttled {
+		errs = append(errs, errors.New("parameter 'throttle_window' can only be used with 'throttle_after'"))
+	}
+	return errors.Join(errs...)
+}
+
+// closestParam returns the name of the known parameter that is most similar to the given one, or an empty string if
+// none is similar enough to be a likely typo. Deprecated names are replaced by the current ones.
+func closestParam(name string) (result string) {
+	best := 3
+	for _, candidate := range dataParams {
+		distance := editDistance(name, candidate)
+		if distance < best {
+			best = distance
+			result = candidate
+		}
+	}
+	replacement, ok := paramAliases[result]
+	if ok {
+		result = replacement
+	}
+	return
+}
+
+// editDistance calculates the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// parseIntParam parses the value of an integer query parameter that can't be negative. If the text is empty it
+// returns the default value.
+func parseIntParam(text string, defaultValue int) (result int, err error) {
+	if text == "" {
+		result = defaultValue
+		return
+	}
+	result, err = strconv.Atoi(text)
+	if err != nil {
+		return
+	}
+	if result < 0 {
+		err = fmt.Errorf("value %d is negative", result)
+	}
+	return
+}
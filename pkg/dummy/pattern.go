@@ -0,0 +1,166 @@
+package dummy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Names of the supported data patterns:
+const (
+	patternRandom   = "random"
+	patternZero     = "zero"
+	patternSequence = "sequence"
+)
+
+// Default size of the pattern blobs. Must be a multiple of 256 so that the sequence pattern can be repeated without
+// discontinuities.
+const defaultPatternSize = 16 * (1 << 20) // 16 MiB
+
+// patternFills contains the functions that fill the blobs of the deterministic patterns.
+var patternFills = map[string]func([]byte){
+	patternZero: func(data []byte) {
+		clear(data)
+	},
+	patternSequence: func(data []byte) {
+		for i := range data {
+			data[i] = byte(i)
+		}
+	},
+}
+
+// PatternStore generates and stores in disk blobs containing deterministic data patterns. Serving those files with
+// io.Copy allows the Go runtime to use the sendfile system call when the connection isn't encrypted, so the data
+// doesn't need to be copied to user space.
+type PatternStore struct {
+	logger *slog.Logger
+	dir    string
+	size   int
+	lock   sync.Mutex
+	blobs  map[string]*patternBlob
+}
+
+type patternBlob struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// NewPatternStore creates a store that will save the blobs in the given directory.
+func NewPatternStore(logger *slog.Logger, dir string) *PatternStore {
+	return &PatternStore{
+		logger: logger,
+		dir:    dir,
+		size:   defaultPatternSize,
+		blobs:  map[string]*patternBlob{},
+	}
+}
+
+// Size returns the size of the blobs.
+func (s *PatternStore) Size() int {
+	return s.size
+}
+
+// Open opens the blob for the given pattern, generating it if it doesn't exist yet. The caller is responsible for
+// closing the returned file.
+func (s *PatternStore) Open(name string) (*os.File, error) {
+	fill, ok := patternFills[name]
+	if !ok {
+		return nil, fmt.Errorf("pattern '%s' isn't supported", name)
+	}
+	s.lock.Lock()
+	blob, ok := s.blobs[name]
+	if !ok {
+		blob = &patternBlob{
+			path: filepath.Join(s.dir, name),
+		}
+		s.blobs[name] = blob
+	}
+	s.lock.Unlock()
+	blob.once.Do(func() {
+		data := make([]byte, s.size)
+		fill(data)
+		blob.err = os.WriteFile(blob.path, data, 0o600)
+		if blob.err == nil {
+			s.logger.Info(
+				"Generated pattern blob",
+				slog.String("pattern", name),
+				slog.String("path", blob.path),
+				slog.Int("size", s.size),
+			)
+		}
+	})
+	if blob.err != nil {
+		return nil, blob.err
+	}
+	return os.Open(blob.path)
+}
+
+// repeatReader reads a file from the beginning to the end, and then starts again from the beginning, so it never
+// returns io.EOF.
+type repeatReader struct {
+	file *os.File
+}
+
+// Read is the implementation of the io.Reader interface.
+func (r *repeatReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		var count int
+		count, err = r.file.Read(p[n:])
+		n += count
+		if err == io.EOF {
+			_, err = r.file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// patternSection gives random access to the data of a pattern of the given size, repeating the blob as many times as
+// needed. It is used to serve range requests.
+type patternSection struct {
+	file   *os.File
+	blob   int64
+	size   int64
+	offset int64
+}
+
+// Read is the implementation of the io.Reader interface.
+func (s *patternSection) Read(p []byte) (n int, err error) {
+	if s.offset >= s.size {
+		err = io.EOF
+		return
+	}
+	position := s.offset % s.blob
+	p = p[:min(int64(len(p)), s.size-s.offset, s.blob-position)]
+	n, err = s.file.ReadAt(p, position)
+	s.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return
+}
+
+// Seek is the implementation of the io.Seeker interface.
+func (s *patternSection) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.offset = offset
+	return offset, nil
+}
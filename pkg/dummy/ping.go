@@ -0,0 +1,107 @@
+package dummy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Default interval between the pings sent as events.
+const defaultPingInterval = time.Second
+
+// PingResult is the response of the ping endpoint, and the payload of each ping event.
+type PingResult struct {
+	Seq      int       `json:"seq"`
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance,omitempty"`
+}
+
+// PingHandler is an HTTP handler that responds immediately with a tiny payload that contains the time of the server,
+// so that clients can measure the round trip time and the jitter separately from the throughput. When the 'count'
+// query parameter is given the response is instead a stream of server sent events, one every 'interval', which is one
+// second by default.
+type PingHandler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *PingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Get the parameters:
+	query := r.URL.Query()
+	count, err := parseIntParam(query.Get("count"), 0)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("count isn't valid: %v", err), http.StatusBadRequest)
+		return
+	}
+	interval := defaultPingInterval
+	text := query.Get("interval")
+	if text != "" {
+		interval, err = time.ParseDuration(text)
+		if err != nil || interval <= 0 {
+			http.Error(w, fmt.Sprintf("interval '%s' should be a positive duration", text), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Without count respond with a single ping:
+	if count == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(&PingResult{
+			Time:     time.Now().UTC(),
+			Instance: h.identity.Instance,
+		})
+		if err != nil {
+			h.logger.Error(
+				"Failed to send ping",
+				slog.String("error", err.Error()),
+			)
+		}
+		return
+	}
+
+	// Send the pings as events, flushing each one as soon as it is written:
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	encoder := json.NewEncoder(w)
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			select {
+			case <-ticker.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: ping\ndata: ", seq)
+		if err == nil {
+			err = encoder.Encode(&PingResult{
+				Seq:      seq,
+				Time:     time.Now().UTC(),
+				Instance: h.identity.Instance,
+			})
+		}
+		if err == nil {
+			_, err = fmt.Fprint(w, "\n")
+		}
+		if err == nil {
+			err = controller.Flush()
+		}
+		if err != nil {
+			h.logger.Info(
+				"Stopped sending pings",
+				slog.Int("sent", seq),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+	}
+}
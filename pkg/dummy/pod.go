@@ -0,0 +1,47 @@
+package dummy
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Directories where the server looks for the configuration and the TLS certificate when they aren't given
+// explicitly, so that in Kubernetes they can be provided mounting a config map and a TLS secret, without changing the
+// command line of the container.
+const (
+	MountedConfigDir = "/etc/dummy"
+	MountedTLSDir    = "/var/run/secrets/dummy/tls"
+)
+
+// Names of the files of the configuration that are searched in the mounted configuration directory, in order of
+// preference.
+var mountedConfigFiles = []string{
+	"config.yaml",
+	"config.yml",
+	"config.json",
+}
+
+// FindMountedConfig returns the configuration file mounted in the configuration directory, or an empty string if
+// there is none.
+func FindMountedConfig() string {
+	for _, name := range mountedConfigFiles {
+		file := filepath.Join(MountedConfigDir, name)
+		info, err := os.Stat(file)
+		if err == nil && info.Mode().IsRegular() {
+			return file
+		}
+	}
+	return ""
+}
+
+// findMountedTLSFiles returns the certificate and key files of the TLS secret mounted in the TLS directory. The names
+// of the files are the keys of the secrets of type 'kubernetes.io/tls'. The result is false if either of them is
+// missing.
+func findMountedTLSFiles() (crtFile, keyFile string, ok bool) {
+	crtFile = filepath.Join(MountedTLSDir, "tls.crt")
+	keyFile = filepath.Join(MountedTLSDir, "tls.key")
+	_, crtErr := os.Stat(crtFile)
+	_, keyErr := os.Stat(keyFile)
+	ok = crtErr == nil && keyErr == nil
+	return
+}
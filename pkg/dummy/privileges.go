@@ -0,0 +1,118 @@
+package dummy
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// errRunningAsRoot is returned when the server would serve requests as root without having been told to drop the
+// privileges or to keep them.
+var errRunningAsRoot = errors.New(
+	"refusing to serve as root, use a user to drop the privileges after opening the listeners, or explicitly " +
+		"allow running as root",
+)
+
+// credentials are the user, group and supplementary groups that the process switches to after opening the listeners.
+type credentials struct {
+	user   string
+	uid    int
+	gid    int
+	groups []int
+}
+
+// lookupCredentials resolves the given user and group names, or numeric identifiers. When the group is empty the
+// primary group of the user is used. The supplementary groups are the ones of the user, if it exists in the user
+// database.
+func lookupCredentials(userName, groupName string) (result *credentials, err error) {
+	if userName == "" {
+		if groupName != "" {
+			err = fmt.Errorf("group '%s' can't be used without a user", groupName)
+		}
+		return
+	}
+	creds := &credentials{
+		user: userName,
+	}
+	account, err := user.Lookup(userName)
+	if err != nil {
+		var idErr error
+		account, idErr = user.LookupId(userName)
+		if idErr == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		// Numeric identifiers that aren't in the user database are still allowed, as it is common in containers:
+		uid, parseErr := strconv.Atoi(userName)
+		if parseErr != nil || uid < 0 {
+			err = fmt.Errorf("failed to find user '%s': %w", userName, err)
+			return
+		}
+		err = nil
+		creds.uid = uid
+		creds.gid = uid
+	} else {
+		creds.uid, err = strconv.Atoi(account.Uid)
+		if err != nil {
+			err = fmt.Errorf("identifier '%s' of user '%s' isn't numeric: %w", account.Uid, userName, err)
+			return
+		}
+		creds.gid, err = strconv.Atoi(account.Gid)
+		if err != nil {
+			err = fmt.Errorf("group identifier '%s' of user '%s' isn't numeric: %w", account.Gid, userName, err)
+			return
+		}
+		var ids []string
+		ids, err = account.GroupIds()
+		if err != nil {
+			err = fmt.Errorf("failed to get groups of user '%s': %w", userName, err)
+			return
+		}
+		for _, id := range ids {
+			var gid int
+			gid, err = strconv.Atoi(id)
+			if err != nil {
+				err = fmt.Errorf("group identifier '%s' of user '%s' isn't numeric: %w", id, userName, err)
+				return
+			}
+			creds.groups = append(creds.groups, gid)
+		}
+	}
+	if groupName != "" {
+		creds.gid, err = lookupGroup(groupName)
+		if err != nil {
+			return
+		}
+	}
+	result = creds
+	return
+}
+
+// lookupGroup resolves the given group name or numeric identifier.
+func lookupGroup(name string) (result int, err error) {
+	group, err := user.LookupGroup(name)
+	if err != nil {
+		var idErr error
+		group, idErr = user.LookupGroupId(name)
+		if idErr == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		gid, parseErr := strconv.Atoi(name)
+		if parseErr != nil || gid < 0 {
+			err = fmt.Errorf("failed to find group '%s': %w", name, err)
+			return
+		}
+		result = gid
+		err = nil
+		return
+	}
+	result, err = strconv.Atoi(group.Gid)
+	if err != nil {
+		err = fmt.Errorf("identifier '%s' of group '%s' isn't numeric: %w", group.Gid, name, err)
+	}
+	return
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package dummy
+
+import "errors"
+
+// runningAsRoot always returns false, as systems that aren't Unix like don't have a root user.
+func runningAsRoot() bool {
+	return false
+}
+
+// dropPrivileges returns an error, as switching the user of the process is only supported in Unix like systems.
+func dropPrivileges(creds *credentials, owned []string) error {
+	return errors.New("changing the user is only supported in Unix like systems")
+}
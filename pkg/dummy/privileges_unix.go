@@ -0,0 +1,49 @@
+//go:build unix
+
+package dummy
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// runningAsRoot checks if the effective user of the process is root.
+func runningAsRoot() bool {
+	return os.Geteuid() == 0
+}
+
+// dropPrivileges gives the given files and directories, created by the process while it was privileged, to the user
+// of the credentials, and then switches the process to those credentials. The supplementary groups and the group are
+// changed first, because that isn't possible once the user isn't root. Since Go 1.16 these calls apply to all the
+// threads of the process.
+func dropPrivileges(creds *credentials, owned []string) error {
+	for _, path := range owned {
+		err := os.Chown(path, creds.uid, creds.gid)
+		if err != nil {
+			return fmt.Errorf("failed to change owner of '%s': %w", path, err)
+		}
+	}
+	groups := creds.groups
+	if len(groups) == 0 {
+		groups = []int{creds.gid}
+	}
+	err := syscall.Setgroups(groups)
+	if err != nil {
+		return fmt.Errorf("failed to set supplementary groups: %w", err)
+	}
+	err = syscall.Setgid(creds.gid)
+	if err != nil {
+		return fmt.Errorf("failed to set group %d: %w", creds.gid, err)
+	}
+	err = syscall.Setuid(creds.uid)
+	if err != nil {
+		return fmt.Errorf("failed to set user %d: %w", creds.uid, err)
+	}
+
+	// Check that the privileges can't be regained, in case the system ignored part of the change:
+	if creds.uid != 0 && syscall.Setuid(0) == nil {
+		return fmt.Errorf("privileges can still be regained after switching to user %d", creds.uid)
+	}
+	return nil
+}
@@ -0,0 +1,419 @@
+package dummy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults of the background probes:
+const (
+	DefaultProbeInterval = time.Minute
+	DefaultProbeTimeout  = 30 * time.Second
+
+	// DefaultProbeAlertWindow is the number of recent downloads used to calculate the error rate.
+	DefaultProbeAlertWindow = 10
+)
+
+// ProbeConfig describes a target that the server downloads from periodically, acting as a client, so that one
+// deployment gives continuous synthetic monitoring of the path to that target. For example:
+//
+//	{
+//	  "name": "other-region",
+//	  "url": "https://dummy.example.com/?size=1048576",
+//	  "interval": "1m"
+//	}
+type ProbeConfig struct {
+	// Name identifies the probe in the metrics and the statistics. The default is the URL.
+	Name string `json:"name,omitempty"`
+
+	// URL is the address that is downloaded.
+	URL string `json:"url"`
+
+	// Interval is the time between downloads. The default is one minute.
+	Interval Duration `json:"interval,omitempty"`
+
+	// Timeout is the maximum duration of a download. The default is 30 seconds, or the interval if it is shorter.
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// Insecure disables the verification of the TLS certificate of the target.
+	Insecure bool `json:"insecure,omitempty"`
+
+	// Alerts contains the conditions that send notifications to the webhooks.
+	Alerts *ProbeAlertsConfig `json:"alerts,omitempty"`
+}
+
+// ProbeAlertsConfig contains the conditions that fire alerts for a probe. Each alert is sent to the webhooks when the
+// condition starts to be true, and again when it is resolved. Zero disables the condition.
+type ProbeAlertsConfig struct {
+	// MinThroughput is the throughput, in bytes per second, that a successful download must exceed.
+	MinThroughput float64 `json:"min_throughput,omitempty"`
+
+	// MaxErrorRate is the fraction, between zero and one, of failed downloads in the window that fires the alert.
+	MaxErrorRate float64 `json:"max_error_rate,omitempty"`
+
+	// Window is the number of recent downloads used to calculate the error rate. The default is ten.
+	Window int `json:"window,omitempty"`
+
+	// Failures is the number of consecutive failed downloads that fires the alert.
+	Failures int `json:"failures,omitempty"`
+}
+
+// validate checks that the alert conditions are valid.
+func (c *ProbeAlertsConfig) validate() error {
+	if c.MinThroughput < 0 {
+		return fmt.Errorf("minimum throughput %g is negative", c.MinThroughput)
+	}
+	if c.MaxErrorRate < 0 || c.MaxErrorRate > 1 {
+		return fmt.Errorf("maximum error rate %g should be between zero and one", c.MaxErrorRate)
+	}
+	if c.Window < 0 {
+		return fmt.Errorf("window %d is negative", c.Window)
+	}
+	if c.Failures < 0 {
+		return fmt.Errorf("failures %d is negative", c.Failures)
+	}
+	return nil
+}
+
+// validate checks that the probe is valid, and sets the default name.
+func (c *ProbeConfig) validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("URL of probe '%s' is mandatory", c.Name)
+	}
+	address, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("URL of probe '%s' isn't valid: %w", c.Name, err)
+	}
+	if address.Scheme != "http" && address.Scheme != "https" {
+		return fmt.Errorf("scheme of the URL of probe '%s' should be 'http' or 'https'", c.Name)
+	}
+	if c.Name == "" {
+		c.Name = c.URL
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("interval of probe '%s' is negative", c.Name)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout of probe '%s' is negative", c.Name)
+	}
+	if c.Alerts != nil {
+		err = c.Alerts.validate()
+		if err != nil {
+			return fmt.Errorf("alerts of probe '%s' aren't valid: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// ProbeStats contains the results of one of the background probes.
+type ProbeStats struct {
+	Name     string        `json:"name"`
+	URL      string        `json:"url"`
+	Runs     int64         `json:"runs"`
+	Failures int64         `json:"failures"`
+	Last     *ClientResult `json:"last,omitempty"`
+}
+
+// probeState contains the recent results of a probe, used to evaluate the alert conditions.
+type probeState struct {
+	failures int
+	recent   []bool
+	firing   map[string]bool
+}
+
+// Prober runs the background probes, records their results in the statistics and in the metrics, and sends the alerts
+// to the notifier.
+type Prober struct {
+	logger     *slog.Logger
+	probes     []ProbeConfig
+	notifier   *Notifier
+	recorders  []ResultRecorder
+	lock       sync.Mutex
+	stats      map[string]*ProbeStats
+	states     map[string]*probeState
+	runs       *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	throughput *prometheus.GaugeVec
+	up         *prometheus.GaugeVec
+}
+
+// NewProber creates the runner of the given probes, and registers the metrics with the given registerer. The names of
+// the probes must be unique. The notifier can be nil, and then alerts are only written to the log. The results are
+// also sent to the given recorders.
+func NewProber(logger *slog.Logger, probes []ProbeConfig, notifier *Notifier, recorders []ResultRecorder,
+	registerer prometheus.Registerer) (result *Prober, err error) {
+	probes = slices.Clone(probes)
+	names := map[string]bool{}
+	for i := range probes {
+		probe := &probes[i]
+		err = probe.validate()
+		if err != nil {
+			return
+		}
+		if names[probe.Name] {
+			err = fmt.Errorf("probe name '%s' is duplicated", probe.Name)
+			return
+		}
+		names[probe.Name] = true
+		if probe.Interval == 0 {
+			probe.Interval = Duration(DefaultProbeInterval)
+		}
+		if probe.Timeout == 0 {
+			probe.Timeout = Duration(min(DefaultProbeTimeout, time.Duration(probe.Interval)))
+		}
+		if probe.Alerts != nil && probe.Alerts.Window == 0 {
+			alerts := *probe.Alerts
+			alerts.Window = DefaultProbeAlertWindow
+			probe.Alerts = &alerts
+		}
+	}
+	prober := &Prober{
+		logger:    logger,
+		probes:    probes,
+		notifier:  notifier,
+		recorders: recorders,
+		stats:     map[string]*ProbeStats{},
+		states:    map[string]*probeState{},
+	}
+	if len(probes) == 0 {
+		result = prober
+		return
+	}
+	prober.runs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_probe_runs_total",
+			Help: "Number of downloads of the background probes, by probe and result, 'success' or 'failure'.",
+		},
+		[]string{"probe", "result"},
+	)
+	prober.duration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dummy_probe_duration_seconds",
+			Help:    "Duration of the successful downloads of the background probes.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		},
+		[]string{"probe"},
+	)
+	prober.throughput = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dummy_probe_throughput_bytes_per_second",
+			Help: "Throughput of the last successful download of the background probes.",
+		},
+		[]string{"probe"},
+	)
+	prober.up = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dummy_probe_up",
+			Help: "Result of the last download of the background probes, one if it succeeded and zero otherwise.",
+		},
+		[]string{"probe"},
+	)
+	for _, collector := range []prometheus.Collector{prober.runs, prober.duration, prober.throughput, prober.up} {
+		err = registerer.Register(collector)
+		if err != nil {
+			return
+		}
+	}
+	result = prober
+	return
+}
+
+// Start starts running the probes, till the context is cancelled. The first download of each probe happens after one
+// interval, so that the listeners of the server are already open when the target is the server itself.
+func (p *Prober) Start(ctx context.Context) error {
+	for _, probe := range p.probes {
+		client, err := NewClientWithTransport(TransportOptions{
+			Insecure:     probe.Insecure,
+			DisableReuse: true,
+			Timeout:      time.Duration(probe.Timeout),
+		}, DefaultBufferSize)
+		if err != nil {
+			return fmt.Errorf("failed to create client of probe '%s': %w", probe.Name, err)
+		}
+		p.logger.Info(
+			"Starting probe",
+			slog.String("name", probe.Name),
+			slog.String("url", probe.URL),
+			slog.String("interval", time.Duration(probe.Interval).String()),
+		)
+		go func() {
+			ticker := time.NewTicker(time.Duration(probe.Interval))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+				p.run(ctx, client, probe)
+			}
+		}()
+	}
+	return nil
+}
+
+// run downloads the URL of the probe once and records the result.
+func (p *Prober) run(ctx context.Context, client *Client, probe ProbeConfig) {
+	result := client.Download(ctx, probe.URL)
+	if ctx.Err() != nil {
+		return
+	}
+	if result.Error == "" && (result.Status < 200 || result.Status > 299) {
+		result.Error = fmt.Sprintf("unexpected status %d", result.Status)
+	}
+	if result.Error != "" {
+		p.runs.WithLabelValues(probe.Name, "failure").Inc()
+		p.up.WithLabelValues(probe.Name).Set(0)
+		p.logger.Warn(
+			"Probe failed",
+			slog.String("name", probe.Name),
+			slog.String("url", probe.URL),
+			slog.String("error", result.Error),
+		)
+	} else {
+		p.runs.WithLabelValues(probe.Name, "success").Inc()
+		p.up.WithLabelValues(probe.Name).Set(1)
+		p.duration.WithLabelValues(probe.Name).Observe(time.Duration(result.Elapsed).Seconds())
+		p.throughput.WithLabelValues(probe.Name).Set(result.Throughput)
+		p.logger.Debug(
+			"Probe succeeded",
+			slog.String("name", probe.Name),
+			slog.Int64("bytes", result.Bytes),
+			slog.String("elapsed", time.Duration(result.Elapsed).String()),
+			slog.Float64("throughput", result.Throughput),
+		)
+	}
+	for _, recorder := range p.recorders {
+		recorder.RecordProbe(probe.Name, result)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if probe.Alerts != nil {
+		p.evaluate(probe, result)
+	}
+	stats := p.stats[probe.Name]
+	if stats == nil {
+		stats = &ProbeStats{
+			Name: probe.Name,
+			URL:  probe.URL,
+		}
+		p.stats[probe.Name] = stats
+	}
+	stats.Runs++
+	if result.Error != "" {
+		stats.Failures++
+	}
+	stats.Last = result
+}
+
+// evaluate checks the alert conditions of the probe after a download, and sends the alerts whose state changed. It
+// must be called with the lock held.
+func (p *Prober) evaluate(probe ProbeConfig, result *ClientResult) {
+	alerts := probe.Alerts
+	state := p.states[probe.Name]
+	if state == nil {
+		state = &probeState{
+			firing: map[string]bool{},
+		}
+		p.states[probe.Name] = state
+	}
+	failed := result.Error != ""
+	if failed {
+		state.failures++
+	} else {
+		state.failures = 0
+	}
+	state.recent = append(state.recent, failed)
+	if len(state.recent) > alerts.Window {
+		state.recent = state.recent[len(state.recent)-alerts.Window:]
+	}
+
+	// Consecutive failures:
+	if alerts.Failures > 0 {
+		p.update(probe, state, AlertKindFailures, state.failures >= alerts.Failures, float64(state.failures),
+			float64(alerts.Failures), fmt.Sprintf(
+				"%d consecutive downloads failed, the last one with error: %s",
+				state.failures, result.Error,
+			))
+	}
+
+	// Error rate, only when there are enough downloads in the window:
+	if alerts.MaxErrorRate > 0 && len(state.recent) == alerts.Window {
+		count := 0
+		for _, failed := range state.recent {
+			if failed {
+				count++
+			}
+		}
+		rate := float64(count) / float64(len(state.recent))
+		p.update(probe, state, AlertKindErrorRate, rate > alerts.MaxErrorRate, rate, alerts.MaxErrorRate,
+			fmt.Sprintf(
+				"%d of the last %d downloads failed, error rate is %.2f and the maximum is %.2f",
+				count, len(state.recent), rate, alerts.MaxErrorRate,
+			))
+	}
+
+	// Throughput, only for successful downloads:
+	if alerts.MinThroughput > 0 && !failed {
+		p.update(probe, state, AlertKindThroughput, result.Throughput < alerts.MinThroughput, result.Throughput,
+			alerts.MinThroughput, fmt.Sprintf(
+				"throughput is %.0f bytes per second and the minimum is %.0f",
+				result.Throughput, alerts.MinThroughput,
+			))
+	}
+}
+
+// update sends the alert if the condition changed since the last evaluation.
+func (p *Prober) update(probe ProbeConfig, state *probeState, kind string, condition bool, value, threshold float64,
+	message string) {
+	if condition == state.firing[kind] {
+		return
+	}
+	state.firing[kind] = condition
+	alert := Alert{
+		Probe:     probe.Name,
+		URL:       probe.URL,
+		Kind:      kind,
+		State:     AlertStateFiring,
+		Time:      time.Now().UTC(),
+		Value:     value,
+		Threshold: threshold,
+		Message:   message,
+	}
+	if !condition {
+		alert.State = AlertStateResolved
+	}
+	p.logger.Warn(
+		"Probe alert changed",
+		slog.String("probe", probe.Name),
+		slog.String("kind", kind),
+		slog.String("state", alert.State),
+		slog.String("message", message),
+	)
+	p.notifier.Notify(alert)
+}
+
+// Report returns the results of the probes, sorted by name. The receiver can be nil.
+func (p *Prober) Report() []ProbeStats {
+	if p == nil {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	result := make([]ProbeStats, 0, len(p.stats))
+	for _, stats := range p.stats {
+		result = append(result, *stats)
+	}
+	slices.SortFunc(result, func(a, b ProbeStats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result
+}
@@ -0,0 +1,122 @@
+package dummy
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressRecord contains the progress of a transfer during one interval.
+type ProgressRecord struct {
+	Time    time.Time `json:"time"`
+	Elapsed Duration  `json:"elapsed"`
+	Bytes   int64     `json:"bytes"`
+	Total   int64     `json:"total"`
+	Rate    float64   `json:"rate"`
+}
+
+// progressMeter counts the bytes of a transfer and calls a function with the progress periodically, so that long
+// transfers can be charted live. All the methods can be called on a nil meter, and then they do nothing, so that the
+// code that does the transfer doesn't need to check if progress reporting is enabled.
+type progressMeter struct {
+	start   time.Time
+	report  func(*ProgressRecord)
+	bytes   atomic.Int64
+	last    int64
+	lastAt  time.Time
+	lock    sync.Mutex
+	records []*ProgressRecord
+	ticker  *time.Ticker
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// startProgress starts a meter that calls the given function every interval. It returns nil if the interval is zero.
+func startProgress(interval time.Duration, report func(*ProgressRecord)) *progressMeter {
+	if interval <= 0 {
+		return nil
+	}
+	now := time.Now()
+	m := &progressMeter{
+		start:  now,
+		report: report,
+		lastAt: now,
+		ticker: time.NewTicker(interval),
+		done:   make(chan struct{}),
+	}
+	m.stopped.Add(1)
+	go m.run()
+	return m
+}
+
+func (m *progressMeter) run() {
+	defer m.stopped.Done()
+	for {
+		select {
+		case now := <-m.ticker.C:
+			m.tick(now)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// tick calculates the progress since the previous tick and reports it.
+func (m *progressMeter) tick(now time.Time) {
+	total := m.bytes.Load()
+	m.lock.Lock()
+	record := &ProgressRecord{
+		Time:    now,
+		Elapsed: Duration(now.Sub(m.start)),
+		Bytes:   total - m.last,
+		Total:   total,
+	}
+	interval := now.Sub(m.lastAt)
+	if interval > 0 {
+		record.Rate = float64(record.Bytes) / interval.Seconds()
+	}
+	m.last = total
+	m.lastAt = now
+	m.records = append(m.records, record)
+	m.lock.Unlock()
+	if m.report != nil {
+		m.report(record)
+	}
+}
+
+// Add adds the given number of bytes to the count.
+func (m *progressMeter) Add(n int64) {
+	if m == nil {
+		return
+	}
+	m.bytes.Add(n)
+}
+
+// Stop stops the periodic reports, reporting the last partial interval if it transferred any byte, and returns all
+// the records.
+func (m *progressMeter) Stop() []*ProgressRecord {
+	if m == nil {
+		return nil
+	}
+	m.ticker.Stop()
+	close(m.done)
+	m.stopped.Wait()
+	if m.bytes.Load() > m.last {
+		m.tick(time.Now())
+	}
+	return m.records
+}
+
+// progressReader is a reader that adds the bytes read to a progress meter.
+type progressReader struct {
+	reader io.Reader
+	meter  *progressMeter
+}
+
+// Read is the implementation of the io.Reader interface.
+func (r *progressReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.meter.Add(int64(n))
+	return
+}
@@ -0,0 +1,629 @@
+package dummy
+
+import (
+	"bufio"
+	"context"
+	crand "crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modes of the proxy:
+const (
+	ProxyModeForward = "forward"
+	ProxyModeRecord  = "record"
+	ProxyModeReplay  = "replay"
+)
+
+// DefaultProxyPrefix is the default prefix of the paths handled by the proxy.
+const DefaultProxyPrefix = "/proxy/"
+
+// ProxyConfig contains the settings of the proxy. In forward and record modes the requests whose path starts with the
+// prefix are forwarded to the upstream, without the prefix. In forward mode the impairment is applied to the exchanges,
+// so that the proxy can be placed in the path of real traffic to simulate a bad network. In record mode the metadata
+// and timings of each exchange are appended to the file. In replay mode the file is loaded when the server starts, and
+// the requests are answered with synthetic responses that have the recorded status, content type and size, sent with
+// the recorded time to first byte and total duration. For example:
+//
+//	{
+//	  "mode": "record",
+//	  "upstream": "https://api.example.com",
+//	  "file": "/var/lib/dummy/api.ndjson"
+//	}
+type ProxyConfig struct {
+	// Mode is 'forward', 'record' or 'replay'.
+	Mode string `json:"mode"`
+
+	// Upstream is the URL of the real server, mandatory in forward and record modes.
+	Upstream string `json:"upstream,omitempty"`
+
+	// File is the file that contains the recorded exchanges, one JSON document per line. It is mandatory in record
+	// and replay modes.
+	File string `json:"file,omitempty"`
+
+	// Impairment is the behavior applied to the exchanges in forward mode: the latency is added before forwarding
+	// the request, the errors and resets replace the response of the upstream, the rate limits the bandwidth of the
+	// response body, and truncated bodies are cut at a random point. The behaviors activated by the chaos mode, the
+	// scenarios and the schedules are merged on top of it, so it can be changed while the server runs.
+	Impairment *Behavior `json:"impairment,omitempty"`
+
+	// Prefix is the prefix of the paths handled by the proxy. The default is '/proxy/'.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Insecure disables the verification of the TLS certificate of the upstream.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// validate checks that the proxy settings are valid, and sets the default prefix.
+func (c *ProxyConfig) validate() error {
+	switch c.Mode {
+	case ProxyModeForward, ProxyModeRecord:
+		if c.Upstream == "" {
+			return fmt.Errorf("proxy upstream is mandatory in %s mode", c.Mode)
+		}
+		address, err := url.Parse(c.Upstream)
+		if err != nil {
+			return fmt.Errorf("proxy upstream isn't valid: %w", err)
+		}
+		if address.Scheme != "http" && address.Scheme != "https" {
+			return fmt.Errorf("scheme of the proxy upstream should be 'http' or 'https'")
+		}
+	case ProxyModeReplay:
+	default:
+		return fmt.Errorf(
+			"proxy mode should be '%s', '%s' or '%s', but it is '%s'",
+			ProxyModeForward, ProxyModeRecord, ProxyModeReplay, c.Mode,
+		)
+	}
+	if c.File == "" && c.Mode != ProxyModeForward {
+		return fmt.Errorf("proxy file is mandatory in %s mode", c.Mode)
+	}
+	if c.Impairment != nil {
+		if c.Mode != ProxyModeForward {
+			return fmt.Errorf("proxy impairment can only be used in %s mode", ProxyModeForward)
+		}
+		err := c.Impairment.Validate()
+		if err != nil {
+			return fmt.Errorf("proxy impairment isn't valid: %w", err)
+		}
+	}
+	if c.Prefix == "" {
+		c.Prefix = DefaultProxyPrefix
+	}
+	if !strings.HasPrefix(c.Prefix, "/") || !strings.HasSuffix(c.Prefix, "/") || c.Prefix == "/" {
+		return fmt.Errorf("proxy prefix '%s' should start and end with a slash, and not be only a slash", c.Prefix)
+	}
+	return nil
+}
+
+// ProxyRecord is one of the exchanges recorded by the proxy. The path doesn't contain the prefix of the proxy. The
+// first byte is the time from the reception of the request till the upstream sent the response headers.
+type ProxyRecord struct {
+	Time          time.Time `json:"time"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Query         string    `json:"query,omitempty"`
+	Status        int       `json:"status"`
+	ContentType   string    `json:"content_type,omitempty"`
+	RequestBytes  int64     `json:"request_bytes"`
+	ResponseBytes int64     `json:"response_bytes"`
+	FirstByte     Duration  `json:"first_byte"`
+	Elapsed       Duration  `json:"elapsed"`
+}
+
+// validate checks that the recorded exchange can be replayed: the status is a valid HTTP status, there is no body for
+// the statuses that don't allow it, and the times aren't negative, with the first byte before the end.
+func (r *ProxyRecord) validate() error {
+	if r.Status < 100 || r.Status > 999 {
+		return fmt.Errorf("status %d should be between 100 and 999", r.Status)
+	}
+	if r.ResponseBytes < 0 {
+		return fmt.Errorf("response bytes %d can't be negative", r.ResponseBytes)
+	}
+	if r.ResponseBytes > 0 && !proxyBodyAllowed(r.Status) {
+		return fmt.Errorf("status %d doesn't allow a body, but there are %d response bytes", r.Status, r.ResponseBytes)
+	}
+	if r.FirstByte < 0 {
+		return fmt.Errorf("first byte time %s can't be negative", time.Duration(r.FirstByte))
+	}
+	if r.Elapsed < 0 {
+		return fmt.Errorf("elapsed time %s can't be negative", time.Duration(r.Elapsed))
+	}
+	if r.FirstByte > r.Elapsed {
+		return fmt.Errorf(
+			"first byte time %s is after the elapsed time %s",
+			time.Duration(r.FirstByte), time.Duration(r.Elapsed),
+		)
+	}
+	return nil
+}
+
+// proxyBodyAllowed returns true if responses with the given status can have a body.
+func proxyBodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// Proxy forwards the requests to a real upstream, adding impairments or recording the exchanges, or replays recorded
+// exchanges synthetically.
+type Proxy struct {
+	logger    *slog.Logger
+	config    ProxyConfig
+	behaviors *BehaviorSet
+
+	// proxy is used in forward and record modes, and file in record mode.
+	proxy *httputil.ReverseProxy
+	file  *os.File
+
+	// records contains the recorded exchanges, indexed by method, path and query, and by method and path, and next
+	// contains the index of the next one to replay for each key. They are used in replay mode.
+	records map[string][]*ProxyRecord
+	next    map[string]int
+
+	// lock protects the writes to the file and the indexes of the next exchanges.
+	lock sync.Mutex
+}
+
+// NewProxy creates the proxy. In record mode it opens the file for appending, and in replay mode it loads it. The
+// active behaviors of the given set are added to the impairment of the forward mode.
+func NewProxy(logger *slog.Logger, config ProxyConfig, behaviors *BehaviorSet) (result *Proxy, err error) {
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	if behaviors == nil {
+		behaviors = &BehaviorSet{}
+	}
+	proxy := &Proxy{
+		logger:    logger,
+		config:    config,
+		behaviors: behaviors,
+	}
+	switch config.Mode {
+	case ProxyModeForward, ProxyModeRecord:
+		err = proxy.startForwarding()
+	case ProxyModeReplay:
+		err = proxy.load()
+	}
+	if err != nil {
+		return
+	}
+	result = proxy
+	return
+}
+
+// startForwarding creates the reverse proxy, and in record mode opens the file.
+func (p *Proxy) startForwarding() error {
+	upstream, err := url.Parse(p.config.Upstream)
+	if err != nil {
+		return err
+	}
+	if p.config.Mode == ProxyModeRecord {
+		p.file, err = os.OpenFile(p.config.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open proxy file: %w", err)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.config.Insecure {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Path = p.trim(r.In.URL.Path)
+			r.Out.URL.RawPath = ""
+			r.SetURL(upstream)
+			r.SetXForwarded()
+		},
+		Transport:      transport,
+		ModifyResponse: p.truncate,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			p.logger.Error(
+				"Failed to forward request",
+				slog.String("upstream", p.config.Upstream),
+				slog.String("path", r.URL.Path),
+				slog.String("error", err.Error()),
+			)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	if p.config.Mode == ProxyModeRecord {
+		p.logger.Info(
+			"Recording proxy exchanges",
+			slog.String("prefix", p.config.Prefix),
+			slog.String("upstream", p.config.Upstream),
+			slog.String("file", p.config.File),
+		)
+	} else {
+		p.logger.Info(
+			"Forwarding proxy exchanges",
+			slog.String("prefix", p.config.Prefix),
+			slog.String("upstream", p.config.Upstream),
+			slog.Any("impairment", p.config.Impairment),
+		)
+	}
+	return nil
+}
+
+// load reads the recorded exchanges from the file.
+func (p *Proxy) load() error {
+	file, err := os.Open(p.config.File)
+	if err != nil {
+		return fmt.Errorf("failed to open proxy file: %w", err)
+	}
+	defer file.Close()
+	p.records = map[string][]*ProxyRecord{}
+	p.next = map[string]int{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	count := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		record := &ProxyRecord{}
+		err = json.Unmarshal([]byte(text), record)
+		if err != nil {
+			return fmt.Errorf("failed to parse line %d of proxy file: %w", line, err)
+		}
+		err = record.validate()
+		if err != nil {
+			return fmt.Errorf("line %d of proxy file isn't valid: %w", line, err)
+		}
+		exact, partial := proxyKeys(record.Method, record.Path, record.Query)
+		p.records[exact] = append(p.records[exact], record)
+		p.records[partial] = append(p.records[partial], record)
+		count++
+	}
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read proxy file: %w", err)
+	}
+	p.logger.Info(
+		"Loaded proxy exchanges",
+		slog.String("prefix", p.config.Prefix),
+		slog.String("file", p.config.File),
+		slog.Int("count", count),
+	)
+	return nil
+}
+
+// Prefix returns the prefix of the paths handled by the proxy.
+func (p *Proxy) Prefix() string {
+	return p.config.Prefix
+}
+
+// Close closes the file of the recorded exchanges. The receiver can be nil.
+func (p *Proxy) Close() error {
+	if p == nil || p.file == nil {
+		return nil
+	}
+	return p.file.Close()
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch p.config.Mode {
+	case ProxyModeForward:
+		p.forward(w, r)
+	case ProxyModeRecord:
+		p.record(w, r)
+	case ProxyModeReplay:
+		p.replay(w, r)
+	}
+}
+
+// forward applies the impairment and forwards the request to the upstream.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	var behavior Behavior
+	if p.config.Impairment != nil {
+		behavior = *p.config.Impairment
+	}
+	behavior = behavior.Merge(p.behaviors.Current())
+	if behavior.SlowRate > 0 && rand.Float64() < behavior.SlowRate {
+		behavior.Latency += behavior.SlowLatency
+	}
+	if behavior.Latency > 0 {
+		select {
+		case <-time.After(behavior.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if behavior.ResetRate > 0 && rand.Float64() < behavior.ResetRate {
+		p.logger.Info(
+			"Simulated proxy connection reset",
+			slog.String("path", r.URL.Path),
+		)
+		resetConnection(w)
+		return
+	}
+	if behavior.ErrorRate > 0 && rand.Float64() < behavior.ErrorRate {
+		errorStatus := behavior.ErrorStatus
+		if errorStatus == 0 {
+			errorStatus = http.StatusBadGateway
+		}
+		p.logger.Info(
+			"Simulated proxy error",
+			slog.String("path", r.URL.Path),
+			slog.Int("status", errorStatus),
+		)
+		w.WriteHeader(errorStatus)
+		return
+	}
+	if behavior.TruncateRate > 0 && rand.Float64() < behavior.TruncateRate {
+		r = r.WithContext(context.WithValue(r.Context(), proxyTruncateKey{}, true))
+	}
+	if behavior.Rate > 0 {
+		w = &pacedWriter{
+			ResponseWriter: w,
+			ctx:            r.Context(),
+			rate:           float64(behavior.Rate),
+			start:          time.Now(),
+		}
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// proxyTruncateKey is the key of the context value that marks the requests whose response body will be truncated.
+type proxyTruncateKey struct{}
+
+// proxyTruncateMax is the maximum size of the truncated bodies when the upstream doesn't send the content length.
+const proxyTruncateMax = 1 << 20
+
+// truncate cuts the body of the response at a random point, if the request was marked for it. The reverse proxy then
+// aborts the response, so the client receives an incomplete body.
+func (p *Proxy) truncate(response *http.Response) error {
+	truncated, _ := response.Request.Context().Value(proxyTruncateKey{}).(bool)
+	if !truncated || response.ContentLength == 0 {
+		return nil
+	}
+	limit := response.ContentLength
+	if limit < 0 {
+		limit = proxyTruncateMax
+	}
+	limit = rand.Int64N(limit)
+	p.logger.Info(
+		"Simulated proxy truncated body",
+		slog.String("path", response.Request.URL.Path),
+		slog.Int64("size", response.ContentLength),
+		slog.Int64("limit", limit),
+	)
+	response.Body = &proxyTruncatedBody{
+		reader:    response.Body,
+		remaining: limit,
+	}
+	return nil
+}
+
+// proxyTruncatedBody is a response body that fails after a number of bytes.
+type proxyTruncatedBody struct {
+	reader    io.ReadCloser
+	remaining int64
+}
+
+// Read is the implementation of the io.Reader interface.
+func (b *proxyTruncatedBody) Read(p []byte) (n int, err error) {
+	if b.remaining <= 0 {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err = b.reader.Read(p)
+	b.remaining -= int64(n)
+	return
+}
+
+// Close is the implementation of the io.Closer interface.
+func (b *proxyTruncatedBody) Close() error {
+	return b.reader.Close()
+}
+
+// record forwards the request to the upstream, and appends the exchange to the file.
+func (p *Proxy) record(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	body := &proxyBodyCounter{
+		reader: r.Body,
+	}
+	r.Body = body
+	recorder := &proxyRecorder{
+		ResponseWriter: w,
+		start:          start,
+		status:         http.StatusOK,
+	}
+	p.proxy.ServeHTTP(recorder, r)
+	record := &ProxyRecord{
+		Time:          start.UTC(),
+		Method:        r.Method,
+		Path:          p.trim(r.URL.Path),
+		Query:         r.URL.RawQuery,
+		Status:        recorder.status,
+		ContentType:   recorder.Header().Get("Content-Type"),
+		RequestBytes:  body.count,
+		ResponseBytes: recorder.count,
+		FirstByte:     Duration(recorder.firstByte),
+		Elapsed:       Duration(time.Since(start)),
+	}
+	data, err := json.Marshal(record)
+	if err == nil {
+		data = append(data, '\n')
+		p.lock.Lock()
+		_, err = p.file.Write(data)
+		p.lock.Unlock()
+	}
+	if err != nil {
+		p.logger.Error(
+			"Failed to record proxy exchange",
+			slog.String("file", p.config.File),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// replay sends a synthetic response with the status, content type, size and timings of the recorded exchange that
+// matches the request. When there are several matching exchanges they are replayed in turns.
+func (p *Proxy) replay(w http.ResponseWriter, r *http.Request) {
+	record := p.lookup(r.Method, p.trim(r.URL.Path), r.URL.RawQuery)
+	if record == nil {
+		http.Error(w, "no recorded exchange matches the request", http.StatusNotFound)
+		return
+	}
+
+	// Drain the request body, as the upstream would do:
+	_, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		return
+	}
+
+	// Wait till the time of the first byte, measured from the reception of the request:
+	start := time.Now()
+	select {
+	case <-time.After(time.Duration(record.FirstByte)):
+	case <-r.Context().Done():
+		return
+	}
+
+	// Send the body paced so that the transfer lasts what the recorded one lasted:
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	if proxyBodyAllowed(record.Status) {
+		w.Header().Set("Content-Length", strconv.FormatInt(record.ResponseBytes, 10))
+	}
+	w.WriteHeader(record.Status)
+	if r.Method == http.MethodHead || record.ResponseBytes == 0 {
+		return
+	}
+	var writer io.Writer = w
+	transfer := time.Duration(record.Elapsed - record.FirstByte)
+	if transfer > 0 {
+		writer = &pacedWriter{
+			ResponseWriter: w,
+			ctx:            r.Context(),
+			rate:           float64(record.ResponseBytes) / transfer.Seconds(),
+			start:          time.Now(),
+		}
+	}
+	var seed [32]byte
+	_, err = crand.Read(seed[:])
+	if err == nil {
+		reader := newDataSourceReader(lookupDataSource(sourceRandom), seed, record.ResponseBytes)
+		_, err = io.Copy(writer, reader)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		p.logger.Debug(
+			"Failed to replay proxy exchange",
+			slog.String("path", r.URL.Path),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	p.logger.Debug(
+		"Replayed proxy exchange",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", record.Status),
+		slog.Int64("bytes", record.ResponseBytes),
+		slog.String("elapsed", time.Since(start).String()),
+	)
+}
+
+// lookup returns the next recorded exchange for the given method, path and query, or for the method and path if there
+// is none for the query, or nil if there is none at all.
+func (p *Proxy) lookup(method, path, query string) *ProxyRecord {
+	exact, partial := proxyKeys(method, path, query)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, key := range []string{exact, partial} {
+		records := p.records[key]
+		if len(records) == 0 {
+			continue
+		}
+		index := p.next[key]
+		p.next[key] = (index + 1) % len(records)
+		return records[index]
+	}
+	return nil
+}
+
+// trim removes the prefix of the proxy from the given path, keeping the leading slash.
+func (p *Proxy) trim(path string) string {
+	return "/" + strings.TrimPrefix(path, p.config.Prefix)
+}
+
+// proxyKeys returns the keys used to find the recorded exchanges, the first one includes the query.
+func proxyKeys(method, path, query string) (exact, partial string) {
+	partial = method + " " + path
+	exact = partial + "?" + query
+	return
+}
+
+// proxyRecorder is a response writer that records the status, the size of the body and the time of the first byte.
+type proxyRecorder struct {
+	http.ResponseWriter
+	start     time.Time
+	status    int
+	count     int64
+	firstByte time.Duration
+	wrote     bool
+}
+
+// WriteHeader is the implementation of the http.ResponseWriter interface.
+func (w *proxyRecorder) WriteHeader(status int) {
+	if !w.wrote {
+		w.wrote = true
+		w.status = status
+		w.firstByte = time.Since(w.start)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write is the implementation of the http.ResponseWriter interface.
+func (w *proxyRecorder) Write(p []byte) (n int, err error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err = w.ResponseWriter.Write(p)
+	w.count += int64(n)
+	return
+}
+
+// Unwrap returns the original response writer, so that the reverse proxy can flush it.
+func (w *proxyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// proxyBodyCounter is a request body that counts the bytes read.
+type proxyBodyCounter struct {
+	reader io.ReadCloser
+	count  int64
+}
+
+// Read is the implementation of the io.Reader interface.
+func (b *proxyBodyCounter) Read(p []byte) (n int, err error) {
+	n, err = b.reader.Read(p)
+	b.count += int64(n)
+	return
+}
+
+// Close is the implementation of the io.Closer interface.
+func (b *proxyBodyCounter) Close() error {
+	return b.reader.Close()
+}
@@ -0,0 +1,130 @@
+package dummy
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProxyLoad(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		fail  string
+	}{
+		{
+			name: "Valid",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 200, "response_bytes": 10, "elapsed": "2ms"}`,
+				`{"method": "GET", "path": "/a", "status": 200, "first_byte": "1ms", "elapsed": "2ms"}`,
+				``,
+				`{"method": "GET", "path": "/b", "status": 204, "first_byte": "1ms", "elapsed": "1ms"}`,
+				`{"method": "GET", "path": "/c", "status": 304}`,
+			},
+		},
+		{
+			name: "Status too low",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 200}`,
+				`{"method": "GET", "path": "/b", "status": 99}`,
+			},
+			fail: "line 2 of proxy file isn't valid: status 99 should be between 100 and 999",
+		},
+		{
+			name: "Status too high",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 1000}`,
+			},
+			fail: "line 1 of proxy file isn't valid: status 1000",
+		},
+		{
+			name: "Missing status",
+			lines: []string{
+				`{"method": "GET", "path": "/a"}`,
+			},
+			fail: "status 0",
+		},
+		{
+			name: "Body with no content",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 204, "response_bytes": 10}`,
+			},
+			fail: "status 204 doesn't allow a body",
+		},
+		{
+			name: "Body with not modified",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 304, "response_bytes": 10}`,
+			},
+			fail: "status 304 doesn't allow a body",
+		},
+		{
+			name: "Body with informational status",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 103, "response_bytes": 10}`,
+			},
+			fail: "status 103 doesn't allow a body",
+		},
+		{
+			name: "Negative response bytes",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 200, "response_bytes": -1}`,
+			},
+			fail: "can't be negative",
+		},
+		{
+			name: "Negative first byte",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 200, "first_byte": "-1s", "elapsed": "1s"}`,
+			},
+			fail: "first byte time -1s can't be negative",
+		},
+		{
+			name: "Negative elapsed",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 200, "elapsed": "-1s"}`,
+			},
+			fail: "elapsed time -1s can't be negative",
+		},
+		{
+			name: "First byte after elapsed",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 200, "first_byte": "2s", "elapsed": "1s"}`,
+			},
+			fail: "first byte time 2s is after the elapsed time 1s",
+		},
+		{
+			name: "Not JSON",
+			lines: []string{
+				`{"method": "GET", "path": "/a", "status": 200}`,
+				`junk`,
+			},
+			fail: "failed to parse line 2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "proxy.ndjson")
+			err := os.WriteFile(file, []byte(strings.Join(test.lines, "\n")), 0600)
+			if err != nil {
+				t.Fatalf("failed to write proxy file: %v", err)
+			}
+			_, err = NewProxy(slog.New(slog.NewTextHandler(io.Discard, nil)), ProxyConfig{
+				Mode: ProxyModeReplay,
+				File: file,
+			}, nil)
+			if test.fail != "" {
+				if err == nil || !strings.Contains(err.Error(), test.fail) {
+					t.Fatalf("expected an error containing '%s', but got: %v", test.fail, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
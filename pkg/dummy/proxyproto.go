@@ -0,0 +1,350 @@
+package dummy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modes of the support for the PROXY protocol:
+const (
+	ProxyProtocolOff      = "off"
+	ProxyProtocolOptional = "optional"
+	ProxyProtocolRequired = "required"
+)
+
+// Time that the server waits for the PROXY protocol header.
+const defaultProxyHeaderTimeout = 5 * time.Second
+
+// Signatures of the versions of the PROXY protocol:
+var (
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// Maximum length of a version 1 header, including the CRLF.
+const proxyV1MaxLength = 107
+
+// ProxyListener is a listener that accepts connections that start with the header of the HAProxy PROXY protocol,
+// versions 1 and 2. The header is removed from the data, and the addresses that it contains are returned by the
+// RemoteAddr and LocalAddr methods of the connections, so that the rest of the server sees the real client address
+// even when it is behind a layer four load balancer. In optional mode connections without the header are accepted
+// and keep their real addresses. In required mode they are closed.
+//
+// When there is a list of trusted CIDRs only the headers sent by peers inside those ranges, usually the load
+// balancers, are honoured. Connections from other peers are treated as if they had no header, so that clients can't
+// pretend to have other addresses: in optional mode they keep their real addresses and their data isn't changed, and
+// in required mode they are closed. Peers that don't have IP addresses, like those of Unix sockets, are trusted, as
+// access to those is controlled by the permissions of the file.
+type ProxyListener struct {
+	net.Listener
+	required bool
+	trusted  []netip.Prefix
+	timeout  time.Duration
+}
+
+// NewProxyListener wraps the given listener so that it processes the PROXY protocol header. The mode should be
+// 'optional' or 'required'. The trusted list contains the CIDRs of the peers whose headers are honoured. When it is
+// empty the headers of all the peers are honoured.
+func NewProxyListener(listener net.Listener, mode string, trusted []string) (result *ProxyListener, err error) {
+	switch mode {
+	case ProxyProtocolOptional, ProxyProtocolRequired:
+	default:
+		err = fmt.Errorf(
+			"PROXY protocol mode should be '%s', '%s' or '%s', but it is '%s'",
+			ProxyProtocolOff, ProxyProtocolOptional, ProxyProtocolRequired, mode,
+		)
+		return
+	}
+	prefixes, err := parseProxyTrusted(trusted)
+	if err != nil {
+		return
+	}
+	result = &ProxyListener{
+		Listener: listener,
+		required: mode == ProxyProtocolRequired,
+		trusted:  prefixes,
+		timeout:  defaultProxyHeaderTimeout,
+	}
+	return
+}
+
+// parseProxyTrusted parses the CIDRs of the peers trusted to send PROXY protocol headers.
+func parseProxyTrusted(trusted []string) (result []netip.Prefix, err error) {
+	result = make([]netip.Prefix, len(trusted))
+	for i, cidr := range trusted {
+		result[i], err = netip.ParsePrefix(cidr)
+		if err != nil {
+			err = fmt.Errorf("trusted PROXY protocol CIDR '%s' isn't valid: %w", cidr, err)
+			return
+		}
+		result[i] = result[i].Masked()
+	}
+	return
+}
+
+// trusts checks if the PROXY protocol header sent by the given peer should be honoured.
+func (l *ProxyListener) trusts(peer net.Addr) bool {
+	if len(l.trusted) == 0 {
+		return true
+	}
+	tcpAddr, ok := peer.(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	addr := tcpAddr.AddrPort().Addr().Unmap()
+	for _, prefix := range l.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Accept is the implementation of the net.Listener interface. Note that the header isn't read here, but when the
+// connection is first used, so that a slow client doesn't block the accept loop.
+func (l *ProxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{
+		Conn:     conn,
+		reader:   bufio.NewReader(conn),
+		required: l.required,
+		trusted:  l.trusts(conn.RemoteAddr()),
+		timeout:  l.timeout,
+	}, nil
+}
+
+// proxyConn is a connection that may start with a PROXY protocol header.
+type proxyConn struct {
+	net.Conn
+	reader   *bufio.Reader
+	required bool
+	trusted  bool
+	timeout  time.Duration
+	once     sync.Once
+	err      error
+	remote   net.Addr
+	local    net.Addr
+	lock     sync.Mutex
+	deadline time.Time
+}
+
+// Read is the implementation of the io.Reader interface.
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.once.Do(c.init)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr is the implementation of the net.Conn interface.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.init)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr is the implementation of the net.Conn interface.
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.once.Do(c.init)
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// SetDeadline is the implementation of the net.Conn interface.
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.deadline = t
+	c.lock.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline is the implementation of the net.Conn interface.
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.deadline = t
+	c.lock.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) init() {
+	// Don't look for the header if the peer isn't allowed to send it:
+	if !c.trusted {
+		if c.required {
+			c.err = fmt.Errorf("peer '%s' isn't trusted to send the PROXY protocol header", c.Conn.RemoteAddr())
+		}
+		return
+	}
+
+	// Read the header with our own deadline, and then restore the one set by the user of the connection, if any.
+	// This is needed because the multiplexer sets its own deadline before peeking at the first bytes.
+	c.err = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	if c.err != nil {
+		return
+	}
+	c.remote, c.local, c.err = readProxyHeader(c.reader, c.required)
+	if c.err != nil {
+		c.err = fmt.Errorf("failed to read PROXY protocol header from '%s': %w", c.Conn.RemoteAddr(), c.err)
+		return
+	}
+	c.lock.Lock()
+	deadline := c.deadline
+	c.lock.Unlock()
+	c.err = c.Conn.SetReadDeadline(deadline)
+}
+
+// readProxyHeader reads the PROXY protocol header and returns the source and destination addresses. The addresses are
+// nil if there is no header, or if it doesn't contain addresses, as in health checks sent by the load balancer itself.
+func readProxyHeader(reader *bufio.Reader, required bool) (source, destination net.Addr, err error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return
+	}
+	switch first[0] {
+	case proxyV1Signature[0]:
+		var data []byte
+		data, err = reader.Peek(len(proxyV1Signature))
+		if err == nil && bytes.Equal(data, proxyV1Signature) {
+			return readProxyV1Header(reader)
+		}
+	case proxyV2Signature[0]:
+		var data []byte
+		data, err = reader.Peek(len(proxyV2Signature))
+		if err == nil && bytes.Equal(data, proxyV2Signature) {
+			return readProxyV2Header(reader)
+		}
+	}
+	if err == nil && required {
+		err = errors.New("header is missing")
+	}
+	return
+}
+
+func readProxyV1Header(reader *bufio.Reader) (source, destination net.Addr, err error) {
+	// Read the line, without reading past the maximum length:
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		var b byte
+		b, err = reader.ReadByte()
+		if err != nil {
+			return
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		err = errors.New("version 1 header isn't terminated by CRLF")
+		return
+	}
+
+	// The format is 'PROXY TCP4 source destination source-port destination-port':
+	fields := strings.Fields(text)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		err = fmt.Errorf("version 1 header '%s' isn't valid", text)
+		return
+	}
+	source, err = parseProxyV1Addr(fields[2], fields[4])
+	if err != nil {
+		return
+	}
+	destination, err = parseProxyV1Addr(fields[3], fields[5])
+	return
+}
+
+func parseProxyV1Addr(host, port string) (result net.Addr, err error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		err = fmt.Errorf("address '%s' isn't valid", host)
+		return
+	}
+	number, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		err = fmt.Errorf("port '%s' isn't valid", port)
+		return
+	}
+	result = &net.TCPAddr{
+		IP:   ip,
+		Port: int(number),
+	}
+	return
+}
+
+func readProxyV2Header(reader *bufio.Reader) (source, destination net.Addr, err error) {
+	// The fixed part contains the signature, the version and command, the family and protocol, and the length of
+	// the rest of the header:
+	var fixed [16]byte
+	_, err = io.ReadFull(reader, fixed[:])
+	if err != nil {
+		return
+	}
+	version := fixed[12] >> 4
+	command := fixed[12] & 0x0f
+	family := fixed[13] >> 4
+	length := binary.BigEndian.Uint16(fixed[14:])
+	if version != 2 {
+		err = fmt.Errorf("version %d isn't supported", version)
+		return
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		return
+	}
+
+	// The local command is used by the load balancer for health checks, and the addresses should be ignored:
+	if command == 0 {
+		return
+	}
+	if command != 1 {
+		err = fmt.Errorf("command %d isn't supported", command)
+		return
+	}
+
+	// Only the IP families have addresses that are useful for us, the rest are ignored. Note that the data may
+	// contain additional type-length-value fields after the addresses, those are ignored.
+	var size int
+	switch family {
+	case 1:
+		size = net.IPv4len
+	case 2:
+		size = net.IPv6len
+	default:
+		return
+	}
+	if len(data) < 2*size+4 {
+		err = fmt.Errorf("address block of %d bytes is too short", len(data))
+		return
+	}
+	source = &net.TCPAddr{
+		IP:   net.IP(data[0:size]),
+		Port: int(binary.BigEndian.Uint16(data[2*size:])),
+	}
+	destination = &net.TCPAddr{
+		IP:   net.IP(data[size : 2*size]),
+		Port: int(binary.BigEndian.Uint16(data[2*size+2:])),
+	}
+	return
+}
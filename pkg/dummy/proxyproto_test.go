@@ -0,0 +1,310 @@
+package dummy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// proxyV2Header builds a version 2 header with the given version and command byte, family and protocol byte, and
+// payload.
+func proxyV2Header(command, family byte, payload []byte) string {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return string(append(header, payload...))
+}
+
+// proxyV2Addresses builds the address block of a version 2 header.
+func proxyV2Addresses(source, destination string, sourcePort, destinationPort uint16) []byte {
+	sourceIP := net.ParseIP(source)
+	destinationIP := net.ParseIP(destination)
+	if sourceIP.To4() != nil {
+		sourceIP = sourceIP.To4()
+		destinationIP = destinationIP.To4()
+	}
+	block := append([]byte(nil), sourceIP...)
+	block = append(block, destinationIP...)
+	block = binary.BigEndian.AppendUint16(block, sourcePort)
+	block = binary.BigEndian.AppendUint16(block, destinationPort)
+	return block
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		required    bool
+		rest        string
+		source      string
+		destination string
+		fail        bool
+	}{
+		{
+			name:        "Version 1 with IPv4",
+			input:       "PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\nGET / HTTP/1.1\r\n",
+			source:      "192.168.0.1:56324",
+			destination: "10.0.0.1:443",
+			rest:        "GET / HTTP/1.1\r\n",
+		},
+		{
+			name:        "Version 1 with IPv6",
+			input:       "PROXY TCP6 2001:db8::1 2001:db8::2 1234 8080\r\nGET / HTTP/1.1\r\n",
+			source:      "[2001:db8::1]:1234",
+			destination: "[2001:db8::2]:8080",
+			rest:        "GET / HTTP/1.1\r\n",
+		},
+		{
+			name:  "Version 1 unknown",
+			input: "PROXY UNKNOWN\r\nGET / HTTP/1.1\r\n",
+			rest:  "GET / HTTP/1.1\r\n",
+		},
+		{
+			name:  "Version 1 without CRLF",
+			input: "PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\nGET / HTTP/1.1\r\n",
+			fail:  true,
+		},
+		{
+			name:  "Version 1 too long",
+			input: "PROXY TCP4 " + strings.Repeat("1", proxyV1MaxLength) + "\r\n",
+			fail:  true,
+		},
+		{
+			name:  "Version 1 with wrong number of fields",
+			input: "PROXY TCP4 192.168.0.1 10.0.0.1 56324\r\n",
+			fail:  true,
+		},
+		{
+			name:  "Version 1 with unknown protocol",
+			input: "PROXY UDP4 192.168.0.1 10.0.0.1 56324 443\r\n",
+			fail:  true,
+		},
+		{
+			name:  "Version 1 with invalid address",
+			input: "PROXY TCP4 192.168.0.256 10.0.0.1 56324 443\r\n",
+			fail:  true,
+		},
+		{
+			name:  "Version 1 with invalid port",
+			input: "PROXY TCP4 192.168.0.1 10.0.0.1 65536 443\r\n",
+			fail:  true,
+		},
+		{
+			name:        "Version 2 with IPv4",
+			input:       proxyV2Header(0x21, 0x11, proxyV2Addresses("192.168.0.1", "10.0.0.1", 56324, 443)) + "GET",
+			source:      "192.168.0.1:56324",
+			destination: "10.0.0.1:443",
+			rest:        "GET",
+		},
+		{
+			name:        "Version 2 with IPv6",
+			input:       proxyV2Header(0x21, 0x21, proxyV2Addresses("2001:db8::1", "2001:db8::2", 1234, 8080)) + "GET",
+			source:      "[2001:db8::1]:1234",
+			destination: "[2001:db8::2]:8080",
+			rest:        "GET",
+		},
+		{
+			name: "Version 2 with additional fields",
+			input: proxyV2Header(
+				0x21, 0x11,
+				append(proxyV2Addresses("192.168.0.1", "10.0.0.1", 56324, 443), 0x04, 0x00, 0x01, 0x00),
+			) + "GET",
+			source:      "192.168.0.1:56324",
+			destination: "10.0.0.1:443",
+			rest:        "GET",
+		},
+		{
+			name:  "Version 2 local command",
+			input: proxyV2Header(0x20, 0x00, nil) + "GET",
+			rest:  "GET",
+		},
+		{
+			name:  "Version 2 unspecified family",
+			input: proxyV2Header(0x21, 0x00, []byte{1, 2, 3}) + "GET",
+			rest:  "GET",
+		},
+		{
+			name:  "Version 2 with wrong version",
+			input: proxyV2Header(0x11, 0x11, proxyV2Addresses("192.168.0.1", "10.0.0.1", 56324, 443)),
+			fail:  true,
+		},
+		{
+			name:  "Version 2 with unknown command",
+			input: proxyV2Header(0x22, 0x11, proxyV2Addresses("192.168.0.1", "10.0.0.1", 56324, 443)),
+			fail:  true,
+		},
+		{
+			name:  "Version 2 with short address block",
+			input: proxyV2Header(0x21, 0x11, []byte{192, 168, 0, 1}),
+			fail:  true,
+		},
+		{
+			name:  "Version 2 truncated",
+			input: proxyV2Header(0x21, 0x11, proxyV2Addresses("192.168.0.1", "10.0.0.1", 56324, 443))[:20],
+			fail:  true,
+		},
+		{
+			name:  "Missing and optional",
+			input: "GET / HTTP/1.1\r\n",
+			rest:  "GET / HTTP/1.1\r\n",
+		},
+		{
+			name:     "Missing and required",
+			input:    "GET / HTTP/1.1\r\n",
+			required: true,
+			fail:     true,
+		},
+		{
+			name:  "Missing with the first byte of the signature",
+			input: "POST / HTTP/1.1\r\n",
+			rest:  "POST / HTTP/1.1\r\n",
+		},
+		{
+			name:  "Connection closed inside the signature",
+			input: "PROX",
+			fail:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(test.input))
+			source, destination, err := readProxyHeader(reader, test.required)
+			if test.fail {
+				if err == nil {
+					t.Fatalf("expected an error, but got source '%v' and destination '%v'", source, destination)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkProxyAddr(t, "source", source, test.source)
+			checkProxyAddr(t, "destination", destination, test.destination)
+
+			// The data that follows the header should be untouched:
+			rest, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("failed to read the rest of the data: %v", err)
+			}
+			if string(rest) != test.rest {
+				t.Errorf("expected data after the header %q, but got %q", test.rest, rest)
+			}
+		})
+	}
+}
+
+func checkProxyAddr(t *testing.T, name string, actual net.Addr, expected string) {
+	t.Helper()
+	if expected == "" {
+		if actual != nil {
+			t.Errorf("expected no %s address, but got '%s'", name, actual)
+		}
+		return
+	}
+	if actual == nil {
+		t.Errorf("expected %s address '%s', but got nothing", name, expected)
+		return
+	}
+	if actual.String() != expected {
+		t.Errorf("expected %s address '%s', but got '%s'", name, expected, actual)
+	}
+}
+
+func TestProxyListenerTrusted(t *testing.T) {
+	header := "PROXY TCP4 192.0.2.1 192.0.2.2 1000 80\r\n"
+	tests := []struct {
+		name    string
+		mode    string
+		trusted []string
+		remote  string
+		data    string
+		fail    string
+	}{
+		{
+			name:   "All peers trusted",
+			mode:   ProxyProtocolOptional,
+			remote: "192.0.2.1:1000",
+			data:   "hello",
+		},
+		{
+			name:    "Trusted peer",
+			mode:    ProxyProtocolOptional,
+			trusted: []string{"10.0.0.0/8", "127.0.0.0/8"},
+			remote:  "192.0.2.1:1000",
+			data:    "hello",
+		},
+		{
+			name:    "Untrusted peer in optional mode",
+			mode:    ProxyProtocolOptional,
+			trusted: []string{"10.0.0.0/8"},
+			remote:  "127.0.0.1",
+			data:    header + "hello",
+		},
+		{
+			name:    "Untrusted peer in required mode",
+			mode:    ProxyProtocolRequired,
+			trusted: []string{"10.0.0.0/8"},
+			fail:    "isn't trusted",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			socket, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer socket.Close()
+			listener, err := NewProxyListener(socket, test.mode, test.trusted)
+			if err != nil {
+				t.Fatalf("failed to create listener: %v", err)
+			}
+			client, err := net.Dial("tcp", socket.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer client.Close()
+			_, err = client.Write([]byte(header + "hello"))
+			if err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+			client.(*net.TCPConn).CloseWrite()
+			conn, err := listener.Accept()
+			if err != nil {
+				t.Fatalf("failed to accept: %v", err)
+			}
+			defer conn.Close()
+			data, err := io.ReadAll(conn)
+			if test.fail != "" {
+				if err == nil || !strings.Contains(err.Error(), test.fail) {
+					t.Fatalf("expected an error containing '%s', but got: %v", test.fail, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if string(data) != test.data {
+				t.Errorf("expected data %q, but got %q", test.data, data)
+			}
+			remote := conn.RemoteAddr().String()
+			if !strings.HasPrefix(remote, test.remote) {
+				t.Errorf("expected remote address '%s', but got '%s'", test.remote, remote)
+			}
+		})
+	}
+}
+
+func TestNewProxyListenerInvalidTrusted(t *testing.T) {
+	socket, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer socket.Close()
+	_, err = NewProxyListener(socket, ProxyProtocolOptional, []string{"10.0.0.1"})
+	if err == nil || !strings.Contains(err.Error(), "CIDR '10.0.0.1' isn't valid") {
+		t.Errorf("expected an error for the invalid CIDR, but got: %v", err)
+	}
+}
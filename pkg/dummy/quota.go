@@ -0,0 +1,332 @@
+package dummy
+
+import (
+	"bufio"
+	"container/list"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Ways to identify the clients for the quotas:
+const (
+	QuotaKeyIP    = "ip"
+	QuotaKeyToken = "token"
+)
+
+// Name of the response header that contains the number of bytes that the client can still download.
+const quotaRemainingHeader = "X-Quota-Remaining"
+
+// Maximum number of clients whose downloaded bytes are remembered.
+const maxQuotaAccounts = 100000
+
+// errQuotaExceeded is returned by the writes that would exceed the quota of the client.
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// QuotasConfig contains the number of bytes that each client can download, so that a shared server isn't monopolized
+// by one client. Zero means no limit.
+type QuotasConfig struct {
+	// Key is the way to identify the clients, 'ip' (the default) for the remote address, or 'token' for the bearer
+	// token of the 'Authorization' header. Requests without a token, or with a token that isn't in the list of
+	// tokens, are identified by the remote address, so that clients can't get a fresh quota sending a new token.
+	Key string `json:"key,omitempty"`
+
+	// Tokens are the bearer tokens that identify clients. They are mandatory when the key is 'token'.
+	Tokens []string `json:"tokens,omitempty"`
+
+	// Daily is the number of bytes that each client can download per day. Days start at midnight UTC.
+	Daily int64 `json:"daily,omitempty"`
+
+	// Total is the number of bytes that each client can download since the server started.
+	Total int64 `json:"total,omitempty"`
+}
+
+// validate checks that the quotas are valid.
+func (c *QuotasConfig) validate() error {
+	switch c.Key {
+	case "", QuotaKeyIP, QuotaKeyToken:
+	default:
+		return fmt.Errorf("quota key should be '%s' or '%s', but it is '%s'", QuotaKeyIP, QuotaKeyToken, c.Key)
+	}
+	if c.Key == QuotaKeyToken && len(c.Tokens) == 0 {
+		return fmt.Errorf("quota tokens are mandatory when the key is '%s'", QuotaKeyToken)
+	}
+	if c.Key != QuotaKeyToken && len(c.Tokens) > 0 {
+		return fmt.Errorf("quota tokens can only be used when the key is '%s'", QuotaKeyToken)
+	}
+	for i, token := range c.Tokens {
+		if token == "" {
+			return fmt.Errorf("quota token %d is empty", i)
+		}
+	}
+	if c.Daily < 0 {
+		return fmt.Errorf("daily quota %d is negative", c.Daily)
+	}
+	if c.Total < 0 {
+		return fmt.Errorf("total quota %d is negative", c.Total)
+	}
+	return nil
+}
+
+// quotaAccount contains the bytes downloaded by one client.
+type quotaAccount struct {
+	client string
+	day    time.Time
+	daily  int64
+	total  int64
+}
+
+// QuotaHandler is an HTTP handler that counts the bytes of the responses of the wrapped handler for each client, and
+// rejects the requests of the clients that have exhausted their quotas with the 429 status code. Responses contain the
+// 'X-Quota-Remaining' header with the number of bytes that the client could download when the request was received,
+// and they are aborted when the client reaches the limit.
+//
+// When there is only a daily quota the accounts of the clients are forgotten when the day ends. In any case no more
+// than one hundred thousand accounts are kept, and when that limit is reached the least recently used one is
+// forgotten, which resets its counters.
+type QuotaHandler struct {
+	logger     *slog.Logger
+	handler    http.Handler
+	key        string
+	tokens     map[string]bool
+	daily      int64
+	total      int64
+	rejections *prometheus.CounterVec
+
+	// accounts contains the accounts of the clients, indexed by client, and order contains the same accounts
+	// sorted by time of last use, the most recent first.
+	lock     sync.Mutex
+	accounts map[string]*list.Element
+	order    *list.List
+}
+
+// NewQuotaHandler wraps the given handler so that it enforces the given quotas, and registers the metrics with the
+// given registerer. If there are no quotas it returns the given handler unchanged.
+func NewQuotaHandler(logger *slog.Logger, handler http.Handler, config QuotasConfig,
+	registerer prometheus.Registerer) (result http.Handler, err error) {
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	if config.Daily == 0 && config.Total == 0 {
+		result = handler
+		return
+	}
+	rejections := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_quota_rejections_total",
+			Help: "Number of requests rejected because the client exhausted a quota, by quota, 'daily' or 'total'.",
+		},
+		[]string{"quota"},
+	)
+	err = registerer.Register(rejections)
+	if err != nil {
+		return
+	}
+	key := config.Key
+	if key == "" {
+		key = QuotaKeyIP
+	}
+	tokens := map[string]bool{}
+	for _, token := range config.Tokens {
+		tokens[token] = true
+	}
+	result = &QuotaHandler{
+		logger:     logger,
+		handler:    handler,
+		key:        key,
+		tokens:     tokens,
+		daily:      config.Daily,
+		total:      config.Total,
+		rejections: rejections,
+		accounts:   map[string]*list.Element{},
+		order:      list.New(),
+	}
+	return
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *QuotaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client := h.client(r)
+	remaining, exhausted := h.remaining(client)
+	w.Header().Set(quotaRemainingHeader, strconv.FormatInt(remaining, 10))
+	if exhausted != "" {
+		h.rejections.WithLabelValues(exhausted).Inc()
+		h.logger.Info(
+			"Quota exhausted",
+			slog.String("client", client),
+			slog.String("quota", exhausted),
+		)
+		if exhausted == "daily" {
+			now := time.Now().UTC()
+			tomorrow := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+			w.Header().Set("Retry-After", strconv.Itoa(int(tomorrow.Sub(now).Seconds())+1))
+		}
+		http.Error(w, fmt.Sprintf("%s quota of client '%s' is exhausted", exhausted, client), http.StatusTooManyRequests)
+		return
+	}
+	writer := &quotaWriter{
+		ResponseWriter: w,
+		handler:        h,
+		client:         client,
+	}
+	h.handler.ServeHTTP(writer, r)
+
+	// If the response was cut abort it, otherwise the client could take the partial body for the complete one:
+	if writer.exceeded {
+		h.logger.Info(
+			"Quota exhausted during response",
+			slog.String("client", client),
+			slog.String("path", r.URL.Path),
+		)
+		http.NewResponseController(w).Flush()
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// client returns the identifier of the client that sent the request.
+func (h *QuotaHandler) client(r *http.Request) string {
+	if h.key == QuotaKeyToken {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && h.tokens[token] {
+			return "token:" + token
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
+
+// account returns the account of the client, creating it if needed, with the daily counter reset if the day has
+// changed. It must be called with the lock held.
+func (h *QuotaHandler) account(client string) *quotaAccount {
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	h.sweep(day)
+	var account *quotaAccount
+	element := h.accounts[client]
+	if element != nil {
+		account = element.Value.(*quotaAccount)
+		h.order.MoveToFront(element)
+	} else {
+		if h.order.Len() >= maxQuotaAccounts {
+			h.forget(h.order.Back())
+		}
+		account = &quotaAccount{
+			client: client,
+		}
+		h.accounts[client] = h.order.PushFront(account)
+	}
+	if !account.day.Equal(day) {
+		account.day = day
+		account.daily = 0
+	}
+	return account
+}
+
+// sweep forgets the accounts that weren't used during the given day, if there is only a daily quota, as their counters
+// would be reset anyhow. It must be called with the lock held.
+func (h *QuotaHandler) sweep(day time.Time) {
+	if h.total > 0 {
+		return
+	}
+	for {
+		element := h.order.Back()
+		if element == nil || element.Value.(*quotaAccount).day.Equal(day) {
+			return
+		}
+		h.forget(element)
+	}
+}
+
+// forget removes an account. It must be called with the lock held.
+func (h *QuotaHandler) forget(element *list.Element) {
+	account := h.order.Remove(element).(*quotaAccount)
+	delete(h.accounts, account.client)
+}
+
+// remaining returns the number of bytes that the client can still download, and the name of the quota that is
+// exhausted, if any.
+func (h *QuotaHandler) remaining(client string) (result int64, exhausted string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	result, exhausted = h.check(h.account(client))
+	return
+}
+
+// check returns the number of bytes left in the account, and the name of the quota that is exhausted, if any. It must
+// be called with the lock held.
+func (h *QuotaHandler) check(account *quotaAccount) (result int64, exhausted string) {
+	result = -1
+	if h.total > 0 {
+		result = max(h.total-account.total, 0)
+		if result == 0 {
+			exhausted = "total"
+		}
+	}
+	if h.daily > 0 && (result < 0 || h.daily-account.daily < result) {
+		result = max(h.daily-account.daily, 0)
+		if result == 0 {
+			exhausted = "daily"
+		}
+	}
+	return
+}
+
+// consume adds the given number of bytes to the account of the client, up to the remaining quota, and returns the
+// number of bytes that were added.
+func (h *QuotaHandler) consume(client string, bytes int64) int64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	account := h.account(client)
+	remaining, _ := h.check(account)
+	bytes = min(bytes, remaining)
+	account.daily += bytes
+	account.total += bytes
+	return bytes
+}
+
+// quotaWriter is a response writer that counts the bytes of the body in the account of the client, and fails when the
+// quota is exhausted.
+type quotaWriter struct {
+	http.ResponseWriter
+	handler  *QuotaHandler
+	client   string
+	exceeded bool
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *quotaWriter) Write(p []byte) (n int, err error) {
+	allowed := int(w.handler.consume(w.client, int64(len(p))))
+	n, err = w.ResponseWriter.Write(p[:allowed])
+	if err == nil && allowed < len(p) {
+		w.exceeded = true
+		err = errQuotaExceeded
+	}
+	return
+}
+
+// Flush is the implementation of the http.Flusher interface.
+func (w *quotaWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack is the implementation of the http.Hijacker interface, needed by the WebSocket library. Note that the bytes
+// sent through hijacked connections aren't counted.
+func (w *quotaWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped response writer, so that http.ResponseController can use it.
+func (w *quotaWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,163 @@
+package dummy
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestQuotaHandler creates a quota handler in front of a handler that sends 100 bytes.
+func newTestQuotaHandler(t *testing.T, config QuotasConfig) *QuotaHandler {
+	t.Helper()
+	data := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	})
+	handler, err := NewQuotaHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), data, config,
+		prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("failed to create quota handler: %v", err)
+	}
+	return handler.(*QuotaHandler)
+}
+
+// sendQuotaRequest sends a request from the given address with the given token, and returns the status code.
+func sendQuotaRequest(handler http.Handler, address, token string) int {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = address
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func TestQuotasConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config QuotasConfig
+		fail   string
+	}{
+		{
+			name:   "Address",
+			config: QuotasConfig{Daily: 100},
+		},
+		{
+			name:   "Tokens",
+			config: QuotasConfig{Key: QuotaKeyToken, Tokens: []string{"a", "b"}, Total: 100},
+		},
+		{
+			name:   "Token without list",
+			config: QuotasConfig{Key: QuotaKeyToken, Total: 100},
+			fail:   "tokens are mandatory",
+		},
+		{
+			name:   "List without token key",
+			config: QuotasConfig{Tokens: []string{"a"}, Total: 100},
+			fail:   "can only be used",
+		},
+		{
+			name:   "Empty token",
+			config: QuotasConfig{Key: QuotaKeyToken, Tokens: []string{"a", ""}, Total: 100},
+			fail:   "quota token 1 is empty",
+		},
+		{
+			name:   "Unknown key",
+			config: QuotasConfig{Key: "cookie"},
+			fail:   "quota key should be",
+		},
+		{
+			name:   "Negative",
+			config: QuotasConfig{Daily: -1},
+			fail:   "negative",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.validate()
+			if test.fail != "" {
+				if err == nil || !strings.Contains(err.Error(), test.fail) {
+					t.Fatalf("expected an error containing '%s', but got: %v", test.fail, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestQuotaUnknownTokensShareAddressAccount(t *testing.T) {
+	handler := newTestQuotaHandler(t, QuotasConfig{
+		Key:    QuotaKeyToken,
+		Tokens: []string{"known"},
+		Total:  200,
+	})
+
+	// Two requests with fresh tokens consume the quota of the address, so the third is rejected:
+	for i := 0; i < 2; i++ {
+		status := sendQuotaRequest(handler, "192.0.2.1:1234", fmt.Sprintf("fresh-%d", i))
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d for request %d, but got %d", http.StatusOK, i, status)
+		}
+	}
+	status := sendQuotaRequest(handler, "192.0.2.1:1234", "fresh-2")
+	if status != http.StatusTooManyRequests {
+		t.Errorf("expected status %d with a fresh token, but got %d", http.StatusTooManyRequests, status)
+	}
+
+	// The known token has its own account:
+	status = sendQuotaRequest(handler, "192.0.2.1:1234", "known")
+	if status != http.StatusOK {
+		t.Errorf("expected status %d with the known token, but got %d", http.StatusOK, status)
+	}
+}
+
+func TestQuotaAccountsAreBounded(t *testing.T) {
+	handler := newTestQuotaHandler(t, QuotasConfig{
+		Total: 1000,
+	})
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	for i := 0; i < maxQuotaAccounts+10; i++ {
+		handler.account(fmt.Sprintf("client-%d", i))
+	}
+	if len(handler.accounts) != maxQuotaAccounts || handler.order.Len() != maxQuotaAccounts {
+		t.Fatalf("expected %d accounts, but got %d", maxQuotaAccounts, len(handler.accounts))
+	}
+
+	// The least recently used ones should have been forgotten:
+	for i := 0; i < 10; i++ {
+		if handler.accounts[fmt.Sprintf("client-%d", i)] != nil {
+			t.Errorf("expected account of 'client-%d' to be forgotten", i)
+		}
+	}
+	if handler.accounts["client-10"] == nil {
+		t.Errorf("expected account of 'client-10' to be kept")
+	}
+}
+
+func TestQuotaDailyAccountsExpire(t *testing.T) {
+	handler := newTestQuotaHandler(t, QuotasConfig{
+		Daily: 1000,
+	})
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	yesterday := time.Now().UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour)
+	for i := 0; i < 3; i++ {
+		account := handler.account(fmt.Sprintf("old-%d", i))
+		account.day = yesterday
+	}
+	handler.account("new")
+	if len(handler.accounts) != 1 || handler.accounts["new"] == nil {
+		t.Errorf("expected only the account of today, but got %d accounts", len(handler.accounts))
+	}
+}
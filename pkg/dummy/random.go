@@ -0,0 +1,184 @@
+package dummy
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+)
+
+// Names of the supported sources of random data:
+const (
+	randomSourceURandom = "urandom"
+	randomSourceCrypto  = "crypto"
+	randomSourceChaCha8 = "chacha8"
+	randomSourcePool    = "pool"
+	randomSourceMmap    = "mmap"
+)
+
+// Default size of the pre-generated pool of random bytes.
+const defaultRandomPoolSize = 64 * (1 << 20) // 64 MiB
+
+// RandomSource is a source of random data.
+type RandomSource interface {
+	// Open returns a reader that generates random data. The reads always fill the buffer completely. The caller is
+	// responsible for closing the reader.
+	Open() (io.ReadCloser, error)
+}
+
+// RandomSourceNames returns the names of the supported random sources, for use in help text and error messages.
+func RandomSourceNames() string {
+	return strings.Join([]string{
+		randomSourceURandom,
+		randomSourceCrypto,
+		randomSourceChaCha8,
+		randomSourcePool,
+		randomSourceMmap,
+	}, ", ")
+}
+
+// NewRandomSource creates the random source with the given name.
+func NewRandomSource(name string) (result RandomSource, err error) {
+	switch name {
+	case randomSourceURandom:
+		_, err = os.Stat(urandomPath)
+		if err != nil {
+			err = fmt.Errorf(
+				"random source '%s' isn't available in this platform, try '%s' instead: %w",
+				name, randomSourceCrypto, err,
+			)
+			return
+		}
+		result = &urandomSource{}
+	case randomSourceCrypto:
+		result = &cryptoSource{}
+	case randomSourceChaCha8:
+		result = &chaCha8Source{}
+	case randomSourcePool:
+		result, err = newPoolSource(defaultRandomPoolSize)
+	case randomSourceMmap:
+		result, err = NewMmapRandomSource("", 0)
+	default:
+		err = fmt.Errorf("random source '%s' isn't supported, valid values are %s", name, RandomSourceNames())
+	}
+	return
+}
+
+// Path of the random device, only available in Unix like systems.
+const urandomPath = "/dev/urandom"
+
+// urandomSource reads the random data from the /dev/urandom device. Every read is a system call, so this may be a
+// bottleneck for fast network interfaces.
+type urandomSource struct{}
+
+// Open is the implementation of the RandomSource interface.
+func (s *urandomSource) Open() (io.ReadCloser, error) {
+	return os.Open(urandomPath)
+}
+
+// cryptoSource reads the random data from the crypto/rand package, which works in all the platforms supported by Go,
+// including those that don't have the /dev/urandom device, like Windows.
+type cryptoSource struct{}
+
+// Open is the implementation of the RandomSource interface.
+func (s *cryptoSource) Open() (io.ReadCloser, error) {
+	return io.NopCloser(&cryptoReader{}), nil
+}
+
+type cryptoReader struct{}
+
+// Read is the implementation of the io.Reader interface.
+func (r *cryptoReader) Read(p []byte) (n int, err error) {
+	return io.ReadFull(crand.Reader, p)
+}
+
+// chaCha8Source generates the random data in process using the ChaCha8 generator, seeded from the operating system
+// random source once per reader.
+type chaCha8Source struct{}
+
+// Open is the implementation of the RandomSource interface.
+func (s *chaCha8Source) Open() (result io.ReadCloser, err error) {
+	var seed [32]byte
+	_, err = crand.Read(seed[:])
+	if err != nil {
+		return
+	}
+	result = &chaCha8Reader{
+		generator: rand.NewChaCha8(seed),
+	}
+	return
+}
+
+type chaCha8Reader struct {
+	generator *rand.ChaCha8
+}
+
+// Read is the implementation of the io.Reader interface.
+func (r *chaCha8Reader) Read(p []byte) (n int, err error) {
+	n = len(p)
+	for len(p) >= 8 {
+		binary.LittleEndian.PutUint64(p, r.generator.Uint64())
+		p = p[8:]
+	}
+	if len(p) > 0 {
+		var tail [8]byte
+		binary.LittleEndian.PutUint64(tail[:], r.generator.Uint64())
+		copy(p, tail[:])
+	}
+	return
+}
+
+// Close is the implementation of the io.Closer interface.
+func (r *chaCha8Reader) Close() error {
+	return nil
+}
+
+// poolSource serves the random data from a ring buffer that is filled once when the source is created. Each reader
+// starts at a random position of the ring. The data repeats after the size of the ring, which is acceptable for
+// throughput tests but not for anything that requires real randomness.
+type poolSource struct {
+	ring []byte
+}
+
+func newPoolSource(size int) (result *poolSource, err error) {
+	ring := make([]byte, size)
+	_, err = crand.Read(ring)
+	if err != nil {
+		return
+	}
+	result = &poolSource{
+		ring: ring,
+	}
+	return
+}
+
+// Open is the implementation of the RandomSource interface.
+func (s *poolSource) Open() (io.ReadCloser, error) {
+	return &poolReader{
+		ring:   s.ring,
+		offset: rand.IntN(len(s.ring)),
+	}, nil
+}
+
+type poolReader struct {
+	ring   []byte
+	offset int
+}
+
+// Read is the implementation of the io.Reader interface.
+func (r *poolReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		count := copy(p[n:], r.ring[r.offset:])
+		n += count
+		r.offset = (r.offset + count) % len(r.ring)
+	}
+	return
+}
+
+// Close is the implementation of the io.Closer interface.
+func (r *poolReader) Close() error {
+	return nil
+}
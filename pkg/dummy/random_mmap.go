@@ -0,0 +1,127 @@
+package dummy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+)
+
+// Default name and size of the file used by the memory mapped random source.
+const (
+	defaultRandomFileName = "dummy-random.bin"
+	defaultRandomFileSize = 1 << 30 // 1 GiB
+)
+
+// DefaultRandomFile returns the file used by the memory mapped random source when none is explicitly selected. It is
+// in the temporary directory, so that it can be reused by the next runs of the server.
+func DefaultRandomFile() string {
+	return filepath.Join(os.TempDir(), defaultRandomFileName)
+}
+
+// mmapSource serves the random data from a file that is mapped into memory, so that the data is served at page cache
+// speed and repeated benchmarks don't pay for generating it. Each reader starts at a random position of the file, and
+// the data repeats after the size of the file, like with the pool source. The mapping is kept for the life of the
+// process, because readers may still be using it.
+type mmapSource struct {
+	data []byte
+}
+
+// NewMmapRandomSource creates a random source that maps the given file into memory. If the file doesn't exist, or if it
+// is smaller than the given size, it is first filled with that number of random bytes. A zero size means the size of
+// the existing file, or 1 GiB if it doesn't exist. An empty path means the file returned by DefaultRandomFile.
+func NewMmapRandomSource(path string, size int64) (result RandomSource, err error) {
+	if path == "" {
+		path = DefaultRandomFile()
+	}
+	if size < 0 || size > math.MaxInt {
+		err = fmt.Errorf("size %d of random file '%s' should be between 0 and %d", size, path, math.MaxInt)
+		return
+	}
+
+	// Generate the file if it doesn't exist or if it is too small:
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		if size == 0 {
+			size = defaultRandomFileSize
+		}
+		err = generateRandomFile(path, size)
+	case err != nil:
+		err = fmt.Errorf("failed to check random file '%s': %w", path, err)
+	case info.Size() < size:
+		err = generateRandomFile(path, size)
+	case size == 0:
+		size = info.Size()
+	}
+	if err != nil {
+		return
+	}
+	if size == 0 || size > math.MaxInt {
+		err = fmt.Errorf("size %d of random file '%s' should be between 1 and %d", size, path, math.MaxInt)
+		return
+	}
+
+	// Map the file:
+	file, err := os.Open(path)
+	if err != nil {
+		err = fmt.Errorf("failed to open random file '%s': %w", path, err)
+		return
+	}
+	defer file.Close()
+	data, err := mapFile(file, int(size))
+	if err != nil {
+		err = fmt.Errorf("failed to map random file '%s': %w", path, err)
+		return
+	}
+	result = &mmapSource{
+		data: data,
+	}
+	return
+}
+
+// generateRandomFile writes the given number of random bytes to the given file. The data is written to a temporary file
+// that is then renamed, so that an interrupted run doesn't leave a truncated file that would be reused by the next one.
+func generateRandomFile(path string, size int64) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		err = fmt.Errorf("failed to create random file '%s': %w", path, err)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	random, err := (&chaCha8Source{}).Open()
+	if err != nil {
+		return
+	}
+	writer := bufio.NewWriterSize(tmp, DefaultBufferSize)
+	_, err = io.CopyN(writer, random, size)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to write random file '%s': %w", path, err)
+	}
+	return
+}
+
+// Open is the implementation of the RandomSource interface.
+func (s *mmapSource) Open() (io.ReadCloser, error) {
+	return &poolReader{
+		ring:   s.data,
+		offset: rand.IntN(len(s.data)),
+	}, nil
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package dummy
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile loads the first bytes of the given file into memory. Systems that aren't Unix like don't have the mmap system
+// call, so the data is read instead, which needs as much memory as the size of the file.
+func mapFile(file *os.File, size int) (result []byte, err error) {
+	data := make([]byte, size)
+	_, err = io.ReadFull(file, data)
+	if err != nil {
+		return
+	}
+	result = data
+	return
+}
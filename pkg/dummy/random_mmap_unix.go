@@ -0,0 +1,15 @@
+//go:build unix
+
+package dummy
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the first bytes of the given file into memory, read only. The mapping stays valid after the file is
+// closed.
+func mapFile(file *os.File, size int) (result []byte, err error) {
+	result, err = syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	return
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package dummy
+
+// DefaultRandomSource is the random source used when none is explicitly selected. Systems that aren't Unix like,
+// Windows for example, don't have the random device, so we use the pure Go implementation instead.
+const DefaultRandomSource = randomSourceCrypto
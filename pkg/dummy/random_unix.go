@@ -0,0 +1,7 @@
+//go:build unix
+
+package dummy
+
+// DefaultRandomSource is the random source used when none is explicitly selected. Unix like systems have the random
+// device.
+const DefaultRandomSource = randomSourceURandom
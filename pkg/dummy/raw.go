@@ -0,0 +1,665 @@
+package dummy
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Modes of the raw listeners:
+const (
+	RawModeSend = "send"
+	RawModeSink = "sink"
+)
+
+// Backends of the write loop of the raw TCP listeners in send mode:
+const (
+	RawBackendStandard = "standard"
+	RawBackendIOUring  = "io_uring"
+)
+
+// Number of buffers submitted together by the io_uring backend.
+const rawIOUringDepth = 8
+
+// Defaults for the raw UDP listeners:
+const (
+	DefaultDatagramSize = 1400
+	DefaultUDPDuration  = 10 * time.Second
+	DefaultUDPRate      = 125000000 // 1 Gb/s
+)
+
+// Limits of the raw UDP listeners. The cookie is the eight bytes of the time when it was issued followed by the first
+// sixteen bytes of its signature.
+const (
+	maxRawUDPBursts  = 16
+	maxRawUDPPeers   = 10000
+	rawUDPPeerIdle   = time.Minute
+	rawUDPCookieSize = 24
+	rawUDPCookieTTL  = 10 * time.Second
+)
+
+// RawTCPServer accepts TCP connections and, depending on the mode, either sends random data till the client closes the
+// connection, or reads and discards everything that the client sends. There is no framing at all, so this can be used
+// to measure the raw throughput of the network, and compare it with the throughput of the HTTP endpoints.
+//
+// In send mode the data can be written with the standard write loop, or with the experimental io_uring backend, which
+// submits several buffers with a single system call. The metrics count the bytes sent and the system calls used by each
+// backend, so that they can be compared in fast links. For the standard backend each write to the connection is counted
+// as one system call, so the count is a lower bound.
+type RawTCPServer struct {
+	logger   *slog.Logger
+	mode     string
+	backend  string
+	random   RandomSource
+	buffers  *BufferPool
+	sent     *prometheus.CounterVec
+	syscalls *prometheus.CounterVec
+	pinner   *cpuPinner
+}
+
+// Serve accepts connections till the listener is closed.
+func (s *RawTCPServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *RawTCPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	defer s.pinner.pin()()
+	buffer := s.buffers.Get(DefaultBufferSize)
+	defer s.buffers.Put(buffer)
+	startTime := time.Now()
+	var bytes, syscalls int64
+	var err error
+	switch s.mode {
+	case RawModeSend:
+		var reader io.ReadCloser
+		reader, err = s.random.Open()
+		if err != nil {
+			s.logger.Error(
+				"Failed to open data",
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		defer reader.Close()
+		bytes, syscalls, err = s.send(conn, reader, *buffer)
+		s.sent.WithLabelValues(s.backend).Add(float64(bytes))
+		s.syscalls.WithLabelValues(s.backend).Add(float64(syscalls))
+	case RawModeSink:
+		bytes, err = io.CopyBuffer(io.Discard, conn, *buffer)
+	}
+
+	// Write a summary to the log. Errors are expected in send mode, because the only way for the client to stop
+	// the transfer is to close the connection.
+	elapsed := time.Since(startTime)
+	attrs := []any{
+		slog.String("mode", s.mode),
+		slog.String("remote", conn.RemoteAddr().String()),
+		slog.Int64("bytes", bytes),
+		slog.String("elapsed", elapsed.String()),
+		slog.Float64("throughput", float64(bytes)/elapsed.Seconds()),
+	}
+	if s.mode == RawModeSend {
+		attrs = append(attrs, slog.String("backend", s.backend), slog.Int64("syscalls", syscalls))
+		if bytes > 0 {
+			attrs = append(attrs, slog.Float64("syscalls_per_gib", float64(syscalls)/float64(bytes)*(1<<30)))
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	s.logger.Info("TCP transfer finished", attrs...)
+}
+
+// send sends random data to the connection till it fails, using the configured backend. It returns the number of bytes
+// sent and the number of system calls used.
+func (s *RawTCPServer) send(conn net.Conn, reader io.Reader, buffer []byte) (bytes, syscalls int64, err error) {
+	if s.backend == RawBackendIOUring {
+		buffers := make([][]byte, rawIOUringDepth)
+		for i := range buffers {
+			pooled := s.buffers.Get(DefaultBufferSize)
+			defer s.buffers.Put(pooled)
+			buffers[i] = *pooled
+		}
+		bytes, syscalls, err = sendIOUring(conn, reader, buffers)
+		return
+	}
+	writer := &rawWriteCounter{
+		writer: conn,
+	}
+	bytes, err = io.CopyBuffer(writer, reader, buffer)
+	syscalls = writer.calls
+	return
+}
+
+// rawWriteCounter is a writer that counts the calls to the Write method of the wrapped writer.
+type rawWriteCounter struct {
+	writer io.Writer
+	calls  int64
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *rawWriteCounter) Write(p []byte) (n int, err error) {
+	w.calls++
+	return w.writer.Write(p)
+}
+
+// RawUDPServer receives UDP datagrams. In sink mode it counts the datagrams received from each client, and when it
+// receives an empty datagram it replies with a JSON report of the counts and forgets the client. Clients that stay idle
+// for more than a minute are also forgotten, and no more than ten thousand are tracked at the same time.
+//
+// In send mode the server sends bursts of datagrams to the clients, limited in rate and duration. Because the source
+// address of UDP datagrams can be forged, a burst is only sent to an address that has proved that it receives the
+// datagrams sent to it: the client sends a datagram of at least 24 bytes, the server replies with a 24 bytes cookie
+// signed with a secret and with the address of the client, and the client sends the cookie back within ten seconds to
+// start the burst. The reply is never larger than the request, so the listener can't be used to amplify traffic. The
+// first eight bytes of each datagram of the burst contain a big endian sequence number, so that the client can detect
+// losses and reordering. No more than sixteen bursts are sent at the same time.
+type RawUDPServer struct {
+	logger   *slog.Logger
+	mode     string
+	random   RandomSource
+	size     int
+	duration time.Duration
+	rate     int64
+	secret   []byte
+	lock     sync.Mutex
+	peers    map[string]*rawUDPPeer
+	swept    time.Time
+
+	// control is the connection used to send the cookies and the reports, so that they aren't impaired. When it
+	// is nil the connection passed to the Serve method is used.
+	control net.PacketConn
+}
+
+type rawUDPPeer struct {
+	start     time.Time
+	last      time.Time
+	datagrams int64
+	bytes     int64
+}
+
+// RawUDPReport is the report sent by the sink when the client sends an empty datagram.
+type RawUDPReport struct {
+	Datagrams int64   `json:"datagrams"`
+	Bytes     int64   `json:"bytes"`
+	Elapsed   string  `json:"elapsed"`
+	Rate      float64 `json:"throughput"`
+}
+
+// Serve receives datagrams till the connection is closed.
+func (s *RawUDPServer) Serve(conn net.PacketConn) error {
+	buffer := make([]byte, 1<<16)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+		switch s.mode {
+		case RawModeSend:
+			s.request(conn, addr, buffer[:n])
+		case RawModeSink:
+			s.receive(conn, addr, n)
+		}
+	}
+}
+
+// controlConn returns the connection used to send the cookies and the reports.
+func (s *RawUDPServer) controlConn(conn net.PacketConn) net.PacketConn {
+	if s.control != nil {
+		return s.control
+	}
+	return conn
+}
+
+// request processes a datagram received by the send mode: a valid cookie starts the burst, and other datagrams that
+// are large enough are answered with a new cookie.
+func (s *RawUDPServer) request(conn net.PacketConn, addr net.Addr, data []byte) {
+	if len(data) < rawUDPCookieSize {
+		return
+	}
+	now := time.Now()
+	if len(data) == rawUDPCookieSize && s.checkCookie(addr, data, now) {
+		s.startBurst(conn, addr)
+		return
+	}
+	_, err := s.controlConn(conn).WriteTo(s.makeCookie(addr, now), addr)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		s.logger.Error(
+			"Failed to send UDP cookie",
+			slog.String("remote", addr.String()),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// makeCookie returns a cookie for the given address, issued at the given time.
+func (s *RawUDPServer) makeCookie(addr net.Addr, now time.Time) []byte {
+	cookie := make([]byte, rawUDPCookieSize)
+	binary.BigEndian.PutUint64(cookie, uint64(now.Unix()))
+	copy(cookie[8:], s.signCookie(addr, cookie[:8]))
+	return cookie
+}
+
+// checkCookie checks that the cookie was issued by this server for the given address, and that it hasn't expired.
+func (s *RawUDPServer) checkCookie(addr net.Addr, cookie []byte, now time.Time) bool {
+	issued := time.Unix(int64(binary.BigEndian.Uint64(cookie)), 0)
+	age := now.Sub(issued)
+	if age < -time.Second || age > rawUDPCookieTTL {
+		return false
+	}
+	return hmac.Equal(cookie[8:], s.signCookie(addr, cookie[:8]))
+}
+
+// signCookie returns the signature of the given time of a cookie for the given address.
+func (s *RawUDPServer) signCookie(addr net.Addr, issued []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(issued)
+	mac.Write([]byte(addr.String()))
+	return mac.Sum(nil)[:rawUDPCookieSize-8]
+}
+
+// sweep forgets the clients that have been idle for too long. It should be called with the lock held.
+func (s *RawUDPServer) sweep(now time.Time) {
+	if now.Sub(s.swept) < rawUDPPeerIdle/2 {
+		return
+	}
+	s.swept = now
+	for key, peer := range s.peers {
+		if now.Sub(peer.last) > rawUDPPeerIdle {
+			delete(s.peers, key)
+		}
+	}
+}
+
+func (s *RawUDPServer) receive(conn net.PacketConn, addr net.Addr, n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.peers == nil {
+		s.peers = map[string]*rawUDPPeer{}
+	}
+	key := addr.String()
+	now := time.Now()
+	s.sweep(now)
+	peer := s.peers[key]
+	if n > 0 {
+		if peer == nil {
+			if len(s.peers) >= maxRawUDPPeers {
+				return
+			}
+			peer = &rawUDPPeer{
+				start: now,
+			}
+			s.peers[key] = peer
+		}
+		peer.last = now
+		peer.datagrams++
+		peer.bytes += int64(n)
+		return
+	}
+
+	// An empty datagram is the end of the transfer, so send the report to the client. Unknown clients are ignored,
+	// and so are clients that sent less data than the size of the report, so that the listener can't be used to
+	// amplify traffic sent with a forged source address.
+	if peer == nil {
+		return
+	}
+	delete(s.peers, key)
+	elapsed := peer.last.Sub(peer.start)
+	report := &RawUDPReport{
+		Datagrams: peer.datagrams,
+		Bytes:     peer.bytes,
+		Elapsed:   elapsed.String(),
+	}
+	if elapsed > 0 {
+		report.Rate = float64(peer.bytes) / elapsed.Seconds()
+	}
+	data, err := json.Marshal(report)
+	if err == nil && int64(len(data)) <= peer.bytes {
+		_, err = s.controlConn(conn).WriteTo(data, addr)
+	}
+	if err != nil {
+		s.logger.Error(
+			"Failed to send UDP report",
+			slog.String("remote", key),
+			slog.String("error", err.Error()),
+		)
+	}
+	s.logger.Info(
+		"UDP transfer finished",
+		slog.String("mode", s.mode),
+		slog.String("remote", key),
+		slog.Int64("datagrams", report.Datagrams),
+		slog.Int64("bytes", report.Bytes),
+		slog.String("elapsed", report.Elapsed),
+		slog.Float64("throughput", report.Rate),
+	)
+}
+
+func (s *RawUDPServer) startBurst(conn net.PacketConn, addr net.Addr) {
+	// Ignore the request if there is already a burst in progress for this client:
+	key := addr.String()
+	s.lock.Lock()
+	if s.peers == nil {
+		s.peers = map[string]*rawUDPPeer{}
+	}
+	if s.peers[key] != nil || len(s.peers) >= maxRawUDPBursts {
+		s.lock.Unlock()
+		return
+	}
+	peer := &rawUDPPeer{
+		start: time.Now(),
+	}
+	s.peers[key] = peer
+	s.lock.Unlock()
+	go s.burst(conn, addr, peer)
+}
+
+func (s *RawUDPServer) burst(conn net.PacketConn, addr net.Addr, peer *rawUDPPeer) {
+	defer func() {
+		s.lock.Lock()
+		delete(s.peers, addr.String())
+		s.lock.Unlock()
+	}()
+	reader, err := s.random.Open()
+	if err != nil {
+		s.logger.Error(
+			"Failed to open data",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	defer reader.Close()
+	datagram := make([]byte, max(s.size, 8))
+	deadline := peer.start.Add(s.duration)
+	for {
+		// Wait till the rate allows sending the next datagram:
+		now := time.Now()
+		if !now.Before(deadline) {
+			break
+		}
+		if s.rate > 0 {
+			due := peer.start.Add(time.Duration(float64(peer.datagrams*int64(len(datagram))) / float64(s.rate) *
+				float64(time.Second)))
+			if due.After(now) {
+				time.Sleep(due.Sub(now))
+			}
+		}
+		_, err = reader.Read(datagram[8:])
+		if err != nil {
+			break
+		}
+		binary.BigEndian.PutUint64(datagram, uint64(peer.datagrams))
+		_, err = conn.WriteTo(datagram, addr)
+		if errors.Is(err, net.ErrClosed) {
+			break
+		}
+
+		// Other errors, like full buffers, are counted as lost datagrams, that is why the sequence number is
+		// incremented anyhow:
+		peer.datagrams++
+		if err == nil {
+			peer.bytes += int64(len(datagram))
+		}
+	}
+	elapsed := time.Since(peer.start)
+	s.logger.Info(
+		"UDP transfer finished",
+		slog.String("mode", s.mode),
+		slog.String("remote", addr.String()),
+		slog.Int64("datagrams", peer.datagrams),
+		slog.Int64("bytes", peer.bytes),
+		slog.String("elapsed", elapsed.String()),
+		slog.Float64("throughput", float64(peer.bytes)/elapsed.Seconds()),
+	)
+}
+
+// RawListener describes one of the raw listeners requested with the command line flags.
+type RawListener struct {
+	Network string
+	Mode    string
+	Address string
+
+	// Backend is the implementation of the write loop of TCP listeners in send mode, 'standard' (the default) or
+	// 'io_uring'. The io_uring backend is experimental and only available in Linux.
+	Backend string
+}
+
+// rawListeners are the raw TCP and UDP listeners of a server. They are prepared when the server is created, so that
+// configuration errors are detected early, but the sockets are only opened when the server starts to listen.
+type rawListeners struct {
+	logger     *slog.Logger
+	random     RandomSource
+	buffers    *BufferPool
+	listeners  []RawListener
+	size       int
+	duration   time.Duration
+	rate       int64
+	impairment UDPImpairment
+	pinner     *cpuPinner
+	sent       *prometheus.CounterVec
+	syscalls   *prometheus.CounterVec
+	impaired   *prometheus.CounterVec
+
+	// open contains the listeners and connections that have been opened, so that they can be closed.
+	lock sync.Mutex
+	open []io.Closer
+}
+
+// newRawListeners checks the given raw listeners, skipping those that have an empty address, and registers the metrics
+// of the TCP and UDP listeners with the given registerer. The connections of the TCP listeners are pinned with the
+// given pinner, if it isn't nil. The bursts of the UDP send listeners are limited to the given rate, in bytes per
+// second. The datagrams sent by the UDP send listeners and received by the UDP sink listeners are impaired with the
+// given impairment.
+func newRawListeners(logger *slog.Logger, random RandomSource, buffers *BufferPool, listeners []RawListener,
+	datagramSize int, udpDuration time.Duration, udpRate int64, impairment UDPImpairment,
+	registerer prometheus.Registerer, pinner *cpuPinner) (result *rawListeners, err error) {
+	err = impairment.Validate()
+	if err != nil {
+		err = fmt.Errorf("UDP impairment isn't valid: %w", err)
+		return
+	}
+	var enabled []RawListener
+	for _, listener := range listeners {
+		if listener.Address == "" {
+			continue
+		}
+		switch listener.Backend {
+		case "":
+			listener.Backend = RawBackendStandard
+		case RawBackendStandard:
+		case RawBackendIOUring:
+			err = checkIOUring()
+			if err != nil {
+				return
+			}
+		default:
+			err = fmt.Errorf(
+				"backend '%s' isn't supported, valid values are '%s' and '%s'",
+				listener.Backend, RawBackendStandard, RawBackendIOUring,
+			)
+			return
+		}
+		enabled = append(enabled, listener)
+	}
+	sent := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_raw_tcp_sent_bytes_total",
+			Help: "Number of bytes sent by the raw TCP listeners, by write backend.",
+		},
+		[]string{"backend"},
+	)
+	syscalls := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_raw_tcp_write_syscalls_total",
+			Help: "Number of system calls used to send data by the raw TCP listeners, by write backend.",
+		},
+		[]string{"backend"},
+	)
+	impaired := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_raw_udp_impaired_datagrams_total",
+			Help: "Number of datagrams dropped, reordered or duplicated by the impairment of the raw UDP listeners.",
+		},
+		[]string{"direction", "action"},
+	)
+	for _, collector := range []prometheus.Collector{sent, syscalls, impaired} {
+		err = registerer.Register(collector)
+		if err != nil {
+			return
+		}
+	}
+	result = &rawListeners{
+		logger:     logger,
+		random:     random,
+		buffers:    buffers,
+		listeners:  enabled,
+		size:       datagramSize,
+		duration:   udpDuration,
+		rate:       udpRate,
+		impairment: impairment,
+		pinner:     pinner,
+		sent:       sent,
+		syscalls:   syscalls,
+		impaired:   impaired,
+	}
+	return
+}
+
+// protocols returns the names of the protocols of the listeners.
+func (r *rawListeners) protocols() []string {
+	result := make([]string, len(r.listeners))
+	for i, listener := range r.listeners {
+		result[i] = listener.Network + "-" + listener.Mode
+	}
+	return result
+}
+
+// start opens the listeners and starts serving them. If one of them fails to open the ones already opened are closed.
+func (r *rawListeners) start() (err error) {
+	defer func() {
+		if err != nil {
+			r.close()
+		}
+	}()
+	for _, listener := range r.listeners {
+		var address net.Addr
+		switch listener.Network {
+		case "tcp":
+			address, err = r.startTCP(listener)
+		case "udp":
+			address, err = r.startUDP(listener)
+		}
+		if err != nil {
+			err = fmt.Errorf(
+				"failed to listen with raw %s %s listener in address '%s': %w",
+				listener.Network, listener.Mode, listener.Address, err,
+			)
+			return
+		}
+		r.logger.Info(
+			"Started raw listener",
+			slog.String("network", listener.Network),
+			slog.String("mode", listener.Mode),
+			slog.String("address", address.String()),
+		)
+	}
+	return
+}
+
+func (r *rawListeners) startTCP(listener RawListener) (address net.Addr, err error) {
+	tcpListener, err := net.Listen("tcp", listener.Address)
+	if err != nil {
+		return
+	}
+	r.add(tcpListener)
+	server := r.newTCPServer(listener.Mode, listener.Backend)
+	go server.Serve(tcpListener)
+	address = tcpListener.Addr()
+	return
+}
+
+// newTCPServer creates a raw TCP server with the given mode and backend, sharing the metrics of the listeners. It is
+// also used for the connections of multiplexed listeners that aren't TLS or HTTP.
+func (r *rawListeners) newTCPServer(mode, backend string) *RawTCPServer {
+	return &RawTCPServer{
+		logger:   r.logger,
+		mode:     mode,
+		backend:  backend,
+		random:   r.random,
+		buffers:  r.buffers,
+		sent:     r.sent,
+		syscalls: r.syscalls,
+		pinner:   r.pinner,
+	}
+}
+
+func (r *rawListeners) startUDP(listener RawListener) (address net.Addr, err error) {
+	secret := make([]byte, 32)
+	_, err = crand.Read(secret)
+	if err != nil {
+		err = fmt.Errorf("failed to generate cookie secret: %w", err)
+		return
+	}
+	udpConn, err := net.ListenPacket("udp", listener.Address)
+	if err != nil {
+		return
+	}
+	server := &RawUDPServer{
+		logger:   r.logger,
+		mode:     listener.Mode,
+		random:   r.random,
+		size:     r.size,
+		duration: r.duration,
+		rate:     r.rate,
+		secret:   secret,
+	}
+	if r.impairment.Enabled() {
+		// Only the datagrams that carry the data are impaired:
+		direction := impairmentOutbound
+		if listener.Mode == RawModeSink {
+			direction = impairmentInbound
+		}
+		server.control = udpConn
+		udpConn = newImpairedPacketConn(udpConn, r.impairment, direction, r.impaired)
+	}
+	r.add(udpConn)
+	go server.Serve(udpConn)
+	address = udpConn.LocalAddr()
+	return
+}
+
+func (r *rawListeners) add(closer io.Closer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.open = append(r.open, closer)
+}
+
+// close closes the listeners and connections that have been opened, so that no more connections and datagrams are
+// accepted and the bursts in progress stop. It can be called multiple times.
+func (r *rawListeners) close() {
+	r.lock.Lock()
+	open := r.open
+	r.open = nil
+	r.lock.Unlock()
+	for _, closer := range open {
+		closer.Close()
+	}
+}
@@ -0,0 +1,375 @@
+package dummy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Methods used to check the reachability:
+const (
+	ReachMethodICMP = "icmp"
+	ReachMethodTCP  = "tcp"
+)
+
+// Defaults of the reachability checks:
+const (
+	DefaultReachTimeout  = 2 * time.Second
+	DefaultReachInterval = 200 * time.Millisecond
+	DefaultMaxHops       = 30
+)
+
+// Protocol numbers of ICMP for IPv4 and IPv6, needed to parse the messages.
+const (
+	icmpProtocolIPv4 = 1
+	icmpProtocolIPv6 = 58
+)
+
+// ReachReport contains the results of the reachability checks made by the client before the transfers.
+type ReachReport struct {
+	Ping       *ReachPingResult `json:"ping,omitempty"`
+	Traceroute []TracerouteHop  `json:"traceroute,omitempty"`
+	MTU        *MTUResult       `json:"mtu,omitempty"`
+}
+
+// ReachPingResult is the result of a series of pings sent by the client. The method is 'icmp' when the client has
+// permission to send ICMP echo requests, and 'tcp' otherwise, in which case the round trip time is the time to
+// establish a TCP connection.
+type ReachPingResult struct {
+	Method   string   `json:"method"`
+	Address  string   `json:"address"`
+	Sent     int      `json:"sent"`
+	Received int      `json:"received"`
+	Loss     float64  `json:"loss"`
+	Min      Duration `json:"min,omitempty"`
+	Avg      Duration `json:"avg,omitempty"`
+	Max      Duration `json:"max,omitempty"`
+}
+
+// TracerouteHop is one of the hops of the path to the server. When the hop didn't answer the address is empty.
+type TracerouteHop struct {
+	TTL     int      `json:"ttl"`
+	Address string   `json:"address,omitempty"`
+	RTT     Duration `json:"rtt,omitempty"`
+}
+
+// ReachOptions contains the settings of the reachability checks.
+type ReachOptions struct {
+	// Timeout is the maximum time to wait for each answer. The default is two seconds.
+	Timeout time.Duration
+
+	// Interval is the time between pings. The default is 200 milliseconds.
+	Interval time.Duration
+
+	// MaxHops is the maximum number of hops explored by the traceroute. The default is 30.
+	MaxHops int
+}
+
+// reachTarget resolves the host of the given URL, and returns its address and the port used for the TCP checks.
+func reachTarget(ctx context.Context, target string) (ip net.IP, port string, err error) {
+	address, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	port = address.Port()
+	if port == "" {
+		port = "80"
+		if address.Scheme == "https" {
+			port = "443"
+		}
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", address.Hostname())
+	if err != nil {
+		return
+	}
+	if len(ips) == 0 {
+		err = fmt.Errorf("host '%s' has no addresses", address.Hostname())
+		return
+	}
+	ip = ips[0]
+	return
+}
+
+// ReachPing sends the given number of pings to the host of the target URL. It uses ICMP echo requests when the process
+// has permission to send them, either with raw sockets or with the unprivileged ICMP sockets of Linux, and otherwise
+// it measures the time to establish TCP connections to the port of the URL.
+func ReachPing(ctx context.Context, target string, count int, options ReachOptions) (result *ReachPingResult,
+	err error) {
+	options = options.withDefaults()
+	ip, port, err := reachTarget(ctx, target)
+	if err != nil {
+		return
+	}
+	result = &ReachPingResult{
+		Address: ip.String(),
+	}
+	var rtts []time.Duration
+	conn, privileged, err := listenICMP(ip)
+	if err == nil {
+		defer conn.Close()
+		result.Method = ReachMethodICMP
+		rtts, result.Sent, err = pingICMP(ctx, conn, privileged, ip, count, options)
+	} else {
+		result.Method = ReachMethodTCP
+		rtts, result.Sent, err = pingTCP(ctx, net.JoinHostPort(ip.String(), port), count, options)
+	}
+	if err != nil {
+		result = nil
+		return
+	}
+	result.Received = len(rtts)
+	if result.Sent > 0 {
+		result.Loss = float64(result.Sent-result.Received) / float64(result.Sent)
+	}
+	var total time.Duration
+	for i, rtt := range rtts {
+		if i == 0 || rtt < time.Duration(result.Min) {
+			result.Min = Duration(rtt)
+		}
+		if rtt > time.Duration(result.Max) {
+			result.Max = Duration(rtt)
+		}
+		total += rtt
+	}
+	if len(rtts) > 0 {
+		result.Avg = Duration(total / time.Duration(len(rtts)))
+	}
+	return
+}
+
+// Traceroute finds the hops of the path to the host of the target URL, sending ICMP echo requests with increasing
+// TTL. It needs permission to open raw ICMP sockets, usually root or the CAP_NET_RAW capability, because the
+// unprivileged ICMP sockets don't receive the time exceeded messages sent by the routers.
+func Traceroute(ctx context.Context, target string, options ReachOptions) (result []TracerouteHop, err error) {
+	options = options.withDefaults()
+	ip, _, err := reachTarget(ctx, target)
+	if err != nil {
+		return
+	}
+	conn, privileged, err := listenICMP(ip)
+	if err != nil || !privileged {
+		if conn != nil {
+			conn.Close()
+		}
+		err = errors.New("traceroute needs permission to open raw ICMP sockets")
+		return
+	}
+	defer conn.Close()
+	id := os.Getpid() & 0xffff
+	for ttl := 1; ttl <= options.MaxHops; ttl++ {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+		if ip.To4() != nil {
+			err = conn.IPv4PacketConn().SetTTL(ttl)
+		} else {
+			err = conn.IPv6PacketConn().SetHopLimit(ttl)
+		}
+		if err != nil {
+			return
+		}
+		hop := TracerouteHop{
+			TTL: ttl,
+		}
+		var peer net.Addr
+		var reached bool
+		peer, hop.RTT, reached, err = exchangeICMP(conn, true, ip, id, ttl, options.Timeout)
+		if err != nil {
+			return
+		}
+		if peer != nil {
+			hop.Address = peer.String()
+		}
+		result = append(result, hop)
+		if reached {
+			return
+		}
+	}
+	return
+}
+
+// withDefaults returns a copy of the options with the defaults applied.
+func (o ReachOptions) withDefaults() ReachOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultReachTimeout
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultReachInterval
+	}
+	if o.MaxHops <= 0 {
+		o.MaxHops = DefaultMaxHops
+	}
+	return o
+}
+
+// listenICMP opens an ICMP socket for the family of the given address. It tries first a raw socket, and then an
+// unprivileged one. The second result is true for raw sockets.
+func listenICMP(ip net.IP) (conn *icmp.PacketConn, privileged bool, err error) {
+	raw, datagram := "ip4:icmp", "udp4"
+	listen := "0.0.0.0"
+	if ip.To4() == nil {
+		raw, datagram = "ip6:ipv6-icmp", "udp6"
+		listen = "::"
+	}
+	conn, err = icmp.ListenPacket(raw, listen)
+	if err == nil {
+		privileged = true
+		return
+	}
+	conn, err = icmp.ListenPacket(datagram, listen)
+	return
+}
+
+// pingICMP sends ICMP echo requests and returns the round trip times of the answers received.
+func pingICMP(ctx context.Context, conn *icmp.PacketConn, privileged bool, ip net.IP, count int,
+	options ReachOptions) (rtts []time.Duration, sent int, err error) {
+	id := os.Getpid() & 0xffff
+	for seq := 1; seq <= count; seq++ {
+		if seq > 1 {
+			select {
+			case <-time.After(options.Interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+		sent++
+		var rtt Duration
+		var reached bool
+		_, rtt, reached, err = exchangeICMP(conn, privileged, ip, id, seq, options.Timeout)
+		if err != nil {
+			return
+		}
+		if reached {
+			rtts = append(rtts, time.Duration(rtt))
+		}
+	}
+	return
+}
+
+// exchangeICMP sends an echo request and waits for the answer, which can be the echo reply, in which case reached is
+// true, or a time exceeded message sent by a router. When there is no answer before the timeout the peer is nil.
+func exchangeICMP(conn *icmp.PacketConn, privileged bool, ip net.IP, id, seq int,
+	timeout time.Duration) (peer net.Addr, rtt Duration, reached bool, err error) {
+	var echoType icmp.Type = ipv4.ICMPTypeEcho
+	protocol := icmpProtocolIPv4
+	if ip.To4() == nil {
+		echoType = ipv6.ICMPTypeEchoRequest
+		protocol = icmpProtocolIPv6
+	}
+	message := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{
+			ID:   id,
+			Seq:  seq,
+			Data: []byte("dummy"),
+		},
+	}
+	data, err := message.Marshal(nil)
+	if err != nil {
+		return
+	}
+	var destination net.Addr = &net.IPAddr{IP: ip}
+	if !privileged {
+		destination = &net.UDPAddr{IP: ip}
+	}
+	start := time.Now()
+	_, err = conn.WriteTo(data, destination)
+	if err != nil {
+		return
+	}
+	err = conn.SetReadDeadline(start.Add(timeout))
+	if err != nil {
+		return
+	}
+	buffer := make([]byte, 1500)
+	for {
+		var n int
+		var from net.Addr
+		n, from, err = conn.ReadFrom(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = nil
+			}
+			return
+		}
+		elapsed := time.Since(start)
+		var answer *icmp.Message
+		answer, err = icmp.ParseMessage(protocol, buffer[:n])
+		if err != nil {
+			err = nil
+			continue
+		}
+		switch body := answer.Body.(type) {
+		case *icmp.Echo:
+			// The unprivileged sockets replace the identifier, so only the sequence number is checked:
+			if answer.Type != ipv4.ICMPTypeEchoReply && answer.Type != ipv6.ICMPTypeEchoReply {
+				continue
+			}
+			if body.Seq != seq || (privileged && body.ID != id) {
+				continue
+			}
+			peer, rtt, reached = from, Duration(elapsed), true
+			return
+		case *icmp.TimeExceeded:
+			if !matchEcho(body.Data, ip.To4() != nil, id, seq) {
+				continue
+			}
+			peer, rtt = from, Duration(elapsed)
+			return
+		}
+	}
+}
+
+// matchEcho checks if the original datagram included in an ICMP error message is the echo request with the given
+// identifier and sequence number.
+func matchEcho(data []byte, v4 bool, id, seq int) bool {
+	offset := 40
+	if v4 {
+		if len(data) < 1 {
+			return false
+		}
+		offset = int(data[0]&0x0f) * 4
+	}
+	if len(data) < offset+8 {
+		return false
+	}
+	header := data[offset:]
+	return int(binary.BigEndian.Uint16(header[4:6])) == id && int(binary.BigEndian.Uint16(header[6:8])) == seq
+}
+
+// pingTCP establishes TCP connections to the given address and returns the times to establish them.
+func pingTCP(ctx context.Context, address string, count int, options ReachOptions) (rtts []time.Duration, sent int,
+	err error) {
+	dialer := &net.Dialer{
+		Timeout: options.Timeout,
+	}
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(options.Interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+		sent++
+		start := time.Now()
+		conn, dialErr := dialer.DialContext(ctx, "tcp", address)
+		if dialErr != nil {
+			continue
+		}
+		rtts = append(rtts, time.Since(start))
+		conn.Close()
+	}
+	return
+}
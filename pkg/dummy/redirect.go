@@ -0,0 +1,116 @@
+package dummy
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Maximum length of a chain of redirects.
+const maxRedirects = 100
+
+// Status codes that can be used for redirects.
+var redirectCodes = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// Query parameters used by the redirect endpoint, that aren't passed to the final target.
+var redirectParams = []string{"code", "absolute", "scheme", "loop"}
+
+// RedirectHandler is an HTTP handler that sends a chain of redirects, so that the handling of redirects by clients can
+// be tested. The number in the path is the number of redirects till the final target, which is the data endpoint. The
+// rest of the query parameters are passed to the data endpoint. The chain is controlled with these query parameters:
+//
+//   - 'code' is the status code of the redirects, 301, 302, 307 or 308. It can be a comma separated list, and then
+//     the codes are used in turns. The default is 302.
+//   - 'absolute' set to 'true' uses absolute URLs in the 'Location' header. The default is to use relative URLs.
+//   - 'scheme' set to 'http' or 'https' uses absolute URLs with that scheme, so that cross scheme redirects can be
+//     tested. Note that plain text HTTP/1 only works if the listener is multiplexed or doesn't use TLS.
+//   - 'loop' set to 'true' makes each redirect point to itself, so that loop detection can be tested.
+type RedirectHandler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *RedirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+
+	// Get the parameters:
+	text := r.PathValue("n")
+	n, err := strconv.Atoi(text)
+	if err != nil || n < 1 || n > maxRedirects {
+		http.Error(w, fmt.Sprintf("number of redirects '%s' should be between 1 and %d", text, maxRedirects),
+			http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	codes := []int{http.StatusFound}
+	text = query.Get("code")
+	if text != "" {
+		codes = nil
+		for _, item := range strings.Split(text, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil || !slices.Contains(redirectCodes, code) {
+				http.Error(w, fmt.Sprintf("redirect code '%s' should be 301, 302, 307 or 308", item),
+					http.StatusBadRequest)
+				return
+			}
+			codes = append(codes, code)
+		}
+	}
+	scheme := query.Get("scheme")
+	switch scheme {
+	case "":
+		if query.Get("absolute") == "true" {
+			scheme = "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+		}
+	case "http", "https":
+	default:
+		http.Error(w, fmt.Sprintf("scheme should be 'http' or 'https', but it is '%s'", scheme),
+			http.StatusBadRequest)
+		return
+	}
+	loop := query.Get("loop") == "true"
+
+	// Calculate the next location. The last redirect goes to the data endpoint, without the parameters of the
+	// redirects.
+	location := &url.URL{}
+	switch {
+	case loop:
+		location.Path = r.URL.Path
+		location.RawQuery = r.URL.RawQuery
+	case n > 1:
+		location.Path = fmt.Sprintf("/redirect/%d", n-1)
+		location.RawQuery = r.URL.RawQuery
+	default:
+		for _, param := range redirectParams {
+			query.Del(param)
+		}
+		location.Path = "/"
+		location.RawQuery = query.Encode()
+	}
+	if scheme != "" {
+		location.Scheme = scheme
+		location.Host = r.Host
+	}
+	code := codes[(n-1)%len(codes)]
+	h.logger.Info(
+		"Sending redirect",
+		slog.Int("remaining", n),
+		slog.Int("code", code),
+		slog.String("location", location.String()),
+	)
+	w.Header().Set("Location", location.String())
+	w.WriteHeader(code)
+}
@@ -0,0 +1,466 @@
+package dummy
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix of the paths of the OCI distribution API.
+const registryPrefix = "/v2/"
+
+// Media types of the OCI images:
+const (
+	ociManifestType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigType   = "application/vnd.oci.image.config.v1+json"
+	ociLayerType    = "application/vnd.oci.image.layer.v1.tar"
+)
+
+// Limits of the synthetic images:
+const (
+	maxRegistryLayers          = 100
+	maxRegistryLayerSize int64 = 16 << 30 // 16 GiB
+)
+
+// registryImageRE is the regular expression that matches the last component of the name of a repository, which
+// contains the number of layers and the size of each layer.
+var registryImageRE = regexp.MustCompile(`^(\d+)x(\d+)([kmg]?)$`)
+
+// OCIDescriptor describes a blob referenced by a manifest.
+type OCIDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// OCIManifest is the manifest of an image.
+type OCIManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        OCIDescriptor   `json:"config"`
+	Layers        []OCIDescriptor `json:"layers"`
+}
+
+// OCIImageConfig is the configuration of an image.
+type OCIImageConfig struct {
+	Created      time.Time `json:"created"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	RootFS       OCIRootFS `json:"rootfs"`
+}
+
+// OCIRootFS contains the identifiers of the layers of an image. As the layers aren't compressed the identifiers are
+// the digests of the layers.
+type OCIRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// RegistryErrors is the document returned by the OCI distribution API when a request fails.
+type RegistryErrors struct {
+	Errors []RegistryError `json:"errors"`
+}
+
+// RegistryError describes one of the errors of a failed request.
+type RegistryError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RegistryHandler is an HTTP handler that implements the pull side of the OCI distribution API with synthetic images,
+// so that the throughput of image pulls through registries, mirrors and proxies can be measured with real clients.
+// The last component of the name of the repository selects the image: the number of layers, the letter 'x', and the
+// size of each layer, in bytes or with a 'k', 'm' or 'g' suffix. For example 'localhost:8443/dummy/4x64m:latest' is
+// an image with four layers of 64 MiB. All tags return the same image.
+//
+// Each layer is an uncompressed tar archive containing one file of random data. The content of the layers depends
+// only on their size and position, so images with the same layer size share their first layers, like real images
+// that share a base, and the digests are the same in every instance of the server. Calculating the digests requires
+// generating the layers, so the first request for an image can take a while, then they are remembered.
+//
+// The push side of the API accepts blobs and manifests for any repository, and discards them after verifying their
+// digests, so that push paths can be measured as well. Blobs can be uploaded in one request or in chunks, and
+// interrupted uploads can be resumed from the last byte received.
+type RegistryHandler struct {
+	logger   *slog.Logger
+	identity Identity
+	buffers  *BufferPool
+	stats    *Stats
+	lock     sync.Mutex
+	digests  map[registryLayer]string
+	uploads  map[string]*registryUpload
+	swept    time.Time
+}
+
+// registryImage describes a synthetic image.
+type registryImage struct {
+	layers int
+	size   int64
+}
+
+// registryLayer identifies a layer of a synthetic image.
+type registryLayer struct {
+	index int
+	size  int64
+}
+
+// NewRegistryHandler creates a new handler for the OCI distribution API.
+func NewRegistryHandler(logger *slog.Logger, identity Identity, buffers *BufferPool, stats *Stats) *RegistryHandler {
+	return &RegistryHandler{
+		logger:   logger,
+		identity: identity,
+		buffers:  buffers,
+		stats:    stats,
+		digests:  map[registryLayer]string{},
+		uploads:  map[string]*registryUpload{},
+		swept:    time.Now(),
+	}
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *RegistryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	// The root of the API only tells the client that this is a registry:
+	rest := strings.TrimPrefix(r.URL.Path, registryPrefix)
+	if rest == "" {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}\n")
+		return
+	}
+
+	// The rest of the paths start with the name of the repository, that may contain slashes:
+	var name, kind, reference string
+	if prefix, ok := strings.CutSuffix(rest, "/tags/list"); ok {
+		name, kind = prefix, "tags"
+	} else {
+		for _, candidate := range []string{"blobs/uploads", "manifests", "blobs"} {
+			index := strings.LastIndex(rest, "/"+candidate+"/")
+			if index > 0 {
+				name, kind, reference = rest[:index], candidate, rest[index+len(candidate)+2:]
+				break
+			}
+		}
+	}
+	if kind == "" {
+		h.sendError(w, http.StatusNotFound, "UNSUPPORTED", fmt.Sprintf("path '%s' isn't supported", r.URL.Path))
+		return
+	}
+
+	// Blobs and manifests can be pushed to any repository, the rest of the requests need one of the synthetic
+	// images:
+	switch {
+	case kind == "blobs/uploads":
+		h.serveUpload(w, r, name, reference)
+		return
+	case kind == "manifests" && r.Method == http.MethodPut:
+		h.putManifest(w, r, name)
+		return
+	case r.Method != http.MethodGet && r.Method != http.MethodHead:
+		h.sendError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", fmt.Sprintf(
+			"method '%s' isn't supported", r.Method,
+		))
+		return
+	}
+	image, err := parseRegistryImage(name)
+	if err != nil {
+		h.sendError(w, http.StatusNotFound, "NAME_UNKNOWN", err.Error())
+		return
+	}
+
+	switch kind {
+	case "tags":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(map[string]any{
+			"name": name,
+			"tags": []string{"latest"},
+		})
+		if err != nil {
+			h.logger.Error(
+				"Failed to send tags",
+				slog.String("error", err.Error()),
+			)
+		}
+	case "manifests":
+		h.sendManifest(w, r, image, reference)
+	case "blobs":
+		h.sendBlob(w, r, image, reference)
+	}
+}
+
+// parseRegistryImage extracts the description of the image from the name of the repository.
+func parseRegistryImage(name string) (result registryImage, err error) {
+	matches := registryImageRE.FindStringSubmatch(path.Base(name))
+	if matches == nil {
+		err = fmt.Errorf(
+			"repository '%s' doesn't exist, the last component of the name should be the number of layers "+
+				"and the size of each layer, for example '4x64m'",
+			name,
+		)
+		return
+	}
+	result.layers, err = strconv.Atoi(matches[1])
+	if err != nil || result.layers < 1 || result.layers > maxRegistryLayers {
+		err = fmt.Errorf("number of layers should be between 1 and %d", maxRegistryLayers)
+		return
+	}
+	unit := int64(1)
+	switch matches[3] {
+	case "k":
+		unit = 1 << 10
+	case "m":
+		unit = 1 << 20
+	case "g":
+		unit = 1 << 30
+	}
+	result.size, err = strconv.ParseInt(matches[2], 10, 64)
+	if err != nil || result.size > maxRegistryLayerSize/unit {
+		err = fmt.Errorf("size of layers should be at most %d bytes", maxRegistryLayerSize)
+		return
+	}
+	result.size *= unit
+	return
+}
+
+// describe returns the manifest and the configuration of the image, and the digests of the layers.
+func (h *RegistryHandler) describe(image registryImage) (manifest, config []byte, layers []OCIDescriptor, err error) {
+	var diffIDs []string
+	for i := 0; i < image.layers; i++ {
+		layer := registryLayer{
+			index: i,
+			size:  image.size,
+		}
+		var digest string
+		digest, err = h.digest(layer)
+		if err != nil {
+			return
+		}
+		_, size := layer.source()
+		layers = append(layers, OCIDescriptor{
+			MediaType: ociLayerType,
+			Digest:    digest,
+			Size:      size,
+		})
+		diffIDs = append(diffIDs, digest)
+	}
+	config, err = json.Marshal(&OCIImageConfig{
+		Created:      syntheticModTime,
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		RootFS: OCIRootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
+		},
+	})
+	if err != nil {
+		return
+	}
+	manifest, err = json.Marshal(&OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestType,
+		Config: OCIDescriptor{
+			MediaType: ociConfigType,
+			Digest:    ociDigest(config),
+			Size:      int64(len(config)),
+		},
+		Layers: layers,
+	})
+	return
+}
+
+// digest returns the digest of the given layer, calculating it the first time.
+func (h *RegistryHandler) digest(layer registryLayer) (result string, err error) {
+	h.lock.Lock()
+	result, ok := h.digests[layer]
+	h.lock.Unlock()
+	if ok {
+		return
+	}
+	startTime := time.Now()
+	source, size := layer.source()
+	hash := sha256.New()
+	_, err = io.Copy(hash, newDataSourceReader(source, layer.seed(), size))
+	if err != nil {
+		return
+	}
+	result = "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	h.lock.Lock()
+	h.digests[layer] = result
+	h.lock.Unlock()
+	h.logger.Debug(
+		"Calculated layer digest",
+		slog.Int("index", layer.index),
+		slog.Int64("size", layer.size),
+		slog.String("digest", result),
+		slog.String("elapsed", time.Since(startTime).String()),
+	)
+	return
+}
+
+// sendManifest sends the manifest of the image, if the reference is a tag or the digest of the manifest.
+func (h *RegistryHandler) sendManifest(w http.ResponseWriter, r *http.Request, image registryImage,
+	reference string) {
+	manifest, _, _, err := h.describe(image)
+	if err != nil {
+		h.logger.Error(
+			"Failed to describe image",
+			slog.String("error", err.Error()),
+		)
+		h.sendError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	digest := ociDigest(manifest)
+	if strings.HasPrefix(reference, "sha256:") && reference != digest {
+		h.sendError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf(
+			"manifest '%s' doesn't exist", reference,
+		))
+		return
+	}
+	w.Header().Set("Content-Type", ociManifestType)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("ETag", `"`+digest+`"`)
+	http.ServeContent(w, r, "", syntheticModTime, bytes.NewReader(manifest))
+}
+
+// sendBlob sends the configuration or one of the layers of the image.
+func (h *RegistryHandler) sendBlob(w http.ResponseWriter, r *http.Request, image registryImage, digest string) {
+	_, config, layers, err := h.describe(image)
+	if err != nil {
+		h.logger.Error(
+			"Failed to describe image",
+			slog.String("error", err.Error()),
+		)
+		h.sendError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	var content io.ReadSeeker
+	if digest == ociDigest(config) {
+		content = bytes.NewReader(config)
+	}
+	for i, layer := range layers {
+		if digest == layer.Digest {
+			blob := registryLayer{
+				index: i,
+				size:  image.size,
+			}
+			source, size := blob.source()
+			content = newDataSourceReader(source, blob.seed(), size)
+			break
+		}
+	}
+	if content == nil {
+		h.sendError(w, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Sprintf("blob '%s' doesn't exist", digest))
+		return
+	}
+	h.logger.Debug(
+		"Serving blob",
+		slog.String("digest", digest),
+		slog.String("range", r.Header.Get("Range")),
+	)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("ETag", `"`+digest+`"`)
+	http.ServeContent(w, r, "", syntheticModTime, content)
+}
+
+// sendError sends an error in the format of the OCI distribution API.
+func (h *RegistryHandler) sendError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(&RegistryErrors{
+		Errors: []RegistryError{{
+			Code:    code,
+			Message: message,
+		}},
+	})
+	if err != nil {
+		h.logger.Error(
+			"Failed to send registry error",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// ociDigest calculates the digest of the given data.
+func ociDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// seed returns the seed of the content of the layer.
+func (l registryLayer) seed() [32]byte {
+	return sha256.Sum256([]byte(fmt.Sprintf("registry/%d/%d", l.size, l.index)))
+}
+
+// source returns the generator and the size of the tar archive of the layer.
+func (l registryLayer) source() (source DataSource, size int64) {
+	return newTarFileSource(fmt.Sprintf("dummy/layer-%03d.bin", l.index), l.size, lookupDataSource(sourceRandom))
+}
+
+// tarFileSource is a data source that generates a tar archive that contains one file, with the content generated by
+// another source.
+type tarFileSource struct {
+	header  []byte
+	size    int64
+	content DataSource
+}
+
+// newTarFileSource creates a source that generates a tar archive containing a file with the given name and size. It
+// returns the source and the size of the archive.
+func newTarFileSource(name string, size int64, content DataSource) (source DataSource, total int64) {
+	// Writing the header can't fail, as the buffer doesn't fail and the name and the size are always valid:
+	buffer := &bytes.Buffer{}
+	writer := tar.NewWriter(buffer)
+	writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  syntheticModTime,
+	})
+	s := &tarFileSource{
+		header:  buffer.Bytes(),
+		size:    size,
+		content: content,
+	}
+	padded := (size + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+	source = s
+	total = int64(len(s.header)) + padded + 2*tarBlockSize
+	return
+}
+
+// ContentType is the implementation of the DataSource interface.
+func (s *tarFileSource) ContentType() string {
+	return "application/x-tar"
+}
+
+// ReadAt is the implementation of the DataSource interface. The content of the file is followed by zeros, which are
+// the padding of the last block and the end of the archive.
+func (s *tarFileSource) ReadAt(seed [32]byte, p []byte, offset int64) {
+	start := int64(len(s.header))
+	if offset < start {
+		n := copy(p, s.header[offset:])
+		p = p[n:]
+		offset += int64(n)
+	}
+	if len(p) > 0 && offset < start+s.size {
+		n := min(int64(len(p)), start+s.size-offset)
+		s.content.ReadAt(seed, p[:n], offset-start)
+		p = p[n:]
+	}
+	clear(p)
+}
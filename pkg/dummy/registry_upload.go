@@ -0,0 +1,285 @@
+package dummy
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of the uploads of the OCI distribution API:
+const (
+	registryUploadTTL    = 10 * time.Minute
+	maxRegistryUploads   = 1000
+	maxRegistryManifest  = 4 << 20 // 4 MiB
+	registryDigestPrefix = "sha256:"
+)
+
+// registryUpload is the state of a blob upload session. The data is discarded, only the digest and the size are kept.
+// The lock serializes the requests that add data to the session.
+type registryUpload struct {
+	id       string
+	name     string
+	lock     sync.Mutex
+	hash     hash.Hash
+	size     int64
+	created  time.Time
+	lastSeen time.Time
+}
+
+// serveUpload handles the requests for blob uploads. A POST request starts an upload session, or uploads a complete
+// blob if it has the digest, PATCH requests add chunks, a PUT request adds the last chunk and verifies the digest, a
+// GET request returns the progress, so that interrupted uploads can be resumed, and a DELETE request cancels it.
+func (h *RegistryHandler) serveUpload(w http.ResponseWriter, r *http.Request, name, id string) {
+	if r.Method == http.MethodPost && id == "" {
+		h.startUpload(w, r, name)
+		return
+	}
+	upload := h.findUpload(name, id)
+	if upload == nil {
+		h.sendError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", fmt.Sprintf(
+			"upload '%s' doesn't exist", id,
+		))
+		return
+	}
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		h.sendUploadStatus(w, upload, http.StatusNoContent)
+	case http.MethodPatch:
+		if !h.receiveChunk(w, r, upload) {
+			return
+		}
+		h.sendUploadStatus(w, upload, http.StatusAccepted)
+	case http.MethodPut:
+		if !h.receiveChunk(w, r, upload) {
+			return
+		}
+		if h.finishUpload(w, r, upload) {
+			h.removeUpload(upload)
+		}
+	case http.MethodDelete:
+		h.removeUpload(upload)
+		w.WriteHeader(http.StatusNoContent)
+		h.logger.Info(
+			"Cancelled blob upload",
+			slog.String("name", upload.name),
+			slog.String("id", upload.id),
+			slog.Int64("size", upload.size),
+		)
+	default:
+		h.sendError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", fmt.Sprintf(
+			"method '%s' isn't supported", r.Method,
+		))
+	}
+}
+
+// startUpload creates an upload session. If the request has the digest the body is the complete blob, and the upload
+// finishes immediately.
+func (h *RegistryHandler) startUpload(w http.ResponseWriter, r *http.Request, name string) {
+	var data [16]byte
+	_, err := rand.Read(data[:])
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	now := time.Now()
+	upload := &registryUpload{
+		id:       hex.EncodeToString(data[:]),
+		name:     name,
+		hash:     sha256.New(),
+		created:  now,
+		lastSeen: now,
+	}
+	if r.URL.Query().Get("digest") != "" {
+		if h.receiveChunk(w, r, upload) {
+			h.finishUpload(w, r, upload)
+		}
+		return
+	}
+	h.lock.Lock()
+	h.sweepUploads(now)
+	count := len(h.uploads)
+	if count < maxRegistryUploads {
+		h.uploads[upload.id] = upload
+	}
+	h.lock.Unlock()
+	if count >= maxRegistryUploads {
+		h.sendError(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", fmt.Sprintf(
+			"there are already %d uploads in progress", count,
+		))
+		return
+	}
+	h.logger.Debug(
+		"Started blob upload",
+		slog.String("name", name),
+		slog.String("id", upload.id),
+	)
+	h.sendUploadStatus(w, upload, http.StatusAccepted)
+}
+
+// findUpload returns the upload session with the given identifier, or nil if it doesn't exist or belongs to a different
+// repository.
+func (h *RegistryHandler) findUpload(name, id string) *registryUpload {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	now := time.Now()
+	h.sweepUploads(now)
+	upload := h.uploads[id]
+	if upload == nil || upload.name != name {
+		return nil
+	}
+	upload.lastSeen = now
+	return upload
+}
+
+// removeUpload discards an upload session.
+func (h *RegistryHandler) removeUpload(upload *registryUpload) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.uploads, upload.id)
+}
+
+// sweepUploads discards the upload sessions that have been idle for longer than the TTL. To avoid scanning the
+// sessions for every request it runs at most once per minute.
+func (h *RegistryHandler) sweepUploads(now time.Time) {
+	if now.Sub(h.swept) < time.Minute {
+		return
+	}
+	h.swept = now
+	for id, upload := range h.uploads {
+		if now.Sub(upload.lastSeen) > registryUploadTTL {
+			delete(h.uploads, id)
+		}
+	}
+}
+
+// receiveChunk adds the body of the request to the upload. If the request has a 'Content-Range' header it must start
+// where the previous chunk ended. It returns false if the request failed, and then the response has already been
+// sent. Note that when the body is interrupted the bytes received are kept, so that the client can resume the upload
+// after checking the progress.
+func (h *RegistryHandler) receiveChunk(w http.ResponseWriter, r *http.Request, upload *registryUpload) bool {
+	text := r.Header.Get("Content-Range")
+	if text != "" {
+		first, _, _ := strings.Cut(strings.TrimPrefix(text, "bytes="), "-")
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start != upload.size {
+			w.Header().Set("Range", upload.progress())
+			w.Header().Set("Location", upload.location())
+			h.sendError(w, http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID", fmt.Sprintf(
+				"chunk range '%s' doesn't start at the %d bytes already received", text, upload.size,
+			))
+			return false
+		}
+	}
+	buffer := h.buffers.Get(DefaultBufferSize)
+	defer h.buffers.Put(buffer)
+	startTime := time.Now()
+	n, err := io.CopyBuffer(upload.hash, r.Body, *buffer)
+	elapsed := time.Since(startTime)
+	upload.size += n
+	h.stats.RecordTransfer(r.Context(), n, elapsed)
+	if err != nil {
+		h.logger.Info(
+			"Failed to read blob chunk",
+			slog.String("name", upload.name),
+			slog.String("id", upload.id),
+			slog.Int64("bytes", n),
+			slog.String("error", err.Error()),
+		)
+		h.sendError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+		return false
+	}
+	return true
+}
+
+// finishUpload verifies the digest of the complete blob. It returns false if the digest doesn't match, and then the
+// upload session is kept so that the client can check the progress and try again.
+func (h *RegistryHandler) finishUpload(w http.ResponseWriter, r *http.Request, upload *registryUpload) bool {
+	expected := r.URL.Query().Get("digest")
+	if !strings.HasPrefix(expected, registryDigestPrefix) {
+		h.sendError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf(
+			"digest '%s' isn't supported, it should start with '%s'", expected, registryDigestPrefix,
+		))
+		return false
+	}
+	actual := registryDigestPrefix + hex.EncodeToString(upload.hash.Sum(nil))
+	if actual != expected {
+		h.logger.Info(
+			"Blob digest mismatch",
+			slog.String("name", upload.name),
+			slog.String("expected", expected),
+			slog.String("actual", actual),
+		)
+		h.sendError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf(
+			"digest of the blob is '%s', but it should be '%s'", actual, expected,
+		))
+		return false
+	}
+	w.Header().Set("Location", registryPrefix+upload.name+"/blobs/"+actual)
+	w.Header().Set("Docker-Content-Digest", actual)
+	w.WriteHeader(http.StatusCreated)
+	h.logger.Info(
+		"Blob uploaded",
+		slog.String("name", upload.name),
+		slog.String("digest", actual),
+		slog.Int64("size", upload.size),
+		slog.String("elapsed", time.Since(upload.created).String()),
+		h.identity.LogAttr(),
+	)
+	return true
+}
+
+// sendUploadStatus sends the headers that describe the progress of an upload.
+func (h *RegistryHandler) sendUploadStatus(w http.ResponseWriter, upload *registryUpload, status int) {
+	w.Header().Set("Location", upload.location())
+	w.Header().Set("Range", upload.progress())
+	w.Header().Set("Docker-Upload-UUID", upload.id)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(status)
+}
+
+// putManifest receives a manifest and discards it.
+func (h *RegistryHandler) putManifest(w http.ResponseWriter, r *http.Request, name string) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRegistryManifest+1))
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+	if len(body) > maxRegistryManifest {
+		h.sendError(w, http.StatusRequestEntityTooLarge, "SIZE_INVALID", fmt.Sprintf(
+			"manifest exceeds the maximum size of %d bytes", maxRegistryManifest,
+		))
+		return
+	}
+	digest := ociDigest(body)
+	w.Header().Set("Location", registryPrefix+name+"/manifests/"+digest)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+	h.logger.Info(
+		"Manifest uploaded",
+		slog.String("name", name),
+		slog.String("digest", digest),
+		slog.Int("size", len(body)),
+		h.identity.LogAttr(),
+	)
+}
+
+// location returns the path where the client should send the next chunk of the upload.
+func (u *registryUpload) location() string {
+	return registryPrefix + u.name + "/blobs/uploads/" + u.id
+}
+
+// progress returns the value of the 'Range' header that describes the bytes received.
+func (u *registryUpload) progress() string {
+	return fmt.Sprintf("0-%d", max(0, u.size-1))
+}
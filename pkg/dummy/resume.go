@@ -0,0 +1,391 @@
+package dummy
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Name of the response header that contains the token of a resumable download.
+const resumeTokenHeader = "X-Dummy-Resume-Token"
+
+// Defaults and limits of the resumable downloads:
+const (
+	defaultResumeSize       = 100 << 20 // 100 MiB
+	maxResumeSize     int64 = 1 << 40   // 1 TiB
+	maxResumeSessions       = 10000
+	resumeSessionTTL        = 30 * time.Minute
+)
+
+// errResumeBusy is returned when a resumable download is requested while a previous attempt is still in progress.
+var errResumeBusy = errors.New("download is already in progress")
+
+// ResumeSessionStats contains the server side accounting of a resumable download.
+type ResumeSessionStats struct {
+	Token         string    `json:"token"`
+	Source        string    `json:"source"`
+	Size          int64     `json:"size"`
+	Delivered     int64     `json:"delivered"`
+	Sent          int64     `json:"sent"`
+	Attempts      int       `json:"attempts"`
+	Interruptions int       `json:"interruptions"`
+	Completed     bool      `json:"completed"`
+	Created       time.Time `json:"created"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// resumeSession is the state of a resumable download. The settings are fixed when the download starts, so that
+// resuming it only needs the token.
+type resumeSession struct {
+	stats     ResumeSessionStats
+	source    DataSource
+	seed      [32]byte
+	interrupt int64
+	rate      float64
+	busy      bool
+}
+
+// ResumeManager tracks the resumable downloads and the bytes delivered for each of them.
+type ResumeManager struct {
+	lock     sync.Mutex
+	sessions map[string]*resumeSession
+	swept    time.Time
+}
+
+// NewResumeManager creates a manager without downloads.
+func NewResumeManager() *ResumeManager {
+	return &ResumeManager{
+		sessions: map[string]*resumeSession{},
+		swept:    time.Now(),
+	}
+}
+
+// create adds a download and marks it as in progress.
+func (m *ResumeManager) create(session *resumeSession) error {
+	var data [16]byte
+	_, err := crand.Read(data[:])
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	session.stats.Token = hex.EncodeToString(data[:])
+	session.stats.Created = now
+	session.stats.LastSeen = now
+	session.stats.Attempts = 1
+	session.busy = true
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sweep(now)
+	if len(m.sessions) >= maxResumeSessions {
+		return fmt.Errorf("there are already %d resumable downloads", len(m.sessions))
+	}
+	m.sessions[session.stats.Token] = session
+	return nil
+}
+
+// acquire finds the download with the given token and marks it as in progress. It returns nil if it doesn't exist, and
+// an error if a previous attempt is still in progress.
+func (m *ResumeManager) acquire(token string) (session *resumeSession, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	m.sweep(now)
+	session = m.sessions[token]
+	if session == nil {
+		return
+	}
+	if session.busy {
+		err = errResumeBusy
+		return
+	}
+	session.busy = true
+	session.stats.Attempts++
+	session.stats.LastSeen = now
+	return
+}
+
+// release marks the attempt in progress as finished.
+func (m *ResumeManager) release(session *resumeSession, interrupted bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	session.busy = false
+	session.stats.LastSeen = time.Now()
+	if interrupted {
+		session.stats.Interruptions++
+	}
+}
+
+// delivered records that the bytes of the download up to the given offset have been sent, and that the given number
+// of bytes were sent by the current attempt.
+func (m *ResumeManager) delivered(session *resumeSession, offset, sent int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	session.stats.Delivered = max(session.stats.Delivered, offset)
+	session.stats.Sent += sent
+	session.stats.Completed = session.stats.Delivered == session.stats.Size
+}
+
+// Report returns the accounting of the downloads, sorted by creation time.
+func (m *ResumeManager) Report() []ResumeSessionStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	result := make([]ResumeSessionStats, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		result = append(result, session.stats)
+	}
+	slices.SortFunc(result, func(a, b ResumeSessionStats) int {
+		return a.Created.Compare(b.Created)
+	})
+	return result
+}
+
+// sweep discards the downloads that have been idle for longer than the TTL. To avoid scanning the downloads for every
+// request it runs at most once per minute.
+func (m *ResumeManager) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for token, session := range m.sessions {
+		if !session.busy && now.Sub(session.stats.LastSeen) > resumeSessionTTL {
+			delete(m.sessions, token)
+		}
+	}
+}
+
+// ResumeHandler is an HTTP handler for downloads that can be resumed with a token instead of a range, so that the
+// resume logic of clients can be tested in flaky networks. A request to '/resume' starts a download and returns the
+// token in the 'X-Dummy-Resume-Token' header. It is controlled with these query parameters:
+//
+//   - 'size' is the total size of the download, in bytes. The default is 100 MiB.
+//   - 'source' is the name of the data source that generates the content. The default is 'random'.
+//   - 'interrupt' is a number of bytes after which each attempt is interrupted, resetting the stream. The default is
+//     zero, which means that attempts aren't interrupted by the server.
+//   - 'rate' is the maximum transfer rate, in bytes per second, so that there is time to interrupt the transfer from
+//     the client side.
+//
+// A request to '/resume/{token}' continues the download from the last byte delivered by the server, and the response
+// has the 206 status and the 'Content-Range' header. The server counts as delivered the bytes written to the
+// connection, and some of them may have been lost when the connection failed, so the client can send the number of
+// bytes that it actually received in the 'offset' query parameter. The content is the same in all the attempts. The
+// bytes delivered for each download are reported by the statistics endpoint.
+type ResumeHandler struct {
+	logger   *slog.Logger
+	identity Identity
+	buffers  *BufferPool
+	stats    *Stats
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *ResumeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+	query := r.URL.Query()
+	token := r.PathValue("token")
+
+	// Start a new download, or find the one that should be resumed:
+	var session *resumeSession
+	var offset int64
+	var err error
+	if token == "" {
+		session, err = h.parseSession(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = h.stats.resumes.create(session)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		token = session.stats.Token
+		h.logger.Info(
+			"Started resumable download",
+			slog.String("token", token),
+			slog.Int64("size", session.stats.Size),
+			slog.String("source", session.stats.Source),
+		)
+	} else {
+		session, err = h.stats.resumes.acquire(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if session == nil {
+			http.Error(w, fmt.Sprintf("download '%s' doesn't exist", token), http.StatusNotFound)
+			return
+		}
+		offset = session.stats.Delivered
+		text := query.Get("offset")
+		if text != "" {
+			value, err := strconv.ParseInt(text, 10, 64)
+			if err != nil || value < 0 || value > offset {
+				h.stats.resumes.release(session, false)
+				http.Error(w, fmt.Sprintf("offset '%s' should be a number of bytes between 0 and %d", text,
+					offset), http.StatusBadRequest)
+				return
+			}
+			offset = value
+		}
+	}
+	interrupted := true
+	defer func() {
+		h.stats.resumes.release(session, interrupted)
+	}()
+
+	// A download that has been completely delivered has nothing left to send:
+	size := session.stats.Size
+	w.Header().Set(resumeTokenHeader, token)
+	if offset == size && size > 0 {
+		interrupted = false
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, fmt.Sprintf("download '%s' is complete", token), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	// Prepare the data, starting at the offset, and the part that will be sent before the interruption:
+	reader := newDataSourceReader(session.source, session.seed, size)
+	_, err = reader.Seek(offset, io.SeekStart)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pending := size - offset
+	limit := pending
+	if session.interrupt > 0 {
+		limit = min(limit, session.interrupt)
+	}
+	w.Header().Set("Content-Type", session.source.ContentType())
+	w.Header().Set("Content-Length", strconv.FormatInt(pending, 10))
+	if offset > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// Send the data, recording the bytes delivered after each write:
+	var writer io.Writer = w
+	if session.rate > 0 {
+		writer = &pacedWriter{
+			ResponseWriter: w,
+			ctx:            r.Context(),
+			rate:           session.rate,
+			start:          time.Now(),
+		}
+	}
+	writer = &resumeWriter{
+		writer:  writer,
+		manager: h.stats.resumes,
+		session: session,
+		offset:  offset,
+	}
+	buffer := h.buffers.Get(DefaultBufferSize)
+	defer h.buffers.Put(buffer)
+	startTime := time.Now()
+	sent, err := io.CopyBuffer(writer, io.LimitReader(reader, limit), *buffer)
+	elapsed := time.Since(startTime)
+	h.stats.RecordTransfer(r.Context(), sent, elapsed)
+	if err != nil {
+		h.logger.Info(
+			"Resumable download interrupted by the client",
+			slog.String("token", token),
+			slog.Int64("offset", offset),
+			slog.Int64("sent", sent),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if limit < pending {
+		h.logger.Info(
+			"Interrupted resumable download",
+			slog.String("token", token),
+			slog.Int64("offset", offset),
+			slog.Int64("sent", sent),
+		)
+		http.NewResponseController(w).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	interrupted = false
+	h.stats.resumes.delivered(session, size, 0)
+	h.logger.Info(
+		"Resumable download completed",
+		slog.String("token", token),
+		slog.Int64("size", size),
+		slog.Int64("offset", offset),
+		slog.Int("attempt", session.stats.Attempts),
+		slog.String("elapsed", elapsed.String()),
+		h.identity.LogAttr(),
+	)
+}
+
+// parseSession creates a download from the query parameters of the request that starts it.
+func (h *ResumeHandler) parseSession(query url.Values) (session *resumeSession, err error) {
+	size := int64(defaultResumeSize)
+	text := query.Get("size")
+	if text != "" {
+		size, err = strconv.ParseInt(text, 10, 64)
+		if err != nil || size < 0 || size > maxResumeSize {
+			err = fmt.Errorf("size '%s' should be a number of bytes between 0 and %d", text, maxResumeSize)
+			return
+		}
+	}
+	interrupt := int64(0)
+	text = query.Get("interrupt")
+	if text != "" {
+		interrupt, err = strconv.ParseInt(text, 10, 64)
+		if err != nil || interrupt < 0 {
+			err = fmt.Errorf("interrupt '%s' should be a positive number of bytes", text)
+			return
+		}
+	}
+	rate, err := parseFloatParam(query.Get("rate"), 0)
+	if err != nil || rate < 0 {
+		err = fmt.Errorf("rate '%s' should be a positive number of bytes per second", query.Get("rate"))
+		return
+	}
+	sourceName := query.Get("source")
+	if sourceName == "" {
+		sourceName = sourceRandom
+	}
+	source := lookupDataSource(sourceName)
+	if source == nil {
+		err = unknownSourceError(sourceName)
+		return
+	}
+	session = &resumeSession{
+		stats: ResumeSessionStats{
+			Source: sourceName,
+			Size:   size,
+		},
+		source:    source,
+		interrupt: interrupt,
+		rate:      rate,
+	}
+	_, err = crand.Read(session.seed[:])
+	return
+}
+
+// resumeWriter is a writer that records in the manager the bytes of a download written successfully.
+type resumeWriter struct {
+	writer  io.Writer
+	manager *ResumeManager
+	session *resumeSession
+	offset  int64
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *resumeWriter) Write(p []byte) (n int, err error) {
+	n, err = w.writer.Write(p)
+	w.offset += int64(n)
+	w.manager.delivered(w.session, w.offset, int64(n))
+	return
+}
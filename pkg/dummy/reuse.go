@@ -0,0 +1,187 @@
+package dummy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Defaults of the connection reuse mode of the load generator:
+const (
+	DefaultBenchReuseRequests = 100
+	DefaultBenchReuseSize     = 1 << 10 // 1 KiB
+)
+
+// Phases of the connection reuse mode:
+const (
+	reusePhaseReused  = "reused"
+	reusePhaseResumed = "resumed"
+	reusePhaseFull    = "full"
+)
+
+// BenchReuseResult is the report of a run of the load generator in connection reuse mode. It contains a phase where
+// all the requests use the same connection, another where each request opens a new connection but can resume the TLS
+// session of the previous one, and a last one where each request performs a full handshake. Overhead is the extra
+// mean duration of a request that opens a new connection with a full handshake, compared to one that reuses a
+// connection, and ResumptionSavings is how much of that is saved by resuming TLS sessions.
+type BenchReuseResult struct {
+	Target            string             `json:"target"`
+	Protocol          string             `json:"protocol"`
+	Requests          int                `json:"requests"`
+	Phases            []*BenchReusePhase `json:"phases"`
+	Overhead          Duration           `json:"overhead"`
+	ResumptionSavings Duration           `json:"resumption_savings"`
+}
+
+// BenchReusePhase contains the measurements of one of the phases of the connection reuse mode. The latencies are the
+// durations of complete requests, and the connect and TLS durations are the means for the requests that opened a new
+// connection. ResumptionRate is the fraction of the TLS handshakes that resumed a previous session.
+type BenchReusePhase struct {
+	Name           string   `json:"name"`
+	Requests       int      `json:"requests"`
+	Errors         int      `json:"errors"`
+	NewConnections int      `json:"new_connections"`
+	Latency        Duration `json:"latency"`
+	P50            Duration `json:"p50"`
+	P99            Duration `json:"p99"`
+	Connect        Duration `json:"connect"`
+	TLS            Duration `json:"tls"`
+	Resumed        int      `json:"resumed"`
+	ResumptionRate float64  `json:"resumption_rate"`
+}
+
+// RunReuse runs the load generator in connection reuse mode, sending the given number of requests, one after another,
+// in each of the phases. This quantifies the benefits of keep alive and TLS session resumption through a given path.
+// Note that clients don't resume sessions when the certificate of the server has expired, as the built-in one has.
+func (b *Bench) RunReuse(ctx context.Context, requests int) (result *BenchReuseResult, err error) {
+	if requests <= 0 {
+		requests = DefaultBenchReuseRequests
+	}
+	result = &BenchReuseResult{
+		Target:   b.address,
+		Protocol: b.options.Transport.Protocol,
+		Requests: requests,
+	}
+	for _, name := range []string{reusePhaseReused, reusePhaseResumed, reusePhaseFull} {
+		var phase *BenchReusePhase
+		phase, err = b.runReusePhase(ctx, name, requests)
+		if err != nil {
+			return
+		}
+		result.Phases = append(result.Phases, phase)
+		b.logger.Info(
+			"Phase finished",
+			slog.String("phase", name),
+			slog.Int("requests", phase.Requests),
+			slog.Int("errors", phase.Errors),
+			slog.String("latency", time.Duration(phase.Latency).String()),
+		)
+	}
+	reused := result.Phases[0]
+	resumed := result.Phases[1]
+	full := result.Phases[2]
+	result.Overhead = full.Latency - reused.Latency
+	result.ResumptionSavings = full.Latency - resumed.Latency
+	return
+}
+
+// runReusePhase sends the requests of one phase of the connection reuse mode.
+func (b *Bench) runReusePhase(ctx context.Context, name string, requests int) (result *BenchReusePhase, err error) {
+	transport, err := NewTransport(b.options.Transport)
+	if err != nil {
+		return
+	}
+	defer transport.CloseIdleConnections()
+	switch name {
+	case reusePhaseResumed:
+		transport.DisableKeepAlives = true
+		transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	case reusePhaseFull:
+		transport.DisableKeepAlives = true
+		transport.TLSClientConfig.ClientSessionCache = nil
+		transport.TLSClientConfig.SessionTicketsDisabled = true
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   b.options.Transport.Timeout,
+	}
+	result = &BenchReusePhase{
+		Name: name,
+	}
+	var latencies []float64
+	var connect, handshake time.Duration
+	var handshakes int
+	buffer := make([]byte, b.options.Buffer)
+	for i := 0; i < requests && ctx.Err() == nil; i++ {
+		start := time.Now()
+		tracer, requestCtx := newTimingTracer(ctx)
+		resumed, sendErr := b.sendReuse(requestCtx, client, buffer)
+		timing := tracer.finish()
+		result.Requests++
+		if sendErr != nil {
+			result.Errors++
+			continue
+		}
+		latencies = append(latencies, time.Since(start).Seconds())
+		if !timing.Reused {
+			result.NewConnections++
+			connect += time.Duration(timing.Connect)
+		}
+		if timing.TLS > 0 {
+			handshakes++
+			handshake += time.Duration(timing.TLS)
+			if resumed {
+				result.Resumed++
+			}
+		}
+	}
+	err = ctx.Err()
+	if err != nil {
+		return
+	}
+
+	// Calculate the means and the percentiles:
+	if len(latencies) > 0 {
+		result.Latency = benchSeconds(mean(latencies))
+		slices.Sort(latencies)
+		result.P50 = benchSeconds(percentile(latencies, 0.50))
+		result.P99 = benchSeconds(percentile(latencies, 0.99))
+	}
+	if result.NewConnections > 0 {
+		result.Connect = Duration(connect / time.Duration(result.NewConnections))
+	}
+	if handshakes > 0 {
+		result.TLS = Duration(handshake / time.Duration(handshakes))
+		result.ResumptionRate = float64(result.Resumed) / float64(handshakes)
+	}
+	return
+}
+
+// sendReuse sends one request of the connection reuse mode and reads the response. It returns true if the TLS
+// session of the connection was resumed.
+func (b *Bench) sendReuse(ctx context.Context, client *http.Client, buffer []byte) (resumed bool, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, b.address, nil)
+	if err != nil {
+		return
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	_, err = io.CopyBuffer(io.Discard, response.Body, buffer)
+	if err != nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %d", response.StatusCode)
+		return
+	}
+	resumed = response.TLS != nil && response.TLS.DidResume
+	return
+}
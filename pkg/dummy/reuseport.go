@@ -0,0 +1,102 @@
+package dummy
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// withReusePort changes the listen configuration so that the SO_REUSEPORT option is enabled in the sockets, in
+// addition to anything that the configuration already does.
+func withReusePort(listenConfig *net.ListenConfig) {
+	control := listenConfig.Control
+	listenConfig.Control = func(network, address string, conn syscall.RawConn) error {
+		if control != nil {
+			err := control(network, address, conn)
+			if err != nil {
+				return err
+			}
+		}
+		var err error
+		controlErr := conn.Control(func(fd uintptr) {
+			err = setReusePort(fd)
+		})
+		if controlErr != nil {
+			return controlErr
+		}
+		return err
+	}
+}
+
+// mergedListener is a listener that accepts connections from several listening sockets in parallel, one goroutine
+// per socket. With SO_REUSEPORT the kernel distributes the incoming connections between the sockets, which improves
+// the scalability of the accept path under very high connection rates.
+type mergedListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// newMergedListener creates a listener that accepts connections from all the given listeners.
+func newMergedListener(listeners []net.Listener) *mergedListener {
+	result := &mergedListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		errs:      make(chan error, len(listeners)),
+		closing:   make(chan struct{}),
+	}
+	for _, listener := range listeners {
+		go result.accept(listener)
+	}
+	return result
+}
+
+func (l *mergedListener) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			l.errs <- err
+			return
+		}
+		select {
+		case l.conns <- conn:
+		case <-l.closing:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept is the implementation of the net.Listener interface.
+func (l *mergedListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.closing:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close is the implementation of the net.Listener interface.
+func (l *mergedListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closing)
+		for _, listener := range l.listeners {
+			closeErr := listener.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+// Addr is the implementation of the net.Listener interface.
+func (l *mergedListener) Addr() net.Addr {
+	return l.listeners[0].Addr()
+}
@@ -0,0 +1,12 @@
+//go:build !unix || solaris
+
+package dummy
+
+import (
+	"errors"
+)
+
+// setReusePort enables the SO_REUSEPORT option of the socket. It isn't supported in Windows or Solaris.
+func setReusePort(fd uintptr) error {
+	return errors.New("SO_REUSEPORT isn't supported in this operating system")
+}
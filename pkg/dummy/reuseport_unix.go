@@ -0,0 +1,12 @@
+//go:build unix && !solaris
+
+package dummy
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setReusePort enables the SO_REUSEPORT option of the socket.
+func setReusePort(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+}
@@ -0,0 +1,250 @@
+package dummy
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of the paths of the S3 compatible API.
+const s3Prefix = "/s3/"
+
+// Number of objects listed in each bucket, and maximum number of objects returned in one page of the listing.
+const (
+	s3BucketSize   = 1000
+	s3MaxKeys      = 1000
+	s3DefaultOwner = "dummy"
+)
+
+// S3Handler is an HTTP handler that implements a minimal subset of the S3 API backed by synthetic objects, so that S3
+// clients and SDKs can be pointed to the server for transfer benchmarks. Only path style requests are supported, with
+// the endpoint set to the '/s3' path of the server. Any bucket and key can be requested, and the content is generated
+// like for the '/objects/{name}' endpoint, using 'bucket/key' as the name. The listing of a bucket contains a fixed
+// set of objects named 'object-00000', 'object-00001', and so on.
+type S3Handler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// S3Error is the XML document returned by S3 when a request fails.
+type S3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource,omitempty"`
+}
+
+// S3ListAllMyBucketsResult is the XML document returned by the list buckets operation.
+type S3ListAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   S3Owner    `xml:"Owner"`
+	Buckets []S3Bucket `xml:"Buckets>Bucket"`
+}
+
+// S3Owner is the owner of the buckets.
+type S3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+// S3Bucket describes one bucket in the list buckets result.
+type S3Bucket struct {
+	Name         string    `xml:"Name"`
+	CreationDate time.Time `xml:"CreationDate"`
+}
+
+// S3ListBucketResult is the XML document returned by the list objects operation, versions one and two.
+type S3ListBucketResult struct {
+	XMLName               xml.Name   `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string     `xml:"Name"`
+	Prefix                string     `xml:"Prefix"`
+	Marker                string     `xml:"Marker,omitempty"`
+	NextMarker            string     `xml:"NextMarker,omitempty"`
+	StartAfter            string     `xml:"StartAfter,omitempty"`
+	ContinuationToken     string     `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string     `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int        `xml:"KeyCount"`
+	MaxKeys               int        `xml:"MaxKeys"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	Contents              []S3Object `xml:"Contents"`
+}
+
+// S3Object describes one object in the list objects result.
+type S3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	StorageClass string    `xml:"StorageClass"`
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *S3Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.sendError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed",
+			fmt.Sprintf("Method '%s' isn't supported", r.Method))
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, s3Prefix), "/")
+	switch {
+	case bucket == "":
+		h.listBuckets(w, r)
+	case key == "":
+		h.listObjects(w, r, bucket)
+	default:
+		h.getObject(w, r, bucket, key)
+	}
+}
+
+func (h *S3Handler) listBuckets(w http.ResponseWriter, r *http.Request) {
+	h.sendXML(w, r, &S3ListAllMyBucketsResult{
+		Owner: S3Owner{
+			ID:          s3DefaultOwner,
+			DisplayName: s3DefaultOwner,
+		},
+		Buckets: []S3Bucket{{
+			Name:         s3DefaultOwner,
+			CreationDate: syntheticModTime,
+		}},
+	})
+}
+
+func (h *S3Handler) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	// Get the parameters. Version two of the API uses the continuation token and the start after parameters,
+	// version one uses the marker.
+	query := r.URL.Query()
+	v2 := query.Get("list-type") == "2"
+	prefix := query.Get("prefix")
+	maxKeys := s3MaxKeys
+	text := query.Get("max-keys")
+	if text != "" {
+		value, err := strconv.Atoi(text)
+		if err != nil || value < 0 {
+			h.sendError(w, r, http.StatusBadRequest, "InvalidArgument",
+				fmt.Sprintf("Value '%s' of 'max-keys' isn't valid", text))
+			return
+		}
+		maxKeys = min(value, s3MaxKeys)
+	}
+	after := query.Get("marker")
+	if v2 {
+		after = query.Get("start-after")
+		token := query.Get("continuation-token")
+		if token != "" {
+			after = token
+		}
+	}
+
+	// Find the first key after the marker. The keys are generated so that the lexicographic order is the same than
+	// the numeric order.
+	result := &S3ListBucketResult{
+		Name:    bucket,
+		Prefix:  prefix,
+		MaxKeys: maxKeys,
+	}
+	if v2 {
+		result.StartAfter = query.Get("start-after")
+		result.ContinuationToken = query.Get("continuation-token")
+	} else {
+		result.Marker = after
+	}
+	first := sort.Search(s3BucketSize, func(i int) bool {
+		return s3ObjectKey(i) > after
+	})
+	for i := first; i < s3BucketSize; i++ {
+		key := s3ObjectKey(i)
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if len(result.Contents) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		object := newSyntheticObject(bucket + "/" + key)
+		result.Contents = append(result.Contents, S3Object{
+			Key:          key,
+			LastModified: syntheticModTime,
+			ETag:         object.ETag(),
+			Size:         object.size,
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents)
+	if result.IsTruncated && len(result.Contents) > 0 {
+		last := result.Contents[len(result.Contents)-1].Key
+		if v2 {
+			result.NextContinuationToken = last
+		} else {
+			result.NextMarker = last
+		}
+	}
+	h.sendXML(w, r, result)
+}
+
+func (h *S3Handler) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	object := newSyntheticObject(bucket + "/" + key)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", object.ETag())
+	w.Header().Set("Accept-Ranges", "bytes")
+	h.logger.Debug(
+		"Serving S3 object",
+		slog.String("bucket", bucket),
+		slog.String("key", key),
+		slog.Int64("size", object.size),
+		slog.String("range", r.Header.Get("Range")),
+	)
+	http.ServeContent(w, r, key, syntheticModTime, object)
+}
+
+// sendXML sends the given document as the body of a successful response.
+func (h *S3Handler) sendXML(w http.ResponseWriter, r *http.Request, document any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, err := w.Write([]byte(xml.Header))
+	if err == nil {
+		err = xml.NewEncoder(w).Encode(document)
+	}
+	if err != nil {
+		h.logger.Error(
+			"Failed to send S3 response",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// sendError sends an error response in the format used by S3.
+func (h *S3Handler) sendError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, err := w.Write([]byte(xml.Header))
+	if err == nil {
+		err = xml.NewEncoder(w).Encode(&S3Error{
+			Code:     code,
+			Message:  message,
+			Resource: r.URL.Path,
+		})
+	}
+	if err != nil {
+		h.logger.Error(
+			"Failed to send S3 error",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// s3ObjectKey returns the key of the object with the given index in the listing of a bucket.
+func s3ObjectKey(i int) string {
+	return fmt.Sprintf("object-%05d", i)
+}
@@ -0,0 +1,458 @@
+package dummy
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Scenario is a named sequence of behavior changes, for example a window of time where requests fail, or where the
+// transfer rate is reduced. The steps are activated by time, for all clients, when the scenario is started. The
+// sequence is instead selected by each request with the 'scenario' query parameter, and it is advanced separately
+// for each client, for example to make the first three requests of each client fail.
+type Scenario struct {
+	Name     string             `json:"name"`
+	Steps    []ScenarioStep     `json:"steps,omitempty"`
+	Sequence []ScenarioSequence `json:"sequence,omitempty"`
+
+	// Repeat makes the sequence start again after the last request of the last element. Otherwise the last element
+	// is used for all the requests after the end of the sequence.
+	Repeat bool `json:"repeat,omitempty"`
+}
+
+// ScenarioSequence is an element of the sequence of a scenario, a behavior that is applied to a number of consecutive
+// requests of the same client.
+type ScenarioSequence struct {
+	// Count is the number of requests. Zero means all the remaining requests.
+	Count int `json:"count,omitempty"`
+
+	// Behavior is the behavior applied to the requests.
+	Behavior Behavior `json:"behavior"`
+}
+
+// ScenarioStep is a behavior that is activated some time after the scenario is started, and deactivated after some
+// more time.
+type ScenarioStep struct {
+	// After is the time from the start of the scenario to the activation of the behavior.
+	After Duration `json:"after,omitempty"`
+
+	// Duration is the time that the behavior stays active. When it is zero the behavior stays active till the
+	// scenario is stopped.
+	Duration Duration `json:"duration,omitempty"`
+
+	// Behavior is the behavior to activate.
+	Behavior Behavior `json:"behavior"`
+}
+
+// ScenarioAction is an action that has been scheduled as the result of starting or stopping a scenario.
+type ScenarioAction struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Step     int       `json:"step"`
+	Behavior *Behavior `json:"behavior,omitempty"`
+}
+
+// Name of the response header that contains the index of the element of the scenario sequence applied to the request.
+const scenarioStepHeader = "X-Dummy-Scenario-Step"
+
+// Maximum number of clients whose positions in the sequence of each scenario are remembered.
+const maxScenarioClients = 10000
+
+// Types of scenario actions:
+const (
+	scenarioActionApply  = "apply"
+	scenarioActionRevert = "revert"
+)
+
+// ScenarioManager knows how to start and stop scenarios, activating and deactivating the corresponding behaviors at
+// the right times.
+//
+// No more than ten thousand positions are kept for each scenario, and when that limit is reached the least recently
+// used one is forgotten, which moves that client back to the beginning of the sequence.
+type ScenarioManager struct {
+	logger    *slog.Logger
+	behaviors *BehaviorSet
+	lock      sync.Mutex
+	scenarios map[string]*Scenario
+	runs      map[string]*scenarioRun
+	counters  map[string]*scenarioCounters
+}
+
+// scenarioCounters contains the positions of the clients in the sequence of a scenario, indexed by client, and order
+// contains the same positions sorted by time of last use, the most recent first.
+type scenarioCounters struct {
+	positions map[string]*list.Element
+	order     *list.List
+}
+
+// scenarioPosition is the number of requests that a client has sent with a scenario.
+type scenarioPosition struct {
+	client string
+	count  int
+}
+
+// scenarioRun contains the state of a scenario that has been started.
+type scenarioRun struct {
+	timers  []*time.Timer
+	applied map[int]bool
+}
+
+// NewScenarioManager creates a new scenario manager that will activate the behaviors in the given set.
+func NewScenarioManager(logger *slog.Logger, behaviors *BehaviorSet) *ScenarioManager {
+	return &ScenarioManager{
+		logger:    logger,
+		behaviors: behaviors,
+		scenarios: map[string]*Scenario{},
+		runs:      map[string]*scenarioRun{},
+		counters:  map[string]*scenarioCounters{},
+	}
+}
+
+// Define adds or replaces the definition of a scenario, so that it can later be started using only the name. The
+// positions of the clients in the sequence are reset.
+func (m *ScenarioManager) Define(scenario *Scenario) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.scenarios[scenario.Name] = scenario
+	delete(m.counters, scenario.Name)
+}
+
+// Next returns the behavior for the next request of the given client in the sequence of the scenario, and the index
+// of the element of the sequence.
+func (m *ScenarioManager) Next(name, client string) (behavior Behavior, index int, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	scenario, ok := m.scenarios[name]
+	if !ok {
+		err = fmt.Errorf("scenario '%s' doesn't exist", name)
+		return
+	}
+	if len(scenario.Sequence) == 0 {
+		err = fmt.Errorf("scenario '%s' doesn't have a sequence", name)
+		return
+	}
+	counters, ok := m.counters[name]
+	if !ok {
+		counters = &scenarioCounters{
+			positions: map[string]*list.Element{},
+			order:     list.New(),
+		}
+		m.counters[name] = counters
+	}
+	position := counters.next(client)
+
+	// When the sequence repeats, and all the elements have a count, the position is relative to the start of the
+	// current repetition:
+	if scenario.Repeat {
+		total := 0
+		for _, element := range scenario.Sequence {
+			if element.Count == 0 {
+				total = 0
+				break
+			}
+			total += element.Count
+		}
+		if total > 0 {
+			position %= total
+		}
+	}
+	for index = range scenario.Sequence {
+		element := scenario.Sequence[index]
+		if element.Count == 0 || position < element.Count {
+			break
+		}
+		position -= element.Count
+	}
+	behavior = scenario.Sequence[index].Behavior
+	return
+}
+
+// next returns the number of requests that the client has already sent, and counts a new one. It must be called with
+// the lock of the manager held.
+func (c *scenarioCounters) next(client string) int {
+	var position *scenarioPosition
+	element := c.positions[client]
+	if element != nil {
+		position = element.Value.(*scenarioPosition)
+		c.order.MoveToFront(element)
+	} else {
+		if c.order.Len() >= maxScenarioClients {
+			forgotten := c.order.Remove(c.order.Back()).(*scenarioPosition)
+			delete(c.positions, forgotten.client)
+		}
+		position = &scenarioPosition{
+			client: client,
+		}
+		c.positions[client] = c.order.PushFront(position)
+	}
+	result := position.count
+	position.count++
+	return result
+}
+
+// Reset resets the positions of all the clients in the sequence of the given scenario.
+func (m *ScenarioManager) Reset(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.scenarios[name]
+	if !ok {
+		return fmt.Errorf("scenario '%s' doesn't exist", name)
+	}
+	delete(m.counters, name)
+	m.logger.Info(
+		"Reset scenario sequence",
+		slog.String("name", name),
+	)
+	return nil
+}
+
+// Start starts the scenario with the given name. If it is already running it will be stopped first. It returns the
+// list of actions that have been scheduled.
+func (m *ScenarioManager) Start(name string) (actions []ScenarioAction, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	scenario, ok := m.scenarios[name]
+	if !ok {
+		err = fmt.Errorf("scenario '%s' doesn't exist", name)
+		return
+	}
+	actions = m.stop(name)
+	run := &scenarioRun{
+		applied: map[int]bool{},
+	}
+	now := time.Now()
+	for i, step := range scenario.Steps {
+		index := i
+		behavior := step.Behavior
+		applyTime := now.Add(time.Duration(step.After))
+		run.timers = append(run.timers, time.AfterFunc(time.Duration(step.After), func() {
+			m.apply(name, run, index, behavior)
+		}))
+		actions = append(actions, ScenarioAction{
+			Time:     applyTime,
+			Type:     scenarioActionApply,
+			Step:     index,
+			Behavior: &behavior,
+		})
+		if step.Duration > 0 {
+			revertDelay := time.Duration(step.After) + time.Duration(step.Duration)
+			run.timers = append(run.timers, time.AfterFunc(revertDelay, func() {
+				m.revert(name, run, index)
+			}))
+			actions = append(actions, ScenarioAction{
+				Time: now.Add(revertDelay),
+				Type: scenarioActionRevert,
+				Step: index,
+			})
+		}
+	}
+	m.runs[name] = run
+	m.logger.Info(
+		"Started scenario",
+		slog.String("name", name),
+		slog.Int("steps", len(scenario.Steps)),
+	)
+	return
+}
+
+// Stop stops the scenario with the given name, cancelling the actions that are still pending and reverting the
+// behaviors that are active. It returns the list of revert actions that have been performed.
+func (m *ScenarioManager) Stop(name string) (actions []ScenarioAction, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.scenarios[name]
+	if !ok {
+		err = fmt.Errorf("scenario '%s' doesn't exist", name)
+		return
+	}
+	actions = m.stop(name)
+	m.logger.Info(
+		"Stopped scenario",
+		slog.String("name", name),
+	)
+	return
+}
+
+func (m *ScenarioManager) stop(name string) []ScenarioAction {
+	run, ok := m.runs[name]
+	if !ok {
+		return nil
+	}
+	delete(m.runs, name)
+	for _, timer := range run.timers {
+		timer.Stop()
+	}
+	var actions []ScenarioAction
+	now := time.Now()
+	for index := range run.applied {
+		m.behaviors.Clear(scenarioLayerName(name, index))
+		actions = append(actions, ScenarioAction{
+			Time: now,
+			Type: scenarioActionRevert,
+			Step: index,
+		})
+	}
+	return actions
+}
+
+func (m *ScenarioManager) apply(name string, run *scenarioRun, index int, behavior Behavior) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.runs[name] != run {
+		return
+	}
+	m.behaviors.Set(scenarioLayerName(name, index), behavior)
+	run.applied[index] = true
+	m.logger.Info(
+		"Applied scenario step",
+		slog.String("name", name),
+		slog.Int("step", index),
+		slog.Any("behavior", behavior),
+	)
+}
+
+func (m *ScenarioManager) revert(name string, run *scenarioRun, index int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.runs[name] != run {
+		return
+	}
+	m.behaviors.Clear(scenarioLayerName(name, index))
+	delete(run.applied, index)
+	m.logger.Info(
+		"Reverted scenario step",
+		slog.String("name", name),
+		slog.Int("step", index),
+	)
+}
+
+// validate checks that the steps and the sequence of the scenario are valid.
+func (s *Scenario) validate() error {
+	for i, step := range s.Steps {
+		if step.After < 0 || step.Duration < 0 {
+			return fmt.Errorf("times of step %d of scenario '%s' can't be negative", i, s.Name)
+		}
+		err := step.Behavior.Validate()
+		if err != nil {
+			return fmt.Errorf("behavior of step %d of scenario '%s' isn't valid: %w", i, s.Name, err)
+		}
+	}
+	for i, element := range s.Sequence {
+		if element.Count < 0 {
+			return fmt.Errorf("count of sequence element %d of scenario '%s' can't be negative", i, s.Name)
+		}
+		err := element.Behavior.Validate()
+		if err != nil {
+			return fmt.Errorf("behavior of sequence element %d of scenario '%s' isn't valid: %w", i, s.Name, err)
+		}
+	}
+	return nil
+}
+
+func scenarioLayerName(name string, index int) string {
+	return fmt.Sprintf("scenario/%s/%d", name, index)
+}
+
+// ScenarioTrigger is the body of the requests sent to the scenario trigger endpoint.
+type ScenarioTrigger struct {
+	// Name is the name of the scenario.
+	Name string `json:"name"`
+
+	// Action is 'start', 'stop' or 'reset'. The reset action moves all the clients to the beginning of the sequence.
+	Action string `json:"action"`
+
+	// Steps and Sequence optionally contain the steps and the sequence of the scenario. When present the scenario
+	// is defined or redefined before performing the action.
+	Steps    []ScenarioStep     `json:"steps,omitempty"`
+	Sequence []ScenarioSequence `json:"sequence,omitempty"`
+	Repeat   bool               `json:"repeat,omitempty"`
+}
+
+// ScenarioTriggerResult is the body of the responses of the scenario trigger endpoint.
+type ScenarioTriggerResult struct {
+	Name    string           `json:"name"`
+	Action  string           `json:"action"`
+	Actions []ScenarioAction `json:"actions"`
+}
+
+// ScenarioHandler is the HTTP handler that receives requests to start and stop scenarios, so that external systems,
+// like CI pipelines, can trigger them.
+type ScenarioHandler struct {
+	logger  *slog.Logger
+	manager *ScenarioManager
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *ScenarioHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Parse the request:
+	var trigger ScenarioTrigger
+	err := json.NewDecoder(r.Body).Decode(&trigger)
+	if err != nil {
+		h.logger.Error(
+			"Failed to parse scenario trigger",
+			slog.String("error", err.Error()),
+		)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if trigger.Name == "" {
+		http.Error(w, "scenario name is mandatory", http.StatusBadRequest)
+		return
+	}
+
+	// Define the scenario if the steps or the sequence have been provided:
+	if len(trigger.Steps) > 0 || len(trigger.Sequence) > 0 {
+		scenario := &Scenario{
+			Name:     trigger.Name,
+			Steps:    trigger.Steps,
+			Sequence: trigger.Sequence,
+			Repeat:   trigger.Repeat,
+		}
+		err = scenario.validate()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.manager.Define(scenario)
+	}
+
+	// Perform the action:
+	var actions []ScenarioAction
+	switch trigger.Action {
+	case "start":
+		actions, err = h.manager.Start(trigger.Name)
+	case "stop":
+		actions, err = h.manager.Stop(trigger.Name)
+	case "reset":
+		err = h.manager.Reset(trigger.Name)
+	default:
+		err = fmt.Errorf("action should be 'start', 'stop' or 'reset', but it is '%s'", trigger.Action)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Send the result:
+	if actions == nil {
+		actions = []ScenarioAction{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(ScenarioTriggerResult{
+		Name:    trigger.Name,
+		Action:  trigger.Action,
+		Actions: actions,
+	})
+	if err != nil {
+		h.logger.Error(
+			"Failed to send scenario trigger result",
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,52 @@
+package dummy
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestScenarioManagerCountersAreBounded(t *testing.T) {
+	manager := NewScenarioManager(slog.New(slog.NewTextHandler(io.Discard, nil)), &BehaviorSet{})
+	manager.Define(&Scenario{
+		Name: "flaky",
+		Sequence: []ScenarioSequence{
+			{
+				Count: 1,
+				Behavior: Behavior{
+					ErrorRate: 1,
+				},
+			},
+			{
+				Behavior: Behavior{},
+			},
+		},
+	})
+	for i := 0; i < maxScenarioClients+10; i++ {
+		_, index, err := manager.Next("flaky", fmt.Sprintf("client-%d", i))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if index != 0 {
+			t.Fatalf("expected the first request of client %d to use element 0, but got %d", i, index)
+		}
+	}
+	counters := manager.counters["flaky"]
+	if len(counters.positions) != maxScenarioClients || counters.order.Len() != maxScenarioClients {
+		t.Fatalf(
+			"expected %d positions, but got %d indexed and %d ordered",
+			maxScenarioClients, len(counters.positions), counters.order.Len(),
+		)
+	}
+
+	// The most recent client has advanced, but the least recently used ones have been moved back to the beginning:
+	_, index, _ := manager.Next("flaky", fmt.Sprintf("client-%d", maxScenarioClients+9))
+	if index != 1 {
+		t.Errorf("expected the most recent client to use element 1, but got %d", index)
+	}
+	_, index, _ = manager.Next("flaky", "client-0")
+	if index != 0 {
+		t.Errorf("expected the least recently used client to use element 0, but got %d", index)
+	}
+}
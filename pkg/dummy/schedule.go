@@ -0,0 +1,142 @@
+package dummy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule is a behavior that is activated periodically, at the times given by a cron expression, and that stays
+// active for some time. For example, to simulate a degradation window that starts every night at 2 AM and lasts one
+// hour:
+//
+//	{
+//	  "name": "nightly-degradation",
+//	  "cron": "0 2 * * *",
+//	  "duration": "1h",
+//	  "behavior": {
+//	    "latency": "500ms",
+//	    "rate": 1048576
+//	  }
+//	}
+type Schedule struct {
+	Name     string   `json:"name"`
+	Cron     string   `json:"cron"`
+	Duration Duration `json:"duration"`
+	Behavior Behavior `json:"behavior"`
+}
+
+// Scheduler activates and deactivates the behaviors of a set of schedules.
+type Scheduler struct {
+	logger    *slog.Logger
+	behaviors *BehaviorSet
+	entries   []*scheduleEntry
+}
+
+type scheduleEntry struct {
+	schedule Schedule
+	spec     cron.Schedule
+}
+
+// NewScheduler creates a scheduler for the given schedules. It returns an error if any of the cron expressions or
+// durations isn't valid.
+func NewScheduler(logger *slog.Logger, behaviors *BehaviorSet, schedules []Schedule) (result *Scheduler, err error) {
+	var entries []*scheduleEntry
+	names := map[string]bool{}
+	for i, schedule := range schedules {
+		if schedule.Name == "" {
+			err = fmt.Errorf("name of schedule %d is mandatory", i)
+			return
+		}
+		if names[schedule.Name] {
+			err = fmt.Errorf("schedule name '%s' is duplicated", schedule.Name)
+			return
+		}
+		names[schedule.Name] = true
+		if schedule.Duration <= 0 {
+			err = fmt.Errorf("duration of schedule '%s' should be positive", schedule.Name)
+			return
+		}
+		var spec cron.Schedule
+		spec, err = cron.ParseStandard(schedule.Cron)
+		if err != nil {
+			err = fmt.Errorf("cron expression '%s' of schedule '%s' isn't valid: %w", schedule.Cron,
+				schedule.Name, err)
+			return
+		}
+		entries = append(entries, &scheduleEntry{
+			schedule: schedule,
+			spec:     spec,
+		})
+	}
+	result = &Scheduler{
+		logger:    logger,
+		behaviors: behaviors,
+		entries:   entries,
+	}
+	return
+}
+
+// Start starts activating and deactivating the behaviors. It returns immediately, and the work continues in the
+// background till the context is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, entry := range s.entries {
+		go s.run(ctx, entry)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, entry *scheduleEntry) {
+	name := entry.schedule.Name
+	layer := "schedule/" + name
+	duration := time.Duration(entry.schedule.Duration)
+	defer s.behaviors.Clear(layer)
+	for {
+		// Find the next window. Note that we start looking at the current time minus the duration, so that if the
+		// server is started in the middle of a window the behavior is activated immediately.
+		now := time.Now()
+		start := entry.spec.Next(now.Add(-duration))
+		end := start.Add(duration)
+		s.logger.Info(
+			"Next schedule window",
+			slog.String("name", name),
+			slog.Time("start", start),
+			slog.Time("end", end),
+		)
+		if !sleepUntil(ctx, start) {
+			return
+		}
+		s.behaviors.Set(layer, entry.schedule.Behavior)
+		s.logger.Info(
+			"Activated schedule",
+			slog.String("name", name),
+			slog.Any("behavior", entry.schedule.Behavior),
+		)
+		if !sleepUntil(ctx, end) {
+			return
+		}
+		s.behaviors.Clear(layer)
+		s.logger.Info(
+			"Deactivated schedule",
+			slog.String("name", name),
+		)
+	}
+}
+
+// sleepUntil waits till the given time. It returns false if the context was cancelled before that.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	delay := time.Until(t)
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,162 @@
+package dummy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewScheduler(t *testing.T) {
+	tests := []struct {
+		name      string
+		schedules []Schedule
+		fail      string
+	}{
+		{
+			name: "Valid",
+			schedules: []Schedule{
+				{Name: "nightly", Cron: "0 2 * * *", Duration: Duration(time.Hour)},
+				{Name: "hourly", Cron: "@hourly", Duration: Duration(time.Minute)},
+				{Name: "zoned", Cron: "CRON_TZ=Europe/Madrid 30 8 * * 1-5", Duration: Duration(time.Minute)},
+			},
+		},
+		{
+			name: "Missing name",
+			schedules: []Schedule{
+				{Cron: "0 2 * * *", Duration: Duration(time.Hour)},
+			},
+			fail: "name of schedule 0 is mandatory",
+		},
+		{
+			name: "Duplicated name",
+			schedules: []Schedule{
+				{Name: "a", Cron: "0 2 * * *", Duration: Duration(time.Hour)},
+				{Name: "a", Cron: "0 3 * * *", Duration: Duration(time.Hour)},
+			},
+			fail: "schedule name 'a' is duplicated",
+		},
+		{
+			name: "Zero duration",
+			schedules: []Schedule{
+				{Name: "a", Cron: "0 2 * * *"},
+			},
+			fail: "duration of schedule 'a' should be positive",
+		},
+		{
+			name: "Seconds field",
+			schedules: []Schedule{
+				{Name: "a", Cron: "0 0 2 * * *", Duration: Duration(time.Hour)},
+			},
+			fail: "isn't valid",
+		},
+		{
+			name: "Out of range",
+			schedules: []Schedule{
+				{Name: "a", Cron: "0 25 * * *", Duration: Duration(time.Hour)},
+			},
+			fail: "isn't valid",
+		},
+		{
+			name: "Garbage",
+			schedules: []Schedule{
+				{Name: "a", Cron: "every night", Duration: Duration(time.Hour)},
+			},
+			fail: "isn't valid",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewScheduler(slog.New(slog.NewTextHandler(io.Discard, nil)), &BehaviorSet{}, test.schedules)
+			if test.fail != "" {
+				if err == nil || !strings.Contains(err.Error(), test.fail) {
+					t.Fatalf("expected an error containing '%s', but got: %v", test.fail, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSchedulerNextWindow(t *testing.T) {
+	scheduler, err := NewScheduler(slog.New(slog.NewTextHandler(io.Discard, nil)), &BehaviorSet{}, []Schedule{
+		{Name: "nightly", Cron: "0 2 * * *", Duration: Duration(time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	spec := scheduler.entries[0].spec
+	tests := []struct {
+		now      time.Time
+		expected time.Time
+	}{
+		{
+			now:      time.Date(2026, 1, 1, 1, 0, 0, 0, time.Local),
+			expected: time.Date(2026, 1, 1, 2, 0, 0, 0, time.Local),
+		},
+		{
+			now:      time.Date(2026, 1, 1, 2, 0, 0, 0, time.Local),
+			expected: time.Date(2026, 1, 2, 2, 0, 0, 0, time.Local),
+		},
+		{
+			now:      time.Date(2026, 12, 31, 23, 0, 0, 0, time.Local),
+			expected: time.Date(2027, 1, 1, 2, 0, 0, 0, time.Local),
+		},
+	}
+	for _, test := range tests {
+		actual := spec.Next(test.now)
+		if !actual.Equal(test.expected) {
+			t.Errorf("expected next window after %s at %s, but got %s", test.now, test.expected, actual)
+		}
+	}
+}
+
+func TestSchedulerActivatesCurrentWindow(t *testing.T) {
+	behaviors := &BehaviorSet{}
+	behavior := Behavior{
+		ErrorRate: 0.5,
+	}
+	scheduler, err := NewScheduler(slog.New(slog.NewTextHandler(io.Discard, nil)), behaviors, []Schedule{
+		{Name: "always", Cron: "* * * * *", Duration: Duration(2 * time.Minute), Behavior: behavior},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler.Start(ctx)
+
+	// The server is always inside a window, so the behavior should be activated immediately:
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		active, ok := behaviors.Get("schedule/always")
+		if ok {
+			if active.ErrorRate != behavior.ErrorRate {
+				t.Errorf("expected error rate %g, but got %g", behavior.ErrorRate, active.ErrorRate)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("behavior wasn't activated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Cancelling the context should deactivate it:
+	cancel()
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		_, ok := behaviors.Get("schedule/always")
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("behavior wasn't deactivated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,860 @@
+// Package dummy contains the handlers, data sources and middleware of the dummy server, so that it can be embedded in
+// other programs, for example in integration tests. Use the NewServer function to create a server and then use its
+// handler directly or call the ListenAndServe method.
+package dummy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Default listen address:
+const (
+	DefaultListenAddress = ":8443"
+)
+
+// Default server timeouts:
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultIdleTimeout       = 5 * time.Minute
+)
+
+// Options contains the settings used to create a server. Only the logger is usually needed, the rest of the fields
+// have defaults suitable for tests.
+type Options struct {
+	// Logger is the logger used by the server. The default is to discard the log.
+	Logger *slog.Logger
+
+	// Config is the configuration of the server, usually loaded from a file with the LoadConfig function. When nil
+	// the default configuration is used.
+	Config *Config
+
+	// Identity is the identity of the instance that is added to the responses. The default is the identity loaded
+	// from the environment with the LoadIdentity function.
+	Identity *Identity
+
+	// Headers are extra headers added to all the responses of the data endpoint.
+	Headers http.Header
+
+	// RandomSource is the name of the source of random data. The default is 'urandom' on Unix like systems and
+	// 'crypto' on the rest.
+	RandomSource string
+
+	// RandomFile and RandomFileSize are the file and size used by the 'mmap' random source. The default file is the
+	// one returned by DefaultRandomFile, and the default size is the size of the existing file, or 1 GiB.
+	RandomFile     string
+	RandomFileSize int64
+
+	// ServeDir is a directory containing real files that are served in the '/files/' path. When empty that path
+	// isn't available.
+	ServeDir string
+
+	// PinConnections is the way to pin the connections to processors, 'cpu' to assign each connection to one
+	// processor in round robin, or 'node' to assign it to one NUMA node. The default is to not pin connections.
+	// Pinning is only a hint for the runtime, and it is only supported in Linux.
+	PinConnections string
+
+	// User is the name or identifier of the user that the process switches to after opening the listeners, so that
+	// it can listen in privileged ports without serving requests as root. Group is the group, the primary group of
+	// the user by default.
+	User  string
+	Group string
+
+	// AllowRoot allows serving requests as root. Otherwise the server refuses to start when it runs as root and
+	// there is no user to switch to.
+	AllowRoot bool
+
+	// RawListeners are the raw TCP and UDP listeners opened by the ListenAndServe method together with the HTTP
+	// ones. Listeners without address are ignored.
+	RawListeners []RawListener
+
+	// DatagramSize, UDPDuration and UDPRate are the size of the datagrams, and the duration and the rate in bytes
+	// per second of the bursts sent by the raw UDP listeners.
+	DatagramSize int
+	UDPDuration  time.Duration
+	UDPRate      int64
+
+	// UDPImpairment is the synthetic loss, reordering and duplication applied to the datagrams sent and received
+	// by the raw UDP listeners. The default is no impairment.
+	UDPImpairment UDPImpairment
+
+	// ReadHeaderTimeout, IdleTimeout and WriteTimeout are the timeouts of the HTTP servers started by the
+	// ListenAndServe method. Zero means no limit.
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+	WriteTimeout      time.Duration
+
+	// AdminToken is the bearer token required by the administration endpoints: '/scenario/trigger' and the ones
+	// under '/admin/'. When empty those endpoints are disabled.
+	AdminToken string
+
+	// Registerer and Gatherer are used to register the metrics of the server and to serve them in the '/metrics'
+	// path. When both are nil a new registry is used for both, so that several servers can be created in the same
+	// process.
+	Registerer prometheus.Registerer
+	Gatherer   prometheus.Gatherer
+}
+
+// Server contains the handlers, data sources and middleware of the dummy server. The handler returned by the Handler
+// method can be used directly, for example with the httptest package, or the server can open the listeners of the
+// configuration with the ListenAndServe method.
+type Server struct {
+	logger      *slog.Logger
+	config      *Config
+	options     Options
+	listeners   []ListenerConfig
+	handler     http.Handler
+	stats       *Stats
+	patternsDir string
+	history     *History
+	exporters   []*Exporter
+	proxy       *Proxy
+	raw         *rawListeners
+	cancel      context.CancelFunc
+	credentials *credentials
+	lock        sync.Mutex
+	open        []net.Listener
+}
+
+// NewServer creates a server with the given options. The server should be closed when no longer needed, to stop the
+// scheduler and remove the temporary files.
+func NewServer(options Options) (result *Server, err error) {
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	config := options.Config
+	if config == nil {
+		config = &Config{}
+	}
+	randomSourceName := options.RandomSource
+	if randomSourceName == "" {
+		randomSourceName = DefaultRandomSource
+	}
+	datagramSize := options.DatagramSize
+	if datagramSize == 0 {
+		datagramSize = DefaultDatagramSize
+	}
+	udpDuration := options.UDPDuration
+	if udpDuration == 0 {
+		udpDuration = DefaultUDPDuration
+	}
+	udpRate := options.UDPRate
+	if udpRate == 0 {
+		udpRate = DefaultUDPRate
+	}
+	credentials, err := lookupCredentials(options.User, options.Group)
+	if err != nil {
+		return
+	}
+	var identity Identity
+	if options.Identity != nil {
+		identity = *options.Identity
+	} else {
+		identity = LoadIdentity()
+	}
+	logger.Info(
+		"Loaded identity",
+		identity.LogAttr(),
+	)
+	registerer := options.Registerer
+	gatherer := options.Gatherer
+	if registerer == nil && gatherer == nil {
+		registry := prometheus.NewRegistry()
+		registerer = registry
+		gatherer = registry
+	}
+
+	// When running in a pod add the identity of the pod to the labels of the metrics of the server:
+	if identity.InPod() && registerer != nil {
+		registerer = prometheus.WrapRegistererWith(identity.Labels(), registerer)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var patternsDir string
+	var history *History
+	var proxy *Proxy
+	var exporters []*Exporter
+	defer func() {
+		if err != nil {
+			cancel()
+			for _, exporter := range exporters {
+				if exporter != nil {
+					exporter.Close()
+				}
+			}
+			history.Close()
+			proxy.Close()
+			if patternsDir != "" {
+				os.RemoveAll(patternsDir)
+			}
+		}
+	}()
+
+	// Create the set of simulated behaviors and the manager that activates them when scenarios are triggered. The
+	// scenarios from the configuration are defined in advance, so that they can be triggered using only the name.
+	behaviors := &BehaviorSet{}
+	scenarios := NewScenarioManager(logger, behaviors)
+	for i := range config.Scenarios {
+		scenarios.Define(&config.Scenarios[i])
+	}
+	if config.Chaos != nil {
+		behaviors.Set(chaosLayer, *config.Chaos)
+	}
+
+	// Start the scheduler that activates the behaviors periodically:
+	scheduler, err := NewScheduler(logger, behaviors, config.Schedules)
+	if err != nil {
+		err = fmt.Errorf("failed to create scheduler: %w", err)
+		return
+	}
+	scheduler.Start(ctx)
+
+	// Create the set of per client overrides:
+	overrides, err := NewOverrideSet(config.Overrides)
+	if err != nil {
+		err = fmt.Errorf("failed to create overrides: %w", err)
+		return
+	}
+
+	// Create the source of random data:
+	var random RandomSource
+	if randomSourceName == randomSourceMmap {
+		random, err = NewMmapRandomSource(options.RandomFile, options.RandomFileSize)
+	} else {
+		random, err = NewRandomSource(randomSourceName)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to create random source '%s': %w", randomSourceName, err)
+		return
+	}
+	logger.Info(
+		"Created random source",
+		slog.String("source", randomSourceName),
+	)
+
+	// Create the store for the blobs of the deterministic data patterns:
+	patternsDir, err = os.MkdirTemp("", ".patterns")
+	if err != nil {
+		err = fmt.Errorf("failed to create temporary patterns directory: %w", err)
+		return
+	}
+	patterns := NewPatternStore(logger, patternsDir)
+
+	// Create the pool of data buffers:
+	buffers, err := NewBufferPool(registerer)
+	if err != nil {
+		err = fmt.Errorf("failed to create buffer pool: %w", err)
+		return
+	}
+
+	// Create the session manager:
+	var sessionsConfig SessionsConfig
+	if config.Sessions != nil {
+		sessionsConfig = *config.Sessions
+	}
+	sessions, err := NewSessionManager(logger, sessionsConfig, registerer)
+	if err != nil {
+		err = fmt.Errorf("failed to create session manager: %w", err)
+		return
+	}
+
+	// Write the processor topology to the log, and prepare the pinning of connections:
+	topology, err := LoadCPUTopology()
+	if err != nil {
+		err = fmt.Errorf("failed to load processor topology: %w", err)
+		return
+	}
+	logger.Info("Loaded processor topology", topology.LogAttrs()...)
+	pinner, err := newCPUPinner(options.PinConnections, topology)
+	if err != nil {
+		err = fmt.Errorf("failed to prepare pinning of connections: %w", err)
+		return
+	}
+
+	// Prepare the raw TCP and UDP listeners, they are opened by the ListenAndServe method:
+	raw, err := newRawListeners(logger, random, buffers, options.RawListeners, datagramSize, udpDuration, udpRate,
+		options.UDPImpairment, registerer, pinner)
+	if err != nil {
+		err = fmt.Errorf("failed to create raw listeners: %w", err)
+		return
+	}
+
+	// Create the handlers:
+	zones, err := NewZoneEmulator(identity.Zone, config.Zones)
+	if err != nil {
+		err = fmt.Errorf("failed to create zone emulator: %w", err)
+		return
+	}
+	var logHeaders bool
+	var logProgress time.Duration
+	if config.Logging != nil {
+		logHeaders = config.Logging.Headers
+		logProgress = time.Duration(config.Logging.Progress)
+	}
+	if config.Limits != nil {
+		err = config.Limits.validate()
+		if err != nil {
+			err = fmt.Errorf("limits aren't valid: %w", err)
+			return
+		}
+	}
+	limits := config.Limits.withDefaults()
+	stats := NewStats()
+	chunkLatencies := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "dummy_chunk_write_duration_seconds",
+		Help:    "Duration of the writes of the data endpoint, for the requests that enable it with 'chunk_latency'.",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+	err = registerer.Register(chunkLatencies)
+	if err != nil {
+		err = fmt.Errorf("failed to register chunk latency metric: %w", err)
+		return
+	}
+	handler := &Handler{
+		logger:     logger,
+		identity:   identity,
+		headers:    options.Headers,
+		behaviors:  behaviors,
+		scenarios:  scenarios,
+		sessions:   sessions,
+		throttles:  NewThrottleManager(),
+		overrides:  overrides,
+		zones:      zones,
+		random:     random,
+		patterns:   patterns,
+		buffers:    buffers,
+		limits:     limits,
+		logHeaders: logHeaders,
+		progress:   logProgress,
+		strict:     config.Strict,
+		templates:  config.Templates,
+		stats:      stats,
+		latencies:  chunkLatencies,
+	}
+	scenarioHandler := &ScenarioHandler{
+		logger:  logger,
+		manager: scenarios,
+	}
+	eventsHandler := &EventsHandler{
+		logger:   logger,
+		identity: identity,
+	}
+	webSocketEchoHandler := &WebSocketEchoHandler{
+		logger:   logger,
+		identity: identity,
+	}
+	webSocketDataHandler := &WebSocketDataHandler{
+		logger:   logger,
+		identity: identity,
+		random:   random,
+		stats:    stats,
+	}
+	grpcHandler := &GRPCHandler{
+		logger:   logger,
+		identity: identity,
+		random:   random,
+		patterns: patterns,
+		stats:    stats,
+	}
+	delayHandler := &DelayHandler{
+		logger:   logger,
+		identity: identity,
+	}
+	objectsHandler := &ObjectsHandler{
+		logger:   logger,
+		identity: identity,
+	}
+	s3Handler := &S3Handler{
+		logger:   logger,
+		identity: identity,
+	}
+	redirectHandler := &RedirectHandler{
+		logger:   logger,
+		identity: identity,
+	}
+	slowReadHandler := &SlowReadHandler{
+		logger:   logger,
+		identity: identity,
+	}
+	uiHandler := &UIHandler{
+		logger: logger,
+		data:   handler,
+	}
+	uploadHandler := &UploadHandler{
+		logger:   logger,
+		identity: identity,
+		buffers:  buffers,
+		stats:    stats,
+	}
+	pingHandler := &PingHandler{
+		logger:   logger,
+		identity: identity,
+	}
+	clockHandler := &ClockHandler{
+		logger:   logger,
+		identity: identity,
+	}
+	archiveHandler := &ArchiveHandler{
+		logger:   logger,
+		identity: identity,
+		buffers:  buffers,
+	}
+	registryHandler := NewRegistryHandler(logger, identity, buffers, stats)
+	mediaHandler := &MediaHandler{
+		logger:   logger,
+		identity: identity,
+	}
+	resumeHandler := &ResumeHandler{
+		logger:   logger,
+		identity: identity,
+		buffers:  buffers,
+		stats:    stats,
+	}
+	chaosHandler := &ChaosHandler{
+		logger:    logger,
+		behaviors: behaviors,
+	}
+	statsHandler := &StatsHandler{
+		logger: logger,
+		stats:  stats,
+	}
+	connectionsHandler := &ConnectionsHandler{
+		logger: logger,
+		stats:  stats,
+	}
+	mux := NewRouter()
+	mux.Handle("/", uiHandler)
+	mux.Handle("GET /ui", uiHandler)
+	mux.Handle("POST /upload", uploadHandler)
+	mux.Handle("GET /events", eventsHandler)
+	mux.Handle("GET /ping", pingHandler)
+	mux.Handle("GET /clock", clockHandler)
+	mux.Handle("GET /delay/{duration}", delayHandler)
+	mux.Handle("GET /redirect/{n}", redirectHandler)
+	mux.Handle("POST /slow/read", slowReadHandler)
+	mux.Handle("GET /objects/{name}", objectsHandler)
+	mux.Handle(s3Prefix, s3Handler)
+	mux.Handle("GET /archive", archiveHandler)
+	mux.Handle("GET /resume", resumeHandler)
+	mux.Handle("GET /resume/{token}", resumeHandler)
+	mux.Handle(registryPrefix, registryHandler)
+	mux.Handle("GET /media/{protocol}/{file}", mediaHandler)
+	mux.Handle("GET /media/{protocol}/{rendition}/{file}", mediaHandler)
+	mux.Handle("GET /ws/echo", webSocketEchoHandler)
+	mux.Handle("GET /ws/data", webSocketDataHandler)
+	mux.Handle("POST "+grpcServicePath, grpcHandler)
+	admin := func(handler http.Handler) http.Handler {
+		return &AdminHandler{
+			logger:  logger,
+			handler: handler,
+			token:   options.AdminToken,
+		}
+	}
+	mux.Handle("POST /scenario/trigger", admin(scenarioHandler))
+	mux.Handle("/admin/chaos", admin(chaosHandler))
+	mux.Handle("GET /metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	mux.Handle("GET /stats", statsHandler)
+	mux.Handle("GET /debug/connections", connectionsHandler)
+	mux.Handle("DELETE /admin/transfers/{id}", admin(connectionsHandler))
+	if options.ServeDir != "" {
+		var filesHandler http.Handler
+		filesHandler, err = NewFilesHandler(logger, identity, options.ServeDir)
+		if err != nil {
+			err = fmt.Errorf("failed to create files handler for directory '%s': %w", options.ServeDir, err)
+			return
+		}
+		mux.Handle("GET "+FilesPrefix, filesHandler)
+	}
+
+	// Use the listeners from the configuration, or else a single listener with the default settings:
+	listeners := config.Listeners
+	if len(listeners) == 0 {
+		listeners = []ListenerConfig{{
+			Name:    "default",
+			Address: DefaultListenAddress,
+			TLS:     &ListenerTLSConfig{},
+		}}
+	}
+
+	// Add the fleet handler, and start announcing the server to its peers:
+	fleet, err := NewFleet(logger, identity, listeners, config.Fleet)
+	if err != nil {
+		err = fmt.Errorf("failed to create fleet: %w", err)
+		return
+	}
+	fleet.Start(ctx)
+	mux.Handle("GET "+FleetPath, fleet)
+	if config.Fleet.accepting() {
+		mux.Handle("POST "+FleetPath, fleet)
+	}
+	var meshConfig *MeshConfig
+	if config.Fleet != nil {
+		meshConfig = config.Fleet.Mesh
+	}
+	mesh, err := NewMesh(logger, fleet, meshConfig, registerer)
+	if err != nil {
+		err = fmt.Errorf("failed to create mesh: %w", err)
+		return
+	}
+	mesh.Start(ctx)
+	mux.Handle("GET "+MeshPath, mesh)
+
+	// Open the database where the results are recorded, if enabled, and add the endpoints that query it:
+	if config.History != nil {
+		history, err = NewHistory(ctx, logger, config.History)
+		if err != nil {
+			err = fmt.Errorf("failed to create history: %w", err)
+			return
+		}
+		stats.recorders = append(stats.recorders, history)
+		mux.Handle("GET "+HistoryPath, history)
+		mux.Handle(GrafanaPrefix, NewGrafanaHandler(logger, history))
+	}
+
+	// Add the proxy that forwards, records or replays the exchanges with a real server:
+	if config.Proxy != nil {
+		proxy, err = NewProxy(logger, *config.Proxy, behaviors)
+		if err != nil {
+			err = fmt.Errorf("failed to create proxy: %w", err)
+			return
+		}
+		mux.Handle(proxy.Prefix(), proxy)
+	}
+
+	// Create the exporters that push the results to external databases:
+	exporters = make([]*Exporter, len(config.Exporters))
+	for i, exporterConfig := range config.Exporters {
+		exporters[i], err = NewExporter(ctx, logger, identity, exporterConfig)
+		if err != nil {
+			err = fmt.Errorf("failed to create exporter %d: %w", i, err)
+			return
+		}
+		stats.recorders = append(stats.recorders, exporters[i])
+	}
+
+	// Start the background probes, and add their results to the statistics. Alerts are sent to the webhooks, if there
+	// are any:
+	var notifier *Notifier
+	if len(config.Webhooks) > 0 {
+		notifier, err = NewNotifier(logger, identity, config.Webhooks)
+		if err != nil {
+			err = fmt.Errorf("failed to create webhooks: %w", err)
+			return
+		}
+	}
+	prober, err := NewProber(logger, config.Probes, notifier, stats.recorders, registerer)
+	if err != nil {
+		err = fmt.Errorf("failed to create probes: %w", err)
+		return
+	}
+	err = prober.Start(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to start probes: %w", err)
+		return
+	}
+	stats.probes = prober
+
+	// Add the capabilities handler, which needs to be last so that it can report all the other endpoints:
+	capabilities := newCapabilities()
+	capabilities.Instance = identity.Instance
+	capabilities.RandomSource = randomSourceName
+	if !config.Templates {
+		capabilities.Sources = slices.DeleteFunc(capabilities.Sources, func(name string) bool {
+			return name == sourceTemplate
+		})
+	}
+	capabilities.Limits.DefaultSize = limits.DefaultSize
+	capabilities.Limits.DefaultBuffer = limits.DefaultBufferSize
+	capabilities.Limits.MaxSize = limits.MaxSize
+	capabilities.Limits.MaxBuffer = limits.MaxBufferSize
+	capabilities.Limits.MaxBytes = limits.MaxBytesPerRequest
+	capabilities.Limits.MaxDuration = limits.MaxDuration
+	capabilities.Protocols = []string{"http/1.1", "h2", "websocket", "sse", "grpc", "hls", "dash"}
+	for _, listenerConfig := range listeners {
+		if listenerConfig.Multiplex || listenerConfig.TLS == nil {
+			capabilities.Protocols = append(capabilities.Protocols, "h2c")
+			break
+		}
+	}
+	capabilities.Protocols = append(capabilities.Protocols, raw.protocols()...)
+	for _, listenerConfig := range listeners {
+		if listenerConfig.Raw != "" && !slices.Contains(capabilities.Protocols, "tcp-"+listenerConfig.Raw) {
+			capabilities.Protocols = append(capabilities.Protocols, "tcp-"+listenerConfig.Raw)
+		}
+	}
+	capabilitiesHandler := &CapabilitiesHandler{
+		logger:       logger,
+		capabilities: capabilities,
+	}
+	mux.Handle("GET /capabilities", capabilitiesHandler)
+	capabilities.Endpoints = mux.Patterns()
+
+	// Put the mock routes in front of the rest of the endpoints:
+	var routes RouteHandler = mux
+	if len(config.Mocks) > 0 {
+		var mocks *MockHandler
+		mocks, err = NewMockHandler(logger, config.Mocks, mux, registerer)
+		if err != nil {
+			err = fmt.Errorf("failed to create mock routes: %w", err)
+			return
+		}
+		capabilities.Endpoints = append(capabilities.Endpoints, mocks.Patterns()...)
+		routes = mocks
+	}
+
+	// Add the statistics, the per request limits, the quotas and the CORS policy:
+	var quotasConfig QuotasConfig
+	if config.Quotas != nil {
+		quotasConfig = *config.Quotas
+	}
+	truncateHandler := NewTruncateHandler(logger, stats.Wrap(routes), limits)
+	quotaHandler, err := NewQuotaHandler(logger, truncateHandler, quotasConfig, registerer)
+	if err != nil {
+		err = fmt.Errorf("failed to create quota handler: %w", err)
+		return
+	}
+	var corsConfig CORSConfig
+	if config.CORS != nil {
+		corsConfig = *config.CORS
+	}
+	corsHandler, err := NewCORSHandler(quotaHandler, corsConfig)
+	if err != nil {
+		err = fmt.Errorf("failed to create CORS handler: %w", err)
+		return
+	}
+
+	// Add the summary records, outside of everything else so that they include the rejected requests:
+	var summaryOutput string
+	if config.Logging != nil {
+		summaryOutput = config.Logging.Summary
+	}
+	rootHandler, err := NewSummaryHandler(logger, corsHandler, summaryOutput)
+	if err != nil {
+		err = fmt.Errorf("failed to create summary handler: %w", err)
+		return
+	}
+
+	result = &Server{
+		logger:      logger,
+		config:      config,
+		options:     options,
+		listeners:   listeners,
+		handler:     pinner.wrap(rootHandler),
+		stats:       stats,
+		patternsDir: patternsDir,
+		history:     history,
+		exporters:   exporters,
+		proxy:       proxy,
+		raw:         raw,
+		cancel:      cancel,
+		credentials: credentials,
+	}
+	return
+}
+
+// Handler returns the HTTP handler that serves all the endpoints of the server.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Stats returns the statistics of the requests and connections served.
+func (s *Server) Stats() *Stats {
+	return s.stats
+}
+
+// ListenAndServe opens the listeners of the configuration, or the default one if there are none, and serves the
+// requests till one of them fails.
+func (s *Server) ListenAndServe() error {
+	// Refuse to serve as root unless the privileges will be dropped, or running as root was explicitly allowed:
+	if s.credentials == nil && !s.options.AllowRoot && runningAsRoot() {
+		return errRunningAsRoot
+	}
+
+	// Use the TLS certificate and key from the configuration, or the ones of the mounted TLS secret, or else create
+	// temporary files for the built-in ones:
+	var tlsCrtFile, tlsKeyFile string
+	var err error
+	mountedCrtFile, mountedKeyFile, mounted := findMountedTLSFiles()
+	if s.config.TLS != nil && s.config.TLS.CertFile != "" {
+		tlsCrtFile = s.config.TLS.CertFile
+		tlsKeyFile = s.config.TLS.KeyFile
+	} else if mounted {
+		tlsCrtFile = mountedCrtFile
+		tlsKeyFile = mountedKeyFile
+		s.logger.Info(
+			"Using mounted TLS certificate",
+			slog.String("crt", tlsCrtFile),
+			slog.String("key", tlsKeyFile),
+		)
+	} else {
+		tlsCrtFile, tlsKeyFile, err = writeBuiltinTLSFiles()
+		if err != nil {
+			return fmt.Errorf("failed to create TLS files: %w", err)
+		}
+	}
+
+	// Open the listeners before starting to serve, so that configuration errors are detected early:
+	listeners := make([]net.Listener, len(s.listeners))
+	for i, listenerConfig := range s.listeners {
+		listeners[i], err = openListener(s.logger, listenerConfig)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to listen with '%s' in address '%s': %w",
+				listenerConfig.Name, listenerConfig.Address, err,
+			)
+		}
+	}
+
+	s.lock.Lock()
+	s.open = listeners
+	s.lock.Unlock()
+
+	// Start the raw TCP and UDP listeners, also before dropping privileges as they may use privileged ports:
+	err = s.raw.start()
+	if err != nil {
+		return err
+	}
+
+	// Load the TLS certificates and keys now, as they may not be readable once the privileges are dropped:
+	tlsConfigs := make([]*tls.Config, len(listeners))
+	for i, listenerConfig := range s.listeners {
+		tlsConfigs[i], err = newListenerTLSConfig(s.logger, listenerConfig, tlsCrtFile, tlsKeyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Switch to the unprivileged user, if there is one. The temporary directory of the patterns and the history
+	// database were created with the privileged user, so they have to be given to the new one.
+	if s.credentials != nil {
+		owned := []string{s.patternsDir}
+		if s.history != nil {
+			owned = append(owned, s.history.files()...)
+		}
+		err = dropPrivileges(s.credentials, owned)
+		if err != nil {
+			return fmt.Errorf("failed to drop privileges: %w", err)
+		}
+		s.logger.Info(
+			"Dropped privileges",
+			slog.String("user", s.credentials.user),
+			slog.Int("uid", s.credentials.uid),
+			slog.Int("gid", s.credentials.gid),
+		)
+	}
+
+	// Tell systemd that the server is ready, if it was started by systemd. The listeners are already open, so
+	// connections are queued even if the servers haven't started yet.
+	s.notifySystemd("READY=1")
+
+	// Start the servers, and wait till one of them fails:
+	serverOptions := ServerOptions{
+		ConnState:         s.stats.ConnState,
+		ReadHeaderTimeout: s.options.ReadHeaderTimeout,
+		IdleTimeout:       s.options.IdleTimeout,
+		WriteTimeout:      s.options.WriteTimeout,
+	}
+	s.logger.Info(
+		"Server timeouts",
+		slog.String("read_header", serverOptions.ReadHeaderTimeout.String()),
+		slog.String("idle", serverOptions.IdleTimeout.String()),
+		slog.String("write", serverOptions.WriteTimeout.String()),
+	)
+	errs := make(chan error, len(listeners))
+	for i, listener := range listeners {
+		go func() {
+			errs <- serveListener(
+				s.logger, s.listeners[i], listener, tlsConfigs[i], s.handler, s.raw, serverOptions,
+			)
+		}()
+	}
+	return <-errs
+}
+
+// Shutdown tells systemd that the server is stopping, closes the listeners and the raw listeners so that no new
+// connections are accepted, and waits till the requests in progress finish or the context is done. With systemd socket
+// activation the sockets stay open in systemd, so the connections are queued for the next instance of the server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.notifySystemd("STOPPING=1")
+	s.lock.Lock()
+	listeners := s.open
+	s.open = nil
+	s.lock.Unlock()
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	s.raw.close()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		active := s.stats.activeRequests.Load()
+		if active == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d requests are still in progress: %w", active, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// notifySystemd sends the given state to systemd, writing the result to the log.
+func (s *Server) notifySystemd(state string) {
+	sent, err := notifySystemd(state)
+	if err != nil {
+		s.logger.Warn(
+			"Failed to notify systemd",
+			slog.String("state", state),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if sent {
+		s.logger.Info(
+			"Notified systemd",
+			slog.String("state", state),
+		)
+	}
+}
+
+// Close stops the scheduler and the raw listeners, pushes the pending results of the exporters, closes the history
+// database and the file of the proxy, and removes the temporary files created by the server. A failure doesn't stop
+// the rest of the cleanup, and all the failures are returned together.
+func (s *Server) Close() error {
+	s.cancel()
+	s.raw.close()
+	var errs []error
+	for i, exporter := range s.exporters {
+		err := exporter.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to close exporter %d: %w", i, err))
+		}
+	}
+	err := s.history.Close()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to close history: %w", err))
+	}
+	err = s.proxy.Close()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to close proxy: %w", err))
+	}
+	err = os.RemoveAll(s.patternsDir)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove patterns: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package dummy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// failingExportWriter is an export writer that fails to close.
+type failingExportWriter struct {
+	err error
+}
+
+func (w *failingExportWriter) write(ctx context.Context, batch []any) error {
+	return nil
+}
+
+func (w *failingExportWriter) close() error {
+	return w.err
+}
+
+func TestServerCloseContinuesAfterFailures(t *testing.T) {
+	patternsDir := t.TempDir()
+	first := errors.New("first exporter failed")
+	second := errors.New("second exporter failed")
+	var exporters []*Exporter
+	for _, err := range []error{first, second} {
+		done := make(chan struct{})
+		close(done)
+		exporters = append(exporters, &Exporter{
+			writer: &failingExportWriter{
+				err: err,
+			},
+			done: done,
+		})
+	}
+	_, cancel := context.WithCancel(context.Background())
+	server := &Server{
+		patternsDir: patternsDir,
+		exporters:   exporters,
+		raw:         &rawListeners{},
+		cancel:      cancel,
+	}
+	err := server.Close()
+	if !errors.Is(err, first) || !errors.Is(err, second) {
+		t.Fatalf("expected the errors of both exporters, but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "failed to close exporter 1") {
+		t.Errorf("expected the error to identify the exporter, but got %v", err)
+	}
+	_, err = os.Stat(patternsDir)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected the patterns directory to be removed, but got %v", err)
+	}
+}
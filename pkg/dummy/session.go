@@ -0,0 +1,244 @@
+package dummy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Modes of the session simulation:
+const (
+	SessionModeOff     = "off"
+	SessionModeSet     = "set"
+	SessionModeRequire = "require"
+)
+
+// Results of the lookup of the session of a request:
+const (
+	sessionResultNew  = "new"
+	sessionResultHit  = "hit"
+	sessionResultMiss = "miss"
+)
+
+// Name of the session cookie, and of the response header that contains the result of the lookup of the session.
+const (
+	sessionCookie = "dummy_session"
+	sessionHeader = "X-Dummy-Session"
+)
+
+// Default time after which idle sessions are discarded.
+const defaultSessionTTL = 30 * time.Minute
+
+// SessionsConfig contains the settings of the session simulation.
+type SessionsConfig struct {
+	// Mode is 'off' (the default), 'set' or 'require'. In 'set' mode the server sets the session cookie when the
+	// request doesn't have it, or when it has a session that this instance doesn't know, for example because it was
+	// created by another instance. In 'require' mode the requests with unknown sessions are rejected with the 421
+	// status code, so that broken sticky sessions are detected by the client.
+	Mode string `json:"mode,omitempty"`
+
+	// Quota is the total number of bytes that a session can download. Zero means no limit.
+	Quota int64 `json:"quota,omitempty"`
+
+	// TTL is the time after which idle sessions are discarded. The default is 30 minutes.
+	TTL Duration `json:"ttl,omitempty"`
+}
+
+// validate checks that the session settings are valid.
+func (c *SessionsConfig) validate() error {
+	switch c.Mode {
+	case "", SessionModeOff, SessionModeSet, SessionModeRequire:
+	default:
+		return fmt.Errorf(
+			"session mode should be '%s', '%s' or '%s', but it is '%s'",
+			SessionModeOff, SessionModeSet, SessionModeRequire, c.Mode,
+		)
+	}
+	if c.Quota < 0 {
+		return fmt.Errorf("session quota %d is negative", c.Quota)
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("session TTL %s is negative", time.Duration(c.TTL))
+	}
+	return nil
+}
+
+// Session is the state of a client session.
+type Session struct {
+	ID       string
+	created  time.Time
+	lastSeen time.Time
+	requests int
+	bytes    int64
+}
+
+// SessionManager tracks the sessions of the clients, identified by a cookie, so that sticky session configurations
+// of load balancers can be verified, and so that the behavior of the server can depend on the session.
+type SessionManager struct {
+	logger   *slog.Logger
+	mode     string
+	quota    int64
+	ttl      time.Duration
+	lock     sync.Mutex
+	sessions map[string]*Session
+	swept    time.Time
+	requests *prometheus.CounterVec
+	active   prometheus.Gauge
+}
+
+// NewSessionManager creates a session manager with the given configuration, and registers its metrics with the given
+// registerer.
+func NewSessionManager(logger *slog.Logger, config SessionsConfig,
+	registerer prometheus.Registerer) (result *SessionManager, err error) {
+	err = config.validate()
+	if err != nil {
+		return
+	}
+	requests := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dummy_session_requests_total",
+			Help: "Number of requests by result of the session lookup, 'new', 'hit' or 'miss'.",
+		},
+		[]string{"result"},
+	)
+	active := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "dummy_sessions",
+			Help: "Number of sessions known by this instance.",
+		},
+	)
+	for _, collector := range []prometheus.Collector{requests, active} {
+		err = registerer.Register(collector)
+		if err != nil {
+			return
+		}
+	}
+	mode := config.Mode
+	if mode == "" {
+		mode = SessionModeOff
+	}
+	ttl := time.Duration(config.TTL)
+	if ttl == 0 {
+		ttl = defaultSessionTTL
+	}
+	result = &SessionManager{
+		logger:   logger,
+		mode:     mode,
+		quota:    config.Quota,
+		ttl:      ttl,
+		sessions: map[string]*Session{},
+		swept:    time.Now(),
+		requests: requests,
+		active:   active,
+	}
+	return
+}
+
+// Resolve finds the session of the request, creating it and setting the cookie if needed. It returns nil if sessions
+// are disabled. It returns an error if the request should be rejected because the session is unknown and the mode is
+// 'require'.
+func (m *SessionManager) Resolve(w http.ResponseWriter, r *http.Request) (session *Session, err error) {
+	if m.mode == SessionModeOff {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	m.sweep(now)
+
+	// Find the session, if the request has the cookie:
+	result := sessionResultNew
+	cookie, cookieErr := r.Cookie(sessionCookie)
+	if cookieErr == nil {
+		session = m.sessions[cookie.Value]
+		if session != nil {
+			result = sessionResultHit
+		} else {
+			result = sessionResultMiss
+		}
+	}
+	m.requests.WithLabelValues(result).Inc()
+	w.Header().Set(sessionHeader, result)
+	if result == sessionResultMiss {
+		m.logger.Info(
+			"Unknown session",
+			slog.String("id", cookie.Value),
+			slog.String("mode", m.mode),
+		)
+		if m.mode == SessionModeRequire {
+			err = fmt.Errorf("session '%s' isn't known by this instance", cookie.Value)
+			return
+		}
+	}
+
+	// Create the session if needed:
+	if session == nil {
+		var data [16]byte
+		_, err = rand.Read(data[:])
+		if err != nil {
+			return
+		}
+		session = &Session{
+			ID:      hex.EncodeToString(data[:]),
+			created: now,
+		}
+		m.sessions[session.ID] = session
+		m.active.Set(float64(len(m.sessions)))
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    session.ID,
+			Path:     "/",
+			HttpOnly: true,
+		})
+		m.logger.Info(
+			"Created session",
+			slog.String("id", session.ID),
+		)
+	}
+	session.lastSeen = now
+	session.requests++
+	return
+}
+
+// Reserve checks that the session has enough quota left for the given number of bytes, and if it has it adds them to
+// the bytes used by the session.
+func (m *SessionManager) Reserve(session *Session, bytes int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.quota > 0 && session.bytes+bytes > m.quota {
+		return fmt.Errorf(
+			"session has used %d of %d bytes and can't download %d more",
+			session.bytes, m.quota, bytes,
+		)
+	}
+	session.bytes += bytes
+	return nil
+}
+
+// Release returns to the session the bytes reserved for a request that was rejected before sending them.
+func (m *SessionManager) Release(session *Session, bytes int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	session.bytes -= bytes
+}
+
+// sweep discards the sessions that have been idle for longer than the TTL. To avoid scanning the sessions for every
+// request it runs at most once per minute.
+func (m *SessionManager) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for id, session := range m.sessions {
+		if now.Sub(session.lastSeen) > m.ttl {
+			delete(m.sessions, id)
+		}
+	}
+	m.active.Set(float64(len(m.sessions)))
+}
@@ -0,0 +1,110 @@
+package dummy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Defaults for the slow read endpoint:
+const (
+	defaultSlowReadRate  = 1024
+	defaultSlowReadChunk = 16
+)
+
+// SlowReadResult is the response of the slow read endpoint.
+type SlowReadResult struct {
+	Bytes   int64    `json:"bytes"`
+	Elapsed Duration `json:"elapsed"`
+}
+
+// SlowReadHandler is an HTTP handler that reads the request body very slowly, so that the timeouts of proxies and
+// load balancers in front of the server can be tested. The 'rate' query parameter is the number of bytes per second,
+// 1024 by default, and the 'chunk' query parameter is the number of bytes read at once, 16 by default. The 'limit'
+// query parameter is the number of bytes to read before responding. The default is zero, which means to read the
+// complete body.
+type SlowReadHandler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *SlowReadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+
+	// Get the parameters:
+	query := r.URL.Query()
+	rate, err := parseIntParam(query.Get("rate"), defaultSlowReadRate)
+	if err != nil || rate == 0 {
+		http.Error(w, fmt.Sprintf("rate '%s' should be a positive integer", query.Get("rate")),
+			http.StatusBadRequest)
+		return
+	}
+	chunk, err := parseIntParam(query.Get("chunk"), defaultSlowReadChunk)
+	if err != nil || chunk == 0 {
+		http.Error(w, fmt.Sprintf("chunk '%s' should be a positive integer", query.Get("chunk")),
+			http.StatusBadRequest)
+		return
+	}
+	limit, err := parseIntParam(query.Get("limit"), 0)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("limit '%s' should be a non negative integer", query.Get("limit")),
+			http.StatusBadRequest)
+		return
+	}
+
+	// Read the body one chunk at a time, waiting between chunks so that the average rate is the requested one:
+	startTime := time.Now()
+	interval := time.Duration(float64(time.Second) * float64(chunk) / float64(rate))
+	buffer := make([]byte, chunk)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var total int64
+	for limit == 0 || total < int64(limit) {
+		size := chunk
+		if limit > 0 {
+			size = min(size, limit-int(total))
+		}
+		n, err := r.Body.Read(buffer[:size])
+		total += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			h.logger.Info(
+				"Failed to read slow body",
+				slog.Int64("bytes", total),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	elapsed := time.Since(startTime)
+	h.logger.Info(
+		"Slow body read",
+		slog.Int64("bytes", total),
+		slog.Int("rate", rate),
+		slog.String("elapsed", elapsed.String()),
+	)
+
+	// Send the result:
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&SlowReadResult{
+		Bytes:   total,
+		Elapsed: Duration(elapsed),
+	})
+	if err != nil {
+		h.logger.Error(
+			"Failed to send slow read result",
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,272 @@
+package dummy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Names of the built-in data sources:
+const (
+	sourceRandom = "random"
+	sourceZero   = "zero"
+	sourceLorem  = "lorem"
+	sourceJSON   = "json"
+	sourceCSV    = "csv"
+	sourceVideo  = "video"
+)
+
+// Size of the blocks generated by the block based data sources. It is smaller than the default buffer size, so that
+// most reads generate complete blocks directly in the buffer of the caller.
+const sourceBlockSize = 16 * (1 << 10) // 16 KiB
+
+// DataSource is a generator of the data sent by the data endpoint when the 'source' query parameter is used. The data
+// must be a deterministic function of the seed and the offset, so that ranges, entity tags and resumed downloads work,
+// and implementations must be safe for concurrent use, as the same source serves all the requests.
+type DataSource interface {
+	// ContentType returns the media type of the data, used when the request doesn't specify one.
+	ContentType() string
+
+	// ReadAt fills the buffer with the bytes of the data generated for the given seed that start at the given
+	// offset. The size of the response is decided by the caller, so the data has no end, unless the settings of a
+	// configurable source determine its size.
+	ReadAt(seed [32]byte, p []byte, offset int64)
+}
+
+// ConfigurableDataSource is implemented by the data sources that accept settings in the query parameters of the
+// request, in addition to the seed.
+type ConfigurableDataSource interface {
+	DataSource
+
+	// Configure returns the source configured with the query parameters of the request. When the settings determine
+	// the size of the data, for example a number of records, it also returns that size, otherwise zero.
+	Configure(query url.Values) (source DataSource, size int64, err error)
+}
+
+// RequestDataSource is implemented by the data sources that generate the data from the request itself, like the
+// template source. The data is generated when the request is received, and it may be different for each request, so
+// it has no entity tag and it doesn't support ranges.
+type RequestDataSource interface {
+	DataSource
+
+	// Render returns the source that contains the data generated for the request, and the size of that data.
+	Render(r *http.Request) (source DataSource, size int64, err error)
+}
+
+// dataSources contains the registered data sources, indexed by name.
+var dataSources = struct {
+	lock    sync.RWMutex
+	sources map[string]DataSource
+}{
+	sources: map[string]DataSource{},
+}
+
+// RegisterDataSource makes a data source available with the given name. It is intended to be called from the init
+// functions of the packages that implement sources, and it panics if the name is empty or already registered.
+func RegisterDataSource(name string, source DataSource) {
+	dataSources.lock.Lock()
+	defer dataSources.lock.Unlock()
+	if name == "" {
+		panic("data source name is empty")
+	}
+	if source == nil {
+		panic(fmt.Sprintf("data source '%s' is nil", name))
+	}
+	if _, ok := dataSources.sources[name]; ok {
+		panic(fmt.Sprintf("data source '%s' is already registered", name))
+	}
+	dataSources.sources[name] = source
+}
+
+// DataSourceNames returns the sorted names of the registered data sources.
+func DataSourceNames() []string {
+	dataSources.lock.RLock()
+	defer dataSources.lock.RUnlock()
+	names := make([]string, 0, len(dataSources.sources))
+	for name := range dataSources.sources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// lookupDataSource returns the data source with the given name, or nil if there is no such source.
+func lookupDataSource(name string) DataSource {
+	dataSources.lock.RLock()
+	defer dataSources.lock.RUnlock()
+	return dataSources.sources[name]
+}
+
+// unknownSourceError returns the error that describes a request for a source that doesn't exist.
+func unknownSourceError(name string) error {
+	return fmt.Errorf(
+		"data source '%s' isn't supported, valid values are %s",
+		name, strings.Join(DataSourceNames(), ", "),
+	)
+}
+
+func init() {
+	RegisterDataSource(sourceRandom, &blockSource{
+		contentType: "application/octet-stream",
+		fill:        fillRandomBlock,
+	})
+	RegisterDataSource(sourceZero, zeroSource{})
+	RegisterDataSource(sourceLorem, &blockSource{
+		contentType: "text/plain; charset=utf-8",
+		fill:        fillLoremBlock,
+	})
+	records, err := newRecordsSource(
+		[]string{recordsFormatNDJSON, recordsFormatJSON},
+		"", defaultRecordsSchema, 0, 0,
+	)
+	if err != nil {
+		panic(err)
+	}
+	RegisterDataSource(sourceJSON, records)
+	table, err := newRecordsSource(
+		[]string{recordsFormatCSV, recordsFormatTSV},
+		"", defaultTableSchema, 0, 0,
+	)
+	if err != nil {
+		panic(err)
+	}
+	RegisterDataSource(sourceCSV, table)
+	RegisterDataSource(sourceVideo, &blockSource{
+		contentType: "video/h264",
+		fill:        fillVideoBlock,
+	})
+}
+
+// zeroSource is a data source that generates only zeros.
+type zeroSource struct{}
+
+// ContentType is the implementation of the DataSource interface.
+func (s zeroSource) ContentType() string {
+	return "application/octet-stream"
+}
+
+// ReadAt is the implementation of the DataSource interface.
+func (s zeroSource) ReadAt(seed [32]byte, p []byte, offset int64) {
+	clear(p)
+}
+
+// blockSource is a data source that generates the data in independent blocks, of sourceBlockSize bytes unless the size
+// says otherwise, so that reading from any offset only requires generating the blocks that contain it. The fill
+// function receives a generator seeded with the seed of the data and the index of the block.
+type blockSource struct {
+	contentType string
+	size        int
+	fill        func(block []byte, random *rand.Rand, index int64)
+	blocks      sync.Pool
+}
+
+// ContentType is the implementation of the DataSource interface.
+func (s *blockSource) ContentType() string {
+	return s.contentType
+}
+
+// ReadAt is the implementation of the DataSource interface.
+func (s *blockSource) ReadAt(seed [32]byte, p []byte, offset int64) {
+	size := s.size
+	if size == 0 {
+		size = sourceBlockSize
+	}
+	for len(p) > 0 {
+		index := offset / int64(size)
+		start := int(offset % int64(size))
+		random := blockRandom(seed, index)
+
+		// Complete blocks are generated directly in the buffer of the caller, partial ones in a temporary block:
+		var count int
+		if start == 0 && len(p) >= size {
+			s.fill(p[:size], random, index)
+			count = size
+		} else {
+			block, _ := s.blocks.Get().([]byte)
+			if block == nil {
+				block = make([]byte, size)
+			}
+			s.fill(block, random, index)
+			count = copy(p, block[start:])
+			s.blocks.Put(block)
+		}
+		p = p[count:]
+		offset += int64(count)
+	}
+}
+
+// blockRandom returns the generator for the block with the given index, seeded with the hash of the seed of the data
+// and the index.
+func blockRandom(seed [32]byte, index int64) *rand.Rand {
+	var input [40]byte
+	copy(input[:], seed[:])
+	binary.LittleEndian.PutUint64(input[32:], uint64(index))
+	return rand.New(rand.NewChaCha8(sha256.Sum256(input[:])))
+}
+
+// fillRandomBlock fills the block with random bytes.
+func fillRandomBlock(block []byte, random *rand.Rand, index int64) {
+	for len(block) >= 8 {
+		binary.LittleEndian.PutUint64(block, random.Uint64())
+		block = block[8:]
+	}
+	for i := range block {
+		block[i] = byte(random.Uint32())
+	}
+}
+
+// dataSourceReader reads the data generated by a source, from the beginning to the given size.
+type dataSourceReader struct {
+	source DataSource
+	seed   [32]byte
+	size   int64
+	offset int64
+}
+
+// newDataSourceReader creates a reader for the data generated by the given source and seed.
+func newDataSourceReader(source DataSource, seed [32]byte, size int64) *dataSourceReader {
+	return &dataSourceReader{
+		source: source,
+		seed:   seed,
+		size:   size,
+	}
+}
+
+// Read is the implementation of the io.Reader interface.
+func (r *dataSourceReader) Read(p []byte) (n int, err error) {
+	if r.offset >= r.size {
+		err = io.EOF
+		return
+	}
+	p = p[:min(int64(len(p)), r.size-r.offset)]
+	r.source.ReadAt(r.seed, p, r.offset)
+	n = len(p)
+	r.offset += int64(n)
+	return
+}
+
+// Seek is the implementation of the io.Seeker interface.
+func (r *dataSourceReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,51 @@
+package dummy
+
+import (
+	"math/rand/v2"
+	"strings"
+)
+
+// loremWords are the words used to generate the text of the lorem source.
+var loremWords = strings.Fields(`
+	lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore et dolore magna
+	aliqua enim ad minim veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea commodo consequat duis
+	aute irure in reprehenderit voluptate velit esse cillum eu fugiat nulla pariatur excepteur sint occaecat cupidatat
+	non proident sunt culpa qui officia deserunt mollit anim id est laborum
+`)
+
+// fillLoremBlock fills the block with paragraphs of lorem ipsum text. The last byte of the block is always a line
+// break, so that the words of consecutive blocks aren't joined.
+func fillLoremBlock(block []byte, random *rand.Rand, index int64) {
+	var paragraph []byte
+	n := 0
+	for n < len(block) {
+		paragraph = paragraph[:0]
+		sentences := 3 + random.IntN(5)
+		for i := 0; i < sentences; i++ {
+			if i > 0 {
+				paragraph = append(paragraph, ' ')
+			}
+			paragraph = appendLoremSentence(paragraph, random)
+		}
+		paragraph = append(paragraph, "\n\n"...)
+		n += copy(block[n:], paragraph)
+	}
+	block[len(block)-1] = '\n'
+}
+
+// appendLoremSentence appends to the given slice a sentence of random words, starting with a capital letter and ending
+// with a period.
+func appendLoremSentence(data []byte, random *rand.Rand) []byte {
+	words := 4 + random.IntN(12)
+	for i := 0; i < words; i++ {
+		word := loremWords[random.IntN(len(loremWords))]
+		if i == 0 {
+			data = append(data, word[0]-'a'+'A')
+			data = append(data, word[1:]...)
+		} else {
+			data = append(data, ' ')
+			data = append(data, word...)
+		}
+	}
+	return append(data, '.')
+}
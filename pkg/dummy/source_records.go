@@ -0,0 +1,574 @@
+package dummy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of the records sources:
+const (
+	recordsFormatNDJSON = "ndjson"
+	recordsFormatJSON   = "json"
+	recordsFormatCSV    = "csv"
+	recordsFormatTSV    = "tsv"
+)
+
+// Limits of the records sources:
+const (
+	recordsMaxSize   = 1 << 20 // 1 MiB
+	recordsMaxFields = 100
+)
+
+// recordsPaddingName is the name of the field added to the records to fill the space left, so that they have a fixed
+// size or fill a block completely.
+const recordsPaddingName = "padding"
+
+// recordsInterval is the time between the timestamps of consecutive records of fixed size.
+const recordsInterval = 10 * time.Millisecond
+
+// defaultRecordsSchema is the schema of the JSON records when the request doesn't specify one. The records look like
+// structured access log entries.
+const defaultRecordsSchema = "id:id,timestamp:timestamp,level:level,service:enum(api|auth|billing|catalog|checkout|" +
+	"gateway|search|users),method:method,path:path,status:status,latency_ms:float,bytes:int,message:text"
+
+// defaultTableSchema is the schema of the tabular records when the request doesn't specify one. The rows look like
+// the lines of sales orders.
+const defaultTableSchema = "order_id:uuid,timestamp:timestamp,customer:id,country:enum(BR|DE|ES|FR|IN|JP|US)," +
+	"product:word,quantity:int,price:float,paid:bool,comment:text"
+
+// recordsFormat describes how the records of a format are encoded. Each record starts with the open text, followed by
+// the fields, separated by the separator, the padding field, that is enclosed by the padding open and close texts,
+// and the close text. Names are included in the records only when the names flag is set, and strings are quoted
+// only when the quote flag is set.
+type recordsFormat struct {
+	contentType  string
+	open         string
+	close        string
+	separator    string
+	names        bool
+	quote        bool
+	paddingOpen  string
+	paddingClose string
+	header       bool
+	array        bool
+}
+
+// recordsFormats contains the supported formats, indexed by name.
+var recordsFormats = map[string]*recordsFormat{
+	recordsFormatNDJSON: {
+		contentType:  "application/x-ndjson",
+		open:         "{",
+		close:        "}",
+		separator:    ",",
+		names:        true,
+		quote:        true,
+		paddingOpen:  `"` + recordsPaddingName + `":"`,
+		paddingClose: `"`,
+	},
+	recordsFormatJSON: {
+		contentType:  "application/json",
+		open:         "{",
+		close:        "}",
+		separator:    ",",
+		names:        true,
+		quote:        true,
+		paddingOpen:  `"` + recordsPaddingName + `":"`,
+		paddingClose: `"`,
+		array:        true,
+	},
+	recordsFormatCSV: {
+		contentType:  "text/csv; charset=utf-8",
+		separator:    ",",
+		quote:        true,
+		paddingOpen:  `"`,
+		paddingClose: `"`,
+		header:       true,
+	},
+	recordsFormatTSV: {
+		contentType: "text/tab-separated-values; charset=utf-8",
+		separator:   "\t",
+		header:      true,
+	},
+}
+
+// encodeString encodes a string value, or the name of a field, in the given format.
+func (f *recordsFormat) encodeString(value string) (result []byte, err error) {
+	switch {
+	case f.names:
+		result, err = json.Marshal(value)
+	case f.quote:
+		result = []byte(`"` + strings.ReplaceAll(value, `"`, `""`) + `"`)
+	case strings.ContainsAny(value, "\t\r\n"):
+		err = fmt.Errorf("value '%s' contains tabs or line breaks", value)
+	default:
+		result = []byte(value)
+	}
+	return
+}
+
+// recordLevels are the values of the 'level' field type, repeated according to their frequency.
+var recordLevels = []string{
+	"debug", "debug", "debug",
+	"info", "info", "info", "info", "info", "info", "info", "info", "info", "info", "info", "info", "info", "info",
+	"warn", "warn",
+	"error",
+}
+
+// recordMethods and recordPaths are the values of the 'method' and 'path' field types.
+var (
+	recordMethods = []string{"GET", "GET", "GET", "POST", "PUT", "DELETE"}
+	recordPaths   = []string{"/api/v1/items", "/api/v1/orders", "/api/v1/users", "/login", "/health", "/search"}
+)
+
+// recordStatuses are the values of the 'status' field type, repeated according to their frequency.
+var recordStatuses = []int{200, 200, 200, 200, 200, 200, 200, 201, 204, 304, 400, 404, 500, 503}
+
+// recordType describes how the values of a type of field are generated. The width is the maximum length of the values,
+// without quotes, except for the text type, that is truncated when a record needs to fit in a fixed size. Quoted
+// types are strings, and are enclosed in quotes when the format requires it.
+type recordType struct {
+	width  int
+	quoted bool
+	append func(data []byte, random *rand.Rand, timestamp time.Time) []byte
+}
+
+// recordTypes are the types of fields supported in the schemas, except 'enum', that has its values in the schema.
+var recordTypes = map[string]*recordType{
+	"bool": {
+		width: 5,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return strconv.AppendBool(data, random.IntN(2) == 1)
+		},
+	},
+	"int": {
+		width: 6,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return strconv.AppendInt(data, int64(random.IntN(1000000)), 10)
+		},
+	},
+	"float": {
+		width: 7,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return strconv.AppendFloat(data, float64(random.IntN(1000000))/1000, 'f', 3, 64)
+		},
+	},
+	"id": {
+		width:  16,
+		quoted: true,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			var id [8]byte
+			for i := range id {
+				id[i] = byte(random.Uint32())
+			}
+			return hex.AppendEncode(data, id[:])
+		},
+	},
+	"uuid": {
+		width:  36,
+		quoted: true,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			var id [16]byte
+			for i := range id {
+				id[i] = byte(random.Uint32())
+			}
+			id[6] = id[6]&0x0f | 0x40
+			id[8] = id[8]&0x3f | 0x80
+			text := hex.EncodeToString(id[:])
+			return fmt.Appendf(data, "%s-%s-%s-%s-%s", text[0:8], text[8:12], text[12:16], text[16:20], text[20:])
+		},
+	},
+	"timestamp": {
+		width:  len(time.RFC3339Nano),
+		quoted: true,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return timestamp.AppendFormat(data, time.RFC3339Nano)
+		},
+	},
+	"ip": {
+		width:  15,
+		quoted: true,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return fmt.Appendf(data, "10.%d.%d.%d", random.IntN(256), random.IntN(256), 1+random.IntN(254))
+		},
+	},
+	"word": {
+		width:  14,
+		quoted: true,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return append(data, loremWords[random.IntN(len(loremWords))]...)
+		},
+	},
+	"text": {
+		quoted: true,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return appendLoremSentence(data, random)
+		},
+	},
+	"level": {
+		width:  5,
+		quoted: true,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return append(data, recordLevels[random.IntN(len(recordLevels))]...)
+		},
+	},
+	"method": {
+		width:  6,
+		quoted: true,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return append(data, recordMethods[random.IntN(len(recordMethods))]...)
+		},
+	},
+	"path": {
+		width:  14,
+		quoted: true,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return append(data, recordPaths[random.IntN(len(recordPaths))]...)
+		},
+	},
+	"status": {
+		width: 3,
+		append: func(data []byte, random *rand.Rand, timestamp time.Time) []byte {
+			return strconv.AppendInt(data, int64(recordStatuses[random.IntN(len(recordStatuses))]), 10)
+		},
+	},
+}
+
+// recordField is a field of the schema of a records source. The name and the values of enumerations are already
+// encoded for the format, and the name includes the colon when the format includes names in the records.
+type recordField struct {
+	name   []byte
+	kind   *recordType
+	text   bool
+	values [][]byte
+}
+
+// recordsSource is a data source that generates records following a schema, for example newline delimited JSON
+// records or the rows of a CSV file. When the records have variable size they are generated in independent blocks,
+// and the space left at the end of each block is filled with a record that contains only padding. When they have a
+// fixed size each record is padded to that size, and then it is possible to request a number of records, which
+// determines the size of the data. The format, the schema, the size and the number of records are configured with
+// the 'format', 'schema', 'record_size' and 'records' query parameters. Note that columnar formats like Parquet
+// aren't supported, as they can't be generated from independent pieces.
+type recordsSource struct {
+	formats []string
+	schema  string
+	format  *recordsFormat
+	fields  []*recordField
+	prefix  []byte
+	suffix  []byte
+	size    int
+	count   int64
+	blocks  *blockSource
+}
+
+// newRecordsSource creates a records source with the given settings. The first of the allowed formats is the default.
+func newRecordsSource(formats []string, format, schema string, size int,
+	count int64) (result *recordsSource, err error) {
+	if format == "" {
+		format = formats[0]
+	}
+	if !slices.Contains(formats, format) {
+		err = fmt.Errorf(
+			"format should be one of '%s', but it is '%s'",
+			strings.Join(formats, "', '"), format,
+		)
+		return
+	}
+	source := &recordsSource{
+		formats: formats,
+		schema:  schema,
+		format:  recordsFormats[format],
+		size:    size,
+		count:   count,
+	}
+	source.fields, err = source.parseSchema(schema)
+	if err != nil {
+		return
+	}
+	if count > 0 && size == 0 {
+		err = errors.New("number of records can only be used with a fixed record size")
+		return
+	}
+	if source.format.array && count == 0 {
+		err = fmt.Errorf("format '%s' requires the number of records", format)
+		return
+	}
+	if size > 0 {
+		minSize := source.minSize()
+		if size < minSize || size > recordsMaxSize {
+			err = fmt.Errorf(
+				"record size %d should be between %d and %d for this schema",
+				size, minSize, recordsMaxSize,
+			)
+			return
+		}
+	} else {
+		source.blocks = &blockSource{
+			fill: source.fillBlock,
+		}
+	}
+
+	// Prepare the text that goes before the first record and after the last one, the brackets of the JSON array or
+	// the header of the tabular formats:
+	switch {
+	case source.format.array:
+		source.prefix = []byte("[\n")
+		source.suffix = []byte("]\n")
+	case source.format.header:
+		for _, field := range source.fields {
+			source.prefix = append(source.prefix, field.name...)
+			source.prefix = append(source.prefix, source.format.separator...)
+		}
+		source.prefix = append(source.prefix, recordsPaddingName...)
+		source.prefix = append(source.prefix, '\n')
+	}
+	result = source
+	return
+}
+
+// parseSchema parses a schema in the 'name:type,name:type,...' format. The type of a field can also be
+// 'enum(a|b|c)', and then the values are chosen from the given ones.
+func (s *recordsSource) parseSchema(schema string) (result []*recordField, err error) {
+	for _, item := range strings.Split(schema, ",") {
+		name, kind, ok := strings.Cut(item, ":")
+		if !ok || name == "" {
+			err = fmt.Errorf("field '%s' of the schema should be in the 'name:type' format", item)
+			return
+		}
+		field := &recordField{}
+		field.name, err = s.format.encodeString(name)
+		if err != nil {
+			return
+		}
+		if s.format.names {
+			field.name = append(field.name, ':')
+		}
+		values, isEnum := strings.CutPrefix(kind, "enum(")
+		if isEnum {
+			values, isEnum = strings.CutSuffix(values, ")")
+		}
+		switch {
+		case isEnum:
+			field.kind = &recordType{}
+			for _, value := range strings.Split(values, "|") {
+				var encoded []byte
+				encoded, err = s.format.encodeString(value)
+				if err != nil {
+					return
+				}
+				field.values = append(field.values, encoded)
+				field.kind.width = max(field.kind.width, len(encoded))
+			}
+		case recordTypes[kind] != nil:
+			field.kind = recordTypes[kind]
+			field.text = kind == "text"
+		default:
+			err = fmt.Errorf("type '%s' of field '%s' isn't supported", kind, name)
+			return
+		}
+		result = append(result, field)
+	}
+	if len(result) > recordsMaxFields {
+		err = fmt.Errorf("schema has %d fields, but the maximum is %d", len(result), recordsMaxFields)
+	}
+	return
+}
+
+// Configure is the implementation of the ConfigurableDataSource interface.
+func (s *recordsSource) Configure(query url.Values) (result DataSource, size int64, err error) {
+	recordSize, err := parseIntParam(query.Get("record_size"), 0)
+	if err != nil {
+		err = fmt.Errorf("record size '%s' isn't valid: %w", query.Get("record_size"), err)
+		return
+	}
+	count, err := parseIntParam(query.Get("records"), 0)
+	if err != nil {
+		err = fmt.Errorf("number of records '%s' isn't valid: %w", query.Get("records"), err)
+		return
+	}
+	schema := query.Get("schema")
+	if schema == "" {
+		schema = s.schema
+	}
+	source, err := newRecordsSource(s.formats, query.Get("format"), schema, recordSize, int64(count))
+	if err != nil {
+		return
+	}
+	if source.count > 0 {
+		size = int64(len(source.prefix)) + source.count*int64(source.size) + int64(len(source.suffix))
+	}
+	result = source
+	return
+}
+
+// ContentType is the implementation of the DataSource interface.
+func (s *recordsSource) ContentType() string {
+	return s.format.contentType
+}
+
+// ReadAt is the implementation of the DataSource interface.
+func (s *recordsSource) ReadAt(seed [32]byte, p []byte, offset int64) {
+	// The data is the prefix, then the records, and then the suffix, that only exists when there is a number of
+	// records:
+	var record []byte
+	for len(p) > 0 {
+		var chunk []byte
+		position := offset - int64(len(s.prefix))
+		switch {
+		case position < 0:
+			chunk = s.prefix[offset:]
+		case s.blocks != nil:
+			s.blocks.ReadAt(seed, p, position)
+			return
+		case s.count > 0 && position >= s.count*int64(s.size):
+			position -= s.count * int64(s.size)
+			if position >= int64(len(s.suffix)) {
+				clear(p)
+				return
+			}
+			chunk = s.suffix[position:]
+		default:
+			index := position / int64(s.size)
+			record = s.appendFixedRecord(record[:0], seed, index)
+			chunk = record[position%int64(s.size):]
+		}
+		count := copy(p, chunk)
+		p = p[count:]
+		offset += int64(count)
+	}
+}
+
+// minSize returns the minimum fixed size of a record for the schema, so that the largest values fit.
+func (s *recordsSource) minSize() int {
+	size := len(s.format.open) + len(s.format.paddingOpen) + len(s.format.paddingClose) + len(s.format.close) +
+		len(",\n")
+	for _, field := range s.fields {
+		size += len(s.format.separator) + field.kind.width
+		if s.format.names {
+			size += len(field.name)
+		}
+		if s.format.quote && field.kind.quoted {
+			size += 2
+		}
+	}
+	return size
+}
+
+// appendRecord appends a record to the given slice, without the padding field. Text values are truncated to the
+// given length, unless it is negative. It also returns the length of the longest text value before truncating it.
+func (s *recordsSource) appendRecord(data []byte, random *rand.Rand, timestamp time.Time,
+	limit int) (result []byte, longest int) {
+	data = append(data, s.format.open...)
+	for i, field := range s.fields {
+		if i > 0 {
+			data = append(data, s.format.separator...)
+		}
+		if s.format.names {
+			data = append(data, field.name...)
+		}
+		if field.values != nil {
+			data = append(data, field.values[random.IntN(len(field.values))]...)
+			continue
+		}
+		quote := s.format.quote && field.kind.quoted
+		if quote {
+			data = append(data, '"')
+		}
+		start := len(data)
+		data = field.kind.append(data, random, timestamp)
+		if field.text {
+			length := len(data) - start
+			longest = max(longest, length)
+			if limit >= 0 && length > limit {
+				data = data[:start+limit]
+			}
+		}
+		if quote {
+			data = append(data, '"')
+		}
+	}
+	result = append(data, s.format.separator...)
+	return
+}
+
+// appendPadding appends the padding field, containing the given number of spaces, and the end of the record.
+func (s *recordsSource) appendPadding(data []byte, size int) []byte {
+	data = append(data, s.format.paddingOpen...)
+	for i := 0; i < size; i++ {
+		data = append(data, ' ')
+	}
+	data = append(data, s.format.paddingClose...)
+	return append(data, s.format.close...)
+}
+
+// appendFixedRecord appends the record with the given index, padded to the fixed size and followed by its separator.
+func (s *recordsSource) appendFixedRecord(data []byte, seed [32]byte, index int64) []byte {
+	separator := "\n"
+	if s.format.array && index < s.count-1 {
+		separator = ",\n"
+	}
+	target := s.size - len(separator) - len(s.format.paddingOpen) - len(s.format.paddingClose) - len(s.format.close)
+	timestamp := syntheticModTime.Add(time.Duration(index) * recordsInterval)
+	start := len(data)
+	data, longest := s.appendRecord(data, blockRandom(seed, index), timestamp, -1)
+
+	// If the record is too long generate it again with the same values, but truncating the text fields. The limit is
+	// the largest that makes the record fit, found with a binary search.
+	if len(data)-start > target {
+		low, high := 0, longest
+		for low < high {
+			limit := (low + high + 1) / 2
+			data, _ = s.appendRecord(data[:start], blockRandom(seed, index), timestamp, limit)
+			if len(data)-start <= target {
+				low = limit
+			} else {
+				high = limit - 1
+			}
+		}
+		data, _ = s.appendRecord(data[:start], blockRandom(seed, index), timestamp, low)
+	}
+	data = s.appendPadding(data, target-(len(data)-start))
+	return append(data, separator...)
+}
+
+// fillBlock fills a block with records of variable size, followed by a padding record that fills the rest. The
+// padding record has no values, only the padding field. Formats that include the names of the fields don't need the
+// padding field in the rest of the records, formats that have a header do, as all rows have the same columns.
+func (s *recordsSource) fillBlock(block []byte, random *rand.Rand, index int64) {
+	filler := []byte(s.format.open)
+	if !s.format.names {
+		for range s.fields {
+			filler = append(filler, s.format.separator...)
+		}
+	}
+	overhead := len(filler) + len(s.format.paddingOpen) + len(s.format.paddingClose) + len(s.format.close) + 1
+	n := 0
+	timestamp := syntheticModTime.Add(time.Duration(index) * time.Second)
+	var record []byte
+	for {
+		timestamp = timestamp.Add(time.Duration(random.IntN(1000)) * time.Microsecond)
+		record, _ = s.appendRecord(record[:0], random, timestamp, -1)
+		if s.format.names {
+			record = record[:len(record)-len(s.format.separator)]
+			record = append(record, s.format.close...)
+		} else {
+			record = s.appendPadding(record, 0)
+		}
+		record = append(record, '\n')
+		if n+len(record)+overhead > len(block) {
+			break
+		}
+		n += copy(block[n:], record)
+	}
+	filler = s.appendPadding(filler, len(block)-n-overhead)
+	filler = append(filler, '\n')
+	copy(block[n:], filler)
+}
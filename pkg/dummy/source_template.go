@@ -0,0 +1,176 @@
+package dummy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Name of the template data source.
+const sourceTemplate = "template"
+
+// templateMaxSize is the maximum size of the body rendered by the template source.
+const templateMaxSize = 1 << 20 // 1 MiB
+
+// templateFuncs are the functions available to the templates, in addition to the built-in ones.
+var templateFuncs = template.FuncMap{
+	"json": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// TemplateData contains the variables of the request that are available to the templates.
+type TemplateData struct {
+	Method     string
+	Path       string
+	Host       string
+	RemoteAddr string
+	Query      url.Values
+	Headers    http.Header
+	Time       time.Time
+	Timestamp  int64
+	Counter    int64
+
+	request *http.Request
+}
+
+// newTemplateData returns the variables of the given request, with the given value of the counter.
+func newTemplateData(r *http.Request, counter int64) *TemplateData {
+	now := time.Now()
+	return &TemplateData{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Query:      r.URL.Query(),
+		Headers:    r.Header,
+		Time:       now.UTC(),
+		Timestamp:  now.Unix(),
+		Counter:    counter,
+		request:    r,
+	}
+}
+
+// PathValue returns the value of a wildcard of the pattern of the route that matched the request, for example
+// 'id' for '/users/{id}'.
+func (d *TemplateData) PathValue(name string) string {
+	return d.request.PathValue(name)
+}
+
+// parseTemplate parses the text of a template, with the additional functions.
+func parseTemplate(text string) (result *template.Template, err error) {
+	result, err = template.New(sourceTemplate).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		err = fmt.Errorf("template isn't valid: %w", err)
+	}
+	return
+}
+
+// renderTemplate executes the template with the given variables, failing if the result exceeds the maximum size.
+func renderTemplate(tmpl *template.Template, data *TemplateData) (result []byte, err error) {
+	buffer := &bytes.Buffer{}
+	err = tmpl.Execute(&limitedWriter{writer: buffer, limit: templateMaxSize}, data)
+	if err != nil {
+		err = fmt.Errorf("failed to render template: %w", err)
+		return
+	}
+	result = buffer.Bytes()
+	return
+}
+
+// templateSource is a data source that renders the body from the Go template in the 'template' query parameter,
+// with the variables of the request, so that it can be used to mock simple APIs. For example:
+//
+//	{"user": {{json (.Query.Get "user")}}, "agent": {{json (.Headers.Get "User-Agent")}}, "n": {{.Counter}}}
+//
+// The counter is the number of bodies rendered by the server, starting with one. Besides the built-in functions of
+// templates the 'json', 'lower' and 'upper' functions are available. The source is only available when it is enabled
+// in the configuration, as rendering a template sent by an untrusted client can take a long time.
+type templateSource struct {
+	counter atomic.Int64
+}
+
+func init() {
+	RegisterDataSource(sourceTemplate, &templateSource{})
+}
+
+// ContentType is the implementation of the DataSource interface.
+func (s *templateSource) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+// ReadAt is the implementation of the DataSource interface. The source itself has no data, only the rendered one.
+func (s *templateSource) ReadAt(seed [32]byte, p []byte, offset int64) {
+	clear(p)
+}
+
+// Render is the implementation of the RequestDataSource interface.
+func (s *templateSource) Render(r *http.Request) (result DataSource, size int64, err error) {
+	text := r.URL.Query().Get("template")
+	if text == "" {
+		err = errors.New("parameter 'template' is mandatory for the template source")
+		return
+	}
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return
+	}
+	data, err := renderTemplate(tmpl, newTemplateData(r, s.counter.Add(1)))
+	if err != nil {
+		return
+	}
+	result = &renderedSource{
+		contentType: s.ContentType(),
+		data:        data,
+	}
+	size = int64(len(data))
+	return
+}
+
+// renderedSource is a data source that contains a body rendered for a request.
+type renderedSource struct {
+	contentType string
+	data        []byte
+}
+
+// ContentType is the implementation of the DataSource interface.
+func (s *renderedSource) ContentType() string {
+	return s.contentType
+}
+
+// ReadAt is the implementation of the DataSource interface.
+func (s *renderedSource) ReadAt(seed [32]byte, p []byte, offset int64) {
+	n := 0
+	if offset < int64(len(s.data)) {
+		n = copy(p, s.data[offset:])
+	}
+	clear(p[n:])
+}
+
+// limitedWriter is a writer that fails when more than the limit is written.
+type limitedWriter struct {
+	writer  *bytes.Buffer
+	limit   int
+	written int
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *limitedWriter) Write(p []byte) (n int, err error) {
+	if w.written+len(p) > w.limit {
+		err = fmt.Errorf("rendered body exceeds the maximum of %d bytes", w.limit)
+		return
+	}
+	n, err = w.writer.Write(p)
+	w.written += n
+	return
+}
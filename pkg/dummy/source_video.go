@@ -0,0 +1,43 @@
+package dummy
+
+import (
+	"math/rand/v2"
+)
+
+// Types of the H.264 network abstraction layer units generated by the video source:
+const (
+	nalSPS      = 0x67
+	nalPPS      = 0x68
+	nalIDRSlice = 0x65
+	nalSlice    = 0x41
+)
+
+// videoKeyFrameBlocks is the number of blocks between key frames of the video source, about one mebibyte.
+const videoKeyFrameBlocks = 64
+
+// fillVideoBlock fills the block with data that looks like an H.264 bitstream in the Annex B format: network
+// abstraction layer units separated by start codes, with random payloads that don't contain zeros, so that they don't
+// contain accidental start codes. Every videoKeyFrameBlocks blocks there is a key frame, preceded by the sequence and
+// picture parameter sets. This is enough for tools that inspect the framing, but it can't be decoded.
+func fillVideoBlock(block []byte, random *rand.Rand, index int64) {
+	fillRandomBlock(block, random, index)
+	for i, value := range block {
+		if value == 0 {
+			block[i] = 0x80
+		}
+	}
+	position := 0
+	unit := func(kind byte, size int) {
+		copy(block[position:], []byte{0, 0, 0, 1, kind})
+		position += size
+	}
+	kind := byte(nalSlice)
+	if index%videoKeyFrameBlocks == 0 {
+		unit(nalSPS, 24)
+		unit(nalPPS, 8)
+		kind = nalIDRSlice
+	}
+	for position < len(block) {
+		unit(kind, 1<<10+random.IntN(6<<10))
+	}
+}
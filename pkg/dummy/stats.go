@@ -0,0 +1,287 @@
+package dummy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the response trailers that contain the measurements of the transfer made by the server:
+const (
+	elapsedTrailer    = "X-Dummy-Elapsed"
+	throughputTrailer = "X-Dummy-Throughput"
+	chunksTrailer     = "X-Dummy-Chunks"
+)
+
+var statsTrailers = []string{
+	elapsedTrailer,
+	throughputTrailer,
+	chunksTrailer,
+}
+
+// declareStatsTrailers announces the statistics trailers. It must be called before writing the response header.
+func declareStatsTrailers(header http.Header) {
+	header.Set("Trailer", strings.Join(statsTrailers, ", "))
+}
+
+// setStatsTrailers sets the values of the statistics trailers. The elapsed time is the time from the reception of the
+// request till the last byte was written, the throughput is in bytes per second, and the chunks are the number of
+// writes done by the server.
+func setStatsTrailers(header http.Header, elapsed time.Duration, bytes, chunks int64) {
+	throughput := 0.0
+	if elapsed > 0 {
+		throughput = float64(bytes) / elapsed.Seconds()
+	}
+	header.Set(elapsedTrailer, elapsed.String())
+	header.Set(throughputTrailer, strconv.FormatFloat(throughput, 'f', 0, 64))
+	header.Set(chunksTrailer, strconv.FormatInt(chunks, 10))
+}
+
+// Defaults for the statistics endpoint:
+const (
+	defaultStatsSamples = 1000
+	defaultStatsWindow  = 5 * time.Minute
+)
+
+// Stats collects statistics about the work done by the server since it started, independently of the Prometheus
+// metrics, so that they can be inspected quickly with a tool like curl.
+type Stats struct {
+	start             time.Time
+	activeConnections atomic.Int64
+	totalConnections  atomic.Int64
+	activeRequests    atomic.Int64
+	bytes             atomic.Int64
+	lock              sync.Mutex
+	samples           []statsSample
+	next              int
+	endpoints         map[string]*EndpointStats
+	resumes           *ResumeManager
+	connections       *ConnectionTable
+	timelines         []RequestTimeline
+	probes            *Prober
+	recorders         []ResultRecorder
+}
+
+// statsSample is the throughput of one transfer.
+type statsSample struct {
+	time       time.Time
+	throughput float64
+}
+
+// StatsReport is the document returned by the statistics endpoint.
+type StatsReport struct {
+	Start             time.Time                 `json:"start"`
+	Uptime            Duration                  `json:"uptime"`
+	ActiveConnections int64                     `json:"active_connections"`
+	TotalConnections  int64                     `json:"total_connections"`
+	ActiveRequests    int64                     `json:"active_requests"`
+	BytesServed       int64                     `json:"bytes_served"`
+	Throughput        ThroughputStats           `json:"throughput"`
+	Endpoints         map[string]*EndpointStats `json:"endpoints"`
+	ResumeSessions    []ResumeSessionStats      `json:"resume_sessions,omitempty"`
+	Timelines         []RequestTimeline         `json:"timelines,omitempty"`
+	Probes            []ProbeStats              `json:"probes,omitempty"`
+}
+
+// ThroughputStats contains the percentiles of the throughput of the transfers completed during the window, in bytes
+// per second.
+type ThroughputStats struct {
+	Window    Duration `json:"window"`
+	Transfers int      `json:"transfers"`
+	P50       float64  `json:"p50"`
+	P90       float64  `json:"p90"`
+	P99       float64  `json:"p99"`
+	Max       float64  `json:"max"`
+}
+
+// EndpointStats contains the counters of one endpoint.
+type EndpointStats struct {
+	Requests int64 `json:"requests"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// NewStats creates an empty set of statistics.
+func NewStats() *Stats {
+	return &Stats{
+		start:       time.Now(),
+		samples:     make([]statsSample, 0, defaultStatsSamples),
+		endpoints:   map[string]*EndpointStats{},
+		resumes:     NewResumeManager(),
+		connections: NewConnectionTable(),
+	}
+}
+
+// ConnState updates the connection counters. It should be used as the ConnState hook of the HTTP servers.
+func (s *Stats) ConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		s.activeConnections.Add(1)
+		s.totalConnections.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		s.activeConnections.Add(-1)
+	}
+	s.connections.ConnState(conn, state)
+}
+
+// statsEndpointKey is the key of the request context value that contains the pattern matched by the request.
+type statsEndpointKey struct{}
+
+// RecordTransfer records that a transfer of the given number of bytes has been completed in the given time. The bytes
+// are attributed to the endpoint of the request that the context belongs to.
+func (s *Stats) RecordTransfer(ctx context.Context, bytes int64, elapsed time.Duration) {
+	s.bytes.Add(bytes)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pattern, ok := ctx.Value(statsEndpointKey{}).(string)
+	if ok {
+		s.endpoint(pattern).Bytes += bytes
+	}
+	for _, recorder := range s.recorders {
+		recorder.RecordTransfer(pattern, bytes, elapsed)
+	}
+	if elapsed <= 0 {
+		return
+	}
+	sample := statsSample{
+		time:       time.Now(),
+		throughput: float64(bytes) / elapsed.Seconds(),
+	}
+	if len(s.samples) < cap(s.samples) {
+		s.samples = append(s.samples, sample)
+	} else {
+		s.samples[s.next] = sample
+		s.next = (s.next + 1) % len(s.samples)
+	}
+}
+
+// RecordTimeline adds the timeline of a request to the statistics. Only the most recent timelines are kept.
+func (s *Stats) RecordTimeline(timeline RequestTimeline) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.timelines) >= maxStatsTimelines {
+		s.timelines = slices.Delete(s.timelines, 0, len(s.timelines)-maxStatsTimelines+1)
+	}
+	s.timelines = append(s.timelines, timeline)
+}
+
+func (s *Stats) endpoint(pattern string) *EndpointStats {
+	result, ok := s.endpoints[pattern]
+	if !ok {
+		result = &EndpointStats{}
+		s.endpoints[pattern] = result
+	}
+	return result
+}
+
+// RouteHandler is a handler that can report the pattern of the route that matches a request, like the router and the
+// mock routes.
+type RouteHandler interface {
+	http.Handler
+
+	// Handler returns the handler and the pattern of the route that matches the request.
+	Handler(r *http.Request) (handler http.Handler, pattern string)
+}
+
+// Wrap returns a handler that counts the requests sent to each of the endpoints of the given router, and that adds
+// them to the table of transfers.
+func (s *Stats) Wrap(router RouteHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := router.Handler(r)
+		s.lock.Lock()
+		s.endpoint(pattern).Requests++
+		s.lock.Unlock()
+		s.activeRequests.Add(1)
+		defer s.activeRequests.Add(-1)
+		ctx := context.WithValue(r.Context(), statsEndpointKey{}, pattern)
+		s.connections.Serve(router, w, r.WithContext(ctx))
+	})
+}
+
+// Report returns the statistics, including the throughput percentiles of the transfers completed within the given
+// window.
+func (s *Stats) Report(window time.Duration) *StatsReport {
+	now := time.Now()
+	report := &StatsReport{
+		Start:             s.start,
+		Uptime:            Duration(now.Sub(s.start)),
+		ActiveConnections: s.activeConnections.Load(),
+		TotalConnections:  s.totalConnections.Load(),
+		ActiveRequests:    s.activeRequests.Load(),
+		BytesServed:       s.bytes.Load(),
+		Throughput: ThroughputStats{
+			Window: Duration(window),
+		},
+		Endpoints:      map[string]*EndpointStats{},
+		ResumeSessions: s.resumes.Report(),
+		Probes:         s.probes.Report(),
+	}
+	s.lock.Lock()
+	var values []float64
+	for _, sample := range s.samples {
+		if now.Sub(sample.time) <= window {
+			values = append(values, sample.throughput)
+		}
+	}
+	for pattern, endpoint := range s.endpoints {
+		counters := *endpoint
+		report.Endpoints[pattern] = &counters
+	}
+	report.Timelines = slices.Clone(s.timelines)
+	s.lock.Unlock()
+	if len(values) > 0 {
+		slices.Sort(values)
+		report.Throughput.Transfers = len(values)
+		report.Throughput.P50 = percentile(values, 0.50)
+		report.Throughput.P90 = percentile(values, 0.90)
+		report.Throughput.P99 = percentile(values, 0.99)
+		report.Throughput.Max = values[len(values)-1]
+	}
+	return report
+}
+
+// percentile returns the given percentile of the sorted values, using the nearest rank method.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+// StatsHandler is an HTTP handler that returns the statistics as a JSON document. The 'window' query parameter is
+// the duration of the window used to calculate the throughput percentiles, five minutes by default.
+type StatsHandler struct {
+	logger *slog.Logger
+	stats  *Stats
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	window := defaultStatsWindow
+	text := r.URL.Query().Get("window")
+	if text != "" {
+		value, err := time.ParseDuration(text)
+		if err != nil || value <= 0 {
+			http.Error(w, fmt.Sprintf("window '%s' should be a positive duration", text), http.StatusBadRequest)
+			return
+		}
+		window = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(h.stats.Report(window))
+	if err != nil {
+		h.logger.Error(
+			"Failed to send statistics",
+			slog.String("error", err.Error()),
+		)
+	}
+}
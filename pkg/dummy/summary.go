@@ -0,0 +1,192 @@
+package dummy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RequestSummary is the record written for each request to the summary output. The schema is stable, all the fields
+// are always present, so that it can be ingested by log pipelines. The size is the expected size of the body, from the
+// 'Content-Length' header or else from the 'size' query parameter, or -1 if it isn't known. The throughput is in bits
+// per second. The TLS version is empty for plain text connections.
+type RequestSummary struct {
+	Time          time.Time `json:"time"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Status        int       `json:"status"`
+	Size          int64     `json:"size"`
+	BytesSent     int64     `json:"bytes_sent"`
+	DurationMS    float64   `json:"duration_ms"`
+	ThroughputBPS float64   `json:"throughput_bps"`
+	ClientAddr    string    `json:"client_addr"`
+	Proto         string    `json:"proto"`
+	TLSVersion    string    `json:"tls_version"`
+	Aborted       bool      `json:"aborted"`
+}
+
+// SummaryHandler is an HTTP handler that writes a summary record for each request served by the wrapped handler, as a
+// single line of JSON, independently of the level and format of the log.
+type SummaryHandler struct {
+	logger  *slog.Logger
+	handler http.Handler
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewSummaryHandler wraps the given handler so that it writes the summary records to the given output, 'stdout',
+// 'stderr' or the name of a file, opened in append mode. If the output is empty it returns the given handler
+// unchanged.
+func NewSummaryHandler(logger *slog.Logger, handler http.Handler, output string) (result http.Handler, err error) {
+	var writer io.Writer
+	switch output {
+	case "":
+		result = handler
+		return
+	case "stdout":
+		writer = os.Stdout
+	case "stderr":
+		writer = os.Stderr
+	default:
+		writer, err = os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return
+		}
+	}
+	result = &SummaryHandler{
+		logger:  logger,
+		handler: handler,
+		encoder: json.NewEncoder(writer),
+	}
+	return
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *SummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	writer := &summaryWriter{
+		ResponseWriter: w,
+		size:           -1,
+	}
+	size, err := strconv.ParseInt(r.URL.Query().Get("size"), 10, 64)
+	if err == nil {
+		writer.size = size
+	}
+
+	// The record is written even if the handler panics to abort the response:
+	completed := false
+	defer func() {
+		h.write(r, writer, start, !completed)
+	}()
+	h.handler.ServeHTTP(writer, r)
+	completed = true
+}
+
+// write writes the summary record of a request.
+func (h *SummaryHandler) write(r *http.Request, w *summaryWriter, start time.Time, aborted bool) {
+	elapsed := time.Since(start)
+	summary := &RequestSummary{
+		Time:       start.UTC(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Status:     w.status,
+		Size:       w.size,
+		BytesSent:  w.bytes,
+		DurationMS: float64(elapsed) / float64(time.Millisecond),
+		ClientAddr: r.RemoteAddr,
+		Proto:      r.Proto,
+		Aborted:    aborted,
+	}
+	if summary.Status == 0 {
+		summary.Status = http.StatusOK
+	}
+	if elapsed > 0 {
+		summary.ThroughputBPS = float64(w.bytes*8) / elapsed.Seconds()
+	}
+	if r.TLS != nil {
+		summary.TLSVersion = tls.VersionName(r.TLS.Version)
+	}
+	h.lock.Lock()
+	err := h.encoder.Encode(summary)
+	h.lock.Unlock()
+	if err != nil {
+		h.logger.Error(
+			"Failed to write request summary",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// summaryWriter is a response writer that records the status code and the number of bytes of the body.
+type summaryWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	bytes  int64
+}
+
+// WriteHeader is the implementation of the http.ResponseWriter interface.
+func (w *summaryWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+		length, err := strconv.ParseInt(w.ResponseWriter.Header().Get("Content-Length"), 10, 64)
+		if err == nil {
+			w.size = length
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *summaryWriter) Write(p []byte) (n int, err error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err = w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return
+}
+
+// ReadFrom is the implementation of the io.ReaderFrom interface. It is needed so that the runtime can still use
+// sendfile to copy the blobs of the patterns.
+func (w *summaryWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	readerFrom, ok := w.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		n, err = io.Copy(struct{ io.Writer }{w}, r)
+		return
+	}
+	n, err = readerFrom.ReadFrom(r)
+	w.bytes += n
+	return
+}
+
+// Flush is the implementation of the http.Flusher interface.
+func (w *summaryWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack is the implementation of the http.Hijacker interface, needed by the WebSocket library. Hijacked connections
+// are reported with the 101 status code, and the bytes sent through them aren't counted.
+func (w *summaryWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buffer, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, buffer, err
+}
+
+// Unwrap returns the wrapped response writer, so that http.ResponseController can use it.
+func (w *summaryWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,138 @@
+package dummy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Network of the listeners that use the sockets passed by systemd with socket activation. The address of these
+// listeners is the name of the socket, set with the 'FileDescriptorName' option of the socket unit, or its index.
+const NetworkSystemd = "systemd"
+
+// First file descriptor passed by systemd, see sd_listen_fds(3).
+const systemdListenFDsStart = 3
+
+// systemdSocket is a socket passed by systemd.
+type systemdSocket struct {
+	name     string
+	listener net.Listener
+	used     bool
+}
+
+// systemdSockets are the sockets passed by systemd. They are loaded only once, because the environment variables are
+// removed after loading them, so that they aren't inherited by child processes.
+var systemdSockets struct {
+	once    sync.Once
+	lock    sync.Mutex
+	sockets []*systemdSocket
+	err     error
+}
+
+// loadSystemdSockets loads the sockets passed by systemd, if any.
+func loadSystemdSockets() ([]*systemdSocket, error) {
+	systemdSockets.once.Do(func() {
+		defer func() {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+			os.Unsetenv("LISTEN_FDNAMES")
+		}()
+		pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+		if err != nil || pid != os.Getpid() {
+			return
+		}
+		count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || count <= 0 {
+			return
+		}
+		var names []string
+		if os.Getenv("LISTEN_FDNAMES") != "" {
+			names = strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		}
+		for i := range count {
+			socket := &systemdSocket{
+				name: strconv.Itoa(i),
+			}
+			if i < len(names) {
+				socket.name = names[i]
+			}
+			file := os.NewFile(uintptr(systemdListenFDsStart+i), socket.name)
+			socket.listener, err = net.FileListener(file)
+			file.Close()
+			if err != nil {
+				systemdSockets.err = fmt.Errorf("socket %d '%s' passed by systemd isn't a listener: %w", i,
+					socket.name, err)
+				return
+			}
+			systemdSockets.sockets = append(systemdSockets.sockets, socket)
+		}
+	})
+	return systemdSockets.sockets, systemdSockets.err
+}
+
+// openSystemdListener returns the listener for the socket passed by systemd with the given name or index. Each socket
+// can be used only once.
+func openSystemdListener(address string) (result net.Listener, err error) {
+	sockets, err := loadSystemdSockets()
+	if err != nil {
+		return
+	}
+	if len(sockets) == 0 {
+		err = fmt.Errorf("no sockets have been passed by systemd")
+		return
+	}
+	systemdSockets.lock.Lock()
+	defer systemdSockets.lock.Unlock()
+	for i, socket := range sockets {
+		if socket.name != address && strconv.Itoa(i) != address {
+			continue
+		}
+		if socket.used {
+			err = fmt.Errorf("socket '%s' passed by systemd is already used", address)
+			return
+		}
+		socket.used = true
+		result = socket.listener
+		return
+	}
+	names := make([]string, len(sockets))
+	for i, socket := range sockets {
+		names[i] = socket.name
+	}
+	err = fmt.Errorf(
+		"socket '%s' hasn't been passed by systemd, valid names are '%s'",
+		address, strings.Join(names, "', '"),
+	)
+	return
+}
+
+// notifySystemd sends the given state to systemd, for example 'READY=1', see sd_notify(3). It does nothing, and returns
+// false, if the process hasn't been started by systemd with a notification socket.
+func notifySystemd(state string) (sent bool, err error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return
+	}
+
+	// Names starting with '@' are abstract sockets:
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: path,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return
+	}
+	sent = true
+	return
+}
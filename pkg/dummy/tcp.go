@@ -0,0 +1,110 @@
+package dummy
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+)
+
+// TCPConfig contains the settings of the TCP connections accepted by a listener, so that their impact on throughput
+// can be studied. Zero values mean to use the defaults of Go and of the operating system.
+type TCPConfig struct {
+	// NoDelay enables or disables the Nagle algorithm. Go disables it by default, so the default is true.
+	NoDelay *bool `json:"no_delay,omitempty"`
+
+	// SendBuffer and ReceiveBuffer are the sizes of the socket buffers in bytes. They are set in the listening
+	// socket, so that they are inherited by the accepted connections before the TCP handshake, which is needed for
+	// the window scaling to take them into account. Note that the operating system may adjust the values, for
+	// example Linux doubles them.
+	SendBuffer    int `json:"send_buffer,omitempty"`
+	ReceiveBuffer int `json:"receive_buffer,omitempty"`
+
+	// KeepAlive is the period of the TCP keep alive probes. Negative values disable them.
+	KeepAlive Duration `json:"keep_alive,omitempty"`
+}
+
+// validate checks that the TCP settings are valid.
+func (c *TCPConfig) validate() error {
+	if c.SendBuffer < 0 {
+		return fmt.Errorf("send buffer size %d is negative", c.SendBuffer)
+	}
+	if c.ReceiveBuffer < 0 {
+		return fmt.Errorf("receive buffer size %d is negative", c.ReceiveBuffer)
+	}
+	return nil
+}
+
+// listenConfig returns the configuration used to create the listening socket.
+func (c *TCPConfig) listenConfig() *net.ListenConfig {
+	return &net.ListenConfig{
+		KeepAlive: time.Duration(c.KeepAlive),
+		Control: func(network, address string, conn syscall.RawConn) error {
+			var err error
+			controlErr := conn.Control(func(fd uintptr) {
+				err = setSocketBuffers(fd, c.SendBuffer, c.ReceiveBuffer)
+			})
+			if controlErr != nil {
+				return controlErr
+			}
+			return err
+		},
+	}
+}
+
+// logTCPSettings writes to the log the requested TCP settings of the listener, and the socket buffer sizes that are
+// effectively used by the operating system.
+func logTCPSettings(logger *slog.Logger, name string, config *TCPConfig, listener *net.TCPListener) {
+	attrs := []any{
+		slog.String("name", name),
+		slog.Bool("no_delay", config.NoDelay == nil || *config.NoDelay),
+		slog.Int("send_buffer", config.SendBuffer),
+		slog.Int("receive_buffer", config.ReceiveBuffer),
+		slog.String("keep_alive", time.Duration(config.KeepAlive).String()),
+	}
+	var send, receive int
+	conn, err := listener.SyscallConn()
+	if err == nil {
+		controlErr := conn.Control(func(fd uintptr) {
+			send, receive, err = getSocketBuffers(fd)
+		})
+		if controlErr != nil {
+			err = controlErr
+		}
+	}
+	if err == nil {
+		attrs = append(
+			attrs,
+			slog.Int("effective_send_buffer", send),
+			slog.Int("effective_receive_buffer", receive),
+		)
+	} else {
+		attrs = append(attrs, slog.String("effective_error", err.Error()))
+	}
+	logger.Info("TCP settings", attrs...)
+}
+
+// tcpListener is a listener that applies to the accepted connections the TCP settings that can't be inherited from the
+// listening socket.
+type tcpListener struct {
+	net.Listener
+	noDelay bool
+}
+
+// Accept is the implementation of the net.Listener interface.
+func (l *tcpListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if ok {
+		err = tcpConn.SetNoDelay(l.noDelay)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package dummy
+
+import (
+	"errors"
+)
+
+// setSocketBuffers sets the sizes of the send and receive buffers of the socket. It is only supported in Unix like
+// systems.
+func setSocketBuffers(fd uintptr, send, receive int) error {
+	if send > 0 || receive > 0 {
+		return errors.New("socket buffer sizes are only supported in Unix like systems")
+	}
+	return nil
+}
+
+// getSocketBuffers returns the sizes of the send and receive buffers of the socket. It is only supported in Unix like
+// systems.
+func getSocketBuffers(fd uintptr) (send, receive int, err error) {
+	err = errors.New("socket buffer sizes are only supported in Unix like systems")
+	return
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package dummy
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setSocketBuffers sets the sizes of the send and receive buffers of the socket. Zero values aren't changed.
+func setSocketBuffers(fd uintptr, send, receive int) error {
+	if send > 0 {
+		err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF, send)
+		if err != nil {
+			return err
+		}
+	}
+	if receive > 0 {
+		err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF, receive)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSocketBuffers returns the sizes of the send and receive buffers of the socket.
+func getSocketBuffers(fd uintptr) (send, receive int, err error) {
+	send, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF)
+	if err != nil {
+		return
+	}
+	receive, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+	return
+}
@@ -0,0 +1,170 @@
+package dummy
+
+import (
+	"container/list"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default duration of the throttling windows.
+const defaultThrottleWindow = 10 * time.Second
+
+// Maximum duration of the throttling windows.
+const maxThrottleWindow = time.Hour
+
+// Maximum number of windows whose counters are remembered.
+const maxThrottleWindows = 100000
+
+// ThrottleLimit is the number of requests and bytes that a client can use during a window before it is throttled.
+// Zero means no limit.
+type ThrottleLimit struct {
+	Requests int64
+	Bytes    int64
+	Window   time.Duration
+}
+
+// parseThrottleLimit gets the throttling limit from the 'throttle_after', 'throttle_after_bytes' and
+// 'throttle_window' query parameters. The result is nil if the request isn't throttled.
+func parseThrottleLimit(query url.Values) (result *ThrottleLimit, err error) {
+	limit := &ThrottleLimit{
+		Window: defaultThrottleWindow,
+	}
+	text := query.Get("throttle_after")
+	if text != "" {
+		limit.Requests, err = strconv.ParseInt(text, 10, 64)
+		if err != nil || limit.Requests < 0 {
+			err = fmt.Errorf("throttle_after '%s' should be a positive number of requests", text)
+			return
+		}
+	}
+	text = query.Get("throttle_after_bytes")
+	if text != "" {
+		limit.Bytes, err = strconv.ParseInt(text, 10, 64)
+		if err != nil || limit.Bytes < 0 {
+			err = fmt.Errorf("throttle_after_bytes '%s' should be a positive number of bytes", text)
+			return
+		}
+	}
+	text = query.Get("throttle_window")
+	if text != "" {
+		limit.Window, err = time.ParseDuration(text)
+		if err != nil || limit.Window <= 0 {
+			err = fmt.Errorf("throttle_window '%s' should be a positive duration", text)
+			return
+		}
+		if limit.Window > maxThrottleWindow {
+			err = fmt.Errorf("throttle_window '%s' should be at most %s", text, maxThrottleWindow)
+			return
+		}
+	}
+	if limit.Requests > 0 || limit.Bytes > 0 {
+		result = limit
+	}
+	return
+}
+
+// throttleKey identifies the counters of a client. The limit is part of the key, so that tests that use different
+// limits don't interfere with each other.
+type throttleKey struct {
+	client string
+	limit  ThrottleLimit
+}
+
+// throttleWindow contains the requests and bytes used by a client during the current window.
+type throttleWindow struct {
+	key      throttleKey
+	start    time.Time
+	requests int64
+	bytes    int64
+}
+
+// ThrottleManager counts the requests and bytes of each client in fixed windows, and tells when the client has
+// exceeded the limit and for how long it has to wait, so that the backoff logic of clients can be tested
+// deterministically.
+//
+// No more than one hundred thousand windows are kept, and when that limit is reached the least recently used one is
+// forgotten, which resets its counters.
+type ThrottleManager struct {
+	// windows contains the windows of the clients, indexed by client and limit, and order contains the same windows
+	// sorted by time of last use, the most recent first.
+	lock    sync.Mutex
+	windows map[throttleKey]*list.Element
+	order   *list.List
+	swept   time.Time
+}
+
+// NewThrottleManager creates a manager without counters.
+func NewThrottleManager() *ThrottleManager {
+	return &ThrottleManager{
+		windows: map[throttleKey]*list.Element{},
+		order:   list.New(),
+		swept:   time.Now(),
+	}
+}
+
+// Check adds a request of the given number of bytes to the counters of the client, unless the client has already
+// reached the limit. In that case it returns the time till the end of the window, and the request isn't counted.
+func (m *ThrottleManager) Check(client string, limit ThrottleLimit, bytes int64) (retryAfter time.Duration,
+	throttled bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	m.sweep(now)
+	key := throttleKey{
+		client: client,
+		limit:  limit,
+	}
+	var window *throttleWindow
+	element := m.windows[key]
+	if element != nil {
+		window = element.Value.(*throttleWindow)
+		m.order.MoveToFront(element)
+	} else {
+		if m.order.Len() >= maxThrottleWindows {
+			m.forget(m.order.Back())
+		}
+		window = &throttleWindow{
+			key:   key,
+			start: now,
+		}
+		m.windows[key] = m.order.PushFront(window)
+	}
+	if now.Sub(window.start) >= limit.Window {
+		window.start = now
+		window.requests = 0
+		window.bytes = 0
+	}
+	throttled = (limit.Requests > 0 && window.requests >= limit.Requests) ||
+		(limit.Bytes > 0 && window.bytes >= limit.Bytes)
+	if throttled {
+		retryAfter = window.start.Add(limit.Window).Sub(now)
+		return
+	}
+	window.requests++
+	window.bytes += bytes
+	return
+}
+
+// sweep discards the counters of the windows that have ended. To avoid scanning the counters for every request it
+// runs at most once per minute.
+func (m *ThrottleManager) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for _, element := range m.windows {
+		window := element.Value.(*throttleWindow)
+		if now.Sub(window.start) >= window.key.limit.Window {
+			m.forget(element)
+		}
+	}
+}
+
+// forget removes a window. It must be called with the lock held.
+func (m *ThrottleManager) forget(element *list.Element) {
+	window := m.order.Remove(element).(*throttleWindow)
+	delete(m.windows, window.key)
+}
@@ -0,0 +1,104 @@
+package dummy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseThrottleLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected *ThrottleLimit
+		fail     string
+	}{
+		{
+			name:     "Not throttled",
+			query:    "",
+			expected: nil,
+		},
+		{
+			name:  "Default window",
+			query: "throttle_after=10",
+			expected: &ThrottleLimit{
+				Requests: 10,
+				Window:   defaultThrottleWindow,
+			},
+		},
+		{
+			name:  "Maximum window",
+			query: "throttle_after_bytes=1024&throttle_window=1h",
+			expected: &ThrottleLimit{
+				Bytes:  1024,
+				Window: time.Hour,
+			},
+		},
+		{
+			name:  "Window too long",
+			query: "throttle_after=10&throttle_window=1000000h",
+			fail:  "should be at most 1h0m0s",
+		},
+		{
+			name:  "Negative window",
+			query: "throttle_after=10&throttle_window=-1s",
+			fail:  "should be a positive duration",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+			limit, err := parseThrottleLimit(query)
+			if test.fail != "" {
+				if err == nil || !strings.Contains(err.Error(), test.fail) {
+					t.Fatalf("expected error containing '%s', but got %v", test.fail, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.expected == nil {
+				if limit != nil {
+					t.Fatalf("expected no limit, but got %+v", *limit)
+				}
+				return
+			}
+			if limit == nil || *limit != *test.expected {
+				t.Fatalf("expected %+v, but got %+v", *test.expected, limit)
+			}
+		})
+	}
+}
+
+func TestThrottleManagerWindowsAreBounded(t *testing.T) {
+	manager := NewThrottleManager()
+	limit := ThrottleLimit{
+		Requests: 1,
+		Window:   time.Hour,
+	}
+	for i := 0; i < maxThrottleWindows+10; i++ {
+		manager.Check(fmt.Sprintf("client-%d", i), limit, 0)
+	}
+	if len(manager.windows) != maxThrottleWindows || manager.order.Len() != maxThrottleWindows {
+		t.Fatalf(
+			"expected %d windows, but got %d indexed and %d ordered",
+			maxThrottleWindows, len(manager.windows), manager.order.Len(),
+		)
+	}
+
+	// The most recent client is still throttled, but the least recently used ones have been forgotten:
+	_, throttled := manager.Check(fmt.Sprintf("client-%d", maxThrottleWindows+9), limit, 0)
+	if !throttled {
+		t.Errorf("expected the most recent client to be throttled")
+	}
+	_, throttled = manager.Check("client-0", limit, 0)
+	if throttled {
+		t.Errorf("expected the least recently used client to be forgotten")
+	}
+}
@@ -0,0 +1,133 @@
+package dummy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Name of the response trailer that contains the timeline of the request.
+const timelineTrailer = "X-Dummy-Timeline"
+
+// Maximum number of timelines kept by the statistics.
+const maxStatsTimelines = 100
+
+// Names of the events of the timelines, in addition to the progress events, that are named after the percentage of
+// the body written, like 'progress_10':
+const (
+	timelineReceived  = "received"
+	timelineHeaders   = "headers"
+	timelineFirstByte = "first_byte"
+	timelineCompleted = "completed"
+	timelineTruncated = "truncated"
+	timelineFailed    = "failed"
+)
+
+// TimelineEvent is a notable event of a request. The offset is the time since the request was received, and the bytes
+// are the bytes of the body written when the event happened.
+type TimelineEvent struct {
+	Name   string   `json:"name"`
+	Offset Duration `json:"offset"`
+	Bytes  int64    `json:"bytes"`
+}
+
+// RequestTimeline contains the events of a request, to debug where time goes in slow transfers.
+type RequestTimeline struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Query  string          `json:"query,omitempty"`
+	Start  time.Time       `json:"start"`
+	Events []TimelineEvent `json:"events"`
+}
+
+// String returns the timeline in the format used by the trailer, the names of the events and the offsets separated by
+// commas, for example 'received=0s,headers=1.2ms,first_byte=1.3ms'.
+func (t *RequestTimeline) String() string {
+	items := make([]string, len(t.Events))
+	for i, event := range t.Events {
+		items[i] = fmt.Sprintf("%s=%s", event.Name, time.Duration(event.Offset))
+	}
+	return strings.Join(items, ",")
+}
+
+// timelineRecorder records the timeline of a request. A nil recorder ignores all the events, so that the handlers
+// don't need to check if the timeline is enabled.
+type timelineRecorder struct {
+	timeline RequestTimeline
+	total    int64
+	bytes    int64
+	decile   int64
+}
+
+// newTimelineRecorder creates a recorder for the given request, received at the given time, that will write a body of
+// the given size.
+func newTimelineRecorder(r *http.Request, start time.Time, total int64) *timelineRecorder {
+	recorder := &timelineRecorder{
+		timeline: RequestTimeline{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Start:  start,
+			Events: []TimelineEvent{{
+				Name: timelineReceived,
+			}},
+		},
+		total:  total,
+		decile: 1,
+	}
+	return recorder
+}
+
+// record adds an event to the timeline.
+func (t *timelineRecorder) record(name string) {
+	if t == nil {
+		return
+	}
+	t.timeline.Events = append(t.timeline.Events, TimelineEvent{
+		Name:   name,
+		Offset: Duration(time.Since(t.timeline.Start)),
+		Bytes:  t.bytes,
+	})
+}
+
+// wrote records that the given number of bytes of the body have been written, adding the first byte event and an
+// event for each 10% of the body.
+func (t *timelineRecorder) wrote(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	if t.bytes == 0 {
+		t.bytes = int64(n)
+		t.record(timelineFirstByte)
+	} else {
+		t.bytes += int64(n)
+	}
+	for t.decile < 10 && t.bytes*10 >= t.total*t.decile {
+		t.record(fmt.Sprintf("progress_%d", t.decile*10))
+		t.decile++
+	}
+}
+
+// finish adds the final event to the timeline, and adds the timeline to the statistics.
+func (t *timelineRecorder) finish(stats *Stats, name string) {
+	if t == nil {
+		return
+	}
+	t.record(name)
+	stats.RecordTimeline(t.timeline)
+}
+
+// timelineWriter is a writer that records in a timeline the bytes written.
+type timelineWriter struct {
+	writer   io.Writer
+	recorder *timelineRecorder
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *timelineWriter) Write(p []byte) (n int, err error) {
+	n, err = w.writer.Write(p)
+	w.recorder.wrote(n)
+	return
+}
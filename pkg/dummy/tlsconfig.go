@@ -0,0 +1,187 @@
+package dummy
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// tlsVersions are the names of the TLS versions that can be used in the configuration.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ticketKeysKept is the number of session ticket keys kept when they are rotated. The first one is used to encrypt new
+// tickets, and all of them to decrypt, so a ticket is valid for that number of rotation periods.
+const ticketKeysKept = 3
+
+// validate checks that the versions and the cipher suites are valid.
+func (c *ListenerTLSConfig) validate() error {
+	_, _, err := c.versions()
+	if err != nil {
+		return err
+	}
+	_, err = c.cipherSuites()
+	if err != nil {
+		return err
+	}
+	if c.TicketRotation < 0 {
+		return fmt.Errorf("ticket key rotation period %s is negative", time.Duration(c.TicketRotation))
+	}
+	return nil
+}
+
+// versions returns the minimum and maximum TLS versions, zero when they aren't set.
+func (c *ListenerTLSConfig) versions() (minVersion, maxVersion uint16, err error) {
+	var ok bool
+	if c.MinVersion != "" {
+		minVersion, ok = tlsVersions[c.MinVersion]
+		if !ok {
+			err = fmt.Errorf("minimum TLS version '%s' isn't valid, it should be '1.0', '1.1', '1.2' or '1.3'",
+				c.MinVersion)
+			return
+		}
+	}
+	if c.MaxVersion != "" {
+		maxVersion, ok = tlsVersions[c.MaxVersion]
+		if !ok {
+			err = fmt.Errorf("maximum TLS version '%s' isn't valid, it should be '1.0', '1.1', '1.2' or '1.3'",
+				c.MaxVersion)
+			return
+		}
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		err = fmt.Errorf("minimum TLS version '%s' is greater than maximum '%s'", c.MinVersion, c.MaxVersion)
+	}
+	return
+}
+
+// cipherSuites returns the identifiers of the cipher suites, including the insecure ones, nil when they aren't set.
+func (c *ListenerTLSConfig) cipherSuites() (result []uint16, err error) {
+	if len(c.CipherSuites) == 0 {
+		return
+	}
+	ids := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+	for _, name := range c.CipherSuites {
+		id, ok := ids[name]
+		if !ok {
+			err = fmt.Errorf("cipher suite '%s' isn't supported", name)
+			return
+		}
+		result = append(result, id)
+	}
+	return
+}
+
+// newTLSConfig creates the TLS configuration of a listener, loading the given certificate and key files. The negotiated
+// parameters of each connection are written to the log with the debug level.
+func newTLSConfig(logger *slog.Logger, name string, config *ListenerTLSConfig, crtFile,
+	keyFile string) (result *tls.Config, err error) {
+	if config == nil {
+		config = &ListenerTLSConfig{}
+	}
+	certificate, err := tls.LoadX509KeyPair(crtFile, keyFile)
+	if err != nil {
+		err = fmt.Errorf("failed to load TLS certificate: %w", err)
+		return
+	}
+	minVersion, maxVersion, err := config.versions()
+	if err != nil {
+		return
+	}
+	cipherSuites, err := config.cipherSuites()
+	if err != nil {
+		return
+	}
+	result = &tls.Config{
+		Certificates:           []tls.Certificate{certificate},
+		NextProtos:             []string{"h2", "http/1.1"},
+		MinVersion:             minVersion,
+		MaxVersion:             maxVersion,
+		CipherSuites:           cipherSuites,
+		SessionTicketsDisabled: config.SessionTickets != nil && !*config.SessionTickets,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			logger.Debug(
+				"TLS handshake completed",
+				slog.String("listener", name),
+				slog.String("version", tls.VersionName(state.Version)),
+				slog.String("cipher_suite", tls.CipherSuiteName(state.CipherSuite)),
+				slog.String("protocol", state.NegotiatedProtocol),
+				slog.String("server_name", state.ServerName),
+				slog.Bool("resumed", state.DidResume),
+			)
+			return nil
+		},
+	}
+	if config.TicketRotation > 0 && !result.SessionTicketsDisabled {
+		err = rotateTicketKeys(logger, name, result, time.Duration(config.TicketRotation))
+		if err != nil {
+			return
+		}
+	}
+	logger.Info(
+		"TLS settings",
+		slog.String("listener", name),
+		slog.String("min_version", config.MinVersion),
+		slog.String("max_version", config.MaxVersion),
+		slog.Any("cipher_suites", config.CipherSuites),
+		slog.Bool("session_tickets", !result.SessionTicketsDisabled),
+		slog.String("ticket_rotation", time.Duration(config.TicketRotation).String()),
+		slog.Bool("ktls", config.KTLS),
+	)
+	return
+}
+
+// rotateTicketKeys sets a new session ticket key in the given configuration, and then starts a goroutine that replaces
+// it with a new one every period, keeping the previous ones so that recent tickets can still be used.
+func rotateTicketKeys(logger *slog.Logger, name string, config *tls.Config, period time.Duration) error {
+	var keys [][32]byte
+	rotate := func() error {
+		var key [32]byte
+		_, err := rand.Read(key[:])
+		if err != nil {
+			return err
+		}
+		keys = append([][32]byte{key}, keys...)
+		if len(keys) > ticketKeysKept {
+			keys = keys[:ticketKeysKept]
+		}
+		config.SetSessionTicketKeys(keys)
+		return nil
+	}
+	err := rotate()
+	if err != nil {
+		return fmt.Errorf("failed to generate session ticket key: %w", err)
+	}
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for range ticker.C {
+			err := rotate()
+			if err != nil {
+				logger.Error(
+					"Failed to rotate session ticket keys",
+					slog.String("listener", name),
+					slog.String("error", err.Error()),
+				)
+				continue
+			}
+			logger.Debug(
+				"Rotated session ticket keys",
+				slog.String("listener", name),
+			)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,96 @@
+package dummy
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ClientTiming contains the durations of the phases of a request. The DNS, connect and TLS phases are zero when the
+// connection is reused. TTFB is the time from the start of the request till the first byte of the response, and
+// Transfer is the time from then till the end of the body.
+type ClientTiming struct {
+	DNS      Duration `json:"dns,omitempty"`
+	Connect  Duration `json:"connect,omitempty"`
+	TLS      Duration `json:"tls,omitempty"`
+	TTFB     Duration `json:"ttfb"`
+	Transfer Duration `json:"transfer"`
+	Reused   bool     `json:"reused"`
+}
+
+// timingTracer measures the phases of a request using the hooks of the httptrace package. Note that the hooks may be
+// called from different goroutines, so the access to the times is protected by a lock.
+type timingTracer struct {
+	lock         sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	firstByte    time.Time
+	timing       ClientTiming
+}
+
+// newTimingTracer creates a tracer and returns a context that activates it for the requests that use it.
+func newTimingTracer(ctx context.Context) (tracer *timingTracer, result context.Context) {
+	tracer = &timingTracer{
+		start: time.Now(),
+	}
+	result = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tracer.lock.Lock()
+			defer tracer.lock.Unlock()
+			tracer.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tracer.lock.Lock()
+			defer tracer.lock.Unlock()
+			tracer.timing.DNS = Duration(time.Since(tracer.dnsStart))
+		},
+		ConnectStart: func(string, string) {
+			tracer.lock.Lock()
+			defer tracer.lock.Unlock()
+			tracer.connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			tracer.lock.Lock()
+			defer tracer.lock.Unlock()
+			tracer.timing.Connect = Duration(time.Since(tracer.connectStart))
+		},
+		TLSHandshakeStart: func() {
+			tracer.lock.Lock()
+			defer tracer.lock.Unlock()
+			tracer.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tracer.lock.Lock()
+			defer tracer.lock.Unlock()
+			tracer.timing.TLS = Duration(time.Since(tracer.tlsStart))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			tracer.lock.Lock()
+			defer tracer.lock.Unlock()
+			tracer.timing.Reused = info.Reused
+		},
+		GotFirstResponseByte: func() {
+			tracer.lock.Lock()
+			defer tracer.lock.Unlock()
+			tracer.firstByte = time.Now()
+			tracer.timing.TTFB = Duration(tracer.firstByte.Sub(tracer.start))
+		},
+	})
+	return
+}
+
+// finish calculates the duration of the transfer, and returns the timing. It should be called when the body has been
+// read completely.
+func (t *timingTracer) finish() *ClientTiming {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.firstByte.IsZero() {
+		t.timing.Transfer = Duration(time.Since(t.firstByte))
+	}
+	result := t.timing
+	return &result
+}
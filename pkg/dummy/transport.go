@@ -0,0 +1,224 @@
+package dummy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTP protocols that can be forced in the client transport:
+const (
+	ProtocolHTTP1 = "http1"
+	ProtocolHTTP2 = "http2"
+)
+
+// TransportOptions contains the settings of the HTTP transport used by the client and the load generator, so that
+// realistic client configurations can be reproduced.
+type TransportOptions struct {
+	// Insecure disables the verification of the TLS certificate of the server.
+	Insecure bool
+
+	// CAFile is the name of a PEM file containing the certificates of the authorities trusted to verify the
+	// certificate of the server. The default is to use the system trust store.
+	CAFile string
+
+	// CertFile and KeyFile are the names of the PEM files containing the certificate and the key that the client
+	// presents to the server. The default is to not present a certificate.
+	CertFile string
+	KeyFile  string
+
+	// Proxy is the URL of the proxy. The scheme can be 'http' or 'https' for HTTP proxies, that use the CONNECT
+	// method for TLS targets, or 'socks5' and 'socks5h' for SOCKS5 proxies. The credentials can be included in the URL.
+	// The default is to use the proxy configured in the 'HTTP_PROXY', 'HTTPS_PROXY' and 'NO_PROXY' environment
+	// variables.
+	Proxy string
+
+	// ProxyUser contains the credentials used to authenticate to the proxy, in the 'user:password' format. They
+	// replace the ones included in the proxy URL, if any.
+	ProxyUser string
+
+	// ProxyTunnel forces the use of the CONNECT method of HTTP proxies also for plain text targets, which are
+	// otherwise sent to the proxy as regular requests.
+	ProxyTunnel bool
+
+	// Resolve contains addresses that replace the ones resolved by the DNS, in the 'host:port:address' format used
+	// by curl. For example 'example.com:443:127.0.0.1' sends the connections to 'example.com' port 443 to the local
+	// host.
+	Resolve []string
+
+	// Protocol is the HTTP version, 'http1' or 'http2'. The default is to negotiate it with the server, preferring
+	// HTTP/2. Note that HTTP/2 requires TLS, and that the server can still choose HTTP/1 if it doesn't support it.
+	Protocol string
+
+	// DisableReuse disables the reuse of connections, so that each request opens a new one.
+	DisableReuse bool
+
+	// ConnectTimeout is the maximum time to establish a TCP connection.
+	ConnectTimeout time.Duration
+
+	// TLSTimeout is the maximum time to complete the TLS handshake.
+	TLSTimeout time.Duration
+
+	// ResponseTimeout is the maximum time to wait for the response headers after sending the request.
+	ResponseTimeout time.Duration
+
+	// Timeout is the maximum duration of a complete request, including reading the body. It is applied by the HTTP
+	// client, not by the transport.
+	Timeout time.Duration
+}
+
+// NewTransport creates an HTTP transport with the given options.
+func NewTransport(options TransportOptions) (result *http.Transport, err error) {
+	// Prepare the TLS configuration:
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: options.Insecure,
+	}
+	if options.CAFile != "" {
+		var data []byte
+		data, err = os.ReadFile(options.CAFile)
+		if err != nil {
+			err = fmt.Errorf("failed to read CA file: %w", err)
+			return
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			err = fmt.Errorf("CA file '%s' doesn't contain any certificate", options.CAFile)
+			return
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if options.CertFile != "" || options.KeyFile != "" {
+		var certificate tls.Certificate
+		certificate, err = tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			err = fmt.Errorf("failed to load client certificate: %w", err)
+			return
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	// Prepare the proxy:
+	proxy := http.ProxyFromEnvironment
+	var proxyURL *url.URL
+	if options.Proxy != "" {
+		proxyURL, err = parseProxy(options.Proxy, options.ProxyUser)
+		if err != nil {
+			return
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	if options.ProxyTunnel && (proxyURL == nil || !strings.HasPrefix(proxyURL.Scheme, "http")) {
+		err = fmt.Errorf("tunneling requires an HTTP proxy")
+		return
+	}
+
+	// Prepare the dialer, replacing the addresses that are overridden:
+	overrides := map[string]string{}
+	for _, entry := range options.Resolve {
+		host, port, address, ok := parseResolve(entry)
+		if !ok {
+			err = fmt.Errorf(
+				"address override '%s' isn't valid, it should be 'host:port:address'",
+				entry,
+			)
+			return
+		}
+		overrides[net.JoinHostPort(host, port)] = net.JoinHostPort(address, port)
+	}
+	dialer := &net.Dialer{
+		Timeout:   options.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		override, ok := overrides[address]
+		if ok {
+			address = override
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	// When tunneling the transport doesn't know about the proxy, the dial function opens the tunnel instead:
+	if options.ProxyTunnel {
+		proxy = nil
+		tunnel := &proxyTunnel{
+			proxy:     proxyURL,
+			next:      dial,
+			tlsConfig: tlsConfig,
+		}
+		dial = tunnel.dial
+	}
+
+	// Create the transport:
+	result = &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dial,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   options.TLSTimeout,
+		ResponseHeaderTimeout: options.ResponseTimeout,
+		DisableKeepAlives:     options.DisableReuse,
+		ForceAttemptHTTP2:     true,
+	}
+	switch options.Protocol {
+	case "", ProtocolHTTP2:
+	case ProtocolHTTP1:
+		result.ForceAttemptHTTP2 = false
+		result.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	default:
+		err = fmt.Errorf(
+			"protocol should be '%s' or '%s', but it is '%s'",
+			ProtocolHTTP1, ProtocolHTTP2, options.Protocol,
+		)
+		result = nil
+	}
+	return
+}
+
+// parseProxy parses the proxy URL, checks that the scheme is supported, and adds the credentials, if any.
+func parseProxy(text, user string) (result *url.URL, err error) {
+	result, err = url.Parse(text)
+	if err != nil {
+		err = fmt.Errorf("proxy URL '%s' isn't valid: %w", text, err)
+		return
+	}
+	switch result.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		err = fmt.Errorf(
+			"proxy scheme should be 'http', 'https', 'socks5' or 'socks5h', but it is '%s'",
+			result.Scheme,
+		)
+		return
+	}
+	if user != "" {
+		name, password, ok := strings.Cut(user, ":")
+		if ok {
+			result.User = url.UserPassword(name, password)
+		} else {
+			result.User = url.User(name)
+		}
+	}
+	return
+}
+
+// parseResolve parses an address override in the 'host:port:address' format. IPv6 addresses can be written with or
+// without brackets.
+func parseResolve(entry string) (host, port, address string, ok bool) {
+	host, rest, ok := strings.Cut(entry, ":")
+	if !ok || host == "" {
+		return
+	}
+	port, address, ok = strings.Cut(rest, ":")
+	if !ok || port == "" || address == "" {
+		ok = false
+		return
+	}
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	return
+}
@@ -0,0 +1,159 @@
+package dummy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Name of the response trailer that indicates that the body was truncated because it exceeded a limit of the server,
+// and the values that indicate which limit.
+const (
+	truncatedTrailer       = "X-Dummy-Truncated"
+	truncatedReasonBytes   = "max-bytes"
+	truncatedReasonTimeout = "max-duration"
+)
+
+// errResponseTruncated is returned by the writes of responses that have exceeded a limit of the server.
+var errResponseTruncated = errors.New("response truncated because it exceeded a limit of the server")
+
+// TruncateHandler is an HTTP handler that stops the responses of the wrapped handler that exceed the maximum number of
+// bytes or the maximum duration of the server. The body ends cleanly and the 'X-Dummy-Truncated' trailer tells the
+// client which limit was exceeded. Trailers can't be used with a fixed length body, so the 'Content-Length' header is
+// removed from the responses that may be truncated: all of them when there is a maximum duration, and the ones that
+// are larger than the maximum number of bytes otherwise.
+type TruncateHandler struct {
+	logger      *slog.Logger
+	handler     http.Handler
+	maxBytes    int64
+	maxDuration time.Duration
+}
+
+// NewTruncateHandler wraps the given handler so that it enforces the per request limits. If there are no limits it
+// returns the given handler unchanged.
+func NewTruncateHandler(logger *slog.Logger, handler http.Handler, limits LimitsConfig) http.Handler {
+	if limits.MaxBytesPerRequest == 0 && limits.MaxDuration == 0 {
+		return handler
+	}
+	return &TruncateHandler{
+		logger:      logger,
+		handler:     handler,
+		maxBytes:    limits.MaxBytesPerRequest,
+		maxDuration: time.Duration(limits.MaxDuration),
+	}
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *TruncateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	writer := &truncateWriter{
+		ResponseWriter: w,
+		handler:        h,
+	}
+
+	// When the duration is exceeded cancel the request, so that handlers that are waiting stop even if they aren't
+	// writing:
+	if h.maxDuration > 0 {
+		timer := time.AfterFunc(h.maxDuration, func() {
+			writer.truncate(truncatedReasonTimeout)
+			cancel()
+		})
+		defer timer.Stop()
+	}
+	h.handler.ServeHTTP(writer, r.WithContext(ctx))
+	reason := writer.reason()
+	if reason == "" {
+		return
+	}
+	w.Header().Set(http.TrailerPrefix+truncatedTrailer, reason)
+	h.logger.Info(
+		"Truncated response",
+		slog.String("path", r.URL.Path),
+		slog.String("reason", reason),
+		slog.Int64("bytes", writer.written),
+	)
+}
+
+// truncateWriter is a response writer that stops writing when the response exceeds one of the limits.
+type truncateWriter struct {
+	http.ResponseWriter
+	handler   *TruncateHandler
+	lock      sync.Mutex
+	truncated string
+	written   int64
+	started   bool
+}
+
+// truncate records that the response has been truncated for the given reason, unless it was already truncated.
+func (w *truncateWriter) truncate(reason string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.truncated == "" {
+		w.truncated = reason
+	}
+}
+
+// reason returns the reason why the response was truncated, or an empty string if it wasn't.
+func (w *truncateWriter) reason() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.truncated
+}
+
+// WriteHeader is the implementation of the http.ResponseWriter interface.
+func (w *truncateWriter) WriteHeader(status int) {
+	if !w.started && status >= http.StatusOK {
+		w.started = true
+		header := w.ResponseWriter.Header()
+		length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if w.handler.maxDuration > 0 || (w.handler.maxBytes > 0 && err == nil && length > w.handler.maxBytes) {
+			header.Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write is the implementation of the io.Writer interface.
+func (w *truncateWriter) Write(p []byte) (n int, err error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.reason() != "" {
+		err = errResponseTruncated
+		return
+	}
+	allowed := int64(len(p))
+	if w.handler.maxBytes > 0 {
+		allowed = min(allowed, w.handler.maxBytes-w.written)
+	}
+	n, err = w.ResponseWriter.Write(p[:allowed])
+	w.written += int64(n)
+	if err == nil && allowed < int64(len(p)) {
+		w.truncate(truncatedReasonBytes)
+		err = errResponseTruncated
+	}
+	return
+}
+
+// Flush is the implementation of the http.Flusher interface.
+func (w *truncateWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack is the implementation of the http.Hijacker interface, needed by the WebSocket library. Note that the limits
+// don't apply to hijacked connections.
+func (w *truncateWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped response writer, so that http.ResponseController can use it.
+func (w *truncateWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,233 @@
+package dummy
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Modes of the pinning of connections to processors:
+const (
+	PinModeCPU  = "cpu"
+	PinModeNode = "node"
+)
+
+// CPUTopology describes the processors available to the process, so that the results of tests run in large NUMA
+// servers can be reproduced.
+type CPUTopology struct {
+	// CPUs is the number of logical processors of the system.
+	CPUs int
+
+	// GOMAXPROCS is the number of processors that can run Go code simultaneously.
+	GOMAXPROCS int
+
+	// Affinity is the set of processors that the process is allowed to run on.
+	Affinity []int
+
+	// Nodes are the NUMA nodes of the system, empty if they aren't known.
+	Nodes []NUMANode
+}
+
+// NUMANode describes a NUMA node and its processors.
+type NUMANode struct {
+	ID   int
+	CPUs []int
+}
+
+// LoadCPUTopology returns the topology of the processors of the system.
+func LoadCPUTopology() (result *CPUTopology, err error) {
+	affinity, err := getCPUAffinity()
+	if err != nil {
+		err = fmt.Errorf("failed to get processor affinity: %w", err)
+		return
+	}
+	nodes, err := loadNUMANodes()
+	if err != nil {
+		err = fmt.Errorf("failed to load NUMA nodes: %w", err)
+		return
+	}
+	result = &CPUTopology{
+		CPUs:       runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Affinity:   affinity,
+		Nodes:      nodes,
+	}
+	return
+}
+
+// LogAttrs returns the attributes used to write the topology to the log.
+func (t *CPUTopology) LogAttrs() []any {
+	nodes := make([]string, len(t.Nodes))
+	for i, node := range t.Nodes {
+		nodes[i] = fmt.Sprintf("%d:%s", node.ID, FormatCPUList(node.CPUs))
+	}
+	return []any{
+		slog.Int("cpus", t.CPUs),
+		slog.Int("gomaxprocs", t.GOMAXPROCS),
+		slog.String("affinity", FormatCPUList(t.Affinity)),
+		slog.Any("nodes", nodes),
+	}
+}
+
+// SetCPUAffinity restricts all the threads of the process to the given processors. Threads created later inherit the
+// restriction. It returns the processors that the process is actually allowed to run on, which excludes the ones that
+// don't exist. It is only supported in Linux.
+func SetCPUAffinity(cpus []int) (result []int, err error) {
+	if len(cpus) == 0 {
+		err = fmt.Errorf("list of processors is empty")
+		return
+	}
+	err = setProcessAffinity(cpus)
+	if err != nil {
+		return
+	}
+	result, err = getCPUAffinity()
+	return
+}
+
+// ParseCPUList parses a list of processors in the format used by the Linux kernel, for example '0-3,8,10-11'.
+func ParseCPUList(text string) (result []int, err error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	for _, item := range strings.Split(text, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		var start, end int
+		start, err = strconv.Atoi(first)
+		if err == nil {
+			end = start
+			if isRange {
+				end, err = strconv.Atoi(last)
+			}
+		}
+		if err != nil || start < 0 || end < start {
+			err = fmt.Errorf("'%s' isn't a valid processor or range of processors", item)
+			return
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			result = append(result, cpu)
+		}
+	}
+	slices.Sort(result)
+	result = slices.Compact(result)
+	return
+}
+
+// FormatCPUList formats a sorted list of processors in the format used by the Linux kernel, for example '0-3,8'.
+func FormatCPUList(cpus []int) string {
+	var items []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if j == i {
+			items = append(items, strconv.Itoa(cpus[i]))
+		} else {
+			items = append(items, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(items, ",")
+}
+
+// cpuPinner assigns the connections to processors, or to NUMA nodes, in round robin, and pins the threads that serve
+// them. Go doesn't support pinning goroutines, so this is done by locking the goroutine to its thread and then
+// changing the affinity of the thread, which is only a hint: the runtime may still need other threads, for example for
+// the system calls.
+type cpuPinner struct {
+	groups   [][]int
+	affinity []int
+	next     atomic.Uint64
+}
+
+// newCPUPinner creates a pinner for the given mode. It returns nil if the mode is empty.
+func newCPUPinner(mode string, topology *CPUTopology) (result *cpuPinner, err error) {
+	var groups [][]int
+	switch mode {
+	case "":
+		return
+	case PinModeCPU:
+		for _, cpu := range topology.Affinity {
+			groups = append(groups, []int{cpu})
+		}
+	case PinModeNode:
+		for _, node := range topology.Nodes {
+			var group []int
+			for _, cpu := range node.CPUs {
+				if slices.Contains(topology.Affinity, cpu) {
+					group = append(group, cpu)
+				}
+			}
+			if len(group) > 0 {
+				groups = append(groups, group)
+			}
+		}
+		if len(groups) == 0 {
+			err = fmt.Errorf("NUMA nodes aren't known")
+			return
+		}
+	default:
+		err = fmt.Errorf(
+			"pin mode '%s' isn't supported, valid values are '%s' and '%s'",
+			mode, PinModeCPU, PinModeNode,
+		)
+		return
+	}
+
+	// Check that the affinity of the threads can be changed, setting it to the value that it already has:
+	runtime.LockOSThread()
+	err = setThreadAffinity(topology.Affinity)
+	runtime.UnlockOSThread()
+	if err != nil {
+		return
+	}
+	result = &cpuPinner{
+		groups:   groups,
+		affinity: topology.Affinity,
+	}
+	return
+}
+
+// pin locks the calling goroutine to its thread and restricts the thread to the next group of processors. The
+// returned function restores the affinity of the thread and unlocks it. Errors are ignored, as pinning is only a hint.
+func (p *cpuPinner) pin() func() {
+	if p == nil {
+		return func() {}
+	}
+	group := p.groups[(p.next.Add(1)-1)%uint64(len(p.groups))]
+	runtime.LockOSThread()
+	err := setThreadAffinity(group)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return func() {}
+	}
+	return func() {
+		err := setThreadAffinity(p.affinity)
+		if err != nil {
+			// The thread can't be returned to the pool of threads with the wrong affinity, so we don't unlock
+			// it, and the runtime will terminate it when the goroutine finishes.
+			return
+		}
+		runtime.UnlockOSThread()
+	}
+}
+
+// wrap returns a handler that pins the goroutines that serve the requests. With HTTP/1 the requests of a connection
+// are served by the same goroutine, so this pins the connection. It returns the given handler unchanged if the pinner
+// is nil.
+func (p *cpuPinner) wrap(handler http.Handler) http.Handler {
+	if p == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer p.pin()()
+		handler.ServeHTTP(w, r)
+	})
+}
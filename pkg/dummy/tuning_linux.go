@@ -0,0 +1,110 @@
+//go:build linux
+
+package dummy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Directory where the kernel describes the NUMA nodes.
+const numaNodesDir = "/sys/devices/system/node"
+
+// getCPUAffinity returns the processors that the calling thread is allowed to run on.
+func getCPUAffinity() (result []int, err error) {
+	var set unix.CPUSet
+	err = unix.SchedGetaffinity(0, &set)
+	if err != nil {
+		return
+	}
+	for cpu := 0; cpu < len(set)*64; cpu++ {
+		if set.IsSet(cpu) {
+			result = append(result, cpu)
+		}
+	}
+	return
+}
+
+// setProcessAffinity restricts all the threads of the process to the given processors.
+func setProcessAffinity(cpus []int) error {
+	set, err := makeCPUSet(cpus)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		err = unix.SchedSetaffinity(tid, &set)
+		if err != nil && !errors.Is(err, unix.ESRCH) {
+			return err
+		}
+	}
+	return nil
+}
+
+// setThreadAffinity restricts the calling thread to the given processors.
+func setThreadAffinity(cpus []int) error {
+	set, err := makeCPUSet(cpus)
+	if err != nil {
+		return err
+	}
+	return unix.SchedSetaffinity(0, &set)
+}
+
+func makeCPUSet(cpus []int) (result unix.CPUSet, err error) {
+	for _, cpu := range cpus {
+		if cpu >= len(result)*64 {
+			err = fmt.Errorf("processor %d is out of range", cpu)
+			return
+		}
+		result.Set(cpu)
+	}
+	return
+}
+
+// loadNUMANodes loads the NUMA nodes and their processors from the files that the kernel provides. It returns an empty
+// list if the kernel doesn't provide them.
+func loadNUMANodes() (result []NUMANode, err error) {
+	paths, err := filepath.Glob(filepath.Join(numaNodesDir, "node[0-9]*"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		var id int
+		id, err = strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "node"))
+		if err != nil {
+			return
+		}
+		var data []byte
+		data, err = os.ReadFile(filepath.Join(path, "cpulist"))
+		if err != nil {
+			return
+		}
+		var cpus []int
+		cpus, err = ParseCPUList(string(data))
+		if err != nil {
+			return
+		}
+		result = append(result, NUMANode{
+			ID:   id,
+			CPUs: cpus,
+		})
+	}
+	slices.SortFunc(result, func(a, b NUMANode) int {
+		return a.ID - b.ID
+	})
+	return
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+
+package dummy
+
+import (
+	"errors"
+	"runtime"
+)
+
+// errAffinityUnsupported is returned when the affinity of the process or the threads is changed in a system that isn't
+// Linux.
+var errAffinityUnsupported = errors.New("processor affinity is only supported in Linux")
+
+// getCPUAffinity returns the processors that the process is allowed to run on. The affinity isn't known in systems
+// that aren't Linux, so it returns all the processors.
+func getCPUAffinity() (result []int, err error) {
+	for cpu := range runtime.NumCPU() {
+		result = append(result, cpu)
+	}
+	return
+}
+
+// setProcessAffinity restricts the process to the given processors. It is only supported in Linux.
+func setProcessAffinity(cpus []int) error {
+	return errAffinityUnsupported
+}
+
+// setThreadAffinity restricts the calling thread to the given processors. It is only supported in Linux.
+func setThreadAffinity(cpus []int) error {
+	return errAffinityUnsupported
+}
+
+// loadNUMANodes loads the NUMA nodes. They aren't known in systems that aren't Linux.
+func loadNUMANodes() (result []NUMANode, err error) {
+	return
+}
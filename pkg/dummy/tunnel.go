@@ -0,0 +1,113 @@
+package dummy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// proxyTunnel opens connections through an HTTP proxy using the CONNECT method, so that the proxy forwards the bytes
+// without looking at them, also for plain text targets.
+type proxyTunnel struct {
+	proxy     *url.URL
+	next      func(ctx context.Context, network, address string) (net.Conn, error)
+	tlsConfig *tls.Config
+}
+
+// dial opens a connection to the proxy and asks it to connect to the given address.
+func (t *proxyTunnel) dial(ctx context.Context, network, address string) (result net.Conn, err error) {
+	// Connect to the proxy, using TLS if needed:
+	proxyAddress := t.proxy.Host
+	if t.proxy.Port() == "" {
+		port := "80"
+		if t.proxy.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddress = net.JoinHostPort(t.proxy.Hostname(), port)
+	}
+	conn, err := t.next(ctx, network, proxyAddress)
+	if err != nil {
+		return
+	}
+	if t.proxy.Scheme == "https" {
+		tlsConfig := t.tlsConfig.Clone()
+		tlsConfig.ServerName = t.proxy.Hostname()
+		tlsConfig.NextProtos = nil
+		tlsConn := tls.Client(conn, tlsConfig)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		conn = tlsConn
+	}
+
+	// Send the request, honoring the cancellation of the context while waiting for the response:
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL: &url.URL{
+			Opaque: address,
+		},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if t.proxy.User != nil {
+		password, _ := t.proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(t.proxy.User.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	err = request.Write(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	// Note that the body of the response isn't closed, because that would try to read it till the end, and after a
+	// successful response what follows is the data of the target.
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		err = fmt.Errorf("proxy refused to connect to '%s': %s", address, response.Status)
+		return
+	}
+
+	// The proxy shouldn't send anything before the target, but if it does don't lose it:
+	result = conn
+	if reader.Buffered() > 0 {
+		result = &bufferedConn{
+			Conn:   conn,
+			reader: reader,
+		}
+	}
+	return
+}
+
+// bufferedConn is a connection that reads first the data that was already read into a buffer.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read is the implementation of the io.Reader interface.
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
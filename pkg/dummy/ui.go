@@ -0,0 +1,42 @@
+package dummy
+
+import (
+	_ "embed"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// uiPage is the speed test page.
+//
+//go:embed ui.html
+var uiPage []byte
+
+// UIHandler is an HTTP handler that serves a speed test page that runs download, upload and latency tests against the
+// server from the browser. It wraps the data handler, and serves the page only for requests to the root path without
+// query parameters that come from browsers, the rest are passed to the data handler.
+type UIHandler struct {
+	logger *slog.Logger
+	data   http.Handler
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *UIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page := r.URL.Path == "/ui"
+	if r.URL.Path == "/" && r.URL.RawQuery == "" && r.Method == http.MethodGet {
+		page = strings.Contains(r.Header.Get("Accept"), "text/html")
+	}
+	if !page {
+		h.data.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, err := w.Write(uiPage)
+	if err != nil {
+		h.logger.Error(
+			"Failed to send speed test page",
+			slog.String("error", err.Error()),
+		)
+	}
+}
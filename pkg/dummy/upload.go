@@ -0,0 +1,95 @@
+package dummy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// UploadResult is the response of the upload endpoint.
+type UploadResult struct {
+	Bytes      int64    `json:"bytes"`
+	Elapsed    Duration `json:"elapsed"`
+	Throughput float64  `json:"throughput"`
+
+	// Digest is the digest of the body, in hexadecimal, calculated with the algorithm requested with the 'digest'
+	// query parameter.
+	Digest string `json:"digest,omitempty"`
+}
+
+// UploadHandler is an HTTP handler that reads and discards the request body as fast as possible, and returns the
+// number of bytes received and the throughput measured by the server. The 'digest' query parameter selects an
+// algorithm, 'sha256', 'crc32' or 'xxh3', used to calculate a digest of the body, so that the client can compare it
+// with its own and detect corruption.
+type UploadHandler struct {
+	logger   *slog.Logger
+	identity Identity
+	buffers  *BufferPool
+	stats    *Stats
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.identity.SetHeaders(w.Header())
+
+	// Create the digest, if requested:
+	var digest hash.Hash
+	sink := io.Discard
+	name := r.URL.Query().Get("digest")
+	if name != "" {
+		var err error
+		digest, err = NewDigest(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sink = digest
+	}
+
+	// Read the body:
+	startTime := time.Now()
+	buffer := h.buffers.Get(DefaultBufferSize)
+	defer h.buffers.Put(buffer)
+	bytes, err := io.CopyBuffer(sink, r.Body, *buffer)
+	elapsed := time.Since(startTime)
+	if err != nil {
+		h.logger.Info(
+			"Failed to read upload",
+			slog.Int64("bytes", bytes),
+			slog.String("error", err.Error()),
+		)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.stats.RecordTransfer(r.Context(), bytes, elapsed)
+
+	// Send the result:
+	result := &UploadResult{
+		Bytes:   bytes,
+		Elapsed: Duration(elapsed),
+	}
+	if elapsed > 0 {
+		result.Throughput = float64(bytes) / elapsed.Seconds()
+	}
+	if digest != nil {
+		result.Digest = hex.EncodeToString(digest.Sum(nil))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		h.logger.Error(
+			"Failed to send upload result",
+			slog.String("error", err.Error()),
+		)
+	}
+	h.logger.Info(
+		"Data received",
+		slog.Int64("size", bytes),
+		slog.String("elapsed", elapsed.String()),
+		h.identity.LogAttr(),
+	)
+}
@@ -0,0 +1,298 @@
+//go:build linux
+
+package dummy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants of the io_uring interface, from 'linux/io_uring.h':
+const (
+	uringOffSQRing      = 0
+	uringOffCQRing      = 0x8000000
+	uringOffSQEs        = 0x10000000
+	uringFeatSingleMmap = 1 << 0
+	uringEnterGetEvents = 1 << 0
+	uringOpSend         = 26
+)
+
+// uringParams is the 'io_uring_params' structure.
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        uringSQOffsets
+	cqOff        uringCQOffsets
+}
+
+// uringSQOffsets is the 'io_sqring_offsets' structure.
+type uringSQOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	flags       uint32
+	dropped     uint32
+	array       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+// uringCQOffsets is the 'io_cqring_offsets' structure.
+type uringCQOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	overflow    uint32
+	cqes        uint32
+	flags       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+// uringSQE is the 'io_uring_sqe' structure, with only the fields used for sending data.
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	msgFlags    uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+// uringCQE is the 'io_uring_cqe' structure.
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// uring is a minimal io_uring instance, with the submission and completion queues mapped into memory. It is only used
+// by one goroutine at a time.
+type uring struct {
+	fd      int
+	entries uint32
+	sqRing  []byte
+	cqRing  []byte
+	sqeData []byte
+	sqHead  *uint32
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	sqes    []uringSQE
+	cqHead  *uint32
+	cqTail  *uint32
+	cqMask  uint32
+	cqes    []uringCQE
+}
+
+// newURing creates an io_uring instance with the given number of entries.
+func newURing(entries uint32) (result *uring, err error) {
+	var params uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		err = fmt.Errorf("failed to create io_uring: %w", errno)
+		return
+	}
+	ring := &uring{
+		fd:      int(fd),
+		entries: params.sqEntries,
+	}
+	defer func() {
+		if err != nil {
+			ring.Close()
+		}
+	}()
+
+	// Map the queues. Recent kernels allow mapping both rings with a single call.
+	sqSize := int(params.sqOff.array + params.sqEntries*4)
+	cqSize := int(params.cqOff.cqes) + int(params.cqEntries)*int(unsafe.Sizeof(uringCQE{}))
+	if params.features&uringFeatSingleMmap != 0 {
+		sqSize = max(sqSize, cqSize)
+	}
+	ring.sqRing, err = ring.mmap(uringOffSQRing, sqSize)
+	if err != nil {
+		return
+	}
+	ring.cqRing = ring.sqRing
+	if params.features&uringFeatSingleMmap == 0 {
+		ring.cqRing, err = ring.mmap(uringOffCQRing, cqSize)
+		if err != nil {
+			return
+		}
+	}
+	ring.sqeData, err = ring.mmap(uringOffSQEs, int(params.sqEntries)*int(unsafe.Sizeof(uringSQE{})))
+	if err != nil {
+		return
+	}
+
+	// Locate the fields of the queues inside the mapped memory:
+	ring.sqHead = (*uint32)(unsafe.Pointer(&ring.sqRing[params.sqOff.head]))
+	ring.sqTail = (*uint32)(unsafe.Pointer(&ring.sqRing[params.sqOff.tail]))
+	ring.sqMask = *(*uint32)(unsafe.Pointer(&ring.sqRing[params.sqOff.ringMask]))
+	ring.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&ring.sqRing[params.sqOff.array])), params.sqEntries)
+	ring.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&ring.sqeData[0])), params.sqEntries)
+	ring.cqHead = (*uint32)(unsafe.Pointer(&ring.cqRing[params.cqOff.head]))
+	ring.cqTail = (*uint32)(unsafe.Pointer(&ring.cqRing[params.cqOff.tail]))
+	ring.cqMask = *(*uint32)(unsafe.Pointer(&ring.cqRing[params.cqOff.ringMask]))
+	ring.cqes = unsafe.Slice((*uringCQE)(unsafe.Pointer(&ring.cqRing[params.cqOff.cqes])), params.cqEntries)
+	result = ring
+	return
+}
+
+func (r *uring) mmap(offset int64, size int) (result []byte, err error) {
+	result, err = unix.Mmap(r.fd, offset, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		err = fmt.Errorf("failed to map io_uring queue: %w", err)
+	}
+	return
+}
+
+// Close releases the memory and the file descriptor of the instance.
+func (r *uring) Close() error {
+	if r.sqeData != nil {
+		unix.Munmap(r.sqeData)
+	}
+	if r.cqRing != nil && &r.cqRing[0] != &r.sqRing[0] {
+		unix.Munmap(r.cqRing)
+	}
+	if r.sqRing != nil {
+		unix.Munmap(r.sqRing)
+	}
+	return unix.Close(r.fd)
+}
+
+// send sends the given buffers to the socket, with one submission per buffer, and waits till all of them have
+// completed. It returns the number of bytes sent and the number of system calls used.
+func (r *uring) send(fd int, buffers [][]byte) (bytes, syscalls int64, err error) {
+	// Queue the submissions. The data is random, so it doesn't matter if the kernel completes them out of order.
+	tail := atomic.LoadUint32(r.sqTail)
+	for i, buffer := range buffers {
+		index := (tail + uint32(i)) & r.sqMask
+		r.sqes[index] = uringSQE{
+			opcode:   uringOpSend,
+			fd:       int32(fd),
+			addr:     uint64(uintptr(unsafe.Pointer(&buffer[0]))),
+			len:      uint32(len(buffer)),
+			msgFlags: unix.MSG_WAITALL | unix.MSG_NOSIGNAL,
+			userData: uint64(i),
+		}
+		r.sqArray[index] = index
+	}
+	atomic.StoreUint32(r.sqTail, tail+uint32(len(buffers)))
+
+	// Submit and wait for the completions. The wait may be interrupted by the signals that the Go runtime uses for
+	// preemption, so we need to check how many submissions are still pending each time.
+	completed := 0
+	for completed < len(buffers) {
+		pending := atomic.LoadUint32(r.sqTail) - atomic.LoadUint32(r.sqHead)
+		_, _, errno := unix.Syscall6(
+			unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(pending), uintptr(len(buffers)-completed),
+			uringEnterGetEvents, 0, 0,
+		)
+		syscalls++
+		if errno != 0 && errno != unix.EINTR && errno != unix.EAGAIN && errno != unix.EBUSY {
+			err = fmt.Errorf("failed to submit to io_uring: %w", errno)
+			break
+		}
+		head := atomic.LoadUint32(r.cqHead)
+		for head != atomic.LoadUint32(r.cqTail) {
+			cqe := r.cqes[head&r.cqMask]
+			head++
+			completed++
+			switch {
+			case cqe.res < 0 && err == nil:
+				err = syscall.Errno(-cqe.res)
+			case cqe.res == 0 && err == nil:
+				err = io.ErrShortWrite
+			case cqe.res > 0:
+				bytes += int64(cqe.res)
+			}
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+	runtime.KeepAlive(buffers)
+	return
+}
+
+// checkIOUring checks that io_uring can be used, as it may be disabled by the administrator or by a seccomp profile.
+func checkIOUring() error {
+	ring, err := newURing(1)
+	if err != nil {
+		return err
+	}
+	return ring.Close()
+}
+
+// sendIOUring sends random data to the given connection till it fails, filling the given buffers and submitting them
+// to the kernel together, so that there is only one system call for all of them. It returns the number of bytes sent
+// and the number of system calls used.
+func sendIOUring(conn net.Conn, reader io.Reader, buffers [][]byte) (bytes, syscalls int64, err error) {
+	syscallConn, ok := conn.(syscall.Conn)
+	if !ok {
+		err = fmt.Errorf("connection of type %T doesn't support io_uring", conn)
+		return
+	}
+	rawConn, err := syscallConn.SyscallConn()
+	if err != nil {
+		return
+	}
+	ring, err := newURing(uint32(len(buffers)))
+	if err != nil {
+		return
+	}
+	defer ring.Close()
+
+	// The kernel returns an error instead of waiting when a non blocking socket is full, so the socket needs to be
+	// blocking. This is safe because the Go runtime isn't going to write to it.
+	var fd int
+	controlErr := rawConn.Control(func(value uintptr) {
+		fd = int(value)
+		err = unix.SetNonblock(fd, false)
+	})
+	if controlErr != nil {
+		err = controlErr
+	}
+	if err != nil {
+		return
+	}
+
+	// Send the data:
+	for {
+		for _, buffer := range buffers {
+			_, err = io.ReadFull(reader, buffer)
+			if err != nil {
+				return
+			}
+		}
+		var sent, calls int64
+		sent, calls, err = ring.send(fd, buffers)
+		bytes += sent
+		syscalls += calls
+		if err != nil {
+			return
+		}
+	}
+}
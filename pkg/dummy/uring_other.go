@@ -0,0 +1,23 @@
+//go:build !linux
+
+package dummy
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// errIOUringUnsupported is returned when io_uring is requested in a system that isn't Linux.
+var errIOUringUnsupported = errors.New("io_uring is only supported in Linux")
+
+// checkIOUring checks that io_uring can be used. It is only supported in Linux.
+func checkIOUring() error {
+	return errIOUringUnsupported
+}
+
+// sendIOUring sends random data to the given connection using io_uring. It is only supported in Linux.
+func sendIOUring(conn net.Conn, reader io.Reader, buffers [][]byte) (bytes, syscalls int64, err error) {
+	err = errIOUringUnsupported
+	return
+}
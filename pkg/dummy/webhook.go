@@ -0,0 +1,205 @@
+package dummy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Formats of the bodies of the webhook requests:
+const (
+	WebhookFormatGeneric = "generic"
+	WebhookFormatSlack   = "slack"
+)
+
+// Kinds of alerts:
+const (
+	AlertKindThroughput = "throughput"
+	AlertKindErrorRate  = "error_rate"
+	AlertKindFailures   = "failures"
+)
+
+// States of alerts:
+const (
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// webhookTimeout is the maximum time to deliver a notification.
+const webhookTimeout = 10 * time.Second
+
+// WebhookConfig describes an URL that receives a POST request when an alert starts or stops firing. For example:
+//
+//	{
+//	  "name": "team",
+//	  "url": "https://hooks.slack.com/services/...",
+//	  "format": "slack"
+//	}
+type WebhookConfig struct {
+	// Name identifies the webhook in the log. The default is the URL.
+	Name string `json:"name,omitempty"`
+
+	// URL is the address that receives the notifications.
+	URL string `json:"url"`
+
+	// Format is the format of the body. With 'generic', the default, the body is the JSON representation of the
+	// alert, and with 'slack' it is a message for a Slack incoming webhook.
+	Format string `json:"format,omitempty"`
+
+	// Headers are additional headers added to the requests, for example for authentication.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Insecure disables the verification of the TLS certificate of the webhook.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// validate checks that the webhook is valid, and sets the default name.
+func (c *WebhookConfig) validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("URL of webhook '%s' is mandatory", c.Name)
+	}
+	address, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("URL of webhook '%s' isn't valid: %w", c.Name, err)
+	}
+	if address.Scheme != "http" && address.Scheme != "https" {
+		return fmt.Errorf("scheme of the URL of webhook '%s' should be 'http' or 'https'", c.Name)
+	}
+	if c.Name == "" {
+		c.Name = c.URL
+	}
+	switch c.Format {
+	case "", WebhookFormatGeneric, WebhookFormatSlack:
+	default:
+		return fmt.Errorf(
+			"format of webhook '%s' should be '%s' or '%s', but it is '%s'",
+			c.Name, WebhookFormatGeneric, WebhookFormatSlack, c.Format,
+		)
+	}
+	return nil
+}
+
+// Alert is the content of a notification. Value is the measurement that caused the change of state, and Threshold is
+// the configured limit.
+type Alert struct {
+	Instance  string    `json:"instance"`
+	Probe     string    `json:"probe"`
+	URL       string    `json:"url"`
+	Kind      string    `json:"kind"`
+	State     string    `json:"state"`
+	Time      time.Time `json:"time"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+}
+
+// Notifier sends alerts to the configured webhooks.
+type Notifier struct {
+	logger   *slog.Logger
+	instance string
+	webhooks []WebhookConfig
+	clients  []*http.Client
+}
+
+// NewNotifier creates a notifier for the given webhooks. The identity is used to tell which server sent the alerts.
+func NewNotifier(logger *slog.Logger, identity Identity, webhooks []WebhookConfig) (result *Notifier, err error) {
+	names := map[string]bool{}
+	clients := make([]*http.Client, len(webhooks))
+	webhooks = slices.Clone(webhooks)
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		err = webhook.validate()
+		if err != nil {
+			return
+		}
+		if names[webhook.Name] {
+			err = fmt.Errorf("webhook name '%s' is duplicated", webhook.Name)
+			return
+		}
+		names[webhook.Name] = true
+		clients[i] = &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: webhook.Insecure,
+				},
+			},
+			Timeout: webhookTimeout,
+		}
+	}
+	result = &Notifier{
+		logger:   logger,
+		instance: identity.Instance,
+		webhooks: webhooks,
+		clients:  clients,
+	}
+	return
+}
+
+// Notify sends the alert to all the webhooks, in the background, so that slow webhooks don't delay the caller. The
+// receiver can be nil, and then it does nothing.
+func (n *Notifier) Notify(alert Alert) {
+	if n == nil {
+		return
+	}
+	alert.Instance = n.instance
+	for i, webhook := range n.webhooks {
+		go func() {
+			err := n.send(n.clients[i], webhook, alert)
+			if err != nil {
+				n.logger.Error(
+					"Failed to send alert",
+					slog.String("webhook", webhook.Name),
+					slog.String("error", err.Error()),
+				)
+			}
+		}()
+	}
+}
+
+// send delivers the alert to one webhook.
+func (n *Notifier) send(client *http.Client, webhook WebhookConfig, alert Alert) error {
+	var payload any
+	switch webhook.Format {
+	case WebhookFormatSlack:
+		emoji := ":red_circle:"
+		if alert.State == AlertStateResolved {
+			emoji = ":large_green_circle:"
+		}
+		payload = map[string]string{
+			"text": fmt.Sprintf("%s [%s] %s: %s", emoji, alert.Instance, alert.Probe, alert.Message),
+		}
+	default:
+		payload = alert
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range webhook.Headers {
+		request.Header.Set(name, value)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	return nil
+}
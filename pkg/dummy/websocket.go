@@ -0,0 +1,239 @@
+package dummy
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Defaults for the WebSocket data endpoint:
+const (
+	defaultFrameSize = 1 << 10 // 1 KiB
+	defaultFrameRate = 0       // As fast as possible
+)
+
+// webSocketUpgrader is used to upgrade the HTTP connections to WebSocket. The origin isn't checked because this is
+// intended for load tests, including browser based ones.
+var webSocketUpgrader = websocket.Upgrader{
+	ReadBufferSize:  DefaultBufferSize,
+	WriteBufferSize: DefaultBufferSize,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// WebSocketEchoHandler is an HTTP handler that accepts WebSocket connections and sends back every message that it
+// receives, with the same type.
+type WebSocketEchoHandler struct {
+	logger   *slog.Logger
+	identity Identity
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *WebSocketEchoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Upgrade the connection:
+	header := http.Header{}
+	h.identity.SetHeaders(header)
+	conn, err := webSocketUpgrader.Upgrade(w, r, header)
+	if err != nil {
+		h.logger.Error(
+			"Failed to upgrade connection",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	defer conn.Close()
+
+	// Send back the messages till the client closes the connection:
+	startTime := time.Now()
+	var messages, bytes int64
+	for {
+		messageType, reader, err := conn.NextReader()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				h.logger.Info(
+					"Failed to read message",
+					slog.String("error", err.Error()),
+				)
+			}
+			break
+		}
+		writer, err := conn.NextWriter(messageType)
+		if err != nil {
+			h.logger.Info(
+				"Failed to write message",
+				slog.String("error", err.Error()),
+			)
+			break
+		}
+		n, err := io.Copy(writer, reader)
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			h.logger.Info(
+				"Failed to echo message",
+				slog.String("error", err.Error()),
+			)
+			break
+		}
+		messages++
+		bytes += n
+	}
+
+	// Write a summary to the log:
+	h.logger.Info(
+		"Echo finished",
+		slog.Int64("messages", messages),
+		slog.Int64("bytes", bytes),
+		slog.String("elapsed", time.Since(startTime).String()),
+		h.identity.LogAttr(),
+	)
+}
+
+// WebSocketDataHandler is an HTTP handler that accepts WebSocket connections and pushes binary frames of random data
+// to the client. The 'size' query parameter is the size of each frame, the 'rate' query parameter is the number of
+// frames per second, and the 'count' query parameter is the total number of frames. When the rate is zero frames are
+// sent as fast as possible, and when the count is zero they are sent till the client closes the connection.
+type WebSocketDataHandler struct {
+	logger   *slog.Logger
+	identity Identity
+	random   RandomSource
+	stats    *Stats
+}
+
+// ServeHTTP is the implementation of the http.Handler interface.
+func (h *WebSocketDataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get the parameters:
+	query, deprecated := resolveParamAliases(r.URL.Query())
+	setDeprecationWarnings(w.Header(), deprecated)
+	size, err := parseIntParam(query.Get("size"), defaultFrameSize)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("size isn't valid: %v", err), http.StatusBadRequest)
+		return
+	}
+	count, err := parseIntParam(query.Get("count"), 0)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("count isn't valid: %v", err), http.StatusBadRequest)
+		return
+	}
+	rate := float64(defaultFrameRate)
+	text := query.Get("rate")
+	if text != "" {
+		rate, err = strconv.ParseFloat(text, 64)
+		if err != nil || rate < 0 {
+			http.Error(w, fmt.Sprintf("rate '%s' should be a non negative number", text), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Open the random data:
+	dataReader, err := h.random.Open()
+	if err != nil {
+		h.logger.Error(
+			"Failed to open data",
+			slog.String("error", err.Error()),
+		)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer dataReader.Close()
+
+	// Upgrade the connection:
+	header := http.Header{}
+	h.identity.SetHeaders(header)
+	conn, err := webSocketUpgrader.Upgrade(w, r, header)
+	if err != nil {
+		h.logger.Error(
+			"Failed to upgrade connection",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	defer conn.Close()
+
+	// Read in the background, as that is needed to process control messages, in particular the close message sent
+	// by the client:
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			_, _, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Send the frames:
+	startTime := time.Now()
+	frame := make([]byte, size)
+	var ticker *time.Ticker
+	if rate > 0 {
+		ticker = time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+	}
+	sent := 0
+loop:
+	for count == 0 || sent < count {
+		_, err = dataReader.Read(frame)
+		if err != nil {
+			h.logger.Error(
+				"Failed to read data",
+				slog.String("error", err.Error()),
+			)
+			break
+		}
+		err = conn.WriteMessage(websocket.BinaryMessage, frame)
+		if err != nil {
+			h.logger.Info(
+				"Failed to write frame",
+				slog.String("error", err.Error()),
+			)
+			break
+		}
+		sent++
+		if ticker != nil {
+			select {
+			case <-ticker.C:
+			case <-closed:
+				break loop
+			}
+		} else {
+			select {
+			case <-closed:
+				break loop
+			default:
+			}
+		}
+	}
+	if count != 0 && sent == count {
+		err = conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second),
+		)
+		if err != nil {
+			h.logger.Info(
+				"Failed to send close message",
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	// Write a summary to the log:
+	elapsed := time.Since(startTime)
+	h.stats.RecordTransfer(r.Context(), int64(sent)*int64(size), elapsed)
+	h.logger.Info(
+		"Frames sent",
+		slog.Int("count", sent),
+		slog.Int("size", size),
+		slog.String("elapsed", elapsed.String()),
+		h.identity.LogAttr(),
+	)
+}
@@ -0,0 +1,114 @@
+package dummy
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// Default name of the header that clients use to tell the server their zone.
+const defaultClientZoneHeader = "X-Client-Zone"
+
+// ZoneConfig describes the latency that is added to requests coming from clients in a zone different to the zone of
+// the server. The zone of the client is taken from a header, or, if the header isn't present, from the subnet of the
+// client address, similar to the EDNS client subnet hint used by DNS servers. For example:
+//
+//	{
+//	  "header": "X-Client-Zone",
+//	  "subnets": {
+//	    "10.0.1.0/24": "us-east-1a",
+//	    "10.0.2.0/24": "us-east-1b"
+//	  },
+//	  "cross_zone_latency": "2ms",
+//	  "latencies": {
+//	    "eu-west-1a": "80ms"
+//	  }
+//	}
+type ZoneConfig struct {
+	// Header is the name of the header that contains the zone of the client. The default is 'X-Client-Zone'.
+	Header string `json:"header,omitempty"`
+
+	// Subnets maps subnets to zones, and it is used when the request doesn't contain the header.
+	Subnets map[string]string `json:"subnets,omitempty"`
+
+	// CrossZoneLatency is the latency added when the zone of the client is known and different to the zone of the
+	// server.
+	CrossZoneLatency Duration `json:"cross_zone_latency,omitempty"`
+
+	// Latencies contains the latencies for specific client zones, replacing the cross zone latency.
+	Latencies map[string]Duration `json:"latencies,omitempty"`
+}
+
+// ZoneEmulator calculates the latency that should be added to requests according to the zone of the client and the
+// zone of the server.
+type ZoneEmulator struct {
+	zone      string
+	header    string
+	subnets   []zoneSubnet
+	latency   time.Duration
+	latencies map[string]time.Duration
+}
+
+type zoneSubnet struct {
+	prefix netip.Prefix
+	zone   string
+}
+
+// NewZoneEmulator creates an emulator for a server running in the given zone. The configuration can be nil, and then
+// the emulator will not add any latency.
+func NewZoneEmulator(zone string, config *ZoneConfig) (result *ZoneEmulator, err error) {
+	emulator := &ZoneEmulator{
+		zone:      zone,
+		header:    defaultClientZoneHeader,
+		latencies: map[string]time.Duration{},
+	}
+	if config != nil {
+		if config.Header != "" {
+			emulator.header = config.Header
+		}
+		for cidr, subnetZone := range config.Subnets {
+			var prefix netip.Prefix
+			prefix, err = netip.ParsePrefix(cidr)
+			if err != nil {
+				err = fmt.Errorf("subnet '%s' of zone '%s' isn't valid: %w", cidr, subnetZone, err)
+				return
+			}
+			emulator.subnets = append(emulator.subnets, zoneSubnet{
+				prefix: prefix,
+				zone:   subnetZone,
+			})
+		}
+		emulator.latency = time.Duration(config.CrossZoneLatency)
+		for latencyZone, latency := range config.Latencies {
+			emulator.latencies[latencyZone] = time.Duration(latency)
+		}
+	}
+	result = emulator
+	return
+}
+
+// Latency returns the latency that should be added to the request and the zone of the client. The zone will be empty
+// if it isn't known.
+func (e *ZoneEmulator) Latency(r *http.Request) (latency time.Duration, zone string) {
+	zone = r.Header.Get(e.header)
+	if zone == "" && len(e.subnets) > 0 {
+		addr := clientAddr(r)
+		if addr.IsValid() {
+			for _, subnet := range e.subnets {
+				if subnet.prefix.Contains(addr) {
+					zone = subnet.zone
+					break
+				}
+			}
+		}
+	}
+	if zone == "" || zone == e.zone {
+		return
+	}
+	latency, ok := e.latencies[zone]
+	if !ok {
+		latency = e.latency
+	}
+	return
+}
@@ -0,0 +1,631 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// serveMain is the entry point of the 'serve' command, which is also the default when no command is given.
+func serveMain(args []string) {
+	// Parse the command line:
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	var configFile string
+	var randomSourceName string
+	var randomFile string
+	var randomFileSize int64
+	var multiplex bool
+	var multiplexRaw string
+	var proxyProtocol string
+	var proxyTrusted string
+	var checkConfig bool
+	var logFlags dummy.LoggingConfig
+	var tcpSend, tcpSink, udpSend, udpSink string
+	var tcpSendBackend string
+	var datagramSize int
+	var udpDuration time.Duration
+	var udpRate int64
+	var udpImpairment dummy.UDPImpairment
+	var serveDir string
+	var readHeaderTimeout, idleTimeout, writeTimeout time.Duration
+	var tcpFlags dummy.TCPConfig
+	var tcpNoDelay bool
+	var tlsFlags dummy.ListenerTLSConfig
+	var tlsCipherSuites string
+	var tlsSessionTickets bool
+	var reusePort int
+	var sessionMode string
+	var corsOrigins string
+	var strict bool
+	var maxBytesPerRequest int64
+	var maxDuration time.Duration
+	var gomaxprocs int
+	var cpuList string
+	var pinConnections string
+	var systemdSocket string
+	var shutdownTimeout time.Duration
+	var runUser string
+	var runGroup string
+	var allowRoot bool
+	var adminToken string
+	var fleetFlags dummy.FleetConfig
+	var fleetPeers string
+	var meshFlags dummy.MeshConfig
+	var meshInterval time.Duration
+	var probeURLs string
+	var probeFlags dummy.ProbeConfig
+	var probeInterval time.Duration
+	var probeAlerts dummy.ProbeAlertsConfig
+	var webhookURLs string
+	var webhookFormat string
+	var historyFlags dummy.HistoryConfig
+	var historyRetention time.Duration
+	var influxFlags dummy.ExporterConfig
+	var postgresFlags dummy.ExporterConfig
+	var exportInterval time.Duration
+	var proxyFlags dummy.ProxyConfig
+	var proxyRecord, proxyReplay string
+	var proxyImpairment dummy.Behavior
+	headers := dummy.HeaderFlag{}
+	flags.StringVar(&configFile, "config", "",
+		fmt.Sprintf(
+			"Configuration file, in YAML or JSON format. Default is the 'config.yaml' or 'config.json' file of the "+
+				"'%s' directory, if it exists, so that it can be mounted from a config map.",
+			dummy.MountedConfigDir,
+		))
+	flags.BoolVar(&checkConfig, "check-config", false, "Check the configuration file and exit.")
+	flags.StringVar(&logFlags.Level, "log-level", "",
+		"Minimum level of the log messages, one of 'debug', 'info', 'warn' or 'error'. Default is 'info'.")
+	flags.StringVar(&logFlags.Format, "log-format", "",
+		fmt.Sprintf(
+			"Format of the log, '%s' or '%s'. Default is '%s'.",
+			dummy.LogFormatJSON, dummy.LogFormatText, dummy.LogFormatJSON,
+		))
+	flags.StringVar(&logFlags.Output, "log-output", "",
+		"Destination of the log, 'stdout', 'stderr' or the name of a file. Default is 'stdout'.")
+	flags.BoolVar(&logFlags.Headers, "log-headers", false, "Write the headers of each request to the log.")
+	flags.DurationVar((*time.Duration)(&logFlags.Progress), "log-progress", 0,
+		"Interval between the progress messages written to the log during transfers. Default is no progress messages.")
+	flags.StringVar(&logFlags.Summary, "log-summary", "",
+		"Destination of the summary records, one line of JSON per request with a stable schema, 'stdout', 'stderr' "+
+			"or the name of a file. Default is no summary records.")
+	flags.StringVar(&randomSourceName, "random-source", dummy.DefaultRandomSource,
+		fmt.Sprintf("Source of random data, one of %s.", dummy.RandomSourceNames()))
+	flags.StringVar(&randomFile, "random-file", dummy.DefaultRandomFile(),
+		"File of pre-generated random data used by the 'mmap' random source. It is generated if it doesn't exist.")
+	flags.Int64Var(&randomFileSize, "random-file-size", 0,
+		"Size in bytes of the file used by the 'mmap' random source. It is regenerated if it is smaller. Default is "+
+			"the size of the existing file, or 1 GiB.")
+	flags.BoolVar(&multiplex, "multiplex", false,
+		"Accept plain text HTTP/1 and HTTP/2, including gRPC, in the same port than TLS. Ignored when the "+
+			"configuration file contains listeners.")
+	flags.StringVar(&multiplexRaw, "multiplex-raw", "",
+		fmt.Sprintf(
+			"Mode of the raw TCP server, '%s' or '%s', that receives the multiplexed connections that aren't TLS "+
+				"or HTTP. Requires '--multiplex'. Ignored when the configuration file contains listeners.",
+			dummy.RawModeSend, dummy.RawModeSink,
+		))
+	flags.StringVar(&proxyProtocol, "proxy-protocol", dummy.ProxyProtocolOff,
+		fmt.Sprintf(
+			"Support for the PROXY protocol header in inbound connections, one of '%s', '%s' or '%s'. "+
+				"Ignored when the configuration file contains listeners.",
+			dummy.ProxyProtocolOff, dummy.ProxyProtocolOptional, dummy.ProxyProtocolRequired,
+		))
+	flags.StringVar(&proxyTrusted, "proxy-trusted", "",
+		"Comma separated list of CIDRs of the peers, usually the load balancers, whose PROXY protocol headers are "+
+			"honoured. Default is to honour the headers of all peers. Ignored when the configuration file "+
+			"contains listeners.")
+	flags.Var(headers, "header", "Extra response header in the 'Name: value' format. Can be repeated.")
+	flags.StringVar(&tcpSend, "tcp-send", "",
+		"Address of a raw TCP listener that sends random data till the client closes the connection.")
+	flags.StringVar(&tcpSendBackend, "tcp-send-backend", dummy.RawBackendStandard,
+		fmt.Sprintf(
+			"Implementation of the write loop of the raw TCP send listener, '%s' or the experimental '%s', which "+
+				"is only available in Linux.",
+			dummy.RawBackendStandard, dummy.RawBackendIOUring,
+		))
+	flags.StringVar(&tcpSink, "tcp-sink", "",
+		"Address of a raw TCP listener that discards all the data sent by the client.")
+	flags.StringVar(&udpSend, "udp-send", "",
+		"Address of a raw UDP listener that sends a burst of datagrams to the clients that send back the cookie "+
+			"that it returns for their first datagram.")
+	flags.StringVar(&udpSink, "udp-sink", "",
+		"Address of a raw UDP listener that counts the datagrams received and reports the counts when it "+
+			"receives an empty datagram.")
+	flags.IntVar(&datagramSize, "udp-size", dummy.DefaultDatagramSize, "Size of the datagrams sent by the UDP listener.")
+	flags.DurationVar(&udpDuration, "udp-duration", dummy.DefaultUDPDuration,
+		"Duration of the bursts sent by the UDP listener.")
+	flags.Int64Var(&udpRate, "udp-rate", dummy.DefaultUDPRate,
+		"Maximum rate of the bursts sent by the UDP listener, in bytes per second.")
+	flags.Float64Var(&udpImpairment.LossRate, "udp-loss", 0,
+		"Probability, from zero to one, that the UDP listeners drop a datagram. The impaired datagrams are the "+
+			"ones sent by the send listener and the ones received by the sink listener.")
+	flags.Float64Var(&udpImpairment.ReorderRate, "udp-reorder", 0,
+		"Probability, from zero to one, that the UDP listeners deliver a datagram after the ones that follow it.")
+	flags.DurationVar(&udpImpairment.ReorderDelay, "udp-reorder-delay", dummy.DefaultReorderDelay,
+		"Time that the UDP listeners hold the reordered datagrams that they send.")
+	flags.Float64Var(&udpImpairment.DuplicateRate, "udp-duplicate", 0,
+		"Probability, from zero to one, that the UDP listeners deliver a datagram twice.")
+	flags.BoolVar(&tcpNoDelay, "tcp-no-delay", true,
+		"Disable the Nagle algorithm in TCP connections. Ignored when the configuration file contains listeners.")
+	flags.IntVar(&tcpFlags.SendBuffer, "socket-send-buffer", 0,
+		"Size of the send buffer of TCP sockets. Zero means the operating system default. Ignored when the "+
+			"configuration file contains listeners.")
+	flags.IntVar(&tcpFlags.ReceiveBuffer, "socket-receive-buffer", 0,
+		"Size of the receive buffer of TCP sockets. Zero means the operating system default. Ignored when the "+
+			"configuration file contains listeners.")
+	flags.DurationVar((*time.Duration)(&tcpFlags.KeepAlive), "tcp-keep-alive", 0,
+		"Period of the TCP keep alive probes. Zero means the Go default and negative disables them. Ignored "+
+			"when the configuration file contains listeners.")
+	flags.StringVar(&tlsFlags.MinVersion, "tls-min-version", "",
+		"Minimum TLS version, '1.0', '1.1', '1.2' or '1.3'. Default is '1.2'. Ignored when the configuration file "+
+			"contains listeners.")
+	flags.StringVar(&tlsFlags.MaxVersion, "tls-max-version", "",
+		"Maximum TLS version, '1.0', '1.1', '1.2' or '1.3'. Default is '1.3'. Ignored when the configuration file "+
+			"contains listeners.")
+	flags.StringVar(&tlsCipherSuites, "tls-cipher-suites", "",
+		"Comma separated list of the cipher suites enabled for TLS 1.2 and older. Default is a secure selection. "+
+			"Ignored when the configuration file contains listeners.")
+	flags.BoolVar(&tlsSessionTickets, "tls-session-tickets", true,
+		"Enable TLS session resumption with tickets. Ignored when the configuration file contains listeners.")
+	flags.DurationVar((*time.Duration)(&tlsFlags.TicketRotation), "tls-ticket-rotation", 0,
+		"Period of the rotation of the session ticket keys. Default is daily. Ignored when the configuration file "+
+			"contains listeners.")
+	flags.BoolVar(&tlsFlags.KTLS, "ktls", false,
+		"Send data with kernel TLS, so that files can be sent with sendfile. Requires Linux, TLS 1.3 and an AES-GCM "+
+			"cipher suite, and connections use HTTP/1. Ignored when the configuration file contains listeners.")
+	flags.IntVar(&reusePort, "reuseport", 0,
+		"Number of listening sockets opened with the SO_REUSEPORT option, to accept connections in parallel. "+
+			"Zero means a single socket without that option. Ignored when the configuration file contains "+
+			"listeners.")
+	flags.StringVar(&sessionMode, "sessions", "",
+		fmt.Sprintf(
+			"Session cookie mode, one of '%s', '%s' or '%s'. Default is the mode from the configuration file, or "+
+				"'%s'.",
+			dummy.SessionModeOff, dummy.SessionModeSet, dummy.SessionModeRequire, dummy.SessionModeOff,
+		))
+	flags.StringVar(&corsOrigins, "cors-origins", "",
+		"Comma separated list of origins allowed to send cross origin requests, '*' means any origin. Replaces "+
+			"the origins from the configuration file.")
+	flags.BoolVar(&strict, "strict", false,
+		"Reject requests to the data endpoint that contain unknown query parameters or invalid combinations.")
+	flags.DurationVar(&readHeaderTimeout, "read-header-timeout", dummy.DefaultReadHeaderTimeout,
+		"Time allowed to read the headers of a request. Zero means no limit.")
+	flags.DurationVar(&idleTimeout, "idle-timeout", dummy.DefaultIdleTimeout,
+		"Time that idle keep alive connections are kept open. Zero means no limit.")
+	flags.DurationVar(&writeTimeout, "write-timeout", 0,
+		"Maximum duration of a response, including the body. Note that this limits the amount of data that can "+
+			"be downloaded. Zero means no limit.")
+	flags.Int64Var(&maxBytesPerRequest, "max-bytes-per-request", 0,
+		"Maximum number of bytes of the body of each response, longer responses are truncated. Replaces the limit "+
+			"from the configuration file. Zero means no limit.")
+	flags.DurationVar(&maxDuration, "max-duration", 0,
+		"Maximum duration of each response, longer responses are truncated. Unlike the write timeout the body "+
+			"ends cleanly and a trailer indicates the truncation. Replaces the limit from the configuration file. "+
+			"Zero means no limit.")
+	flags.IntVar(&gomaxprocs, "gomaxprocs", 0,
+		"Number of processors that can run Go code simultaneously. Default is the number of processors that the "+
+			"process is allowed to run on.")
+	flags.StringVar(&cpuList, "cpus", "",
+		"Processors that the process is allowed to run on, in the format used by the Linux kernel, for example "+
+			"'0-7,16-23'. Only supported in Linux.")
+	flags.StringVar(&pinConnections, "pin-connections", "",
+		fmt.Sprintf(
+			"Pin each connection to one processor ('%s') or to one NUMA node ('%s'), in round robin. This is only "+
+				"a hint for the Go runtime, and it is only supported in Linux. Default is to not pin connections.",
+			dummy.PinModeCPU, dummy.PinModeNode,
+		))
+	flags.StringVar(&systemdSocket, "systemd-socket", "",
+		"Name or index of the socket passed by systemd with socket activation that is used instead of the default "+
+			"address. Ignored when the configuration file contains listeners.")
+	flags.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second,
+		"Time to wait for the requests in progress when the server receives a termination signal.")
+	flags.StringVar(&runUser, "user", "",
+		"Name or identifier of the user that the server switches to after opening the listeners, so that it can "+
+			"listen in privileged ports like 443 without serving requests as root. Only supported in Unix like "+
+			"systems.")
+	flags.StringVar(&runGroup, "group", "",
+		"Name or identifier of the group that the server switches to together with the user. Default is the "+
+			"primary group of the user.")
+	flags.StringVar(&fleetFlags.Advertise, "fleet-advertise", "",
+		"Base URL where the other servers of the fleet and the clients can reach this server. Default is built "+
+			"with the address from the 'POD_IP' environment variable, or the host name, and the port of the listener.")
+	flags.StringVar(&fleetPeers, "fleet-peers", "",
+		"Comma separated list of base URLs of other servers that this server announces itself to, so that clients "+
+			"can discover all of them from any of them.")
+	flags.StringVar(&fleetFlags.DNS, "fleet-dns", "",
+		"Host name, usually the one of a headless service, whose addresses are the ones of other servers of the "+
+			"fleet.")
+	flags.BoolVar(&fleetFlags.Insecure, "fleet-insecure", false,
+		"Don't verify the TLS certificates of the other servers of the fleet.")
+	flags.StringVar(&fleetFlags.Token, "fleet-token", os.Getenv(dummy.FleetTokenEnv), fmt.Sprintf(
+		"Secret shared by the servers of the fleet, required to announce a server to the others. Mandatory with "+
+			"'--fleet-peers' or '--fleet-dns'. Default is the value of the '%s' environment variable.",
+		dummy.FleetTokenEnv,
+	))
+	flags.DurationVar(&meshInterval, "fleet-mesh-interval", 0,
+		"Time between measurements of the latency and throughput to the other servers of the fleet. The matrix "+
+			"of all the measurements is available in the '"+dummy.MeshPath+"' endpoint. Zero disables them.")
+	flags.Int64Var(&meshFlags.Size, "fleet-mesh-size", dummy.DefaultMeshSize,
+		"Number of bytes downloaded from each server of the fleet to measure the throughput.")
+	flags.StringVar(&probeURLs, "probe-url", "",
+		"Comma separated list of URLs that the server downloads periodically, acting as a client, recording the "+
+			"results in the statistics and the metrics.")
+	flags.DurationVar(&probeInterval, "probe-interval", dummy.DefaultProbeInterval,
+		"Time between downloads of the probe URLs.")
+	flags.BoolVar(&probeFlags.Insecure, "probe-insecure", false,
+		"Don't verify the TLS certificates of the probe URLs.")
+	flags.Float64Var(&probeAlerts.MinThroughput, "probe-min-throughput", 0,
+		"Throughput, in bytes per second, below which a download of the probe URLs fires an alert. Zero disables "+
+			"the alert.")
+	flags.Float64Var(&probeAlerts.MaxErrorRate, "probe-max-error-rate", 0,
+		fmt.Sprintf(
+			"Fraction, between zero and one, of failed downloads of the probe URLs within the last %d that fires "+
+				"an alert. Zero disables the alert.",
+			dummy.DefaultProbeAlertWindow,
+		))
+	flags.IntVar(&probeAlerts.Failures, "probe-failures", 0,
+		"Number of consecutive failed downloads of the probe URLs that fires an alert. Zero disables the alert.")
+	flags.StringVar(&webhookURLs, "webhook-url", "",
+		"Comma separated list of URLs that receive a POST request when an alert of the probes fires or is resolved.")
+	flags.StringVar(&webhookFormat, "webhook-format", dummy.WebhookFormatGeneric,
+		fmt.Sprintf(
+			"Format of the body of the webhook requests. Can be '%s', for the JSON representation of the alert, or "+
+				"'%s', for Slack incoming webhooks.",
+			dummy.WebhookFormatGeneric, dummy.WebhookFormatSlack,
+		))
+	flags.StringVar(&historyFlags.File, "history-file", "",
+		"SQLite database file where the results of the transfers and of the probes are recorded, so that they "+
+			"survive restarts. They can be queried with the '"+dummy.HistoryPath+"' endpoint, and with the Grafana "+
+			"JSON data source plugin using the '"+dummy.GrafanaPrefix+"' path. Default is to not record them.")
+	flags.DurationVar(&historyRetention, "history-retention", dummy.DefaultHistoryRetention,
+		"Time that the recorded results are kept.")
+	flags.StringVar(&influxFlags.URL, "export-influxdb-url", "",
+		"URL of the InfluxDB write endpoint where the results of the transfers and of the probes are pushed, "+
+			"including the query parameters that select the database or bucket. For example "+
+			"'http://influxdb:8086/api/v2/write?org=perf&bucket=dummy'.")
+	flags.StringVar(&influxFlags.Token, "export-influxdb-token", "",
+		"Authentication token of InfluxDB.")
+	flags.StringVar(&postgresFlags.URL, "export-postgres-url", "",
+		"Connection string of the PostgreSQL or TimescaleDB database where the results of the transfers and of the "+
+			"probes are pushed. For example 'postgres://user:password@db/perf?sslmode=disable'.")
+	flags.DurationVar(&exportInterval, "export-interval", dummy.DefaultExporterInterval,
+		"Time between pushes of the results to InfluxDB or PostgreSQL.")
+	flags.StringVar(&proxyFlags.Upstream, "upstream", "",
+		"URL of a real server that the proxy forwards the requests to, adding the impairment of the '--proxy-latency', "+
+			"'--proxy-rate', '--proxy-error-rate', '--proxy-reset-rate' and '--proxy-truncate-rate' flags, or "+
+			"recording the exchanges if '--proxy-record' is used. The chaos mode, the scenarios and the schedules "+
+			"are also applied to the forwarded requests.")
+	flags.DurationVar(&proxyImpairment.Latency, "proxy-latency", 0,
+		"Latency added by the proxy before forwarding each request.")
+	flags.Int64Var(&proxyImpairment.Rate, "proxy-rate", 0,
+		"Maximum number of bytes per second of the response bodies sent by the proxy. Zero means no limit.")
+	flags.Float64Var(&proxyImpairment.ErrorRate, "proxy-error-rate", 0,
+		"Probability, from zero to one, that the proxy answers with an error instead of forwarding the request.")
+	flags.IntVar(&proxyImpairment.ErrorStatus, "proxy-error-status", http.StatusBadGateway,
+		"Status code of the errors simulated by the proxy.")
+	flags.Float64Var(&proxyImpairment.ResetRate, "proxy-reset-rate", 0,
+		"Probability, from zero to one, that the proxy resets the connection instead of forwarding the request.")
+	flags.Float64Var(&proxyImpairment.TruncateRate, "proxy-truncate-rate", 0,
+		"Probability, from zero to one, that the proxy cuts the response body at a random point.")
+	flags.StringVar(&proxyRecord, "proxy-record", "",
+		"File where the proxy appends the metadata and timings of the requests forwarded to the '--upstream', one "+
+			"JSON document per line.")
+	flags.StringVar(&proxyReplay, "proxy-replay", "",
+		"File of exchanges recorded with '--proxy-record' that the proxy replays, sending synthetic responses with "+
+			"the recorded status, size and timings.")
+	flags.StringVar(&proxyFlags.Prefix, "proxy-prefix", dummy.DefaultProxyPrefix,
+		"Prefix of the paths handled by the proxy. It is removed before forwarding the requests.")
+	flags.BoolVar(&proxyFlags.Insecure, "proxy-insecure", false,
+		"Don't verify the TLS certificate of the upstream.")
+	flags.StringVar(&adminToken, "admin-token", os.Getenv(dummy.AdminTokenEnv), fmt.Sprintf(
+		"Bearer token required by the administration endpoints: '/scenario/trigger' and those under '/admin/'. "+
+			"When empty those endpoints are disabled. Default is the value of the '%s' environment variable.",
+		dummy.AdminTokenEnv,
+	))
+	flags.BoolVar(&allowRoot, "allow-root", false,
+		"Allow serving requests as root. Otherwise the server refuses to start as root without the '--user' flag.")
+	flags.StringVar(&serveDir, "serve-dir", "",
+		fmt.Sprintf("Directory containing real files that will be served in the '%s' path.", dummy.FilesPrefix))
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s serve [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Runs the server. This is the default when no command is given.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// Prepare the logger:
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	// Load the configuration, from the mounted configuration directory if no file has been given:
+	if configFile == "" {
+		configFile = dummy.FindMountedConfig()
+		if configFile != "" {
+			logger.Info(
+				"Using mounted configuration",
+				slog.String("file", configFile),
+			)
+		}
+	}
+	config := &dummy.Config{}
+	if configFile != "" {
+		var err error
+		config, err = dummy.LoadConfig(configFile)
+		if err != nil {
+			logger.Error(
+				"Failed to load configuration",
+				slog.String("file", configFile),
+				slog.String("error", err.Error()),
+			)
+			os.Exit(1)
+		}
+	}
+	if checkConfig {
+		logger.Info(
+			"Configuration is valid",
+			slog.String("file", configFile),
+		)
+		return
+	}
+
+	// Replace the logger with one that uses the configuration and the command line flags:
+	logging := config.Logging.Merge(logFlags)
+	configuredLogger, err := dummy.NewLogger(logging)
+	if err != nil {
+		logger.Error(
+			"Failed to create logger",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	logger = configuredLogger
+
+	// Restrict the processors before anything else starts, so that the rest of the threads inherit the affinity.
+	// The number of processors used by the runtime follows the affinity unless explicitly given.
+	if cpuList != "" {
+		cpus, err := dummy.ParseCPUList(cpuList)
+		if err == nil {
+			cpus, err = dummy.SetCPUAffinity(cpus)
+		}
+		if err != nil {
+			logger.Error(
+				"Failed to set processor affinity",
+				slog.String("cpus", cpuList),
+				slog.String("error", err.Error()),
+			)
+			os.Exit(1)
+		}
+		if gomaxprocs == 0 {
+			gomaxprocs = len(cpus)
+		}
+	}
+	if gomaxprocs > 0 {
+		runtime.GOMAXPROCS(gomaxprocs)
+	}
+
+	// Apply the command line flags that replace the settings of the configuration file. Note that the strict mode
+	// can only be enabled.
+	config.Logging = &logging
+	if sessionMode != "" {
+		if config.Sessions == nil {
+			config.Sessions = &dummy.SessionsConfig{}
+		}
+		config.Sessions.Mode = sessionMode
+	}
+	if corsOrigins != "" {
+		if config.CORS == nil {
+			config.CORS = &dummy.CORSConfig{}
+		}
+		config.CORS.AllowedOrigins = strings.Split(corsOrigins, ",")
+	}
+	config.Strict = config.Strict || strict
+	if maxBytesPerRequest != 0 || maxDuration != 0 {
+		if config.Limits == nil {
+			config.Limits = &dummy.LimitsConfig{}
+		}
+		if maxBytesPerRequest != 0 {
+			config.Limits.MaxBytesPerRequest = maxBytesPerRequest
+		}
+		if maxDuration != 0 {
+			config.Limits.MaxDuration = dummy.Duration(maxDuration)
+		}
+	}
+
+	if fleetPeers != "" || fleetFlags.DNS != "" || fleetFlags.Advertise != "" || fleetFlags.Insecure ||
+		fleetFlags.Token != "" {
+		if config.Fleet == nil {
+			config.Fleet = &dummy.FleetConfig{}
+		}
+		if fleetFlags.Advertise != "" {
+			config.Fleet.Advertise = fleetFlags.Advertise
+		}
+		if fleetPeers != "" {
+			config.Fleet.Peers = strings.Split(fleetPeers, ",")
+		}
+		if fleetFlags.DNS != "" {
+			config.Fleet.DNS = fleetFlags.DNS
+		}
+		config.Fleet.Insecure = config.Fleet.Insecure || fleetFlags.Insecure
+		if fleetFlags.Token != "" {
+			config.Fleet.Token = fleetFlags.Token
+		}
+	}
+	if meshInterval != 0 {
+		if config.Fleet == nil {
+			config.Fleet = &dummy.FleetConfig{}
+		}
+		if config.Fleet.Mesh == nil {
+			config.Fleet.Mesh = &dummy.MeshConfig{}
+		}
+		config.Fleet.Mesh.Interval = dummy.Duration(meshInterval)
+		config.Fleet.Mesh.Size = meshFlags.Size
+	}
+	if probeURLs != "" {
+		var alerts *dummy.ProbeAlertsConfig
+		if probeAlerts != (dummy.ProbeAlertsConfig{}) {
+			alerts = &probeAlerts
+		}
+		for _, probeURL := range strings.Split(probeURLs, ",") {
+			config.Probes = append(config.Probes, dummy.ProbeConfig{
+				URL:      probeURL,
+				Interval: dummy.Duration(probeInterval),
+				Insecure: probeFlags.Insecure,
+				Alerts:   alerts,
+			})
+		}
+	}
+	if historyFlags.File != "" {
+		if config.History == nil {
+			config.History = &dummy.HistoryConfig{}
+		}
+		config.History.File = historyFlags.File
+		config.History.Retention = dummy.Duration(historyRetention)
+	}
+	if influxFlags.URL != "" {
+		influxFlags.Type = dummy.ExporterTypeInfluxDB
+		influxFlags.Interval = dummy.Duration(exportInterval)
+		config.Exporters = append(config.Exporters, influxFlags)
+	}
+	if postgresFlags.URL != "" {
+		postgresFlags.Type = dummy.ExporterTypePostgres
+		postgresFlags.Interval = dummy.Duration(exportInterval)
+		config.Exporters = append(config.Exporters, postgresFlags)
+	}
+	switch {
+	case proxyRecord != "" && proxyReplay != "":
+		logger.Error("Flags '--proxy-record' and '--proxy-replay' can't be used together")
+		os.Exit(1)
+	case proxyRecord != "":
+		proxyFlags.Mode = dummy.ProxyModeRecord
+		proxyFlags.File = proxyRecord
+		config.Proxy = &proxyFlags
+	case proxyReplay != "":
+		proxyFlags.Mode = dummy.ProxyModeReplay
+		proxyFlags.File = proxyReplay
+		config.Proxy = &proxyFlags
+	case proxyFlags.Upstream != "":
+		proxyFlags.Mode = dummy.ProxyModeForward
+		proxyFlags.Impairment = &proxyImpairment
+		config.Proxy = &proxyFlags
+	}
+	if webhookURLs != "" {
+		for _, webhookURL := range strings.Split(webhookURLs, ",") {
+			config.Webhooks = append(config.Webhooks, dummy.WebhookConfig{
+				URL:    webhookURL,
+				Format: webhookFormat,
+			})
+		}
+	}
+
+	// Use the listeners from the configuration file, or else a single listener configured with the command line
+	// flags:
+	if len(config.Listeners) == 0 {
+		tcpFlags.NoDelay = &tcpNoDelay
+		tlsFlags.SessionTickets = &tlsSessionTickets
+		if tlsCipherSuites != "" {
+			tlsFlags.CipherSuites = strings.Split(tlsCipherSuites, ",")
+		}
+		var proxyTrustedList []string
+		if proxyTrusted != "" {
+			proxyTrustedList = strings.Split(proxyTrusted, ",")
+		}
+		network, address := "", dummy.DefaultListenAddress
+		if systemdSocket != "" {
+			network, address = dummy.NetworkSystemd, systemdSocket
+		}
+		config.Listeners = []dummy.ListenerConfig{{
+			Name:          "default",
+			Network:       network,
+			Address:       address,
+			TLS:           &tlsFlags,
+			Multiplex:     multiplex,
+			Raw:           multiplexRaw,
+			ProxyProtocol: proxyProtocol,
+			ProxyTrusted:  proxyTrustedList,
+			TCP:           &tcpFlags,
+			ReusePort:     reusePort,
+		}}
+	}
+
+	// Create the server:
+	server, err := dummy.NewServer(dummy.Options{
+		Logger:         logger,
+		Config:         config,
+		Headers:        http.Header(headers),
+		RandomSource:   randomSourceName,
+		RandomFile:     randomFile,
+		RandomFileSize: randomFileSize,
+		PinConnections: pinConnections,
+		User:           runUser,
+		Group:          runGroup,
+		AllowRoot:      allowRoot,
+		AdminToken:     adminToken,
+		ServeDir:       serveDir,
+		RawListeners: []dummy.RawListener{
+			{Network: "tcp", Mode: dummy.RawModeSend, Address: tcpSend, Backend: tcpSendBackend},
+			{Network: "tcp", Mode: dummy.RawModeSink, Address: tcpSink},
+			{Network: "udp", Mode: dummy.RawModeSend, Address: udpSend},
+			{Network: "udp", Mode: dummy.RawModeSink, Address: udpSink},
+		},
+		DatagramSize:      datagramSize,
+		UDPDuration:       udpDuration,
+		UDPRate:           udpRate,
+		UDPImpairment:     udpImpairment,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+		WriteTimeout:      writeTimeout,
+		Registerer:        prometheus.DefaultRegisterer,
+		Gatherer:          prometheus.DefaultGatherer,
+	})
+	if err != nil {
+		logger.Error(
+			"Failed to create server",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	defer server.Close()
+
+	// Serve till one of the listeners fails, or till the process receives a termination signal. In that case stop
+	// accepting connections and wait for the requests in progress. A second signal stops the process immediately.
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err = <-errs:
+		logger.Error(
+			"Failed to listen and serve",
+			slog.String("error", err.Error()),
+		)
+	case <-signals.Done():
+		stop()
+		logger.Info(
+			"Shutting down",
+			slog.String("timeout", shutdownTimeout.String()),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err = server.Shutdown(ctx)
+		if err != nil {
+			logger.Warn(
+				"Failed to wait for requests in progress",
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
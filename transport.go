@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// addTransportFlags adds to the given flag set the flags that configure the HTTP transport of the client and bench
+// commands. The protocol is the default value of the '--protocol' flag.
+func addTransportFlags(flags *flag.FlagSet, options *dummy.TransportOptions, protocol string) {
+	flags.BoolVar(&options.Insecure, "insecure", false, "Don't verify the TLS certificate of the server.")
+	flags.StringVar(&options.CAFile, "cacert", "",
+		"File containing the CA certificates used to verify the server. Default is the system trust store.")
+	flags.StringVar(&options.CertFile, "cert", "", "File containing the client certificate.")
+	flags.StringVar(&options.KeyFile, "key", "", "File containing the key of the client certificate.")
+	flags.StringVar(&options.Proxy, "proxy", "", "URL of the proxy, with scheme 'http', 'https', 'socks5' or "+
+		"'socks5h'. Default is to use the 'HTTP_PROXY' and 'HTTPS_PROXY' environment variables.")
+	flags.StringVar(&options.ProxyUser, "proxy-user", "",
+		"Credentials used to authenticate to the proxy, in the 'user:password' format.")
+	flags.BoolVar(&options.ProxyTunnel, "proxy-tunnel", false,
+		"Use the CONNECT method of the HTTP proxy also for plain text targets.")
+	flags.Var((*resolveFlag)(&options.Resolve), "resolve", "Use a fixed address for a host and port, in the "+
+		"'host:port:address' format. Can be repeated, or contain multiple values separated by commas.")
+	flags.StringVar(&options.Protocol, "protocol", protocol, fmt.Sprintf(
+		"HTTP version, '%s' or '%s'. Empty means negotiate it with the server.",
+		dummy.ProtocolHTTP1, dummy.ProtocolHTTP2,
+	))
+	flags.BoolVar(&options.DisableReuse, "no-reuse", false, "Open a new connection for each request.")
+	flags.DurationVar(&options.ConnectTimeout, "connect-timeout", 0,
+		"Maximum time to establish a connection. Zero means no limit.")
+	flags.DurationVar(&options.TLSTimeout, "tls-timeout", 0,
+		"Maximum time to complete the TLS handshake. Zero means no limit.")
+	flags.DurationVar(&options.ResponseTimeout, "response-timeout", 0,
+		"Maximum time to wait for the response headers. Zero means no limit.")
+	flags.DurationVar(&options.Timeout, "timeout", 0,
+		"Maximum duration of each request, including reading the body. Zero means no limit.")
+}
+
+// resolveFlag is a command line flag that can be repeated to add address overrides. The values are also separated by
+// commas, so that the flag can be passed again as a single value, for example to the Kubernetes job.
+type resolveFlag []string
+
+// String is the implementation of the flag.Value interface.
+func (f *resolveFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set is the implementation of the flag.Value interface.
+func (f *resolveFlag) Set(text string) error {
+	*f = append(*f, strings.Split(text, ",")...)
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/jhernand/dummy/pkg/dummy"
+)
+
+// VersionResult is the output of the 'version' command.
+type VersionResult struct {
+	Version  string `json:"version"`
+	Revision string `json:"revision,omitempty"`
+	Go       string `json:"go"`
+	Platform string `json:"platform"`
+}
+
+// versionMain is the entry point of the 'version' command.
+func versionMain(args []string) {
+	// Parse the command line:
+	flags := flag.NewFlagSet("version", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s version\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Prints the version of the binary as a JSON document.\n")
+	}
+	flags.Parse(args)
+
+	// Write the version:
+	version, revision := dummy.BuildVersion()
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(&VersionResult{
+		Version:  version,
+		Revision: revision,
+		Go:       runtime.Version(),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+	})
+}